@@ -0,0 +1,118 @@
+package main
+
+import (
+	"AscensionPath/internal/model"
+	"AscensionPath/internal/service"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// command 子命令
+type command struct {
+	usage string
+	run   func(args []string) error
+}
+
+// commands 一级子命令，不带子命令时执行serve
+var commands = map[string]command{
+	"serve":    {"启动Web服务(默认)", serve},
+	"user":     {"用户管理: create / disable / reset-password", runUser},
+	"invite":   {"注册邀请码: create / list", runInvite},
+	"env":      {"漏洞环境管理: import <目录> / list", runEnv},
+	"instance": {"实例管理: list / stop <实例ID>... / gc", runInstance},
+	"db":       {"数据库管理: migrate status|up|down / backup <文件>", runDB},
+}
+
+// runCommand 根据命令行参数执行子命令
+func runCommand(args []string) error {
+	if len(args) == 0 {
+		return serve(nil)
+	}
+	// 兼容旧的 migrate 命令
+	if args[0] == "migrate" {
+		return runMigrate(args[1:])
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		return fmt.Errorf("未知的命令: %s\n\n%s", args[0], commandUsage())
+	}
+	return cmd.run(args[1:])
+}
+
+// commandUsage 子命令帮助信息
+func commandUsage() string {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString("用法: main [全局参数] <命令> [参数]\n\n命令:\n")
+	for _, name := range names {
+		fmt.Fprintf(&b, "  %-10s %s\n", name, commands[name].usage)
+	}
+	b.WriteString("\n全局参数(如 -config)需写在命令之前，使用 -h 查看全部全局参数")
+	return b.String()
+}
+
+// usage 覆盖flag默认的帮助信息
+func usage() {
+	fmt.Fprintln(flag.CommandLine.Output(), commandUsage())
+	fmt.Fprintln(flag.CommandLine.Output(), "\n全局参数:")
+	flag.PrintDefaults()
+}
+
+// dispatch 执行二级子命令
+func dispatch(name string, args []string, subcommands map[string]func([]string) error, help string) error {
+	if len(args) == 0 {
+		return errors.New(help)
+	}
+	run, ok := subcommands[args[0]]
+	if !ok {
+		return fmt.Errorf("未知的 %s 命令: %s\n%s", name, args[0], help)
+	}
+	return run(args[1:])
+}
+
+// newFlagSet 创建子命令参数解析器，出错时返回错误而不是退出
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	return fs
+}
+
+// withDB 初始化数据库(执行迁移)并加载运行时配置和身份后执行fn
+func withDB(fn func() error) error {
+	model.InitDB()
+	defer model.CloseDB()
+	if err := service.LoadSettings(); err != nil {
+		return err
+	}
+	if err := service.Roles.Load(); err != nil {
+		return err
+	}
+	return fn()
+}
+
+// withDocker 检查Docker可用后执行fn
+func withDocker(fn func() error) error {
+	if ok, err := service.IsDockerAvailable(); !ok {
+		return fmt.Errorf("Docker不可用: %v", err)
+	}
+	return fn()
+}
+
+// cliOperator 命令行以管理员身份调用UserService
+func cliOperator() *service.UserService {
+	return &service.UserService{
+		UserDTO: service.UserDTO{
+			Username: "cli",
+			Role:     service.RoleAdmin,
+		},
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"AscensionPath/config"
+	"AscensionPath/internal/model"
+	"errors"
+	"fmt"
+)
+
+const dbUsage = `用法:
+  main db migrate status|up|down   数据库迁移
+  main db backup <文件>            备份SQLite数据库到指定文件`
+
+const migrateUsage = `用法:
+  main db migrate status                     查看迁移状态
+  main db migrate up [-to 版本] [-dry-run]   执行未执行的迁移
+  main db migrate down [-steps N] [-dry-run] 回滚最近的迁移`
+
+func runDB(args []string) error {
+	return dispatch("db", args, map[string]func([]string) error{
+		"migrate": runMigrate,
+		"backup":  dbBackup,
+	}, dbUsage)
+}
+
+// dbBackup 备份数据库，不执行迁移，可在升级前使用
+func dbBackup(args []string) error {
+	if len(args) != 1 {
+		return errors.New(dbUsage)
+	}
+	db, err := model.Open(config.Current().Database)
+	if err != nil {
+		return err
+	}
+	model.DB = db
+	defer model.CloseDB()
+
+	if err := model.Backup(args[0]); err != nil {
+		return err
+	}
+	fmt.Printf("已备份数据库到 %s\n", args[0])
+	return nil
+}
+
+// runMigrate 执行数据库迁移命令
+func runMigrate(args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	fs := newFlagSet("db migrate " + args[0])
+	dryRun := fs.Bool("dry-run", false, "只列出将要执行的迁移，不修改数据库")
+	target := fs.Int("to", 0, "迁移到的版本(0为最新版本)")
+	steps := fs.Int("steps", 1, "回滚的迁移数量")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	db, err := model.Open(config.Current().Database)
+	if err != nil {
+		return err
+	}
+	model.DB = db
+	defer model.CloseDB()
+
+	switch args[0] {
+	case "status":
+		states, err := model.MigrationStatus(db)
+		if err != nil {
+			return err
+		}
+		for _, s := range states {
+			status := "未执行"
+			if s.Applied {
+				status = "已执行 " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			if s.Unknown {
+				status += " (程序中不存在)"
+			}
+			fmt.Printf("%4d  %-30s %s\n", s.Version, s.Name, status)
+		}
+		return nil
+	case "up":
+		done, err := model.MigrateUp(db, *target, *dryRun)
+		printMigrations("执行", done, *dryRun)
+		return err
+	case "down":
+		done, err := model.MigrateDown(db, *steps, *dryRun)
+		printMigrations("回滚", done, *dryRun)
+		return err
+	default:
+		return fmt.Errorf("未知的迁移命令: %s\n%s", args[0], migrateUsage)
+	}
+}
+
+func printMigrations(action string, list []model.Migration, dryRun bool) {
+	if len(list) == 0 {
+		fmt.Println("没有需要" + action + "的迁移")
+		return
+	}
+	prefix := "已" + action
+	if dryRun {
+		prefix = "将" + action
+	}
+	for _, m := range list {
+		fmt.Printf("%s %d_%s\n", prefix, m.Version, m.Name)
+	}
+}
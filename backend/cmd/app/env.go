@@ -0,0 +1,65 @@
+package main
+
+import (
+	"AscensionPath/internal/service"
+	"errors"
+	"fmt"
+)
+
+const envUsage = `用法:
+  main env import <目录>   导入目录下的镜像列表(*.json)和compose环境(包含docker-compose.yml的子目录)
+  main env list            列出所有漏洞环境`
+
+func runEnv(args []string) error {
+	return dispatch("env", args, map[string]func([]string) error{
+		"import": envImport,
+		"list":   envList,
+	}, envUsage)
+}
+
+func envImport(args []string) error {
+	if len(args) != 1 {
+		return errors.New(envUsage)
+	}
+	return withDB(func() error {
+		return withDocker(func() error {
+			v := service.VulService{}
+			results, err := v.ImportVulEnvs(args[0])
+			if err != nil {
+				return err
+			}
+
+			failed := 0
+			for _, r := range results {
+				fmt.Printf("%-8s %-30s %s %s\n", r.Result, r.EnvName, r.Source, r.Error)
+				if r.Result == service.ImportFailed {
+					failed++
+				}
+			}
+			if failed > 0 {
+				return fmt.Errorf("%d 个环境导入失败", failed)
+			}
+			return nil
+		})
+	})
+}
+
+func envList(args []string) error {
+	return withDB(func() error {
+		v := service.VulService{}
+		// 开放级别大于-1即全部环境
+		envs, err := v.GetVulEnvList(-1)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%-5s %-30s %-8s %-6s %-6s %s\n", "ID", "名称", "类型", "花费", "开放", "镜像/compose")
+		for _, env := range envs {
+			source := env.Base_Image
+			if source == "" {
+				source = env.Base_compose
+			}
+			fmt.Printf("%-5d %-30s %-8s %-6.1f %-6d %s\n", env.ID, env.EnvName, env.EnvType, env.Cost, env.IsOpen, source)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"AscensionPath/internal/model"
+	"AscensionPath/internal/service"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+const instanceUsage = `用法:
+  main instance list                         列出所有实例
+  main instance stop <实例ID>...             停止并删除实例
+  main instance gc [-dry-run] [-orphans]     清理过期实例，-orphans 同时删除没有实例记录的容器/堆栈`
+
+func runInstance(args []string) error {
+	return dispatch("instance", args, map[string]func([]string) error{
+		"list": instanceList,
+		"stop": instanceStop,
+		"gc":   instanceGC,
+	}, instanceUsage)
+}
+
+func instanceList(args []string) error {
+	return withDB(func() error {
+		v := service.VulService{}
+		instances, err := v.GetAllVulInstances()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%-5s %-16s %-30s %-4s %-19s %s\n", "ID", "用户", "环境", "状态", "过期时间", "容器/堆栈")
+		for _, i := range instances {
+			target := i.ContainerID
+			if target == "" {
+				target = i.StackName
+			}
+			fmt.Printf("%-5d %-16s %-30s %-4d %-19s %s\n", i.ID, i.Username, i.EnvName, i.Status,
+				i.ExpireTime.Format("2006-01-02 15:04:05"), target)
+		}
+		return nil
+	})
+}
+
+func instanceStop(args []string) error {
+	if len(args) == 0 {
+		return errors.New(instanceUsage)
+	}
+	ids := make([]uint, 0, len(args))
+	for _, arg := range args {
+		id, err := strconv.ParseUint(arg, 10, 64)
+		if err != nil {
+			return fmt.Errorf("无效的实例ID: %s", arg)
+		}
+		ids = append(ids, uint(id))
+	}
+
+	return withDB(func() error {
+		return withDocker(func() error {
+			v := service.VulService{}
+			var errs []error
+			for _, id := range ids {
+				instance, err := model.GetVulInstanceByID(id)
+				if err != nil {
+					errs = append(errs, fmt.Errorf("实例 %d 不存在", id))
+					continue
+				}
+				if err := v.RemoveVulInstance(instance); err != nil {
+					errs = append(errs, fmt.Errorf("删除实例 %d 失败: %v", id, err))
+					continue
+				}
+				fmt.Printf("已删除实例 %d\n", id)
+			}
+			return errors.Join(errs...)
+		})
+	})
+}
+
+func instanceGC(args []string) error {
+	fs := newFlagSet("instance gc")
+	dryRun := fs.Bool("dry-run", false, "只列出将要清理的资源，不执行删除")
+	orphans := fs.Bool("orphans", false, "同时删除没有实例记录的容器/堆栈")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	prefix := "已删除"
+	if *dryRun {
+		prefix = "将删除"
+	}
+	return withDB(func() error {
+		return withDocker(func() error {
+			v := service.VulService{}
+			expired, err := v.CleanExpiredInstances(*dryRun)
+			for _, i := range expired {
+				fmt.Printf("%s过期实例 %d (用户ID: %d, 过期时间: %s)\n", prefix, i.ID, i.UserID,
+					i.ExpireTime.Format("2006-01-02 15:04:05"))
+			}
+			if err != nil {
+				return err
+			}
+			if !*orphans {
+				return nil
+			}
+
+			report, err := v.Reconcile(service.OrphanPolicyRemove, *dryRun)
+			if err != nil {
+				return err
+			}
+			for _, a := range report.Actions {
+				fmt.Printf("%-9s %-32s %s %s\n", a.Kind, a.Target, a.Action, a.Error)
+			}
+			return nil
+		})
+	})
+}
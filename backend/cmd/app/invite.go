@@ -0,0 +1,61 @@
+package main
+
+import (
+	"AscensionPath/internal/service"
+	"errors"
+	"fmt"
+)
+
+const inviteUsage = `用法:
+  main invite create [-role 身份名] [-score 初始积分] [-uses 可使用次数] [-days 有效天数] [-note 备注]
+  main invite list`
+
+func runInvite(args []string) error {
+	return dispatch("invite", args, map[string]func([]string) error{
+		"create": inviteCreate,
+		"list":   inviteList,
+	}, inviteUsage)
+}
+
+func inviteCreate(args []string) error {
+	fs := newFlagSet("invite create")
+	role := fs.String("role", service.RoleUser, "使用邀请码注册的账号获得的身份")
+	score := fs.Float64("score", 0, "使用邀请码注册的账号的初始积分")
+	uses := fs.Int("uses", 1, "邀请码可以使用的次数")
+	days := fs.Int("days", 7, "有效天数，0为不过期")
+	note := fs.String("note", "", "备注，如班级名称")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return errors.New(inviteUsage)
+	}
+
+	return withDB(func() error {
+		invite, err := cliOperator().CreateInviteCode(*role, *score, *uses, *days, *note)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("已生成邀请码 %s (身份: %s, 可使用 %d 次)\n", invite.Code, invite.Role, invite.MaxUses)
+		return nil
+	})
+}
+
+func inviteList(args []string) error {
+	return withDB(func() error {
+		invites, err := cliOperator().ListInviteCodes()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%-5s %-14s %-10s %-6s %-7s %-16s %s\n", "ID", "邀请码", "身份", "积分", "已使用", "过期时间", "备注")
+		for _, i := range invites {
+			expires := "不过期"
+			if i.ExpiresAt != nil {
+				expires = i.ExpiresAt.Format("2006-01-02 15:04")
+			}
+			fmt.Printf("%-5d %-14s %-10s %-6g %-7s %-16s %s\n", i.ID, i.Code, i.Role, i.Score,
+				fmt.Sprintf("%d/%d", i.UsedCount, i.MaxUses), expires, i.Note)
+		}
+		return nil
+	})
+}
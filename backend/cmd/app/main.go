@@ -1,29 +1,100 @@
 package main
 
 import (
+	"AscensionPath/config"
 	"AscensionPath/internal/handler"
 	"AscensionPath/internal/middleware"
 	"AscensionPath/internal/model"
+	"AscensionPath/internal/service"
+	"context"
 	"embed"
 	"flag"
+	"fmt"
 	"io/fs"
 	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
 
 	"github.com/gin-gonic/gin"
 )
 
 func main() {
-	port := flag.String("port", "8080", "服务器监听的端口号")
+	config.RegisterFlags(flag.CommandLine)
+	flag.Usage = usage
 	flag.Parse()
 
 	// 1. 初始化配置
-	// config.Load()
-	gin.SetMode(gin.ReleaseMode)
+	if err := config.Load(); err != nil {
+		panic("加载配置失败: " + err.Error())
+	}
+	middleware.InitLogger(config.Current().Log)
+
+	if err := runCommand(flag.Args()); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// serve 启动Web服务，收到退出信号后优雅停机
+func serve(args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("serve 不接受参数: %v", args)
+	}
+	gin.SetMode(config.Current().Server.Mode)
+	port := strconv.Itoa(config.Current().Server.Port)
 
 	// 2. 初始化数据库
 	model.InitDB()
 	defer model.CloseDB()
 
+	// 加载管理员在运行时修改的配置
+	if err := service.LoadSettings(); err != nil {
+		return err
+	}
+
+	// 加载JWT签名密钥
+	if err := service.JwtKeys.Load(); err != nil {
+		return err
+	}
+
+	// 加载身份和权限
+	if err := service.Roles.Load(); err != nil {
+		return err
+	}
+
+	// 首次启动初始化管理员
+	setupToken, err := service.BootstrapAdmin()
+	if err != nil {
+		return err
+	}
+	if setupToken != "" {
+		fmt.Printf("\n系统尚未创建管理员，请使用以下一次性初始化令牌调用 POST /api/v1/setup 创建管理员:\n\n    %s\n\n", setupToken)
+	}
+
+	// 获取所有已经创建的漏洞环境依赖镜像
+	if err := service.GetDependentImages(); err != nil {
+		middleware.SugarLogger.Errorf("获取依赖镜像列表失败: %v", err)
+	}
+
+	// 对账实例记录与Docker状态
+	if config.Current().Reconcile.OnStartup {
+		reconcileOnStartup()
+	}
+
+	// 启动后台任务
+	jobCtx, stopJobs := context.WithCancel(context.Background())
+	service.StartMonitorExpiredInstances(jobCtx)
+	service.StartJwtKeyRotation(jobCtx)
+	service.StartSessionCleanup(jobCtx)
+	service.StartLoginCleanup(jobCtx)
+	service.StartAPITokenCleanup(jobCtx)
+	service.StartOIDCCleanup(jobCtx)
+	service.StartRoleSync(jobCtx)
+	service.StartPasswordResetCleanup(jobCtx)
+	service.StartEmailVerificationCleanup(jobCtx)
+
 	// 3. 创建Gin实例
 	r := gin.Default()
 
@@ -36,12 +107,71 @@ func main() {
 	// 6. 设置嵌入的静态文件服务
 	setupEmbeddedStaticFiles(r)
 
-	println("服务器已启动，监听端口：" + *port)
 	// 7. 启动服务
-	err := r.Run(":" + *port)
+	srv := &http.Server{
+		Addr:    ":" + port,
+		Handler: r,
+	}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			panic("无法启动服务器: " + err.Error())
+		}
+	}()
+	println("服务器已启动，监听端口：" + port)
+
+	// 8. 等待退出信号并优雅停机
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	sig := <-quit
+	middleware.SugarLogger.Infof("收到信号 %v，开始停机", sig)
+	shutdown(srv, stopJobs)
+	return nil
+}
+
+// reconcileOnStartup 启动时修正崩溃或手动删除容器导致的实例状态偏差
+func reconcileOnStartup() {
+	if ok, _ := service.IsDockerAvailable(); !ok {
+		middleware.SugarLogger.Warn("Docker不可用，跳过启动对账")
+		return
+	}
+	v := service.VulService{}
+	report, err := v.Reconcile(config.Current().Reconcile.OrphanPolicy, false)
 	if err != nil {
-		panic("无法启动服务器: " + err.Error())
+		middleware.SugarLogger.Errorf("启动对账失败: %v", err)
+		return
+	}
+	for _, action := range report.Actions {
+		middleware.SugarLogger.Infow("启动对账", "kind", action.Kind, "target", action.Target, "action", action.Action, "error", action.Error)
+	}
+}
+
+// shutdown 停止接收请求，等待进行中的操作完成，停止后台任务并按策略处理实例
+func shutdown(srv *http.Server, stopJobs context.CancelFunc) {
+	ctx, cancel := context.WithTimeout(context.Background(), config.Current().Shutdown.Timeout.Std())
+	defer cancel()
+
+	// 停止接收新请求并等待进行中的HTTP请求完成
+	if err := srv.Shutdown(ctx); err != nil {
+		middleware.SugarLogger.Errorf("关闭HTTP服务失败: %v", err)
+	}
+
+	// 等待WebSocket中的镜像拉取/构建完成
+	if err := service.DrainOperations(ctx); err != nil {
+		middleware.SugarLogger.Errorf("等待镜像拉取/构建完成失败: %v", err)
 	}
+
+	// 停止后台任务
+	stopJobs()
+	service.WaitBackgroundJobs()
+
+	// 按策略处理运行中的实例
+	v := service.VulService{}
+	if err := v.ApplyShutdownPolicy(config.Current().Shutdown.InstancePolicy); err != nil {
+		middleware.SugarLogger.Errorf("处理运行中的实例失败: %v", err)
+	}
+
+	middleware.SugarLogger.Info("服务已停止")
+	middleware.SugarLogger.Sync()
 }
 
 //go:embed dist/*
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"AscensionPath/internal/model"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+const userUsage = `用法:
+  main user create -username 用户名 -password 密码 -email 邮箱 [-role 身份名] [-must-change-password=false]
+  main user disable <用户名>
+  main user reset-password <用户名> [-password 新密码]   不指定密码时随机生成，用户下次登录必须修改
+  main user unlock [<用户名>] [-ip IP]                  解除登录失败次数过多导致的锁定
+  main user reset-2fa <用户名>                          关闭两步验证(用户丢失验证器时使用)`
+
+func runUser(args []string) error {
+	return dispatch("user", args, map[string]func([]string) error{
+		"create":         userCreate,
+		"disable":        userDisable,
+		"reset-password": userResetPassword,
+		"unlock":         userUnlock,
+		"reset-2fa":      userResetTwoFactor,
+	}, userUsage)
+}
+
+func userCreate(args []string) error {
+	fs := newFlagSet("user create")
+	username := fs.String("username", "", "用户名")
+	password := fs.String("password", "", "密码")
+	email := fs.String("email", "", "邮箱")
+	role := fs.String("role", "user", "身份，如 user、vip、admin 或管理员创建的身份")
+	mustChange := fs.Bool("must-change-password", true, "首次登录是否必须修改密码")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *username == "" || *password == "" || *email == "" {
+		return errors.New("username、password、email 不能为空\n" + userUsage)
+	}
+
+	return withDB(func() error {
+		user := model.User{
+			Username: *username,
+			Password: *password,
+			Email:    *email,
+			Role:     *role,
+			Status:   1,
+
+			MustChangePassword: *mustChange,
+		}
+		if err := cliOperator().AddUser(&user); err != nil {
+			return err
+		}
+		fmt.Printf("已创建用户 %s (ID: %d, 身份: %s)\n", user.Username, user.ID, user.Role)
+		return nil
+	})
+}
+
+func userDisable(args []string) error {
+	if len(args) != 1 {
+		return errors.New(userUsage)
+	}
+	return withDB(func() error {
+		user, err := model.GetUserByUsername(args[0])
+		if err != nil {
+			return fmt.Errorf("用户 %s 不存在", args[0])
+		}
+		if err := cliOperator().UpdateProfile(user.ID, "", 0, "", -1, "", ""); err != nil {
+			return err
+		}
+		fmt.Printf("已禁用用户 %s\n", user.Username)
+		return nil
+	})
+}
+
+func userResetPassword(args []string) error {
+	if len(args) == 0 {
+		return errors.New(userUsage)
+	}
+	username := args[0]
+	fs := newFlagSet("user reset-password")
+	password := fs.String("password", "", "新密码，为空时随机生成")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	generated := *password == ""
+	if generated {
+		buf := make([]byte, 12)
+		if _, err := rand.Read(buf); err != nil {
+			return err
+		}
+		*password = base64.RawURLEncoding.EncodeToString(buf)
+	}
+
+	return withDB(func() error {
+		user, err := model.GetUserByUsername(username)
+		if err != nil {
+			return fmt.Errorf("用户 %s 不存在", username)
+		}
+		if err := cliOperator().ChangePassword(user.ID, "", *password); err != nil {
+			return err
+		}
+		if generated {
+			fmt.Printf("已重置用户 %s 的密码: %s\n", user.Username, *password)
+		} else {
+			fmt.Printf("已重置用户 %s 的密码\n", user.Username)
+		}
+		fmt.Println("用户下次登录后必须修改密码")
+		return nil
+	})
+}
+
+func userUnlock(args []string) error {
+	var username string
+	if len(args) > 0 && args[0] != "" && args[0][0] != '-' {
+		username, args = args[0], args[1:]
+	}
+	fs := newFlagSet("user unlock")
+	ip := fs.String("ip", "", "同时解除该IP的锁定")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if username == "" && *ip == "" {
+		return errors.New(userUsage)
+	}
+	return withDB(func() error {
+		if err := cliOperator().UnlockLogin(username, *ip); err != nil {
+			return err
+		}
+		fmt.Println("已解除锁定")
+		return nil
+	})
+}
+
+func userResetTwoFactor(args []string) error {
+	if len(args) != 1 {
+		return errors.New(userUsage)
+	}
+	return withDB(func() error {
+		user, err := model.GetUserByUsername(args[0])
+		if err != nil {
+			return fmt.Errorf("用户 %s 不存在", args[0])
+		}
+		if err := cliOperator().ResetTwoFactor(user.ID); err != nil {
+			return err
+		}
+		fmt.Printf("已关闭用户 %s 的两步验证\n", user.Username)
+		return nil
+	})
+}
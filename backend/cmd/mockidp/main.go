@@ -0,0 +1,52 @@
+// mockidp 本地联调单点登录用的OpenID Connect IdP，支持授权码 + PKCE(S256)。
+// 不校验密码，授权页直接列出预置用户，仅用于开发和测试，不要在生产环境使用。
+//
+//	go run ./cmd/mockidp -users "alice:alice@example.edu:students;tom:tom@example.edu:teachers,it-admins"
+//
+// 授权请求带 login_hint=<用户名> 时跳过选择页直接登录，便于脚本测试。
+package main
+
+import (
+	"AscensionPath/internal/mockidp"
+	"flag"
+	"log"
+	"net/http"
+	"strings"
+)
+
+func main() {
+	addr := flag.String("addr", "127.0.0.1:9000", "监听地址")
+	issuer := flag.String("issuer", "", "issuer地址，默认为 http://<addr>")
+	clientID := flag.String("client-id", "ascension-path", "允许的客户端ID")
+	clientSecret := flag.String("client-secret", "", "客户端密钥，为空时按公共客户端处理")
+	users := flag.String("users", "alice:alice@example.edu:students;tom:tom@example.edu:teachers,it-admins",
+		"预置用户，格式为 用户名:邮箱:用户组1,用户组2，多个用户用分号分隔")
+	flag.Parse()
+
+	if *issuer == "" {
+		*issuer = "http://" + *addr
+	}
+	server, err := mockidp.New(*issuer, *clientID, *clientSecret, parseUsers(*users))
+	if err != nil {
+		log.Fatalf("启动失败: %v", err)
+	}
+
+	log.Printf("mock IdP 已启动: %s (client_id=%s, 用户数=%d)", server.Issuer, server.ClientID, len(server.Users))
+	log.Fatal(http.ListenAndServe(*addr, server.Handler()))
+}
+
+func parseUsers(spec string) []mockidp.User {
+	var users []mockidp.User
+	for _, item := range strings.Split(spec, ";") {
+		parts := strings.SplitN(strings.TrimSpace(item), ":", 3)
+		if len(parts) < 2 || parts[0] == "" {
+			continue
+		}
+		user := mockidp.User{Username: parts[0], Email: parts[1]}
+		if len(parts) == 3 && parts[2] != "" {
+			user.Groups = strings.Split(parts[2], ",")
+		}
+		users = append(users, user)
+	}
+	return users
+}
@@ -0,0 +1,56 @@
+// mockldap 本地联调LDAP登录用的内存LDAP服务器，仅用于开发和测试，不要在生产环境使用。
+//
+//	go run ./cmd/mockldap -users "alice:alice123:alice@example.edu:students;tom:tom123:tom@example.edu:teachers,it"
+//
+// 服务账号为 cn=readonly,<base>，用户为 uid=<用户名>,ou=people,<base>，组为 cn=<组名>,ou=groups,<base>。
+package main
+
+import (
+	"AscensionPath/internal/mockldap"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+)
+
+func main() {
+	addr := flag.String("addr", "127.0.0.1:3890", "监听地址")
+	base := flag.String("base", "dc=example,dc=edu", "目录根DN")
+	bindPassword := flag.String("bind-password", "readonly", "服务账号 cn=readonly,<base> 的密码")
+	users := flag.String("users", "alice:alice123:alice@example.edu:students;tom:tom123:tom@example.edu:teachers,it",
+		"预置用户，格式为 用户名:密码:邮箱:组1,组2，多个用户用分号分隔")
+	flag.Parse()
+
+	entries := mockldap.Directory(*base, *bindPassword, parseUsers(*users))
+	server, err := mockldap.Start(*addr, entries)
+	if err != nil {
+		log.Fatalf("启动失败: %v", err)
+	}
+	log.Printf("mock LDAP 已启动: %s (base=%s, 条目数=%d)", server.URL(), *base, len(entries))
+	for _, e := range entries {
+		log.Printf("  %s", e.DN)
+	}
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+	server.Close()
+}
+
+func parseUsers(spec string) []mockldap.User {
+	var users []mockldap.User
+	for _, item := range strings.Split(spec, ";") {
+		parts := strings.SplitN(strings.TrimSpace(item), ":", 4)
+		if len(parts) < 3 || parts[0] == "" {
+			continue
+		}
+		user := mockldap.User{Username: parts[0], Password: parts[1], Email: parts[2]}
+		if len(parts) == 4 && parts[3] != "" {
+			user.Groups = strings.Split(parts[3], ",")
+		}
+		users = append(users, user)
+	}
+	return users
+}
@@ -1,40 +1,441 @@
 package config
 
 import (
+	"strings"
+	"sync/atomic"
 	"time"
+)
+
+// current 当前生效的配置。Load和SetRuntime在副本上修改后整体替换，读取时不需要加锁
+var current atomic.Pointer[Config]
+
+func init() {
+	current.Store(Default())
+}
+
+// Current 返回当前生效的配置，调用方不应修改返回的配置
+func Current() *Config {
+	return current.Load()
+}
+
+// Set 替换当前生效的配置
+func Set(cfg *Config) {
+	current.Store(cfg)
+}
+
+// Config 平台配置
+type Config struct {
+	Server    ServerConfig    `yaml:"server" toml:"server"`
+	Database  DatabaseConfig  `yaml:"database" toml:"database"`
+	Log       LogConfig       `yaml:"log" toml:"log"`
+	Storage   StorageConfig   `yaml:"storage" toml:"storage"`
+	Instance  InstanceConfig  `yaml:"instance" toml:"instance"`
+	Flag      FlagConfig      `yaml:"flag" toml:"flag"`
+	Jwt       JwtConfig       `yaml:"jwt" toml:"jwt"`
+	Shutdown  ShutdownConfig  `yaml:"shutdown" toml:"shutdown"`
+	Reconcile ReconcileConfig `yaml:"reconcile" toml:"reconcile"`
+	Setup     SetupConfig     `yaml:"setup" toml:"setup"`
+
+	Registration RegistrationConfig `yaml:"registration" toml:"registration"`
+	Health       HealthConfig       `yaml:"health" toml:"health"`
+	Session      SessionConfig      `yaml:"session" toml:"session"`
+	Login        LoginConfig        `yaml:"login" toml:"login"`
+	TwoFactor    TwoFactorConfig    `yaml:"two_factor" toml:"two_factor"`
+	APIToken     APITokenConfig     `yaml:"api_token" toml:"api_token"`
+	OIDC         OIDCConfig         `yaml:"oidc" toml:"oidc"`
+	LDAP         LDAPConfig         `yaml:"ldap" toml:"ldap"`
+
+	Password      PasswordConfig      `yaml:"password" toml:"password"`
+	PasswordReset PasswordResetConfig `yaml:"password_reset" toml:"password_reset"`
+	Mail          MailConfig          `yaml:"mail" toml:"mail"`
+	Security      SecurityConfig      `yaml:"security" toml:"security"`
+	Scoreboard    ScoreboardConfig    `yaml:"scoreboard" toml:"scoreboard"`
+}
+
+// ServerConfig HTTP服务配置
+type ServerConfig struct {
+	Port int    `yaml:"port" toml:"port"` // 监听端口
+	Mode string `yaml:"mode" toml:"mode"` // gin运行模式(release/debug/test)
+}
+
+// DatabaseConfig 数据库配置
+type DatabaseConfig struct {
+	DSN             string   `yaml:"dsn" toml:"dsn"`                             // 数据库连接串
+	MaxIdleConns    int      `yaml:"max_idle_conns" toml:"max_idle_conns"`       // 最大空闲连接数
+	MaxOpenConns    int      `yaml:"max_open_conns" toml:"max_open_conns"`       // 最大打开连接数
+	ConnMaxLifetime Duration `yaml:"conn_max_lifetime" toml:"conn_max_lifetime"` // 连接最大存活时间
+	AutoMigrate     bool     `yaml:"auto_migrate" toml:"auto_migrate"`           // 启动时是否自动执行数据库迁移
+}
+
+// LogConfig 日志配置
+type LogConfig struct {
+	Level      string `yaml:"level" toml:"level"`             // 日志级别(debug/info/warn/error)
+	File       string `yaml:"file" toml:"file"`               // 日志文件路径
+	MaxSize    int    `yaml:"max_size" toml:"max_size"`       // 单个日志文件最大尺寸(MB)
+	MaxBackups int    `yaml:"max_backups" toml:"max_backups"` // 保留的旧日志文件数量
+	MaxAge     int    `yaml:"max_age" toml:"max_age"`         // 旧日志文件保留天数
+	Compress   bool   `yaml:"compress" toml:"compress"`       // 是否压缩旧日志
+}
 
-	"github.com/google/uuid"
+// StorageConfig 镜像存储配置
+type StorageConfig struct {
+	ImagePath string `yaml:"image_path" toml:"image_path"` // 本地镜像存储路径
+	Proxy     string `yaml:"proxy" toml:"proxy"`           // 拉取镜像时使用的代理
+}
+
+// InstanceConfig 场景实例配置
+type InstanceConfig struct {
+	DefaultExpiration Duration `yaml:"default_expiration" toml:"default_expiration"` // 场景默认过期时间
+	ExtendDuration    Duration `yaml:"extend_duration" toml:"extend_duration"`       // 每次延长的时间
+	MaxExtensions     int      `yaml:"max_extensions" toml:"max_extensions"`         // 每个实例最多延长次数，0表示不限制
+}
+
+// FlagConfig 实例flag配置，每个实例创建时生成随机flag并注入到所有容器中
+type FlagConfig struct {
+	Prefix string `yaml:"prefix" toml:"prefix"` // flag前缀，生成的flag形如 prefix{32位十六进制}
+	Env    string `yaml:"env" toml:"env"`       // 注入flag的环境变量名，为空时不注入
+	File   string `yaml:"file" toml:"file"`     // 容器内写入flag的文件路径(绝对路径)，为空时不写入
+}
+
+// ScoreboardConfig 排行榜配置
+type ScoreboardConfig struct {
+	CacheTTL Duration `yaml:"cache_ttl" toml:"cache_ttl"` // 排行榜缓存时间，有新的解出时立即失效，0表示不缓存
+}
+
+// JwtConfig JWT签名密钥配置
+type JwtConfig struct {
+	RotateInterval Duration `yaml:"rotate_interval" toml:"rotate_interval"` // 自动轮换周期，0表示仅手动轮换
+	GracePeriod    Duration `yaml:"grace_period" toml:"grace_period"`       // 轮换后旧密钥的宽限期
+}
+
+// ShutdownConfig 停机配置
+type ShutdownConfig struct {
+	Timeout        Duration `yaml:"timeout" toml:"timeout"`                 // 等待请求、镜像拉取/构建完成的最长时间
+	InstancePolicy string   `yaml:"instance_policy" toml:"instance_policy"` // 运行中实例的处理策略(keep/stop/remove)
+}
+
+// ReconcileConfig 实例与Docker状态对账配置
+type ReconcileConfig struct {
+	OnStartup    bool   `yaml:"on_startup" toml:"on_startup"`       // 启动时是否对账
+	OrphanPolicy string `yaml:"orphan_policy" toml:"orphan_policy"` // 孤儿容器/堆栈的处理策略(report/remove/adopt)
+}
+
+// SetupConfig 首次启动初始化配置，没有管理员时使用该账号创建管理员
+type SetupConfig struct {
+	AdminUsername string `yaml:"admin_username" toml:"admin_username"` // 管理员用户名
+	AdminPassword string `yaml:"admin_password" toml:"admin_password"` // 管理员密码，为空时生成一次性初始化令牌
+	AdminEmail    string `yaml:"admin_email" toml:"admin_email"`       // 管理员邮箱
+}
+
+// 注册方式
+const (
+	RegistrationClosed = "closed" // 关闭注册
+	RegistrationOpen   = "open"   // 任何人都可以注册
+	RegistrationInvite = "invite" // 只能使用邀请码注册
+	RegistrationDomain = "domain" // 只允许指定域名的邮箱注册，使用邀请码时不受限制
 )
 
-var Proxy string = ""
+// 注册后的账号激活方式
+const (
+	ActivationAdmin = "admin" // 管理员启用，使用邀请码注册时直接启用
+	ActivationEmail = "email" // 点击验证邮件中的链接后启用
+	ActivationNone  = "none"  // 注册后直接启用
+)
 
-// JwtSecretKey 用于签名JWT的密钥
-var JwtSecretKey []byte
+// RegistrationConfig 用户注册配置
+type RegistrationConfig struct {
+	Open           bool     `yaml:"open" toml:"open"`                       // 已弃用，未设置mode时 false 等同于 mode: closed
+	Mode           string   `yaml:"mode" toml:"mode"`                       // 注册方式(closed/open/invite/domain)
+	AllowedDomains string   `yaml:"allowed_domains" toml:"allowed_domains"` // domain方式允许的邮箱域名，逗号分隔，*.example.edu 匹配所有子域名
+	Activation     string   `yaml:"activation" toml:"activation"`           // 激活方式(admin/email/none)
+	VerifyTTL      Duration `yaml:"verify_ttl" toml:"verify_ttl"`           // 验证邮件中链接的有效期
+	VerifyURL      string   `yaml:"verify_url" toml:"verify_url"`           // 前端验证邮箱页面的地址，令牌以 token 参数附加
+}
 
-// 本地镜像存储路径
-var LocalImagePath string = "./storage"
+// EffectiveMode 实际使用的注册方式，兼容只配置了 open 的旧配置文件
+func (r RegistrationConfig) EffectiveMode() string {
+	if r.Mode != "" {
+		return r.Mode
+	}
+	if r.Open {
+		return RegistrationOpen
+	}
+	return RegistrationClosed
+}
 
-// 场景默认过期时间
-var DefaultExpirationTime time.Duration = 30 * time.Minute
+// Domains 解析允许注册的邮箱域名
+func (r RegistrationConfig) Domains() []string {
+	var domains []string
+	for _, d := range strings.Split(r.AllowedDomains, ",") {
+		if d = strings.ToLower(strings.TrimSpace(d)); d != "" {
+			domains = append(domains, d)
+		}
+	}
+	return domains
+}
 
-func init() {
-	// 初始化密钥
-	refreshJwtKey()
-
-	// 启动定时任务，每天凌晨2点刷新密钥
-	go func() {
-		for {
-			now := time.Now()
-			next := now.AddDate(0, 0, 1)
-			next = time.Date(next.Year(), next.Month(), next.Day(), 2, 0, 0, 0, next.Location())
-			t := time.NewTimer(next.Sub(now))
-			<-t.C
-			refreshJwtKey()
+// HealthConfig 健康检查配置
+type HealthConfig struct {
+	CheckTimeout Duration `yaml:"check_timeout" toml:"check_timeout"` // 单次检查的超时时间
+	MinFreeDisk  int      `yaml:"min_free_disk" toml:"min_free_disk"` // 镜像存储目录和Docker数据目录的最小剩余空间(MB)
+}
+
+// SessionConfig 登录会话配置
+type SessionConfig struct {
+	AccessTTL  Duration `yaml:"access_ttl" toml:"access_ttl"`   // 访问令牌有效期
+	RefreshTTL Duration `yaml:"refresh_ttl" toml:"refresh_ttl"` // 刷新令牌有效期，超过该时间未刷新需重新登录
+}
+
+// LoginConfig 登录防暴力破解配置
+type LoginConfig struct {
+	MaxAttempts      int      `yaml:"max_attempts" toml:"max_attempts"`           // 同一账号连续失败多少次后锁定
+	IPMaxAttempts    int      `yaml:"ip_max_attempts" toml:"ip_max_attempts"`     // 同一IP在统计窗口内失败多少次后锁定
+	Window           Duration `yaml:"window" toml:"window"`                       // 失败次数统计窗口，超过该时间没有失败则重新计数
+	BaseDelay        Duration `yaml:"base_delay" toml:"base_delay"`               // 账号失败后的初始等待时间，之后每次失败翻倍
+	LockoutDuration  Duration `yaml:"lockout_duration" toml:"lockout_duration"`   // 锁定时长
+	HistoryRetention Duration `yaml:"history_retention" toml:"history_retention"` // 登录记录保留时长，0表示永久保留
+}
+
+// TwoFactorConfig 两步验证配置
+type TwoFactorConfig struct {
+	Issuer        string `yaml:"issuer" toml:"issuer"`                 // 验证器App中显示的服务名称
+	RequiredRoles string `yaml:"required_roles" toml:"required_roles"` // 必须启用两步验证的身份，多个用逗号分隔
+}
+
+// Requires 判断该身份是否必须启用两步验证
+func (c TwoFactorConfig) Requires(role string) bool {
+	for _, r := range strings.Split(c.RequiredRoles, ",") {
+		if strings.TrimSpace(r) == role {
+			return true
+		}
+	}
+	return false
+}
+
+// APITokenConfig 个人访问令牌配置
+type APITokenConfig struct {
+	MaxTTL         Duration `yaml:"max_ttl" toml:"max_ttl"`                 // 令牌最长有效期
+	UsageRetention Duration `yaml:"usage_retention" toml:"usage_retention"` // 令牌使用记录保留时长，0表示永久保留
+}
+
+// OIDCConfig OpenID Connect单点登录配置
+type OIDCConfig struct {
+	Enabled       bool   `yaml:"enabled" toml:"enabled"`               // 是否启用单点登录
+	DisplayName   string `yaml:"display_name" toml:"display_name"`     // 登录页按钮上显示的名称
+	Issuer        string `yaml:"issuer" toml:"issuer"`                 // IdP地址，从 {issuer}/.well-known/openid-configuration 获取端点
+	ClientID      string `yaml:"client_id" toml:"client_id"`           // 在IdP注册的客户端ID
+	ClientSecret  string `yaml:"client_secret" toml:"client_secret"`   // 客户端密钥，公共客户端留空
+	RedirectURL   string `yaml:"redirect_url" toml:"redirect_url"`     // 回调地址，指向 /api/v1/users/oidc/callback
+	Scopes        string `yaml:"scopes" toml:"scopes"`                 // 请求的scope，空格分隔
+	FrontendURL   string `yaml:"frontend_url" toml:"frontend_url"`     // 登录完成后跳转的前端地址
+	RoleClaim     string `yaml:"role_claim" toml:"role_claim"`         // 用于映射身份的claim，值可以是字符串或字符串数组
+	RoleMapping   string `yaml:"role_mapping" toml:"role_mapping"`     // claim值到身份的映射，如 teachers=vip,it-admins=admin
+	DefaultRole   string `yaml:"default_role" toml:"default_role"`     // 没有匹配的映射时使用的身份
+	AutoProvision bool   `yaml:"auto_provision" toml:"auto_provision"` // 首次登录时是否自动创建账号
+	LinkByEmail   bool   `yaml:"link_by_email" toml:"link_by_email"`   // 是否按已验证的邮箱关联已有账号
+	SyncRole      bool   `yaml:"sync_role" toml:"sync_role"`           // 每次登录时是否按映射更新已有账号的身份
+}
+
+// LDAPConfig LDAP/Active Directory登录配置
+type LDAPConfig struct {
+	Enabled            bool     `yaml:"enabled" toml:"enabled"`                           // 是否启用LDAP登录
+	URL                string   `yaml:"url" toml:"url"`                                   // 服务器地址，ldap://host:389 或 ldaps://host:636
+	StartTLS           bool     `yaml:"start_tls" toml:"start_tls"`                       // ldap:// 连接后是否升级为TLS
+	InsecureSkipVerify bool     `yaml:"insecure_skip_verify" toml:"insecure_skip_verify"` // 是否跳过服务器证书校验，仅用于测试
+	Timeout            Duration `yaml:"timeout" toml:"timeout"`                           // 连接和请求的超时时间
+	BindDN             string   `yaml:"bind_dn" toml:"bind_dn"`                           // 查找用户使用的服务账号，为空时匿名查找
+	BindPassword       string   `yaml:"bind_password" toml:"bind_password"`               // 服务账号密码
+	UserBaseDN         string   `yaml:"user_base_dn" toml:"user_base_dn"`                 // 查找用户的起点
+	UserFilter         string   `yaml:"user_filter" toml:"user_filter"`                   // 查找用户的过滤器，%s替换为转义后的用户名
+	EmailAttribute     string   `yaml:"email_attribute" toml:"email_attribute"`           // 邮箱属性
+	GroupAttribute     string   `yaml:"group_attribute" toml:"group_attribute"`           // 用户条目上记录所属组DN的属性
+	GroupBaseDN        string   `yaml:"group_base_dn" toml:"group_base_dn"`               // 设置后按group_filter查找用户所属的组，用于没有memberOf的服务器
+	GroupFilter        string   `yaml:"group_filter" toml:"group_filter"`                 // 查找组的过滤器，%s替换为转义后的用户DN
+	RoleMapping        string   `yaml:"role_mapping" toml:"role_mapping"`                 // 组DN到身份的映射，分号分隔，如 cn=teachers,ou=groups,dc=example,dc=edu=vip
+	DefaultRole        string   `yaml:"default_role" toml:"default_role"`                 // 没有匹配的映射时使用的身份
+	AutoProvision      bool     `yaml:"auto_provision" toml:"auto_provision"`             // 首次登录时是否自动创建账号
+	SyncRole           bool     `yaml:"sync_role" toml:"sync_role"`                       // 每次登录时是否按映射更新身份
+}
+
+// PasswordConfig 密码策略，注册、修改和重置密码时校验
+type PasswordConfig struct {
+	MinLength    int    `yaml:"min_length" toml:"min_length"`       // 最短长度(字符数)
+	BreachedList string `yaml:"breached_list" toml:"breached_list"` // 已泄露密码列表文件，每行一个明文密码或SHA-1(可带 :次数)，为空时不检查
+}
+
+// PasswordResetConfig 自助重置密码配置
+type PasswordResetConfig struct {
+	Enabled  bool     `yaml:"enabled" toml:"enabled"`     // 是否允许通过邮件自助重置密码
+	TokenTTL Duration `yaml:"token_ttl" toml:"token_ttl"` // 重置链接有效期
+	URL      string   `yaml:"url" toml:"url"`             // 邮件中重置页面的地址，令牌以 token 参数附加
+}
+
+// MailConfig 邮件发送配置
+type MailConfig struct {
+	Driver       string   `yaml:"driver" toml:"driver"`               // 发送方式(log/file/smtp)，log和file用于开发和测试
+	From         string   `yaml:"from" toml:"from"`                   // 发件人地址
+	Dir          string   `yaml:"dir" toml:"dir"`                     // driver为file时邮件保存的目录
+	SMTPHost     string   `yaml:"smtp_host" toml:"smtp_host"`         // SMTP服务器地址
+	SMTPPort     int      `yaml:"smtp_port" toml:"smtp_port"`         // SMTP端口
+	SMTPUsername string   `yaml:"smtp_username" toml:"smtp_username"` // SMTP用户名，为空时不认证
+	SMTPPassword string   `yaml:"smtp_password" toml:"smtp_password"` // SMTP密码
+	SMTPTLS      string   `yaml:"smtp_tls" toml:"smtp_tls"`           // 加密方式(starttls/tls/none)
+	Timeout      Duration `yaml:"timeout" toml:"timeout"`             // 连接和发送的超时时间
+}
+
+// SecurityConfig 跨域来源和CSRF配置
+type SecurityConfig struct {
+	AllowedOrigins string `yaml:"allowed_origins" toml:"allowed_origins"` // 允许跨域调用接口和建立WebSocket连接的来源，逗号分隔，同源请求始终允许
+	CSRF           bool   `yaml:"csrf" toml:"csrf"`                       // 是否校验只用cookie认证的请求的来源和写请求的CSRF令牌
+}
+
+// Origins 解析允许的来源，统一为小写并去掉末尾的 /
+func (s SecurityConfig) Origins() []string {
+	var origins []string
+	for _, o := range strings.Split(s.AllowedOrigins, ",") {
+		if o = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(o)), "/"); o != "" {
+			origins = append(origins, o)
 		}
-	}()
+	}
+	return origins
+}
+
+// Default 返回默认配置
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Port: 8080,
+			Mode: "release",
+		},
+		Database: DatabaseConfig{
+			DSN:             "gorm.db",
+			MaxIdleConns:    10,
+			MaxOpenConns:    100,
+			ConnMaxLifetime: Duration(time.Hour),
+			AutoMigrate:     true,
+		},
+		Log: LogConfig{
+			Level:      "info",
+			File:       "./log/app.log",
+			MaxSize:    500,
+			MaxBackups: 10,
+			MaxAge:     90,
+			Compress:   true,
+		},
+		Storage: StorageConfig{
+			ImagePath: "./storage",
+			Proxy:     "",
+		},
+		Instance: InstanceConfig{
+			DefaultExpiration: Duration(30 * time.Minute),
+			ExtendDuration:    Duration(30 * time.Minute),
+		},
+		Flag: FlagConfig{
+			Prefix: "flag",
+			Env:    "FLAG",
+		},
+		Scoreboard: ScoreboardConfig{
+			CacheTTL: Duration(30 * time.Second),
+		},
+		Jwt: JwtConfig{
+			RotateInterval: Duration(30 * 24 * time.Hour),
+			GracePeriod:    Duration(18 * time.Hour),
+		},
+		Shutdown: ShutdownConfig{
+			Timeout:        Duration(30 * time.Second),
+			InstancePolicy: "keep",
+		},
+		Reconcile: ReconcileConfig{
+			OnStartup:    true,
+			OrphanPolicy: "adopt",
+		},
+		Setup: SetupConfig{
+			AdminUsername: "admin",
+		},
+		Registration: RegistrationConfig{
+			Open:       true,
+			Activation: ActivationAdmin,
+			VerifyTTL:  Duration(24 * time.Hour),
+		},
+		Health: HealthConfig{
+			CheckTimeout: Duration(3 * time.Second),
+			MinFreeDisk:  1024,
+		},
+		Session: SessionConfig{
+			AccessTTL:  Duration(15 * time.Minute),
+			RefreshTTL: Duration(7 * 24 * time.Hour),
+		},
+		Login: LoginConfig{
+			MaxAttempts:      5,
+			IPMaxAttempts:    50,
+			Window:           Duration(15 * time.Minute),
+			BaseDelay:        Duration(time.Second),
+			LockoutDuration:  Duration(15 * time.Minute),
+			HistoryRetention: Duration(90 * 24 * time.Hour),
+		},
+		TwoFactor: TwoFactorConfig{
+			Issuer: "AscensionPath",
+		},
+		APIToken: APITokenConfig{
+			MaxTTL:         Duration(365 * 24 * time.Hour),
+			UsageRetention: Duration(30 * 24 * time.Hour),
+		},
+		OIDC: OIDCConfig{
+			DisplayName:   "统一身份认证",
+			Scopes:        "openid profile email",
+			FrontendURL:   "/static/",
+			RoleClaim:     "groups",
+			DefaultRole:   "user",
+			AutoProvision: true,
+			LinkByEmail:   true,
+		},
+		LDAP: LDAPConfig{
+			Timeout:        Duration(5 * time.Second),
+			UserFilter:     "(uid=%s)",
+			EmailAttribute: "mail",
+			GroupAttribute: "memberOf",
+			GroupFilter:    "(member=%s)",
+			DefaultRole:    "user",
+			AutoProvision:  true,
+			SyncRole:       true,
+		},
+		Password: PasswordConfig{
+			MinLength: 8,
+		},
+		PasswordReset: PasswordResetConfig{
+			TokenTTL: Duration(30 * time.Minute),
+		},
+		Mail: MailConfig{
+			Driver:   "log",
+			From:     "AscensionPath <noreply@localhost>",
+			Dir:      "./mail",
+			SMTPPort: 587,
+			SMTPTLS:  "starttls",
+			Timeout:  Duration(10 * time.Second),
+		},
+		Security: SecurityConfig{
+			CSRF: true,
+		},
+	}
+}
+
+// Duration 支持"30m"、"1h"等写法的时间间隔
+type Duration time.Duration
+
+// Std 转换为time.Duration
+func (d Duration) Std() time.Duration {
+	return time.Duration(d)
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
 }
 
-// refreshJwtKey 刷新JWT密钥
-func refreshJwtKey() {
-	JwtSecretKey = []byte(uuid.New().String())
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
 }
@@ -0,0 +1,524 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// 环境变量前缀，如 ASCENSION_SERVER_PORT
+const envPrefix = "ASCENSION_"
+
+var (
+	flagPrefixPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+	flagEnvPattern    = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+var (
+	// 命令行指定的配置文件路径
+	configPath string
+	// 命令行覆盖的配置项 key: 配置键, value: 原始字符串
+	flagOverrides = map[string]string{}
+)
+
+// setting 可通过环境变量和命令行覆盖的配置项
+type setting struct {
+	key    string      // 配置键，如 server.port
+	usage  string      // 命令行帮助信息
+	target interface{} // 指向Config字段的指针
+}
+
+func (c *Config) settings() []setting {
+	return []setting{
+		{"server.port", "服务器监听的端口号", &c.Server.Port},
+		{"server.mode", "运行模式(release/debug/test)", &c.Server.Mode},
+		{"database.dsn", "数据库连接串", &c.Database.DSN},
+		{"database.max_idle_conns", "数据库最大空闲连接数", &c.Database.MaxIdleConns},
+		{"database.max_open_conns", "数据库最大打开连接数", &c.Database.MaxOpenConns},
+		{"database.conn_max_lifetime", "数据库连接最大存活时间", &c.Database.ConnMaxLifetime},
+		{"database.auto_migrate", "启动时是否自动执行数据库迁移", &c.Database.AutoMigrate},
+		{"log.level", "日志级别(debug/info/warn/error)", &c.Log.Level},
+		{"log.file", "日志文件路径", &c.Log.File},
+		{"log.max_size", "单个日志文件最大尺寸(MB)", &c.Log.MaxSize},
+		{"log.max_backups", "保留的旧日志文件数量", &c.Log.MaxBackups},
+		{"log.max_age", "旧日志文件保留天数", &c.Log.MaxAge},
+		{"log.compress", "是否压缩旧日志", &c.Log.Compress},
+		{"storage.image_path", "本地镜像存储路径", &c.Storage.ImagePath},
+		{"storage.proxy", "拉取镜像时使用的代理", &c.Storage.Proxy},
+		{"instance.default_expiration", "场景默认过期时间", &c.Instance.DefaultExpiration},
+		{"instance.extend_duration", "场景每次延长的时间", &c.Instance.ExtendDuration},
+		{"instance.max_extensions", "每个场景最多延长次数(0为不限制)", &c.Instance.MaxExtensions},
+		{"flag.prefix", "实例flag前缀", &c.Flag.Prefix},
+		{"flag.env", "注入实例flag的环境变量名(为空时不注入)", &c.Flag.Env},
+		{"flag.file", "容器内写入实例flag的文件路径(为空时不写入)", &c.Flag.File},
+		{"scoreboard.cache_ttl", "排行榜缓存时间(0为不缓存)", &c.Scoreboard.CacheTTL},
+		{"jwt.rotate_interval", "JWT密钥自动轮换周期(0为仅手动)", &c.Jwt.RotateInterval},
+		{"jwt.grace_period", "JWT密钥轮换后旧密钥的宽限期", &c.Jwt.GracePeriod},
+		{"shutdown.timeout", "停机时等待请求和镜像拉取/构建完成的最长时间", &c.Shutdown.Timeout},
+		{"shutdown.instance_policy", "停机时运行中实例的处理策略(keep/stop/remove)", &c.Shutdown.InstancePolicy},
+		{"reconcile.on_startup", "启动时是否对账实例与Docker状态", &c.Reconcile.OnStartup},
+		{"reconcile.orphan_policy", "孤儿容器/堆栈的处理策略(report/remove/adopt)", &c.Reconcile.OrphanPolicy},
+		{"setup.admin_username", "首次启动时创建的管理员用户名", &c.Setup.AdminUsername},
+		{"setup.admin_password", "首次启动时创建的管理员密码(为空时生成一次性初始化令牌)", &c.Setup.AdminPassword},
+		{"setup.admin_email", "首次启动时创建的管理员邮箱", &c.Setup.AdminEmail},
+		{"registration.open", "是否开放用户注册(已弃用，请使用registration.mode)", &c.Registration.Open},
+		{"registration.mode", "注册方式(closed/open/invite/domain)，为空时按registration.open", &c.Registration.Mode},
+		{"registration.allowed_domains", "domain方式允许注册的邮箱域名，逗号分隔", &c.Registration.AllowedDomains},
+		{"registration.activation", "注册后的激活方式(admin/email/none)", &c.Registration.Activation},
+		{"registration.verify_ttl", "验证邮件中链接的有效期", &c.Registration.VerifyTTL},
+		{"registration.verify_url", "邮件中验证邮箱页面的地址", &c.Registration.VerifyURL},
+		{"health.check_timeout", "健康检查单项超时时间", &c.Health.CheckTimeout},
+		{"health.min_free_disk", "镜像存储目录和Docker数据目录的最小剩余空间(MB)", &c.Health.MinFreeDisk},
+		{"session.access_ttl", "访问令牌有效期", &c.Session.AccessTTL},
+		{"session.refresh_ttl", "刷新令牌有效期", &c.Session.RefreshTTL},
+		{"login.max_attempts", "同一账号连续登录失败多少次后锁定", &c.Login.MaxAttempts},
+		{"login.ip_max_attempts", "同一IP在统计窗口内登录失败多少次后锁定", &c.Login.IPMaxAttempts},
+		{"login.window", "登录失败次数统计窗口", &c.Login.Window},
+		{"login.base_delay", "账号登录失败后的初始等待时间(每次失败翻倍)", &c.Login.BaseDelay},
+		{"login.lockout_duration", "登录失败次数过多后的锁定时长", &c.Login.LockoutDuration},
+		{"login.history_retention", "登录记录保留时长(0为永久保留)", &c.Login.HistoryRetention},
+		{"two_factor.issuer", "验证器App中显示的服务名称", &c.TwoFactor.Issuer},
+		{"two_factor.required_roles", "必须启用两步验证的身份(逗号分隔，如 admin)", &c.TwoFactor.RequiredRoles},
+		{"api_token.max_ttl", "个人访问令牌最长有效期", &c.APIToken.MaxTTL},
+		{"api_token.usage_retention", "个人访问令牌使用记录保留时长(0为永久保留)", &c.APIToken.UsageRetention},
+		{"oidc.enabled", "是否启用OpenID Connect单点登录", &c.OIDC.Enabled},
+		{"oidc.display_name", "登录页单点登录按钮显示的名称", &c.OIDC.DisplayName},
+		{"oidc.issuer", "OIDC IdP地址", &c.OIDC.Issuer},
+		{"oidc.client_id", "OIDC客户端ID", &c.OIDC.ClientID},
+		{"oidc.client_secret", "OIDC客户端密钥(公共客户端留空)", &c.OIDC.ClientSecret},
+		{"oidc.redirect_url", "OIDC回调地址(指向 /api/v1/users/oidc/callback)", &c.OIDC.RedirectURL},
+		{"oidc.scopes", "OIDC请求的scope(空格分隔)", &c.OIDC.Scopes},
+		{"oidc.frontend_url", "单点登录完成后跳转的前端地址", &c.OIDC.FrontendURL},
+		{"oidc.role_claim", "用于映射身份的claim", &c.OIDC.RoleClaim},
+		{"oidc.role_mapping", "claim值到身份的映射(如 teachers=vip,it-admins=admin)", &c.OIDC.RoleMapping},
+		{"oidc.default_role", "没有匹配的映射时使用的身份", &c.OIDC.DefaultRole},
+		{"oidc.auto_provision", "首次单点登录时是否自动创建账号", &c.OIDC.AutoProvision},
+		{"oidc.link_by_email", "是否按已验证的邮箱关联已有账号", &c.OIDC.LinkByEmail},
+		{"oidc.sync_role", "每次单点登录时是否按映射更新身份", &c.OIDC.SyncRole},
+		{"ldap.enabled", "是否启用LDAP登录", &c.LDAP.Enabled},
+		{"ldap.url", "LDAP服务器地址(ldap://或ldaps://)", &c.LDAP.URL},
+		{"ldap.start_tls", "ldap://连接后是否升级为TLS", &c.LDAP.StartTLS},
+		{"ldap.insecure_skip_verify", "是否跳过LDAP服务器证书校验(仅用于测试)", &c.LDAP.InsecureSkipVerify},
+		{"ldap.timeout", "LDAP连接和请求的超时时间", &c.LDAP.Timeout},
+		{"ldap.bind_dn", "查找用户使用的服务账号DN(为空时匿名查找)", &c.LDAP.BindDN},
+		{"ldap.bind_password", "LDAP服务账号密码", &c.LDAP.BindPassword},
+		{"ldap.user_base_dn", "查找用户的起点DN", &c.LDAP.UserBaseDN},
+		{"ldap.user_filter", "查找用户的过滤器(%s为用户名，AD可用 (sAMAccountName=%s))", &c.LDAP.UserFilter},
+		{"ldap.email_attribute", "LDAP邮箱属性", &c.LDAP.EmailAttribute},
+		{"ldap.group_attribute", "用户条目上记录所属组DN的属性", &c.LDAP.GroupAttribute},
+		{"ldap.group_base_dn", "查找用户所属组的起点DN(为空时使用group_attribute)", &c.LDAP.GroupBaseDN},
+		{"ldap.group_filter", "查找组的过滤器(%s为用户DN)", &c.LDAP.GroupFilter},
+		{"ldap.role_mapping", "组DN到身份的映射(分号分隔，如 cn=teachers,ou=groups,dc=example,dc=edu=vip)", &c.LDAP.RoleMapping},
+		{"ldap.default_role", "没有匹配的映射时使用的身份", &c.LDAP.DefaultRole},
+		{"ldap.auto_provision", "首次LDAP登录时是否自动创建账号", &c.LDAP.AutoProvision},
+		{"ldap.sync_role", "每次LDAP登录时是否按组更新身份", &c.LDAP.SyncRole},
+		{"password.min_length", "密码最短长度", &c.Password.MinLength},
+		{"password.breached_list", "已泄露密码列表文件(每行一个明文密码或SHA-1)", &c.Password.BreachedList},
+		{"password_reset.enabled", "是否允许通过邮件自助重置密码", &c.PasswordReset.Enabled},
+		{"password_reset.token_ttl", "密码重置链接有效期", &c.PasswordReset.TokenTTL},
+		{"password_reset.url", "邮件中重置密码页面的地址", &c.PasswordReset.URL},
+		{"mail.driver", "邮件发送方式(log/file/smtp)", &c.Mail.Driver},
+		{"mail.from", "发件人地址", &c.Mail.From},
+		{"mail.dir", "mail.driver为file时邮件保存的目录", &c.Mail.Dir},
+		{"mail.smtp_host", "SMTP服务器地址", &c.Mail.SMTPHost},
+		{"mail.smtp_port", "SMTP端口", &c.Mail.SMTPPort},
+		{"mail.smtp_username", "SMTP用户名(为空时不认证)", &c.Mail.SMTPUsername},
+		{"mail.smtp_password", "SMTP密码", &c.Mail.SMTPPassword},
+		{"mail.smtp_tls", "SMTP加密方式(starttls/tls/none)", &c.Mail.SMTPTLS},
+		{"mail.timeout", "邮件服务器连接和发送的超时时间", &c.Mail.Timeout},
+		{"security.allowed_origins", "允许跨域调用接口和建立WebSocket连接的来源，逗号分隔", &c.Security.AllowedOrigins},
+		{"security.csrf", "是否校验只用cookie认证的请求的来源和CSRF令牌", &c.Security.CSRF},
+	}
+}
+
+// RegisterFlags 注册配置相关的命令行参数
+func RegisterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&configPath, "config", "", "配置文件路径(.yaml/.yml/.toml)")
+	for _, s := range Default().settings() {
+		key := s.key
+		fs.Func(key, s.usage, func(v string) error {
+			flagOverrides[key] = v
+			return nil
+		})
+	}
+	// 兼容旧的 -port 参数
+	fs.Func("port", "服务器监听的端口号(同 -server.port)", func(v string) error {
+		flagOverrides["server.port"] = v
+		return nil
+	})
+}
+
+// Load 按 默认值 < 配置文件 < 环境变量 < 命令行 的顺序加载配置，校验后应用到各子系统
+func Load() error {
+	cfg := Default()
+
+	path := configPath
+	if path == "" {
+		path = os.Getenv(envPrefix + "CONFIG")
+	}
+	if path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return err
+		}
+	}
+
+	if err := cfg.applyEnv(); err != nil {
+		return err
+	}
+	if err := cfg.applyOverrides(flagOverrides); err != nil {
+		return err
+	}
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	Set(cfg)
+	return nil
+}
+
+// loadFile 根据扩展名解析YAML或TOML配置文件
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("读取配置文件失败: %v", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, c)
+	case ".toml":
+		err = toml.Unmarshal(data, c)
+	default:
+		return fmt.Errorf("不支持的配置文件格式: %s", path)
+	}
+	if err != nil {
+		return fmt.Errorf("解析配置文件 %s 失败: %v", path, err)
+	}
+	return nil
+}
+
+// applyEnv 使用 ASCENSION_* 环境变量覆盖配置
+func (c *Config) applyEnv() error {
+	for _, s := range c.settings() {
+		if v, ok := os.LookupEnv(envName(s.key)); ok {
+			if err := setValue(s.target, v); err != nil {
+				return fmt.Errorf("环境变量 %s 无效: %v", envName(s.key), err)
+			}
+		}
+	}
+	return nil
+}
+
+// applyOverrides 使用命令行参数覆盖配置
+func (c *Config) applyOverrides(overrides map[string]string) error {
+	for _, s := range c.settings() {
+		if v, ok := overrides[s.key]; ok {
+			if err := setValue(s.target, v); err != nil {
+				return fmt.Errorf("命令行参数 -%s 无效: %v", s.key, err)
+			}
+		}
+	}
+	return nil
+}
+
+// envName 配置键转换为环境变量名
+func envName(key string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
+
+// setValue 将字符串解析到目标字段
+func setValue(target interface{}, raw string) error {
+	switch t := target.(type) {
+	case *string:
+		*t = raw
+	case *int:
+		v, err := strconv.Atoi(raw)
+		if err != nil {
+			return err
+		}
+		*t = v
+	case *bool:
+		v, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		*t = v
+	case *Duration:
+		v, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		*t = Duration(v)
+	default:
+		return fmt.Errorf("不支持的配置类型 %T", target)
+	}
+	return nil
+}
+
+// Validate 校验配置取值
+func (c *Config) Validate() error {
+	var errs []error
+
+	if c.Server.Port <= 0 || c.Server.Port > 65535 {
+		errs = append(errs, fmt.Errorf("server.port 超出范围: %d", c.Server.Port))
+	}
+	switch c.Server.Mode {
+	case "release", "debug", "test":
+	default:
+		errs = append(errs, fmt.Errorf("server.mode 无效: %s", c.Server.Mode))
+	}
+
+	if c.Database.DSN == "" {
+		errs = append(errs, errors.New("database.dsn 不能为空"))
+	} else if i := strings.Index(c.Database.DSN, "://"); i >= 0 {
+		// 与 model.openDialector 支持的数据库类型保持一致，不带协议的连接串为SQLite文件路径
+		switch c.Database.DSN[:i] {
+		case "postgres", "postgresql", "mysql", "sqlite":
+		default:
+			errs = append(errs, fmt.Errorf("database.dsn 不支持的数据库类型: %s", c.Database.DSN[:i]))
+		}
+	}
+	if c.Database.MaxIdleConns < 0 || c.Database.MaxOpenConns < 0 {
+		errs = append(errs, errors.New("database 连接数不能为负数"))
+	}
+	if c.Database.ConnMaxLifetime < 0 {
+		errs = append(errs, errors.New("database.conn_max_lifetime 不能为负数"))
+	}
+
+	switch c.Log.Level {
+	case "debug", "info", "warn", "error":
+	default:
+		errs = append(errs, fmt.Errorf("log.level 无效: %s", c.Log.Level))
+	}
+	if c.Log.File == "" {
+		errs = append(errs, errors.New("log.file 不能为空"))
+	}
+	if c.Log.MaxSize < 0 || c.Log.MaxBackups < 0 || c.Log.MaxAge < 0 {
+		errs = append(errs, errors.New("log 轮转参数不能为负数"))
+	}
+
+	if c.Storage.ImagePath == "" {
+		errs = append(errs, errors.New("storage.image_path 不能为空"))
+	}
+	if c.Storage.Proxy != "" {
+		if u, err := url.Parse(c.Storage.Proxy); err != nil || u.Scheme == "" || u.Host == "" {
+			errs = append(errs, fmt.Errorf("storage.proxy 不是有效的URL: %s", c.Storage.Proxy))
+		}
+	}
+
+	if c.Instance.DefaultExpiration <= 0 {
+		errs = append(errs, errors.New("instance.default_expiration 必须大于0"))
+	}
+	if c.Instance.ExtendDuration <= 0 {
+		errs = append(errs, errors.New("instance.extend_duration 必须大于0"))
+	}
+	if c.Instance.MaxExtensions < 0 {
+		errs = append(errs, errors.New("instance.max_extensions 不能为负数"))
+	}
+
+	if c.Flag.Prefix != "" && !flagPrefixPattern.MatchString(c.Flag.Prefix) {
+		errs = append(errs, fmt.Errorf("flag.prefix 只能包含字母、数字、下划线和中划线: %q", c.Flag.Prefix))
+	}
+	if c.Flag.Env != "" && !flagEnvPattern.MatchString(c.Flag.Env) {
+		errs = append(errs, fmt.Errorf("flag.env 不是有效的环境变量名: %q", c.Flag.Env))
+	}
+	if c.Flag.File != "" && (!path.IsAbs(c.Flag.File) || strings.HasSuffix(c.Flag.File, "/")) {
+		errs = append(errs, fmt.Errorf("flag.file 必须是容器内的绝对文件路径: %q", c.Flag.File))
+	}
+
+	if c.Scoreboard.CacheTTL < 0 {
+		errs = append(errs, errors.New("scoreboard.cache_ttl 不能为负数"))
+	}
+
+	if c.Jwt.RotateInterval < 0 || c.Jwt.GracePeriod < 0 {
+		errs = append(errs, errors.New("jwt 轮换参数不能为负数"))
+	}
+
+	if c.Shutdown.Timeout <= 0 {
+		errs = append(errs, errors.New("shutdown.timeout 必须大于0"))
+	}
+	switch c.Shutdown.InstancePolicy {
+	case "keep", "stop", "remove":
+	default:
+		errs = append(errs, fmt.Errorf("shutdown.instance_policy 无效: %s", c.Shutdown.InstancePolicy))
+	}
+
+	switch c.Reconcile.OrphanPolicy {
+	case "report", "remove", "adopt":
+	default:
+		errs = append(errs, fmt.Errorf("reconcile.orphan_policy 无效: %s", c.Reconcile.OrphanPolicy))
+	}
+
+	if c.Setup.AdminPassword != "" {
+		if c.Setup.AdminUsername == "" {
+			errs = append(errs, errors.New("setup.admin_username 不能为空"))
+		}
+		if len(c.Setup.AdminPassword) < 8 {
+			errs = append(errs, errors.New("setup.admin_password 长度不能少于8位"))
+		}
+	}
+
+	if c.Health.CheckTimeout <= 0 {
+		errs = append(errs, errors.New("health.check_timeout 必须大于0"))
+	}
+	if c.Health.MinFreeDisk < 0 {
+		errs = append(errs, errors.New("health.min_free_disk 不能为负数"))
+	}
+
+	if c.Session.AccessTTL <= 0 || c.Session.RefreshTTL <= 0 {
+		errs = append(errs, errors.New("session 令牌有效期必须大于0"))
+	} else if c.Session.RefreshTTL < c.Session.AccessTTL {
+		errs = append(errs, errors.New("session.refresh_ttl 不能小于 session.access_ttl"))
+	}
+
+	if c.Login.MaxAttempts < 1 || c.Login.IPMaxAttempts < 1 {
+		errs = append(errs, errors.New("login 失败次数上限必须大于0"))
+	}
+	if c.Login.Window <= 0 || c.Login.LockoutDuration <= 0 {
+		errs = append(errs, errors.New("login.window 和 login.lockout_duration 必须大于0"))
+	}
+	if c.Login.BaseDelay < 0 || c.Login.HistoryRetention < 0 {
+		errs = append(errs, errors.New("login.base_delay 和 login.history_retention 不能为负数"))
+	}
+
+	if strings.TrimSpace(c.TwoFactor.Issuer) == "" {
+		errs = append(errs, errors.New("two_factor.issuer 不能为空"))
+	}
+
+	if c.APIToken.MaxTTL < Duration(24*time.Hour) {
+		errs = append(errs, errors.New("api_token.max_ttl 不能小于24h"))
+	}
+	if c.APIToken.UsageRetention < 0 {
+		errs = append(errs, errors.New("api_token.usage_retention 不能为负数"))
+	}
+
+	if c.OIDC.Enabled {
+		for _, item := range [][2]string{{"oidc.issuer", c.OIDC.Issuer}, {"oidc.redirect_url", c.OIDC.RedirectURL}} {
+			if u, err := url.Parse(item[1]); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				errs = append(errs, fmt.Errorf("%s 必须是http(s)地址: %q", item[0], item[1]))
+			}
+		}
+		if c.OIDC.ClientID == "" {
+			errs = append(errs, errors.New("oidc.client_id 不能为空"))
+		}
+		if !strings.Contains(" "+c.OIDC.Scopes+" ", " openid ") {
+			errs = append(errs, errors.New("oidc.scopes 必须包含 openid"))
+		}
+	}
+
+	if c.LDAP.Enabled {
+		if u, err := url.Parse(c.LDAP.URL); err != nil || (u.Scheme != "ldap" && u.Scheme != "ldaps") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("ldap.url 必须是ldap://或ldaps://地址: %q", c.LDAP.URL))
+		} else if c.LDAP.StartTLS && u.Scheme == "ldaps" {
+			errs = append(errs, errors.New("ldaps:// 不能同时开启 ldap.start_tls"))
+		}
+		if c.LDAP.Timeout <= 0 {
+			errs = append(errs, errors.New("ldap.timeout 必须大于0"))
+		}
+		if c.LDAP.UserBaseDN == "" {
+			errs = append(errs, errors.New("ldap.user_base_dn 不能为空"))
+		}
+		if strings.Count(c.LDAP.UserFilter, "%s") != 1 {
+			errs = append(errs, errors.New("ldap.user_filter 必须包含一个 %s"))
+		}
+		if c.LDAP.GroupBaseDN != "" && strings.Count(c.LDAP.GroupFilter, "%s") != 1 {
+			errs = append(errs, errors.New("ldap.group_filter 必须包含一个 %s"))
+		}
+	}
+
+	switch c.Registration.Mode {
+	case "", RegistrationClosed, RegistrationOpen, RegistrationInvite:
+	case RegistrationDomain:
+		if len(c.Registration.Domains()) == 0 {
+			errs = append(errs, errors.New("registration.allowed_domains 不能为空"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("registration.mode 无效: %s", c.Registration.Mode))
+	}
+	for _, d := range c.Registration.Domains() {
+		if strings.ContainsAny(strings.TrimPrefix(d, "*."), "@*/ ") || !strings.Contains(d, ".") {
+			errs = append(errs, fmt.Errorf("registration.allowed_domains 中的域名无效: %s", d))
+		}
+	}
+	switch c.Registration.Activation {
+	case ActivationAdmin, ActivationNone:
+	case ActivationEmail:
+		if c.Registration.VerifyTTL <= 0 {
+			errs = append(errs, errors.New("registration.verify_ttl 必须大于0"))
+		}
+		if u, err := url.Parse(c.Registration.VerifyURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("registration.verify_url 必须是http(s)地址: %q", c.Registration.VerifyURL))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("registration.activation 无效: %s", c.Registration.Activation))
+	}
+
+	// bcrypt只使用前72字节
+	if c.Password.MinLength < 6 || c.Password.MinLength > 72 {
+		errs = append(errs, fmt.Errorf("password.min_length 必须在6到72之间: %d", c.Password.MinLength))
+	}
+	if c.Password.BreachedList != "" {
+		if _, err := os.Stat(c.Password.BreachedList); err != nil {
+			errs = append(errs, fmt.Errorf("password.breached_list 无法读取: %v", err))
+		}
+	}
+
+	if c.PasswordReset.Enabled {
+		if c.PasswordReset.TokenTTL <= 0 {
+			errs = append(errs, errors.New("password_reset.token_ttl 必须大于0"))
+		}
+		if u, err := url.Parse(c.PasswordReset.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("password_reset.url 必须是http(s)地址: %q", c.PasswordReset.URL))
+		}
+	}
+
+	if _, err := mail.ParseAddress(c.Mail.From); err != nil {
+		errs = append(errs, fmt.Errorf("mail.from 不是有效的邮箱地址: %q", c.Mail.From))
+	}
+	if c.Mail.Timeout <= 0 {
+		errs = append(errs, errors.New("mail.timeout 必须大于0"))
+	}
+	switch c.Mail.Driver {
+	case "log":
+	case "file":
+		if c.Mail.Dir == "" {
+			errs = append(errs, errors.New("mail.dir 不能为空"))
+		}
+	case "smtp":
+		if c.Mail.SMTPHost == "" {
+			errs = append(errs, errors.New("mail.smtp_host 不能为空"))
+		}
+		if c.Mail.SMTPPort <= 0 || c.Mail.SMTPPort > 65535 {
+			errs = append(errs, fmt.Errorf("mail.smtp_port 超出范围: %d", c.Mail.SMTPPort))
+		}
+		switch c.Mail.SMTPTLS {
+		case "starttls", "tls", "none":
+		default:
+			errs = append(errs, fmt.Errorf("mail.smtp_tls 无效: %s", c.Mail.SMTPTLS))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("mail.driver 无效: %s", c.Mail.Driver))
+	}
+
+	// 来源只包含协议、主机和端口，携带凭据的跨域请求不能使用通配符
+	for _, o := range c.Security.Origins() {
+		u, err := url.Parse(o)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.Path != "" || u.RawQuery != "" || u.User != nil {
+			errs = append(errs, fmt.Errorf("security.allowed_origins 中的来源无效: %q", o))
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,209 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// resetLoad 清除环境变量、配置文件路径和命令行参数，测试结束后恢复全局配置
+func resetLoad(t *testing.T) {
+	t.Helper()
+	for _, kv := range os.Environ() {
+		if name, _, _ := strings.Cut(kv, "="); strings.HasPrefix(name, envPrefix) {
+			t.Setenv(name, "")
+			os.Unsetenv(name)
+		}
+	}
+	oldConf, oldPath, oldOverrides := Current(), configPath, flagOverrides
+	configPath, flagOverrides = "", map[string]string{}
+	t.Cleanup(func() {
+		Set(oldConf)
+		configPath, flagOverrides = oldPath, oldOverrides
+	})
+}
+
+func writeConfig(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadDefaults(t *testing.T) {
+	resetLoad(t)
+	if err := Load(); err != nil {
+		t.Fatalf("加载默认配置失败: %v", err)
+	}
+	def := Default()
+	if Current().Server.Port != def.Server.Port || Current().Database.DSN != def.Database.DSN || Current().Log.Level != def.Log.Level {
+		t.Fatalf("未设置任何来源时应使用默认配置: %+v", Current())
+	}
+	if Current().Jwt != def.Jwt {
+		t.Fatalf("jwt 默认值错误: %+v", Current().Jwt)
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	yamlFile := `
+server:
+  port: 9000
+  mode: debug
+log:
+  level: warn
+instance:
+  default_expiration: 45m
+jwt:
+  grace_period: 2h
+`
+	tomlFile := `
+[server]
+port = 9000
+mode = "debug"
+
+[log]
+level = "warn"
+
+[instance]
+default_expiration = "45m"
+
+[jwt]
+grace_period = "2h"
+`
+	for name, content := range map[string]string{"config.yaml": yamlFile, "config.toml": tomlFile} {
+		t.Run(name, func(t *testing.T) {
+			resetLoad(t)
+			t.Setenv(envPrefix+"CONFIG", writeConfig(t, name, content))
+			t.Setenv("ASCENSION_SERVER_PORT", "9100")
+			t.Setenv("ASCENSION_LOG_LEVEL", "debug")
+			flagOverrides["log.level"] = "error"
+
+			if err := Load(); err != nil {
+				t.Fatalf("加载配置失败: %v", err)
+			}
+			if Current().Server.Mode != "debug" {
+				t.Fatalf("配置文件应覆盖默认值: %s", Current().Server.Mode)
+			}
+			if Current().Jwt.GracePeriod.Std() != 2*time.Hour {
+				t.Fatalf("配置文件中的时间间隔解析错误: %v", Current().Jwt.GracePeriod.Std())
+			}
+			if Current().Instance.DefaultExpiration.Std() != 45*time.Minute {
+				t.Fatalf("配置文件中的过期时间未生效: %v", Current().Instance.DefaultExpiration)
+			}
+			if Current().Server.Port != 9100 {
+				t.Fatalf("环境变量应覆盖配置文件: %d", Current().Server.Port)
+			}
+			if Current().Log.Level != "error" {
+				t.Fatalf("命令行参数应覆盖环境变量: %s", Current().Log.Level)
+			}
+			if Current().Database.DSN != Default().Database.DSN {
+				t.Fatalf("未配置的项应保留默认值: %s", Current().Database.DSN)
+			}
+		})
+	}
+
+	// -config 参数优先于 ASCENSION_CONFIG
+	resetLoad(t)
+	t.Setenv(envPrefix+"CONFIG", writeConfig(t, "env.yaml", "server:\n  port: 9001\n"))
+	configPath = writeConfig(t, "flag.yaml", "server:\n  port: 9002\n")
+	if err := Load(); err != nil {
+		t.Fatalf("加载配置失败: %v", err)
+	}
+	if Current().Server.Port != 9002 {
+		t.Fatalf("应使用 -config 指定的配置文件: %d", Current().Server.Port)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	cases := []struct {
+		name   string
+		file   string // 配置文件名，为空时不使用配置文件
+		config string
+		env    map[string]string
+		want   string
+	}{
+		{name: "配置文件不存在", file: "-", want: "读取配置文件失败"},
+		{name: "不支持的格式", file: "config.json", config: "{}", want: "不支持的配置文件格式"},
+		{name: "配置文件格式错误", file: "config.yaml", config: "server: [", want: "解析配置文件"},
+		{name: "配置文件时间间隔无效", file: "config.yaml", config: "jwt:\n  grace_period: 5x\n", want: "解析配置文件"},
+		{name: "环境变量时间间隔无效", env: map[string]string{"ASCENSION_JWT_GRACE_PERIOD": "abc"}, want: "环境变量 ASCENSION_JWT_GRACE_PERIOD 无效"},
+		{name: "环境变量整数无效", env: map[string]string{"ASCENSION_SERVER_PORT": "http"}, want: "环境变量 ASCENSION_SERVER_PORT 无效"},
+		{name: "环境变量布尔值无效", env: map[string]string{"ASCENSION_LOG_COMPRESS": "maybe"}, want: "环境变量 ASCENSION_LOG_COMPRESS 无效"},
+		{name: "数据库连接串为空", env: map[string]string{"ASCENSION_DATABASE_DSN": ""}, want: "database.dsn 不能为空"},
+		{name: "不支持的数据库类型", env: map[string]string{"ASCENSION_DATABASE_DSN": "mongodb://localhost/db"}, want: "database.dsn 不支持的数据库类型: mongodb"},
+		{name: "jwt参数为负数", env: map[string]string{"ASCENSION_JWT_ROTATE_INTERVAL": "-1h"}, want: "jwt 轮换参数不能为负数"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			resetLoad(t)
+			Set(nil)
+			switch tc.file {
+			case "":
+			case "-":
+				configPath = filepath.Join(t.TempDir(), "missing.yaml")
+			default:
+				configPath = writeConfig(t, tc.file, tc.config)
+			}
+			for k, v := range tc.env {
+				t.Setenv(k, v)
+			}
+			err := Load()
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("期望包含 %q 的错误，实际为 %v", tc.want, err)
+			}
+			if Current() != nil {
+				t.Fatal("加载失败时不应替换当前配置")
+			}
+		})
+	}
+
+	// 命令行参数的错误指出参数名
+	resetLoad(t)
+	flagOverrides["instance.default_expiration"] = "soon"
+	if err := Load(); err == nil || !strings.Contains(err.Error(), "命令行参数 -instance.default_expiration 无效") {
+		t.Fatalf("命令行参数无效时应返回错误: %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := Default().Validate(); err != nil {
+		t.Fatalf("默认配置应通过校验: %v", err)
+	}
+
+	for _, dsn := range []string{"gorm.db", "sqlite://data/app.db", "postgres://u:p@localhost/db", "postgresql://localhost/db", "mysql://u:p@tcp(localhost)/db"} {
+		c := Default()
+		c.Database.DSN = dsn
+		if err := c.Validate(); err != nil {
+			t.Fatalf("连接串 %s 应通过校验: %v", dsn, err)
+		}
+	}
+
+	// 所有错误一起返回，便于一次改完
+	c := Default()
+	c.Server.Port = 70000
+	c.Server.Mode = "prod"
+	c.Database.DSN = "redis://localhost"
+	c.Database.ConnMaxLifetime = Duration(-time.Second)
+	c.Jwt.GracePeriod = Duration(-time.Hour)
+	c.Security.AllowedOrigins = "*"
+	err := c.Validate()
+	if err == nil {
+		t.Fatal("无效配置应校验失败")
+	}
+	for _, want := range []string{
+		"server.port 超出范围: 70000",
+		"server.mode 无效: prod",
+		"database.dsn 不支持的数据库类型: redis",
+		"database.conn_max_lifetime 不能为负数",
+		"jwt 轮换参数不能为负数",
+		"security.allowed_origins 中的来源无效",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("校验错误中缺少 %q: %v", want, err)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// runtimeKeys 可由管理员在运行时修改的配置项，修改后立即生效
+var runtimeKeys = map[string]bool{
+	"storage.image_path":           true,
+	"storage.proxy":                true,
+	"instance.default_expiration":  true,
+	"instance.extend_duration":     true,
+	"instance.max_extensions":      true,
+	"registration.mode":            true,
+	"registration.allowed_domains": true,
+	"registration.activation":      true,
+	"two_factor.required_roles":    true,
+	"password.min_length":          true,
+	"password_reset.enabled":       true,
+	"scoreboard.cache_ttl":         true,
+}
+
+// 串行化运行时配置的修改
+var runtimeMu sync.Mutex
+
+// RuntimeSetting 运行时配置项
+type RuntimeSetting struct {
+	Key   string `json:"key"`
+	Type  string `json:"type"` // string/int/bool/duration
+	Usage string `json:"usage"`
+	Value string `json:"value"`
+}
+
+// IsRuntimeKey 判断配置项是否支持运行时修改
+func IsRuntimeKey(key string) bool {
+	return runtimeKeys[key]
+}
+
+// RuntimeSettings 返回所有运行时配置项的当前值
+func RuntimeSettings() []RuntimeSetting {
+	runtimeMu.Lock()
+	defer runtimeMu.Unlock()
+
+	var result []RuntimeSetting
+	for _, s := range Current().settings() {
+		if !runtimeKeys[s.key] {
+			continue
+		}
+		result = append(result, RuntimeSetting{
+			Key:   s.key,
+			Type:  typeName(s.target),
+			Usage: s.usage,
+			Value: formatValue(s.target),
+		})
+	}
+	return result
+}
+
+// CheckRuntime 校验运行时配置修改，不会生效
+func CheckRuntime(values map[string]string) error {
+	runtimeMu.Lock()
+	defer runtimeMu.Unlock()
+
+	_, err := withRuntime(values)
+	return err
+}
+
+// SetRuntime 校验并应用运行时配置修改，全部合法时才会生效
+func SetRuntime(values map[string]string) error {
+	runtimeMu.Lock()
+	defer runtimeMu.Unlock()
+
+	cfg, err := withRuntime(values)
+	if err != nil {
+		return err
+	}
+	Set(cfg)
+	return nil
+}
+
+// withRuntime 在当前配置的副本上应用修改并校验
+func withRuntime(values map[string]string) (*Config, error) {
+	cfg := *Current()
+	targets := map[string]interface{}{}
+	for _, s := range cfg.settings() {
+		targets[s.key] = s.target
+	}
+
+	for key, raw := range values {
+		if !runtimeKeys[key] {
+			return nil, fmt.Errorf("%s 不支持运行时修改", key)
+		}
+		if err := setValue(targets[key], raw); err != nil {
+			return nil, fmt.Errorf("%s 无效: %v", key, err)
+		}
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// typeName 配置项的类型名
+func typeName(target interface{}) string {
+	switch target.(type) {
+	case *int:
+		return "int"
+	case *bool:
+		return "bool"
+	case *Duration:
+		return "duration"
+	default:
+		return "string"
+	}
+}
+
+// formatValue 将配置项格式化为可被setValue解析的字符串
+func formatValue(target interface{}) string {
+	switch t := target.(type) {
+	case *string:
+		return *t
+	case *int:
+		return strconv.Itoa(*t)
+	case *bool:
+		return strconv.FormatBool(*t)
+	case *Duration:
+		return time.Duration(*t).String()
+	default:
+		return fmt.Sprint(target)
+	}
+}
@@ -0,0 +1,52 @@
+package config
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSetRuntime(t *testing.T) {
+	resetLoad(t)
+	Set(Default())
+	old := Current()
+
+	if err := SetRuntime(map[string]string{"instance.default_expiration": "45m"}); err != nil {
+		t.Fatalf("修改运行时配置失败: %v", err)
+	}
+	if got := Current().Instance.DefaultExpiration.Std(); got != 45*time.Minute {
+		t.Fatalf("修改未生效: %v", got)
+	}
+	// 修改在副本上进行，之前取得的配置不变
+	if got := old.Instance.DefaultExpiration.Std(); got != Default().Instance.DefaultExpiration.Std() {
+		t.Fatalf("修改不应影响之前取得的配置: %v", got)
+	}
+
+	// 任一项不合法时全部不生效
+	err := SetRuntime(map[string]string{"instance.max_extensions": "5", "server.port": "9000"})
+	if err == nil || Current().Instance.MaxExtensions == 5 {
+		t.Fatalf("不支持运行时修改的配置项应被拒绝: %v", err)
+	}
+
+	// 修改时并发读取配置，使用 -race 运行时检查数据竞争
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				SetRuntime(map[string]string{"instance.extend_duration": strconv.Itoa(j+1) + "m"})
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				if Current().Instance.ExtendDuration.Std() <= 0 {
+					t.Error("读取到不完整的配置")
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
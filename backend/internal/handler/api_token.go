@@ -0,0 +1,197 @@
+package handler
+
+import (
+	"AscensionPath/internal/service"
+	"AscensionPath/internal/utils"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 个人访问令牌可访问的接口及所需权限范围，未列出的接口(会话、两步验证、令牌管理等)只能通过登录访问
+var apiTokenRouteScopes = map[string]string{
+	"GET /api/v1/users/getUserInfo":   service.ScopeUserRead,
+	"GET /api/v1/users/loginHistory":  service.ScopeUserRead,
+	"GET /api/v1/users/scoreLedger":   service.ScopeUserRead,
+	"POST /api/v1/users/profile":      service.ScopeUserWrite,
+	"POST /api/v1/teams/setMember":    service.ScopeUserWrite,
+	"POST /api/v1/teams/removeMember": service.ScopeUserWrite,
+
+	"GET /api/v1/vul/getCreatedVulEnv":   service.ScopeVulRead,
+	"POST /api/v1/vul/createVulInstance": service.ScopeInstanceWrite,
+	"POST /api/v1/vul/removeInstance":    service.ScopeInstanceWrite,
+	"GET /api/v1/vul/extendExpireTime":   service.ScopeInstanceWrite,
+	"POST /api/v1/vul/submitFlag":        service.ScopeInstanceWrite,
+	"GET /api/v1/vul/getTeamInstances":   service.ScopeVulRead,
+	"GET /api/v1/teams/myTeams":          service.ScopeVulRead,
+	"GET /api/v1/courses/getCourses":     service.ScopeVulRead,
+	"GET /api/v1/courses/getAssignments": service.ScopeVulRead,
+	"GET /api/v1/scoreboard/rank":        service.ScopeVulRead,
+	"GET /api/v1/scoreboard/series":      service.ScopeVulRead,
+	"GET /api/v1/scoreboard/solves":      service.ScopeVulRead,
+
+	"POST /api/v1/users/deleteUser":       service.ScopeAdminUsers,
+	"GET /api/v1/users/getAllUsers":       service.ScopeAdminUsers,
+	"POST /api/v1/users/addUser":          service.ScopeAdminUsers,
+	"POST /api/v1/users/searchUsers":      service.ScopeAdminUsers,
+	"GET /api/v1/users/loginLocks":        service.ScopeAdminUsers,
+	"POST /api/v1/users/unlockLogin":      service.ScopeAdminUsers,
+	"POST /api/v1/users/twoFactor/reset":  service.ScopeAdminUsers,
+	"GET /api/v1/users/inviteCodes":       service.ScopeAdminUsers,
+	"POST /api/v1/users/createInviteCode": service.ScopeAdminUsers,
+	"POST /api/v1/users/deleteInviteCode": service.ScopeAdminUsers,
+	"GET /api/v1/teams/getAllTeams":       service.ScopeAdminUsers,
+	"POST /api/v1/teams/createTeam":       service.ScopeAdminUsers,
+	"POST /api/v1/teams/updateTeam":       service.ScopeAdminUsers,
+	"POST /api/v1/teams/deleteTeam":       service.ScopeAdminUsers,
+
+	"GET /api/v1/vul/getAllInstance":     service.ScopeAdminVul,
+	"GET /api/v1/vul/getVulImages":       service.ScopeAdminVul,
+	"GET /api/v1/vul/getImageLoadConfig": service.ScopeAdminVul,
+	"POST /api/v1/vul/uploadImageFile":   service.ScopeAdminVul,
+	"GET /api/v1/vul/pullImage":          service.ScopeAdminVul,
+	"GET /api/v1/vul/getVulEnv":          service.ScopeAdminVul,
+	"POST /api/v1/vul/uploadVulZip":      service.ScopeAdminVul,
+	"GET /api/v1/vul/createVulEnv":       service.ScopeAdminVul,
+	"POST /api/v1/vul/deleteVulEnv":      service.ScopeAdminVul,
+	"POST /api/v1/vul/reconcile":         service.ScopeAdminVul,
+
+	"POST /api/v1/system/rotateJwtKey": service.ScopeAdminSystem,
+	"GET /api/v1/system/settings":      service.ScopeAdminSystem,
+	"POST /api/v1/system/settings":     service.ScopeAdminSystem,
+	"GET /api/v1/system/settingAudits": service.ScopeAdminSystem,
+
+	"GET /api/v1/system/roles":       service.ScopeAdminUsers,
+	"GET /api/v1/system/permissions": service.ScopeAdminUsers,
+	"POST /api/v1/system/createRole": service.ScopeAdminUsers,
+	"POST /api/v1/system/updateRole": service.ScopeAdminUsers,
+	"POST /api/v1/system/deleteRole": service.ScopeAdminUsers,
+
+	"POST /api/v1/courses/createCourse":     service.ScopeAdminCourses,
+	"POST /api/v1/courses/updateCourse":     service.ScopeAdminCourses,
+	"POST /api/v1/courses/deleteCourse":     service.ScopeAdminCourses,
+	"GET /api/v1/courses/getStudents":       service.ScopeAdminCourses,
+	"POST /api/v1/courses/enrollStudents":   service.ScopeAdminCourses,
+	"POST /api/v1/courses/unenrollStudent":  service.ScopeAdminCourses,
+	"POST /api/v1/courses/createAssignment": service.ScopeAdminCourses,
+	"POST /api/v1/courses/updateAssignment": service.ScopeAdminCourses,
+	"POST /api/v1/courses/deleteAssignment": service.ScopeAdminCourses,
+	"GET /api/v1/courses/getProgress":       service.ScopeAdminCourses,
+}
+
+// getAPITokenScopes 获取当前用户可以授予的权限范围
+func getAPITokenScopes(c *gin.Context) {
+	userService, err := utils.GetDataFromContext(c, "UserInfo", &service.UserService{})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.FailResult(utils.CodeInternalError, err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, utils.SuccessResult(userService.AvailableAPITokenScopes()))
+}
+
+// getAPITokens 获取令牌列表，默认为当前用户，管理员可通过id查看其他用户
+func getAPITokens(c *gin.Context) {
+	userService, err := utils.GetDataFromContext(c, "UserInfo", &service.UserService{})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.FailResult(utils.CodeInternalError, err.Error()))
+		return
+	}
+	userID := userService.ID
+	if id := c.Query("id"); id != "" {
+		n, err := utils.StringToInt(id)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, utils.FailResult(utils.CodeBadRequest, "无效的用户ID: "+err.Error()))
+			return
+		}
+		userID = uint(n)
+	}
+	tokens, err := userService.ListAPITokens(userID)
+	if err != nil {
+		c.JSON(http.StatusForbidden, utils.FailResult(http.StatusForbidden, err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, utils.SuccessResult(tokens))
+}
+
+// createAPIToken 创建个人访问令牌，明文令牌只在响应中返回一次
+func createAPIToken(c *gin.Context) {
+	var req utils.Message[struct {
+		UserID        uint     `json:"user_id"` // 管理员为其他用户创建时指定
+		Name          string   `json:"name" binding:"required"`
+		Scopes        []string `json:"scopes" binding:"required"`
+		ExpiresInDays int      `json:"expires_in_days" binding:"required"`
+	}]
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, utils.FailResult(utils.CodeBadRequest, "无效的请求参数: "+err.Error()))
+		return
+	}
+	userService, err := utils.GetDataFromContext(c, "UserInfo", &service.UserService{})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.FailResult(utils.CodeInternalError, err.Error()))
+		return
+	}
+	userID := req.Data.UserID
+	if userID == 0 {
+		userID = userService.ID
+	}
+	plain, token, err := userService.CreateAPIToken(userID, req.Data.Name, req.Data.Scopes, req.Data.ExpiresInDays)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, utils.FailResult(utils.CodeBadRequest, err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, utils.SuccessResult(gin.H{"token": plain, "info": token}))
+}
+
+// revokeAPIToken 撤销个人访问令牌
+func revokeAPIToken(c *gin.Context) {
+	var req utils.Message[struct {
+		ID uint `json:"id" binding:"required"`
+	}]
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, utils.FailResult(utils.CodeBadRequest, "无效的请求参数: "+err.Error()))
+		return
+	}
+	userService, err := utils.GetDataFromContext(c, "UserInfo", &service.UserService{})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.FailResult(utils.CodeInternalError, err.Error()))
+		return
+	}
+	if err := userService.RevokeAPIToken(req.Data.ID); err != nil {
+		c.JSON(http.StatusBadRequest, utils.FailResult(utils.CodeBadRequest, err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, utils.SuccessResult("已撤销令牌"))
+}
+
+// getAPITokenUsage 分页获取令牌调用记录
+func getAPITokenUsage(c *gin.Context) {
+	id, err := utils.StringToInt(c.Query("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, utils.FailResult(utils.CodeBadRequest, "无效的令牌ID: "+err.Error()))
+		return
+	}
+	page, err := utils.StringToInt(c.DefaultQuery("page", "1"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, utils.FailResult(utils.CodeBadRequest, "无效的页码: "+err.Error()))
+		return
+	}
+	pageSize, err := utils.StringToInt(c.DefaultQuery("pageSize", "10"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, utils.FailResult(utils.CodeBadRequest, "无效的每页数量: "+err.Error()))
+		return
+	}
+	userService, err := utils.GetDataFromContext(c, "UserInfo", &service.UserService{})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.FailResult(utils.CodeInternalError, err.Error()))
+		return
+	}
+	usages, count, err := userService.GetAPITokenUsage(uint(id), page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, utils.FailResult(utils.CodeBadRequest, err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, utils.SuccessResult(struct {
+		Usages []service.APITokenUsageDTO `json:"usages"`
+		Count  int64                      `json:"count"`
+	}{Usages: usages, Count: count}))
+}
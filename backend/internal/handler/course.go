@@ -0,0 +1,296 @@
+package handler
+
+import (
+	"AscensionPath/internal/service"
+	"AscensionPath/internal/utils"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// assignmentRequest 创建或修改作业的请求参数，时间为RFC3339格式
+type assignmentRequest struct {
+	ID          uint      `json:"id"`
+	CourseID    uint      `json:"course_id"`
+	Title       string    `json:"title" binding:"required"`
+	Description string    `json:"description"`
+	OpenAt      time.Time `json:"open_at" binding:"required"`
+	DueAt       time.Time `json:"due_at" binding:"required"`
+	Lifetime    int       `json:"lifetime"` // 实例有效期(分钟)，0使用默认有效期
+	VulEnvIDs   []uint    `json:"vul_env_ids" binding:"required"`
+}
+
+func (r assignmentRequest) form() service.AssignmentForm {
+	return service.AssignmentForm{
+		Title:       r.Title,
+		Description: r.Description,
+		OpenAt:      r.OpenAt,
+		DueAt:       r.DueAt,
+		Lifetime:    r.Lifetime,
+		VulEnvIDs:   r.VulEnvIDs,
+	}
+}
+
+// queryID 读取查询参数中的ID
+func queryID(c *gin.Context, name string) (uint, bool) {
+	id, err := strconv.ParseUint(c.Query(name), 10, 32)
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, utils.FailResult(utils.CodeBadRequest, "无效的"+name+"参数"))
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// getCourses 课程管理员获取所有课程，学生获取已选修的课程
+func getCourses(c *gin.Context) {
+	userService, err := utils.GetDataFromContext(c, "UserInfo", &service.UserService{})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.FailResult(utils.CodeInternalError, err.Error()))
+		return
+	}
+	courses, err := userService.GetCourses()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.FailResult(utils.CodeInternalError, err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, utils.SuccessResult(courses))
+}
+
+// createCourse 创建课程
+func createCourse(c *gin.Context) {
+	var req utils.Message[struct {
+		Name        string `json:"name" binding:"required"`
+		Description string `json:"description"`
+	}]
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, utils.FailResult(utils.CodeBadRequest, "无效的请求参数: "+err.Error()))
+		return
+	}
+	userService, err := utils.GetDataFromContext(c, "UserInfo", &service.UserService{})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.FailResult(utils.CodeInternalError, err.Error()))
+		return
+	}
+	course, err := userService.CreateCourse(req.Data.Name, req.Data.Description)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, utils.FailResult(utils.CodeBadRequest, err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, utils.SuccessResult(course))
+}
+
+// updateCourse 修改课程名称和说明
+func updateCourse(c *gin.Context) {
+	var req utils.Message[struct {
+		ID          uint   `json:"id" binding:"required"`
+		Name        string `json:"name" binding:"required"`
+		Description string `json:"description"`
+	}]
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, utils.FailResult(utils.CodeBadRequest, "无效的请求参数: "+err.Error()))
+		return
+	}
+	userService, err := utils.GetDataFromContext(c, "UserInfo", &service.UserService{})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.FailResult(utils.CodeInternalError, err.Error()))
+		return
+	}
+	if err := userService.UpdateCourse(req.Data.ID, req.Data.Name, req.Data.Description); err != nil {
+		c.JSON(http.StatusBadRequest, utils.FailResult(utils.CodeBadRequest, err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, utils.SuccessResult("课程已更新"))
+}
+
+// deleteCourse 删除课程及其作业和学生进度
+func deleteCourse(c *gin.Context) {
+	var req utils.Message[struct {
+		ID uint `json:"id" binding:"required"`
+	}]
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, utils.FailResult(utils.CodeBadRequest, "无效的请求参数: "+err.Error()))
+		return
+	}
+	userService, err := utils.GetDataFromContext(c, "UserInfo", &service.UserService{})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.FailResult(utils.CodeInternalError, err.Error()))
+		return
+	}
+	if err := userService.DeleteCourse(req.Data.ID); err != nil {
+		c.JSON(http.StatusBadRequest, utils.FailResult(utils.CodeBadRequest, err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, utils.SuccessResult("课程已删除"))
+}
+
+// getCourseStudents 获取课程的学生
+func getCourseStudents(c *gin.Context) {
+	courseID, ok := queryID(c, "course_id")
+	if !ok {
+		return
+	}
+	userService, err := utils.GetDataFromContext(c, "UserInfo", &service.UserService{})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.FailResult(utils.CodeInternalError, err.Error()))
+		return
+	}
+	students, err := userService.GetCourseStudents(courseID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.FailResult(utils.CodeInternalError, err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, utils.SuccessResult(students))
+}
+
+// enrollStudents 按用户名批量选课，返回不存在的用户名
+func enrollStudents(c *gin.Context) {
+	var req utils.Message[struct {
+		CourseID  uint     `json:"course_id" binding:"required"`
+		Usernames []string `json:"usernames" binding:"required"`
+	}]
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, utils.FailResult(utils.CodeBadRequest, "无效的请求参数: "+err.Error()))
+		return
+	}
+	userService, err := utils.GetDataFromContext(c, "UserInfo", &service.UserService{})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.FailResult(utils.CodeInternalError, err.Error()))
+		return
+	}
+	notFound, err := userService.EnrollStudents(req.Data.CourseID, req.Data.Usernames)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, utils.FailResult(utils.CodeBadRequest, err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, utils.SuccessResult(gin.H{"not_found": notFound}))
+}
+
+// unenrollStudent 学生退课
+func unenrollStudent(c *gin.Context) {
+	var req utils.Message[struct {
+		CourseID uint `json:"course_id" binding:"required"`
+		UserID   uint `json:"user_id" binding:"required"`
+	}]
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, utils.FailResult(utils.CodeBadRequest, "无效的请求参数: "+err.Error()))
+		return
+	}
+	userService, err := utils.GetDataFromContext(c, "UserInfo", &service.UserService{})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.FailResult(utils.CodeInternalError, err.Error()))
+		return
+	}
+	if err := userService.UnenrollStudent(req.Data.CourseID, req.Data.UserID); err != nil {
+		c.JSON(http.StatusBadRequest, utils.FailResult(utils.CodeBadRequest, err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, utils.SuccessResult("已退课"))
+}
+
+// getAssignments 获取课程的作业，学生只能看到已开放的作业和自己的进度
+func getAssignments(c *gin.Context) {
+	courseID, ok := queryID(c, "course_id")
+	if !ok {
+		return
+	}
+	userService, err := utils.GetDataFromContext(c, "UserInfo", &service.UserService{})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.FailResult(utils.CodeInternalError, err.Error()))
+		return
+	}
+	assignments, err := userService.GetAssignments(courseID)
+	if err == service.ErrNotEnrolled {
+		c.JSON(http.StatusForbidden, utils.FailResult(http.StatusForbidden, err.Error()))
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.FailResult(utils.CodeInternalError, err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, utils.SuccessResult(assignments))
+}
+
+// createAssignment 为课程创建作业
+func createAssignment(c *gin.Context) {
+	var req utils.Message[assignmentRequest]
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, utils.FailResult(utils.CodeBadRequest, "无效的请求参数: "+err.Error()))
+		return
+	}
+	userService, err := utils.GetDataFromContext(c, "UserInfo", &service.UserService{})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.FailResult(utils.CodeInternalError, err.Error()))
+		return
+	}
+	assignment, err := userService.CreateAssignment(req.Data.CourseID, req.Data.form())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, utils.FailResult(utils.CodeBadRequest, err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, utils.SuccessResult(assignment))
+}
+
+// updateAssignment 修改作业
+func updateAssignment(c *gin.Context) {
+	var req utils.Message[assignmentRequest]
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, utils.FailResult(utils.CodeBadRequest, "无效的请求参数: "+err.Error()))
+		return
+	}
+	userService, err := utils.GetDataFromContext(c, "UserInfo", &service.UserService{})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.FailResult(utils.CodeInternalError, err.Error()))
+		return
+	}
+	if err := userService.UpdateAssignment(req.Data.ID, req.Data.form()); err != nil {
+		c.JSON(http.StatusBadRequest, utils.FailResult(utils.CodeBadRequest, err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, utils.SuccessResult("作业已更新"))
+}
+
+// deleteAssignment 删除作业
+func deleteAssignment(c *gin.Context) {
+	var req utils.Message[struct {
+		ID uint `json:"id" binding:"required"`
+	}]
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, utils.FailResult(utils.CodeBadRequest, "无效的请求参数: "+err.Error()))
+		return
+	}
+	userService, err := utils.GetDataFromContext(c, "UserInfo", &service.UserService{})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.FailResult(utils.CodeInternalError, err.Error()))
+		return
+	}
+	if err := userService.DeleteAssignment(req.Data.ID); err != nil {
+		c.JSON(http.StatusBadRequest, utils.FailResult(utils.CodeBadRequest, err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, utils.SuccessResult("作业已删除"))
+}
+
+// getAssignmentProgress 作业进度：每个学生在每个漏洞环境是未开启、已开启还是已解出
+func getAssignmentProgress(c *gin.Context) {
+	id, ok := queryID(c, "id")
+	if !ok {
+		return
+	}
+	userService, err := utils.GetDataFromContext(c, "UserInfo", &service.UserService{})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.FailResult(utils.CodeInternalError, err.Error()))
+		return
+	}
+	report, err := userService.GetAssignmentProgress(id)
+	if err == service.ErrAssignmentNotFound {
+		c.JSON(http.StatusNotFound, utils.FailResult(http.StatusNotFound, err.Error()))
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.FailResult(utils.CodeInternalError, err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, utils.SuccessResult(report))
+}
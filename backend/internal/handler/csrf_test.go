@@ -0,0 +1,136 @@
+package handler
+
+import (
+	"AscensionPath/internal/model"
+	"AscensionPath/internal/service"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// loginCookie 为用户创建会话，返回auth_token cookie
+func loginCookie(t *testing.T, user *model.User) *http.Cookie {
+	t.Helper()
+	tokens, err := service.CreateSession(user.ID, "192.0.2.1", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := generateToken(user.ID, user.Username, user.Role, tokens.SessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &http.Cookie{Name: "auth_token", Value: token}
+}
+
+func TestCSRFProtection(t *testing.T) {
+	conf, r := useTestServer(t)
+	conf.Security.CSRF = true
+	conf.Security.AllowedOrigins = "https://lab.example.edu"
+	alice := createTestUser(t, "alice", service.RoleUser)
+	authCookie := loginCookie(t, alice)
+	apiToken := createTestAPIToken(t, alice, service.ScopeUserWrite)
+
+	const csrfToken = "csrf-token-value"
+	profile := map[string]interface{}{"id": alice.ID, "email": "alice@example.edu", "status": -1, "score": -1}
+	for _, tc := range []struct {
+		name    string
+		method  string
+		path    string
+		cookie  bool   // 是否带auth_token cookie
+		csrf    string // csrf_token cookie的值
+		header  string // X-CSRF-Token请求头的值
+		auth    string // Authorization请求头
+		origin  string
+		referer string
+		status  int
+	}{
+		// cookie认证的写请求须双重提交CSRF令牌
+		{name: "缺少请求头", method: "POST", cookie: true, csrf: csrfToken, status: http.StatusForbidden},
+		{name: "请求头不一致", method: "POST", cookie: true, csrf: csrfToken, header: "other", status: http.StatusForbidden},
+		{name: "缺少cookie", method: "POST", cookie: true, header: csrfToken, status: http.StatusForbidden},
+		{name: "令牌一致", method: "POST", cookie: true, csrf: csrfToken, header: csrfToken, status: http.StatusOK},
+
+		// 安全方法不需要令牌
+		{name: "GET不需要令牌", method: "GET", path: "/api/v1/users/loginHistory", cookie: true, status: http.StatusOK},
+
+		// 携带Authorization请求头的请求不使用cookie，不需要令牌
+		{name: "请求头中的JWT", method: "POST", auth: authCookie.Value, status: http.StatusOK},
+		{name: "访问令牌", method: "POST", auth: "Bearer " + apiToken, status: http.StatusOK},
+
+		// cookie认证的请求须来自允许的来源，GET也不例外
+		{name: "其他网站的写请求", method: "POST", cookie: true, csrf: csrfToken, header: csrfToken, origin: "https://evil.example.com", status: http.StatusForbidden},
+		{name: "白名单来源的写请求", method: "POST", cookie: true, csrf: csrfToken, header: csrfToken, origin: "https://lab.example.edu", status: http.StatusOK},
+		{name: "同源写请求", method: "POST", cookie: true, csrf: csrfToken, header: csrfToken, origin: "http://example.com", status: http.StatusOK},
+		{name: "其他网站Origin的GET", method: "GET", path: "/api/v1/users/loginHistory", cookie: true, origin: "https://evil.example.com", status: http.StatusForbidden},
+		{name: "其他网站链接的GET", method: "GET", path: "/api/v1/vul/pullImage?image=evil", cookie: true, referer: "https://evil.example.com/page", status: http.StatusForbidden},
+		{name: "同源页面的GET", method: "GET", path: "/api/v1/users/loginHistory", cookie: true, referer: "http://example.com/static/", status: http.StatusOK},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path := tc.path
+			var data interface{}
+			if path == "" {
+				path, data = "/api/v1/users/profile", profile
+			}
+			req := newRequest(tc.method, path, data)
+			if tc.cookie {
+				req.AddCookie(authCookie)
+			}
+			if tc.csrf != "" {
+				req.AddCookie(&http.Cookie{Name: csrfCookie, Value: tc.csrf})
+			}
+			if tc.header != "" {
+				req.Header.Set(csrfHeader, tc.header)
+			}
+			if tc.auth != "" {
+				req.Header.Set("Authorization", tc.auth)
+			}
+			if tc.origin != "" {
+				req.Header.Set("Origin", tc.origin)
+			}
+			if tc.referer != "" {
+				req.Header.Set("Referer", tc.referer)
+			}
+			if w := serve(r, req); w.Code != tc.status {
+				t.Fatalf("状态码 %d，期望 %d: %s", w.Code, tc.status, w.Body.String())
+			}
+		})
+	}
+
+	// 升级前登录的会话没有CSRF令牌时在GET请求中补发
+	req := newRequest("GET", "/api/v1/users/loginHistory", nil)
+	req.AddCookie(authCookie)
+	w := serve(r, req)
+	if w.Code != http.StatusOK || !strings.Contains(w.Header().Get("Set-Cookie"), csrfCookie+"=") {
+		t.Errorf("没有补发CSRF令牌: %d %v", w.Code, w.Header().Values("Set-Cookie"))
+	}
+
+	// 关闭校验后不检查令牌和Referer
+	conf.Security.CSRF = false
+	req = newRequest("POST", "/api/v1/users/profile", profile)
+	req.AddCookie(authCookie)
+	req.Header.Set("Referer", "https://evil.example.com/page")
+	if w := serve(r, req); w.Code != http.StatusOK {
+		t.Errorf("关闭CSRF校验后请求被拒绝: %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestCORSAllowedOrigins(t *testing.T) {
+	conf, r := useTestServer(t)
+	conf.Security.AllowedOrigins = "https://lab.example.edu"
+
+	for _, tc := range []struct {
+		origin  string
+		allowed bool
+	}{
+		{"https://lab.example.edu", true},
+		{"https://evil.example.com", false},
+	} {
+		req := newRequest("OPTIONS", "/api/v1/users/profile", nil)
+		req.Header.Set("Origin", tc.origin)
+		req.Header.Set("Access-Control-Request-Method", "POST")
+		w := serve(r, req)
+		if got := w.Header().Get("Access-Control-Allow-Origin") == tc.origin; got != tc.allowed {
+			t.Errorf("%s 的预检请求: 状态码 %d, Access-Control-Allow-Origin=%q", tc.origin, w.Code, w.Header().Get("Access-Control-Allow-Origin"))
+		}
+	}
+}
@@ -1,7 +1,6 @@
 package handler
 
 import (
-	"context"
 	"net/http"
 
 	"AscensionPath/internal/middleware"
@@ -28,8 +27,12 @@ func PullImage(c *gin.Context) {
 		return
 	}
 
-	// 创建上下文
-	ctx, cancel := context.WithCancel(context.Background())
+	// 登记长耗时操作，停机时等待其完成
+	ctx, cancel, err := service.BeginOperation()
+	if err != nil {
+		utils.SendError(conn, utils.CodeInternalError, err.Error())
+		return
+	}
 	defer cancel()
 	go service.MonitorStopOperation(conn, cancel)
 
@@ -0,0 +1,26 @@
+package handler
+
+import (
+	"AscensionPath/internal/service"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// livez 存活检查，失败时应重启进程
+func livez(c *gin.Context) {
+	writeHealthReport(c, service.Liveness())
+}
+
+// readyz 就绪检查，失败时负载均衡应停止转发请求
+func readyz(c *gin.Context) {
+	writeHealthReport(c, service.Readiness(c.Request.Context()))
+}
+
+func writeHealthReport(c *gin.Context, report service.HealthReport) {
+	status := http.StatusOK
+	if report.Status != service.HealthOK {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, report)
+}
@@ -2,9 +2,13 @@ package handler
 
 import (
 	"AscensionPath/config"
+	"AscensionPath/internal/middleware"
 	"AscensionPath/internal/service"
 	"AscensionPath/internal/utils"
+	"errors"
+	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
@@ -19,10 +23,10 @@ type Claims struct {
 	jwt.StandardClaims
 }
 
-// 生成JWT token
-func generateToken(userID uint, username, role string) (string, error) {
-	// 设置token过期时间(18小时)
-	expirationTime := time.Now().Add(18 * time.Hour)
+// 生成访问令牌，jti为会话ID，用于注销后校验
+func generateToken(userID uint, username, role, sessionID string) (string, error) {
+	// 设置token过期时间
+	expirationTime := time.Now().Add(config.Current().Session.AccessTTL.Std())
 
 	// 创建claims
 	claims := &Claims{
@@ -30,17 +34,49 @@ func generateToken(userID uint, username, role string) (string, error) {
 		Username: username,
 		Role:     role,
 		StandardClaims: jwt.StandardClaims{
+			Id:        sessionID,
 			ExpiresAt: expirationTime.Unix(),
 			IssuedAt:  time.Now().Unix(),
 			Issuer:    "AscensionPath",
 		},
 	}
 
-	// 创建token
+	return signClaims(claims)
+}
+
+// 两步验证令牌的受众，与访问令牌区分
+const twoFactorAudience = "two_factor"
+
+// 两步验证令牌有效期，超时需重新输入密码
+const twoFactorTokenTTL = 5 * time.Minute
+
+// generateTwoFactorToken 密码验证通过后签发的临时令牌，只能用于完成两步验证
+func generateTwoFactorToken(userID uint, username string) (string, error) {
+	claims := &Claims{
+		UserID:   userID,
+		Username: username,
+		StandardClaims: jwt.StandardClaims{
+			Audience:  twoFactorAudience,
+			ExpiresAt: time.Now().Add(twoFactorTokenTTL).Unix(),
+			IssuedAt:  time.Now().Unix(),
+			Issuer:    "AscensionPath",
+		},
+	}
+	return signClaims(claims)
+}
+
+// signClaims 使用当前密钥签名，在头部写入密钥ID
+func signClaims(claims *Claims) (string, error) {
+	// 获取当前签名密钥
+	kid, secretKey, err := service.JwtKeys.Current()
+	if err != nil {
+		return "", err
+	}
+
+	// 创建token，在头部写入密钥ID
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = kid
 
-	// 签名token(请替换为您的实际密钥)
-	secretKey := config.JwtSecretKey // 应该从配置中获取
 	tokenString, err := token.SignedString(secretKey)
 	if err != nil {
 		return "", err
@@ -49,52 +85,129 @@ func generateToken(userID uint, username, role string) (string, error) {
 	return tokenString, nil
 }
 
-// 认证中间件
+// 强制修改密码期间允许访问的接口
+var passwordChangePaths = map[string]bool{
+	"/api/v1/users/updatePassword": true,
+	"/api/v1/users/getUserInfo":    true,
+	"/api/v1/users/logout":         true,
+}
+
+// 身份要求两步验证但尚未启用时允许访问的接口
+var twoFactorSetupPaths = map[string]bool{
+	"/api/v1/users/getUserInfo":      true,
+	"/api/v1/users/logout":           true,
+	"/api/v1/users/twoFactor":        true,
+	"/api/v1/users/twoFactor/setup":  true,
+	"/api/v1/users/twoFactor/enable": true,
+}
+
+// 认证中间件，同时接受JWT和个人访问令牌
 func authMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// 1. 尝试从cookie或header中获取token
 		var token string
+		fromCookie := false
 		if cookieToken, err := c.Cookie("auth_token"); err == nil {
 			token = cookieToken
+			fromCookie = true
 		} else {
 			authHeader := c.GetHeader("Authorization")
 			token = authHeader
 		}
 
-		// 2. 验证token是否有效
-		claims, err := validateToken(token)
-		if err != nil {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, utils.FailResult(utils.CodeUnauthorized, "无效的token"))
-			return
+		// 2. 验证token是否有效，个人访问令牌只能访问其权限范围内的接口
+		var userService *service.UserService
+		if raw := strings.TrimPrefix(token, "Bearer "); strings.HasPrefix(raw, service.APITokenPrefix) {
+			apiToken, err := service.AuthenticateAPIToken(raw)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, utils.FailResult(utils.CodeUnauthorized, err.Error()))
+				return
+			}
+			// 无论请求是否成功都记录调用
+			defer func() {
+				service.RecordAPITokenUsage(apiToken.ID, c.Request.Method, c.Request.URL.Path, c.ClientIP(), c.Writer.Status())
+			}()
+			scope, ok := apiTokenRouteScopes[c.Request.Method+" "+c.FullPath()]
+			if !ok || !apiToken.HasScope(scope) {
+				c.AbortWithStatusJSON(http.StatusForbidden, utils.FailResult(http.StatusForbidden, "访问令牌无权访问该接口"))
+				return
+			}
+			// 标记为令牌请求，身份的权限只能在令牌的权限范围内使用
+			userService = &service.UserService{
+				UserDTO:  service.UserDTO{ID: apiToken.UserID},
+				APIToken: apiToken,
+			}
+		} else {
+			claims, err := validateToken(token)
+			if err != nil || claims.Audience != "" {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, utils.FailResult(utils.CodeUnauthorized, "无效的token"))
+				return
+			}
+			// 检查会话是否已注销
+			if err := service.ValidateSession(claims.Id, claims.UserID, c.ClientIP()); err != nil {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, utils.FailResult(utils.CodeUnauthorized, err.Error()))
+				return
+			}
+			userService = &service.UserService{
+				// 临时用户信息，存储必要的查询条件
+				UserDTO: service.UserDTO{
+					ID:   claims.UserID,
+					Role: claims.Role,
+				},
+				SessionID: claims.Id,
+			}
 		}
-		// 3. 将用户信息存入上下文
-		userService := &service.UserService{
-			// 临时用户信息，存储必要的查询条件
-			UserDTO: service.UserDTO{
-				ID:   claims.UserID,
-				Role: claims.Role,
-			},
+
+		// 3. 只用cookie认证的请求须来自允许的来源，写请求须携带CSRF令牌，升级前登录的会话没有令牌时补发
+		if fromCookie {
+			if !csrfValid(c) {
+				c.AbortWithStatusJSON(http.StatusForbidden, utils.FailResult(http.StatusForbidden, "请求来源不允许或CSRF令牌无效"))
+				return
+			}
+			if _, err := c.Cookie(csrfCookie); err != nil {
+				setCSRFCookie(c)
+			}
 		}
-		userInfo, err := userService.GetUserByID(claims.UserID)
+
+		// 4. 将用户信息存入上下文
+		userInfo, err := userService.GetUserByID(userService.ID)
 		if err != nil || userInfo.Status == 0 { // 检查用户状态
 			c.AbortWithStatusJSON(http.StatusUnauthorized, utils.FailResult(utils.CodeUnauthorized, "用户不存在或已被禁用"))
 			return
 		}
 		userService.UserDTO = *userInfo // 更新用户信息
+
+		// 5. 需要修改密码的用户只能访问改密相关接口
+		if userInfo.MustChangePassword && !passwordChangePaths[c.FullPath()] {
+			c.AbortWithStatusJSON(http.StatusForbidden, utils.FailResult(http.StatusForbidden, "请先修改密码"))
+			return
+		}
+		// 6. 身份要求两步验证的用户只能访问启用两步验证相关接口
+		if !twoFactorSetupPaths[c.FullPath()] && service.TwoFactorSetupRequired(userInfo.ID, userInfo.Role) {
+			c.AbortWithStatusJSON(http.StatusForbidden, utils.FailResult(http.StatusForbidden, service.ErrTwoFactorSetupRequired.Error()))
+			return
+		}
 		c.Set("UserInfo", userService)
 		c.Next()
 	}
 }
 
-// 认证是否为管理员
-func isAdmin() gin.HandlerFunc {
+// 校验当前用户的身份拥有任一权限，需放在authMiddleware之后
+func requirePermission(permissions ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userInfo, err := utils.GetDataFromContext(c, "UserInfo", &service.UserService{})
 		if err != nil {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, utils.FailResult(utils.CodeUnauthorized, "未授权"))
 			return
 		}
-		if userInfo.UserDTO.Role != "admin" {
+		allowed := false
+		for _, p := range permissions {
+			if userInfo.Can(p) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
 			c.AbortWithStatusJSON(http.StatusForbidden, utils.FailResult(utils.CodeUnauthorized, "权限不足"))
 			return
 		}
@@ -102,11 +215,25 @@ func isAdmin() gin.HandlerFunc {
 	}
 }
 
+// validateTwoFactorToken 校验两步验证令牌，返回密码验证通过的用户ID
+func validateTwoFactorToken(tokenString string) (uint, error) {
+	claims, err := validateToken(tokenString)
+	if err != nil || claims.Audience != twoFactorAudience {
+		return 0, errors.New("两步验证已超时，请重新登录")
+	}
+	return claims.UserID, nil
+}
+
 // 验证token有效性
 func validateToken(tokenString string) (*Claims, error) {
 	claims := &Claims{}
 	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		return config.JwtSecretKey, nil // 使用与生成token相同的密钥
+		if token.Method != jwt.SigningMethodHS256 {
+			return nil, fmt.Errorf("不支持的签名算法: %v", token.Header["alg"])
+		}
+		// 根据kid查找签名密钥(当前密钥或宽限期内的上一个密钥)
+		kid, _ := token.Header["kid"].(string)
+		return service.JwtKeys.Lookup(kid)
 	})
 
 	if err != nil || !token.Valid {
@@ -115,3 +242,25 @@ func validateToken(tokenString string) (*Claims, error) {
 
 	return claims, nil
 }
+
+// rotateJwtKey 手动轮换JWT签名密钥
+func rotateJwtKey(c *gin.Context) {
+	userService, err := utils.GetDataFromContext(c, "UserInfo", &service.UserService{})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.FailResult(utils.CodeInternalError, err.Error()))
+		return
+	}
+
+	key, err := service.JwtKeys.Rotate()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.FailResult(utils.CodeInternalError, err.Error()))
+		middleware.SugarLogger.Errorf("用户: %s 轮换JWT密钥失败: %s", userService.Username, err.Error())
+		return
+	}
+
+	middleware.SugarLogger.Infof("用户: %s 轮换JWT密钥成功, kid: %s", userService.Username, key.Kid)
+	c.JSON(http.StatusOK, utils.SuccessResult(gin.H{
+		"kid":        key.Kid,
+		"created_at": key.CreatedAt,
+	}))
+}
@@ -0,0 +1,184 @@
+package handler
+
+import (
+	"AscensionPath/config"
+	"AscensionPath/internal/middleware"
+	"AscensionPath/internal/model"
+	"AscensionPath/internal/service"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// TestMain 将测试日志写到临时目录，避免在源码目录下生成日志文件
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "ascension-handler-test")
+	if err != nil {
+		panic(err)
+	}
+	logConf := config.Default().Log
+	logConf.File = filepath.Join(dir, "app.log")
+	middleware.InitLogger(logConf)
+	gin.SetMode(gin.TestMode)
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// useTestServer 使用临时SQLite数据库注册所有路由，测试结束后恢复全局配置
+func useTestServer(t *testing.T) (*config.Config, *gin.Engine) {
+	t.Helper()
+	dbConf := config.Default().Database
+	dbConf.DSN = filepath.Join(t.TempDir(), "test.db")
+	db, err := model.Open(dbConf)
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	if _, err := model.MigrateUp(db, 0, false); err != nil {
+		t.Fatalf("迁移数据表失败: %v", err)
+	}
+
+	conf := config.Default()
+	conf.Login.BaseDelay = 0
+	oldDB, oldConf := model.DB, config.Current()
+	model.DB = db
+	config.Set(conf)
+	t.Cleanup(func() {
+		model.CloseDB()
+		model.DB = oldDB
+		config.Set(oldConf)
+	})
+	if err := service.Roles.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.JwtKeys.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	r := gin.New()
+	RegisterRoutes(r)
+	return conf, r
+}
+
+// createTestUser 创建本地用户，密码为 username + "123456"
+func createTestUser(t *testing.T, username, role string) *model.User {
+	t.Helper()
+	hashed, err := bcrypt.GenerateFromPassword([]byte(username+"123456"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := &model.User{Username: username, Password: string(hashed), Email: username + "@local", Status: 1, Role: role}
+	if err := model.CreateUser(user); err != nil {
+		t.Fatalf("创建用户失败: %v", err)
+	}
+	return user
+}
+
+// createTestAPIToken 为用户创建个人访问令牌
+func createTestAPIToken(t *testing.T, user *model.User, scopes ...string) string {
+	t.Helper()
+	s := &service.UserService{UserDTO: service.UserDTO{ID: user.ID, Username: user.Username, Role: user.Role}}
+	token, _, err := s.CreateAPIToken(user.ID, "test", scopes, 30)
+	if err != nil {
+		t.Fatalf("创建访问令牌失败: %v", err)
+	}
+	return token
+}
+
+// serve 发送请求，body不为空时作为JSON请求体
+func serve(r *gin.Engine, req *http.Request) *httptest.ResponseRecorder {
+	if req.Body != nil && req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// newRequest 构造请求，data不为空时包装为 {"data": data} 请求体
+func newRequest(method, path string, data interface{}) *http.Request {
+	if data == nil {
+		return httptest.NewRequest(method, path, nil)
+	}
+	body, _ := json.Marshal(map[string]interface{}{"data": data})
+	return httptest.NewRequest(method, path, strings.NewReader(string(body)))
+}
+
+func TestAPITokenCannotBypassScopes(t *testing.T) {
+	_, r := useTestServer(t)
+	admin := createTestUser(t, "admin", service.RoleAdmin)
+	alice := createTestUser(t, "alice", service.RoleUser)
+	bob := createTestUser(t, "bob", service.RoleUser)
+
+	adminWrite := createTestAPIToken(t, admin, service.ScopeUserWrite)
+	adminRead := createTestAPIToken(t, admin, service.ScopeUserRead)
+	adminUsers := createTestAPIToken(t, admin, service.ScopeUserRead, service.ScopeUserWrite, service.ScopeAdminUsers)
+	aliceWrite := createTestAPIToken(t, alice, service.ScopeUserWrite)
+
+	profile := func(id uint, fields map[string]interface{}) map[string]interface{} {
+		data := map[string]interface{}{"id": id, "status": -1, "score": -1}
+		for k, v := range fields {
+			data[k] = v
+		}
+		return data
+	}
+	for _, tc := range []struct {
+		name   string
+		token  string
+		method string
+		path   string
+		data   interface{}
+		status int
+	}{
+		// 管理员的user:write令牌只能修改自己的资料，不能修改他人的身份、状态、积分和密码
+		{"修改他人身份", adminWrite, "POST", "/api/v1/users/profile", profile(bob.ID, map[string]interface{}{"role": service.RoleAdmin}), http.StatusForbidden},
+		{"禁用他人", adminWrite, "POST", "/api/v1/users/profile", profile(bob.ID, map[string]interface{}{"status": 0}), http.StatusForbidden},
+		{"修改他人积分", adminWrite, "POST", "/api/v1/users/profile", profile(bob.ID, map[string]interface{}{"score": 1000}), http.StatusForbidden},
+		{"修改他人密码", adminWrite, "POST", "/api/v1/users/profile", profile(bob.ID, map[string]interface{}{"password": "Str0ng!Passw0rd"}), http.StatusForbidden},
+		{"修改自己的密码", adminWrite, "POST", "/api/v1/users/profile", profile(admin.ID, map[string]interface{}{"password": "Str0ng!Passw0rd"}), http.StatusForbidden},
+		{"普通用户不验证旧密码修改密码", aliceWrite, "POST", "/api/v1/users/profile", profile(alice.ID, map[string]interface{}{"password": "Str0ng!Passw0rd"}), http.StatusForbidden},
+		{"修改自己的邮箱", aliceWrite, "POST", "/api/v1/users/profile", profile(alice.ID, map[string]interface{}{"email": "alice@example.edu"}), http.StatusOK},
+		// 令牌不能访问修改密码接口
+		{"修改密码接口", aliceWrite, "POST", "/api/v1/users/updatePassword", map[string]interface{}{"user_id": alice.ID, "new_password": "Str0ng!Passw0rd"}, http.StatusForbidden},
+
+		// user:read令牌只能查看自己的登录记录和积分流水
+		{"查看他人登录记录", adminRead, "GET", "/api/v1/users/loginHistory?id=" + fmt.Sprint(bob.ID), nil, http.StatusForbidden},
+		{"查看自己的登录记录", adminRead, "GET", "/api/v1/users/loginHistory", nil, http.StatusOK},
+		{"查看他人积分流水", adminRead, "GET", "/api/v1/users/scoreLedger?id=" + fmt.Sprint(bob.ID), nil, http.StatusForbidden},
+		{"查看自己的积分流水", adminRead, "GET", "/api/v1/users/scoreLedger?id=" + fmt.Sprint(admin.ID), nil, http.StatusOK},
+
+		// 同时授予admin:users时可以使用用户管理权限，但仍不能修改密码
+		{"授权后查看他人登录记录", adminUsers, "GET", "/api/v1/users/loginHistory?id=" + fmt.Sprint(bob.ID), nil, http.StatusOK},
+		{"授权后查看他人积分流水", adminUsers, "GET", "/api/v1/users/scoreLedger?id=" + fmt.Sprint(bob.ID), nil, http.StatusOK},
+		{"授权后修改他人身份", adminUsers, "POST", "/api/v1/users/profile", profile(bob.ID, map[string]interface{}{"role": service.RoleVip}), http.StatusOK},
+		{"授权后修改他人密码", adminUsers, "POST", "/api/v1/users/profile", profile(bob.ID, map[string]interface{}{"password": "Str0ng!Passw0rd"}), http.StatusForbidden},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req := newRequest(tc.method, tc.path, tc.data)
+			req.Header.Set("Authorization", "Bearer "+tc.token)
+			if w := serve(r, req); w.Code != tc.status {
+				t.Fatalf("状态码 %d，期望 %d: %s", w.Code, tc.status, w.Body.String())
+			}
+		})
+	}
+
+	// 被拒绝的请求没有修改任何字段
+	bobNow, _ := model.GetUserByID(bob.ID)
+	if bobNow.Role != service.RoleVip || bobNow.Status != 1 || bobNow.Score != 0 || bobNow.Password != bob.Password {
+		t.Errorf("被拒绝的请求修改了用户: %+v", bobNow)
+	}
+	for _, user := range []*model.User{admin, alice} {
+		if now, _ := model.GetUserByID(user.ID); now.Password != user.Password {
+			t.Errorf("%s 的密码被令牌修改", user.Username)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"AscensionPath/internal/service"
+	"AscensionPath/internal/utils"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// getLoginHistory 获取登录记录，默认为当前用户，管理员可通过id查看其他用户
+func getLoginHistory(c *gin.Context) {
+	page, err := utils.StringToInt(c.DefaultQuery("page", "1"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, utils.FailResult(utils.CodeBadRequest, "无效的页码: "+err.Error()))
+		return
+	}
+	pageSize, err := utils.StringToInt(c.DefaultQuery("pageSize", "10"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, utils.FailResult(utils.CodeBadRequest, "无效的每页数量: "+err.Error()))
+		return
+	}
+	userService, err := utils.GetDataFromContext(c, "UserInfo", &service.UserService{})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.FailResult(utils.CodeInternalError, err.Error()))
+		return
+	}
+	userID := userService.ID
+	if id := c.Query("id"); id != "" {
+		n, err := utils.StringToInt(id)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, utils.FailResult(utils.CodeBadRequest, "无效的用户ID: "+err.Error()))
+			return
+		}
+		userID = uint(n)
+	}
+
+	histories, count, err := userService.GetLoginHistory(userID, page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusForbidden, utils.FailResult(http.StatusForbidden, err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, utils.SuccessResult(struct {
+		Histories []service.LoginHistoryDTO `json:"histories"`
+		Count     int64                     `json:"count"`
+	}{Histories: histories, Count: count}))
+}
+
+// getLoginLocks 获取当前被锁定的账号和IP
+func getLoginLocks(c *gin.Context) {
+	userService, err := utils.GetDataFromContext(c, "UserInfo", &service.UserService{})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.FailResult(utils.CodeInternalError, err.Error()))
+		return
+	}
+	locks, err := userService.GetLoginLocks()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.FailResult(utils.CodeInternalError, err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, utils.SuccessResult(locks))
+}
+
+// unlockLogin 解除账号或IP的登录锁定
+func unlockLogin(c *gin.Context) {
+	var req utils.Message[struct {
+		Username string `json:"username"`
+		IP       string `json:"ip"`
+	}]
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, utils.FailResult(utils.CodeBadRequest, "无效的请求参数: "+err.Error()))
+		return
+	}
+	userService, err := utils.GetDataFromContext(c, "UserInfo", &service.UserService{})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.FailResult(utils.CodeInternalError, err.Error()))
+		return
+	}
+	if err := userService.UnlockLogin(req.Data.Username, req.Data.IP); err != nil {
+		c.JSON(http.StatusBadRequest, utils.FailResult(utils.CodeBadRequest, err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, utils.SuccessResult("已解除锁定"))
+}
@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"AscensionPath/config"
+	"AscensionPath/internal/middleware"
+	"AscensionPath/internal/service"
+	"AscensionPath/internal/utils"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// state cookie只在单点登录接口下发送，用于确认回调来自发起登录的浏览器
+const (
+	oidcStateCookie     = "oidc_state"
+	oidcStateCookiePath = "/api/v1/users/oidc"
+)
+
+// getOIDCConfig 登录页获取单点登录是否可用
+func getOIDCConfig(c *gin.Context) {
+	conf := config.Current().OIDC
+	c.JSON(http.StatusOK, utils.SuccessResult(gin.H{
+		"enabled":      conf.Enabled,
+		"display_name": conf.DisplayName,
+	}))
+}
+
+// oidcLogin 跳转到IdP登录
+func oidcLogin(c *gin.Context) {
+	start, err := service.StartOIDCLogin(c.Request.Context())
+	if err != nil {
+		middleware.SugarLogger.Errorw("发起单点登录失败", "error", err.Error())
+		redirectToFrontendLogin(c, url.Values{"oidc_error": {err.Error()}})
+		return
+	}
+	// IdP回调是跨站的顶级跳转，需要Lax才能带上cookie
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, start.State, 600, oidcStateCookiePath, "", false, true)
+	c.Redirect(http.StatusFound, start.AuthURL)
+}
+
+// oidcCallback IdP登录完成后的回调，校验通过后带一次性登录码跳转回前端
+func oidcCallback(c *gin.Context) {
+	state := c.Query("state")
+	cookieState, _ := c.Cookie(oidcStateCookie)
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, "", -1, oidcStateCookiePath, "", false, true)
+
+	if idpErr := c.Query("error"); idpErr != "" {
+		msg := strings.TrimSpace("IdP登录失败: " + idpErr + " " + c.Query("error_description"))
+		redirectToFrontendLogin(c, url.Values{"oidc_error": {msg}})
+		return
+	}
+	if state == "" || state != cookieState {
+		redirectToFrontendLogin(c, url.Values{"oidc_error": {service.ErrOIDCStateInvalid.Error()}})
+		return
+	}
+	code, err := service.FinishOIDCLogin(c.Request.Context(), state, c.Query("code"), c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		middleware.SugarLogger.Warnw("单点登录失败", "ip", c.ClientIP(), "error", err.Error())
+		redirectToFrontendLogin(c, url.Values{"oidc_error": {err.Error()}})
+		return
+	}
+	redirectToFrontendLogin(c, url.Values{"oidc_code": {code}})
+}
+
+// oidcExchange 前端用一次性登录码换取会话，响应与密码登录相同
+func oidcExchange(c *gin.Context) {
+	var req utils.Message[struct {
+		Code string `json:"code" binding:"required"`
+	}]
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, utils.FailResult(utils.CodeBadRequest, "无效的请求参数: "+err.Error()))
+		return
+	}
+	user, err := service.ExchangeOIDCLoginCode(req.Data.Code, c.ClientIP(), c.Request.UserAgent())
+	if errors.Is(err, service.ErrTwoFactorRequired) {
+		token, err := generateTwoFactorToken(user.ID, user.Username)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, utils.FailResult(utils.CodeInternalError, "生成token失败: "+err.Error()))
+			return
+		}
+		c.JSON(http.StatusOK, utils.SuccessResult(gin.H{
+			"two_factor_required": true,
+			"two_factor_token":    token,
+		}))
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, utils.FailResult(utils.CodeUnauthorized, "登录失败: "+err.Error()))
+		return
+	}
+	issueSession(c, user)
+}
+
+// redirectToFrontendLogin 跳转到前端登录页，前端使用hash路由
+func redirectToFrontendLogin(c *gin.Context, params url.Values) {
+	target := strings.TrimSuffix(config.Current().OIDC.FrontendURL, "/") + "/#/login?" + params.Encode()
+	c.Redirect(http.StatusFound, target)
+}
@@ -0,0 +1,63 @@
+package handler
+
+import (
+	"AscensionPath/config"
+	"AscensionPath/internal/service"
+	"AscensionPath/internal/utils"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// getPasswordPolicy 注册、修改密码和登录页获取密码策略及是否可以自助重置密码
+func getPasswordPolicy(c *gin.Context) {
+	c.JSON(http.StatusOK, utils.SuccessResult(gin.H{
+		"min_length":    config.Current().Password.MinLength,
+		"reset_enabled": config.Current().PasswordReset.Enabled,
+	}))
+}
+
+// forgotPassword 申请通过邮件重置密码，邮箱不存在时同样返回成功
+func forgotPassword(c *gin.Context) {
+	var req utils.Message[struct {
+		Email string `json:"email" binding:"required,email"`
+	}]
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, utils.FailResult(utils.CodeBadRequest, "无效的请求参数: "+err.Error()))
+		return
+	}
+	if err := service.ForgotPassword(req.Data.Email, c.ClientIP()); err != nil {
+		statusCode := http.StatusInternalServerError
+		if err == service.ErrPasswordResetDisabled {
+			statusCode = http.StatusForbidden
+		}
+		c.JSON(statusCode, utils.FailResult(statusCode, err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, utils.SuccessResult("如果该邮箱已注册，重置链接将发送到该邮箱"))
+}
+
+// resetPassword 使用邮件中的令牌设置新密码
+func resetPassword(c *gin.Context) {
+	var req utils.Message[struct {
+		Token    string `json:"token" binding:"required"`
+		Password string `json:"password" binding:"required"`
+	}]
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, utils.FailResult(utils.CodeBadRequest, "无效的请求参数: "+err.Error()))
+		return
+	}
+	if err := service.ResetPassword(req.Data.Token, req.Data.Password); err != nil {
+		statusCode := http.StatusInternalServerError
+		switch {
+		case err == service.ErrPasswordResetDisabled:
+			statusCode = http.StatusForbidden
+		case err == service.ErrInvalidResetToken, errors.Is(err, utils.ErrWeakPassword):
+			statusCode = http.StatusBadRequest
+		}
+		c.JSON(statusCode, utils.FailResult(statusCode, err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, utils.SuccessResult("密码已重置，请使用新密码登录"))
+}
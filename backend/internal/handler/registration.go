@@ -0,0 +1,117 @@
+package handler
+
+import (
+	"AscensionPath/internal/service"
+	"AscensionPath/internal/utils"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// getRegistrationInfo 注册页获取注册方式、允许的邮箱域名和激活方式
+func getRegistrationInfo(c *gin.Context) {
+	c.JSON(http.StatusOK, utils.SuccessResult(service.GetRegistrationInfo()))
+}
+
+// verifyEmail 使用验证邮件中的令牌启用账号
+func verifyEmail(c *gin.Context) {
+	var req utils.Message[struct {
+		Token string `json:"token" binding:"required"`
+	}]
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, utils.FailResult(utils.CodeBadRequest, "无效的请求参数: "+err.Error()))
+		return
+	}
+	user, err := service.VerifyEmail(req.Data.Token)
+	if err != nil {
+		statusCode := http.StatusInternalServerError
+		if err == service.ErrInvalidVerifyToken {
+			statusCode = http.StatusBadRequest
+		}
+		c.JSON(statusCode, utils.FailResult(statusCode, err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, utils.SuccessResult(gin.H{"username": user.Username}))
+}
+
+// resendVerification 重新发送验证邮件，邮箱不存在或不需要验证时同样返回成功
+func resendVerification(c *gin.Context) {
+	var req utils.Message[struct {
+		Email string `json:"email" binding:"required,email"`
+	}]
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, utils.FailResult(utils.CodeBadRequest, "无效的请求参数: "+err.Error()))
+		return
+	}
+	if err := service.ResendVerification(req.Data.Email, c.ClientIP()); err != nil {
+		statusCode := http.StatusInternalServerError
+		if err == service.ErrEmailVerifyDisabled {
+			statusCode = http.StatusForbidden
+		}
+		c.JSON(statusCode, utils.FailResult(statusCode, err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, utils.SuccessResult("如果该邮箱正在等待验证，验证邮件将重新发送"))
+}
+
+// getInviteCodes 获取所有邀请码及使用情况
+func getInviteCodes(c *gin.Context) {
+	userService, err := utils.GetDataFromContext(c, "UserInfo", &service.UserService{})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.FailResult(utils.CodeInternalError, err.Error()))
+		return
+	}
+	invites, err := userService.ListInviteCodes()
+	if err != nil {
+		c.JSON(http.StatusForbidden, utils.FailResult(http.StatusForbidden, err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, utils.SuccessResult(invites))
+}
+
+// createInviteCode 生成邀请码
+func createInviteCode(c *gin.Context) {
+	var req utils.Message[struct {
+		Role          string  `json:"role"`
+		Score         float64 `json:"score"`
+		MaxUses       int     `json:"max_uses" binding:"required"`
+		ExpiresInDays int     `json:"expires_in_days"` // 0表示不过期
+		Note          string  `json:"note"`
+	}]
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, utils.FailResult(utils.CodeBadRequest, "无效的请求参数: "+err.Error()))
+		return
+	}
+	userService, err := utils.GetDataFromContext(c, "UserInfo", &service.UserService{})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.FailResult(utils.CodeInternalError, err.Error()))
+		return
+	}
+	invite, err := userService.CreateInviteCode(req.Data.Role, req.Data.Score, req.Data.MaxUses, req.Data.ExpiresInDays, req.Data.Note)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, utils.FailResult(utils.CodeBadRequest, err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, utils.SuccessResult(invite))
+}
+
+// deleteInviteCode 删除邀请码
+func deleteInviteCode(c *gin.Context) {
+	var req utils.Message[struct {
+		ID uint `json:"id" binding:"required"`
+	}]
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, utils.FailResult(utils.CodeBadRequest, "无效的请求参数: "+err.Error()))
+		return
+	}
+	userService, err := utils.GetDataFromContext(c, "UserInfo", &service.UserService{})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.FailResult(utils.CodeInternalError, err.Error()))
+		return
+	}
+	if err := userService.DeleteInviteCode(req.Data.ID); err != nil {
+		c.JSON(http.StatusBadRequest, utils.FailResult(utils.CodeBadRequest, err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, utils.SuccessResult("已删除邀请码"))
+}
@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"AscensionPath/internal/service"
+	"AscensionPath/internal/utils"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// roleRequest 创建和修改身份的请求
+type roleRequest struct {
+	Name        string   `json:"name" binding:"required"`
+	Description string   `json:"description"`
+	Level       *int     `json:"level" binding:"required"` // 漏洞环境开放级别，0表示可见所有环境
+	Permissions []string `json:"permissions"`
+}
+
+// getRoles 获取所有身份及其权限和使用人数
+func getRoles(c *gin.Context) {
+	userService, err := utils.GetDataFromContext(c, "UserInfo", &service.UserService{})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.FailResult(utils.CodeInternalError, err.Error()))
+		return
+	}
+	roles, err := userService.ListRoles()
+	if err != nil {
+		c.JSON(http.StatusForbidden, utils.FailResult(http.StatusForbidden, err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, utils.SuccessResult(roles))
+}
+
+// getPermissions 获取所有可分配的权限
+func getPermissions(c *gin.Context) {
+	c.JSON(http.StatusOK, utils.SuccessResult(service.Permissions))
+}
+
+// createRole 创建身份
+func createRole(c *gin.Context) {
+	var req utils.Message[roleRequest]
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, utils.FailResult(utils.CodeBadRequest, "无效的请求参数: "+err.Error()))
+		return
+	}
+	userService, err := utils.GetDataFromContext(c, "UserInfo", &service.UserService{})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.FailResult(utils.CodeInternalError, err.Error()))
+		return
+	}
+	role, err := userService.CreateRole(req.Data.Name, req.Data.Description, *req.Data.Level, req.Data.Permissions)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, utils.FailResult(utils.CodeBadRequest, err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, utils.SuccessResult(role))
+}
+
+// updateRole 修改身份的说明、开放级别和权限，修改后立即对该身份的所有用户生效
+func updateRole(c *gin.Context) {
+	var req utils.Message[roleRequest]
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, utils.FailResult(utils.CodeBadRequest, "无效的请求参数: "+err.Error()))
+		return
+	}
+	userService, err := utils.GetDataFromContext(c, "UserInfo", &service.UserService{})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.FailResult(utils.CodeInternalError, err.Error()))
+		return
+	}
+	role, err := userService.UpdateRole(req.Data.Name, req.Data.Description, *req.Data.Level, req.Data.Permissions)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, utils.FailResult(utils.CodeBadRequest, err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, utils.SuccessResult(role))
+}
+
+// deleteRole 删除没有用户使用的自定义身份
+func deleteRole(c *gin.Context) {
+	var req utils.Message[struct {
+		Name string `json:"name" binding:"required"`
+	}]
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, utils.FailResult(utils.CodeBadRequest, "无效的请求参数: "+err.Error()))
+		return
+	}
+	userService, err := utils.GetDataFromContext(c, "UserInfo", &service.UserService{})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.FailResult(utils.CodeInternalError, err.Error()))
+		return
+	}
+	if err := userService.DeleteRole(req.Data.Name); err != nil {
+		c.JSON(http.StatusBadRequest, utils.FailResult(utils.CodeBadRequest, err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, utils.SuccessResult("已删除身份"))
+}
@@ -1,6 +1,8 @@
 package handler
 
 import (
+	"AscensionPath/internal/service"
+	"AscensionPath/internal/utils"
 	"net/http"
 	"time"
 
@@ -9,27 +11,14 @@ import (
 )
 
 func RegisterRoutes(r *gin.Engine) {
-	// 统一使用CORS中间件替代全局OPTIONS处理
-	// 修改后的CORS配置
+	// 跨域请求只允许 security.allowed_origins 中的来源，WebSocket升级使用同一白名单
 	r.Use(cors.New(cors.Config{
-		AllowOriginFunc: func(origin string) bool {
-			// allowedOrigins := []string{
-			// 	"http://localhost:3006",
-			// 	"http://127.0.0.1:3006",
-			// 	"http://localhost:8000",
-			// 	"http://127.0.0.1:8000",
-			// }
-			// for _, o := range allowedOrigins {
-			// 	if origin == o {
-			// 		return true
-			// 	}
-			// }
-			// return false
-			return true
+		AllowOriginWithContextFunc: func(c *gin.Context, origin string) bool {
+			return utils.OriginAllowed(c.Request)
 		},
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Content-Type", "Authorization", "Upgrade", "Connection"}, // 新增WebSocket头
-		ExposeHeaders:    []string{"Content-Length", "Sec-WebSocket-Accept"},                 // 暴露WebSocket头
+		AllowHeaders:     []string{"Content-Type", "Authorization", "Upgrade", "Connection", csrfHeader}, // 新增WebSocket头
+		ExposeHeaders:    []string{"Content-Length", "Sec-WebSocket-Accept"},                             // 暴露WebSocket头
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	}))
@@ -40,15 +29,33 @@ func RegisterRoutes(r *gin.Engine) {
 			"status": "ok",
 		})
 	})
+	r.GET("/livez", livez)
+	r.GET("/readyz", readyz)
 
 	// API v1 版本路由组
 	v1 := r.Group("/api/v1")
 	{
+		// 首次启动初始化
+		v1.GET("/setup", getSetupStatus)
+		v1.POST("/setup", completeSetup)
+
 		// 用户相关路由
 		userGroup := v1.Group("/users")
 		{
 			userGroup.POST("/register", registerUser)
 			userGroup.POST("/login", loginUser)
+			userGroup.POST("/login/twoFactor", loginTwoFactor)
+			userGroup.POST("/refresh", refreshToken)
+			userGroup.GET("/passwordPolicy", getPasswordPolicy)
+			userGroup.POST("/forgotPassword", forgotPassword)
+			userGroup.POST("/resetPassword", resetPassword)
+			userGroup.GET("/registration", getRegistrationInfo)
+			userGroup.POST("/verifyEmail", verifyEmail)
+			userGroup.POST("/resendVerification", resendVerification)
+			userGroup.GET("/oidc", getOIDCConfig)
+			userGroup.GET("/oidc/login", oidcLogin)
+			userGroup.GET("/oidc/callback", oidcCallback)
+			userGroup.POST("/oidc/exchange", oidcExchange)
 
 			// 认证路由组使用明确路径
 			authGroup := userGroup.Group("")
@@ -57,14 +64,33 @@ func RegisterRoutes(r *gin.Engine) {
 				authGroup.POST("/profile", updateProfile)
 				authGroup.POST("/updatePassword", changePassword)
 				authGroup.GET("/getUserInfo", getUserByID)
-				adminGroup := authGroup.Group("")
-				adminGroup.Use(isAdmin())
-				{
-					adminGroup.POST("/deleteUser", deleteUser)
-					adminGroup.GET("/getAllUsers", getAllUsers)
-					adminGroup.POST("/addUser", addUser)
-					adminGroup.POST("/searchUsers", searchUsers)
-				}
+				authGroup.POST("/logout", logout)
+				authGroup.POST("/logoutAll", logoutAll)
+				authGroup.GET("/sessions", getSessions)
+				authGroup.POST("/revokeSession", revokeSession)
+				authGroup.GET("/loginHistory", getLoginHistory)
+				authGroup.GET("/scoreLedger", getScoreLedger)
+				authGroup.GET("/twoFactor", getTwoFactorStatus)
+				authGroup.POST("/twoFactor/setup", setupTwoFactor)
+				authGroup.POST("/twoFactor/enable", enableTwoFactor)
+				authGroup.POST("/twoFactor/disable", disableTwoFactor)
+				authGroup.POST("/twoFactor/recoveryCodes", regenerateRecoveryCodes)
+				authGroup.GET("/tokenScopes", getAPITokenScopes)
+				authGroup.GET("/tokens", getAPITokens)
+				authGroup.POST("/createToken", createAPIToken)
+				authGroup.POST("/revokeToken", revokeAPIToken)
+				authGroup.GET("/tokenUsage", getAPITokenUsage)
+				userManage := requirePermission(service.PermUserManage)
+				authGroup.POST("/deleteUser", userManage, deleteUser)
+				authGroup.GET("/getAllUsers", userManage, getAllUsers)
+				authGroup.POST("/addUser", userManage, addUser)
+				authGroup.POST("/searchUsers", userManage, searchUsers)
+				authGroup.GET("/loginLocks", userManage, getLoginLocks)
+				authGroup.POST("/unlockLogin", userManage, unlockLogin)
+				authGroup.POST("/twoFactor/reset", userManage, resetTwoFactor)
+				authGroup.GET("/inviteCodes", userManage, getInviteCodes)
+				authGroup.POST("/createInviteCode", userManage, createInviteCode)
+				authGroup.POST("/deleteInviteCode", userManage, deleteInviteCode)
 			}
 		}
 
@@ -75,21 +101,83 @@ func RegisterRoutes(r *gin.Engine) {
 			vulGroup.POST("/createVulInstance", CreateVulInstance)
 			vulGroup.POST("/removeInstance", RemoveInstance)
 			vulGroup.GET("/extendExpireTime", ExtendExpireTime)
+			vulGroup.POST("/submitFlag", SubmitFlag)            // 提交实例flag
 			vulGroup.GET("/getCreatedVulEnv", GetCreatedVulEnv) // 获取所有创建的漏洞环境以及开启的场景
+			vulGroup.GET("/getTeamInstances", GetTeamInstances) // 获取所在团队的实例
 
-			adminGroup := vulGroup.Group("")
-			adminGroup.Use(isAdmin())
-			{
-				adminGroup.GET("/getAllInstance", GetAllInstance)
-				adminGroup.GET("/getVulImages", GetVulImages)
-				adminGroup.GET("/getImageLoadConfig", GetImageLoadConfig)
-				adminGroup.POST("/uploadImageFile", UploadImageFile)
-				adminGroup.GET("/pullImage", PullImage)
-				adminGroup.GET("/getVulEnv", GetVulEnv) // 获取镜像和compose信息
-				adminGroup.POST("/uploadVulZip", UploadVulZip)
-				adminGroup.GET("/createVulEnv", CreateVulEnv)
-				adminGroup.POST("/deleteVulEnv", DeleteVulEnv)
-			}
+			imageView := requirePermission(service.PermImageView, service.PermImageManage)
+			imageManage := requirePermission(service.PermImageManage)
+			vulGroup.GET("/getAllInstance", requirePermission(service.PermInstanceViewAll), GetAllInstance)
+			vulGroup.GET("/getVulImages", imageView, GetVulImages)
+			vulGroup.GET("/getImageLoadConfig", imageView, GetImageLoadConfig)
+			vulGroup.POST("/uploadImageFile", imageManage, UploadImageFile)
+			vulGroup.GET("/pullImage", imageManage, PullImage)
+			vulGroup.GET("/getVulEnv", imageView, GetVulEnv) // 获取镜像和compose信息
+			vulGroup.POST("/uploadVulZip", imageManage, UploadVulZip)
+			vulGroup.GET("/createVulEnv", imageManage, CreateVulEnv)
+			vulGroup.POST("/deleteVulEnv", imageManage, DeleteVulEnv)
+			vulGroup.POST("/reconcile", imageManage, ReconcileInstances) // 对账实例记录与Docker状态
+		}
+
+		// 团队路由，队长可以管理队员，团队管理员可以管理所有团队
+		teamGroup := v1.Group("/teams")
+		teamGroup.Use(authMiddleware())
+		{
+			teamManage := requirePermission(service.PermTeamManage)
+			teamGroup.GET("/myTeams", getMyTeams)
+			teamGroup.POST("/setMember", setTeamMember)
+			teamGroup.POST("/removeMember", removeTeamMember)
+			teamGroup.GET("/getAllTeams", teamManage, getAllTeams)
+			teamGroup.POST("/createTeam", teamManage, createTeam)
+			teamGroup.POST("/updateTeam", teamManage, updateTeam)
+			teamGroup.POST("/deleteTeam", teamManage, deleteTeam)
+		}
+
+		// 课程路由，学生查看已选课程的作业，课程管理员管理课程、作业并查看进度
+		courseGroup := v1.Group("/courses")
+		courseGroup.Use(authMiddleware())
+		{
+			courseManage := requirePermission(service.PermCourseManage)
+			courseGroup.GET("/getCourses", getCourses)
+			courseGroup.GET("/getAssignments", getAssignments)
+			courseGroup.POST("/createCourse", courseManage, createCourse)
+			courseGroup.POST("/updateCourse", courseManage, updateCourse)
+			courseGroup.POST("/deleteCourse", courseManage, deleteCourse)
+			courseGroup.GET("/getStudents", courseManage, getCourseStudents)
+			courseGroup.POST("/enrollStudents", courseManage, enrollStudents)
+			courseGroup.POST("/unenrollStudent", courseManage, unenrollStudent)
+			courseGroup.POST("/createAssignment", courseManage, createAssignment)
+			courseGroup.POST("/updateAssignment", courseManage, updateAssignment)
+			courseGroup.POST("/deleteAssignment", courseManage, deleteAssignment)
+			courseGroup.GET("/getProgress", courseManage, getAssignmentProgress)
+		}
+
+		// 排行榜路由，可按团队、课程和时间段筛选
+		scoreboardGroup := v1.Group("/scoreboard")
+		scoreboardGroup.Use(authMiddleware())
+		{
+			scoreboardGroup.GET("/rank", getScoreboard)
+			scoreboardGroup.GET("/series", getScoreSeries)
+			scoreboardGroup.GET("/solves", getSolveTimeline)
+		}
+
+		// 系统管理路由
+		systemGroup := v1.Group("/system")
+		systemGroup.Use(authMiddleware())
+		{
+			systemManage := requirePermission(service.PermSystemManage)
+			systemGroup.POST("/rotateJwtKey", systemManage, rotateJwtKey)
+			systemGroup.GET("/settings", systemManage, getSettings)
+			systemGroup.POST("/settings", systemManage, updateSettings)
+			systemGroup.GET("/settingAudits", systemManage, getSettingAudits)
+
+			// 身份与权限，用户管理员需要读取身份列表来分配身份
+			roleManage := requirePermission(service.PermRoleManage)
+			systemGroup.GET("/roles", requirePermission(service.PermUserManage, service.PermRoleManage), getRoles)
+			systemGroup.GET("/permissions", roleManage, getPermissions)
+			systemGroup.POST("/createRole", roleManage, createRole)
+			systemGroup.POST("/updateRole", roleManage, updateRole)
+			systemGroup.POST("/deleteRole", roleManage, deleteRole)
 		}
 	}
 }
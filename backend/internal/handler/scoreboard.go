@@ -0,0 +1,156 @@
+package handler
+
+import (
+	"AscensionPath/internal/service"
+	"AscensionPath/internal/utils"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// optionalQueryUint 读取可选的数字查询参数，未提供时返回0
+func optionalQueryUint(c *gin.Context, name string) (uint, bool) {
+	value := c.Query(name)
+	if value == "" {
+		return 0, true
+	}
+	n, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, utils.FailResult(utils.CodeBadRequest, "无效的"+name+"参数"))
+		return 0, false
+	}
+	return uint(n), true
+}
+
+// optionalQueryTime 读取可选的RFC3339时间查询参数，未提供时返回零值
+func optionalQueryTime(c *gin.Context, name string) (time.Time, bool) {
+	value := c.Query(name)
+	if value == "" {
+		return time.Time{}, true
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, utils.FailResult(utils.CodeBadRequest, "无效的"+name+"参数，应为RFC3339格式"))
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// scoreboardQuery 读取排行榜的筛选条件 team_id、course_id、from、to
+func scoreboardQuery(c *gin.Context) (service.ScoreboardQuery, bool) {
+	var q service.ScoreboardQuery
+	var ok bool
+	if q.TeamID, ok = optionalQueryUint(c, "team_id"); !ok {
+		return q, false
+	}
+	if q.CourseID, ok = optionalQueryUint(c, "course_id"); !ok {
+		return q, false
+	}
+	if q.From, ok = optionalQueryTime(c, "from"); !ok {
+		return q, false
+	}
+	if q.To, ok = optionalQueryTime(c, "to"); !ok {
+		return q, false
+	}
+	return q, true
+}
+
+// scoreboardError 按错误类型返回排行榜请求的失败响应
+func scoreboardError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidTimeRange):
+		c.JSON(http.StatusBadRequest, utils.FailResult(utils.CodeBadRequest, err.Error()))
+	case errors.Is(err, service.ErrNotEnrolled), errors.Is(err, service.ErrNotTeamMember):
+		c.JSON(http.StatusForbidden, utils.FailResult(http.StatusForbidden, err.Error()))
+	default:
+		c.JSON(http.StatusInternalServerError, utils.FailResult(utils.CodeInternalError, err.Error()))
+	}
+}
+
+// getScoreboard 获取排行榜，可选参数limit限制返回的名次数
+func getScoreboard(c *gin.Context) {
+	q, ok := scoreboardQuery(c)
+	if !ok {
+		return
+	}
+	limit, ok := optionalQueryUint(c, "limit")
+	if !ok {
+		return
+	}
+	userService, err := utils.GetDataFromContext(c, "UserInfo", &service.UserService{})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.FailResult(utils.CodeInternalError, err.Error()))
+		return
+	}
+	board, err := userService.GetScoreboard(q, int(limit))
+	if err != nil {
+		scoreboardError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, utils.SuccessResult(board))
+}
+
+// getScoreSeries 获取积分曲线，user_ids为逗号分隔的用户ID，未提供时返回前top名
+func getScoreSeries(c *gin.Context) {
+	q, ok := scoreboardQuery(c)
+	if !ok {
+		return
+	}
+	top, ok := optionalQueryUint(c, "top")
+	if !ok {
+		return
+	}
+	var userIDs []uint
+	if value := c.Query("user_ids"); value != "" {
+		for _, part := range strings.Split(value, ",") {
+			id, err := strconv.ParseUint(strings.TrimSpace(part), 10, 32)
+			if err != nil || id == 0 {
+				c.JSON(http.StatusBadRequest, utils.FailResult(utils.CodeBadRequest, "无效的user_ids参数"))
+				return
+			}
+			userIDs = append(userIDs, uint(id))
+		}
+	}
+	userService, err := utils.GetDataFromContext(c, "UserInfo", &service.UserService{})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.FailResult(utils.CodeInternalError, err.Error()))
+		return
+	}
+	series, err := userService.GetScoreSeries(q, userIDs, int(top))
+	if err != nil {
+		scoreboardError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, utils.SuccessResult(series))
+}
+
+// getSolveTimeline 获取最近的解出记录，可选参数user_id只看某个用户，limit限制条数
+func getSolveTimeline(c *gin.Context) {
+	q, ok := scoreboardQuery(c)
+	if !ok {
+		return
+	}
+	userID, ok := optionalQueryUint(c, "user_id")
+	if !ok {
+		return
+	}
+	limit, ok := optionalQueryUint(c, "limit")
+	if !ok {
+		return
+	}
+	userService, err := utils.GetDataFromContext(c, "UserInfo", &service.UserService{})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.FailResult(utils.CodeInternalError, err.Error()))
+		return
+	}
+	events, err := userService.GetSolveTimeline(q, userID, int(limit))
+	if err != nil {
+		scoreboardError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, utils.SuccessResult(events))
+}
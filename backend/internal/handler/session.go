@@ -0,0 +1,154 @@
+package handler
+
+import (
+	"AscensionPath/config"
+	"AscensionPath/internal/middleware"
+	"AscensionPath/internal/service"
+	"AscensionPath/internal/utils"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 刷新令牌cookie只在用户接口下发送
+const refreshCookiePath = "/api/v1/users"
+
+// setAuthCookies 写入访问令牌和刷新令牌cookie，同时更换CSRF令牌
+func setAuthCookies(c *gin.Context, token string, tokens *service.SessionTokens) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(
+		"auth_token", // cookie名称
+		token,        // token值
+		int(config.Current().Session.AccessTTL.Std().Seconds()), // 过期时间(秒)
+		"/",   // 路径
+		"",    // 域名
+		false, // 仅HTTPS
+		true,  // 仅HTTP访问
+	)
+	c.SetCookie("refresh_token", tokens.RefreshToken, int(time.Until(tokens.RefreshExpiresAt).Seconds()),
+		refreshCookiePath, "", false, true)
+	setCSRFCookie(c)
+}
+
+// clearAuthCookies 清除认证cookie
+func clearAuthCookies(c *gin.Context) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie("auth_token", "", -1, "/", "", false, true)
+	c.SetCookie("refresh_token", "", -1, refreshCookiePath, "", false, true)
+	c.SetCookie(csrfCookie, "", -1, "/", "", false, false)
+}
+
+// tokenResponse 登录和刷新接口返回的令牌信息
+func tokenResponse(token string, tokens *service.SessionTokens) gin.H {
+	return gin.H{
+		"token":              token,
+		"expires_in":         int(config.Current().Session.AccessTTL.Std().Seconds()),
+		"refresh_token":      tokens.RefreshToken,
+		"refresh_expires_at": tokens.RefreshExpiresAt,
+	}
+}
+
+// refreshToken 使用刷新令牌换取新的访问令牌和刷新令牌，刷新令牌可放在请求体或cookie中
+func refreshToken(c *gin.Context) {
+	var req utils.Message[struct {
+		RefreshToken string `json:"refresh_token"`
+	}]
+	// 请求体可以为空，此时从cookie读取
+	_ = c.ShouldBindJSON(&req)
+	refresh := req.Data.RefreshToken
+	if refresh == "" {
+		// 只用cookie刷新时同样需要CSRF令牌，防止其他网站替用户轮换令牌
+		if !csrfValid(c) {
+			c.JSON(http.StatusForbidden, utils.FailResult(http.StatusForbidden, "请求来源不允许或CSRF令牌无效"))
+			return
+		}
+		refresh, _ = c.Cookie("refresh_token")
+	}
+	if refresh == "" {
+		c.JSON(http.StatusUnauthorized, utils.FailResult(utils.CodeUnauthorized, "缺少刷新令牌"))
+		return
+	}
+
+	tokens, user, err := service.RefreshSession(refresh, c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		clearAuthCookies(c)
+		c.JSON(http.StatusUnauthorized, utils.FailResult(utils.CodeUnauthorized, err.Error()))
+		return
+	}
+	token, err := generateToken(user.ID, user.Username, user.Role, tokens.SessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.FailResult(utils.CodeInternalError, "生成token失败: "+err.Error()))
+		return
+	}
+	setAuthCookies(c, token, tokens)
+	c.JSON(http.StatusOK, utils.SuccessResult(tokenResponse(token, tokens)))
+}
+
+// logout 注销当前会话
+func logout(c *gin.Context) {
+	userService, err := utils.GetDataFromContext(c, "UserInfo", &service.UserService{})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.FailResult(utils.CodeInternalError, err.Error()))
+		return
+	}
+	if err := userService.Logout(); err != nil {
+		c.JSON(http.StatusInternalServerError, utils.FailResult(utils.CodeInternalError, err.Error()))
+		return
+	}
+	clearAuthCookies(c)
+	c.JSON(http.StatusOK, utils.SuccessResult("已退出登录"))
+}
+
+// logoutAll 注销当前用户在所有设备上的会话
+func logoutAll(c *gin.Context) {
+	userService, err := utils.GetDataFromContext(c, "UserInfo", &service.UserService{})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.FailResult(utils.CodeInternalError, err.Error()))
+		return
+	}
+	count, err := userService.LogoutAll()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.FailResult(utils.CodeInternalError, err.Error()))
+		middleware.SugarLogger.Errorf("用户: %s 注销所有会话失败: %s", userService.Username, err.Error())
+		return
+	}
+	clearAuthCookies(c)
+	c.JSON(http.StatusOK, utils.SuccessResult(gin.H{"revoked": count}))
+}
+
+// getSessions 获取当前用户的有效会话
+func getSessions(c *gin.Context) {
+	userService, err := utils.GetDataFromContext(c, "UserInfo", &service.UserService{})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.FailResult(utils.CodeInternalError, err.Error()))
+		return
+	}
+	sessions, err := userService.ListSessions()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.FailResult(utils.CodeInternalError, err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, utils.SuccessResult(sessions))
+}
+
+// revokeSession 注销当前用户的指定会话
+func revokeSession(c *gin.Context) {
+	var req utils.Message[struct {
+		ID uint `json:"id" binding:"required"`
+	}]
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, utils.FailResult(utils.CodeBadRequest, "无效的请求参数: "+err.Error()))
+		return
+	}
+	userService, err := utils.GetDataFromContext(c, "UserInfo", &service.UserService{})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.FailResult(utils.CodeInternalError, err.Error()))
+		return
+	}
+	if err := userService.RevokeSession(req.Data.ID); err != nil {
+		c.JSON(http.StatusNotFound, utils.FailResult(http.StatusNotFound, err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, utils.SuccessResult("会话已注销"))
+}
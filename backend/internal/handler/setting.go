@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"AscensionPath/internal/middleware"
+	"AscensionPath/internal/service"
+	"AscensionPath/internal/utils"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// getSettings 获取运行时配置
+func getSettings(c *gin.Context) {
+	settings, err := service.GetSettings()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.FailResult(utils.CodeInternalError, err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, utils.SuccessResult(settings))
+}
+
+// updateSettings 修改运行时配置，保存后立即生效
+func updateSettings(c *gin.Context) {
+	var req utils.Message[struct {
+		Values map[string]string `json:"values" binding:"required"` // 配置键 -> 新值
+	}]
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, utils.FailResult(utils.CodeBadRequest, "请求参数错误"))
+		return
+	}
+
+	userService, err := utils.GetDataFromContext(c, "UserInfo", &service.UserService{})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.FailResult(utils.CodeInternalError, err.Error()))
+		return
+	}
+
+	settings, err := userService.UpdateSettings(req.Data.Values)
+	if err != nil {
+		if errors.Is(err, utils.ErrInvalidSetting) {
+			c.JSON(http.StatusBadRequest, utils.FailResult(utils.CodeBadRequest, err.Error()))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, utils.FailResult(utils.CodeInternalError, err.Error()))
+		middleware.SugarLogger.Errorf("用户: %s 修改运行时配置失败: %s", userService.Username, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, utils.SuccessResult(settings))
+}
+
+// getSettingAudits 分页获取配置修改记录，可按配置键过滤
+func getSettingAudits(c *gin.Context) {
+	page, err := utils.StringToInt(c.DefaultQuery("page", "1"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, utils.FailResult(utils.CodeBadRequest, "无效的页码: "+err.Error()))
+		return
+	}
+	pageSize, err := utils.StringToInt(c.DefaultQuery("pageSize", "10"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, utils.FailResult(utils.CodeBadRequest, "无效的每页数量: "+err.Error()))
+		return
+	}
+
+	audits, count, err := service.GetSettingAudits(c.Query("key"), page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.FailResult(utils.CodeInternalError, err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, utils.SuccessResult(struct {
+		Audits []service.SettingAuditDTO `json:"audits"`
+		Count  int64                     `json:"count"`
+	}{Audits: audits, Count: count}))
+}
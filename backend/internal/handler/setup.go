@@ -0,0 +1,53 @@
+package handler
+
+import (
+	"AscensionPath/internal/service"
+	"AscensionPath/internal/utils"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// getSetupStatus 查询是否需要初始化管理员
+func getSetupStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, utils.SuccessResult(gin.H{
+		"required": service.SetupRequired(),
+	}))
+}
+
+// completeSetup 使用控制台打印的初始化令牌创建管理员
+func completeSetup(c *gin.Context) {
+	var reqMessage utils.Message[struct {
+		Token    string `json:"token" binding:"required"`
+		Username string `json:"username" binding:"required"`
+		Password string `json:"password" binding:"required"`
+		Email    string `json:"email" binding:"omitempty,email"`
+	}]
+	if err := c.ShouldBindJSON(&reqMessage); err != nil {
+		c.JSON(http.StatusBadRequest, utils.FailResult(utils.CodeBadRequest, "无效的请求参数: "+err.Error()))
+		return
+	}
+	req := reqMessage.Data
+
+	user, err := service.CompleteSetup(req.Token, req.Username, req.Password, req.Email)
+	if err != nil {
+		statusCode := http.StatusBadRequest
+		switch err {
+		case service.ErrSetupCompleted:
+			statusCode = http.StatusGone
+		case service.ErrInvalidSetupToken:
+			statusCode = http.StatusForbidden
+		case utils.ErrUserAlreadyExists:
+			statusCode = http.StatusConflict
+		}
+		c.JSON(statusCode, utils.FailResult(statusCode, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusCreated, utils.SuccessResult(gin.H{
+		"id":       user.ID,
+		"username": user.Username,
+		"email":    user.Email,
+		"role":     user.Role,
+	}))
+}
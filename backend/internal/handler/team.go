@@ -0,0 +1,155 @@
+package handler
+
+import (
+	"AscensionPath/internal/service"
+	"AscensionPath/internal/utils"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// getMyTeams 获取当前用户加入的团队
+func getMyTeams(c *gin.Context) {
+	userService, err := utils.GetDataFromContext(c, "UserInfo", &service.UserService{})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.FailResult(utils.CodeInternalError, err.Error()))
+		return
+	}
+	teams, err := userService.MyTeams()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.FailResult(utils.CodeInternalError, err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, utils.SuccessResult(teams))
+}
+
+// getAllTeams 获取所有团队及其成员
+func getAllTeams(c *gin.Context) {
+	userService, err := utils.GetDataFromContext(c, "UserInfo", &service.UserService{})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.FailResult(utils.CodeInternalError, err.Error()))
+		return
+	}
+	teams, err := userService.ListTeams()
+	if err != nil {
+		c.JSON(http.StatusForbidden, utils.FailResult(http.StatusForbidden, err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, utils.SuccessResult(teams))
+}
+
+// createTeam 创建团队
+func createTeam(c *gin.Context) {
+	var req utils.Message[struct {
+		Name        string `json:"name" binding:"required"`
+		Description string `json:"description"`
+	}]
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, utils.FailResult(utils.CodeBadRequest, "无效的请求参数: "+err.Error()))
+		return
+	}
+	userService, err := utils.GetDataFromContext(c, "UserInfo", &service.UserService{})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.FailResult(utils.CodeInternalError, err.Error()))
+		return
+	}
+	team, err := userService.CreateTeam(req.Data.Name, req.Data.Description)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, utils.FailResult(utils.CodeBadRequest, err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, utils.SuccessResult(team))
+}
+
+// updateTeam 修改团队名称和说明
+func updateTeam(c *gin.Context) {
+	var req utils.Message[struct {
+		ID          uint   `json:"id" binding:"required"`
+		Name        string `json:"name" binding:"required"`
+		Description string `json:"description"`
+	}]
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, utils.FailResult(utils.CodeBadRequest, "无效的请求参数: "+err.Error()))
+		return
+	}
+	userService, err := utils.GetDataFromContext(c, "UserInfo", &service.UserService{})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.FailResult(utils.CodeInternalError, err.Error()))
+		return
+	}
+	if err := userService.UpdateTeam(req.Data.ID, req.Data.Name, req.Data.Description); err != nil {
+		c.JSON(http.StatusBadRequest, utils.FailResult(utils.CodeBadRequest, err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, utils.SuccessResult("团队已更新"))
+}
+
+// deleteTeam 删除团队，团队还有实例时拒绝删除
+func deleteTeam(c *gin.Context) {
+	var req utils.Message[struct {
+		ID uint `json:"id" binding:"required"`
+	}]
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, utils.FailResult(utils.CodeBadRequest, "无效的请求参数: "+err.Error()))
+		return
+	}
+	userService, err := utils.GetDataFromContext(c, "UserInfo", &service.UserService{})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.FailResult(utils.CodeInternalError, err.Error()))
+		return
+	}
+	if err := userService.DeleteTeam(req.Data.ID); err != nil {
+		statusCode := http.StatusBadRequest
+		if err == service.ErrTeamHasInstances {
+			statusCode = http.StatusConflict
+		}
+		c.JSON(statusCode, utils.FailResult(statusCode, err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, utils.SuccessResult("团队已删除"))
+}
+
+// setTeamMember 添加团队成员或修改成员角色，团队管理员和队长可用
+func setTeamMember(c *gin.Context) {
+	var req utils.Message[struct {
+		TeamID   uint   `json:"team_id" binding:"required"`
+		Username string `json:"username" binding:"required"`
+		Role     string `json:"role"` // captain 或 member，默认为 member
+	}]
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, utils.FailResult(utils.CodeBadRequest, "无效的请求参数: "+err.Error()))
+		return
+	}
+	userService, err := utils.GetDataFromContext(c, "UserInfo", &service.UserService{})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.FailResult(utils.CodeInternalError, err.Error()))
+		return
+	}
+	if err := userService.SetTeamMember(req.Data.TeamID, req.Data.Username, req.Data.Role); err != nil {
+		c.JSON(http.StatusBadRequest, utils.FailResult(utils.CodeBadRequest, err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, utils.SuccessResult("团队成员已更新"))
+}
+
+// removeTeamMember 移除团队成员，成员可以移除自己以退出团队
+func removeTeamMember(c *gin.Context) {
+	var req utils.Message[struct {
+		TeamID uint `json:"team_id" binding:"required"`
+		UserID uint `json:"user_id" binding:"required"`
+	}]
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, utils.FailResult(utils.CodeBadRequest, "无效的请求参数: "+err.Error()))
+		return
+	}
+	userService, err := utils.GetDataFromContext(c, "UserInfo", &service.UserService{})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.FailResult(utils.CodeInternalError, err.Error()))
+		return
+	}
+	if err := userService.RemoveTeamMember(req.Data.TeamID, req.Data.UserID); err != nil {
+		c.JSON(http.StatusBadRequest, utils.FailResult(utils.CodeBadRequest, err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, utils.SuccessResult("已移除团队成员"))
+}
@@ -1,10 +1,14 @@
 package handler
 
 import (
+	"AscensionPath/config"
 	"AscensionPath/internal/model"
 	"AscensionPath/internal/service"
 	"AscensionPath/internal/utils"
+	"errors"
+	"math"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 )
@@ -15,6 +19,8 @@ func registerUser(c *gin.Context) {
 		Username string `json:"username" binding:"required"`
 		Password string `json:"password" binding:"required"`
 		Email    string `json:"email" binding:"required,email"`
+		// 注册方式为invite时必填，其他方式下可选，使用后获得邀请码预设的身份和积分
+		InviteCode string `json:"invite_code"`
 	}]
 
 	// 绑定并验证请求参数
@@ -28,11 +34,19 @@ func registerUser(c *gin.Context) {
 
 	// 调用service层注册方法
 	userService := &service.UserService{}
-	user, err := userService.Register(req.Username, req.Password, req.Email)
+	user, err := userService.Register(req.Username, req.Password, req.Email, req.InviteCode)
 	if err != nil {
 		statusCode := utils.CodeInternalError
-		if err == utils.ErrUserAlreadyExists {
+		switch err {
+		case utils.ErrUserAlreadyExists:
 			statusCode = http.StatusConflict
+		case service.ErrRegistrationClosed, service.ErrInviteRequired, service.ErrEmailDomainNotAllowed:
+			statusCode = http.StatusForbidden
+		case service.ErrInvalidInviteCode:
+			statusCode = http.StatusBadRequest
+		}
+		if errors.Is(err, utils.ErrWeakPassword) {
+			statusCode = http.StatusBadRequest
 		}
 
 		c.JSON(statusCode, utils.FailResult(statusCode, err.Error()))
@@ -45,6 +59,9 @@ func registerUser(c *gin.Context) {
 		"username": user.Username,
 		"email":    user.Email,
 		"role":     user.Role,
+		"status":   user.Status,
+		// 账号未启用时前端按激活方式提示等待审核或验证邮箱
+		"activation": config.Current().Registration.Activation,
 	}
 	c.JSON(http.StatusCreated, utils.SuccessResult(responseData))
 }
@@ -66,29 +83,74 @@ func loginUser(c *gin.Context) {
 
 	// 调用service层登录方法
 	userService := &service.UserService{}
-	user, err := userService.Login(req.Username, req.Password)
+	user, err := userService.Login(req.Username, req.Password, c.ClientIP(), c.Request.UserAgent())
+	if errors.Is(err, service.ErrTwoFactorRequired) {
+		// 密码正确但已启用两步验证，签发临时令牌，校验验证码后再创建会话
+		token, err := generateTwoFactorToken(user.ID, user.Username)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, utils.FailResult(utils.CodeInternalError, "生成token失败: "+err.Error()))
+			return
+		}
+		c.JSON(http.StatusOK, utils.SuccessResult(gin.H{
+			"two_factor_required": true,
+			"two_factor_token":    token,
+		}))
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, utils.FailResult(utils.CodeUnauthorized, "登录失败: "+err.Error()))
+		writeLoginError(c, err)
 		return
 	}
-	// 生成token或其他认证信息
-	token, err := generateToken(user.ID, user.Username, user.Role)
+	issueSession(c, user)
+}
+
+// loginTwoFactor 登录第二步：校验TOTP验证码或恢复码
+func loginTwoFactor(c *gin.Context) {
+	var req utils.Message[struct {
+		TwoFactorToken string `json:"two_factor_token" binding:"required"`
+		Code           string `json:"code" binding:"required"`
+	}]
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, utils.FailResult(utils.CodeBadRequest, "无效的请求参数: "+err.Error()))
+		return
+	}
+	userID, err := validateTwoFactorToken(req.Data.TwoFactorToken)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, utils.FailResult(utils.CodeInternalError, "生成token失败: "+err.Error()))
+		c.JSON(http.StatusUnauthorized, utils.FailResult(utils.CodeUnauthorized, err.Error()))
+		return
+	}
+	user, err := service.VerifyTwoFactorLogin(userID, req.Data.Code, c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		writeLoginError(c, err)
 		return
 	}
+	issueSession(c, user)
+}
 
-	// 设置cookie，有效期18小时
-	c.SetSameSite(http.SameSiteLaxMode)
-	c.SetCookie(
-		"auth_token", // cookie名称
-		token,        // token值
-		18*60*60,     // 过期时间(秒)
-		"/",          // 路径
-		"",           // 域名
-		false,        // 仅HTTPS
-		true,         // 仅HTTP访问
-	)
+// writeLoginError 登录失败响应，被限制时返回429和Retry-After
+func writeLoginError(c *gin.Context, err error) {
+	var throttled *service.LoginThrottledError
+	if errors.As(err, &throttled) {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+		c.JSON(http.StatusTooManyRequests, utils.FailResult(http.StatusTooManyRequests, err.Error()))
+		return
+	}
+	c.JSON(http.StatusUnauthorized, utils.FailResult(utils.CodeUnauthorized, "登录失败: "+err.Error()))
+}
+
+// issueSession 创建会话并签发访问令牌和刷新令牌，返回登录成功的用户信息
+func issueSession(c *gin.Context, user *model.User) {
+	tokens, err := service.CreateSession(user.ID, c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.FailResult(utils.CodeInternalError, err.Error()))
+		return
+	}
+	token, err := generateToken(user.ID, user.Username, user.Role, tokens.SessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.FailResult(utils.CodeInternalError, "生成token失败: "+err.Error()))
+		return
+	}
+	setAuthCookies(c, token, tokens)
 
 	// 返回登录成功的用户信息和token
 	responseData := gin.H{
@@ -98,6 +160,13 @@ func loginUser(c *gin.Context) {
 		"token":    token,
 		"email":    user.Email,
 		"status":   user.Status,
+
+		"permissions":               service.RolePermissions(user.Role),
+		"must_change_password":      user.MustChangePassword,
+		"two_factor_setup_required": service.TwoFactorSetupRequired(user.ID, user.Role),
+	}
+	for k, v := range tokenResponse(token, tokens) {
+		responseData[k] = v
 	}
 	c.JSON(http.StatusOK, utils.SuccessResult(responseData))
 }
@@ -134,7 +203,11 @@ func updateProfile(c *gin.Context) {
 	}
 
 	if err := userService.UpdateProfile(req.ID, req.Email, req.Status, req.Role, req.Score, req.Username, req.Password); err != nil {
-		c.JSON(http.StatusForbidden, utils.FailResult(http.StatusForbidden, err.Error()))
+		statusCode := http.StatusForbidden
+		if errors.Is(err, utils.ErrWeakPassword) {
+			statusCode = http.StatusBadRequest
+		}
+		c.JSON(statusCode, utils.FailResult(statusCode, err.Error()))
 		return
 	}
 
@@ -165,6 +238,8 @@ func changePassword(c *gin.Context) {
 		statusCode := http.StatusForbidden
 		if err == utils.ErrInvalidCredentials {
 			statusCode = http.StatusUnauthorized
+		} else if errors.Is(err, utils.ErrWeakPassword) {
+			statusCode = http.StatusBadRequest
 		}
 		c.JSON(statusCode, utils.FailResult(statusCode, err.Error()))
 		return
@@ -182,6 +257,8 @@ func addUser(c *gin.Context) {
 		Role     string  `json:"role" binding:"required"`
 		Status   int     `json:"status"`
 		Score    float64 `json:"score"`
+
+		MustChangePassword *bool `json:"must_change_password"` // 首次登录是否必须修改密码，默认是
 	}]
 	if err := c.ShouldBindJSON(&reqMessage); err != nil {
 		c.JSON(http.StatusBadRequest, utils.FailResult(utils.CodeBadRequest, "无效的请求参数: "+err.Error()))
@@ -200,9 +277,15 @@ func addUser(c *gin.Context) {
 		Role:     req.Role,
 		Status:   req.Status,
 		Score:    req.Score,
+
+		MustChangePassword: req.MustChangePassword == nil || *req.MustChangePassword,
 	}
 	if err := userService.AddUser(&user); err != nil {
-		c.JSON(http.StatusForbidden, utils.FailResult(http.StatusForbidden, err.Error()))
+		statusCode := http.StatusForbidden
+		if errors.Is(err, utils.ErrWeakPassword) {
+			statusCode = http.StatusBadRequest
+		}
+		c.JSON(statusCode, utils.FailResult(statusCode, err.Error()))
 		return
 	}
 	c.JSON(http.StatusOK, utils.SuccessResult[interface{}](nil))
@@ -316,6 +399,10 @@ func getUserByID(c *gin.Context) {
 		c.JSON(http.StatusNotFound, utils.FailResult(http.StatusNotFound, "用户不存在"))
 		return
 	}
+	// 前端按权限显示菜单，刷新自己的信息时一并返回
+	if user.ID == userService.ID {
+		user.Permissions = service.RolePermissions(user.Role)
+	}
 	c.JSON(http.StatusOK, utils.SuccessResult(user))
 }
 
@@ -355,3 +442,41 @@ func searchUsers(c *gin.Context) {
 		Count int64             `json:"count"` // 添加用户数量的返回
 	}{Users: users, Count: count}))
 }
+
+// getScoreLedger 获取积分流水，管理员可以通过id参数查看其他用户的流水
+func getScoreLedger(c *gin.Context) {
+	page, err := utils.StringToInt(c.DefaultQuery("page", "1"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, utils.FailResult(utils.CodeBadRequest, "无效的页码: "+err.Error()))
+		return
+	}
+	pageSize, err := utils.StringToInt(c.DefaultQuery("pageSize", "10"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, utils.FailResult(utils.CodeBadRequest, "无效的每页数量: "+err.Error()))
+		return
+	}
+	userService, err := utils.GetDataFromContext(c, "UserInfo", &service.UserService{})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.FailResult(utils.CodeInternalError, err.Error()))
+		return
+	}
+	userID := userService.ID
+	if id := c.Query("id"); id != "" {
+		n, err := utils.StringToInt(id)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, utils.FailResult(utils.CodeBadRequest, "无效的用户ID: "+err.Error()))
+			return
+		}
+		userID = uint(n)
+	}
+
+	entries, count, err := userService.GetScoreLedger(userID, page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusForbidden, utils.FailResult(http.StatusForbidden, err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, utils.SuccessResult(struct {
+		Entries []service.ScoreEntryDTO `json:"entries"`
+		Count   int64                   `json:"count"`
+	}{Entries: entries, Count: count}))
+}
@@ -1,10 +1,12 @@
 package handler
 
 import (
+	"AscensionPath/config"
 	"AscensionPath/internal/middleware"
 	"AscensionPath/internal/model"
 	"AscensionPath/internal/service"
 	"AscensionPath/internal/utils"
+	"errors"
 	"net/http"
 	"strconv"
 
@@ -191,7 +193,7 @@ func GetCreatedVulEnv(c *gin.Context) {
 	result := service.VulInstanceList{}
 	vul := service.VulService{}
 	// 获取所有创建的漏洞环境
-	vulEnvList, err := vul.GetVulEnvList(service.RoleMap[userService.Role])
+	vulEnvList, err := vul.GetVulEnvList(service.RoleLevel(userService.Role))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, utils.FailResult(utils.CodeBadRequest, err.Error()))
 		return
@@ -235,6 +237,7 @@ func CreateVulInstance(c *gin.Context) {
 	var req utils.Message[struct {
 		EnvName  string `json:"env_name"`
 		VulEnvID uint   `json:"vul_env_id"`
+		TeamID   uint   `json:"team_id"` // 不为0时创建团队实例
 	}]
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -249,7 +252,11 @@ func CreateVulInstance(c *gin.Context) {
 	}
 	middleware.SugarLogger.Infof("用户: %s 请求创建场景: %s", userService.Username, req.Data.EnvName)
 	vul := service.VulService{}
-	instance, err := vul.CreateVulInstance(userService.ID, req.Data.VulEnvID)
+	instance, err := vul.CreateVulInstance(userService.ID, req.Data.TeamID, req.Data.VulEnvID)
+	if errors.Is(err, service.ErrNotTeamMember) {
+		c.JSON(http.StatusForbidden, utils.FailResult(http.StatusForbidden, err.Error()))
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, utils.FailResult(utils.CodeInternalError, err.Error()))
 		middleware.SugarLogger.Errorf("用户: %s 创建场景 %s 失败: %s", userService.Username, req.Data.EnvName, err.Error())
@@ -263,6 +270,7 @@ func RemoveInstance(c *gin.Context) {
 	var req utils.Message[struct {
 		UserID   uint `json:"user_id"`
 		VulEnvID uint `json:"vul_env_id"`
+		TeamID   uint `json:"team_id"` // 不为0时停止团队实例，忽略user_id
 	}]
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -276,13 +284,22 @@ func RemoveInstance(c *gin.Context) {
 		return
 	}
 
-	if userService.Role != "admin" && req.Data.UserID != userService.ID {
-		c.JSON(http.StatusInternalServerError, utils.FailResult(utils.CodeInternalError, "无权删除该实例"))
-		return
-	}
-
 	vul := service.VulService{}
-	if err := vul.DeleteVulInstance(req.Data.UserID, req.Data.VulEnvID); err != nil {
+	if req.Data.TeamID != 0 {
+		// 团队实例由任意队员停止
+		if !userService.IsTeamMember(req.Data.TeamID) && !userService.Can(service.PermInstanceRemoveAll) {
+			c.JSON(http.StatusInternalServerError, utils.FailResult(utils.CodeInternalError, "无权删除该实例"))
+			return
+		}
+		err = vul.DeleteTeamVulInstance(req.Data.TeamID, req.Data.VulEnvID)
+	} else {
+		if req.Data.UserID != userService.ID && !userService.Can(service.PermInstanceRemoveAll) {
+			c.JSON(http.StatusInternalServerError, utils.FailResult(utils.CodeInternalError, "无权删除该实例"))
+			return
+		}
+		err = vul.DeleteVulInstance(req.Data.UserID, req.Data.VulEnvID)
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, utils.FailResult(utils.CodeInternalError, err.Error()))
 		middleware.SugarLogger.Errorf("用户: %s 停止实例失败: %s", userService.Username, err.Error())
 		return
@@ -292,6 +309,22 @@ func RemoveInstance(c *gin.Context) {
 	c.JSON(http.StatusOK, utils.SuccessResult("实例已停止并移除"))
 }
 
+// 获取用户所在团队的实例
+func GetTeamInstances(c *gin.Context) {
+	userService, err := utils.GetDataFromContext(c, "UserInfo", &service.UserService{})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.FailResult(utils.CodeInternalError, err.Error()))
+		return
+	}
+	vul := service.VulService{}
+	instances, err := vul.GetTeamInstancesByUserID(userService.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.FailResult(utils.CodeInternalError, err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, utils.SuccessResult(instances))
+}
+
 // 获取所有漏洞场景实例
 func GetAllInstance(c *gin.Context) {
 	userService, err := utils.GetDataFromContext(c, "UserInfo", &service.UserService{})
@@ -299,7 +332,7 @@ func GetAllInstance(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, utils.FailResult(utils.CodeInternalError, err.Error()))
 		return
 	}
-	if userService.Role != "admin" {
+	if !userService.Can(service.PermInstanceViewAll) {
 		c.JSON(http.StatusInternalServerError, utils.FailResult(utils.CodeInternalError, "未授权获取漏洞实例"))
 		return
 	}
@@ -342,8 +375,12 @@ func ExtendExpireTime(c *gin.Context) {
 		return
 	}
 
-	// 非管理员只能操作自己的实例
-	if userService.Role != "admin" && instance.UserID != userService.ID {
+	// 没有延长所有实例权限的用户只能操作自己的实例和所在团队的实例
+	owned := instance.UserID == userService.ID && instance.TeamID == 0
+	if instance.TeamID != 0 {
+		owned = userService.IsTeamMember(instance.TeamID)
+	}
+	if !owned && !userService.Can(service.PermInstanceExtendAll) {
 		c.JSON(http.StatusForbidden, utils.FailResult(utils.CodeInternalError, "无权操作该实例"))
 		return
 	}
@@ -351,6 +388,10 @@ func ExtendExpireTime(c *gin.Context) {
 	// 调用服务层方法延长过期时间
 	v := service.VulService{}
 	if err := v.ExtendExpireTime(uint(id)); err != nil {
+		if errors.Is(err, utils.ErrExtendLimitReached) {
+			c.JSON(http.StatusBadRequest, utils.FailResult(utils.CodeBadRequest, err.Error()))
+			return
+		}
 		c.JSON(http.StatusInternalServerError, utils.FailResult(utils.CodeInternalError, err.Error()))
 		middleware.SugarLogger.Errorf("用户: %s 延长实例ID: %d 过期时间失败: %s", userService.Username, id, err.Error())
 		return
@@ -359,3 +400,68 @@ func ExtendExpireTime(c *gin.Context) {
 	middleware.SugarLogger.Infof("用户: %s 成功延长实例ID: %d 过期时间", userService.Username, id)
 	c.JSON(http.StatusOK, utils.SuccessResult("实例过期时间已延长"))
 }
+
+// 对账实例记录与Docker状态
+func ReconcileInstances(c *gin.Context) {
+	var req utils.Message[struct {
+		OrphanPolicy string `json:"orphan_policy"`
+		DryRun       bool   `json:"dry_run"`
+	}]
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, utils.FailResult(utils.CodeBadRequest, "请求参数错误"))
+		return
+	}
+
+	userService, err := utils.GetDataFromContext(c, "UserInfo", &service.UserService{})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.FailResult(utils.CodeInternalError, err.Error()))
+		return
+	}
+
+	policy := req.Data.OrphanPolicy
+	if policy == "" {
+		policy = config.Current().Reconcile.OrphanPolicy
+	}
+
+	middleware.SugarLogger.Infof("用户: %s 请求对账实例状态, 策略: %s, 演练: %v", userService.Username, policy, req.Data.DryRun)
+	vul := service.VulService{}
+	report, err := vul.Reconcile(policy, req.Data.DryRun)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.FailResult(utils.CodeInternalError, err.Error()))
+		middleware.SugarLogger.Errorf("用户: %s 对账实例状态失败: %s", userService.Username, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, utils.SuccessResult(report))
+}
+
+// SubmitFlag 提交实例flag，正确时记录解出并奖励积分
+func SubmitFlag(c *gin.Context) {
+	var req utils.Message[struct {
+		Flag string `json:"flag" binding:"required"`
+	}]
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, utils.FailResult(utils.CodeBadRequest, "无效的请求参数: "+err.Error()))
+		return
+	}
+	userService, err := utils.GetDataFromContext(c, "UserInfo", &service.UserService{})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.FailResult(utils.CodeInternalError, err.Error()))
+		return
+	}
+	solve, err := userService.SubmitFlag(req.Data.Flag)
+	switch {
+	case err == nil:
+	case errors.Is(err, service.ErrWrongFlag):
+		c.JSON(http.StatusBadRequest, utils.FailResult(utils.CodeBadRequest, err.Error()))
+		return
+	case errors.Is(err, utils.ErrAlreadySolved), errors.Is(err, service.ErrTeamAlreadySolved):
+		c.JSON(http.StatusConflict, utils.FailResult(http.StatusConflict, err.Error()))
+		return
+	default:
+		middleware.SugarLogger.Errorf("用户: %s 提交flag失败: %s", userService.Username, err.Error())
+		c.JSON(http.StatusInternalServerError, utils.FailResult(utils.CodeInternalError, "提交flag失败"))
+		return
+	}
+	c.JSON(http.StatusOK, utils.SuccessResult(solve))
+}
@@ -0,0 +1,53 @@
+package mail
+
+import (
+	"AscensionPath/internal/middleware"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// logSender 把邮件内容写入日志，正文中可能有重置链接等敏感信息，只应在开发环境使用
+type logSender struct {
+	from string
+}
+
+func (s *logSender) Send(ctx context.Context, msg Message) error {
+	if _, err := build(s.from, msg); err != nil {
+		return err
+	}
+	middleware.SugarLogger.Infow("邮件(未发送)", "to", msg.To, "subject", msg.Subject, "body", msg.Body)
+	return nil
+}
+
+// fileSender 把邮件保存为.eml文件，可以用邮件客户端打开
+type fileSender struct {
+	from string
+	dir  string
+}
+
+func (s *fileSender) Send(ctx context.Context, msg Message) error {
+	data, err := build(s.from, msg)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.dir, 0o700); err != nil {
+		return fmt.Errorf("创建邮件目录失败: %v", err)
+	}
+	f, err := os.CreateTemp(s.dir, time.Now().Format("20060102-150405-")+"*.eml")
+	if err != nil {
+		return fmt.Errorf("保存邮件失败: %v", err)
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return fmt.Errorf("保存邮件失败: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("保存邮件失败: %v", err)
+	}
+	middleware.SugarLogger.Infow("邮件已保存", "to", msg.To, "subject", msg.Subject, "file", filepath.Base(f.Name()))
+	return nil
+}
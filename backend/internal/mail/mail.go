@@ -0,0 +1,79 @@
+// Package mail 发送系统邮件，通过配置选择发送方式，log和file方式不连接邮件服务器，便于开发和离线测试
+package mail
+
+import (
+	"AscensionPath/config"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+// Message 一封纯文本邮件
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Sender 邮件发送方式
+type Sender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// New 按配置创建发送方式
+func New(conf config.MailConfig) (Sender, error) {
+	switch conf.Driver {
+	case "log":
+		return &logSender{from: conf.From}, nil
+	case "file":
+		return &fileSender{from: conf.From, dir: conf.Dir}, nil
+	case "smtp":
+		return &smtpSender{conf: conf}, nil
+	default:
+		return nil, fmt.Errorf("不支持的邮件发送方式: %s", conf.Driver)
+	}
+}
+
+// build 生成RFC 5322格式的邮件，标题和正文使用UTF-8编码
+func build(from string, msg Message) ([]byte, error) {
+	if _, err := mail.ParseAddress(msg.To); err != nil {
+		return nil, fmt.Errorf("无效的收件人地址 %q: %v", msg.To, err)
+	}
+	if strings.ContainsAny(msg.To+msg.Subject, "\r\n") {
+		return nil, fmt.Errorf("邮件头不能包含换行")
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	domain := "localhost"
+	if addr, err := mail.ParseAddress(from); err == nil {
+		if i := strings.LastIndex(addr.Address, "@"); i >= 0 {
+			domain = addr.Address[i+1:]
+		}
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.BEncoding.Encode("UTF-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "Message-ID: <%s@%s>\r\n", hex.EncodeToString(id), domain)
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: base64\r\n\r\n")
+	encoded := base64.StdEncoding.EncodeToString([]byte(msg.Body))
+	for len(encoded) > 76 {
+		buf.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	buf.WriteString(encoded + "\r\n")
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,86 @@
+package mail
+
+import (
+	"AscensionPath/config"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+)
+
+// smtpSender 通过SMTP服务器发送邮件
+type smtpSender struct {
+	conf config.MailConfig
+}
+
+func (s *smtpSender) Send(ctx context.Context, msg Message) error {
+	data, err := build(s.conf.From, msg)
+	if err != nil {
+		return err
+	}
+	from, err := mail.ParseAddress(s.conf.From)
+	if err != nil {
+		return fmt.Errorf("无效的发件人地址: %v", err)
+	}
+	to, _ := mail.ParseAddress(msg.To)
+
+	timeout := s.conf.Timeout.Std()
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	addr := net.JoinHostPort(s.conf.SMTPHost, strconv.Itoa(s.conf.SMTPPort))
+	tlsConfig := &tls.Config{ServerName: s.conf.SMTPHost, MinVersion: tls.VersionTLS12}
+	dialer := &net.Dialer{Timeout: timeout}
+	var conn net.Conn
+	if s.conf.SMTPTLS == "tls" {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: tlsConfig}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("连接SMTP服务器失败: %v", err)
+	}
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+
+	client, err := smtp.NewClient(conn, s.conf.SMTPHost)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("连接SMTP服务器失败: %v", err)
+	}
+	defer client.Close()
+
+	if s.conf.SMTPTLS == "starttls" {
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("STARTTLS失败: %v", err)
+		}
+	}
+	if s.conf.SMTPUsername != "" {
+		// PlainAuth 拒绝在未加密的连接上发送密码(localhost除外)
+		auth := smtp.PlainAuth("", s.conf.SMTPUsername, s.conf.SMTPPassword, s.conf.SMTPHost)
+		if err := client.Auth(auth); err != nil {
+			return fmt.Errorf("SMTP认证失败: %v", err)
+		}
+	}
+	if err := client.Mail(from.Address); err != nil {
+		return fmt.Errorf("SMTP MAIL FROM失败: %v", err)
+	}
+	if err := client.Rcpt(to.Address); err != nil {
+		return fmt.Errorf("SMTP RCPT TO失败: %v", err)
+	}
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("SMTP DATA失败: %v", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		w.Close()
+		return fmt.Errorf("发送邮件失败: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("发送邮件失败: %v", err)
+	}
+	return client.Quit()
+}
@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"AscensionPath/config"
 	"net"
 	"net/http"
 	"net/http/httputil"
@@ -18,13 +19,24 @@ import (
 var SugarLogger *zap.SugaredLogger
 
 func init() {
+	// 使用默认配置初始化，保证加载配置前也能输出日志
+	InitLogger(config.Default().Log)
+}
+
+// InitLogger 根据配置初始化全局日志器
+func InitLogger(cfg config.LogConfig) {
+	level, err := zapcore.ParseLevel(cfg.Level)
+	if err != nil {
+		level = zapcore.InfoLevel
+	}
+
 	// 配置日志轮转
 	lumberjackLogger := &lumberjack.Logger{
-		Filename:   "./log/app.log",
-		MaxSize:    500,
-		MaxBackups: 10,
-		MaxAge:     90,
-		Compress:   true,
+		Filename:   cfg.File,
+		MaxSize:    cfg.MaxSize,
+		MaxBackups: cfg.MaxBackups,
+		MaxAge:     cfg.MaxAge,
+		Compress:   cfg.Compress,
 	}
 
 	// 确保文件写入使用UTF-8编码
@@ -66,8 +78,8 @@ func init() {
 
 	// 创建多输出核心
 	core := zapcore.NewTee(
-		zapcore.NewCore(consoleEncoder, zapcore.AddSync(os.Stdout), zapcore.InfoLevel),
-		zapcore.NewCore(fileEncoder, fileWriter, zapcore.InfoLevel),
+		zapcore.NewCore(consoleEncoder, zapcore.AddSync(os.Stdout), level),
+		zapcore.NewCore(fileEncoder, fileWriter, level),
 	)
 
 	logger := zap.New(core, zap.AddCaller())
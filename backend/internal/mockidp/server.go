@@ -0,0 +1,293 @@
+// Package mockidp 简易OpenID Connect IdP，支持授权码 + PKCE(S256)，用于单点登录的测试和本地联调。
+// 不校验密码，授权请求带 login_hint=<用户名> 时直接登录，否则列出预置用户供选择。不要在生产环境使用。
+package mockidp
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// KeyID 签名密钥的kid
+const KeyID = "mockidp-1"
+
+// User 预置用户，Groups写入groups claim
+type User struct {
+	Username string
+	Email    string
+	Groups   []string
+}
+
+// authCode 已签发未使用的授权码
+type authCode struct {
+	user        *User
+	clientID    string
+	redirectURI string
+	nonce       string
+	challenge   string
+	expiresAt   time.Time
+}
+
+// Server IdP，Issuer须与对外访问的地址一致
+type Server struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string // 为空时按公共客户端处理
+	Users        []User
+
+	// IDTokenHook 签发ID Token前调用，测试中用于构造过期、受众错误或nonce不符的令牌
+	IDTokenHook func(claims jwt.MapClaims)
+
+	key *rsa.PrivateKey
+
+	mu           sync.Mutex
+	codes        map[string]*authCode
+	accessTokens map[string]*User
+}
+
+// New 生成签名密钥并创建IdP
+func New(issuer, clientID, clientSecret string, users []User) (*Server, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, fmt.Errorf("生成签名密钥失败: %v", err)
+	}
+	return &Server{
+		Issuer:       strings.TrimSuffix(issuer, "/"),
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Users:        users,
+		key:          key,
+		codes:        make(map[string]*authCode),
+		accessTokens: make(map[string]*User),
+	}, nil
+}
+
+// Handler 返回IdP的各个端点
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", s.discovery)
+	mux.HandleFunc("/authorize", s.authorize)
+	mux.HandleFunc("/token", s.token)
+	mux.HandleFunc("/userinfo", s.userinfo)
+	mux.HandleFunc("/jwks", s.jwks)
+	return mux
+}
+
+func (s *Server) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                s.Issuer,
+		"authorization_endpoint":                s.Issuer + "/authorize",
+		"token_endpoint":                        s.Issuer + "/token",
+		"userinfo_endpoint":                     s.Issuer + "/userinfo",
+		"jwks_uri":                              s.Issuer + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"scopes_supported":                      []string{"openid", "profile", "email", "groups"},
+	})
+}
+
+var chooseUserPage = template.Must(template.New("choose").Parse(`<!doctype html>
+<html><head><meta charset="utf-8"><title>mock IdP</title></head><body>
+<h3>选择登录用户(mock IdP)</h3>
+<ul>{{range .}}<li><a href="{{.URL}}">{{.Username}}</a> {{.Email}} {{.Groups}}</li>{{end}}</ul>
+</body></html>`))
+
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	redirectURI := q.Get("redirect_uri")
+	if q.Get("client_id") != s.ClientID || redirectURI == "" {
+		http.Error(w, "client_id 或 redirect_uri 无效", http.StatusBadRequest)
+		return
+	}
+	if q.Get("response_type") != "code" || q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+		redirectWithParams(w, r, redirectURI, url.Values{
+			"error":             {"invalid_request"},
+			"error_description": {"需要 response_type=code 和 S256 PKCE"},
+			"state":             {q.Get("state")},
+		})
+		return
+	}
+
+	var user *User
+	for i := range s.Users {
+		if s.Users[i].Username == q.Get("login_hint") {
+			user = &s.Users[i]
+		}
+	}
+	if user == nil {
+		type choice struct {
+			Username, Email, URL string
+			Groups               []string
+		}
+		var choices []choice
+		for _, u := range s.Users {
+			params := r.URL.Query()
+			params.Set("login_hint", u.Username)
+			choices = append(choices, choice{u.Username, u.Email, "/authorize?" + params.Encode(), u.Groups})
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		chooseUserPage.Execute(w, choices)
+		return
+	}
+
+	code := randomString()
+	s.mu.Lock()
+	s.codes[code] = &authCode{
+		user:        user,
+		clientID:    q.Get("client_id"),
+		redirectURI: redirectURI,
+		nonce:       q.Get("nonce"),
+		challenge:   q.Get("code_challenge"),
+		expiresAt:   time.Now().Add(time.Minute),
+	}
+	s.mu.Unlock()
+	redirectWithParams(w, r, redirectURI, url.Values{"code": {code}, "state": {q.Get("state")}})
+}
+
+func (s *Server) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		tokenError(w, "invalid_request", err.Error())
+		return
+	}
+	clientID, secret, ok := r.BasicAuth()
+	if ok {
+		clientID, _ = url.QueryUnescape(clientID)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		clientID, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if clientID != s.ClientID || secret != s.ClientSecret {
+		tokenError(w, "invalid_client", "客户端认证失败")
+		return
+	}
+	if r.PostForm.Get("grant_type") != "authorization_code" {
+		tokenError(w, "unsupported_grant_type", "")
+		return
+	}
+
+	s.mu.Lock()
+	code := s.codes[r.PostForm.Get("code")]
+	delete(s.codes, r.PostForm.Get("code"))
+	s.mu.Unlock()
+	if code == nil || code.expiresAt.Before(time.Now()) || code.clientID != clientID ||
+		code.redirectURI != r.PostForm.Get("redirect_uri") {
+		tokenError(w, "invalid_grant", "授权码无效或已使用")
+		return
+	}
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(sum[:]) != code.challenge {
+		tokenError(w, "invalid_grant", "PKCE校验失败")
+		return
+	}
+
+	now := time.Now()
+	claims := s.userClaims(code.user)
+	claims["iss"] = s.Issuer
+	claims["aud"] = clientID
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(5 * time.Minute).Unix()
+	if code.nonce != "" {
+		claims["nonce"] = code.nonce
+	}
+	if s.IDTokenHook != nil {
+		s.IDTokenHook(claims)
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = KeyID
+	idToken, err := token.SignedString(s.key)
+	if err != nil {
+		tokenError(w, "server_error", err.Error())
+		return
+	}
+	accessToken := randomString()
+	s.mu.Lock()
+	s.accessTokens[accessToken] = code.user
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     idToken,
+	})
+}
+
+func (s *Server) userinfo(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	user := s.accessTokens[strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")]
+	s.mu.Unlock()
+	if user == nil {
+		http.Error(w, "invalid_token", http.StatusUnauthorized)
+		return
+	}
+	writeJSON(w, http.StatusOK, s.userClaims(user))
+}
+
+func (s *Server) jwks(w http.ResponseWriter, r *http.Request) {
+	pub := s.key.PublicKey
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"use": "sig",
+			"alg": "RS256",
+			"kid": KeyID,
+			"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}},
+	})
+}
+
+func (s *Server) userClaims(user *User) jwt.MapClaims {
+	return jwt.MapClaims{
+		"sub":                "mock-" + user.Username,
+		"preferred_username": user.Username,
+		"name":               user.Username,
+		"email":              user.Email,
+		"email_verified":     true,
+		"groups":             user.Groups,
+	}
+}
+
+func redirectWithParams(w http.ResponseWriter, r *http.Request, target string, params url.Values) {
+	sep := "?"
+	if strings.Contains(target, "?") {
+		sep = "&"
+	}
+	http.Redirect(w, r, target+sep+params.Encode(), http.StatusFound)
+}
+
+func tokenError(w http.ResponseWriter, code, description string) {
+	writeJSON(w, http.StatusBadRequest, map[string]string{"error": code, "error_description": description})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func randomString() string {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		panic(fmt.Sprintf("生成随机数失败: %v", err))
+	}
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
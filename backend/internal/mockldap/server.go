@@ -0,0 +1,374 @@
+// Package mockldap 内存中的简易LDAP服务器，支持简单绑定和搜索，用于LDAP登录的测试和本地联调。
+// 不支持TLS、修改操作和分页，不要在生产环境使用。
+package mockldap
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"sync"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+)
+
+// Entry 目录条目，userPassword属性保存明文密码，搜索结果中不会返回
+type Entry struct {
+	DN         string
+	Attributes map[string][]string
+}
+
+// User 预置用户，Groups为组的cn
+type User struct {
+	Username string
+	Password string
+	Email    string
+	Groups   []string
+}
+
+// Server 内存LDAP服务器
+type Server struct {
+	entries  []Entry
+	listener net.Listener
+	wg       sync.WaitGroup
+}
+
+// Directory 按常见的OpenLDAP结构生成条目：
+// 服务账号 cn=readonly,<base>，用户 uid=<用户名>,ou=people,<base>(带memberOf)，
+// 组 cn=<组名>,ou=groups,<base>(groupOfNames，带member)
+func Directory(base, bindPassword string, users []User) []Entry {
+	entries := []Entry{{
+		DN:         "cn=readonly," + base,
+		Attributes: map[string][]string{"objectClass": {"organizationalRole"}, "cn": {"readonly"}, "userPassword": {bindPassword}},
+	}}
+	groups := make(map[string][]string)
+	var groupOrder []string
+	for _, u := range users {
+		dn := "uid=" + u.Username + ",ou=people," + base
+		var memberOf []string
+		for _, g := range u.Groups {
+			if _, ok := groups[g]; !ok {
+				groupOrder = append(groupOrder, g)
+			}
+			groups[g] = append(groups[g], dn)
+			memberOf = append(memberOf, "cn="+g+",ou=groups,"+base)
+		}
+		entries = append(entries, Entry{DN: dn, Attributes: map[string][]string{
+			"objectClass":  {"inetOrgPerson"},
+			"uid":          {u.Username},
+			"cn":           {u.Username},
+			"mail":         {u.Email},
+			"userPassword": {u.Password},
+			"memberOf":     memberOf,
+		}})
+	}
+	for _, g := range groupOrder {
+		entries = append(entries, Entry{DN: "cn=" + g + ",ou=groups," + base, Attributes: map[string][]string{
+			"objectClass": {"groupOfNames"},
+			"cn":          {g},
+			"member":      groups[g],
+		}})
+	}
+	return entries
+}
+
+// Start 在addr上启动服务器，addr为 127.0.0.1:0 时随机选择端口
+func Start(addr string, entries []Entry) (*Server, error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{entries: entries, listener: l}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.serve()
+	}()
+	return s, nil
+}
+
+// Addr 实际监听的地址
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// URL ldap://地址
+func (s *Server) URL() string {
+	return "ldap://" + s.Addr()
+}
+
+// Close 停止监听并等待已有连接结束
+func (s *Server) Close() error {
+	err := s.listener.Close()
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) serve() {
+	var conns sync.WaitGroup
+	defer conns.Wait()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		conns.Add(1)
+		go func() {
+			defer conns.Done()
+			s.handle(conn)
+		}()
+	}
+}
+
+// handle 处理一个连接上的请求，直到客户端解绑或断开
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+		msgID, _ := packet.Children[0].Value.(int64)
+		op := packet.Children[1]
+		var responses []*ber.Packet
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			responses = []*ber.Packet{s.bind(op)}
+		case ldap.ApplicationSearchRequest:
+			responses = s.search(op)
+		case ldap.ApplicationUnbindRequest:
+			return
+		case ldap.ApplicationAbandonRequest:
+			continue
+		case ldap.ApplicationExtendedRequest:
+			responses = []*ber.Packet{result(ldap.ApplicationExtendedResponse, ldap.LDAPResultProtocolError, "不支持扩展操作")}
+		default:
+			responses = []*ber.Packet{result(op.Tag+1, ldap.LDAPResultUnwillingToPerform, "不支持该操作")}
+		}
+		for _, resp := range responses {
+			envelope := ber.NewSequence("LDAP Response")
+			envelope.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, msgID, "MessageID"))
+			envelope.AppendChild(resp)
+			if _, err := conn.Write(envelope.Bytes()); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// bind 简单绑定：DN和userPassword匹配时成功，DN和密码都为空时视为匿名绑定
+func (s *Server) bind(op *ber.Packet) *ber.Packet {
+	if len(op.Children) < 3 || op.Children[2].Tag != 0 {
+		return result(ldap.ApplicationBindResponse, ldap.LDAPResultAuthMethodNotSupported, "只支持简单绑定")
+	}
+	name, password := stringValue(op.Children[1]), stringValue(op.Children[2])
+	if name == "" && password == "" {
+		return result(ldap.ApplicationBindResponse, ldap.LDAPResultSuccess, "")
+	}
+	if entry := s.find(name); entry != nil && password != "" {
+		for _, p := range entry.Attributes["userPassword"] {
+			if p == password {
+				return result(ldap.ApplicationBindResponse, ldap.LDAPResultSuccess, "")
+			}
+		}
+	}
+	return result(ldap.ApplicationBindResponse, ldap.LDAPResultInvalidCredentials, "")
+}
+
+// search 按范围和过滤器返回条目，超过sizeLimit时返回sizeLimitExceeded
+func (s *Server) search(op *ber.Packet) []*ber.Packet {
+	if len(op.Children) < 8 {
+		return []*ber.Packet{result(ldap.ApplicationSearchResultDone, ldap.LDAPResultProtocolError, "无效的搜索请求")}
+	}
+	base, err := ldap.ParseDN(stringValue(op.Children[0]))
+	if err != nil {
+		return []*ber.Packet{result(ldap.ApplicationSearchResultDone, ldap.LDAPResultInvalidDNSyntax, err.Error())}
+	}
+	scope, _ := op.Children[1].Value.(int64)
+	sizeLimit, _ := op.Children[3].Value.(int64)
+	var attrs []string
+	for _, a := range op.Children[7].Children {
+		attrs = append(attrs, stringValue(a))
+	}
+
+	var responses []*ber.Packet
+	for i := range s.entries {
+		entry := &s.entries[i]
+		dn, err := ldap.ParseDN(entry.DN)
+		if err != nil || !inScope(base, dn, scope) {
+			continue
+		}
+		if ok, err := match(op.Children[6], entry); err != nil {
+			return []*ber.Packet{result(ldap.ApplicationSearchResultDone, ldap.LDAPResultProtocolError, err.Error())}
+		} else if !ok {
+			continue
+		}
+		if sizeLimit > 0 && int64(len(responses)) >= sizeLimit {
+			return append(responses, result(ldap.ApplicationSearchResultDone, ldap.LDAPResultSizeLimitExceeded, ""))
+		}
+		responses = append(responses, searchEntry(entry, attrs))
+	}
+	return append(responses, result(ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess, ""))
+}
+
+func (s *Server) find(dn string) *Entry {
+	target, err := ldap.ParseDN(dn)
+	if err != nil {
+		return nil
+	}
+	for i := range s.entries {
+		if d, err := ldap.ParseDN(s.entries[i].DN); err == nil && d.EqualFold(target) {
+			return &s.entries[i]
+		}
+	}
+	return nil
+}
+
+func inScope(base, dn *ldap.DN, scope int64) bool {
+	switch scope {
+	case ldap.ScopeBaseObject:
+		return base.EqualFold(dn)
+	case ldap.ScopeSingleLevel:
+		return len(dn.RDNs) == len(base.RDNs)+1 && base.AncestorOfFold(dn)
+	default:
+		return base.EqualFold(dn) || base.AncestorOfFold(dn)
+	}
+}
+
+// match 计算过滤器，支持 & | ! = =* 和子串匹配，比较时不区分大小写
+func match(filter *ber.Packet, entry *Entry) (bool, error) {
+	switch filter.Tag {
+	case ldap.FilterAnd:
+		for _, child := range filter.Children {
+			if ok, err := match(child, entry); err != nil || !ok {
+				return false, err
+			}
+		}
+		return true, nil
+	case ldap.FilterOr:
+		for _, child := range filter.Children {
+			if ok, err := match(child, entry); err != nil || ok {
+				return ok, err
+			}
+		}
+		return false, nil
+	case ldap.FilterNot:
+		if len(filter.Children) != 1 {
+			return false, errors.New("无效的过滤器")
+		}
+		ok, err := match(filter.Children[0], entry)
+		return !ok, err
+	case ldap.FilterEqualityMatch:
+		if len(filter.Children) != 2 {
+			return false, errors.New("无效的过滤器")
+		}
+		want := stringValue(filter.Children[1])
+		for _, v := range attribute(entry, stringValue(filter.Children[0])) {
+			if strings.EqualFold(v, want) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case ldap.FilterPresent:
+		return len(attribute(entry, stringValue(filter))) > 0, nil
+	case ldap.FilterSubstrings:
+		if len(filter.Children) != 2 {
+			return false, errors.New("无效的过滤器")
+		}
+		for _, v := range attribute(entry, stringValue(filter.Children[0])) {
+			if matchSubstrings(strings.ToLower(v), filter.Children[1].Children) {
+				return true, nil
+			}
+		}
+		return false, nil
+	default:
+		return false, errors.New("不支持的过滤器: " + ldap.FilterMap[uint64(filter.Tag)])
+	}
+}
+
+func matchSubstrings(value string, parts []*ber.Packet) bool {
+	for _, part := range parts {
+		sub := strings.ToLower(stringValue(part))
+		switch part.Tag {
+		case ldap.FilterSubstringsInitial:
+			if !strings.HasPrefix(value, sub) {
+				return false
+			}
+			value = value[len(sub):]
+		case ldap.FilterSubstringsAny:
+			i := strings.Index(value, sub)
+			if i < 0 {
+				return false
+			}
+			value = value[i+len(sub):]
+		case ldap.FilterSubstringsFinal:
+			if !strings.HasSuffix(value, sub) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// attribute 不区分大小写查找属性值
+func attribute(entry *Entry, name string) []string {
+	for k, v := range entry.Attributes {
+		if strings.EqualFold(k, name) {
+			return v
+		}
+	}
+	return nil
+}
+
+// searchEntry 生成SearchResultEntry，attrs为空或包含*时返回除userPassword外的所有属性
+func searchEntry(entry *Entry, attrs []string) *ber.Packet {
+	all := len(attrs) == 0
+	for _, a := range attrs {
+		all = all || a == "*"
+	}
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "Search Result Entry")
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, entry.DN, "DN"))
+	list := ber.NewSequence("Attributes")
+	for name, values := range entry.Attributes {
+		if strings.EqualFold(name, "userPassword") || len(values) == 0 {
+			continue
+		}
+		wanted := all
+		for _, a := range attrs {
+			wanted = wanted || strings.EqualFold(a, name)
+		}
+		if !wanted {
+			continue
+		}
+		attr := ber.NewSequence("Attribute")
+		attr.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "Type"))
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "Values")
+		for _, v := range values {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, v, "Value"))
+		}
+		attr.AppendChild(set)
+		list.AppendChild(attr)
+	}
+	op.AppendChild(list)
+	return op
+}
+
+// result 生成LDAPResult结构的响应
+func result(tag ber.Tag, code uint16, message string) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, ldap.ApplicationMap[uint8(tag)])
+	op.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code), "Result Code"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Matched DN"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, message, "Diagnostic Message"))
+	return op
+}
+
+// stringValue 通用类型的字符串解码在Value中，上下文类型(如简单绑定的密码)在Data中
+func stringValue(p *ber.Packet) string {
+	if s, ok := p.Value.(string); ok {
+		return s
+	}
+	if p.Data != nil {
+		return p.Data.String()
+	}
+	return ""
+}
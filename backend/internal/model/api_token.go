@@ -0,0 +1,110 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// APIToken 个人访问令牌，只保存令牌哈希，Scopes为逗号分隔的权限范围
+type APIToken struct {
+	ID         uint      `gorm:"primaryKey;autoIncrement"`
+	UserID     uint      `gorm:"not null;index"`
+	Name       string    `gorm:"type:varchar(64);not null"`
+	Prefix     string    `gorm:"type:varchar(16);not null"`             // 令牌前几位，便于用户辨认
+	TokenHash  string    `gorm:"type:varchar(64);uniqueIndex;not null"` // 令牌的SHA-256
+	Scopes     string    `gorm:"type:varchar(255);not null"`
+	ExpiresAt  time.Time `gorm:"index"`
+	LastUsedAt *time.Time
+	LastUsedIP string     `gorm:"type:varchar(64)"`
+	CreatedBy  uint       `gorm:"not null"` // 创建者，管理员可为其他用户创建
+	CreatedAt  time.Time  `gorm:"autoCreateTime"`
+	RevokedAt  *time.Time `gorm:"index"`
+}
+
+// Active 令牌是否未撤销且未过期
+func (t *APIToken) Active() bool {
+	return t.RevokedAt == nil && t.ExpiresAt.After(time.Now())
+}
+
+// APITokenUsage 个人访问令牌的调用记录
+type APITokenUsage struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement"`
+	TokenID   uint      `gorm:"not null;index"`
+	Method    string    `gorm:"type:varchar(10)"`
+	Path      string    `gorm:"type:varchar(255)"`
+	IP        string    `gorm:"type:varchar(64)"`
+	Status    int       `gorm:"not null"`
+	CreatedAt time.Time `gorm:"autoCreateTime;index"`
+}
+
+// CreateAPIToken 创建个人访问令牌
+func CreateAPIToken(token *APIToken) error {
+	return DB.Create(token).Error
+}
+
+// GetAPITokenByHash 根据令牌哈希查询令牌
+func GetAPITokenByHash(hash string) (*APIToken, error) {
+	var token APIToken
+	if err := DB.Where("token_hash = ?", hash).First(&token).Error; err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// GetAPITokenByID 根据ID查询令牌
+func GetAPITokenByID(id uint) (*APIToken, error) {
+	var token APIToken
+	if err := DB.Where("id = ?", id).First(&token).Error; err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// GetAPITokensByUserID 查询用户的所有令牌，最新创建的在前
+func GetAPITokensByUserID(userID uint) ([]APIToken, error) {
+	var tokens []APIToken
+	err := DB.Where("user_id = ?", userID).Order("id DESC").Find(&tokens).Error
+	return tokens, err
+}
+
+// RevokeAPIToken 撤销令牌，已撤销时返回false
+func RevokeAPIToken(id uint) (bool, error) {
+	result := DB.Model(&APIToken{}).Where("id = ? AND revoked_at IS NULL", id).Update("revoked_at", time.Now())
+	return result.RowsAffected == 1, result.Error
+}
+
+// RevokeUserAPITokens 撤销用户的所有令牌
+func RevokeUserAPITokens(userID uint) (int64, error) {
+	result := DB.Model(&APIToken{}).Where("user_id = ? AND revoked_at IS NULL", userID).Update("revoked_at", time.Now())
+	return result.RowsAffected, result.Error
+}
+
+// RecordAPITokenUsage 保存调用记录并更新令牌最后使用时间
+func RecordAPITokenUsage(usage *APITokenUsage) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(usage).Error; err != nil {
+			return err
+		}
+		return tx.Model(&APIToken{}).Where("id = ?", usage.TokenID).
+			Updates(map[string]interface{}{"last_used_at": usage.CreatedAt, "last_used_ip": usage.IP}).Error
+	})
+}
+
+// GetAPITokenUsages 分页查询令牌调用记录，最新的在前
+func GetAPITokenUsages(tokenID uint, page, pageSize int) ([]APITokenUsage, int64, error) {
+	var count int64
+	if err := DB.Model(&APITokenUsage{}).Where("token_id = ?", tokenID).Count(&count).Error; err != nil {
+		return nil, 0, err
+	}
+	var usages []APITokenUsage
+	err := DB.Where("token_id = ?", tokenID).Scopes(Paginate(page, pageSize)).
+		Order("id DESC").Find(&usages).Error
+	return usages, count, err
+}
+
+// DeleteAPITokenUsagesBefore 删除指定时间之前的调用记录
+func DeleteAPITokenUsagesBefore(t time.Time) (int64, error) {
+	result := DB.Where("created_at < ?", t).Delete(&APITokenUsage{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,63 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAPITokens(t *testing.T) {
+	forEachDB(t, func(t *testing.T) {
+		token := &APIToken{
+			UserID:    1,
+			Name:      "ci",
+			Prefix:    "ap_abcd",
+			TokenHash: "hash1",
+			Scopes:    "vul:read,instance:write",
+			ExpiresAt: time.Now().Add(time.Hour),
+			CreatedBy: 1,
+		}
+		if err := CreateAPIToken(token); err != nil {
+			t.Fatalf("CreateAPIToken: %v", err)
+		}
+		if err := CreateAPIToken(&APIToken{UserID: 2, Name: "dup", Prefix: "ap_x", TokenHash: "hash1", Scopes: "vul:read", CreatedBy: 2}); err == nil {
+			t.Error("令牌哈希应唯一")
+		}
+
+		got, err := GetAPITokenByHash("hash1")
+		if err != nil || got.ID != token.ID || !got.Active() || got.LastUsedAt != nil {
+			t.Fatalf("GetAPITokenByHash = %+v, %v", got, err)
+		}
+
+		usage := &APITokenUsage{TokenID: token.ID, Method: "GET", Path: "/api/v1/vul/getVulEnv", IP: "10.0.0.1", Status: 200, CreatedAt: time.Now()}
+		if err := RecordAPITokenUsage(usage); err != nil {
+			t.Fatalf("RecordAPITokenUsage: %v", err)
+		}
+		if err := RecordAPITokenUsage(&APITokenUsage{TokenID: token.ID, Method: "POST", Path: "/api/v1/vul/createVulInstance", IP: "10.0.0.2", Status: 403, CreatedAt: time.Now()}); err != nil {
+			t.Fatalf("RecordAPITokenUsage: %v", err)
+		}
+		if got, _ := GetAPITokenByID(token.ID); got.LastUsedAt == nil || got.LastUsedIP != "10.0.0.2" {
+			t.Errorf("最后使用信息未更新: %+v", got)
+		}
+		usages, total, err := GetAPITokenUsages(token.ID, 1, 1)
+		if err != nil || total != 2 || len(usages) != 1 || usages[0].Status != 403 {
+			t.Errorf("GetAPITokenUsages = %+v, %d, %v", usages, total, err)
+		}
+
+		if tokens, err := GetAPITokensByUserID(1); err != nil || len(tokens) != 1 {
+			t.Errorf("GetAPITokensByUserID = %+v, %v", tokens, err)
+		}
+		if revoked, err := RevokeAPIToken(token.ID); err != nil || !revoked {
+			t.Errorf("RevokeAPIToken = %v, %v", revoked, err)
+		}
+		if revoked, _ := RevokeAPIToken(token.ID); revoked {
+			t.Error("重复撤销应返回false")
+		}
+		if got, _ := GetAPITokenByID(token.ID); got.Active() {
+			t.Error("撤销后令牌仍然有效")
+		}
+
+		if deleted, err := DeleteAPITokenUsagesBefore(time.Now().Add(time.Minute)); err != nil || deleted != 2 {
+			t.Errorf("DeleteAPITokenUsagesBefore = %d, %v", deleted, err)
+		}
+	})
+}
@@ -0,0 +1,329 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Course 课程，学生选课后可以看到课程的作业
+type Course struct {
+	ID           uint      `gorm:"primaryKey;autoIncrement"`
+	Name         string    `gorm:"type:varchar(100);uniqueIndex;not null"`
+	Description  string    `gorm:"type:varchar(255)"`
+	InstructorID uint      `gorm:"not null;index"`
+	CreatedAt    time.Time `gorm:"autoCreateTime"`
+	UpdatedAt    time.Time `gorm:"autoUpdateTime"`
+}
+
+// CourseStudent 选课记录
+type CourseStudent struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement"`
+	CourseID  uint      `gorm:"not null;uniqueIndex:idx_course_students_course_user"`
+	UserID    uint      `gorm:"not null;uniqueIndex:idx_course_students_course_user;index"`
+	User      User      `gorm:"foreignKey:UserID"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+}
+
+// Assignment 作业，包含一组漏洞环境和开放、截止时间
+type Assignment struct {
+	ID          uint            `gorm:"primaryKey;autoIncrement"`
+	CourseID    uint            `gorm:"not null;index"`
+	Title       string          `gorm:"type:varchar(100);not null"`
+	Description string          `gorm:"type:text"`
+	OpenAt      time.Time       `gorm:"not null;index"`
+	DueAt       time.Time       `gorm:"not null;index"`
+	Lifetime    int             `gorm:"not null;default:0;comment:实例有效期(分钟)，0使用默认有效期"`
+	Envs        []AssignmentEnv `gorm:"foreignKey:AssignmentID"`
+	CreatedAt   time.Time       `gorm:"autoCreateTime"`
+	UpdatedAt   time.Time       `gorm:"autoUpdateTime"`
+}
+
+// AssignmentEnv 作业包含的漏洞环境
+type AssignmentEnv struct {
+	AssignmentID uint `gorm:"primaryKey;autoIncrement:false"`
+	VulEnvID     uint `gorm:"primaryKey;autoIncrement:false;index"`
+}
+
+// AssignmentProgress 学生在作业中每个漏洞环境的进度，没有记录表示未开始
+type AssignmentProgress struct {
+	ID           uint `gorm:"primaryKey;autoIncrement"`
+	AssignmentID uint `gorm:"not null;uniqueIndex:idx_assignment_progress"`
+	UserID       uint `gorm:"not null;uniqueIndex:idx_assignment_progress;index"`
+	VulEnvID     uint `gorm:"not null;uniqueIndex:idx_assignment_progress"`
+	LaunchedAt   *time.Time
+	SolvedAt     *time.Time
+}
+
+// CreateCourse 创建课程
+func CreateCourse(course *Course) error {
+	return DB.Create(course).Error
+}
+
+// GetCourse 通过ID获取课程
+func GetCourse(id uint) (*Course, error) {
+	var course Course
+	if err := DB.First(&course, id).Error; err != nil {
+		return nil, err
+	}
+	return &course, nil
+}
+
+// GetCourseByName 通过名称获取课程
+func GetCourseByName(name string) (*Course, error) {
+	var course Course
+	if err := DB.Where("name = ?", name).First(&course).Error; err != nil {
+		return nil, err
+	}
+	return &course, nil
+}
+
+// GetCourses 按ID获取所有课程
+func GetCourses() ([]Course, error) {
+	var courses []Course
+	err := DB.Order("id").Find(&courses).Error
+	return courses, err
+}
+
+// GetCoursesByStudentID 获取学生选修的课程
+func GetCoursesByStudentID(userID uint) ([]Course, error) {
+	var courses []Course
+	err := DB.Where("id IN (?)", DB.Model(&CourseStudent{}).Select("course_id").Where("user_id = ?", userID)).
+		Order("id").Find(&courses).Error
+	return courses, err
+}
+
+// UpdateCourse 修改课程名称和说明
+func UpdateCourse(id uint, name, description string) error {
+	result := DB.Model(&Course{}).Where("id = ?", id).
+		Updates(map[string]interface{}{"name": name, "description": description})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// DeleteCourse 删除课程及其选课记录、作业和进度
+func DeleteCourse(id uint) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		assignments := tx.Model(&Assignment{}).Select("id").Where("course_id = ?", id)
+		if err := tx.Where("assignment_id IN (?)", assignments).Delete(&AssignmentProgress{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("assignment_id IN (?)", assignments).Delete(&AssignmentEnv{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("course_id = ?", id).Delete(&Assignment{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("course_id = ?", id).Delete(&CourseStudent{}).Error; err != nil {
+			return err
+		}
+		result := tx.Delete(&Course{}, id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+}
+
+// GetCourseStudents 获取课程的学生及其用户信息
+func GetCourseStudents(courseID uint) ([]CourseStudent, error) {
+	var students []CourseStudent
+	err := DB.Preload("User").Where("course_id = ?", courseID).Order("id").Find(&students).Error
+	return students, err
+}
+
+// IsCourseStudent 用户是否选修了课程
+func IsCourseStudent(courseID, userID uint) bool {
+	var count int64
+	DB.Model(&CourseStudent{}).Where("course_id = ? AND user_id = ?", courseID, userID).Count(&count)
+	return count > 0
+}
+
+// EnrollStudent 学生选课，已选修时忽略
+func EnrollStudent(courseID, userID uint) error {
+	if IsCourseStudent(courseID, userID) {
+		return nil
+	}
+	return DB.Create(&CourseStudent{CourseID: courseID, UserID: userID}).Error
+}
+
+// UnenrollStudent 退课，学生的作业进度保留
+func UnenrollStudent(courseID, userID uint) error {
+	result := DB.Where("course_id = ? AND user_id = ?", courseID, userID).Delete(&CourseStudent{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// DeleteCourseStudentsByUserID 删除用户的选课记录和作业进度，用户被删除时调用
+func DeleteCourseStudentsByUserID(userID uint) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&AssignmentProgress{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&CourseStudent{}).Error
+	})
+}
+
+// CreateAssignment 创建作业及其漏洞环境
+func CreateAssignment(assignment *Assignment) error {
+	return DB.Create(assignment).Error
+}
+
+// GetAssignment 通过ID获取作业及其漏洞环境
+func GetAssignment(id uint) (*Assignment, error) {
+	var assignment Assignment
+	if err := DB.Preload("Envs").First(&assignment, id).Error; err != nil {
+		return nil, err
+	}
+	return &assignment, nil
+}
+
+// GetAssignmentsByCourseID 按开放时间获取课程的作业及其漏洞环境
+func GetAssignmentsByCourseID(courseID uint) ([]Assignment, error) {
+	var assignments []Assignment
+	err := DB.Preload("Envs").Where("course_id = ?", courseID).Order("open_at, id").Find(&assignments).Error
+	return assignments, err
+}
+
+// UpdateAssignment 修改作业，替换作业的漏洞环境，已有的进度保留
+func UpdateAssignment(assignment *Assignment) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&Assignment{}).Where("id = ?", assignment.ID).Updates(map[string]interface{}{
+			"title":       assignment.Title,
+			"description": assignment.Description,
+			"open_at":     assignment.OpenAt,
+			"due_at":      assignment.DueAt,
+			"lifetime":    assignment.Lifetime,
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		if err := tx.Where("assignment_id = ?", assignment.ID).Delete(&AssignmentEnv{}).Error; err != nil {
+			return err
+		}
+		for i := range assignment.Envs {
+			assignment.Envs[i].AssignmentID = assignment.ID
+		}
+		if len(assignment.Envs) == 0 {
+			return nil
+		}
+		return tx.Create(&assignment.Envs).Error
+	})
+}
+
+// DeleteAssignment 删除作业及其漏洞环境和进度
+func DeleteAssignment(id uint) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("assignment_id = ?", id).Delete(&AssignmentProgress{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("assignment_id = ?", id).Delete(&AssignmentEnv{}).Error; err != nil {
+			return err
+		}
+		result := tx.Delete(&Assignment{}, id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+}
+
+// DeleteAssignmentEnvsByVulEnvID 漏洞环境被删除时从所有作业中移除
+func DeleteAssignmentEnvsByVulEnvID(vulEnvID uint) error {
+	return DB.Where("vul_env_id = ?", vulEnvID).Delete(&AssignmentEnv{}).Error
+}
+
+// studentAssignments 学生已选课程中包含该漏洞环境、且在at时已开放的作业
+func studentAssignments(userID, vulEnvID uint, at time.Time) *gorm.DB {
+	return DB.Model(&Assignment{}).
+		Where("course_id IN (?)", DB.Model(&CourseStudent{}).Select("course_id").Where("user_id = ?", userID)).
+		Where("id IN (?)", DB.Model(&AssignmentEnv{}).Select("assignment_id").Where("vul_env_id = ?", vulEnvID)).
+		Where("open_at <= ?", at)
+}
+
+// GetAssignmentLifetime 学生在at时开启漏洞环境的实例有效期(分钟)，取开放中作业的最大值，没有时返回0
+func GetAssignmentLifetime(userID, vulEnvID uint, at time.Time) (int, error) {
+	var lifetime int
+	err := studentAssignments(userID, vulEnvID, at).Where("due_at >= ?", at).
+		Select("COALESCE(MAX(lifetime), 0)").Scan(&lifetime).Error
+	return lifetime, err
+}
+
+// RecordAssignmentLaunch 记录学生首次开启作业中的漏洞环境，截止后开启同样记录
+func RecordAssignmentLaunch(userID, vulEnvID uint, at time.Time) error {
+	var ids []uint
+	if err := studentAssignments(userID, vulEnvID, at).Pluck("id", &ids).Error; err != nil {
+		return err
+	}
+	for _, id := range ids {
+		progress := AssignmentProgress{AssignmentID: id, UserID: userID, VulEnvID: vulEnvID}
+		if err := DB.Where(&progress).FirstOrCreate(&progress).Error; err != nil {
+			return err
+		}
+		if progress.LaunchedAt != nil {
+			continue
+		}
+		if err := DB.Model(&progress).Update("launched_at", at).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RecordAssignmentSolve 记录学生首次解出作业中的漏洞环境，截止后解出同样记录
+func RecordAssignmentSolve(userID, vulEnvID uint, at time.Time) error {
+	var ids []uint
+	if err := studentAssignments(userID, vulEnvID, at).Pluck("id", &ids).Error; err != nil {
+		return err
+	}
+	for _, id := range ids {
+		progress := AssignmentProgress{AssignmentID: id, UserID: userID, VulEnvID: vulEnvID}
+		if err := DB.Where(&progress).FirstOrCreate(&progress).Error; err != nil {
+			return err
+		}
+		if progress.SolvedAt != nil {
+			continue
+		}
+		updates := map[string]interface{}{"solved_at": at}
+		if progress.LaunchedAt == nil {
+			updates["launched_at"] = at
+		}
+		if err := DB.Model(&progress).Updates(updates).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetAssignmentProgress 获取作业的所有进度记录
+func GetAssignmentProgress(assignmentID uint) ([]AssignmentProgress, error) {
+	var progress []AssignmentProgress
+	err := DB.Where("assignment_id = ?", assignmentID).Find(&progress).Error
+	return progress, err
+}
+
+// GetUserAssignmentProgress 获取学生在作业中的进度记录
+func GetUserAssignmentProgress(assignmentID, userID uint) ([]AssignmentProgress, error) {
+	var progress []AssignmentProgress
+	err := DB.Where("assignment_id = ? AND user_id = ?", assignmentID, userID).Find(&progress).Error
+	return progress, err
+}
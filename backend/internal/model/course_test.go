@@ -0,0 +1,104 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCourses(t *testing.T) {
+	forEachDB(t, func(t *testing.T) {
+		teacher := createTestUser(t, "teacher", 1, "instructor")
+		alice := createTestUser(t, "alice", 1, "user")
+		bob := createTestUser(t, "bob", 1, "user")
+
+		course := &Course{Name: "Web安全", InstructorID: teacher.ID}
+		if err := CreateCourse(course); err != nil {
+			t.Fatalf("CreateCourse: %v", err)
+		}
+		if err := CreateCourse(&Course{Name: "Web安全"}); err == nil {
+			t.Error("重复的课程名称应创建失败")
+		}
+		EnrollStudent(course.ID, alice.ID)
+		if err := EnrollStudent(course.ID, alice.ID); err != nil {
+			t.Errorf("重复选课应被忽略: %v", err)
+		}
+		EnrollStudent(course.ID, bob.ID)
+		if students, err := GetCourseStudents(course.ID); err != nil || len(students) != 2 || students[0].User.Username != "alice" {
+			t.Errorf("GetCourseStudents = %+v, %v", students, err)
+		}
+		if courses, err := GetCoursesByStudentID(alice.ID); err != nil || len(courses) != 1 {
+			t.Errorf("GetCoursesByStudentID = %+v, %v", courses, err)
+		}
+
+		env := createTestVulEnv(t, "sqli", 1000)
+		other := createTestVulEnv(t, "xss", 1000)
+		now := time.Now()
+		assignment := &Assignment{
+			CourseID: course.ID, Title: "第一周", OpenAt: now.Add(-time.Hour), DueAt: now.Add(time.Hour), Lifetime: 90,
+			Envs: []AssignmentEnv{{VulEnvID: env.ID}, {VulEnvID: other.ID}},
+		}
+		if err := CreateAssignment(assignment); err != nil {
+			t.Fatalf("CreateAssignment: %v", err)
+		}
+		// 未开放的作业不影响有效期
+		future := &Assignment{CourseID: course.ID, Title: "第二周", OpenAt: now.Add(time.Hour), DueAt: now.Add(2 * time.Hour), Lifetime: 300,
+			Envs: []AssignmentEnv{{VulEnvID: env.ID}}}
+		CreateAssignment(future)
+
+		if lifetime, err := GetAssignmentLifetime(alice.ID, env.ID, now); err != nil || lifetime != 90 {
+			t.Errorf("GetAssignmentLifetime = %d, %v", lifetime, err)
+		}
+		if lifetime, _ := GetAssignmentLifetime(teacher.ID, env.ID, now); lifetime != 0 {
+			t.Errorf("未选课的用户不应使用作业有效期: %d", lifetime)
+		}
+		if lifetime, _ := GetAssignmentLifetime(alice.ID, env.ID, now.Add(90*time.Minute)); lifetime != 300 {
+			t.Errorf("截止后应使用下一个开放中作业的有效期: %d", lifetime)
+		}
+
+		if err := RecordAssignmentLaunch(alice.ID, env.ID, now); err != nil {
+			t.Fatalf("RecordAssignmentLaunch: %v", err)
+		}
+		RecordAssignmentLaunch(alice.ID, env.ID, now.Add(time.Minute))
+		progress, err := GetAssignmentProgress(assignment.ID)
+		if err != nil || len(progress) != 1 || progress[0].LaunchedAt == nil || progress[0].LaunchedAt.Sub(now).Abs() > time.Second {
+			t.Errorf("应只记录首次开启: %+v, %v", progress, err)
+		}
+		if progress, _ := GetAssignmentProgress(future.ID); len(progress) != 0 {
+			t.Errorf("未开放的作业不应记录进度: %+v", progress)
+		}
+
+		assignment.Title = "第一周(修改)"
+		assignment.Envs = []AssignmentEnv{{VulEnvID: other.ID}}
+		if err := UpdateAssignment(assignment); err != nil {
+			t.Fatalf("UpdateAssignment: %v", err)
+		}
+		if got, err := GetAssignment(assignment.ID); err != nil || got.Title != "第一周(修改)" || len(got.Envs) != 1 || got.Envs[0].VulEnvID != other.ID {
+			t.Errorf("GetAssignment = %+v, %v", got, err)
+		}
+		if err := DeleteAssignmentEnvsByVulEnvID(other.ID); err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := GetAssignment(assignment.ID); len(got.Envs) != 0 {
+			t.Errorf("删除漏洞环境后应从作业中移除: %+v", got.Envs)
+		}
+
+		if err := DeleteCourseStudentsByUserID(alice.ID); err != nil {
+			t.Fatal(err)
+		}
+		if IsCourseStudent(course.ID, alice.ID) {
+			t.Error("删除用户后选课记录应被删除")
+		}
+		if err := UnenrollStudent(course.ID, alice.ID); err == nil {
+			t.Error("未选课的学生退课应返回错误")
+		}
+		if err := DeleteCourse(course.ID); err != nil {
+			t.Fatalf("DeleteCourse: %v", err)
+		}
+		if assignments, _ := GetAssignmentsByCourseID(course.ID); len(assignments) != 0 {
+			t.Errorf("删除课程后作业应被删除: %+v", assignments)
+		}
+		if IsCourseStudent(course.ID, bob.ID) {
+			t.Error("删除课程后选课记录应被删除")
+		}
+	})
+}
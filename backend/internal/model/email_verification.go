@@ -0,0 +1,82 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// EmailVerificationToken 注册后验证邮箱的一次性令牌，只保存令牌的哈希。
+// 账号禁用且有未使用的令牌时视为等待验证邮箱
+type EmailVerificationToken struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement"`
+	UserID    uint      `gorm:"not null;index"`
+	TokenHash string    `gorm:"type:varchar(64);uniqueIndex;not null"`
+	ExpiresAt time.Time `gorm:"index"`
+	UsedAt    *time.Time
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+}
+
+// CreateEmailVerificationToken 保存验证令牌，同时删除该用户之前未使用的令牌，只有最新的链接有效
+func CreateEmailVerificationToken(token *EmailVerificationToken) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ? AND used_at IS NULL", token.UserID).Delete(&EmailVerificationToken{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(token).Error
+	})
+}
+
+// GetPendingEmailVerification 查询用户最近一个未使用的令牌(可能已过期)，没有时返回gorm.ErrRecordNotFound
+func GetPendingEmailVerification(userID uint) (*EmailVerificationToken, error) {
+	var token EmailVerificationToken
+	err := DB.Where("user_id = ? AND used_at IS NULL", userID).Order("id DESC").First(&token).Error
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// VerifyEmail 使用令牌并在同一事务中启用账号，令牌不存在、已使用、已过期或账号不是待验证状态时返回gorm.ErrRecordNotFound
+func VerifyEmail(tokenHash string) (*User, error) {
+	var user User
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var token EmailVerificationToken
+		if err := tx.Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", tokenHash, time.Now()).First(&token).Error; err != nil {
+			return err
+		}
+		// 并发使用同一令牌时只有一个请求能更新成功
+		result := tx.Model(&EmailVerificationToken{}).
+			Where("id = ? AND used_at IS NULL", token.ID).
+			Update("used_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		result = tx.Model(&User{}).Where("id = ? AND status = 0", token.UserID).Update("status", 1)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return tx.First(&user, token.UserID).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// DeleteEmailVerificationTokens 删除用户所有的验证令牌，管理员修改账号状态后不再允许通过邮件启用
+func DeleteEmailVerificationTokens(userID uint) error {
+	return DB.Where("user_id = ?", userID).Delete(&EmailVerificationToken{}).Error
+}
+
+// DeleteExpiredEmailVerificationTokens 删除指定时间之前过期的令牌
+func DeleteExpiredEmailVerificationTokens(t time.Time) (int64, error) {
+	result := DB.Where("expires_at < ?", t).Delete(&EmailVerificationToken{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,75 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// InviteCode 管理员生成的注册邀请码，使用邀请码注册的账号获得预设的身份和初始积分
+type InviteCode struct {
+	ID        uint       `gorm:"primaryKey;autoIncrement"`
+	Code      string     `gorm:"type:varchar(32);uniqueIndex;not null"`
+	Role      string     `gorm:"type:varchar(20);not null"`
+	Score     float64    `gorm:"not null"`
+	MaxUses   int        `gorm:"not null"` // 最多可使用的次数
+	UsedCount int        `gorm:"not null"` // 已使用的次数
+	ExpiresAt *time.Time // 为空时不过期
+	Note      string     `gorm:"type:varchar(100)"`
+	CreatedBy uint       `gorm:"not null"`
+	CreatedAt time.Time  `gorm:"autoCreateTime"`
+}
+
+// CreateInviteCode 保存邀请码
+func CreateInviteCode(invite *InviteCode) error {
+	return DB.Create(invite).Error
+}
+
+// GetInviteCodes 按创建时间倒序获取所有邀请码
+func GetInviteCodes() ([]InviteCode, error) {
+	var invites []InviteCode
+	err := DB.Order("id DESC").Find(&invites).Error
+	return invites, err
+}
+
+// GetInviteCode 根据邀请码查询，不检查是否可用
+func GetInviteCode(code string) (*InviteCode, error) {
+	var invite InviteCode
+	if err := DB.Where("code = ?", code).First(&invite).Error; err != nil {
+		return nil, err
+	}
+	return &invite, nil
+}
+
+// DeleteInviteCode 删除邀请码，已注册的账号不受影响
+func DeleteInviteCode(id uint) error {
+	result := DB.Delete(&InviteCode{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// CreateUserWithInvite 在同一事务中占用一次邀请码并创建用户，
+// 邀请码不存在、已过期或已用完时返回gorm.ErrRecordNotFound
+func CreateUserWithInvite(user *User, code string) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		// 条件更新保证并发注册时不会超出使用次数
+		result := tx.Model(&InviteCode{}).
+			Where("code = ? AND used_count < max_uses AND (expires_at IS NULL OR expires_at > ?)", code, time.Now()).
+			Update("used_count", gorm.Expr("used_count + 1"))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+		return recordInitialScore(tx, user, "邀请码初始积分")
+	})
+}
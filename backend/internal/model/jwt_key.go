@@ -0,0 +1,84 @@
+package model
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// JwtKey JWT签名密钥
+type JwtKey struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement"`
+	Kid       string    `gorm:"type:varchar(36);uniqueIndex;not null"` // 密钥ID，写入token头部
+	Secret    string    `gorm:"type:varchar(128);not null"`            // base64编码的密钥
+	CreatedAt time.Time `gorm:"autoCreateTime;index"`                  // 创建时间(启用时间)
+}
+
+// CreateJwtKey 创建签名密钥
+func CreateJwtKey(key *JwtKey) error {
+	return DB.Create(key).Error
+}
+
+// RotateJwtKey 锁定最新的密钥后插入新密钥，多个实例同时轮换时依次执行。
+// dueBefore不为零时，最新的密钥创建于dueBefore之后说明其他实例已经轮换，不插入并返回false
+func RotateJwtKey(key *JwtKey, dueBefore time.Time) (bool, error) {
+	rotated := false
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var latest JwtKey
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Order("created_at DESC, id DESC").First(&latest).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		if err == nil {
+			// 拿到锁后重新查询，等待期间其他实例插入的密钥此时才可见
+			if err := tx.Order("created_at DESC, id DESC").First(&latest).Error; err != nil {
+				return err
+			}
+			if !dueBefore.IsZero() && !latest.CreatedAt.Before(dueBefore) {
+				return nil
+			}
+		}
+		rotated = true
+		return tx.Create(key).Error
+	})
+	return rotated, err
+}
+
+// GetActiveJwtKeys 按创建时间倒序获取仍可验签的密钥：宽限期内创建的密钥，以及被其中最早一把替换的密钥
+func GetActiveJwtKeys(gracePeriod time.Duration) ([]JwtKey, error) {
+	cutoff, ok, err := jwtKeyCutoff(gracePeriod)
+	if err != nil {
+		return nil, err
+	}
+	query := DB.Order("created_at DESC, id DESC")
+	if ok {
+		query = query.Where("created_at >= ?", cutoff)
+	}
+	var keys []JwtKey
+	err = query.Find(&keys).Error
+	return keys, err
+}
+
+// DeleteExpiredJwtKeys 删除宽限期已过的密钥，即被宽限期开始前创建的密钥替换掉的密钥
+func DeleteExpiredJwtKeys(gracePeriod time.Duration) error {
+	cutoff, ok, err := jwtKeyCutoff(gracePeriod)
+	if err != nil || !ok {
+		return err
+	}
+	return DB.Where("created_at < ?", cutoff).Delete(&JwtKey{}).Error
+}
+
+// jwtKeyCutoff 获取宽限期开始前创建的最新一把密钥的创建时间，比它更早的密钥都已过了宽限期
+func jwtKeyCutoff(gracePeriod time.Duration) (time.Time, bool, error) {
+	var key JwtKey
+	err := DB.Where("created_at <= ?", time.Now().Add(-gracePeriod)).Order("created_at DESC, id DESC").First(&key).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return time.Time{}, false, nil
+	}
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	return key.CreatedAt, true, nil
+}
@@ -0,0 +1,98 @@
+package model
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestJwtKeys(t *testing.T) {
+	forEachDB(t, func(t *testing.T) {
+		if keys, err := GetActiveJwtKeys(time.Hour); err != nil || len(keys) != 0 {
+			t.Fatalf("空表返回 %d 把密钥, %v", len(keys), err)
+		}
+
+		// k1、k2已被替换超过1小时，k3在30分钟前被k4替换
+		now := time.Now()
+		for i, kid := range []string{"k1", "k2", "k3", "k4"} {
+			offset := []time.Duration{-4 * time.Hour, -3 * time.Hour, -2 * time.Hour, -30 * time.Minute}[i]
+			key := &JwtKey{Kid: kid, Secret: "secret-" + kid, CreatedAt: now.Add(offset)}
+			if err := CreateJwtKey(key); err != nil {
+				t.Fatalf("CreateJwtKey: %v", err)
+			}
+		}
+		if err := CreateJwtKey(&JwtKey{Kid: "k1", Secret: "dup"}); err == nil {
+			t.Error("重复kid应创建失败")
+		}
+
+		keys, err := GetActiveJwtKeys(time.Hour)
+		if err != nil {
+			t.Fatalf("GetActiveJwtKeys: %v", err)
+		}
+		if len(keys) != 2 || keys[0].Kid != "k4" || keys[1].Kid != "k3" {
+			t.Fatalf("GetActiveJwtKeys 返回 %+v", keys)
+		}
+		if keys, _ := GetActiveJwtKeys(150 * time.Minute); len(keys) != 3 || keys[2].Kid != "k2" {
+			t.Fatalf("宽限期2.5小时时应包含k2: %+v", keys)
+		}
+
+		if err := DeleteExpiredJwtKeys(time.Hour); err != nil {
+			t.Fatalf("DeleteExpiredJwtKeys: %v", err)
+		}
+		keys, err = GetActiveJwtKeys(24 * time.Hour)
+		if err != nil {
+			t.Fatalf("GetActiveJwtKeys: %v", err)
+		}
+		if len(keys) != 2 || keys[1].Kid != "k3" {
+			t.Errorf("只应清理宽限期已过的密钥，剩余 %+v", keys)
+		}
+
+		// 最新密钥不早于dueBefore时说明已被轮换
+		if rotated, err := RotateJwtKey(&JwtKey{Kid: "late", Secret: "late"}, now.Add(-time.Hour)); err != nil || rotated {
+			t.Fatalf("最新密钥未到期时不应轮换: %v, %v", rotated, err)
+		}
+		if rotated, err := RotateJwtKey(&JwtKey{Kid: "due", Secret: "due"}, now.Add(-10*time.Minute)); err != nil || !rotated {
+			t.Fatalf("最新密钥到期时应轮换: %v, %v", rotated, err)
+		}
+		keys, _ = GetActiveJwtKeys(time.Hour)
+		if keys[0].Kid != "due" {
+			t.Fatalf("轮换后的当前密钥为 %s", keys[0].Kid)
+		}
+	})
+}
+
+func TestRotateJwtKeyConcurrent(t *testing.T) {
+	forEachDB(t, func(t *testing.T) {
+		if err := CreateJwtKey(&JwtKey{Kid: "old", Secret: "old", CreatedAt: time.Now().Add(-time.Hour)}); err != nil {
+			t.Fatal(err)
+		}
+		dueBefore := time.Now().Add(-time.Minute)
+
+		// 多个实例同时发现密钥到期，只有一个插入新密钥，其余失败或发现已被轮换
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		rotatedCount := 0
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				kid := string(rune('a'+i)) + "-replica"
+				rotated, err := RotateJwtKey(&JwtKey{Kid: kid, Secret: kid}, dueBefore)
+				if err == nil && rotated {
+					mu.Lock()
+					rotatedCount++
+					mu.Unlock()
+				}
+			}(i)
+		}
+		wg.Wait()
+
+		var count int64
+		if err := DB.Model(&JwtKey{}).Count(&count).Error; err != nil {
+			t.Fatal(err)
+		}
+		if rotatedCount != 1 || count != 2 {
+			t.Fatalf("并发轮换应只插入一把密钥，成功 %d 次，共 %d 把", rotatedCount, count)
+		}
+	})
+}
@@ -0,0 +1,119 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 登录失败计数的维度
+const (
+	LoginScopeUser = "user" // 按用户名计数
+	LoginScopeIP   = "ip"   // 按来源IP计数
+)
+
+// LoginThrottle 登录失败计数与锁定状态
+type LoginThrottle struct {
+	Scope         string     `gorm:"type:varchar(16);primaryKey"`
+	Subject       string     `gorm:"type:varchar(128);primaryKey"` // 用户名或IP
+	Failures      int        `gorm:"not null"`
+	LastFailureAt time.Time  `gorm:"index"`
+	LockedUntil   *time.Time `gorm:"index"`
+}
+
+// LoginHistory 登录记录
+type LoginHistory struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement"`
+	UserID    uint      `gorm:"index"` // 用户不存在时为0
+	Username  string    `gorm:"type:varchar(50);index"`
+	IP        string    `gorm:"type:varchar(64);index"`
+	UserAgent string    `gorm:"type:varchar(255)"`
+	Success   bool      `gorm:"not null"`
+	Reason    string    `gorm:"type:varchar(100)"` // 失败原因
+	CreatedAt time.Time `gorm:"autoCreateTime;index"`
+}
+
+// GetLoginThrottle 获取登录失败计数，不存在时返回gorm.ErrRecordNotFound
+func GetLoginThrottle(scope, subject string) (*LoginThrottle, error) {
+	var throttle LoginThrottle
+	err := DB.Where("scope = ? AND subject = ?", scope, subject).First(&throttle).Error
+	if err != nil {
+		return nil, err
+	}
+	return &throttle, nil
+}
+
+// RecordLoginFailure 失败次数加一并返回最新计数，上次失败早于windowStart时从1重新计数
+func RecordLoginFailure(scope, subject string, windowStart time.Time) (*LoginThrottle, error) {
+	now := time.Now()
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		// 窗口内的失败直接在数据库中累加，避免并发请求互相覆盖
+		result := tx.Model(&LoginThrottle{}).
+			Where("scope = ? AND subject = ? AND last_failure_at >= ?", scope, subject, windowStart).
+			Updates(map[string]interface{}{
+				"failures":        gorm.Expr("failures + 1"),
+				"last_failure_at": now,
+			})
+		if result.Error != nil || result.RowsAffected > 0 {
+			return result.Error
+		}
+		return tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "scope"}, {Name: "subject"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{"failures": 1, "last_failure_at": now, "locked_until": nil}),
+		}).Create(&LoginThrottle{Scope: scope, Subject: subject, Failures: 1, LastFailureAt: now}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return GetLoginThrottle(scope, subject)
+}
+
+// LockLogin 锁定到指定时间
+func LockLogin(scope, subject string, until time.Time) error {
+	return DB.Model(&LoginThrottle{}).Where("scope = ? AND subject = ?", scope, subject).
+		Update("locked_until", until).Error
+}
+
+// ClearLoginThrottle 清除失败计数和锁定，返回是否存在记录
+func ClearLoginThrottle(scope, subject string) (bool, error) {
+	result := DB.Where("scope = ? AND subject = ?", scope, subject).Delete(&LoginThrottle{})
+	return result.RowsAffected > 0, result.Error
+}
+
+// GetLockedLoginThrottles 获取当前仍处于锁定状态的记录
+func GetLockedLoginThrottles() ([]LoginThrottle, error) {
+	var throttles []LoginThrottle
+	err := DB.Where("locked_until > ?", time.Now()).Order("locked_until DESC").Find(&throttles).Error
+	return throttles, err
+}
+
+// DeleteStaleLoginThrottles 删除最后失败早于before且未锁定的记录
+func DeleteStaleLoginThrottles(before time.Time) (int64, error) {
+	result := DB.Where("last_failure_at < ? AND (locked_until IS NULL OR locked_until < ?)", before, time.Now()).
+		Delete(&LoginThrottle{})
+	return result.RowsAffected, result.Error
+}
+
+// CreateLoginHistory 写入登录记录
+func CreateLoginHistory(history *LoginHistory) error {
+	return DB.Create(history).Error
+}
+
+// GetLoginHistories 分页获取用户的登录记录，最新的在前
+func GetLoginHistories(userID uint, page, pageSize int) ([]LoginHistory, int64, error) {
+	var count int64
+	if err := DB.Model(&LoginHistory{}).Where("user_id = ?", userID).Count(&count).Error; err != nil {
+		return nil, 0, err
+	}
+	var histories []LoginHistory
+	err := DB.Where("user_id = ?", userID).Scopes(Paginate(page, pageSize)).
+		Order("id DESC").Find(&histories).Error
+	return histories, count, err
+}
+
+// DeleteLoginHistoriesBefore 删除指定时间之前的登录记录
+func DeleteLoginHistoriesBefore(t time.Time) (int64, error) {
+	result := DB.Where("created_at < ?", t).Delete(&LoginHistory{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,89 @@
+package model
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func TestLoginThrottle(t *testing.T) {
+	forEachDB(t, func(t *testing.T) {
+		if _, err := GetLoginThrottle(LoginScopeUser, "alice"); !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Fatalf("不存在的记录返回 %v", err)
+		}
+
+		windowStart := time.Now().Add(-time.Minute)
+		for i := 1; i <= 3; i++ {
+			throttle, err := RecordLoginFailure(LoginScopeUser, "alice", windowStart)
+			if err != nil || throttle.Failures != i {
+				t.Fatalf("第%d次失败计数 = %+v, %v", i, throttle, err)
+			}
+		}
+		// 不同维度分别计数
+		if throttle, err := RecordLoginFailure(LoginScopeIP, "alice", windowStart); err != nil || throttle.Failures != 1 {
+			t.Errorf("IP计数 = %+v, %v", throttle, err)
+		}
+
+		until := time.Now().Add(time.Hour)
+		if err := LockLogin(LoginScopeUser, "alice", until); err != nil {
+			t.Fatalf("LockLogin: %v", err)
+		}
+		locks, err := GetLockedLoginThrottles()
+		if err != nil || len(locks) != 1 || locks[0].Subject != "alice" || locks[0].Scope != LoginScopeUser {
+			t.Fatalf("GetLockedLoginThrottles = %+v, %v", locks, err)
+		}
+		assertTimeNear(t, "locked_until", *locks[0].LockedUntil, until)
+
+		// 窗口外的失败从1重新计数并解除锁定
+		throttle, err := RecordLoginFailure(LoginScopeUser, "alice", time.Now().Add(time.Minute))
+		if err != nil || throttle.Failures != 1 || throttle.LockedUntil != nil {
+			t.Errorf("窗口外重新计数 = %+v, %v", throttle, err)
+		}
+
+		// 未锁定且最后失败较早的记录会被清理
+		if count, err := DeleteStaleLoginThrottles(time.Now().Add(time.Minute)); err != nil || count != 2 {
+			t.Errorf("DeleteStaleLoginThrottles = %d, %v", count, err)
+		}
+		RecordLoginFailure(LoginScopeIP, "10.0.0.1", windowStart)
+		LockLogin(LoginScopeIP, "10.0.0.1", until)
+		if count, _ := DeleteStaleLoginThrottles(time.Now().Add(time.Minute)); count != 0 {
+			t.Error("锁定中的记录不应被清理")
+		}
+
+		if ok, err := ClearLoginThrottle(LoginScopeIP, "10.0.0.1"); err != nil || !ok {
+			t.Errorf("ClearLoginThrottle = %v, %v", ok, err)
+		}
+		if ok, err := ClearLoginThrottle(LoginScopeIP, "10.0.0.1"); err != nil || ok {
+			t.Errorf("重复清除 = %v, %v", ok, err)
+		}
+	})
+}
+
+func TestLoginHistory(t *testing.T) {
+	forEachDB(t, func(t *testing.T) {
+		for i, success := range []bool{false, false, true} {
+			h := &LoginHistory{UserID: 1, Username: "alice", IP: "10.0.0.1", Success: success}
+			if !success {
+				h.Reason = "密码错误"
+			}
+			if err := CreateLoginHistory(h); err != nil {
+				t.Fatalf("CreateLoginHistory %d: %v", i, err)
+			}
+		}
+		CreateLoginHistory(&LoginHistory{Username: "nobody", IP: "10.0.0.2", Reason: "用户不存在"})
+
+		histories, count, err := GetLoginHistories(1, 1, 2)
+		if err != nil || count != 3 || len(histories) != 2 {
+			t.Fatalf("GetLoginHistories 返回 %d/%d 条, %v", len(histories), count, err)
+		}
+		if !histories[0].Success || histories[1].Success {
+			t.Errorf("登录记录未按时间倒序: %+v", histories)
+		}
+
+		if count, err := DeleteLoginHistoriesBefore(time.Now().Add(time.Minute)); err != nil || count != 4 {
+			t.Errorf("DeleteLoginHistoriesBefore = %d, %v", count, err)
+		}
+	})
+}
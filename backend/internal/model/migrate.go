@@ -0,0 +1,177 @@
+package model
+
+import (
+	"AscensionPath/internal/middleware"
+	"fmt"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SchemaMigration 已执行的迁移记录
+type SchemaMigration struct {
+	Version   int       `gorm:"primaryKey;autoIncrement:false"` // 迁移版本号
+	Name      string    `gorm:"type:varchar(100);not null"`     // 迁移名称
+	AppliedAt time.Time `gorm:"autoCreateTime"`                 // 执行时间
+}
+
+func (SchemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// Migration 一个版本的表结构变更，Up/Down在同一个事务中执行并记录版本
+//
+// 迁移中不要直接使用会继续变化的模型结构体，应在迁移内定义当时的表结构快照
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error // 为nil时不支持回滚
+}
+
+// MigrationState 迁移的执行状态
+type MigrationState struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+	Unknown   bool // 数据库中存在但程序中没有的版本(程序版本过旧)
+}
+
+// sortedMigrations 按版本号排序的迁移列表，版本号重复时panic
+func sortedMigrations() []Migration {
+	list := append([]Migration(nil), migrations...)
+	sort.Slice(list, func(i, j int) bool { return list[i].Version < list[j].Version })
+	for i := 1; i < len(list); i++ {
+		if list[i].Version == list[i-1].Version {
+			panic(fmt.Sprintf("迁移版本号重复: %d", list[i].Version))
+		}
+	}
+	return list
+}
+
+// appliedMigrations 读取已执行的迁移，迁移表不存在时视为没有执行过
+func appliedMigrations(db *gorm.DB) (map[int]SchemaMigration, error) {
+	applied := make(map[int]SchemaMigration)
+	if !db.Migrator().HasTable(&SchemaMigration{}) {
+		return applied, nil
+	}
+	var records []SchemaMigration
+	if err := db.Order("version").Find(&records).Error; err != nil {
+		return nil, fmt.Errorf("读取迁移记录失败: %v", err)
+	}
+	for _, r := range records {
+		applied[r.Version] = r
+	}
+	return applied, nil
+}
+
+// MigrationStatus 获取所有迁移的执行状态
+func MigrationStatus(db *gorm.DB) ([]MigrationState, error) {
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var states []MigrationState
+	for _, m := range sortedMigrations() {
+		r, ok := applied[m.Version]
+		states = append(states, MigrationState{Version: m.Version, Name: m.Name, Applied: ok, AppliedAt: r.AppliedAt})
+		delete(applied, m.Version)
+	}
+	for _, r := range applied {
+		states = append(states, MigrationState{Version: r.Version, Name: r.Name, Applied: true, AppliedAt: r.AppliedAt, Unknown: true})
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Version < states[j].Version })
+	return states, nil
+}
+
+// MigrateUp 按版本顺序执行未执行的迁移直到target(0为最新版本)，dryRun时只返回将要执行的迁移
+func MigrateUp(db *gorm.DB, target int, dryRun bool) ([]Migration, error) {
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+	list := sortedMigrations()
+	known := make(map[int]bool, len(list))
+	for _, m := range list {
+		known[m.Version] = true
+	}
+	for version := range applied {
+		if !known[version] {
+			return nil, fmt.Errorf("数据库包含未知的迁移版本 %d，请使用更新版本的程序", version)
+		}
+	}
+
+	var pending []Migration
+	for _, m := range list {
+		if target > 0 && m.Version > target {
+			break
+		}
+		if _, ok := applied[m.Version]; !ok {
+			pending = append(pending, m)
+		}
+	}
+	if dryRun || len(pending) == 0 {
+		return pending, nil
+	}
+
+	if err := db.AutoMigrate(&SchemaMigration{}); err != nil {
+		return nil, fmt.Errorf("创建迁移表失败: %v", err)
+	}
+	for i, m := range pending {
+		middleware.SugarLogger.Infof("执行迁移 %d_%s", m.Version, m.Name)
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := m.Up(tx); err != nil {
+				return err
+			}
+			return tx.Create(&SchemaMigration{Version: m.Version, Name: m.Name}).Error
+		})
+		if err != nil {
+			return pending[:i], fmt.Errorf("迁移 %d_%s 执行失败: %v", m.Version, m.Name, err)
+		}
+	}
+	return pending, nil
+}
+
+// MigrateDown 按版本倒序回滚最近执行的steps个迁移，dryRun时只返回将要回滚的迁移
+func MigrateDown(db *gorm.DB, steps int, dryRun bool) ([]Migration, error) {
+	if steps <= 0 {
+		return nil, fmt.Errorf("回滚步数必须大于0: %d", steps)
+	}
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+
+	list := sortedMigrations()
+	var rollback []Migration
+	for i := len(list) - 1; i >= 0 && len(rollback) < steps; i-- {
+		m := list[i]
+		if _, ok := applied[m.Version]; !ok {
+			continue
+		}
+		if m.Down == nil {
+			return nil, fmt.Errorf("迁移 %d_%s 不支持回滚", m.Version, m.Name)
+		}
+		rollback = append(rollback, m)
+	}
+	if dryRun {
+		return rollback, nil
+	}
+
+	for i, m := range rollback {
+		middleware.SugarLogger.Infof("回滚迁移 %d_%s", m.Version, m.Name)
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := m.Down(tx); err != nil {
+				return err
+			}
+			return tx.Delete(&SchemaMigration{}, m.Version).Error
+		})
+		if err != nil {
+			return rollback[:i], fmt.Errorf("迁移 %d_%s 回滚失败: %v", m.Version, m.Name, err)
+		}
+	}
+	return rollback, nil
+}
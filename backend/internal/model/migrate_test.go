@@ -0,0 +1,215 @@
+package model
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// columnType 获取列在数据库中的类型名
+func columnType(t *testing.T, table, column string) string {
+	t.Helper()
+	columns, err := DB.Migrator().ColumnTypes(table)
+	if err != nil {
+		t.Fatalf("获取 %s 列信息失败: %v", table, err)
+	}
+	for _, c := range columns {
+		if c.Name() == column {
+			return strings.ToLower(c.DatabaseTypeName())
+		}
+	}
+	t.Fatalf("%s 表没有 %s 列", table, column)
+	return ""
+}
+
+func TestMigrateDownAndUp(t *testing.T) {
+	forEachDB(t, func(t *testing.T) {
+		latest := sortedMigrations()[len(migrations)-1].Version
+		states, err := MigrationStatus(DB)
+		if err != nil {
+			t.Fatalf("MigrationStatus: %v", err)
+		}
+		for _, s := range states {
+			if !s.Applied || s.Unknown || s.AppliedAt.IsZero() {
+				t.Errorf("迁移 %d_%s 状态错误: %+v", s.Version, s.Name, s)
+			}
+		}
+		if typ := columnType(t, "users", "score"); strings.Contains(typ, "int") {
+			t.Errorf("score 列类型为 %s，应为浮点数", typ)
+		}
+
+		user := createTestUser(t, "dave", 1, "user")
+		if _, err := SetScore(user.ID, 12.5, 0, ""); err != nil {
+			t.Fatalf("SetScore: %v", err)
+		}
+		if got, _ := GetUserByID(user.ID); got == nil || got.Score != 12.5 {
+			t.Errorf("积分应保留小数: %+v", got)
+		}
+
+		// dry-run不修改数据库
+		plan, err := MigrateDown(DB, 1, true)
+		if err != nil || len(plan) != 1 || plan[0].Version != latest {
+			t.Fatalf("MigrateDown dry-run 返回 %+v, %v", plan, err)
+		}
+		if pending, _ := MigrateUp(DB, 0, true); len(pending) != 0 {
+			t.Fatalf("dry-run 后有 %d 个未执行的迁移", len(pending))
+		}
+
+		if _, err := MigrateDown(DB, 1, false); err != nil {
+			t.Fatalf("MigrateDown: %v", err)
+		}
+		pending, err := MigrateUp(DB, 0, true)
+		if err != nil || len(pending) != 1 || pending[0].Version != latest {
+			t.Fatalf("回滚后未执行的迁移为 %+v, %v", pending, err)
+		}
+		if got, err := GetUserByUsername("dave"); err != nil || got.ID != user.ID {
+			t.Errorf("回滚后用户数据丢失: %+v, %v", got, err)
+		}
+
+		if done, err := MigrateUp(DB, 0, false); err != nil || len(done) != 1 {
+			t.Fatalf("MigrateUp 返回 %+v, %v", done, err)
+		}
+		if typ := columnType(t, "users", "score"); strings.Contains(typ, "int") {
+			t.Errorf("重新迁移后 score 列类型为 %s", typ)
+		}
+		// 重建表后唯一索引仍然有效
+		if err := CreateUser(&User{Username: "dave", Password: "x", Email: "dave2@example.com"}); err == nil {
+			t.Error("重建表后用户名唯一索引丢失")
+		}
+
+		// 全部回滚后表被删除
+		if _, err := MigrateDown(DB, len(migrations), false); err != nil {
+			t.Fatalf("全部回滚失败: %v", err)
+		}
+		if DB.Migrator().HasTable("users") {
+			t.Error("全部回滚后 users 表仍然存在")
+		}
+		if _, err := MigrateDown(DB, 1, false); err != nil {
+			t.Errorf("没有可回滚的迁移时返回 %v", err)
+		}
+		if done, err := MigrateUp(DB, 0, false); err != nil || len(done) != len(migrations) {
+			t.Fatalf("重新迁移返回 %d 个, %v", len(done), err)
+		}
+	})
+}
+
+func TestMigrateUpTarget(t *testing.T) {
+	forEachDB(t, func(t *testing.T) {
+		if err := DB.Migrator().DropTable(testTables...); err != nil {
+			t.Fatalf("清理数据表失败: %v", err)
+		}
+
+		// dry-run不创建迁移表
+		pending, err := MigrateUp(DB, 0, true)
+		if err != nil || len(pending) != len(migrations) {
+			t.Fatalf("MigrateUp dry-run 返回 %d 个, %v", len(pending), err)
+		}
+		if DB.Migrator().HasTable(&SchemaMigration{}) {
+			t.Error("dry-run 创建了迁移表")
+		}
+
+		done, err := MigrateUp(DB, 1, false)
+		if err != nil || len(done) != 1 || done[0].Name != "baseline" {
+			t.Fatalf("MigrateUp(1) 返回 %+v, %v", done, err)
+		}
+		if typ := columnType(t, "users", "score"); !strings.Contains(typ, "int") {
+			t.Errorf("基线版本 score 列类型为 %s", typ)
+		}
+	})
+}
+
+func TestMigrateLegacyDatabase(t *testing.T) {
+	forEachDB(t, func(t *testing.T) {
+		// 模拟引入迁移前由AutoMigrate创建并已有数据的库
+		if err := DB.Migrator().DropTable(testTables...); err != nil {
+			t.Fatalf("清理数据表失败: %v", err)
+		}
+		if err := DB.AutoMigrate(&baselineUser{}, &baselineVulEnv{}, &baselineVulInstance{}, &baselineJwtKey{}); err != nil {
+			t.Fatalf("创建旧表失败: %v", err)
+		}
+		legacy := &baselineUser{Username: "legacy", Password: "x", Email: "legacy@example.com", Score: 30}
+		if err := DB.Create(legacy).Error; err != nil {
+			t.Fatalf("创建旧用户失败: %v", err)
+		}
+
+		done, err := MigrateUp(DB, 0, false)
+		if err != nil || len(done) != len(migrations) {
+			t.Fatalf("MigrateUp 返回 %d 个, %v", len(done), err)
+		}
+		got, err := GetUserByUsername("legacy")
+		if err != nil || got.Score != 30 {
+			t.Fatalf("迁移后旧用户为 %+v, %v", got, err)
+		}
+		if typ := columnType(t, "users", "score"); strings.Contains(typ, "int") {
+			t.Errorf("旧库迁移后 score 列类型为 %s", typ)
+		}
+	})
+}
+
+func TestMigrateUnknownVersion(t *testing.T) {
+	forEachDB(t, func(t *testing.T) {
+		if err := DB.Create(&SchemaMigration{Version: 9999, Name: "from_newer_release"}).Error; err != nil {
+			t.Fatalf("写入迁移记录失败: %v", err)
+		}
+		if _, err := MigrateUp(DB, 0, false); err == nil {
+			t.Error("数据库包含未知版本时应拒绝迁移")
+		}
+		states, err := MigrationStatus(DB)
+		if err != nil {
+			t.Fatalf("MigrationStatus: %v", err)
+		}
+		last := states[len(states)-1]
+		if last.Version != 9999 || !last.Unknown {
+			t.Errorf("未知版本状态为 %+v", last)
+		}
+	})
+}
+
+func TestMigrateRotatedRefreshTokens(t *testing.T) {
+	forEachDB(t, func(t *testing.T) {
+		if _, err := MigrateDown(DB, 1, false); err != nil {
+			t.Fatalf("MigrateDown: %v", err)
+		}
+		now := time.Now()
+		rotated := &sessionV6{SessionID: "sid-a", UserID: 1, RefreshTokenHash: "hash-a2", PrevRefreshTokenHash: "hash-a", LastSeenAt: now, ExpiresAt: now.Add(time.Hour)}
+		fresh := &sessionV6{SessionID: "sid-b", UserID: 1, RefreshTokenHash: "hash-b", LastSeenAt: now, ExpiresAt: now.Add(time.Hour)}
+		for _, s := range []*sessionV6{rotated, fresh} {
+			if err := DB.Create(s).Error; err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// 上一个令牌迁入轮换记录，旧列被删除
+		if _, err := MigrateUp(DB, 0, false); err != nil {
+			t.Fatalf("MigrateUp: %v", err)
+		}
+		if DB.Migrator().HasColumn("sessions", "prev_refresh_token_hash") {
+			t.Error("迁移后仍有 prev_refresh_token_hash 列")
+		}
+		if s, err := GetSessionByRotatedRefreshHash("hash-a"); err != nil || s.ID != rotated.ID {
+			t.Errorf("上一个令牌应迁入轮换记录: %+v, %v", s, err)
+		}
+		var count int64
+		DB.Model(&RotatedRefreshToken{}).Count(&count)
+		if count != 1 {
+			t.Errorf("轮换记录有 %d 条", count)
+		}
+		// 重建表后唯一索引仍然有效
+		if err := CreateSession(&Session{SessionID: "sid-c", UserID: 1, RefreshTokenHash: "hash-b", ExpiresAt: now}); err == nil {
+			t.Error("重建表后刷新令牌唯一索引丢失")
+		}
+
+		// 回滚后保留最近轮换的令牌
+		RotateRefreshToken(rotated.ID, "hash-a2", "hash-a3", now.Add(time.Hour), "", "")
+		if _, err := MigrateDown(DB, 1, false); err != nil {
+			t.Fatalf("MigrateDown: %v", err)
+		}
+		var got sessionV6
+		if err := DB.First(&got, rotated.ID).Error; err != nil || got.PrevRefreshTokenHash != "hash-a2" {
+			t.Errorf("回滚后上一个令牌为 %q, %v", got.PrevRefreshTokenHash, err)
+		}
+		if _, err := MigrateUp(DB, 0, false); err != nil {
+			t.Fatalf("MigrateUp: %v", err)
+		}
+	})
+}
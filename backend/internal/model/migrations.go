@@ -0,0 +1,857 @@
+package model
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// migrations 所有表结构迁移，只能追加新版本，已发布的迁移不要修改
+var migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "baseline",
+		Up:      baselineUp,
+		Down:    baselineDown,
+	},
+	{
+		Version: 2,
+		Name:    "user_score_float",
+		Up: func(tx *gorm.DB) error {
+			return alterColumn(tx, &userV2{}, "Score")
+		},
+		Down: func(tx *gorm.DB) error {
+			return alterColumn(tx, &baselineUser{}, "Score")
+		},
+	},
+	{
+		Version: 3,
+		Name:    "user_must_change_password",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().AddColumn(&userMustChangePasswordV3{}, "MustChangePassword")
+		},
+		Down: func(tx *gorm.DB) error {
+			return dropColumn(tx, &userMustChangePasswordV3{}, "MustChangePassword", &userV2{})
+		},
+	},
+	{
+		Version: 4,
+		Name:    "settings",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&settingV4{}, &settingAuditV4{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&settingAuditV4{}, &settingV4{})
+		},
+	},
+	{
+		Version: 5,
+		Name:    "vul_instance_extend_count",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().AddColumn(&vulInstanceExtendCountV5{}, "ExtendCount")
+		},
+		Down: func(tx *gorm.DB) error {
+			return dropColumn(tx, &vulInstanceExtendCountV5{}, "ExtendCount", &baselineVulInstance{})
+		},
+	},
+	{
+		Version: 6,
+		Name:    "sessions",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&sessionV6{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&sessionV6{})
+		},
+	},
+	{
+		Version: 7,
+		Name:    "login_throttle_history",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&loginThrottleV7{}, &loginHistoryV7{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&loginHistoryV7{}, &loginThrottleV7{})
+		},
+	},
+	{
+		Version: 8,
+		Name:    "two_factor",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&userTwoFactorV8{}, &recoveryCodeV8{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&recoveryCodeV8{}, &userTwoFactorV8{})
+		},
+	},
+	{
+		Version: 9,
+		Name:    "api_tokens",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&apiTokenV9{}, &apiTokenUsageV9{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&apiTokenUsageV9{}, &apiTokenV9{})
+		},
+	},
+	{
+		Version: 10,
+		Name:    "oidc",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&userIdentityV10{}, &oidcStateV10{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&oidcStateV10{}, &userIdentityV10{})
+		},
+	},
+	{
+		Version: 11,
+		Name:    "roles",
+		Up:      rolesUp,
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&rolePermissionV11{}, &roleV11{})
+		},
+	},
+	{
+		Version: 12,
+		Name:    "password_reset_tokens",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&passwordResetTokenV12{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&passwordResetTokenV12{})
+		},
+	},
+	{
+		Version: 13,
+		Name:    "registration",
+		Up:      registrationUp,
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Model(&settingV4{}).Where("name = ?", "registration.mode").
+				Update("value", gorm.Expr("CASE WHEN value = 'closed' THEN 'false' ELSE 'true' END")).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&settingV4{}).Where("name = ?", "registration.mode").Update("name", "registration.open").Error; err != nil {
+				return err
+			}
+			return tx.Migrator().DropTable(&emailVerificationTokenV13{}, &inviteCodeV13{})
+		},
+	},
+	{
+		Version: 14,
+		Name:    "teams",
+		Up:      teamsUp,
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Where("permission = ?", "team:manage").Delete(&rolePermissionV11{}).Error; err != nil {
+				return err
+			}
+			if err := dropColumn(tx, &vulInstanceTeamV14{}, "TeamID", &baselineVulInstance{}); err != nil {
+				return err
+			}
+			return tx.Migrator().DropTable(&teamMemberV14{}, &teamV14{})
+		},
+	},
+	{
+		Version: 15,
+		Name:    "courses",
+		Up:      coursesUp,
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Where("permission = ?", "course:manage").Delete(&rolePermissionV11{}).Error; err != nil {
+				return err
+			}
+			return tx.Migrator().DropTable(&assignmentProgressV15{}, &assignmentEnvV15{}, &assignmentV15{},
+				&courseStudentV15{}, &courseV15{})
+		},
+	},
+	{
+		Version: 16,
+		Name:    "flags",
+		Up:      flagsUp,
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Migrator().DropTable(&solveV16{}); err != nil {
+				return err
+			}
+			if err := dropColumn(tx, &vulEnvRewardV16{}, "Reward", &baselineVulEnv{}); err != nil {
+				return err
+			}
+			if err := dropColumn(tx, &vulInstanceFlagV16{}, "Flag", &baselineVulInstance{}); err != nil {
+				return err
+			}
+			// SQLite重建表时会丢失版本14的团队索引
+			if tx.Migrator().HasIndex(&vulInstanceTeamV14{}, "TeamID") {
+				return nil
+			}
+			return tx.Migrator().CreateIndex(&vulInstanceTeamV14{}, "TeamID")
+		},
+	},
+	{
+		Version: 17,
+		Name:    "score_ledger",
+		Up:      scoreLedgerUp,
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&scoreEntryV17{})
+		},
+	},
+	{
+		Version: 18,
+		Name:    "rotated_refresh_tokens",
+		Up:      rotatedRefreshTokensUp,
+		Down:    rotatedRefreshTokensDown,
+	},
+}
+
+// 版本1：引入迁移前由AutoMigrate创建的表结构
+
+type baselineUser struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement"`
+	Username  string    `gorm:"type:varchar(50);uniqueIndex;not null"`
+	Password  string    `gorm:"type:varchar(100);not null"`
+	Email     string    `gorm:"type:varchar(100);uniqueIndex"`
+	Status    int       `gorm:"type:smallint;default:0"`
+	Score     float64   `gorm:"type:int;default:0"`
+	Role      string    `gorm:"type:varchar(20);default:'user'"`
+	LastLogin time.Time `gorm:"default:null"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime"`
+}
+
+func (baselineUser) TableName() string { return "users" }
+
+type baselineVulEnv struct {
+	gorm.Model
+	EnvName     string    `gorm:"type:varchar(100);not null;comment:环境名称;uniqueIndex"`
+	EnvDesc     string    `gorm:"type:text;comment:环境描述"`
+	EnvType     string    `gorm:"type:varchar(50);not null;comment:环境类型(单镜像/复合环境)"`
+	BaseImage   string    `gorm:"type:varchar(255);comment:基础镜像名称"`
+	BaseCompose string    `gorm:"type:varchar(255);comment:docker-compose文件路径"`
+	Rank        float64   `gorm:"type:decimal(3,1);default:3.5;comment:环境评分"`
+	From        string    `gorm:"type:varchar(100);comment:来源"`
+	CreateTime  time.Time `gorm:"default:CURRENT_TIMESTAMP;comment:创建时间"`
+	UpdateTime  time.Time `gorm:"default:CURRENT_TIMESTAMP;comment:更新时间"`
+	Degree      string    `gorm:"type:text;comment:环境信息(JSON)"`
+	IsOpen      int       `gorm:"type:int;default:1000;comment:开放级别"`
+	Cost        float64   `gorm:"type:decimal(10,2);default:0.00;comment:开启环境的成本"`
+}
+
+func (baselineVulEnv) TableName() string { return "vul_envs" }
+
+type baselineVulInstance struct {
+	gorm.Model
+	VulEnv      baselineVulEnv `gorm:"foreignKey:VulEnvID"`
+	UserID      uint           `gorm:"not null;index;comment:用户ID"`
+	VulEnvID    uint           `gorm:"not null;index;comment:漏洞环境ID"`
+	StartTime   time.Time      `gorm:"default:CURRENT_TIMESTAMP;comment:开启时间"`
+	EndTime     time.Time      `gorm:"comment:结束时间"`
+	Status      int            `gorm:"type:smallint;default:0;comment:状态(0/未创建/1运行中/2已停止/3已完成/4异常)"`
+	StackName   string         `gorm:"type:varchar(100);comment:Docker Stack名称"`
+	ContainerID string         `gorm:"type:varchar(64);comment:容器ID"`
+	Ports       string         `gorm:"type:text;comment:端口映射(JSON)"`
+	ExpireTime  time.Time      `gorm:"comment:过期时间"`
+}
+
+func (baselineVulInstance) TableName() string { return "vul_instances" }
+
+type baselineJwtKey struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement"`
+	Kid       string    `gorm:"type:varchar(36);uniqueIndex;not null"`
+	Secret    string    `gorm:"type:varchar(128);not null"`
+	CreatedAt time.Time `gorm:"autoCreateTime;index"`
+}
+
+func (baselineJwtKey) TableName() string { return "jwt_keys" }
+
+// baselineUp 新库直接建表；旧库的表已存在，只补齐缺失的列和索引
+func baselineUp(tx *gorm.DB) error {
+	return tx.AutoMigrate(&baselineUser{}, &baselineVulEnv{}, &baselineVulInstance{}, &baselineJwtKey{})
+}
+
+func baselineDown(tx *gorm.DB) error {
+	return tx.Migrator().DropTable(&baselineJwtKey{}, &baselineVulInstance{}, &baselineVulEnv{}, &baselineUser{})
+}
+
+// 版本2：积分字段改为浮点数，旧版本AutoMigrate不会修改已有列的类型
+
+type userV2 struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement"`
+	Username  string    `gorm:"type:varchar(50);uniqueIndex;not null"`
+	Password  string    `gorm:"type:varchar(100);not null"`
+	Email     string    `gorm:"type:varchar(100);uniqueIndex"`
+	Status    int       `gorm:"type:smallint;default:0"`
+	Score     float64   `gorm:"default:0"`
+	Role      string    `gorm:"type:varchar(20);default:'user'"`
+	LastLogin time.Time `gorm:"default:null"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime"`
+}
+
+func (userV2) TableName() string { return "users" }
+
+// 版本3：管理员创建的账号首次登录后必须修改密码
+
+type userMustChangePasswordV3 struct {
+	MustChangePassword bool `gorm:"default:false"`
+}
+
+func (userMustChangePasswordV3) TableName() string { return "users" }
+
+// 版本4：管理员在运行时修改的配置及修改记录
+
+type settingV4 struct {
+	Key       string    `gorm:"column:name;type:varchar(64);primaryKey"`
+	Value     string    `gorm:"type:text"`
+	UpdatedBy string    `gorm:"type:varchar(50)"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime"`
+}
+
+func (settingV4) TableName() string { return "settings" }
+
+type settingAuditV4 struct {
+	ID         uint      `gorm:"primaryKey;autoIncrement"`
+	Key        string    `gorm:"column:name;type:varchar(64);not null;index"`
+	OldValue   string    `gorm:"type:text"`
+	NewValue   string    `gorm:"type:text"`
+	OperatorID uint      `gorm:"index"`
+	Operator   string    `gorm:"type:varchar(50)"`
+	CreatedAt  time.Time `gorm:"autoCreateTime;index"`
+}
+
+func (settingAuditV4) TableName() string { return "setting_audits" }
+
+// 版本5：记录实例已延长的次数
+
+type vulInstanceExtendCountV5 struct {
+	ExtendCount int `gorm:"default:0"`
+}
+
+func (vulInstanceExtendCountV5) TableName() string { return "vul_instances" }
+
+// 版本6：登录会话
+
+type sessionV6 struct {
+	ID                   uint       `gorm:"primaryKey;autoIncrement"`
+	SessionID            string     `gorm:"type:varchar(36);uniqueIndex;not null"`
+	UserID               uint       `gorm:"not null;index"`
+	RefreshTokenHash     string     `gorm:"type:varchar(64);uniqueIndex;not null"`
+	PrevRefreshTokenHash string     `gorm:"type:varchar(64);index"`
+	UserAgent            string     `gorm:"type:varchar(255)"`
+	IP                   string     `gorm:"type:varchar(64)"`
+	CreatedAt            time.Time  `gorm:"autoCreateTime"`
+	LastSeenAt           time.Time  `gorm:"index"`
+	ExpiresAt            time.Time  `gorm:"index"`
+	RevokedAt            *time.Time `gorm:"index"`
+}
+
+func (sessionV6) TableName() string { return "sessions" }
+
+// 版本7：登录失败计数与登录记录
+
+type loginThrottleV7 struct {
+	Scope         string     `gorm:"type:varchar(16);primaryKey"`
+	Subject       string     `gorm:"type:varchar(128);primaryKey"`
+	Failures      int        `gorm:"not null"`
+	LastFailureAt time.Time  `gorm:"index"`
+	LockedUntil   *time.Time `gorm:"index"`
+}
+
+func (loginThrottleV7) TableName() string { return "login_throttles" }
+
+type loginHistoryV7 struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement"`
+	UserID    uint      `gorm:"index"`
+	Username  string    `gorm:"type:varchar(50);index"`
+	IP        string    `gorm:"type:varchar(64);index"`
+	UserAgent string    `gorm:"type:varchar(255)"`
+	Success   bool      `gorm:"not null"`
+	Reason    string    `gorm:"type:varchar(100)"`
+	CreatedAt time.Time `gorm:"autoCreateTime;index"`
+}
+
+func (loginHistoryV7) TableName() string { return "login_histories" }
+
+// 版本8：TOTP两步验证与恢复码
+
+type userTwoFactorV8 struct {
+	UserID       uint   `gorm:"primaryKey;autoIncrement:false"`
+	Secret       string `gorm:"type:varchar(64);not null"`
+	Enabled      bool   `gorm:"not null"`
+	LastUsedStep int64  `gorm:"not null"`
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+func (userTwoFactorV8) TableName() string { return "user_two_factors" }
+
+type recoveryCodeV8 struct {
+	ID        uint   `gorm:"primaryKey;autoIncrement"`
+	UserID    uint   `gorm:"not null;index"`
+	CodeHash  string `gorm:"type:varchar(64);not null;index"`
+	UsedAt    *time.Time
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+}
+
+func (recoveryCodeV8) TableName() string { return "recovery_codes" }
+
+// 版本9：个人访问令牌与调用记录
+
+type apiTokenV9 struct {
+	ID         uint      `gorm:"primaryKey;autoIncrement"`
+	UserID     uint      `gorm:"not null;index"`
+	Name       string    `gorm:"type:varchar(64);not null"`
+	Prefix     string    `gorm:"type:varchar(16);not null"`
+	TokenHash  string    `gorm:"type:varchar(64);uniqueIndex;not null"`
+	Scopes     string    `gorm:"type:varchar(255);not null"`
+	ExpiresAt  time.Time `gorm:"index"`
+	LastUsedAt *time.Time
+	LastUsedIP string     `gorm:"type:varchar(64)"`
+	CreatedBy  uint       `gorm:"not null"`
+	CreatedAt  time.Time  `gorm:"autoCreateTime"`
+	RevokedAt  *time.Time `gorm:"index"`
+}
+
+func (apiTokenV9) TableName() string { return "api_tokens" }
+
+type apiTokenUsageV9 struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement"`
+	TokenID   uint      `gorm:"not null;index"`
+	Method    string    `gorm:"type:varchar(10)"`
+	Path      string    `gorm:"type:varchar(255)"`
+	IP        string    `gorm:"type:varchar(64)"`
+	Status    int       `gorm:"not null"`
+	CreatedAt time.Time `gorm:"autoCreateTime;index"`
+}
+
+func (apiTokenUsageV9) TableName() string { return "api_token_usages" }
+
+// 版本10：OIDC单点登录的外部身份与一次性凭据
+
+type userIdentityV10 struct {
+	ID          uint      `gorm:"primaryKey;autoIncrement"`
+	UserID      uint      `gorm:"not null;index"`
+	Issuer      string    `gorm:"type:varchar(255);not null;uniqueIndex:idx_identity_subject"`
+	Subject     string    `gorm:"type:varchar(255);not null;uniqueIndex:idx_identity_subject"`
+	Email       string    `gorm:"type:varchar(100)"`
+	CreatedAt   time.Time `gorm:"autoCreateTime"`
+	LastLoginAt time.Time
+}
+
+func (userIdentityV10) TableName() string { return "user_identities" }
+
+type oidcStateV10 struct {
+	KeyHash      string    `gorm:"type:varchar(64);primaryKey"`
+	Nonce        string    `gorm:"type:varchar(64)"`
+	CodeVerifier string    `gorm:"type:varchar(128)"`
+	UserID       uint      `gorm:"not null;default:0"`
+	ExpiresAt    time.Time `gorm:"index"`
+	CreatedAt    time.Time `gorm:"autoCreateTime"`
+}
+
+func (oidcStateV10) TableName() string { return "oidc_states" }
+
+// 版本11：身份与权限，替换代码中写死的RoleMap
+
+type roleV11 struct {
+	ID          uint      `gorm:"primaryKey;autoIncrement"`
+	Name        string    `gorm:"type:varchar(20);uniqueIndex;not null"`
+	Description string    `gorm:"type:varchar(100)"`
+	Level       int       `gorm:"not null"`
+	Builtin     bool      `gorm:"not null;default:false"`
+	CreatedAt   time.Time `gorm:"autoCreateTime"`
+	UpdatedAt   time.Time `gorm:"autoUpdateTime"`
+}
+
+func (roleV11) TableName() string { return "roles" }
+
+type rolePermissionV11 struct {
+	RoleID     uint   `gorm:"primaryKey"`
+	Permission string `gorm:"type:varchar(64);primaryKey"`
+}
+
+func (rolePermissionV11) TableName() string { return "role_permissions" }
+
+// rolesV11 迁移时预置的身份，开放级别与原RoleMap一致；instructor可查看和延长所有实例，但不能管理镜像
+var rolesV11 = []struct {
+	role        roleV11
+	permissions []string
+}{
+	{roleV11{Name: "admin", Description: "管理员", Level: 0, Builtin: true}, []string{
+		"user:manage", "role:manage", "instance:view_all", "instance:extend_all", "instance:remove_all",
+		"image:view", "image:manage", "system:manage",
+	}},
+	{roleV11{Name: "vip", Description: "VIP用户", Level: 500, Builtin: true}, nil},
+	{roleV11{Name: "user", Description: "普通用户", Level: 999, Builtin: true}, nil},
+	{roleV11{Name: "instructor", Description: "教师", Level: 500}, []string{
+		"instance:view_all", "instance:extend_all", "image:view",
+	}},
+}
+
+func rolesUp(tx *gorm.DB) error {
+	if err := tx.AutoMigrate(&roleV11{}, &rolePermissionV11{}); err != nil {
+		return err
+	}
+	for _, seed := range rolesV11 {
+		role := seed.role
+		if err := tx.Create(&role).Error; err != nil {
+			return err
+		}
+		for _, p := range seed.permissions {
+			if err := tx.Create(&rolePermissionV11{RoleID: role.ID, Permission: p}).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// 版本12：自助重置密码的一次性令牌
+
+type passwordResetTokenV12 struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement"`
+	UserID    uint      `gorm:"not null;index"`
+	TokenHash string    `gorm:"type:varchar(64);uniqueIndex;not null"`
+	IP        string    `gorm:"type:varchar(45)"`
+	ExpiresAt time.Time `gorm:"index"`
+	UsedAt    *time.Time
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+}
+
+func (passwordResetTokenV12) TableName() string { return "password_reset_tokens" }
+
+// 版本13：注册邀请码和邮箱验证，运行时配置 registration.open 改为 registration.mode
+
+type inviteCodeV13 struct {
+	ID        uint    `gorm:"primaryKey;autoIncrement"`
+	Code      string  `gorm:"type:varchar(32);uniqueIndex;not null"`
+	Role      string  `gorm:"type:varchar(20);not null"`
+	Score     float64 `gorm:"not null"`
+	MaxUses   int     `gorm:"not null"`
+	UsedCount int     `gorm:"not null"`
+	ExpiresAt *time.Time
+	Note      string    `gorm:"type:varchar(100)"`
+	CreatedBy uint      `gorm:"not null"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+}
+
+func (inviteCodeV13) TableName() string { return "invite_codes" }
+
+type emailVerificationTokenV13 struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement"`
+	UserID    uint      `gorm:"not null;index"`
+	TokenHash string    `gorm:"type:varchar(64);uniqueIndex;not null"`
+	ExpiresAt time.Time `gorm:"index"`
+	UsedAt    *time.Time
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+}
+
+func (emailVerificationTokenV13) TableName() string { return "email_verification_tokens" }
+
+func registrationUp(tx *gorm.DB) error {
+	if err := tx.AutoMigrate(&inviteCodeV13{}, &emailVerificationTokenV13{}); err != nil {
+		return err
+	}
+	// 管理员保存过的是否开放注册转换为注册方式
+	var saved settingV4
+	err := tx.Where("name = ?", "registration.open").First(&saved).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	mode := "closed"
+	if open, _ := strconv.ParseBool(saved.Value); open {
+		mode = "open"
+	}
+	return tx.Model(&settingV4{}).Where("name = ?", "registration.open").
+		Updates(map[string]interface{}{"name": "registration.mode", "value": mode}).Error
+}
+
+// 版本14：团队和团队实例，管理员获得团队管理权限
+
+type teamV14 struct {
+	ID          uint      `gorm:"primaryKey;autoIncrement"`
+	Name        string    `gorm:"type:varchar(50);uniqueIndex;not null"`
+	Description string    `gorm:"type:varchar(255)"`
+	CreatedBy   uint      `gorm:"not null"`
+	CreatedAt   time.Time `gorm:"autoCreateTime"`
+	UpdatedAt   time.Time `gorm:"autoUpdateTime"`
+}
+
+func (teamV14) TableName() string { return "teams" }
+
+type teamMemberV14 struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement"`
+	TeamID    uint      `gorm:"not null;uniqueIndex:idx_team_members_team_user"`
+	UserID    uint      `gorm:"not null;uniqueIndex:idx_team_members_team_user;index"`
+	Role      string    `gorm:"type:varchar(20);not null"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+}
+
+func (teamMemberV14) TableName() string { return "team_members" }
+
+type vulInstanceTeamV14 struct {
+	TeamID uint `gorm:"not null;default:0;index"`
+}
+
+func (vulInstanceTeamV14) TableName() string { return "vul_instances" }
+
+func teamsUp(tx *gorm.DB) error {
+	if err := tx.AutoMigrate(&teamV14{}, &teamMemberV14{}); err != nil {
+		return err
+	}
+	if err := tx.Migrator().AddColumn(&vulInstanceTeamV14{}, "TeamID"); err != nil {
+		return err
+	}
+	if err := tx.Migrator().CreateIndex(&vulInstanceTeamV14{}, "TeamID"); err != nil {
+		return err
+	}
+	var admin roleV11
+	err := tx.Where("name = ?", "admin").First(&admin).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Create(&rolePermissionV11{RoleID: admin.ID, Permission: "team:manage"}).Error
+}
+
+// 版本15：课程和作业，管理员和教师获得课程管理权限
+
+type courseV15 struct {
+	ID           uint      `gorm:"primaryKey;autoIncrement"`
+	Name         string    `gorm:"type:varchar(100);uniqueIndex;not null"`
+	Description  string    `gorm:"type:varchar(255)"`
+	InstructorID uint      `gorm:"not null;index"`
+	CreatedAt    time.Time `gorm:"autoCreateTime"`
+	UpdatedAt    time.Time `gorm:"autoUpdateTime"`
+}
+
+func (courseV15) TableName() string { return "courses" }
+
+type courseStudentV15 struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement"`
+	CourseID  uint      `gorm:"not null;uniqueIndex:idx_course_students_course_user"`
+	UserID    uint      `gorm:"not null;uniqueIndex:idx_course_students_course_user;index"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+}
+
+func (courseStudentV15) TableName() string { return "course_students" }
+
+type assignmentV15 struct {
+	ID          uint      `gorm:"primaryKey;autoIncrement"`
+	CourseID    uint      `gorm:"not null;index"`
+	Title       string    `gorm:"type:varchar(100);not null"`
+	Description string    `gorm:"type:text"`
+	OpenAt      time.Time `gorm:"not null;index"`
+	DueAt       time.Time `gorm:"not null;index"`
+	Lifetime    int       `gorm:"not null;default:0;comment:实例有效期(分钟)，0使用默认有效期"`
+	CreatedAt   time.Time `gorm:"autoCreateTime"`
+	UpdatedAt   time.Time `gorm:"autoUpdateTime"`
+}
+
+func (assignmentV15) TableName() string { return "assignments" }
+
+type assignmentEnvV15 struct {
+	AssignmentID uint `gorm:"primaryKey;autoIncrement:false"`
+	VulEnvID     uint `gorm:"primaryKey;autoIncrement:false;index"`
+}
+
+func (assignmentEnvV15) TableName() string { return "assignment_envs" }
+
+type assignmentProgressV15 struct {
+	ID           uint `gorm:"primaryKey;autoIncrement"`
+	AssignmentID uint `gorm:"not null;uniqueIndex:idx_assignment_progress"`
+	UserID       uint `gorm:"not null;uniqueIndex:idx_assignment_progress;index"`
+	VulEnvID     uint `gorm:"not null;uniqueIndex:idx_assignment_progress"`
+	LaunchedAt   *time.Time
+	SolvedAt     *time.Time
+}
+
+func (assignmentProgressV15) TableName() string { return "assignment_progresses" }
+
+func coursesUp(tx *gorm.DB) error {
+	if err := tx.AutoMigrate(&courseV15{}, &courseStudentV15{}, &assignmentV15{}, &assignmentEnvV15{}, &assignmentProgressV15{}); err != nil {
+		return err
+	}
+	var roles []roleV11
+	if err := tx.Where("name IN ?", []string{"admin", "instructor"}).Find(&roles).Error; err != nil {
+		return err
+	}
+	for _, role := range roles {
+		if err := tx.Create(&rolePermissionV11{RoleID: role.ID, Permission: "course:manage"}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 版本16：实例flag、漏洞环境奖励和解出记录
+
+type vulInstanceFlagV16 struct {
+	Flag string `gorm:"type:varchar(128);index;comment:实例flag"`
+}
+
+func (vulInstanceFlagV16) TableName() string { return "vul_instances" }
+
+type vulEnvRewardV16 struct {
+	Reward float64 `gorm:"type:decimal(10,2);default:0.00;comment:解出环境的奖励"`
+}
+
+func (vulEnvRewardV16) TableName() string { return "vul_envs" }
+
+type solveV16 struct {
+	ID         uint      `gorm:"primaryKey;autoIncrement"`
+	UserID     uint      `gorm:"not null;uniqueIndex:idx_solves_user_env"`
+	VulEnvID   uint      `gorm:"not null;uniqueIndex:idx_solves_user_env;index"`
+	TeamID     uint      `gorm:"not null;default:0;index;comment:通过团队实例解出时的团队ID"`
+	InstanceID uint      `gorm:"not null;comment:提交flag的实例ID"`
+	Score      float64   `gorm:"type:decimal(10,2);not null;default:0.00;comment:获得的积分"`
+	SolvedAt   time.Time `gorm:"not null;index"`
+}
+
+func (solveV16) TableName() string { return "solves" }
+
+func flagsUp(tx *gorm.DB) error {
+	if err := tx.Migrator().AddColumn(&vulInstanceFlagV16{}, "Flag"); err != nil {
+		return err
+	}
+	if err := tx.Migrator().CreateIndex(&vulInstanceFlagV16{}, "Flag"); err != nil {
+		return err
+	}
+	if err := tx.Migrator().AddColumn(&vulEnvRewardV16{}, "Reward"); err != nil {
+		return err
+	}
+	return tx.AutoMigrate(&solveV16{})
+}
+
+// 版本17：积分流水
+
+type scoreEntryV17 struct {
+	ID         uint      `gorm:"primaryKey;autoIncrement"`
+	UserID     uint      `gorm:"not null;index"`
+	Type       string    `gorm:"type:varchar(32);not null;index;comment:流水类型"`
+	Amount     float64   `gorm:"type:decimal(10,2);not null;comment:积分变化，扣除为负数"`
+	Balance    float64   `gorm:"type:decimal(10,2);not null;comment:变化后的积分"`
+	VulEnvID   uint      `gorm:"not null;default:0;comment:相关的漏洞环境ID"`
+	RefID      uint      `gorm:"not null;default:0;index;comment:退款对应的扣费流水ID，奖励对应的解出记录ID"`
+	OperatorID uint      `gorm:"not null;default:0;comment:管理员调整时的操作人ID"`
+	Note       string    `gorm:"type:varchar(255);comment:备注"`
+	CreatedAt  time.Time `gorm:"not null;index"`
+}
+
+func (scoreEntryV17) TableName() string { return "score_entries" }
+
+// scoreLedgerUp 创建积分流水表，并为已有积分的用户记录一条期初流水，使流水合计与积分一致
+func scoreLedgerUp(tx *gorm.DB) error {
+	if err := tx.AutoMigrate(&scoreEntryV17{}); err != nil {
+		return err
+	}
+	var users []struct {
+		ID    uint
+		Score float64
+	}
+	if err := tx.Table("users").Select("id", "score").Where("score <> 0").Find(&users).Error; err != nil {
+		return err
+	}
+	now := time.Now()
+	entries := make([]scoreEntryV17, 0, len(users))
+	for _, u := range users {
+		entries = append(entries, scoreEntryV17{
+			UserID:    u.ID,
+			Type:      "admin_grant",
+			Amount:    u.Score,
+			Balance:   u.Score,
+			Note:      "期初积分",
+			CreatedAt: now,
+		})
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+	return tx.CreateInBatches(entries, 100).Error
+}
+
+// alterColumn 修改列类型。SQLite通过重建表实现，会丢失索引，修改后按表结构快照补回
+func alterColumn(tx *gorm.DB, snapshot interface{}, field string) error {
+	if err := tx.Migrator().AlterColumn(snapshot, field); err != nil {
+		return err
+	}
+	return tx.AutoMigrate(snapshot)
+}
+
+// dropColumn 删除列，删除后按上一版本的表结构快照补回SQLite重建表时丢失的索引
+func dropColumn(tx *gorm.DB, value interface{}, field string, snapshot interface{}) error {
+	if err := tx.Migrator().DropColumn(value, field); err != nil {
+		return err
+	}
+	return tx.AutoMigrate(snapshot)
+}
+
+// 版本18：记录会话轮换过的所有刷新令牌，替代只保存上一个令牌的prev_refresh_token_hash列
+
+type rotatedRefreshTokenV18 struct {
+	Hash      string    `gorm:"type:varchar(64);primaryKey"`
+	SessionID uint      `gorm:"not null;index"`
+	RotatedAt time.Time `gorm:"not null"`
+}
+
+func (rotatedRefreshTokenV18) TableName() string { return "rotated_refresh_tokens" }
+
+type sessionV18 struct {
+	ID               uint       `gorm:"primaryKey;autoIncrement"`
+	SessionID        string     `gorm:"type:varchar(36);uniqueIndex;not null"`
+	UserID           uint       `gorm:"not null;index"`
+	RefreshTokenHash string     `gorm:"type:varchar(64);uniqueIndex;not null"`
+	UserAgent        string     `gorm:"type:varchar(255)"`
+	IP               string     `gorm:"type:varchar(64)"`
+	CreatedAt        time.Time  `gorm:"autoCreateTime"`
+	LastSeenAt       time.Time  `gorm:"index"`
+	ExpiresAt        time.Time  `gorm:"index"`
+	RevokedAt        *time.Time `gorm:"index"`
+}
+
+func (sessionV18) TableName() string { return "sessions" }
+
+// rotatedRefreshTokensUp 创建已轮换令牌表，迁入各会话的上一个刷新令牌后删除旧列
+func rotatedRefreshTokensUp(tx *gorm.DB) error {
+	if err := tx.AutoMigrate(&rotatedRefreshTokenV18{}); err != nil {
+		return err
+	}
+	var sessions []sessionV6
+	if err := tx.Where("prev_refresh_token_hash <> ''").Find(&sessions).Error; err != nil {
+		return err
+	}
+	tokens := make([]rotatedRefreshTokenV18, 0, len(sessions))
+	for _, s := range sessions {
+		tokens = append(tokens, rotatedRefreshTokenV18{Hash: s.PrevRefreshTokenHash, SessionID: s.ID, RotatedAt: s.LastSeenAt})
+	}
+	if len(tokens) > 0 {
+		if err := tx.CreateInBatches(tokens, 100).Error; err != nil {
+			return err
+		}
+	}
+	return dropColumn(tx, &sessionV6{}, "PrevRefreshTokenHash", &sessionV18{})
+}
+
+// rotatedRefreshTokensDown 恢复prev_refresh_token_hash列，只能保留每个会话最近轮换的一个令牌
+func rotatedRefreshTokensDown(tx *gorm.DB) error {
+	if err := tx.AutoMigrate(&sessionV6{}); err != nil {
+		return err
+	}
+	var tokens []rotatedRefreshTokenV18
+	if err := tx.Order("rotated_at, hash").Find(&tokens).Error; err != nil {
+		return err
+	}
+	latest := make(map[uint]string)
+	for _, token := range tokens {
+		latest[token.SessionID] = token.Hash
+	}
+	for id, hash := range latest {
+		if err := tx.Model(&sessionV6{}).Where("id = ?", id).Update("prev_refresh_token_hash", hash).Error; err != nil {
+			return err
+		}
+	}
+	return tx.Migrator().DropTable(&rotatedRefreshTokenV18{})
+}
@@ -0,0 +1,112 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// UserIdentity 用户在外部IdP的身份，按(Issuer, Subject)唯一关联到本地用户
+type UserIdentity struct {
+	ID          uint      `gorm:"primaryKey;autoIncrement"`
+	UserID      uint      `gorm:"not null;index"`
+	Issuer      string    `gorm:"type:varchar(255);not null;uniqueIndex:idx_identity_subject"`
+	Subject     string    `gorm:"type:varchar(255);not null;uniqueIndex:idx_identity_subject"`
+	Email       string    `gorm:"type:varchar(100)"`
+	CreatedAt   time.Time `gorm:"autoCreateTime"`
+	LastLoginAt time.Time
+}
+
+// OIDCState 单点登录过程中的一次性凭据：发起登录时保存state对应的nonce和PKCE校验码，
+// 回调成功后保存一次性登录码对应的用户(UserID不为0)。KeyHash为state或登录码的哈希
+type OIDCState struct {
+	KeyHash      string    `gorm:"type:varchar(64);primaryKey"`
+	Nonce        string    `gorm:"type:varchar(64)"`
+	CodeVerifier string    `gorm:"type:varchar(128)"`
+	UserID       uint      `gorm:"not null;default:0"`
+	ExpiresAt    time.Time `gorm:"index"`
+	CreatedAt    time.Time `gorm:"autoCreateTime"`
+}
+
+// TableName 默认命名会把OIDC拆成o_id_c
+func (OIDCState) TableName() string { return "oidc_states" }
+
+// GetUserIdentity 根据IdP和用户标识查询关联的身份
+func GetUserIdentity(issuer, subject string) (*UserIdentity, error) {
+	var identity UserIdentity
+	if err := DB.Where("issuer = ? AND subject = ?", issuer, subject).First(&identity).Error; err != nil {
+		return nil, err
+	}
+	return &identity, nil
+}
+
+// CreateUserIdentity 为已有用户关联外部身份
+func CreateUserIdentity(identity *UserIdentity) error {
+	return DB.Create(identity).Error
+}
+
+// CreateUserWithIdentity 创建用户并关联外部身份
+func CreateUserWithIdentity(user *User, identity *UserIdentity) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+		identity.UserID = user.ID
+		return tx.Create(identity).Error
+	})
+}
+
+// TouchUserIdentity 更新身份的最后登录时间和邮箱
+func TouchUserIdentity(id uint, email string) error {
+	return DB.Model(&UserIdentity{}).Where("id = ?", id).
+		Updates(map[string]interface{}{"last_login_at": time.Now(), "email": email}).Error
+}
+
+// DeleteUserIdentity 删除关联的外部身份
+func DeleteUserIdentity(id uint) error {
+	return DB.Delete(&UserIdentity{}, id).Error
+}
+
+// GetUserIdentitiesByUserID 查询用户关联的所有外部身份
+func GetUserIdentitiesByUserID(userID uint) ([]UserIdentity, error) {
+	var identities []UserIdentity
+	err := DB.Where("user_id = ?", userID).Order("id").Find(&identities).Error
+	return identities, err
+}
+
+// CreateOIDCState 保存一次性凭据
+func CreateOIDCState(state *OIDCState) error {
+	return DB.Create(state).Error
+}
+
+// ConsumeOIDCState 取出并删除一次性凭据，不存在、已使用或已过期时返回gorm.ErrRecordNotFound
+func ConsumeOIDCState(keyHash string) (*OIDCState, error) {
+	var state OIDCState
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("key_hash = ?", keyHash).First(&state).Error; err != nil {
+			return err
+		}
+		// 并发使用同一凭据时只有一个请求能删除成功
+		result := tx.Where("key_hash = ?", keyHash).Delete(&OIDCState{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if state.ExpiresAt.Before(time.Now()) {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &state, nil
+}
+
+// DeleteExpiredOIDCStates 删除指定时间之前过期的凭据
+func DeleteExpiredOIDCStates(t time.Time) (int64, error) {
+	result := DB.Where("expires_at < ?", t).Delete(&OIDCState{})
+	return result.RowsAffected, result.Error
+}
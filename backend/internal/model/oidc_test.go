@@ -0,0 +1,83 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUserIdentity(t *testing.T) {
+	forEachDB(t, func(t *testing.T) {
+		user := &User{Username: "alice", Password: "x", Email: "alice@example.edu", Status: 1}
+		identity := &UserIdentity{Issuer: "https://idp.example.edu", Subject: "sub-1", Email: user.Email}
+		if err := CreateUserWithIdentity(user, identity); err != nil {
+			t.Fatalf("CreateUserWithIdentity: %v", err)
+		}
+		got, err := GetUserIdentity("https://idp.example.edu", "sub-1")
+		if err != nil || got.UserID != user.ID {
+			t.Fatalf("GetUserIdentity = %+v, %v", got, err)
+		}
+		if _, err := GetUserIdentity("https://other.example.edu", "sub-1"); err == nil {
+			t.Error("不同IdP的同一标识不应匹配")
+		}
+
+		// 同一外部身份不能关联两次，用户创建也应回滚
+		dup := &User{Username: "alice2", Password: "x", Email: "alice2@example.edu"}
+		if err := CreateUserWithIdentity(dup, &UserIdentity{Issuer: "https://idp.example.edu", Subject: "sub-1"}); err == nil {
+			t.Error("重复的外部身份应创建失败")
+		}
+		if _, err := GetUserByUsername("alice2"); err == nil {
+			t.Error("关联失败时不应创建用户")
+		}
+
+		if err := CreateUserIdentity(&UserIdentity{UserID: user.ID, Issuer: "https://other.example.edu", Subject: "sub-1"}); err != nil {
+			t.Fatalf("CreateUserIdentity: %v", err)
+		}
+		if identities, err := GetUserIdentitiesByUserID(user.ID); err != nil || len(identities) != 2 {
+			t.Errorf("GetUserIdentitiesByUserID = %+v, %v", identities, err)
+		}
+		if err := TouchUserIdentity(got.ID, "new@example.edu"); err != nil {
+			t.Fatalf("TouchUserIdentity: %v", err)
+		}
+		if got, _ := GetUserIdentity("https://idp.example.edu", "sub-1"); got.Email != "new@example.edu" || got.LastLoginAt.IsZero() {
+			t.Errorf("TouchUserIdentity 后 = %+v", got)
+		}
+		if err := DeleteUserIdentity(got.ID); err != nil {
+			t.Fatalf("DeleteUserIdentity: %v", err)
+		}
+		if _, err := GetUserIdentity("https://idp.example.edu", "sub-1"); err == nil {
+			t.Error("删除后仍能查到外部身份")
+		}
+		if found, err := GetUserByEmail("alice@example.edu"); err != nil || found.ID != user.ID {
+			t.Errorf("GetUserByEmail = %+v, %v", found, err)
+		}
+	})
+}
+
+func TestOIDCState(t *testing.T) {
+	forEachDB(t, func(t *testing.T) {
+		now := time.Now()
+		if err := CreateOIDCState(&OIDCState{KeyHash: "k1", Nonce: "n1", CodeVerifier: "v1", ExpiresAt: now.Add(time.Minute)}); err != nil {
+			t.Fatalf("CreateOIDCState: %v", err)
+		}
+		if err := CreateOIDCState(&OIDCState{KeyHash: "k2", UserID: 3, ExpiresAt: now.Add(-time.Minute)}); err != nil {
+			t.Fatalf("CreateOIDCState: %v", err)
+		}
+
+		state, err := ConsumeOIDCState("k1")
+		if err != nil || state.Nonce != "n1" || state.CodeVerifier != "v1" {
+			t.Fatalf("ConsumeOIDCState = %+v, %v", state, err)
+		}
+		if _, err := ConsumeOIDCState("k1"); err == nil {
+			t.Error("凭据只能使用一次")
+		}
+		if _, err := ConsumeOIDCState("k2"); err == nil {
+			t.Error("过期的凭据不应通过")
+		}
+
+		CreateOIDCState(&OIDCState{KeyHash: "k3", ExpiresAt: now.Add(-time.Minute)})
+		CreateOIDCState(&OIDCState{KeyHash: "k4", ExpiresAt: now.Add(time.Minute)})
+		if deleted, err := DeleteExpiredOIDCStates(now); err != nil || deleted != 1 {
+			t.Errorf("DeleteExpiredOIDCStates = %d, %v", deleted, err)
+		}
+	})
+}
@@ -0,0 +1,86 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PasswordResetToken 自助重置密码的一次性令牌，只保存令牌的哈希
+type PasswordResetToken struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement"`
+	UserID    uint      `gorm:"not null;index"`
+	TokenHash string    `gorm:"type:varchar(64);uniqueIndex;not null"`
+	IP        string    `gorm:"type:varchar(45)"`
+	ExpiresAt time.Time `gorm:"index"`
+	UsedAt    *time.Time
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+}
+
+// CreatePasswordResetToken 保存重置令牌，同时作废该用户之前未使用的令牌，只有最新的链接有效
+func CreatePasswordResetToken(token *PasswordResetToken) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&PasswordResetToken{}).
+			Where("user_id = ? AND used_at IS NULL", token.UserID).
+			Update("used_at", time.Now()).Error
+		if err != nil {
+			return err
+		}
+		return tx.Create(token).Error
+	})
+}
+
+// GetLatestPasswordResetToken 查询用户最近一次申请的令牌，用于限制申请频率
+func GetLatestPasswordResetToken(userID uint) (*PasswordResetToken, error) {
+	var token PasswordResetToken
+	if err := DB.Where("user_id = ?", userID).Order("created_at DESC, id DESC").First(&token).Error; err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// GetPasswordResetToken 查询未使用且未过期的令牌，不存在时返回gorm.ErrRecordNotFound
+func GetPasswordResetToken(tokenHash string) (*PasswordResetToken, error) {
+	var token PasswordResetToken
+	err := DB.Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", tokenHash, time.Now()).First(&token).Error
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// UsePasswordResetToken 标记令牌已使用，不存在、已使用或已过期时返回gorm.ErrRecordNotFound
+func UsePasswordResetToken(tokenHash string) (*PasswordResetToken, error) {
+	var token PasswordResetToken
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("token_hash = ?", tokenHash).First(&token).Error; err != nil {
+			return err
+		}
+		if token.UsedAt != nil || token.ExpiresAt.Before(time.Now()) {
+			return gorm.ErrRecordNotFound
+		}
+		// 并发使用同一令牌时只有一个请求能更新成功
+		now := time.Now()
+		result := tx.Model(&PasswordResetToken{}).
+			Where("id = ? AND used_at IS NULL", token.ID).
+			Update("used_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		token.UsedAt = &now
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// DeleteExpiredPasswordResetTokens 删除指定时间之前过期的令牌
+func DeleteExpiredPasswordResetTokens(t time.Time) (int64, error) {
+	result := DB.Where("expires_at < ?", t).Delete(&PasswordResetToken{})
+	return result.RowsAffected, result.Error
+}
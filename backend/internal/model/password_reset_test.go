@@ -0,0 +1,58 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPasswordResetToken(t *testing.T) {
+	forEachDB(t, func(t *testing.T) {
+		user := &User{Username: "alice", Password: "x", Email: "alice@example.edu", Status: 1}
+		if err := CreateUser(user); err != nil {
+			t.Fatalf("CreateUser: %v", err)
+		}
+		first := &PasswordResetToken{UserID: user.ID, TokenHash: "hash-1", ExpiresAt: time.Now().Add(time.Hour)}
+		if err := CreatePasswordResetToken(first); err != nil {
+			t.Fatalf("CreatePasswordResetToken: %v", err)
+		}
+		second := &PasswordResetToken{UserID: user.ID, TokenHash: "hash-2", ExpiresAt: time.Now().Add(time.Hour)}
+		if err := CreatePasswordResetToken(second); err != nil {
+			t.Fatalf("CreatePasswordResetToken: %v", err)
+		}
+		if latest, err := GetLatestPasswordResetToken(user.ID); err != nil || latest.ID != second.ID {
+			t.Errorf("GetLatestPasswordResetToken = %+v, %v", latest, err)
+		}
+
+		// 申请新链接后旧链接失效
+		if _, err := GetPasswordResetToken("hash-1"); err == nil {
+			t.Error("旧令牌应已失效")
+		}
+		if _, err := UsePasswordResetToken("hash-1"); err == nil {
+			t.Error("旧令牌应已失效")
+		}
+		if got, err := GetPasswordResetToken("hash-2"); err != nil || got.ID != second.ID {
+			t.Fatalf("GetPasswordResetToken = %+v, %v", got, err)
+		}
+		got, err := UsePasswordResetToken("hash-2")
+		if err != nil || got.UserID != user.ID || got.UsedAt == nil {
+			t.Fatalf("UsePasswordResetToken = %+v, %v", got, err)
+		}
+		if _, err := UsePasswordResetToken("hash-2"); err == nil {
+			t.Error("令牌只能使用一次")
+		}
+
+		expired := &PasswordResetToken{UserID: user.ID, TokenHash: "hash-3", ExpiresAt: time.Now().Add(-time.Minute)}
+		if err := CreatePasswordResetToken(expired); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := GetPasswordResetToken("hash-3"); err == nil {
+			t.Error("过期的令牌不应查到")
+		}
+		if _, err := UsePasswordResetToken("hash-3"); err == nil {
+			t.Error("过期的令牌不能使用")
+		}
+		if n, err := DeleteExpiredPasswordResetTokens(time.Now()); err != nil || n != 1 {
+			t.Errorf("DeleteExpiredPasswordResetTokens = %d, %v", n, err)
+		}
+	})
+}
@@ -0,0 +1,127 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestInviteCode(t *testing.T) {
+	forEachDB(t, func(t *testing.T) {
+		invite := &InviteCode{Code: "ABCD-EFGH-JKLM", Role: "vip", Score: 10, MaxUses: 1, CreatedBy: 1}
+		if err := CreateInviteCode(invite); err != nil {
+			t.Fatalf("CreateInviteCode: %v", err)
+		}
+		expired := time.Now().Add(-time.Minute)
+		if err := CreateInviteCode(&InviteCode{Code: "OLD", Role: "user", MaxUses: 5, ExpiresAt: &expired}); err != nil {
+			t.Fatal(err)
+		}
+
+		user := &User{Username: "alice", Password: "x", Email: "alice@example.edu", Status: 1, Role: "vip", Score: 10}
+		if err := CreateUserWithInvite(user, "ABCD-EFGH-JKLM"); err != nil {
+			t.Fatalf("CreateUserWithInvite: %v", err)
+		}
+		// 使用次数已满、已过期或不存在的邀请码不能注册，用户也不应创建
+		for _, code := range []string{"ABCD-EFGH-JKLM", "OLD", "NONE"} {
+			if err := CreateUserWithInvite(&User{Username: "bob", Password: "x", Email: "bob@example.edu"}, code); err == nil {
+				t.Errorf("邀请码 %s 不应可用", code)
+			}
+		}
+		if _, err := GetUserByUsername("bob"); err == nil {
+			t.Error("邀请码不可用时不应创建用户")
+		}
+		// 用户名重复时回滚使用次数
+		second := &InviteCode{Code: "MULTI", Role: "user", MaxUses: 2, CreatedBy: 1}
+		CreateInviteCode(second)
+		if err := CreateUserWithInvite(&User{Username: "alice", Password: "x", Email: "a2@example.edu"}, "MULTI"); err == nil {
+			t.Error("重复的用户名应创建失败")
+		}
+		if got, _ := GetInviteCode("MULTI"); got.UsedCount != 0 {
+			t.Errorf("创建用户失败后邀请码使用次数为 %d", got.UsedCount)
+		}
+
+		if got, err := GetInviteCode("ABCD-EFGH-JKLM"); err != nil || got.UsedCount != 1 {
+			t.Errorf("GetInviteCode = %+v, %v", got, err)
+		}
+		if invites, err := GetInviteCodes(); err != nil || len(invites) != 3 || invites[0].Code != "MULTI" {
+			t.Errorf("GetInviteCodes = %+v, %v", invites, err)
+		}
+		if err := DeleteInviteCode(invite.ID); err != nil {
+			t.Fatalf("DeleteInviteCode: %v", err)
+		}
+		if err := DeleteInviteCode(invite.ID); err == nil {
+			t.Error("删除不存在的邀请码应返回错误")
+		}
+	})
+}
+
+func TestEmailVerification(t *testing.T) {
+	forEachDB(t, func(t *testing.T) {
+		user := createTestUser(t, "carol", 0, "user")
+		first := &EmailVerificationToken{UserID: user.ID, TokenHash: "hash-1", ExpiresAt: time.Now().Add(time.Hour)}
+		if err := CreateEmailVerificationToken(first); err != nil {
+			t.Fatalf("CreateEmailVerificationToken: %v", err)
+		}
+		second := &EmailVerificationToken{UserID: user.ID, TokenHash: "hash-2", ExpiresAt: time.Now().Add(time.Hour)}
+		if err := CreateEmailVerificationToken(second); err != nil {
+			t.Fatal(err)
+		}
+		if pending, err := GetPendingEmailVerification(user.ID); err != nil || pending.ID != second.ID {
+			t.Fatalf("GetPendingEmailVerification = %+v, %v", pending, err)
+		}
+		if _, err := VerifyEmail("hash-1"); err == nil {
+			t.Error("重新发送后旧链接应失效")
+		}
+		got, err := VerifyEmail("hash-2")
+		if err != nil || got.ID != user.ID || got.Status != 1 {
+			t.Fatalf("VerifyEmail = %+v, %v", got, err)
+		}
+		if _, err := VerifyEmail("hash-2"); err == nil {
+			t.Error("令牌只能使用一次")
+		}
+		if _, err := GetPendingEmailVerification(user.ID); err == nil {
+			t.Error("验证后不应再有待验证的令牌")
+		}
+
+		// 管理员禁用后清除令牌，不能再通过邮件启用
+		disabled := createTestUser(t, "dave", 0, "user")
+		CreateEmailVerificationToken(&EmailVerificationToken{UserID: disabled.ID, TokenHash: "hash-3", ExpiresAt: time.Now().Add(time.Hour)})
+		if err := DeleteEmailVerificationTokens(disabled.ID); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := VerifyEmail("hash-3"); err == nil {
+			t.Error("删除后的令牌不能使用")
+		}
+
+		expired := &EmailVerificationToken{UserID: disabled.ID, TokenHash: "hash-4", ExpiresAt: time.Now().Add(-time.Minute)}
+		CreateEmailVerificationToken(expired)
+		if _, err := VerifyEmail("hash-4"); err == nil {
+			t.Error("过期的令牌不能使用")
+		}
+		if n, err := DeleteExpiredEmailVerificationTokens(time.Now()); err != nil || n != 1 {
+			t.Errorf("DeleteExpiredEmailVerificationTokens = %d, %v", n, err)
+		}
+	})
+}
+
+func TestMigrateRegistrationSetting(t *testing.T) {
+	forEachDB(t, func(t *testing.T) {
+		if err := DB.Create(&Setting{Key: "registration.mode", Value: "closed"}).Error; err != nil {
+			t.Fatal(err)
+		}
+		// 回滚到版本12
+		if _, err := MigrateDown(DB, len(migrations)-12, false); err != nil {
+			t.Fatalf("MigrateDown: %v", err)
+		}
+		settings, _ := GetAllSettings()
+		if len(settings) != 1 || settings[0].Key != "registration.open" || settings[0].Value != "false" {
+			t.Fatalf("回滚后配置为 %+v", settings)
+		}
+		if _, err := MigrateUp(DB, 0, false); err != nil {
+			t.Fatalf("MigrateUp: %v", err)
+		}
+		settings, _ = GetAllSettings()
+		if len(settings) != 1 || settings[0].Key != "registration.mode" || settings[0].Value != "closed" {
+			t.Fatalf("迁移后配置为 %+v", settings)
+		}
+	})
+}
@@ -0,0 +1,96 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Role 身份，用户通过users.role关联，拥有的权限保存在role_permissions中
+type Role struct {
+	ID          uint      `gorm:"primaryKey;autoIncrement"`
+	Name        string    `gorm:"type:varchar(20);uniqueIndex;not null"`
+	Description string    `gorm:"type:varchar(100)"`
+	Level       int       `gorm:"not null"`               // 漏洞环境开放级别，环境的开放级别不小于该值时可见
+	Builtin     bool      `gorm:"not null;default:false"` // 内置身份不能删除
+	CreatedAt   time.Time `gorm:"autoCreateTime"`
+	UpdatedAt   time.Time `gorm:"autoUpdateTime"`
+}
+
+// RolePermission 身份拥有的权限
+type RolePermission struct {
+	RoleID     uint   `gorm:"primaryKey"`
+	Permission string `gorm:"type:varchar(64);primaryKey"`
+}
+
+// GetRoles 获取所有身份，按开放级别排序
+func GetRoles() ([]Role, error) {
+	var roles []Role
+	err := DB.Order("level, name").Find(&roles).Error
+	return roles, err
+}
+
+// GetRolePermissions 获取所有身份的权限
+func GetRolePermissions() ([]RolePermission, error) {
+	var permissions []RolePermission
+	err := DB.Order("role_id, permission").Find(&permissions).Error
+	return permissions, err
+}
+
+// GetRoleByName 通过名称获取身份
+func GetRoleByName(name string) (*Role, error) {
+	var role Role
+	if err := DB.Where("name = ?", name).First(&role).Error; err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+// CreateRole 在同一事务中创建身份及其权限
+func CreateRole(role *Role, permissions []string) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(role).Error; err != nil {
+			return err
+		}
+		return createRolePermissions(tx, role.ID, permissions)
+	})
+}
+
+// UpdateRole 更新身份的说明和开放级别，并替换其权限
+func UpdateRole(role *Role, permissions []string) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&Role{}).Where("id = ?", role.ID).Updates(map[string]interface{}{
+			"description": role.Description,
+			"level":       role.Level,
+			"updated_at":  time.Now(),
+		}).Error
+		if err != nil {
+			return err
+		}
+		if err := tx.Where("role_id = ?", role.ID).Delete(&RolePermission{}).Error; err != nil {
+			return err
+		}
+		return createRolePermissions(tx, role.ID, permissions)
+	})
+}
+
+// DeleteRole 删除身份及其权限
+func DeleteRole(id uint) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("role_id = ?", id).Delete(&RolePermission{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&Role{}, id).Error
+	})
+}
+
+func createRolePermissions(tx *gorm.DB, roleID uint, permissions []string) error {
+	if len(permissions) == 0 {
+		return nil
+	}
+	rows := make([]RolePermission, 0, len(permissions))
+	for _, p := range permissions {
+		rows = append(rows, RolePermission{RoleID: roleID, Permission: p})
+	}
+	return tx.Create(&rows).Error
+}
@@ -0,0 +1,78 @@
+package model
+
+import "testing"
+
+func TestRoleSeeds(t *testing.T) {
+	forEachDB(t, func(t *testing.T) {
+		roles, err := GetRoles()
+		if err != nil || len(roles) != 4 {
+			t.Fatalf("GetRoles = %+v, %v", roles, err)
+		}
+		if roles[0].Name != "admin" || roles[0].Level != 0 || !roles[0].Builtin {
+			t.Errorf("预置的admin不正确: %+v", roles[0])
+		}
+		instructor, err := GetRoleByName("instructor")
+		if err != nil || instructor.Builtin || instructor.Level != 500 {
+			t.Fatalf("GetRoleByName(instructor) = %+v, %v", instructor, err)
+		}
+		permissions, err := GetRolePermissions()
+		if err != nil {
+			t.Fatalf("GetRolePermissions: %v", err)
+		}
+		var got []string
+		for _, p := range permissions {
+			if p.RoleID == instructor.ID {
+				got = append(got, p.Permission)
+			}
+		}
+		// 版本15为instructor增加了课程管理权限
+		if len(got) != 4 || got[0] != "course:manage" || got[1] != "image:view" || got[2] != "instance:extend_all" || got[3] != "instance:view_all" {
+			t.Errorf("instructor的权限 = %v", got)
+		}
+	})
+}
+
+func TestRoleCRUD(t *testing.T) {
+	forEachDB(t, func(t *testing.T) {
+		role := &Role{Name: "ta", Description: "助教", Level: 800}
+		if err := CreateRole(role, []string{"instance:view_all"}); err != nil {
+			t.Fatalf("CreateRole: %v", err)
+		}
+		if err := CreateRole(&Role{Name: "ta"}, nil); err == nil {
+			t.Error("重复的身份名应创建失败")
+		}
+
+		role.Description = "课程助教"
+		role.Level = 700
+		if err := UpdateRole(role, []string{"instance:extend_all", "image:view"}); err != nil {
+			t.Fatalf("UpdateRole: %v", err)
+		}
+		got, err := GetRoleByName("ta")
+		if err != nil || got.Description != "课程助教" || got.Level != 700 {
+			t.Fatalf("UpdateRole 后 = %+v, %v", got, err)
+		}
+		count := func() int {
+			permissions, _ := GetRolePermissions()
+			n := 0
+			for _, p := range permissions {
+				if p.RoleID == role.ID {
+					n++
+				}
+			}
+			return n
+		}
+		if n := count(); n != 2 {
+			t.Errorf("UpdateRole 应替换权限，实际有 %d 条", n)
+		}
+
+		if err := DeleteRole(role.ID); err != nil {
+			t.Fatalf("DeleteRole: %v", err)
+		}
+		if _, err := GetRoleByName("ta"); err == nil {
+			t.Error("删除后仍能查到身份")
+		}
+		if n := count(); n != 0 {
+			t.Errorf("删除身份后仍有 %d 条权限", n)
+		}
+	})
+}
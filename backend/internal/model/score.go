@@ -0,0 +1,207 @@
+package model
+
+import (
+	"AscensionPath/internal/utils"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 积分流水类型
+const (
+	ScoreLaunchCost  = "launch_cost"  // 开启实例的开销
+	ScoreRefund      = "refund"       // 开启实例失败退还的开销
+	ScoreSolveReward = "solve_reward" // 解出环境的奖励
+	ScoreAdminGrant  = "admin_grant"  // 管理员调整、邀请码等发放的积分
+)
+
+// ScoreEntry 积分流水，只追加不修改，用户积分的每次变化都对应一条流水
+type ScoreEntry struct {
+	ID         uint      `gorm:"primaryKey;autoIncrement"`
+	UserID     uint      `gorm:"not null;index"`
+	Type       string    `gorm:"type:varchar(32);not null;index;comment:流水类型"`
+	Amount     float64   `gorm:"type:decimal(10,2);not null;comment:积分变化，扣除为负数"`
+	Balance    float64   `gorm:"type:decimal(10,2);not null;comment:变化后的积分"`
+	VulEnvID   uint      `gorm:"not null;default:0;comment:相关的漏洞环境ID"`
+	RefID      uint      `gorm:"not null;default:0;index;comment:退款对应的扣费流水ID，扣费对应的实例ID，奖励对应的解出记录ID"`
+	OperatorID uint      `gorm:"not null;default:0;comment:管理员调整时的操作人ID"`
+	Note       string    `gorm:"type:varchar(255);comment:备注"`
+	CreatedAt  time.Time `gorm:"not null;index"`
+}
+
+// ChangeScore 在事务中修改用户积分并记录流水，扣除积分时余额不足返回 utils.ErrInsufficientScore
+func ChangeScore(entry *ScoreEntry) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		return changeScore(tx, entry)
+	})
+}
+
+// changeScore 修改积分并记录流水。扣除时用条件更新保证并发扣费不会透支
+func changeScore(tx *gorm.DB, entry *ScoreEntry) error {
+	query := tx.Model(&User{}).Where("id = ?", entry.UserID)
+	if entry.Amount < 0 {
+		query = query.Where("score >= ?", -entry.Amount)
+	}
+	result := query.Update("score", gorm.Expr("score + ?", entry.Amount))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		var count int64
+		if err := tx.Model(&User{}).Where("id = ?", entry.UserID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return utils.ErrInsufficientScore
+	}
+	if err := tx.Model(&User{}).Select("score").Where("id = ?", entry.UserID).Scan(&entry.Balance).Error; err != nil {
+		return err
+	}
+	entry.CreatedAt = time.Now()
+	return tx.Create(entry).Error
+}
+
+// RefundScore 退还扣费流水的开销，每条扣费流水只退还一次，已退还时返回 utils.ErrAlreadyRefunded
+func RefundScore(chargeID uint, note string) (*ScoreEntry, error) {
+	var refund *ScoreEntry
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var charge ScoreEntry
+		if err := tx.Where("id = ? AND type = ?", chargeID, ScoreLaunchCost).First(&charge).Error; err != nil {
+			return err
+		}
+		var count int64
+		if err := tx.Model(&ScoreEntry{}).Where("type = ? AND ref_id = ?", ScoreRefund, chargeID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return utils.ErrAlreadyRefunded
+		}
+		refund = &ScoreEntry{
+			UserID:   charge.UserID,
+			Type:     ScoreRefund,
+			Amount:   -charge.Amount,
+			VulEnvID: charge.VulEnvID,
+			RefID:    charge.ID,
+			Note:     note,
+		}
+		return changeScore(tx, refund)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return refund, nil
+}
+
+// ReserveVulInstance 开启实例前在一个事务中检查并扣费：锁定实例所有者(个人实例锁定用户，团队实例锁定团队)，
+// 确认没有运行中或创建中的实例后写入创建中的实例记录，并扣除开销(charge为nil时不扣费)，扣费流水的RefID为实例ID。
+// 同一所有者并发开启同一环境时只有一个请求成功，其余返回 utils.ErrInstanceExists
+func ReserveVulInstance(instance *VulInstance, charge *ScoreEntry) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		locked := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id")
+		query := tx.Model(&VulInstance{}).Where("vul_env_id = ? AND status IN ?",
+			instance.VulEnvID, []int{InstanceStatusNone, InstanceStatusRunning})
+		if instance.TeamID != 0 {
+			if err := locked.First(&Team{}, instance.TeamID).Error; err != nil {
+				return err
+			}
+			query = query.Where("team_id = ?", instance.TeamID)
+		} else {
+			if err := locked.First(&User{}, instance.UserID).Error; err != nil {
+				return err
+			}
+			query = query.Where("user_id = ? AND team_id = 0", instance.UserID)
+		}
+		var count int64
+		if err := query.Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return utils.ErrInstanceExists
+		}
+
+		instance.Status = InstanceStatusNone
+		if err := tx.Create(instance).Error; err != nil {
+			return err
+		}
+		if charge == nil {
+			return nil
+		}
+		charge.RefID = instance.ID
+		return changeScore(tx, charge)
+	})
+}
+
+// RefundLaunchCharge 退还实例的开销，用于开启过程中断的实例；没有扣费时返回nil
+func RefundLaunchCharge(instanceID uint, note string) (*ScoreEntry, error) {
+	var charge ScoreEntry
+	err := DB.Where("type = ? AND ref_id = ?", ScoreLaunchCost, instanceID).First(&charge).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return RefundScore(charge.ID, note)
+}
+
+// SetScore 管理员将用户积分调整为指定值，按差额记录一条调整流水，没有变化时返回nil
+func SetScore(userID uint, score float64, operatorID uint, note string) (*ScoreEntry, error) {
+	var entry *ScoreEntry
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var user User
+		if err := tx.Select("id", "score").First(&user, userID).Error; err != nil {
+			return err
+		}
+		if user.Score == score {
+			return nil
+		}
+		entry = &ScoreEntry{
+			UserID:     userID,
+			Type:       ScoreAdminGrant,
+			Amount:     score - user.Score,
+			OperatorID: operatorID,
+			Note:       note,
+		}
+		return changeScore(tx, entry)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// recordInitialScore 为新建的用户记录初始积分的流水，用户的积分已随用户一起写入
+func recordInitialScore(tx *gorm.DB, user *User, note string) error {
+	if user.Score == 0 {
+		return nil
+	}
+	return tx.Create(&ScoreEntry{
+		UserID:    user.ID,
+		Type:      ScoreAdminGrant,
+		Amount:    user.Score,
+		Balance:   user.Score,
+		Note:      note,
+		CreatedAt: time.Now(),
+	}).Error
+}
+
+// GetScoreEntries 按时间倒序分页获取用户的积分流水
+func GetScoreEntries(userID uint, page, pageSize int) ([]ScoreEntry, int64, error) {
+	var total int64
+	if err := DB.Model(&ScoreEntry{}).Where("user_id = ?", userID).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var entries []ScoreEntry
+	err := DB.Where("user_id = ?", userID).Scopes(Paginate(page, pageSize)).
+		Order("id DESC").Find(&entries).Error
+	return entries, total, err
+}
+
+// DeleteScoreEntriesByUserID 删除用户的积分流水，用户被删除时调用
+func DeleteScoreEntriesByUserID(userID uint) error {
+	return DB.Where("user_id = ?", userID).Delete(&ScoreEntry{}).Error
+}
@@ -0,0 +1,186 @@
+package model
+
+import (
+	"AscensionPath/internal/utils"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestScoreLedger(t *testing.T) {
+	forEachDB(t, func(t *testing.T) {
+		alice := createTestUser(t, "alice", 1, "user")
+		env := createTestVulEnv(t, "web", 1000)
+
+		// 初始积分随用户一起记录流水
+		bob := &User{Username: "bob", Password: "x", Email: "bob@example.com", Status: 1, Role: "user", Score: 20}
+		if err := CreateUser(bob); err != nil {
+			t.Fatal(err)
+		}
+		if entries, total, _ := GetScoreEntries(bob.ID, 1, 10); total != 1 || entries[0].Type != ScoreAdminGrant || entries[0].Balance != 20 {
+			t.Errorf("初始积分流水 = %+v", entries)
+		}
+
+		if err := ChangeScore(&ScoreEntry{UserID: alice.ID, Type: ScoreLaunchCost, Amount: -1}); err != utils.ErrInsufficientScore {
+			t.Errorf("余额不足时应扣费失败: %v", err)
+		}
+		if err := ChangeScore(&ScoreEntry{UserID: 999, Type: ScoreAdminGrant, Amount: 1}); err == nil {
+			t.Error("不存在的用户应失败")
+		}
+		grant, err := SetScore(alice.ID, 30, 1, "管理员调整")
+		if err != nil || grant.Amount != 30 || grant.Balance != 30 || grant.OperatorID != 1 {
+			t.Fatalf("SetScore = %+v, %v", grant, err)
+		}
+		if entry, err := SetScore(alice.ID, 30, 1, ""); entry != nil || err != nil {
+			t.Errorf("积分没有变化时不应记录流水: %+v, %v", entry, err)
+		}
+
+		// 并发扣费不会透支
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		var charges []*ScoreEntry
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				entry := &ScoreEntry{UserID: alice.ID, Type: ScoreLaunchCost, Amount: -env.Cost, VulEnvID: env.ID}
+				if err := ChangeScore(entry); err == nil {
+					mu.Lock()
+					charges = append(charges, entry)
+					mu.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+		if got, _ := GetUserByID(alice.ID); len(charges) != 2 || got.Score != 5 {
+			t.Fatalf("并发扣费成功 %d 次，剩余积分 %v", len(charges), got.Score)
+		}
+
+		// 每条扣费只能退还一次
+		refund, err := RefundScore(charges[0].ID, "创建实例失败")
+		if err != nil || refund.Amount != env.Cost || refund.RefID != charges[0].ID || refund.Balance != 17.5 {
+			t.Fatalf("RefundScore = %+v, %v", refund, err)
+		}
+		if _, err := RefundScore(charges[0].ID, ""); err != utils.ErrAlreadyRefunded {
+			t.Errorf("重复退还应失败: %v", err)
+		}
+		if _, err := RefundScore(grant.ID, ""); err == nil {
+			t.Error("只能退还扣费流水")
+		}
+
+		// 解出奖励记录流水
+		if err := CreateSolve(&Solve{UserID: alice.ID, VulEnvID: env.ID, Score: 2.5, SolvedAt: time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+		entries, total, err := GetScoreEntries(alice.ID, 1, 10)
+		if err != nil || total != 5 || entries[0].Type != ScoreSolveReward || entries[0].Balance != 20 {
+			t.Fatalf("积分流水 = %+v, %d, %v", entries, total, err)
+		}
+		// 流水合计与积分一致
+		var sum float64
+		for _, e := range entries {
+			sum += e.Amount
+		}
+		if got, _ := GetUserByID(alice.ID); got.Score != sum {
+			t.Errorf("流水合计 %v 与积分 %v 不一致", sum, got.Score)
+		}
+
+		if err := DeleteScoreEntriesByUserID(alice.ID); err != nil {
+			t.Fatal(err)
+		}
+		if _, total, _ := GetScoreEntries(alice.ID, 1, 10); total != 0 {
+			t.Errorf("删除后仍有 %d 条流水", total)
+		}
+	})
+}
+
+func TestReserveVulInstance(t *testing.T) {
+	forEachDB(t, func(t *testing.T) {
+		alice := createTestUser(t, "alice", 1, "user")
+		bob := createTestUser(t, "bob", 1, "user")
+		env := createTestVulEnv(t, "web", 1000)
+		if _, err := SetScore(alice.ID, 30, 1, ""); err != nil {
+			t.Fatal(err)
+		}
+		charge := func() *ScoreEntry {
+			return &ScoreEntry{UserID: alice.ID, Type: ScoreLaunchCost, Amount: -env.Cost, VulEnvID: env.ID}
+		}
+
+		// 并发开启同一环境只有一个请求扣费并写入实例记录
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		var reserved []*VulInstance
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				instance := &VulInstance{UserID: alice.ID, VulEnvID: env.ID}
+				if err := ReserveVulInstance(instance, charge()); err == nil {
+					mu.Lock()
+					reserved = append(reserved, instance)
+					mu.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+		if got, _ := GetUserByID(alice.ID); len(reserved) != 1 || got.Score != 17.5 {
+			t.Fatalf("并发开启成功 %d 次，剩余积分 %v", len(reserved), got.Score)
+		}
+		if reserved[0].ID == 0 || reserved[0].Status != InstanceStatusNone {
+			t.Errorf("应写入创建中的实例记录: %+v", reserved[0])
+		}
+		// 扣费流水关联实例，开启中断时按实例退还且只退还一次
+		if entries, _, _ := GetScoreEntries(alice.ID, 1, 1); entries[0].Type != ScoreLaunchCost || entries[0].RefID != reserved[0].ID {
+			t.Errorf("扣费流水应关联实例: %+v", entries[0])
+		}
+		if refund, err := RefundLaunchCharge(reserved[0].ID, "开启实例中断"); err != nil || refund.Amount != env.Cost {
+			t.Errorf("RefundLaunchCharge = %+v, %v", refund, err)
+		}
+		if _, err := RefundLaunchCharge(reserved[0].ID, ""); err != utils.ErrAlreadyRefunded {
+			t.Errorf("重复退还应失败: %v", err)
+		}
+		if refund, err := RefundLaunchCharge(999, ""); refund != nil || err != nil {
+			t.Errorf("没有扣费的实例应返回nil: %+v, %v", refund, err)
+		}
+		SetScore(alice.ID, 17.5, 1, "")
+
+		// 创建中和运行中的实例都会阻止再次开启，已停止的不会
+		if err := ReserveVulInstance(&VulInstance{UserID: alice.ID, VulEnvID: env.ID}, charge()); err != utils.ErrInstanceExists {
+			t.Errorf("已有创建中的实例时应失败: %v", err)
+		}
+		reserved[0].Status = InstanceStatusRunning
+		UpdateVulInstance(reserved[0])
+		if err := ReserveVulInstance(&VulInstance{UserID: alice.ID, VulEnvID: env.ID}, nil); err != utils.ErrInstanceExists {
+			t.Errorf("已有运行中的实例时应失败: %v", err)
+		}
+		reserved[0].Status = InstanceStatusStopped
+		UpdateVulInstance(reserved[0])
+		if err := ReserveVulInstance(&VulInstance{UserID: alice.ID, VulEnvID: env.ID}, charge()); err != nil {
+			t.Errorf("旧实例已停止时应可以开启: %v", err)
+		}
+
+		// 余额不足时不写入实例记录
+		if err := ReserveVulInstance(&VulInstance{UserID: bob.ID, VulEnvID: env.ID},
+			&ScoreEntry{UserID: bob.ID, Type: ScoreLaunchCost, Amount: -env.Cost, VulEnvID: env.ID}); err != utils.ErrInsufficientScore {
+			t.Errorf("余额不足时应失败: %v", err)
+		}
+		if _, err := GetVulInstanceBy2ID(bob.ID, env.ID); err == nil {
+			t.Error("扣费失败时不应写入实例记录")
+		}
+
+		// 团队实例按团队检查，个人实例不影响团队实例
+		team := &Team{Name: "red", CreatedBy: alice.ID}
+		if err := CreateTeam(team); err != nil {
+			t.Fatal(err)
+		}
+		if err := ReserveVulInstance(&VulInstance{UserID: alice.ID, TeamID: team.ID, VulEnvID: env.ID}, nil); err != nil {
+			t.Fatalf("开启团队实例失败: %v", err)
+		}
+		if err := ReserveVulInstance(&VulInstance{UserID: bob.ID, TeamID: team.ID, VulEnvID: env.ID}, nil); err != utils.ErrInstanceExists {
+			t.Errorf("团队已有实例时队员开启应失败: %v", err)
+		}
+		if err := ReserveVulInstance(&VulInstance{UserID: bob.ID, TeamID: 999, VulEnvID: env.ID}, nil); err == nil {
+			t.Error("团队不存在时应失败")
+		}
+	})
+}
@@ -0,0 +1,136 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Session 登录会话，访问令牌通过SessionID关联，刷新令牌只保存哈希
+type Session struct {
+	ID               uint       `gorm:"primaryKey;autoIncrement"`
+	SessionID        string     `gorm:"type:varchar(36);uniqueIndex;not null"` // 写入访问令牌的会话ID
+	UserID           uint       `gorm:"not null;index"`
+	RefreshTokenHash string     `gorm:"type:varchar(64);uniqueIndex;not null"` // 当前刷新令牌的SHA-256
+	UserAgent        string     `gorm:"type:varchar(255)"`
+	IP               string     `gorm:"type:varchar(64)"`
+	CreatedAt        time.Time  `gorm:"autoCreateTime"`
+	LastSeenAt       time.Time  `gorm:"index"`
+	ExpiresAt        time.Time  `gorm:"index"` // 刷新令牌过期时间
+	RevokedAt        *time.Time `gorm:"index"`
+}
+
+// RotatedRefreshToken 会话轮换掉的刷新令牌，任何一个被再次使用都视为令牌泄露
+type RotatedRefreshToken struct {
+	Hash      string    `gorm:"type:varchar(64);primaryKey"` // 刷新令牌的SHA-256
+	SessionID uint      `gorm:"not null;index"`              // sessions表的ID
+	RotatedAt time.Time `gorm:"not null"`
+}
+
+// Active 会话是否未注销且未过期
+func (s *Session) Active() bool {
+	return s.RevokedAt == nil && s.ExpiresAt.After(time.Now())
+}
+
+// CreateSession 创建会话
+func CreateSession(session *Session) error {
+	return DB.Create(session).Error
+}
+
+// GetSessionBySessionID 根据会话ID查询会话
+func GetSessionBySessionID(sessionID string) (*Session, error) {
+	var session Session
+	err := DB.Where("session_id = ?", sessionID).First(&session).Error
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// GetSessionByRefreshHash 根据当前刷新令牌哈希查询会话
+func GetSessionByRefreshHash(hash string) (*Session, error) {
+	var session Session
+	err := DB.Where("refresh_token_hash = ?", hash).First(&session).Error
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// GetSessionByRotatedRefreshHash 根据已轮换的刷新令牌哈希查询会话
+func GetSessionByRotatedRefreshHash(hash string) (*Session, error) {
+	var rotated RotatedRefreshToken
+	if err := DB.Where("hash = ?", hash).First(&rotated).Error; err != nil {
+		return nil, err
+	}
+	var session Session
+	if err := DB.First(&session, rotated.SessionID).Error; err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// RotateRefreshToken 轮换刷新令牌并记录旧令牌，只有刷新令牌仍为oldHash时才会更新，返回是否更新成功
+func RotateRefreshToken(id uint, oldHash, newHash string, expiresAt time.Time, ip, userAgent string) (bool, error) {
+	rotated := false
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		result := tx.Model(&Session{}).
+			Where("id = ? AND refresh_token_hash = ? AND revoked_at IS NULL", id, oldHash).
+			Updates(map[string]interface{}{
+				"refresh_token_hash": newHash,
+				"expires_at":         expiresAt,
+				"last_seen_at":       now,
+				"ip":                 ip,
+				"user_agent":         userAgent,
+			})
+		if result.Error != nil || result.RowsAffected != 1 {
+			return result.Error
+		}
+		rotated = true
+		return tx.Create(&RotatedRefreshToken{Hash: oldHash, SessionID: id, RotatedAt: now}).Error
+	})
+	return rotated && err == nil, err
+}
+
+// TouchSession 更新会话最后活动时间
+func TouchSession(id uint, ip string) error {
+	return DB.Model(&Session{}).Where("id = ?", id).
+		Updates(map[string]interface{}{"last_seen_at": time.Now(), "ip": ip}).Error
+}
+
+// GetActiveSessionsByUserID 获取用户未注销且未过期的会话，最近活动的在前
+func GetActiveSessionsByUserID(userID uint) ([]Session, error) {
+	var sessions []Session
+	err := DB.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_seen_at DESC").Find(&sessions).Error
+	return sessions, err
+}
+
+// RevokeSession 注销会话
+func RevokeSession(id uint) error {
+	return DB.Model(&Session{}).Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", time.Now()).Error
+}
+
+// RevokeUserSessions 注销用户的所有会话，exceptSessionID不为空时保留该会话
+func RevokeUserSessions(userID uint, exceptSessionID string) (int64, error) {
+	result := DB.Model(&Session{}).Where("user_id = ? AND revoked_at IS NULL AND session_id <> ?", userID, exceptSessionID).
+		Update("revoked_at", time.Now())
+	return result.RowsAffected, result.Error
+}
+
+// DeleteSessionsBefore 删除在指定时间之前过期或注销的会话及其轮换记录
+func DeleteSessionsBefore(t time.Time) (int64, error) {
+	var count int64
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		expired := tx.Model(&Session{}).Select("id").Where("expires_at < ? OR revoked_at < ?", t, t)
+		if err := tx.Where("session_id IN (?)", expired).Delete(&RotatedRefreshToken{}).Error; err != nil {
+			return err
+		}
+		result := tx.Where("expires_at < ? OR revoked_at < ?", t, t).Delete(&Session{})
+		count = result.RowsAffected
+		return result.Error
+	})
+	return count, err
+}
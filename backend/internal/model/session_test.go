@@ -0,0 +1,103 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSessions(t *testing.T) {
+	forEachDB(t, func(t *testing.T) {
+		now := time.Now()
+		newSession := func(sid, hash string, userID uint) *Session {
+			s := &Session{SessionID: sid, UserID: userID, RefreshTokenHash: hash, LastSeenAt: now, ExpiresAt: now.Add(time.Hour)}
+			if err := CreateSession(s); err != nil {
+				t.Fatalf("CreateSession %s: %v", sid, err)
+			}
+			return s
+		}
+		a := newSession("sid-a", "hash-a", 1)
+		b := newSession("sid-b", "hash-b", 1)
+		c := newSession("sid-c", "hash-c", 2)
+
+		if err := CreateSession(&Session{SessionID: "sid-d", UserID: 1, RefreshTokenHash: "hash-a", ExpiresAt: now.Add(time.Hour)}); err == nil {
+			t.Error("重复的刷新令牌哈希应创建失败")
+		}
+
+		// 轮换后旧令牌不能再次轮换，但可以通过轮换过的任一令牌查到会话
+		ok, err := RotateRefreshToken(a.ID, "hash-a", "hash-a2", now.Add(2*time.Hour), "10.0.0.1", "curl")
+		if err != nil || !ok {
+			t.Fatalf("RotateRefreshToken = %v, %v", ok, err)
+		}
+		if ok, err := RotateRefreshToken(a.ID, "hash-a", "hash-a3", now.Add(2*time.Hour), "", ""); err != nil || ok {
+			t.Errorf("旧令牌再次轮换 = %v, %v", ok, err)
+		}
+		if s, err := GetSessionByRefreshHash("hash-a2"); err != nil || s.ID != a.ID || s.IP != "10.0.0.1" {
+			t.Errorf("GetSessionByRefreshHash = %+v, %v", s, err)
+		}
+		if _, err := GetSessionByRefreshHash("hash-a"); err == nil {
+			t.Error("旧令牌不应再匹配当前刷新令牌")
+		}
+		if ok, err := RotateRefreshToken(a.ID, "hash-a2", "hash-a4", now.Add(2*time.Hour), "", ""); err != nil || !ok {
+			t.Fatalf("再次轮换 = %v, %v", ok, err)
+		}
+		for _, hash := range []string{"hash-a", "hash-a2"} {
+			if s, err := GetSessionByRotatedRefreshHash(hash); err != nil || s.SessionID != "sid-a" {
+				t.Errorf("GetSessionByRotatedRefreshHash(%s) = %+v, %v", hash, s, err)
+			}
+		}
+		if _, err := GetSessionByRotatedRefreshHash("hash-a4"); err == nil {
+			t.Error("当前令牌不应出现在轮换记录中")
+		}
+
+		// 注销后不再出现在有效会话中，也不能轮换
+		if err := RevokeSession(b.ID); err != nil {
+			t.Fatalf("RevokeSession: %v", err)
+		}
+		if s, err := GetSessionBySessionID("sid-b"); err != nil || s.Active() {
+			t.Errorf("注销的会话仍有效: %+v, %v", s, err)
+		}
+		if ok, _ := RotateRefreshToken(b.ID, "hash-b", "hash-b2", now.Add(time.Hour), "", ""); ok {
+			t.Error("注销的会话不应能轮换刷新令牌")
+		}
+		sessions, err := GetActiveSessionsByUserID(1)
+		if err != nil || len(sessions) != 1 || sessions[0].ID != a.ID {
+			t.Errorf("GetActiveSessionsByUserID = %+v, %v", sessions, err)
+		}
+
+		// 保留指定会话
+		newSession("sid-e", "hash-e", 2)
+		if count, err := RevokeUserSessions(2, "sid-c"); err != nil || count != 1 {
+			t.Errorf("RevokeUserSessions = %d, %v", count, err)
+		}
+		if s, _ := GetSessionBySessionID("sid-c"); !s.Active() {
+			t.Error("被排除的会话不应注销")
+		}
+		if count, err := RevokeUserSessions(2, ""); err != nil || count != 1 {
+			t.Errorf("RevokeUserSessions 全部 = %d, %v", count, err)
+		}
+		if err := TouchSession(c.ID, "10.0.0.2"); err != nil {
+			t.Errorf("TouchSession: %v", err)
+		}
+
+		// 只删除保留时长之前过期或注销的会话
+		expired := newSession("sid-f", "hash-f", 3)
+		DB.Model(expired).Update("expires_at", now.Add(-48*time.Hour))
+		if count, err := DeleteSessionsBefore(now.Add(-24 * time.Hour)); err != nil || count != 1 {
+			t.Errorf("DeleteSessionsBefore = %d, %v", count, err)
+		}
+		if count, err := DeleteSessionsBefore(now.Add(time.Minute)); err != nil || count != 3 {
+			t.Errorf("DeleteSessionsBefore 包含注销会话 = %d, %v", count, err)
+		}
+		// 会话a仍有效，轮换记录保留
+		if _, err := GetSessionByRotatedRefreshHash("hash-a"); err != nil {
+			t.Errorf("有效会话的轮换记录不应删除: %v", err)
+		}
+		RevokeSession(a.ID)
+		DeleteSessionsBefore(now.Add(time.Minute))
+		var rotated int64
+		DB.Model(&RotatedRefreshToken{}).Count(&rotated)
+		if rotated != 0 {
+			t.Errorf("删除会话后仍有 %d 条轮换记录", rotated)
+		}
+	})
+}
@@ -0,0 +1,71 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Setting 管理员在运行时修改的配置项，优先于配置文件
+type Setting struct {
+	Key       string    `gorm:"column:name;type:varchar(64);primaryKey"` // key是MySQL保留字
+	Value     string    `gorm:"type:text"`
+	UpdatedBy string    `gorm:"type:varchar(50)"` // 最后修改人
+	UpdatedAt time.Time `gorm:"autoUpdateTime"`
+}
+
+// SettingAudit 配置修改记录
+type SettingAudit struct {
+	ID         uint      `gorm:"primaryKey;autoIncrement"`
+	Key        string    `gorm:"column:name;type:varchar(64);not null;index"`
+	OldValue   string    `gorm:"type:text"`
+	NewValue   string    `gorm:"type:text"`
+	OperatorID uint      `gorm:"index"`
+	Operator   string    `gorm:"type:varchar(50)"`
+	CreatedAt  time.Time `gorm:"autoCreateTime;index"`
+}
+
+// GetAllSettings 获取所有已保存的配置项
+func GetAllSettings() ([]Setting, error) {
+	var settings []Setting
+	err := DB.Order("name").Find(&settings).Error
+	return settings, err
+}
+
+// SaveSettings 在同一事务中保存配置项并写入修改记录
+func SaveSettings(settings []Setting, audits []SettingAudit) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		for i := range settings {
+			err := tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "name"}},
+				DoUpdates: clause.AssignmentColumns([]string{"value", "updated_by", "updated_at"}),
+			}).Create(&settings[i]).Error
+			if err != nil {
+				return err
+			}
+		}
+		if len(audits) == 0 {
+			return nil
+		}
+		return tx.Create(&audits).Error
+	})
+}
+
+// GetSettingAudits 分页获取配置修改记录，key为空时返回全部
+func GetSettingAudits(key string, page, pageSize int) ([]SettingAudit, int64, error) {
+	filter := func(db *gorm.DB) *gorm.DB {
+		if key != "" {
+			return db.Where("name = ?", key)
+		}
+		return db
+	}
+
+	var count int64
+	if err := DB.Model(&SettingAudit{}).Scopes(filter).Count(&count).Error; err != nil {
+		return nil, 0, err
+	}
+	var audits []SettingAudit
+	err := DB.Scopes(filter, Paginate(page, pageSize)).Order("id DESC").Find(&audits).Error
+	return audits, count, err
+}
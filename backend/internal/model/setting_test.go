@@ -0,0 +1,60 @@
+package model
+
+import "testing"
+
+func TestSettings(t *testing.T) {
+	forEachDB(t, func(t *testing.T) {
+		if settings, err := GetAllSettings(); err != nil || len(settings) != 0 {
+			t.Fatalf("空表返回 %d 项, %v", len(settings), err)
+		}
+
+		err := SaveSettings(
+			[]Setting{{Key: "storage.proxy", Value: "http://proxy:8080", UpdatedBy: "admin"}},
+			[]SettingAudit{{Key: "storage.proxy", OldValue: "", NewValue: "http://proxy:8080", OperatorID: 1, Operator: "admin"}},
+		)
+		if err != nil {
+			t.Fatalf("SaveSettings: %v", err)
+		}
+		// 已存在的配置项覆盖更新
+		err = SaveSettings(
+			[]Setting{
+				{Key: "storage.proxy", Value: "", UpdatedBy: "root"},
+				{Key: "registration.open", Value: "false", UpdatedBy: "root"},
+			},
+			[]SettingAudit{
+				{Key: "storage.proxy", OldValue: "http://proxy:8080", NewValue: "", OperatorID: 2, Operator: "root"},
+				{Key: "registration.open", OldValue: "true", NewValue: "false", OperatorID: 2, Operator: "root"},
+			},
+		)
+		if err != nil {
+			t.Fatalf("SaveSettings 更新: %v", err)
+		}
+
+		settings, err := GetAllSettings()
+		if err != nil || len(settings) != 2 {
+			t.Fatalf("GetAllSettings 返回 %d 项, %v", len(settings), err)
+		}
+		if settings[0].Key != "registration.open" || settings[0].Value != "false" {
+			t.Errorf("settings[0] = %+v", settings[0])
+		}
+		if settings[1].Key != "storage.proxy" || settings[1].Value != "" || settings[1].UpdatedBy != "root" {
+			t.Errorf("settings[1] = %+v", settings[1])
+		}
+
+		audits, count, err := GetSettingAudits("", 1, 10)
+		if err != nil || count != 3 || len(audits) != 3 {
+			t.Fatalf("GetSettingAudits 返回 %d/%d 条, %v", len(audits), count, err)
+		}
+		if audits[0].Key != "registration.open" || audits[2].NewValue != "http://proxy:8080" {
+			t.Errorf("修改记录未按时间倒序: %+v", audits)
+		}
+
+		audits, count, err = GetSettingAudits("storage.proxy", 2, 1)
+		if err != nil || count != 2 || len(audits) != 1 {
+			t.Fatalf("按配置项分页返回 %d/%d 条, %v", len(audits), count, err)
+		}
+		if audits[0].Operator != "admin" {
+			t.Errorf("第2页应为最早的修改记录: %+v", audits[0])
+		}
+	})
+}
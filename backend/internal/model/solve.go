@@ -0,0 +1,116 @@
+package model
+
+import (
+	"AscensionPath/internal/utils"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Solve 用户提交正确flag的记录，每个用户每个漏洞环境只记录一次
+type Solve struct {
+	ID         uint      `gorm:"primaryKey;autoIncrement"`
+	UserID     uint      `gorm:"not null;uniqueIndex:idx_solves_user_env"`
+	VulEnvID   uint      `gorm:"not null;uniqueIndex:idx_solves_user_env;index"`
+	TeamID     uint      `gorm:"not null;default:0;index;comment:通过团队实例解出时的团队ID"`
+	InstanceID uint      `gorm:"not null;comment:提交flag的实例ID"`
+	Score      float64   `gorm:"type:decimal(10,2);not null;default:0.00;comment:获得的积分"`
+	SolvedAt   time.Time `gorm:"not null;index"`
+}
+
+// GetVulInstanceByFlag 通过flag查找未删除的实例
+func GetVulInstanceByFlag(flag string) (*VulInstance, error) {
+	var instance VulInstance
+	if err := DB.Where("flag = ?", flag).First(&instance).Error; err != nil {
+		return nil, err
+	}
+	return &instance, nil
+}
+
+// HasSolved 用户是否已解出漏洞环境
+func HasSolved(userID, vulEnvID uint) bool {
+	var count int64
+	DB.Model(&Solve{}).Where("user_id = ? AND vul_env_id = ?", userID, vulEnvID).Count(&count)
+	return count > 0
+}
+
+// CreateSolve 记录解出并为用户发放奖励积分，已解出过时返回 utils.ErrAlreadySolved。
+// 通过团队实例解出时锁定团队，团队已解出过时返回 utils.ErrTeamAlreadySolved，队员同时提交也只发放一次奖励
+func CreateSolve(solve *Solve) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if solve.TeamID != 0 {
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&Team{}, solve.TeamID).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&Solve{}).Where("team_id = ? AND vul_env_id = ?", solve.TeamID, solve.VulEnvID).
+				Count(&count).Error; err != nil {
+				return err
+			}
+			if count > 0 {
+				return utils.ErrTeamAlreadySolved
+			}
+		}
+		if err := tx.Model(&Solve{}).Where("user_id = ? AND vul_env_id = ?", solve.UserID, solve.VulEnvID).
+			Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return utils.ErrAlreadySolved
+		}
+		if err := tx.Create(solve).Error; err != nil {
+			return err
+		}
+		if solve.Score == 0 {
+			return nil
+		}
+		return changeScore(tx, &ScoreEntry{
+			UserID:   solve.UserID,
+			Type:     ScoreSolveReward,
+			Amount:   solve.Score,
+			VulEnvID: solve.VulEnvID,
+			RefID:    solve.ID,
+		})
+	})
+}
+
+// GetSolvesByUserID 按时间获取用户的解出记录
+func GetSolvesByUserID(userID uint) ([]Solve, error) {
+	var solves []Solve
+	err := DB.Where("user_id = ?", userID).Order("solved_at").Find(&solves).Error
+	return solves, err
+}
+
+// SolveFilter 查询解出记录的条件，零值表示不限制
+type SolveFilter struct {
+	TeamID   uint      // 只包括团队当前成员的解出
+	CourseID uint      // 只包括课程学生的解出
+	From     time.Time // 解出时间不早于From
+	To       time.Time // 解出时间早于To
+}
+
+// GetSolves 按解出时间获取符合条件的解出记录
+func GetSolves(filter SolveFilter) ([]Solve, error) {
+	query := DB.Model(&Solve{})
+	if filter.TeamID != 0 {
+		query = query.Where("user_id IN (?)", DB.Model(&TeamMember{}).Select("user_id").Where("team_id = ?", filter.TeamID))
+	}
+	if filter.CourseID != 0 {
+		query = query.Where("user_id IN (?)", DB.Model(&CourseStudent{}).Select("user_id").Where("course_id = ?", filter.CourseID))
+	}
+	if !filter.From.IsZero() {
+		query = query.Where("solved_at >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		query = query.Where("solved_at < ?", filter.To)
+	}
+	var solves []Solve
+	err := query.Order("solved_at, id").Find(&solves).Error
+	return solves, err
+}
+
+// DeleteSolvesByUserID 删除用户的解出记录，用户被删除时调用
+func DeleteSolvesByUserID(userID uint) error {
+	return DB.Where("user_id = ?", userID).Delete(&Solve{}).Error
+}
@@ -0,0 +1,96 @@
+package model
+
+import (
+	"AscensionPath/internal/utils"
+	"testing"
+	"time"
+)
+
+func TestSolves(t *testing.T) {
+	forEachDB(t, func(t *testing.T) {
+		alice := createTestUser(t, "alice", 1, "user")
+		env := createTestVulEnv(t, "web", 1000)
+		instance := &VulInstance{UserID: alice.ID, VulEnvID: env.ID, Status: InstanceStatusRunning, Flag: "flag{abc}"}
+		if err := CreateVulInstance(instance); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := GetVulInstanceByFlag("flag{abc}"); err != nil || got.ID != instance.ID {
+			t.Errorf("GetVulInstanceByFlag = %+v, %v", got, err)
+		}
+		if _, err := GetVulInstanceByFlag("flag{xyz}"); err == nil {
+			t.Error("不存在的flag应查找失败")
+		}
+
+		solve := &Solve{UserID: alice.ID, VulEnvID: env.ID, InstanceID: instance.ID, Score: 7.5, SolvedAt: time.Now()}
+		if err := CreateSolve(solve); err != nil {
+			t.Fatalf("CreateSolve: %v", err)
+		}
+		if err := CreateSolve(&Solve{UserID: alice.ID, VulEnvID: env.ID, Score: 7.5, SolvedAt: time.Now()}); err != utils.ErrAlreadySolved {
+			t.Errorf("重复解出应返回 ErrAlreadySolved: %v", err)
+		}
+		if got, _ := GetUserByID(alice.ID); got.Score != 7.5 {
+			t.Errorf("解出后积分应增加奖励: %v", got.Score)
+		}
+		if !HasSolved(alice.ID, env.ID) {
+			t.Error("HasSolved 结果不正确")
+		}
+
+		// 团队实例每个团队只能解出一次，不依赖调用方事先检查
+		carol := createTestUser(t, "carol", 1, "user")
+		dave := createTestUser(t, "dave", 1, "user")
+		blue := &Team{Name: "blue", CreatedBy: carol.ID}
+		CreateTeam(blue)
+		if err := CreateSolve(&Solve{UserID: carol.ID, VulEnvID: env.ID, TeamID: blue.ID, Score: 5, SolvedAt: time.Now()}); err != nil {
+			t.Fatalf("团队解出: %v", err)
+		}
+		if err := CreateSolve(&Solve{UserID: dave.ID, VulEnvID: env.ID, TeamID: blue.ID, Score: 5, SolvedAt: time.Now()}); err != utils.ErrTeamAlreadySolved {
+			t.Errorf("团队重复解出应返回 ErrTeamAlreadySolved: %v", err)
+		}
+		if got, _ := GetUserByID(dave.ID); got.Score != 0 {
+			t.Errorf("团队重复解出不应发放奖励: %v", got.Score)
+		}
+		DeleteSolvesByUserID(carol.ID)
+
+		// 按团队、课程和时间段筛选
+		bob := createTestUser(t, "bob", 1, "user")
+		CreateSolve(&Solve{UserID: bob.ID, VulEnvID: env.ID, Score: 5, SolvedAt: solve.SolvedAt.Add(time.Hour)})
+		team := &Team{Name: "red", CreatedBy: bob.ID}
+		CreateTeam(team)
+		SetTeamMember(team.ID, bob.ID, TeamRoleCaptain)
+		course := &Course{Name: "Web安全", InstructorID: bob.ID}
+		CreateCourse(course)
+		EnrollStudent(course.ID, alice.ID)
+		if solves, err := GetSolves(SolveFilter{}); err != nil || len(solves) != 2 || solves[0].UserID != alice.ID {
+			t.Errorf("GetSolves = %+v, %v", solves, err)
+		}
+		if solves, _ := GetSolves(SolveFilter{TeamID: team.ID}); len(solves) != 1 || solves[0].UserID != bob.ID {
+			t.Errorf("按团队筛选 = %+v", solves)
+		}
+		if solves, _ := GetSolves(SolveFilter{CourseID: course.ID}); len(solves) != 1 || solves[0].UserID != alice.ID {
+			t.Errorf("按课程筛选 = %+v", solves)
+		}
+		if solves, _ := GetSolves(SolveFilter{From: solve.SolvedAt.Add(time.Minute)}); len(solves) != 1 || solves[0].UserID != bob.ID {
+			t.Errorf("按开始时间筛选 = %+v", solves)
+		}
+		if solves, _ := GetSolves(SolveFilter{To: solve.SolvedAt.Add(time.Minute)}); len(solves) != 1 || solves[0].UserID != alice.ID {
+			t.Errorf("按结束时间筛选 = %+v", solves)
+		}
+		if names, err := GetUsernames([]uint{alice.ID, bob.ID, 999}); err != nil || len(names) != 2 || names[bob.ID] != "bob" {
+			t.Errorf("GetUsernames = %v, %v", names, err)
+		}
+
+		// 删除实例后flag失效
+		if err := DeleteVulInstance(instance.ID); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := GetVulInstanceByFlag("flag{abc}"); err == nil {
+			t.Error("已删除实例的flag应失效")
+		}
+		if err := DeleteSolvesByUserID(alice.ID); err != nil {
+			t.Fatal(err)
+		}
+		if solves, _ := GetSolvesByUserID(alice.ID); len(solves) != 0 {
+			t.Errorf("删除后仍有解出记录: %+v", solves)
+		}
+	})
+}
@@ -0,0 +1,147 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 团队内的角色
+const (
+	TeamRoleCaptain = "captain" // 队长，可以添加和移除队员
+	TeamRoleMember  = "member"  // 队员
+)
+
+// Team 共享实例的团队，队员都可以查看、延长和停止团队实例
+type Team struct {
+	ID          uint      `gorm:"primaryKey;autoIncrement"`
+	Name        string    `gorm:"type:varchar(50);uniqueIndex;not null"`
+	Description string    `gorm:"type:varchar(255)"`
+	CreatedBy   uint      `gorm:"not null"`
+	CreatedAt   time.Time `gorm:"autoCreateTime"`
+	UpdatedAt   time.Time `gorm:"autoUpdateTime"`
+}
+
+// TeamMember 团队成员，一个用户可以加入多个团队
+type TeamMember struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement"`
+	TeamID    uint      `gorm:"not null;uniqueIndex:idx_team_members_team_user"`
+	UserID    uint      `gorm:"not null;uniqueIndex:idx_team_members_team_user;index"`
+	User      User      `gorm:"foreignKey:UserID"`
+	Role      string    `gorm:"type:varchar(20);not null"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+}
+
+// CreateTeam 创建团队
+func CreateTeam(team *Team) error {
+	return DB.Create(team).Error
+}
+
+// GetTeam 通过ID获取团队
+func GetTeam(id uint) (*Team, error) {
+	var team Team
+	if err := DB.First(&team, id).Error; err != nil {
+		return nil, err
+	}
+	return &team, nil
+}
+
+// GetTeamByName 通过名称获取团队
+func GetTeamByName(name string) (*Team, error) {
+	var team Team
+	if err := DB.Where("name = ?", name).First(&team).Error; err != nil {
+		return nil, err
+	}
+	return &team, nil
+}
+
+// GetTeams 按ID获取所有团队
+func GetTeams() ([]Team, error) {
+	var teams []Team
+	err := DB.Order("id").Find(&teams).Error
+	return teams, err
+}
+
+// GetTeamsByUserID 获取用户加入的团队
+func GetTeamsByUserID(userID uint) ([]Team, error) {
+	var teams []Team
+	err := DB.Where("id IN (?)", DB.Model(&TeamMember{}).Select("team_id").Where("user_id = ?", userID)).
+		Order("id").Find(&teams).Error
+	return teams, err
+}
+
+// UpdateTeam 修改团队名称和说明
+func UpdateTeam(id uint, name, description string) error {
+	result := DB.Model(&Team{}).Where("id = ?", id).
+		Updates(map[string]interface{}{"name": name, "description": description})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// DeleteTeam 删除团队及其成员
+func DeleteTeam(id uint) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("team_id = ?", id).Delete(&TeamMember{}).Error; err != nil {
+			return err
+		}
+		result := tx.Delete(&Team{}, id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+}
+
+// GetTeamMembers 获取团队成员及其用户信息，队长在前
+func GetTeamMembers(teamID uint) ([]TeamMember, error) {
+	var members []TeamMember
+	err := DB.Preload("User").Where("team_id = ?", teamID).
+		Order("CASE WHEN role = 'captain' THEN 0 ELSE 1 END, id").Find(&members).Error
+	return members, err
+}
+
+// GetTeamMember 获取用户在团队中的成员记录，不是成员时返回 gorm.ErrRecordNotFound
+func GetTeamMember(teamID, userID uint) (*TeamMember, error) {
+	var member TeamMember
+	if err := DB.Where("team_id = ? AND user_id = ?", teamID, userID).First(&member).Error; err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+// SetTeamMember 添加成员，已是成员时修改其角色
+func SetTeamMember(teamID, userID uint, role string) error {
+	member, err := GetTeamMember(teamID, userID)
+	if err == gorm.ErrRecordNotFound {
+		return DB.Create(&TeamMember{TeamID: teamID, UserID: userID, Role: role}).Error
+	}
+	if err != nil {
+		return err
+	}
+	return DB.Model(member).Update("role", role).Error
+}
+
+// RemoveTeamMember 移除团队成员
+func RemoveTeamMember(teamID, userID uint) error {
+	result := DB.Where("team_id = ? AND user_id = ?", teamID, userID).Delete(&TeamMember{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// DeleteTeamMembersByUserID 删除用户的所有团队成员记录，用户被删除时调用
+func DeleteTeamMembersByUserID(userID uint) error {
+	return DB.Where("user_id = ?", userID).Delete(&TeamMember{}).Error
+}
@@ -0,0 +1,131 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTeams(t *testing.T) {
+	forEachDB(t, func(t *testing.T) {
+		alice := createTestUser(t, "alice", 1, "user")
+		bob := createTestUser(t, "bob", 1, "user")
+
+		red := &Team{Name: "red", Description: "红队", CreatedBy: alice.ID}
+		if err := CreateTeam(red); err != nil {
+			t.Fatalf("CreateTeam: %v", err)
+		}
+		blue := &Team{Name: "blue", CreatedBy: alice.ID}
+		if err := CreateTeam(blue); err != nil {
+			t.Fatal(err)
+		}
+		if err := CreateTeam(&Team{Name: "red"}); err == nil {
+			t.Error("重复的团队名称应创建失败")
+		}
+
+		if err := SetTeamMember(red.ID, bob.ID, TeamRoleMember); err != nil {
+			t.Fatalf("SetTeamMember: %v", err)
+		}
+		if err := SetTeamMember(red.ID, alice.ID, TeamRoleCaptain); err != nil {
+			t.Fatal(err)
+		}
+		SetTeamMember(blue.ID, bob.ID, TeamRoleCaptain)
+		// 已是成员时修改角色
+		if err := SetTeamMember(blue.ID, bob.ID, TeamRoleMember); err != nil {
+			t.Fatal(err)
+		}
+		if member, err := GetTeamMember(blue.ID, bob.ID); err != nil || member.Role != TeamRoleMember {
+			t.Errorf("GetTeamMember = %+v, %v", member, err)
+		}
+		members, err := GetTeamMembers(red.ID)
+		if err != nil || len(members) != 2 || members[0].UserID != alice.ID || members[1].User.Username != "bob" {
+			t.Errorf("GetTeamMembers 应队长在前并加载用户: %+v, %v", members, err)
+		}
+		if teams, err := GetTeamsByUserID(bob.ID); err != nil || len(teams) != 2 {
+			t.Errorf("GetTeamsByUserID = %+v, %v", teams, err)
+		}
+		if teams, err := GetTeamsByUserID(alice.ID); err != nil || len(teams) != 1 || teams[0].Name != "red" {
+			t.Errorf("GetTeamsByUserID = %+v, %v", teams, err)
+		}
+
+		if err := UpdateTeam(blue.ID, "green", "绿队"); err != nil {
+			t.Fatalf("UpdateTeam: %v", err)
+		}
+		if team, err := GetTeamByName("green"); err != nil || team.ID != blue.ID || team.Description != "绿队" {
+			t.Errorf("GetTeamByName = %+v, %v", team, err)
+		}
+		if err := UpdateTeam(999, "x", ""); err == nil {
+			t.Error("修改不存在的团队应返回错误")
+		}
+
+		if err := RemoveTeamMember(red.ID, bob.ID); err != nil {
+			t.Fatalf("RemoveTeamMember: %v", err)
+		}
+		if err := RemoveTeamMember(red.ID, bob.ID); err == nil {
+			t.Error("移除不存在的成员应返回错误")
+		}
+		if err := DeleteTeamMembersByUserID(bob.ID); err != nil {
+			t.Fatal(err)
+		}
+		if teams, _ := GetTeamsByUserID(bob.ID); len(teams) != 0 {
+			t.Errorf("删除用户的成员记录后仍有团队: %+v", teams)
+		}
+
+		if err := DeleteTeam(red.ID); err != nil {
+			t.Fatalf("DeleteTeam: %v", err)
+		}
+		if _, err := GetTeamMember(red.ID, alice.ID); err == nil {
+			t.Error("删除团队后成员记录应被删除")
+		}
+		if err := DeleteTeam(red.ID); err == nil {
+			t.Error("删除不存在的团队应返回错误")
+		}
+		if teams, err := GetTeams(); err != nil || len(teams) != 1 {
+			t.Errorf("GetTeams = %+v, %v", teams, err)
+		}
+	})
+}
+
+func TestTeamVulInstances(t *testing.T) {
+	forEachDB(t, func(t *testing.T) {
+		alice := createTestUser(t, "alice", 1, "user")
+		env := &VulEnv{EnvName: "web", EnvType: "image", BaseImage: "nginx"}
+		if err := DB.Create(env).Error; err != nil {
+			t.Fatal(err)
+		}
+		now := time.Now()
+		personal := &VulInstance{UserID: alice.ID, VulEnvID: env.ID, Status: 1, StartTime: now, ExpireTime: now.Add(time.Hour)}
+		shared := &VulInstance{UserID: alice.ID, TeamID: 7, VulEnvID: env.ID, Status: 1, StartTime: now, ExpireTime: now.Add(time.Hour)}
+		if err := CreateVulInstance(personal); err != nil {
+			t.Fatal(err)
+		}
+		if err := CreateVulInstance(shared); err != nil {
+			t.Fatal(err)
+		}
+
+		// 个人实例的查询不包括团队实例
+		if instances, err := GetVulInstanceByUserID(alice.ID); err != nil || len(instances) != 1 || instances[0].ID != personal.ID {
+			t.Errorf("GetVulInstanceByUserID = %+v, %v", instances, err)
+		}
+		if got, err := GetVulInstanceBy2ID(alice.ID, env.ID); err != nil || got.ID != personal.ID {
+			t.Errorf("GetVulInstanceBy2ID = %+v, %v", got, err)
+		}
+		if got, err := GetTeamVulInstance(7, env.ID); err != nil || got.ID != shared.ID {
+			t.Errorf("GetTeamVulInstance = %+v, %v", got, err)
+		}
+		if instances, err := GetVulInstancesByTeamIDs([]uint{7, 8}); err != nil || len(instances) != 1 || instances[0].VulEnv.EnvName != "web" {
+			t.Errorf("GetVulInstancesByTeamIDs = %+v, %v", instances, err)
+		}
+		if instances, err := GetVulInstancesByTeamIDs(nil); err != nil || len(instances) != 0 {
+			t.Errorf("没有团队时应返回空列表: %+v, %v", instances, err)
+		}
+		if count, err := CountVulInstancesByTeamID(7); err != nil || count != 1 {
+			t.Errorf("CountVulInstancesByTeamID = %d, %v", count, err)
+		}
+		if err := DeleteVulInstanceBy2ID(alice.ID, env.ID); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := GetTeamVulInstance(7, env.ID); err != nil {
+			t.Error("删除个人实例不应影响团队实例")
+		}
+	})
+}
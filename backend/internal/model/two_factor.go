@@ -0,0 +1,125 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// UserTwoFactor 用户的TOTP两步验证配置，Enabled为false时表示正在绑定中
+type UserTwoFactor struct {
+	UserID       uint   `gorm:"primaryKey;autoIncrement:false"`
+	Secret       string `gorm:"type:varchar(64);not null"` // Base32编码的TOTP密钥
+	Enabled      bool   `gorm:"not null"`
+	LastUsedStep int64  `gorm:"not null"` // 最近一次使用的时间步，同一验证码不能重复使用
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+// RecoveryCode 两步验证恢复码，只保存哈希，每个只能使用一次
+type RecoveryCode struct {
+	ID        uint   `gorm:"primaryKey;autoIncrement"`
+	UserID    uint   `gorm:"not null;index"`
+	CodeHash  string `gorm:"type:varchar(64);not null;index"`
+	UsedAt    *time.Time
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+}
+
+// GetTwoFactor 获取用户的两步验证配置，不存在时返回gorm.ErrRecordNotFound
+func GetTwoFactor(userID uint) (*UserTwoFactor, error) {
+	var tf UserTwoFactor
+	if err := DB.Where("user_id = ?", userID).First(&tf).Error; err != nil {
+		return nil, err
+	}
+	return &tf, nil
+}
+
+// IsTwoFactorEnabled 用户是否已启用两步验证
+func IsTwoFactorEnabled(userID uint) (bool, error) {
+	var count int64
+	err := DB.Model(&UserTwoFactor{}).Where("user_id = ? AND enabled = ?", userID, true).Count(&count).Error
+	return count > 0, err
+}
+
+// SaveTwoFactorSecret 保存待确认的密钥，替换未确认的旧密钥；已启用时主键冲突返回错误
+func SaveTwoFactorSecret(userID uint, secret string) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ? AND enabled = ?", userID, false).Delete(&UserTwoFactor{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&UserTwoFactor{UserID: userID, Secret: secret}).Error
+	})
+}
+
+// EnableTwoFactor 启用两步验证并替换恢复码
+func EnableTwoFactor(userID uint, step int64, codeHashes []string) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&UserTwoFactor{}).Where("user_id = ? AND enabled = ?", userID, false).
+			Updates(map[string]interface{}{"enabled": true, "last_used_step": step})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return replaceRecoveryCodes(tx, userID, codeHashes)
+	})
+}
+
+// UseTOTPStep 记录已使用的时间步，时间步不大于上次使用的值时返回false
+func UseTOTPStep(userID uint, step int64) (bool, error) {
+	result := DB.Model(&UserTwoFactor{}).
+		Where("user_id = ? AND enabled = ? AND last_used_step < ?", userID, true, step).
+		Update("last_used_step", step)
+	return result.RowsAffected == 1, result.Error
+}
+
+// UseRecoveryCode 使用恢复码，不存在或已使用时返回false
+func UseRecoveryCode(userID uint, codeHash string) (bool, error) {
+	result := DB.Model(&RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, codeHash).
+		Update("used_at", time.Now())
+	return result.RowsAffected == 1, result.Error
+}
+
+// ReplaceRecoveryCodes 删除旧的恢复码并保存新的恢复码
+func ReplaceRecoveryCodes(userID uint, codeHashes []string) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		return replaceRecoveryCodes(tx, userID, codeHashes)
+	})
+}
+
+func replaceRecoveryCodes(tx *gorm.DB, userID uint, codeHashes []string) error {
+	if err := tx.Where("user_id = ?", userID).Delete(&RecoveryCode{}).Error; err != nil {
+		return err
+	}
+	codes := make([]RecoveryCode, 0, len(codeHashes))
+	for _, hash := range codeHashes {
+		codes = append(codes, RecoveryCode{UserID: userID, CodeHash: hash})
+	}
+	if len(codes) == 0 {
+		return nil
+	}
+	return tx.Create(&codes).Error
+}
+
+// CountRecoveryCodes 统计未使用的恢复码数量
+func CountRecoveryCodes(userID uint) (int64, error) {
+	var count int64
+	err := DB.Model(&RecoveryCode{}).Where("user_id = ? AND used_at IS NULL", userID).Count(&count).Error
+	return count, err
+}
+
+// DeleteTwoFactor 关闭两步验证，删除密钥和恢复码
+func DeleteTwoFactor(userID uint) (bool, error) {
+	var deleted bool
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		result := tx.Where("user_id = ?", userID).Delete(&UserTwoFactor{})
+		deleted = result.RowsAffected > 0
+		return result.Error
+	})
+	return deleted, err
+}
@@ -0,0 +1,77 @@
+package model
+
+import "testing"
+
+func TestTwoFactor(t *testing.T) {
+	forEachDB(t, func(t *testing.T) {
+		if enabled, err := IsTwoFactorEnabled(1); err != nil || enabled {
+			t.Fatalf("未绑定时 IsTwoFactorEnabled = %v, %v", enabled, err)
+		}
+
+		// 未确认的密钥可以被替换
+		if err := SaveTwoFactorSecret(1, "SECRETA"); err != nil {
+			t.Fatalf("SaveTwoFactorSecret: %v", err)
+		}
+		if err := SaveTwoFactorSecret(1, "SECRETB"); err != nil {
+			t.Fatalf("替换未确认的密钥: %v", err)
+		}
+		if tf, err := GetTwoFactor(1); err != nil || tf.Secret != "SECRETB" || tf.Enabled {
+			t.Fatalf("GetTwoFactor = %+v, %v", tf, err)
+		}
+		// 未启用时不能使用验证码
+		if ok, _ := UseTOTPStep(1, 100); ok {
+			t.Error("未启用时不应接受验证码")
+		}
+
+		if err := EnableTwoFactor(1, 100, []string{"h1", "h2", "h3"}); err != nil {
+			t.Fatalf("EnableTwoFactor: %v", err)
+		}
+		if err := EnableTwoFactor(1, 100, nil); err == nil {
+			t.Error("重复启用应失败")
+		}
+		if err := SaveTwoFactorSecret(1, "SECRETC"); err == nil {
+			t.Error("已启用时不应覆盖密钥")
+		}
+		if tf, _ := GetTwoFactor(1); tf.Secret != "SECRETB" || !tf.Enabled {
+			t.Errorf("启用后的配置 = %+v", tf)
+		}
+
+		// 同一时间步只能使用一次
+		if ok, err := UseTOTPStep(1, 100); err != nil || ok {
+			t.Errorf("启用时使用的时间步不应再次通过: %v, %v", ok, err)
+		}
+		if ok, err := UseTOTPStep(1, 101); err != nil || !ok {
+			t.Errorf("UseTOTPStep(101) = %v, %v", ok, err)
+		}
+
+		if ok, err := UseRecoveryCode(1, "h2"); err != nil || !ok {
+			t.Errorf("UseRecoveryCode = %v, %v", ok, err)
+		}
+		if ok, _ := UseRecoveryCode(1, "h2"); ok {
+			t.Error("恢复码不应重复使用")
+		}
+		if ok, _ := UseRecoveryCode(2, "h1"); ok {
+			t.Error("不应使用其他用户的恢复码")
+		}
+		if count, err := CountRecoveryCodes(1); err != nil || count != 2 {
+			t.Errorf("CountRecoveryCodes = %d, %v", count, err)
+		}
+
+		if err := ReplaceRecoveryCodes(1, []string{"n1"}); err != nil {
+			t.Fatalf("ReplaceRecoveryCodes: %v", err)
+		}
+		if ok, _ := UseRecoveryCode(1, "h1"); ok {
+			t.Error("旧恢复码应失效")
+		}
+
+		if deleted, err := DeleteTwoFactor(1); err != nil || !deleted {
+			t.Errorf("DeleteTwoFactor = %v, %v", deleted, err)
+		}
+		if count, _ := CountRecoveryCodes(1); count != 0 {
+			t.Errorf("关闭后仍有 %d 个恢复码", count)
+		}
+		if deleted, _ := DeleteTwoFactor(1); deleted {
+			t.Error("重复关闭应返回false")
+		}
+	})
+}
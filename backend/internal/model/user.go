@@ -12,17 +12,24 @@ type User struct {
 	Username  string    `gorm:"type:varchar(50);uniqueIndex;not null"`
 	Password  string    `gorm:"type:varchar(100);not null"` // 存储加密后的密码
 	Email     string    `gorm:"type:varchar(100);uniqueIndex"`
-	Status    int       `gorm:"type:tinyint(1);default:0"`       // 状态(0:禁用 1:正常)
-	Score     float64   `gorm:"type:int;default:0"`              // 新增分数字段
+	Status    int       `gorm:"type:smallint;default:0"`         // 状态(0:禁用 1:正常)
+	Score     float64   `gorm:"default:0"`                       // 新增分数字段
 	Role      string    `gorm:"type:varchar(20);default:'user'"` // 新增身份字段
 	LastLogin time.Time `gorm:"default:null"`                    // 最后登录时间
 	CreatedAt time.Time `gorm:"autoCreateTime"`                  // 创建时间
 	UpdatedAt time.Time `gorm:"autoUpdateTime"`                  // 更新时间
+
+	MustChangePassword bool `gorm:"default:false"` // 下次登录后必须修改密码
 }
 
-// CreateUser 创建用户
+// CreateUser 创建用户，有初始积分时同时记录积分流水
 func CreateUser(user *User) error {
-	return DB.Create(user).Error
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+		return recordInitialScore(tx, user, "初始积分")
+	})
 }
 
 // GetUserByID 通过ID获取用户
@@ -35,6 +42,22 @@ func GetUserByID(id uint) (*User, error) {
 	return &user, nil
 }
 
+// GetUsernames 获取用户ID到用户名的映射，不存在的用户被忽略
+func GetUsernames(ids []uint) (map[uint]string, error) {
+	names := make(map[uint]string, len(ids))
+	if len(ids) == 0 {
+		return names, nil
+	}
+	var users []User
+	if err := DB.Select("id", "username").Where("id IN ?", ids).Find(&users).Error; err != nil {
+		return nil, err
+	}
+	for _, user := range users {
+		names[user.ID] = user.Username
+	}
+	return names, nil
+}
+
 // GetUserByUsername 通过用户名获取用户
 func GetUserByUsername(username string) (*User, error) {
 	var user User
@@ -45,6 +68,16 @@ func GetUserByUsername(username string) (*User, error) {
 	return &user, nil
 }
 
+// GetUserByEmail 通过邮箱获取用户
+func GetUserByEmail(email string) (*User, error) {
+	var user User
+	result := DB.Where("email = ?", email).First(&user)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return &user, nil
+}
+
 // UpdateUser 更新用户信息（指定字段）
 func UpdateUser(id uint, updates map[string]interface{}) error {
 	return DB.Model(&User{}).
@@ -57,13 +90,6 @@ func DeleteUser(id uint) error {
 	return DB.Delete(&User{}, id).Error
 }
 
-// UpdateUserScore 更新用户积分
-func UpdateUserScore(id uint, score float64) error {
-	return DB.Model(&User{}).
-		Where("id =?", id).
-		Update("score", score).Error
-}
-
 // UpdatePassword 更新密码
 func UpdatePassword(id uint, newPassword string) error {
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
@@ -119,6 +145,13 @@ func GetUserCount() (int64, error) {
 	return count, err
 }
 
+// CountUsersByRole 统计指定身份的用户数量
+func CountUsersByRole(role string) (int64, error) {
+	var count int64
+	err := DB.Model(&User{}).Where("role = ?", role).Count(&count).Error
+	return count, err
+}
+
 // SearchUsers 搜索用户
 func SearchUsers(username, email string, status int, role string, page, pageSize int) ([]User, error) {
 	var users []User
@@ -0,0 +1,181 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+func createTestUser(t *testing.T, username string, status int, role string) *User {
+	t.Helper()
+	user := &User{
+		Username: username,
+		Password: "hashed",
+		Email:    username + "@example.com",
+		Status:   status,
+		Role:     role,
+	}
+	if err := CreateUser(user); err != nil {
+		t.Fatalf("创建用户 %s 失败: %v", username, err)
+	}
+	return user
+}
+
+func TestUserCRUD(t *testing.T) {
+	forEachDB(t, func(t *testing.T) {
+		user := createTestUser(t, "alice", 1, "user")
+		if user.ID == 0 || user.CreatedAt.IsZero() {
+			t.Fatalf("创建后未回填ID或创建时间: %+v", user)
+		}
+
+		got, err := GetUserByID(user.ID)
+		if err != nil {
+			t.Fatalf("GetUserByID: %v", err)
+		}
+		if got.Username != "alice" || got.Email != "alice@example.com" || got.Role != "user" || got.Status != 1 {
+			t.Errorf("GetUserByID 返回 %+v", got)
+		}
+		if got, err := GetUserByUsername("alice"); err != nil || got.ID != user.ID {
+			t.Errorf("GetUserByUsername 返回 %+v, %v", got, err)
+		}
+		if _, err := GetUserByUsername("nobody"); !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Errorf("查询不存在的用户返回 %v", err)
+		}
+
+		// 用户名唯一
+		dup := &User{Username: "alice", Password: "x", Email: "other@example.com"}
+		if err := CreateUser(dup); err == nil {
+			t.Error("重复用户名应创建失败")
+		}
+
+		if err := UpdateUser(user.ID, map[string]interface{}{"email": "alice@new.com", "status": 0}); err != nil {
+			t.Fatalf("UpdateUser: %v", err)
+		}
+		if _, err := SetScore(user.ID, 42, 0, ""); err != nil {
+			t.Fatalf("SetScore: %v", err)
+		}
+		if err := UpdateUserRole(user.ID, "admin"); err != nil {
+			t.Fatalf("UpdateUserRole: %v", err)
+		}
+		if err := UpdatePassword(user.ID, "n3w-pass"); err != nil {
+			t.Fatalf("UpdatePassword: %v", err)
+		}
+		got, err = GetUserByID(user.ID)
+		if err != nil {
+			t.Fatalf("GetUserByID: %v", err)
+		}
+		if got.Email != "alice@new.com" || got.Status != 0 || got.Score != 42 || got.Role != "admin" {
+			t.Errorf("更新后用户为 %+v", got)
+		}
+		if bcrypt.CompareHashAndPassword([]byte(got.Password), []byte("n3w-pass")) != nil {
+			t.Error("UpdatePassword 未保存加密后的新密码")
+		}
+		if got.MustChangePassword {
+			t.Error("MustChangePassword 默认应为false")
+		}
+		if err := UpdateUser(user.ID, map[string]interface{}{"must_change_password": true}); err != nil {
+			t.Fatalf("UpdateUser: %v", err)
+		}
+		if got, err := GetUserByID(user.ID); err != nil || !got.MustChangePassword {
+			t.Errorf("MustChangePassword 未更新: %+v, %v", got, err)
+		}
+
+		if err := DeleteUser(user.ID); err != nil {
+			t.Fatalf("DeleteUser: %v", err)
+		}
+		if _, err := GetUserByID(user.ID); !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Errorf("删除后查询返回 %v", err)
+		}
+	})
+}
+
+func TestUserExists(t *testing.T) {
+	forEachDB(t, func(t *testing.T) {
+		createTestUser(t, "bob", 1, "user")
+
+		cases := []struct {
+			username, email string
+			want            bool
+		}{
+			{"bob", "none@example.com", true},
+			{"none", "bob@example.com", true},
+			{"none", "none@example.com", false},
+		}
+		for _, c := range cases {
+			got, err := UserExists(c.username, c.email)
+			if err != nil {
+				t.Fatalf("UserExists: %v", err)
+			}
+			if got != c.want {
+				t.Errorf("UserExists(%s, %s) = %v, 期望 %v", c.username, c.email, got, c.want)
+			}
+		}
+	})
+}
+
+func TestUserListAndSearch(t *testing.T) {
+	forEachDB(t, func(t *testing.T) {
+		for i := 0; i < 12; i++ {
+			role := "user"
+			if i%4 == 0 {
+				role = "admin"
+			}
+			createTestUser(t, fmt.Sprintf("user%02d", i), i%2, role)
+		}
+
+		count, err := GetUserCount()
+		if err != nil || count != 12 {
+			t.Fatalf("GetUserCount = %d, %v", count, err)
+		}
+		if admins, err := CountUsersByRole("admin"); err != nil || admins != 3 {
+			t.Errorf("CountUsersByRole = %d, %v", admins, err)
+		}
+
+		page1, err := GetAllUsers(1, 10)
+		if err != nil || len(page1) != 10 {
+			t.Fatalf("GetAllUsers 第1页 %d 条, %v", len(page1), err)
+		}
+		page2, err := GetAllUsers(2, 10)
+		if err != nil || len(page2) != 2 {
+			t.Fatalf("GetAllUsers 第2页 %d 条, %v", len(page2), err)
+		}
+		// 非法分页参数使用默认值
+		if users, err := GetAllUsers(0, 0); err != nil || len(users) != 10 {
+			t.Errorf("GetAllUsers(0, 0) 返回 %d 条, %v", len(users), err)
+		}
+
+		cases := []struct {
+			name            string
+			username, email string
+			status          int
+			role            string
+			want            int
+		}{
+			{"全部", "", "", -1, "", 12},
+			{"用户名", "user0", "", -1, "", 10},
+			{"邮箱", "", "user11@", -1, "", 1},
+			{"状态", "", "", 1, "", 6},
+			{"身份", "", "", -1, "admin", 3},
+			{"组合", "user", "", 0, "admin", 3},
+		}
+		for _, c := range cases {
+			users, err := SearchUsers(c.username, c.email, c.status, c.role, 1, 100)
+			if err != nil {
+				t.Fatalf("%s: SearchUsers: %v", c.name, err)
+			}
+			if len(users) != c.want {
+				t.Errorf("%s: SearchUsers 返回 %d 条, 期望 %d", c.name, len(users), c.want)
+			}
+			count, err := SearchUsersCount(c.username, c.email, c.status, c.role)
+			if err != nil {
+				t.Fatalf("%s: SearchUsersCount: %v", c.name, err)
+			}
+			if count != int64(c.want) {
+				t.Errorf("%s: SearchUsersCount = %d, 期望 %d", c.name, count, c.want)
+			}
+		}
+	})
+}
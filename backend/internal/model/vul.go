@@ -1,6 +1,8 @@
 package model
 
 import (
+	"AscensionPath/internal/utils"
+	"errors"
 	"time"
 
 	"gorm.io/gorm"
@@ -16,26 +18,39 @@ type VulEnv struct {
 	BaseCompose string    `gorm:"type:varchar(255);comment:docker-compose文件路径"`
 	Rank        float64   `gorm:"type:decimal(3,1);default:3.5;comment:环境评分"`
 	From        string    `gorm:"type:varchar(100);comment:来源"`
-	CreateTime  time.Time `gorm:"type:TIMESTAMP;default:CURRENT_TIMESTAMP;comment:创建时间"`
-	UpdateTime  time.Time `gorm:"type:TIMESTAMP;default:CURRENT_TIMESTAMP;comment:更新时间"`
-	Degree      string    `gorm:"type:json;comment:环境信息"`
+	CreateTime  time.Time `gorm:"default:CURRENT_TIMESTAMP;comment:创建时间"`
+	UpdateTime  time.Time `gorm:"default:CURRENT_TIMESTAMP;comment:更新时间"`
+	Degree      string    `gorm:"type:text;comment:环境信息(JSON)"`
 	IsOpen      int       `gorm:"type:int;default:1000;comment:开放级别"`
 	Cost        float64   `gorm:"type:decimal(10,2);default:0.00;comment:开启环境的成本"`
+	Reward      float64   `gorm:"type:decimal(10,2);default:0.00;comment:解出环境的奖励"`
 }
 
-// VulInstance 用户开启的漏洞环境记录
+// 实例状态
+const (
+	InstanceStatusNone     = 0 // 未创建
+	InstanceStatusRunning  = 1 // 运行中
+	InstanceStatusStopped  = 2 // 已停止
+	InstanceStatusFinished = 3 // 已完成
+	InstanceStatusFailed   = 4 // 异常(容器已丢失)
+)
+
+// VulInstance 用户开启的漏洞环境记录，TeamID不为0时是团队实例，UserID为开启实例的队员
 type VulInstance struct {
 	gorm.Model
 	VulEnv      VulEnv    `gorm:"foreignKey:VulEnvID"`
 	UserID      uint      `gorm:"not null;index;comment:用户ID"`
+	TeamID      uint      `gorm:"not null;default:0;index;comment:团队ID(0为个人实例)"`
 	VulEnvID    uint      `gorm:"not null;index;comment:漏洞环境ID"`
-	StartTime   time.Time `gorm:"type:datetime;default:CURRENT_TIMESTAMP;comment:开启时间"`
-	EndTime     time.Time `gorm:"type:datetime;comment:结束时间"`
-	Status      int       `gorm:"type:tinyint;default:0;comment:状态(0/未创建/1运行中/2已停止/3已完成)"`
+	StartTime   time.Time `gorm:"default:CURRENT_TIMESTAMP;comment:开启时间"`
+	EndTime     time.Time `gorm:"comment:结束时间"`
+	Status      int       `gorm:"type:smallint;default:0;comment:状态(0/未创建/1运行中/2已停止/3已完成/4异常)"`
 	StackName   string    `gorm:"type:varchar(100);comment:Docker Stack名称"`
 	ContainerID string    `gorm:"type:varchar(64);comment:容器ID"`
-	Ports       string    `gorm:"type:json;comment:端口映射"`
-	ExpireTime  time.Time `gorm:"type:datetime;comment:过期时间"`
+	Ports       string    `gorm:"type:text;comment:端口映射(JSON)"`
+	ExpireTime  time.Time `gorm:"comment:过期时间"`
+	ExtendCount int       `gorm:"default:0;comment:已延长次数"`
+	Flag        string    `gorm:"type:varchar(128);index;comment:实例flag"`
 }
 
 // VulEnv CRUD 操作
@@ -108,12 +123,40 @@ func GetVulInstanceByID(id uint) (*VulInstance, error) {
 	return &userVul, nil
 }
 
+// GetVulInstanceByUserID 获取用户的个人实例，不包括团队实例
 func GetVulInstanceByUserID(userID uint) ([]VulInstance, error) {
 	var userVuls []VulInstance
-	err := DB.Where("user_id = ?", userID).Find(&userVuls).Error
+	err := DB.Where("user_id = ? AND team_id = 0", userID).Find(&userVuls).Error
 	return userVuls, err
 }
 
+// GetVulInstancesByTeamIDs 获取多个团队的实例
+func GetVulInstancesByTeamIDs(teamIDs []uint) ([]VulInstance, error) {
+	var instances []VulInstance
+	if len(teamIDs) == 0 {
+		return instances, nil
+	}
+	err := DB.Preload("VulEnv").Where("team_id IN ?", teamIDs).Order("id").Find(&instances).Error
+	return instances, err
+}
+
+// GetTeamVulInstance 获取团队在指定环境的实例
+func GetTeamVulInstance(teamID, vulEnvID uint) (*VulInstance, error) {
+	var instance VulInstance
+	err := DB.Where("team_id = ? AND vul_env_id = ?", teamID, vulEnvID).First(&instance).Error
+	if err != nil {
+		return nil, err
+	}
+	return &instance, nil
+}
+
+// CountVulInstancesByTeamID 统计团队的实例数量
+func CountVulInstancesByTeamID(teamID uint) (int64, error) {
+	var count int64
+	err := DB.Model(&VulInstance{}).Where("team_id = ?", teamID).Count(&count).Error
+	return count, err
+}
+
 func GetVulInstanceByVulEnvID(vulEnvID uint) ([]VulInstance, error) {
 	var userVuls []VulInstance
 	err := DB.Where("vul_env_id =?", vulEnvID).Find(&userVuls).Error
@@ -124,13 +167,20 @@ func UpdateVulInstance(userVul *VulInstance) error {
 	return DB.Save(userVul).Error
 }
 
+// UpdateVulInstanceResources 开启过程中记录已创建的容器和堆栈，开启中断时对账可以找到并删除
+func UpdateVulInstanceResources(id uint, containerID, stackName string) error {
+	return DB.Model(&VulInstance{}).Where("id = ?", id).
+		Updates(map[string]interface{}{"container_id": containerID, "stack_name": stackName}).Error
+}
+
 func DeleteVulInstance(id uint) error {
 	return DB.Delete(&VulInstance{}, id).Error
 }
 
+// GetVulInstanceBy2ID 获取用户在指定环境的个人实例
 func GetVulInstanceBy2ID(userID, vulEnvID uint) (*VulInstance, error) {
 	var userVul VulInstance
-	err := DB.Where("user_id = ? AND vul_env_id = ?", userID, vulEnvID).First(&userVul).Error
+	err := DB.Where("user_id = ? AND vul_env_id = ? AND team_id = 0", userID, vulEnvID).First(&userVul).Error
 	if err != nil {
 		return nil, err
 	}
@@ -156,9 +206,9 @@ func DeleteVulInstanceByVulEnvID(vulEnvID uint) error {
 	return nil
 }
 
-// DeleteVulInstanceBy2ID 根据用户ID和漏洞环境ID删除漏洞实例
+// DeleteVulInstanceBy2ID 根据用户ID和漏洞环境ID删除个人实例
 func DeleteVulInstanceBy2ID(userID, vulEnvID uint) error {
-	result := DB.Where("user_id = ? AND vul_env_id = ?", userID, vulEnvID).Delete(&VulInstance{})
+	result := DB.Where("user_id = ? AND vul_env_id = ? AND team_id = 0", userID, vulEnvID).Delete(&VulInstance{})
 	if result.Error != nil {
 		return result.Error
 	}
@@ -168,17 +218,29 @@ func DeleteVulInstanceBy2ID(userID, vulEnvID uint) error {
 	return nil
 }
 
-// ExtendExpireTime 延长实例过期时间半小时
-func ExtendExpireTime(id uint) error {
+// ExtendExpireTime 延长实例过期时间并累加延长次数，maxExtensions大于0时限制最多延长次数
+func ExtendExpireTime(id uint, d time.Duration, maxExtensions int) error {
 	// 获取实例
 	instance, err := GetVulInstanceByID(id)
 	if err != nil {
 		return err
 	}
+	if maxExtensions > 0 && instance.ExtendCount >= maxExtensions {
+		return utils.ErrExtendLimitReached
+	}
 
-	// 延长半小时
-	instance.ExpireTime = instance.ExpireTime.Add(30 * time.Minute)
-
-	// 更新数据库
-	return UpdateVulInstance(instance)
+	// 按读取时的延长次数条件更新，避免并发延长绕过次数限制
+	result := DB.Model(&VulInstance{}).
+		Where("id = ? AND extend_count = ?", id, instance.ExtendCount).
+		Updates(map[string]interface{}{
+			"expire_time":  instance.ExpireTime.Add(d),
+			"extend_count": instance.ExtendCount + 1,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("实例已被同时延长，请重试")
+	}
+	return nil
 }
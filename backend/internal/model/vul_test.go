@@ -0,0 +1,211 @@
+package model
+
+import (
+	"AscensionPath/internal/utils"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func createTestVulEnv(t *testing.T, name string, isOpen int) *VulEnv {
+	t.Helper()
+	env := &VulEnv{
+		EnvName:   name,
+		EnvDesc:   "测试环境",
+		EnvType:   "单镜像",
+		BaseImage: "nginx:latest",
+		Degree:    `{"difficulty":"easy"}`,
+		IsOpen:    isOpen,
+		Cost:      12.5,
+	}
+	if err := CreateVulEnv(env); err != nil {
+		t.Fatalf("创建漏洞环境 %s 失败: %v", name, err)
+	}
+	return env
+}
+
+func TestVulEnvCRUD(t *testing.T) {
+	forEachDB(t, func(t *testing.T) {
+		env := createTestVulEnv(t, "sqli", 1000)
+
+		got, err := GetVulEnvByID(env.ID)
+		if err != nil {
+			t.Fatalf("GetVulEnvByID: %v", err)
+		}
+		if got.EnvName != "sqli" || got.Degree != `{"difficulty":"easy"}` || got.Cost != 12.5 {
+			t.Errorf("GetVulEnvByID 返回 %+v", got)
+		}
+		// 数据库默认值
+		if got.Rank != 3.5 {
+			t.Errorf("Rank 默认值为 %v", got.Rank)
+		}
+		if got.CreateTime.IsZero() || got.UpdateTime.IsZero() {
+			t.Errorf("CreateTime/UpdateTime 未使用数据库默认值: %v %v", got.CreateTime, got.UpdateTime)
+		}
+		if got, err := GetVulEnvByName("sqli"); err != nil || got.ID != env.ID {
+			t.Errorf("GetVulEnvByName 返回 %+v, %v", got, err)
+		}
+		if _, err := GetVulEnvByName("none"); !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Errorf("查询不存在的环境返回 %v", err)
+		}
+
+		got.EnvDesc = "已修改"
+		got.Rank = 4.5
+		if err := UpdateVulEnv(got); err != nil {
+			t.Fatalf("UpdateVulEnv: %v", err)
+		}
+		if got, err := GetVulEnvByID(env.ID); err != nil || got.EnvDesc != "已修改" || got.Rank != 4.5 {
+			t.Errorf("更新后环境为 %+v, %v", got, err)
+		}
+
+		if err := DeleteVulEnv(env.ID); err != nil {
+			t.Fatalf("DeleteVulEnv: %v", err)
+		}
+		// 硬删除后名称可以重新使用
+		createTestVulEnv(t, "sqli", 1000)
+	})
+}
+
+func TestVulEnvList(t *testing.T) {
+	forEachDB(t, func(t *testing.T) {
+		for i := 0; i < 5; i++ {
+			createTestVulEnv(t, fmt.Sprintf("env%d", i), i*10+5)
+		}
+
+		all, err := GetAllVulEnvsNoPage()
+		if err != nil || len(all) != 5 {
+			t.Fatalf("GetAllVulEnvsNoPage 返回 %d 条, %v", len(all), err)
+		}
+		page, err := GetAllVulEnvs(2, 2)
+		if err != nil || len(page) != 2 {
+			t.Fatalf("GetAllVulEnvs 返回 %d 条, %v", len(page), err)
+		}
+		open, err := GetVulEnvsByOpenLevel(15)
+		if err != nil {
+			t.Fatalf("GetVulEnvsByOpenLevel: %v", err)
+		}
+		if len(open) != 3 {
+			t.Errorf("GetVulEnvsByOpenLevel(15) 返回 %d 条, 期望 3", len(open))
+		}
+	})
+}
+
+func TestVulInstanceCRUD(t *testing.T) {
+	forEachDB(t, func(t *testing.T) {
+		user := createTestUser(t, "carol", 1, "user")
+		env := createTestVulEnv(t, "xss", 1000)
+		expire := time.Now().Add(time.Hour)
+
+		instance := &VulInstance{
+			UserID:      user.ID,
+			VulEnvID:    env.ID,
+			Status:      InstanceStatusRunning,
+			ContainerID: "c0ffee",
+			Ports:       `{"80":"32768"}`,
+			ExpireTime:  expire,
+		}
+		if err := CreateVulInstance(instance); err != nil {
+			t.Fatalf("CreateVulInstance: %v", err)
+		}
+
+		got, err := GetVulInstanceByID(instance.ID)
+		if err != nil {
+			t.Fatalf("GetVulInstanceByID: %v", err)
+		}
+		if got.Status != InstanceStatusRunning || got.Ports != `{"80":"32768"}` || got.ContainerID != "c0ffee" {
+			t.Errorf("GetVulInstanceByID 返回 %+v", got)
+		}
+		if got.StartTime.IsZero() {
+			t.Error("StartTime 未使用数据库默认值")
+		}
+		assertTimeNear(t, "ExpireTime", got.ExpireTime, expire)
+
+		if got, err := GetVulInstanceBy2ID(user.ID, env.ID); err != nil || got.ID != instance.ID {
+			t.Errorf("GetVulInstanceBy2ID 返回 %+v, %v", got, err)
+		}
+		if list, err := GetVulInstanceByUserID(user.ID); err != nil || len(list) != 1 {
+			t.Errorf("GetVulInstanceByUserID 返回 %d 条, %v", len(list), err)
+		}
+		if list, err := GetVulInstanceByVulEnvID(env.ID); err != nil || len(list) != 1 {
+			t.Errorf("GetVulInstanceByVulEnvID 返回 %d 条, %v", len(list), err)
+		}
+		if list, err := GetAllVulInstances(); err != nil || len(list) != 1 {
+			t.Errorf("GetAllVulInstances 返回 %d 条, %v", len(list), err)
+		}
+
+		if err := ExtendExpireTime(instance.ID, 30*time.Minute, 2); err != nil {
+			t.Fatalf("ExtendExpireTime: %v", err)
+		}
+		got, err = GetVulInstanceByID(instance.ID)
+		if err != nil {
+			t.Fatalf("GetVulInstanceByID: %v", err)
+		}
+		assertTimeNear(t, "延长后的ExpireTime", got.ExpireTime, expire.Add(30*time.Minute))
+		if got.ExtendCount != 1 {
+			t.Errorf("延长后ExtendCount = %d, 期望 1", got.ExtendCount)
+		}
+		if err := ExtendExpireTime(instance.ID, 10*time.Minute, 2); err != nil {
+			t.Fatalf("第二次ExtendExpireTime: %v", err)
+		}
+		if err := ExtendExpireTime(instance.ID, 10*time.Minute, 2); !errors.Is(err, utils.ErrExtendLimitReached) {
+			t.Errorf("超过延长次数返回 %v", err)
+		}
+		got, err = GetVulInstanceByID(instance.ID)
+		if err != nil {
+			t.Fatalf("GetVulInstanceByID: %v", err)
+		}
+		assertTimeNear(t, "再次延长后的ExpireTime", got.ExpireTime, expire.Add(40*time.Minute))
+
+		endTime := time.Now()
+		got.Status = InstanceStatusStopped
+		got.EndTime = endTime
+		if err := UpdateVulInstance(got); err != nil {
+			t.Fatalf("UpdateVulInstance: %v", err)
+		}
+		got, err = GetVulInstanceByID(instance.ID)
+		if err != nil || got.Status != InstanceStatusStopped {
+			t.Fatalf("更新后实例为 %+v, %v", got, err)
+		}
+		assertTimeNear(t, "EndTime", got.EndTime, endTime)
+
+		if err := DeleteVulInstance(instance.ID); err != nil {
+			t.Fatalf("DeleteVulInstance: %v", err)
+		}
+		if _, err := GetVulInstanceByID(instance.ID); !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Errorf("删除后查询返回 %v", err)
+		}
+	})
+}
+
+func TestDeleteVulInstances(t *testing.T) {
+	forEachDB(t, func(t *testing.T) {
+		alice := createTestUser(t, "alice", 1, "user")
+		bob := createTestUser(t, "bob", 1, "user")
+		env := createTestVulEnv(t, "rce", 1000)
+		for _, u := range []*User{alice, bob} {
+			if err := CreateVulInstance(&VulInstance{UserID: u.ID, VulEnvID: env.ID, Status: InstanceStatusRunning}); err != nil {
+				t.Fatalf("CreateVulInstance: %v", err)
+			}
+		}
+
+		if err := DeleteVulInstanceBy2ID(alice.ID, env.ID); err != nil {
+			t.Fatalf("DeleteVulInstanceBy2ID: %v", err)
+		}
+		if err := DeleteVulInstanceBy2ID(alice.ID, env.ID); !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Errorf("重复删除返回 %v", err)
+		}
+
+		if err := DeleteVulInstanceByVulEnvID(env.ID); err != nil {
+			t.Fatalf("DeleteVulInstanceByVulEnvID: %v", err)
+		}
+		if list, err := GetAllVulInstances(); err != nil || len(list) != 0 {
+			t.Errorf("删除后剩余 %d 条实例, %v", len(list), err)
+		}
+		if err := DeleteVulInstanceByVulEnvID(env.ID); !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Errorf("没有实例时返回 %v", err)
+		}
+	})
+}
@@ -0,0 +1,353 @@
+package service
+
+import (
+	"AscensionPath/config"
+	"AscensionPath/internal/middleware"
+	"AscensionPath/internal/model"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// APITokenPrefix 个人访问令牌前缀，认证中间件据此区分令牌和JWT
+const APITokenPrefix = "ap_"
+
+// 令牌列表中展示的前缀长度
+const apiTokenDisplayPrefix = 10
+
+// 每个用户最多持有的有效令牌数量
+const maxAPITokensPerUser = 20
+
+var ErrInvalidAPIToken = errors.New("无效或已过期的访问令牌")
+
+// 个人访问令牌的权限范围
+const (
+	ScopeUserRead      = "user:read"
+	ScopeUserWrite     = "user:write"
+	ScopeVulRead       = "vul:read"
+	ScopeInstanceWrite = "instance:write"
+	ScopeAdminUsers    = "admin:users"
+	ScopeAdminVul      = "admin:vul"
+	ScopeAdminSystem   = "admin:system"
+	ScopeAdminCourses  = "admin:courses"
+)
+
+// APITokenScope 权限范围说明，设置了Permissions的范围只能授予拥有其中任一权限的用户
+type APITokenScope struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions,omitempty"`
+}
+
+// APITokenScopes 所有可用的权限范围
+var APITokenScopes = []APITokenScope{
+	{ScopeUserRead, "读取个人信息和登录记录", nil},
+	{ScopeUserWrite, "修改个人资料", nil},
+	{ScopeVulRead, "查看漏洞环境和已创建的实例", nil},
+	{ScopeInstanceWrite, "创建、删除和延长漏洞实例", nil},
+	{ScopeAdminUsers, "管理用户、身份和团队", []string{PermUserManage, PermRoleManage, PermTeamManage}},
+	{ScopeAdminVul, "管理镜像、漏洞环境和所有实例", []string{
+		PermInstanceViewAll, PermInstanceExtendAll, PermInstanceRemoveAll, PermImageView, PermImageManage,
+	}},
+	{ScopeAdminSystem, "管理系统设置和密钥", []string{PermSystemManage}},
+	{ScopeAdminCourses, "管理课程和作业，查看学生进度", []string{PermCourseManage}},
+}
+
+// grantableTo 该范围能否授予指定身份的用户
+func (scope APITokenScope) grantableTo(role string) bool {
+	if len(scope.Permissions) == 0 {
+		return true
+	}
+	for _, p := range scope.Permissions {
+		if HasPermission(role, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// APITokenDTO 令牌信息，不包含令牌本身
+type APITokenDTO struct {
+	ID         uint       `json:"id"`
+	UserID     uint       `json:"user_id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	LastUsedIP string     `json:"last_used_ip"`
+	CreatedBy  uint       `json:"created_by"`
+	CreatedAt  time.Time  `json:"created_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+}
+
+// HasScope 令牌是否拥有指定权限范围
+func (t *APITokenDTO) HasScope(scope string) bool {
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// allows 令牌的权限范围是否包含该权限，没有范围包含的权限不能通过令牌使用
+func (t *APITokenDTO) allows(permission string) bool {
+	for _, scope := range APITokenScopes {
+		if !t.HasScope(scope.Name) {
+			continue
+		}
+		for _, p := range scope.Permissions {
+			if p == permission {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// APITokenUsageDTO 令牌调用记录
+type APITokenUsageDTO struct {
+	ID        uint      `json:"id"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	IP        string    `json:"ip"`
+	Status    int       `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func invertAPITokenDTO(token model.APIToken) APITokenDTO {
+	return APITokenDTO{
+		ID:         token.ID,
+		UserID:     token.UserID,
+		Name:       token.Name,
+		Prefix:     token.Prefix,
+		Scopes:     splitScopes(token.Scopes),
+		ExpiresAt:  token.ExpiresAt,
+		LastUsedAt: token.LastUsedAt,
+		LastUsedIP: token.LastUsedIP,
+		CreatedBy:  token.CreatedBy,
+		CreatedAt:  token.CreatedAt,
+		RevokedAt:  token.RevokedAt,
+	}
+}
+
+// AvailableAPITokenScopes 当前用户可以授予的权限范围
+func (s *UserService) AvailableAPITokenScopes() []APITokenScope {
+	scopes := make([]APITokenScope, 0, len(APITokenScopes))
+	for _, scope := range APITokenScopes {
+		if scope.grantableTo(s.Role) {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes
+}
+
+// CreateAPIToken 为用户创建个人访问令牌，返回的明文令牌只显示这一次；
+// 用户管理员可以为其他用户创建，管理类范围只能授予拥有对应权限的用户
+func (s *UserService) CreateAPIToken(userID uint, name string, scopes []string, expiresInDays int) (string, *APITokenDTO, error) {
+	if userID != s.ID && !s.canManageUser(userID) {
+		return "", nil, errors.New("权限不足")
+	}
+	name = strings.TrimSpace(name)
+	if name == "" || len([]rune(name)) > 64 {
+		return "", nil, errors.New("令牌名称不能为空且不能超过64个字符")
+	}
+	ttl := time.Duration(expiresInDays) * 24 * time.Hour
+	if expiresInDays <= 0 || ttl > config.Current().APIToken.MaxTTL.Std() {
+		return "", nil, fmt.Errorf("有效期必须在1到%d天之间", int(config.Current().APIToken.MaxTTL.Std()/(24*time.Hour)))
+	}
+
+	user, err := model.GetUserByID(userID)
+	if err != nil {
+		return "", nil, errors.New("用户不存在")
+	}
+	scopes, err = normalizeScopes(scopes, user.Role)
+	if err != nil {
+		return "", nil, err
+	}
+	tokens, err := model.GetAPITokensByUserID(userID)
+	if err != nil {
+		return "", nil, err
+	}
+	active := 0
+	for i := range tokens {
+		if tokens[i].Active() {
+			active++
+		}
+	}
+	if active >= maxAPITokensPerUser {
+		return "", nil, fmt.Errorf("每个用户最多持有%d个有效令牌", maxAPITokensPerUser)
+	}
+
+	plain, hash, err := newAPIToken()
+	if err != nil {
+		return "", nil, err
+	}
+	token := &model.APIToken{
+		UserID:    userID,
+		Name:      name,
+		Prefix:    plain[:apiTokenDisplayPrefix],
+		TokenHash: hash,
+		Scopes:    strings.Join(scopes, ","),
+		ExpiresAt: time.Now().Add(ttl),
+		CreatedBy: s.ID,
+	}
+	if err := model.CreateAPIToken(token); err != nil {
+		return "", nil, fmt.Errorf("创建令牌失败: %v", err)
+	}
+	middleware.SugarLogger.Infow("创建个人访问令牌",
+		"operatorID", s.ID, "targetUserID", userID, "tokenID", token.ID, "scopes", token.Scopes)
+	dto := invertAPITokenDTO(*token)
+	return plain, &dto, nil
+}
+
+// ListAPITokens 获取用户的令牌，普通用户只能查看自己的令牌
+func (s *UserService) ListAPITokens(userID uint) ([]APITokenDTO, error) {
+	if userID != s.ID && !s.Can(PermUserManage) {
+		return nil, errors.New("权限不足")
+	}
+	tokens, err := model.GetAPITokensByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]APITokenDTO, 0, len(tokens))
+	for _, token := range tokens {
+		result = append(result, invertAPITokenDTO(token))
+	}
+	return result, nil
+}
+
+// RevokeAPIToken 撤销令牌，普通用户只能撤销自己的令牌
+func (s *UserService) RevokeAPIToken(id uint) error {
+	token, err := s.getOwnAPIToken(id)
+	if err != nil {
+		return err
+	}
+	revoked, err := model.RevokeAPIToken(token.ID)
+	if err != nil {
+		return err
+	}
+	if !revoked {
+		return errors.New("令牌已撤销")
+	}
+	middleware.SugarLogger.Infow("撤销个人访问令牌", "operatorID", s.ID, "targetUserID", token.UserID, "tokenID", token.ID)
+	return nil
+}
+
+// GetAPITokenUsage 分页获取令牌调用记录
+func (s *UserService) GetAPITokenUsage(id uint, page, pageSize int) ([]APITokenUsageDTO, int64, error) {
+	token, err := s.getOwnAPIToken(id)
+	if err != nil {
+		return nil, 0, err
+	}
+	usages, count, err := model.GetAPITokenUsages(token.ID, page, pageSize)
+	if err != nil {
+		return nil, 0, err
+	}
+	result := make([]APITokenUsageDTO, 0, len(usages))
+	for _, u := range usages {
+		result = append(result, APITokenUsageDTO{
+			ID:        u.ID,
+			Method:    u.Method,
+			Path:      u.Path,
+			IP:        u.IP,
+			Status:    u.Status,
+			CreatedAt: u.CreatedAt,
+		})
+	}
+	return result, count, nil
+}
+
+// getOwnAPIToken 查询令牌并校验当前用户是否为令牌所有者或管理员
+func (s *UserService) getOwnAPIToken(id uint) (*model.APIToken, error) {
+	token, err := model.GetAPITokenByID(id)
+	if err != nil || (token.UserID != s.ID && !s.canManageUser(token.UserID)) {
+		return nil, errors.New("令牌不存在")
+	}
+	return token, nil
+}
+
+// AuthenticateAPIToken 校验个人访问令牌，返回未撤销且未过期的令牌
+func AuthenticateAPIToken(plain string) (*APITokenDTO, error) {
+	token, err := model.GetAPITokenByHash(hashToken(plain))
+	if err != nil || !token.Active() {
+		return nil, ErrInvalidAPIToken
+	}
+	dto := invertAPITokenDTO(*token)
+	return &dto, nil
+}
+
+// RecordAPITokenUsage 记录令牌调用，失败只写日志，不影响请求
+func RecordAPITokenUsage(tokenID uint, method, path, ip string, status int) {
+	err := model.RecordAPITokenUsage(&model.APITokenUsage{
+		TokenID:   tokenID,
+		Method:    method,
+		Path:      truncate(path, 255),
+		IP:        ip,
+		Status:    status,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		middleware.SugarLogger.Warnw("记录令牌调用失败", "tokenID", tokenID, "error", err.Error())
+	}
+}
+
+// StartAPITokenCleanup 定时删除超过保留时长的令牌调用记录，ctx取消后停止
+func StartAPITokenCleanup(ctx context.Context) {
+	runPeriodic(ctx, "api-token-cleanup", time.Hour, func() error {
+		retention := config.Current().APIToken.UsageRetention
+		if retention <= 0 {
+			return nil
+		}
+		_, err := model.DeleteAPITokenUsagesBefore(time.Now().Add(-retention.Std()))
+		return err
+	})
+}
+
+// normalizeScopes 校验并去重权限范围，按APITokenScopes的顺序返回
+func normalizeScopes(scopes []string, role string) ([]string, error) {
+	requested := make(map[string]bool, len(scopes))
+	for _, scope := range scopes {
+		requested[strings.TrimSpace(scope)] = true
+	}
+	result := make([]string, 0, len(requested))
+	for _, scope := range APITokenScopes {
+		if !requested[scope.Name] {
+			continue
+		}
+		if !scope.grantableTo(role) {
+			return nil, fmt.Errorf("权限范围 %s 需要用户拥有对应的管理权限", scope.Name)
+		}
+		result = append(result, scope.Name)
+		delete(requested, scope.Name)
+	}
+	for scope := range requested {
+		return nil, fmt.Errorf("未知的权限范围: %s", scope)
+	}
+	if len(result) == 0 {
+		return nil, errors.New("至少需要一个权限范围")
+	}
+	return result, nil
+}
+
+func splitScopes(scopes string) []string {
+	if scopes == "" {
+		return []string{}
+	}
+	return strings.Split(scopes, ",")
+}
+
+// newAPIToken 生成随机个人访问令牌及其哈希
+func newAPIToken() (string, string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", fmt.Errorf("生成令牌失败: %v", err)
+	}
+	token := APITokenPrefix + base64.RawURLEncoding.EncodeToString(buf)
+	return token, hashToken(token), nil
+}
@@ -0,0 +1,556 @@
+package service
+
+import (
+	"AscensionPath/config"
+	"AscensionPath/internal/middleware"
+	"AscensionPath/internal/model"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 作业中实例有效期的上限(分钟)
+const maxAssignmentLifetime = 7 * 24 * 60
+
+// 学生在作业中每个漏洞环境的进度
+const (
+	ProgressUntouched = "untouched" // 未开启
+	ProgressLaunched  = "launched"  // 已开启实例
+	ProgressSolved    = "solved"    // 已解出
+)
+
+var (
+	ErrCourseNotFound     = errors.New("课程不存在")
+	ErrAssignmentNotFound = errors.New("作业不存在")
+	ErrNotEnrolled        = errors.New("未选修该课程")
+	ErrNotInstructor      = errors.New("只能管理自己任教的课程")
+)
+
+// CourseDTO 课程信息
+type CourseDTO struct {
+	ID             uint      `json:"id"`
+	Name           string    `json:"name"`
+	Description    string    `json:"description"`
+	InstructorID   uint      `json:"instructor_id"`
+	InstructorName string    `json:"instructor_name"`
+	StudentCount   int       `json:"student_count"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// CourseStudentDTO 选课学生
+type CourseStudentDTO struct {
+	UserID     uint      `json:"user_id"`
+	Username   string    `json:"username"`
+	Email      string    `json:"email"`
+	EnrolledAt time.Time `json:"enrolled_at"`
+}
+
+// AssignmentDTO 作业信息，学生查看时Envs带有自己的进度
+type AssignmentDTO struct {
+	ID          uint               `json:"id"`
+	CourseID    uint               `json:"course_id"`
+	Title       string             `json:"title"`
+	Description string             `json:"description"`
+	OpenAt      time.Time          `json:"open_at"`
+	DueAt       time.Time          `json:"due_at"`
+	Lifetime    int                `json:"lifetime"` // 实例有效期(分钟)，0使用默认有效期
+	Envs        []AssignmentEnvDTO `json:"envs"`
+}
+
+// AssignmentEnvDTO 作业中的漏洞环境
+type AssignmentEnvDTO struct {
+	VulEnvID uint   `json:"vul_env_id"`
+	EnvName  string `json:"env_name"`
+	Status   string `json:"status,omitempty"`
+}
+
+// AssignmentForm 创建或修改作业的参数
+type AssignmentForm struct {
+	Title       string
+	Description string
+	OpenAt      time.Time
+	DueAt       time.Time
+	Lifetime    int
+	VulEnvIDs   []uint
+}
+
+// AssignmentProgressReport 作业进度，每个学生在每个漏洞环境的状态
+type AssignmentProgressReport struct {
+	Assignment AssignmentDTO             `json:"assignment"`
+	Students   []StudentProgressDTO      `json:"students"`
+	Summary    []AssignmentEnvSummaryDTO `json:"summary"`
+}
+
+// StudentProgressDTO 学生在作业中的进度
+type StudentProgressDTO struct {
+	UserID   uint             `json:"user_id"`
+	Username string           `json:"username"`
+	Solved   int              `json:"solved"`
+	Envs     []EnvProgressDTO `json:"envs"`
+}
+
+// EnvProgressDTO 学生在一个漏洞环境的进度
+type EnvProgressDTO struct {
+	VulEnvID   uint       `json:"vul_env_id"`
+	Status     string     `json:"status"`
+	LaunchedAt *time.Time `json:"launched_at,omitempty"`
+	SolvedAt   *time.Time `json:"solved_at,omitempty"`
+	Late       bool       `json:"late"` // 截止后才开启
+}
+
+// AssignmentEnvSummaryDTO 一个漏洞环境的进度统计
+type AssignmentEnvSummaryDTO struct {
+	VulEnvID  uint   `json:"vul_env_id"`
+	EnvName   string `json:"env_name"`
+	Untouched int    `json:"untouched"`
+	Launched  int    `json:"launched"`
+	Solved    int    `json:"solved"`
+}
+
+// instanceLifetime 实例有效期，学生开启开放中作业的漏洞环境时使用作业设置的有效期
+func instanceLifetime(userID, vulEnvID uint, at time.Time) time.Duration {
+	lifetime, err := model.GetAssignmentLifetime(userID, vulEnvID, at)
+	if err != nil {
+		middleware.SugarLogger.Warnw("查询作业实例有效期失败", "userID", userID, "vulEnvID", vulEnvID, "error", err.Error())
+	}
+	if lifetime > 0 {
+		return time.Duration(lifetime) * time.Minute
+	}
+	return config.Current().Instance.DefaultExpiration.Std()
+}
+
+// managedCourse 获取调用者可以管理的课程，只有任课教师和系统管理员可以管理课程
+func (s *UserService) managedCourse(courseID uint) (*model.Course, error) {
+	if !s.Can(PermCourseManage) {
+		return nil, errors.New("权限不足")
+	}
+	course, err := model.GetCourse(courseID)
+	if err != nil {
+		return nil, ErrCourseNotFound
+	}
+	if course.InstructorID != s.ID && !s.Can(PermSystemManage) {
+		return nil, ErrNotInstructor
+	}
+	return course, nil
+}
+
+// managedAssignment 获取调用者可以管理的作业
+func (s *UserService) managedAssignment(id uint) (*model.Assignment, error) {
+	if !s.Can(PermCourseManage) {
+		return nil, errors.New("权限不足")
+	}
+	assignment, err := model.GetAssignment(id)
+	if err != nil {
+		return nil, ErrAssignmentNotFound
+	}
+	if _, err := s.managedCourse(assignment.CourseID); err != nil {
+		return nil, err
+	}
+	return assignment, nil
+}
+
+// GetCourses 课程管理员获取所有课程，其他用户获取已选修的课程
+func (s *UserService) GetCourses() ([]CourseDTO, error) {
+	var courses []model.Course
+	var err error
+	if s.Can(PermCourseManage) {
+		courses, err = model.GetCourses()
+	} else {
+		courses, err = model.GetCoursesByStudentID(s.ID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	result := make([]CourseDTO, 0, len(courses))
+	for _, course := range courses {
+		dto := CourseDTO{
+			ID:           course.ID,
+			Name:         course.Name,
+			Description:  course.Description,
+			InstructorID: course.InstructorID,
+			CreatedAt:    course.CreatedAt,
+		}
+		if instructor, err := model.GetUserByID(course.InstructorID); err == nil {
+			dto.InstructorName = instructor.Username
+		}
+		if students, err := model.GetCourseStudents(course.ID); err == nil {
+			dto.StudentCount = len(students)
+		}
+		result = append(result, dto)
+	}
+	return result, nil
+}
+
+// CreateCourse 创建课程，创建人为任课教师
+func (s *UserService) CreateCourse(name, description string) (*CourseDTO, error) {
+	if !s.Can(PermCourseManage) {
+		return nil, errors.New("权限不足")
+	}
+	name, description, err := validateCourseFields(name, description)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := model.GetCourseByName(name); err == nil {
+		return nil, errors.New("课程名称已存在")
+	}
+	course := &model.Course{Name: name, Description: description, InstructorID: s.ID}
+	if err := model.CreateCourse(course); err != nil {
+		return nil, fmt.Errorf("创建课程失败: %v", err)
+	}
+	middleware.SugarLogger.Infow("创建课程", "operatorID", s.ID, "courseID", course.ID, "name", name)
+	return &CourseDTO{
+		ID:             course.ID,
+		Name:           course.Name,
+		Description:    course.Description,
+		InstructorID:   course.InstructorID,
+		InstructorName: s.Username,
+		CreatedAt:      course.CreatedAt,
+	}, nil
+}
+
+// UpdateCourse 修改课程名称和说明
+func (s *UserService) UpdateCourse(id uint, name, description string) error {
+	if _, err := s.managedCourse(id); err != nil {
+		return err
+	}
+	name, description, err := validateCourseFields(name, description)
+	if err != nil {
+		return err
+	}
+	if existing, err := model.GetCourseByName(name); err == nil && existing.ID != id {
+		return errors.New("课程名称已存在")
+	}
+	if err := model.UpdateCourse(id, name, description); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrCourseNotFound
+		}
+		return err
+	}
+	middleware.SugarLogger.Infow("修改课程", "operatorID", s.ID, "courseID", id, "name", name)
+	return nil
+}
+
+// DeleteCourse 删除课程及其作业和学生进度
+func (s *UserService) DeleteCourse(id uint) error {
+	if _, err := s.managedCourse(id); err != nil {
+		return err
+	}
+	if err := model.DeleteCourse(id); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrCourseNotFound
+		}
+		return err
+	}
+	middleware.SugarLogger.Infow("删除课程", "operatorID", s.ID, "courseID", id)
+	return nil
+}
+
+// GetCourseStudents 获取课程的学生
+func (s *UserService) GetCourseStudents(courseID uint) ([]CourseStudentDTO, error) {
+	if _, err := s.managedCourse(courseID); err != nil {
+		return nil, err
+	}
+	students, err := model.GetCourseStudents(courseID)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]CourseStudentDTO, 0, len(students))
+	for _, student := range students {
+		result = append(result, CourseStudentDTO{
+			UserID:     student.UserID,
+			Username:   student.User.Username,
+			Email:      student.User.Email,
+			EnrolledAt: student.CreatedAt,
+		})
+	}
+	return result, nil
+}
+
+// EnrollStudents 按用户名批量选课，返回不存在的用户名
+func (s *UserService) EnrollStudents(courseID uint, usernames []string) ([]string, error) {
+	if _, err := s.managedCourse(courseID); err != nil {
+		return nil, err
+	}
+	notFound := []string{}
+	enrolled := 0
+	for _, username := range usernames {
+		username = strings.TrimSpace(username)
+		if username == "" {
+			continue
+		}
+		user, err := model.GetUserByUsername(username)
+		if err != nil {
+			notFound = append(notFound, username)
+			continue
+		}
+		if err := model.EnrollStudent(courseID, user.ID); err != nil {
+			return notFound, fmt.Errorf("选课失败: %v", err)
+		}
+		enrolled++
+	}
+	middleware.SugarLogger.Infow("学生选课", "operatorID", s.ID, "courseID", courseID, "count", enrolled, "notFound", len(notFound))
+	return notFound, nil
+}
+
+// UnenrollStudent 学生退课
+func (s *UserService) UnenrollStudent(courseID, userID uint) error {
+	if _, err := s.managedCourse(courseID); err != nil {
+		return err
+	}
+	if err := model.UnenrollStudent(courseID, userID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrNotEnrolled
+		}
+		return err
+	}
+	middleware.SugarLogger.Infow("学生退课", "operatorID", s.ID, "courseID", courseID, "targetUserID", userID)
+	return nil
+}
+
+// GetAssignments 获取课程的作业；学生只能看到已开放的作业，以及自己在每个漏洞环境的进度
+func (s *UserService) GetAssignments(courseID uint) ([]AssignmentDTO, error) {
+	manager := s.Can(PermCourseManage)
+	if !manager && !model.IsCourseStudent(courseID, s.ID) {
+		return nil, ErrNotEnrolled
+	}
+	assignments, err := model.GetAssignmentsByCourseID(courseID)
+	if err != nil {
+		return nil, err
+	}
+	names, err := vulEnvNames()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	result := make([]AssignmentDTO, 0, len(assignments))
+	for _, assignment := range assignments {
+		if !manager && assignment.OpenAt.After(now) {
+			continue
+		}
+		dto := toAssignmentDTO(assignment, names)
+		if !manager {
+			progress, err := model.GetUserAssignmentProgress(assignment.ID, s.ID)
+			if err != nil {
+				return nil, err
+			}
+			for i := range dto.Envs {
+				dto.Envs[i].Status = ProgressUntouched
+				for _, p := range progress {
+					if p.VulEnvID == dto.Envs[i].VulEnvID {
+						dto.Envs[i].Status = progressStatus(p)
+					}
+				}
+			}
+		}
+		result = append(result, dto)
+	}
+	return result, nil
+}
+
+// CreateAssignment 为课程创建作业
+func (s *UserService) CreateAssignment(courseID uint, form AssignmentForm) (*AssignmentDTO, error) {
+	if _, err := s.managedCourse(courseID); err != nil {
+		return nil, err
+	}
+	assignment, err := form.toModel()
+	if err != nil {
+		return nil, err
+	}
+	assignment.CourseID = courseID
+	if err := model.CreateAssignment(assignment); err != nil {
+		return nil, fmt.Errorf("创建作业失败: %v", err)
+	}
+	middleware.SugarLogger.Infow("创建作业", "operatorID", s.ID, "courseID", courseID, "assignmentID", assignment.ID, "title", assignment.Title)
+	names, err := vulEnvNames()
+	if err != nil {
+		return nil, err
+	}
+	dto := toAssignmentDTO(*assignment, names)
+	return &dto, nil
+}
+
+// UpdateAssignment 修改作业，已有的学生进度保留
+func (s *UserService) UpdateAssignment(id uint, form AssignmentForm) error {
+	if _, err := s.managedAssignment(id); err != nil {
+		return err
+	}
+	assignment, err := form.toModel()
+	if err != nil {
+		return err
+	}
+	assignment.ID = id
+	if err := model.UpdateAssignment(assignment); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrAssignmentNotFound
+		}
+		return err
+	}
+	middleware.SugarLogger.Infow("修改作业", "operatorID", s.ID, "assignmentID", id, "title", assignment.Title)
+	return nil
+}
+
+// DeleteAssignment 删除作业及学生进度
+func (s *UserService) DeleteAssignment(id uint) error {
+	if _, err := s.managedAssignment(id); err != nil {
+		return err
+	}
+	if err := model.DeleteAssignment(id); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrAssignmentNotFound
+		}
+		return err
+	}
+	middleware.SugarLogger.Infow("删除作业", "operatorID", s.ID, "assignmentID", id)
+	return nil
+}
+
+// GetAssignmentProgress 作业进度：每个选课学生在每个漏洞环境是未开启、已开启还是已解出
+func (s *UserService) GetAssignmentProgress(id uint) (*AssignmentProgressReport, error) {
+	assignment, err := s.managedAssignment(id)
+	if err != nil {
+		return nil, err
+	}
+	students, err := model.GetCourseStudents(assignment.CourseID)
+	if err != nil {
+		return nil, err
+	}
+	records, err := model.GetAssignmentProgress(id)
+	if err != nil {
+		return nil, err
+	}
+	names, err := vulEnvNames()
+	if err != nil {
+		return nil, err
+	}
+
+	// 按学生和漏洞环境索引进度记录
+	type key struct{ userID, vulEnvID uint }
+	byKey := make(map[key]model.AssignmentProgress, len(records))
+	for _, r := range records {
+		byKey[key{r.UserID, r.VulEnvID}] = r
+	}
+
+	report := &AssignmentProgressReport{
+		Assignment: toAssignmentDTO(*assignment, names),
+		Students:   make([]StudentProgressDTO, 0, len(students)),
+		Summary:    make([]AssignmentEnvSummaryDTO, 0, len(assignment.Envs)),
+	}
+	for _, env := range report.Assignment.Envs {
+		report.Summary = append(report.Summary, AssignmentEnvSummaryDTO{VulEnvID: env.VulEnvID, EnvName: env.EnvName})
+	}
+	for _, student := range students {
+		row := StudentProgressDTO{UserID: student.UserID, Username: student.User.Username}
+		for i, env := range report.Assignment.Envs {
+			progress := EnvProgressDTO{VulEnvID: env.VulEnvID, Status: ProgressUntouched}
+			if r, ok := byKey[key{student.UserID, env.VulEnvID}]; ok {
+				progress.Status = progressStatus(r)
+				progress.LaunchedAt = r.LaunchedAt
+				progress.SolvedAt = r.SolvedAt
+				progress.Late = r.LaunchedAt != nil && r.LaunchedAt.After(assignment.DueAt)
+			}
+			switch progress.Status {
+			case ProgressSolved:
+				row.Solved++
+				report.Summary[i].Solved++
+			case ProgressLaunched:
+				report.Summary[i].Launched++
+			default:
+				report.Summary[i].Untouched++
+			}
+			row.Envs = append(row.Envs, progress)
+		}
+		report.Students = append(report.Students, row)
+	}
+	return report, nil
+}
+
+func progressStatus(p model.AssignmentProgress) string {
+	switch {
+	case p.SolvedAt != nil:
+		return ProgressSolved
+	case p.LaunchedAt != nil:
+		return ProgressLaunched
+	}
+	return ProgressUntouched
+}
+
+// vulEnvNames 漏洞环境ID到名称的映射
+func vulEnvNames() (map[uint]string, error) {
+	envs, err := model.GetAllVulEnvsNoPage()
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[uint]string, len(envs))
+	for _, env := range envs {
+		names[env.ID] = env.EnvName
+	}
+	return names, nil
+}
+
+func toAssignmentDTO(assignment model.Assignment, names map[uint]string) AssignmentDTO {
+	dto := AssignmentDTO{
+		ID:          assignment.ID,
+		CourseID:    assignment.CourseID,
+		Title:       assignment.Title,
+		Description: assignment.Description,
+		OpenAt:      assignment.OpenAt,
+		DueAt:       assignment.DueAt,
+		Lifetime:    assignment.Lifetime,
+		Envs:        make([]AssignmentEnvDTO, 0, len(assignment.Envs)),
+	}
+	for _, env := range assignment.Envs {
+		dto.Envs = append(dto.Envs, AssignmentEnvDTO{VulEnvID: env.VulEnvID, EnvName: names[env.VulEnvID]})
+	}
+	return dto
+}
+
+// toModel 校验作业参数
+func (f AssignmentForm) toModel() (*model.Assignment, error) {
+	title := strings.TrimSpace(f.Title)
+	if title == "" || len([]rune(title)) > 100 {
+		return nil, errors.New("作业标题不能为空且不能超过100个字符")
+	}
+	if f.OpenAt.IsZero() || f.DueAt.IsZero() || !f.DueAt.After(f.OpenAt) {
+		return nil, errors.New("截止时间必须晚于开放时间")
+	}
+	if f.Lifetime < 0 || f.Lifetime > maxAssignmentLifetime {
+		return nil, fmt.Errorf("实例有效期必须在0到%d分钟之间", maxAssignmentLifetime)
+	}
+	if len(f.VulEnvIDs) == 0 {
+		return nil, errors.New("作业至少包含一个漏洞环境")
+	}
+	assignment := &model.Assignment{
+		Title:       title,
+		Description: strings.TrimSpace(f.Description),
+		OpenAt:      f.OpenAt,
+		DueAt:       f.DueAt,
+		Lifetime:    f.Lifetime,
+	}
+	seen := map[uint]bool{}
+	for _, id := range f.VulEnvIDs {
+		if seen[id] {
+			continue
+		}
+		if _, err := model.GetVulEnvByID(id); err != nil {
+			return nil, fmt.Errorf("漏洞环境 %d 不存在", id)
+		}
+		seen[id] = true
+		assignment.Envs = append(assignment.Envs, model.AssignmentEnv{VulEnvID: id})
+	}
+	return assignment, nil
+}
+
+func validateCourseFields(name, description string) (string, string, error) {
+	name = strings.TrimSpace(name)
+	description = strings.TrimSpace(description)
+	if name == "" || len([]rune(name)) > 100 {
+		return "", "", errors.New("课程名称不能为空且不能超过100个字符")
+	}
+	if len([]rune(description)) > 255 {
+		return "", "", errors.New("课程说明不能超过255个字符")
+	}
+	return name, description, nil
+}
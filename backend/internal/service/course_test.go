@@ -0,0 +1,194 @@
+package service
+
+import (
+	"AscensionPath/internal/model"
+	"testing"
+	"time"
+)
+
+func TestCourseAssignments(t *testing.T) {
+	useTestDB(t)
+	var users []*UserService
+	for _, name := range []string{"teacher", "alice", "bob"} {
+		role := RoleUser
+		if name == "teacher" {
+			role = "instructor"
+		}
+		user := &model.User{Username: name, Password: "x", Email: name + "@example.edu", Status: 1, Role: role}
+		if err := model.CreateUser(user); err != nil {
+			t.Fatal(err)
+		}
+		users = append(users, &UserService{UserDTO: UserDTO{ID: user.ID, Username: name, Role: role}})
+	}
+	teacher, alice, bob := users[0], users[1], users[2]
+	sqli := &model.VulEnv{EnvName: "sqli", EnvType: "单镜像", BaseImage: "sqli"}
+	xss := &model.VulEnv{EnvName: "xss", EnvType: "单镜像", BaseImage: "xss"}
+	model.CreateVulEnv(sqli)
+	model.CreateVulEnv(xss)
+
+	if _, err := alice.CreateCourse("Web安全", ""); err == nil {
+		t.Error("学生不应能创建课程")
+	}
+	course, err := teacher.CreateCourse("Web安全", "2024秋")
+	if err != nil {
+		t.Fatalf("CreateCourse: %v", err)
+	}
+	notFound, err := teacher.EnrollStudents(course.ID, []string{"alice", " bob ", "nobody", ""})
+	if err != nil || len(notFound) != 1 || notFound[0] != "nobody" {
+		t.Fatalf("EnrollStudents = %v, %v", notFound, err)
+	}
+
+	now := time.Now()
+	form := AssignmentForm{Title: "第一周", OpenAt: now.Add(-time.Hour), DueAt: now.Add(time.Hour), Lifetime: 120, VulEnvIDs: []uint{sqli.ID, xss.ID, sqli.ID}}
+	bad := form
+	bad.DueAt = bad.OpenAt
+	if _, err := teacher.CreateAssignment(course.ID, bad); err == nil {
+		t.Error("截止时间早于开放时间应被拒绝")
+	}
+	bad = form
+	bad.VulEnvIDs = []uint{999}
+	if _, err := teacher.CreateAssignment(course.ID, bad); err == nil {
+		t.Error("不存在的漏洞环境应被拒绝")
+	}
+	assignment, err := teacher.CreateAssignment(course.ID, form)
+	if err != nil {
+		t.Fatalf("CreateAssignment: %v", err)
+	}
+	if len(assignment.Envs) != 2 || assignment.Envs[0].EnvName != "sqli" {
+		t.Errorf("重复的漏洞环境应去重: %+v", assignment.Envs)
+	}
+	upcoming := form
+	upcoming.Title = "第二周"
+	upcoming.OpenAt, upcoming.DueAt = now.Add(24*time.Hour), now.Add(48*time.Hour)
+	teacher.CreateAssignment(course.ID, upcoming)
+
+	// 作业设置的有效期覆盖默认有效期，只对选课学生生效
+	if got := instanceLifetime(alice.ID, sqli.ID, now); got != 120*time.Minute {
+		t.Errorf("学生的实例有效期 = %v", got)
+	}
+	if got := instanceLifetime(teacher.ID, sqli.ID, now); got != 30*time.Minute {
+		t.Errorf("未选课用户的实例有效期 = %v", got)
+	}
+
+	// 学生只能看到已开放的作业
+	if _, err := (&UserService{UserDTO: UserDTO{ID: 999, Role: RoleUser}}).GetAssignments(course.ID); err != ErrNotEnrolled {
+		t.Errorf("未选课的用户应被拒绝: %v", err)
+	}
+	model.RecordAssignmentLaunch(alice.ID, sqli.ID, now)
+	assignments, err := alice.GetAssignments(course.ID)
+	if err != nil || len(assignments) != 1 {
+		t.Fatalf("GetAssignments = %+v, %v", assignments, err)
+	}
+	if assignments[0].Envs[0].Status != ProgressLaunched || assignments[0].Envs[1].Status != ProgressUntouched {
+		t.Errorf("学生的进度不正确: %+v", assignments[0].Envs)
+	}
+	if all, _ := teacher.GetAssignments(course.ID); len(all) != 2 {
+		t.Errorf("教师应能看到所有作业: %+v", all)
+	}
+
+	// bob在截止后开启，并已解出
+	late := now.Add(2 * time.Hour)
+	model.RecordAssignmentLaunch(bob.ID, xss.ID, late)
+	model.DB.Model(&model.AssignmentProgress{}).Where("user_id = ?", bob.ID).Update("solved_at", late)
+
+	if _, err := alice.GetAssignmentProgress(assignment.ID); err == nil {
+		t.Error("学生不应能查看作业进度")
+	}
+	report, err := teacher.GetAssignmentProgress(assignment.ID)
+	if err != nil {
+		t.Fatalf("GetAssignmentProgress: %v", err)
+	}
+	if len(report.Students) != 2 || report.Students[0].Username != "alice" {
+		t.Fatalf("进度中的学生不正确: %+v", report.Students)
+	}
+	if report.Students[0].Envs[0].Status != ProgressLaunched || report.Students[0].Envs[1].Status != ProgressUntouched {
+		t.Errorf("alice的进度不正确: %+v", report.Students[0].Envs)
+	}
+	bobXSS := report.Students[1].Envs[1]
+	if bobXSS.Status != ProgressSolved || !bobXSS.Late || report.Students[1].Solved != 1 {
+		t.Errorf("bob的进度不正确: %+v", report.Students[1])
+	}
+	if s := report.Summary[0]; s.Launched != 1 || s.Untouched != 1 || s.Solved != 0 {
+		t.Errorf("sqli的统计不正确: %+v", s)
+	}
+	if s := report.Summary[1]; s.Solved != 1 || s.Untouched != 1 {
+		t.Errorf("xss的统计不正确: %+v", s)
+	}
+
+	if err := teacher.UnenrollStudent(course.ID, bob.ID); err != nil {
+		t.Fatal(err)
+	}
+	if report, _ := teacher.GetAssignmentProgress(assignment.ID); len(report.Students) != 1 {
+		t.Errorf("退课的学生不应出现在进度中: %+v", report.Students)
+	}
+	if err := teacher.DeleteCourse(course.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := teacher.GetAssignmentProgress(assignment.ID); err != ErrAssignmentNotFound {
+		t.Errorf("删除课程后作业应被删除: %v", err)
+	}
+}
+
+func TestCourseOwnership(t *testing.T) {
+	useTestDB(t)
+	users := map[string]*UserService{}
+	for _, u := range []struct{ name, role string }{{"teacher", "instructor"}, {"other", "instructor"}, {"root", RoleAdmin}, {"alice", RoleUser}} {
+		user := &model.User{Username: u.name, Password: "x", Email: u.name + "@example.edu", Status: 1, Role: u.role}
+		if err := model.CreateUser(user); err != nil {
+			t.Fatal(err)
+		}
+		users[u.name] = &UserService{UserDTO: UserDTO{ID: user.ID, Username: u.name, Role: u.role}}
+	}
+	teacher, other, root := users["teacher"], users["other"], users["root"]
+	env := &model.VulEnv{EnvName: "sqli", EnvType: "单镜像", BaseImage: "sqli"}
+	model.CreateVulEnv(env)
+
+	course, err := teacher.CreateCourse("Web安全", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	teacher.EnrollStudents(course.ID, []string{"alice"})
+	now := time.Now()
+	form := AssignmentForm{Title: "实验一", OpenAt: now.Add(-time.Hour), DueAt: now.Add(time.Hour), VulEnvIDs: []uint{env.ID}}
+	assignment, err := teacher.CreateAssignment(course.ID, form)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 其他教师不能管理不是自己任教的课程
+	for name, call := range map[string]func() error{
+		"修改课程": func() error { return other.UpdateCourse(course.ID, "改名", "") },
+		"删除课程": func() error { return other.DeleteCourse(course.ID) },
+		"查看学生": func() error { _, err := other.GetCourseStudents(course.ID); return err },
+		"添加学生": func() error { _, err := other.EnrollStudents(course.ID, []string{"other"}); return err },
+		"学生退课": func() error { return other.UnenrollStudent(course.ID, users["alice"].ID) },
+		"创建作业": func() error { _, err := other.CreateAssignment(course.ID, form); return err },
+		"修改作业": func() error { return other.UpdateAssignment(assignment.ID, form) },
+		"删除作业": func() error { return other.DeleteAssignment(assignment.ID) },
+		"查看进度": func() error { _, err := other.GetAssignmentProgress(assignment.ID); return err },
+	} {
+		if err := call(); err != ErrNotInstructor {
+			t.Errorf("%s: 期望 ErrNotInstructor，实际为 %v", name, err)
+		}
+	}
+	if got, _ := model.GetCourse(course.ID); got.Name != "Web安全" {
+		t.Errorf("课程被其他教师修改: %+v", got)
+	}
+	if students, _ := model.GetCourseStudents(course.ID); len(students) != 1 {
+		t.Errorf("选课学生被其他教师修改: %+v", students)
+	}
+	if assignments, _ := model.GetAssignmentsByCourseID(course.ID); len(assignments) != 1 {
+		t.Errorf("作业被其他教师修改: %+v", assignments)
+	}
+
+	// 系统管理员可以管理所有课程
+	if err := root.UpdateCourse(course.ID, "Web安全(一)", ""); err != nil {
+		t.Errorf("系统管理员修改课程失败: %v", err)
+	}
+	if _, err := root.GetAssignmentProgress(assignment.ID); err != nil {
+		t.Errorf("系统管理员查看进度失败: %v", err)
+	}
+	if err := root.DeleteCourse(course.ID); err != nil {
+		t.Errorf("系统管理员删除课程失败: %v", err)
+	}
+}
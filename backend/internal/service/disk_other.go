@@ -0,0 +1,10 @@
+//go:build !linux && !darwin
+
+package service
+
+import "errors"
+
+// diskUsage 当前平台不支持获取磁盘空间
+func diskUsage(path string) (free, total uint64, err error) {
+	return 0, 0, errors.ErrUnsupported
+}
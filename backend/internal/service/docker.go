@@ -42,9 +42,30 @@ const (
 	defaultTimeout     = 10 * time.Minute
 )
 
-// 创建 Docker 客户端 (复用代码)
+// 平台创建的容器和网络上的标签，用于状态对账时识别和认领
+const (
+	LabelManaged  = "ascensionpath.managed"
+	LabelUserID   = "ascensionpath.user_id"
+	LabelVulEnvID = "ascensionpath.vul_env_id"
+	LabelTeamID   = "ascensionpath.team_id"
+)
+
+// InstanceLabels 生成实例资源的标签，团队实例带有团队ID
+func InstanceLabels(userID, teamID, vulEnvID uint) map[string]string {
+	labels := map[string]string{
+		LabelManaged:  "true",
+		LabelUserID:   strconv.FormatUint(uint64(userID), 10),
+		LabelVulEnvID: strconv.FormatUint(uint64(vulEnvID), 10),
+	}
+	if teamID != 0 {
+		labels[LabelTeamID] = strconv.FormatUint(uint64(teamID), 10)
+	}
+	return labels
+}
+
+// 创建 Docker 客户端 (复用代码)，声明为接口以便测试替换为假客户端
 var (
-	dockerCli *client.Client
+	dockerCli client.APIClient
 	cliOnce   sync.Once
 )
 
@@ -55,20 +76,25 @@ func init() {
 
 // 初始化Docker客户端
 func initDockerClient() {
-	var err error
-	dockerCli, err = client.NewClientWithOpts(
+	cli, err := client.NewClientWithOpts(
 		client.FromEnv,
 		client.WithAPIVersionNegotiation(),
 		client.WithTimeout(defaultTimeout),
 	)
 	if err != nil {
+		dockerCli = nil
 		middleware.SugarLogger.Errorf("初始化Docker客户端失败: %v", err)
+		return
 	}
+	dockerCli = cli
 }
 
 // 检查Docker客户端是否可用
 func IsDockerAvailable() (bool, error) {
 	cli := dockerCli
+	if cli == nil {
+		return false, errors.New("Docker客户端未初始化")
+	}
 
 	// 执行一个简单的ping操作验证连接
 	_, err := cli.Ping(context.Background())
@@ -81,7 +107,7 @@ func IsDockerAvailable() (bool, error) {
 }
 
 // 获取Docker客户端 (线程安全)
-func getDockerClient() (*client.Client, error) {
+func getDockerClient() (client.APIClient, error) {
 	if ok, err := IsDockerAvailable(); !ok {
 		initDockerClient()
 		return dockerCli, err
@@ -217,7 +243,7 @@ func PullImage(ctx context.Context, imageName string, conn *websocket.Conn) erro
 	pullOpts := image.PullOptions{}
 
 	// 从环境变量获取代理设置
-	if proxyURL := config.Proxy; proxyURL != "" {
+	if proxyURL := config.Current().Storage.Proxy; proxyURL != "" {
 		pullOpts.RegistryAuth = "" // 如果需要认证可以在这里设置
 		// 设置代理环境变量
 		err = os.Setenv("HTTP_PROXY", proxyURL)
@@ -473,12 +499,15 @@ func DeleteComposeImages(composePath string) error {
 	return lastError
 }
 
-// 使用 compose-go 解析并部署 Docker Compose 文件
-func CreateFromCompose(composePath, stackName string, ports *map[string]string) error {
+// 使用 compose-go 解析并部署 Docker Compose 文件，extraLabels 会附加到网络和容器上
+func CreateFromCompose(composePath, stackName string, ports *map[string]string, extraLabels map[string]string, envVars []string, files map[string]string) error {
 	labels := map[string]string{
 		"com.docker.compose.project": stackName,
 		"com.docker.compose.oneoff":  "False",
 	}
+	for k, v := range extraLabels {
+		labels[k] = v
+	}
 
 	// 创建专用网络（使用规范化名称）
 	networkName := fmt.Sprintf("%s_default", stackName)
@@ -520,7 +549,7 @@ func CreateFromCompose(composePath, stackName string, ports *map[string]string)
 	// 先部署无依赖的服务
 	for _, service := range project.Services {
 		if len(service.DependsOn) == 0 {
-			if err := deployService(service, networkID, composePath, stackName, ports); err != nil {
+			if err := deployService(service, networkID, composePath, stackName, ports, extraLabels, envVars, files); err != nil {
 				return err
 			}
 		}
@@ -543,7 +572,7 @@ func CreateFromCompose(composePath, stackName string, ports *map[string]string)
 
 				if allDepsReady {
 					if !isServiceDeployed(project, service.Name, stackName) {
-						if err := deployService(service, networkID, composePath, stackName, ports); err != nil {
+						if err := deployService(service, networkID, composePath, stackName, ports, extraLabels, envVars, files); err != nil {
 							return err
 						}
 						deployed++
@@ -614,7 +643,7 @@ func getRestartPolicy(deploy *types.DeployConfig) string {
 }
 
 // deployService 根据 compose 文件创建容器
-func deployService(service types.ServiceConfig, networkID string, composePath string, stackName string, ports *map[string]string) error {
+func deployService(service types.ServiceConfig, networkID string, composePath string, stackName string, ports *map[string]string, extraLabels map[string]string, envVars []string, files map[string]string) error {
 	// 检查并拉取镜像
 	cli, err := getDockerClient()
 	if err != nil {
@@ -647,13 +676,16 @@ func deployService(service types.ServiceConfig, networkID string, composePath st
 	// 构建容器配置（添加堆栈标签）
 	containerConfig := &container.Config{
 		Image: service.Image,
-		Env:   convertMappingToSlice(service.Environment),
+		Env:   append(convertMappingToSlice(service.Environment), envVars...),
 		Labels: map[string]string{
 			"com.docker.compose.project": stackName,
 			"com.docker.compose.service": service.Name,
 			"com.docker.compose.oneoff":  "False",
 		},
 	}
+	for k, v := range extraLabels {
+		containerConfig.Labels[k] = v
+	}
 
 	// 添加用户配置（新增）
 	if service.User != "" {
@@ -821,6 +853,12 @@ func deployService(service types.ServiceConfig, networkID string, composePath st
 		return err
 	}
 
+	// 启动前写入实例文件
+	if err := copyFilesToContainer(cli, resp.ID, files); err != nil {
+		middleware.SugarLogger.Errorf("写入容器 %s 的文件失败: %v", service.Name, err)
+		return err
+	}
+
 	// 再启动容器
 	if err := cli.ContainerStart(context.Background(), resp.ID, container.StartOptions{}); err != nil {
 		middleware.SugarLogger.Errorf("启动容器 %s 失败: %v", service.Name, err)
@@ -903,7 +941,7 @@ func GeneratePortBindings(imageName string) (map[string]string, error) {
 }
 
 // CreateContainer 创建并启动容器 (修改后版本)
-func CreateContainer(imageName string, containerName string, envVars []string, portBindings map[string]string) (string, error) {
+func CreateContainer(imageName string, containerName string, envVars []string, files map[string]string, portBindings map[string]string, labels map[string]string) (string, error) {
 	cli, err := getDockerClient()
 	if err != nil {
 		return "", err
@@ -911,8 +949,9 @@ func CreateContainer(imageName string, containerName string, envVars []string, p
 
 	// 构建容器配置
 	containerConfig := &container.Config{
-		Image: imageName,
-		Env:   envVars,
+		Image:  imageName,
+		Env:    envVars,
+		Labels: labels,
 	}
 
 	// 构建主机配置
@@ -948,6 +987,13 @@ func CreateContainer(imageName string, containerName string, envVars []string, p
 		return "", err
 	}
 
+	// 启动前写入实例文件
+	if err := copyFilesToContainer(cli, resp.ID, files); err != nil {
+		middleware.SugarLogger.Errorf("写入容器 %s 的文件失败: %v", containerName, err)
+		cli.ContainerRemove(context.Background(), resp.ID, container.RemoveOptions{Force: true})
+		return "", err
+	}
+
 	// 启动容器
 	if err := cli.ContainerStart(context.Background(), resp.ID, container.StartOptions{}); err != nil {
 		middleware.SugarLogger.Errorf("启动容器 %s 失败: %v", containerName, err)
@@ -963,6 +1009,33 @@ func CreateContainer(imageName string, containerName string, envVars []string, p
 	return resp.ID, nil
 }
 
+// copyFilesToContainer 将文件写入容器，files的键为容器内的绝对路径，不存在的父目录会被创建
+func copyFilesToContainer(cli client.APIClient, containerID string, files map[string]string) error {
+	if len(files) == 0 {
+		return nil
+	}
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for name, content := range files {
+		hdr := &tar.Header{
+			Name:    strings.TrimPrefix(name, "/"),
+			Mode:    0444,
+			Size:    int64(len(content)),
+			ModTime: time.Now(),
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return cli.CopyToContainer(context.Background(), containerID, "/", &buf, container.CopyToContainerOptions{})
+}
+
 // RemoveAllCreatedContainers 删除所有通过CreateContainer创建的容器
 func RemoveAllCreatedContainers() error {
 	containersMutex.Lock()
@@ -1015,10 +1088,34 @@ func RemoveContainer(containerID string, force bool) error {
 		return err
 	}
 
+	containersMutex.Lock()
+	delete(createdContainers, containerID)
+	containersMutex.Unlock()
+
 	middleware.SugarLogger.Infof("成功删除容器 %s (强制: %v)", containerID, force)
 	return nil
 }
 
+// StopContainer 停止容器
+func StopContainer(containerID string) error {
+	cli, err := getDockerClient()
+	if err != nil {
+		return err
+	}
+
+	if err := cli.ContainerStop(context.Background(), containerID, container.StopOptions{}); err != nil {
+		if client.IsErrNotFound(err) {
+			// 容器不存在，直接返回
+			return nil
+		}
+		middleware.SugarLogger.Errorf("停止容器 %s 失败: %v", containerID, err)
+		return err
+	}
+
+	middleware.SugarLogger.Infof("成功停止容器 %s", containerID)
+	return nil
+}
+
 // RemoveComposeContainers 删除通过Compose文件创建的所有容器和网络
 func RemoveComposeContainers(composePath string) error {
 	rawName := filepath.Base(filepath.Dir(composePath))
@@ -1072,6 +1169,22 @@ func isServiceDeployed(_ *types.Project, serviceName string, stackName string) b
 	return err == nil && len(containers) > 0
 }
 
+// GetAllContainers 获取所有容器(包含已停止的)
+func GetAllContainers() ([]container.Summary, error) {
+	cli, err := getDockerClient()
+	if err != nil {
+		return nil, err
+	}
+
+	containers, err := cli.ContainerList(context.Background(), container.ListOptions{
+		All: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("获取容器列表失败: %v", err)
+	}
+	return containers, nil
+}
+
 // GetStackNames 获取Docker中所有存在的stackName
 func GetStackNames() ([]string, error) {
 	cli, err := getDockerClient()
@@ -1117,6 +1230,38 @@ func GetStackNames() ([]string, error) {
 	return result, nil
 }
 
+// StopStackByName 停止stackName对应的所有容器
+func StopStackByName(stackName string) error {
+	cli, err := getDockerClient()
+	if err != nil {
+		return err
+	}
+
+	containers, err := cli.ContainerList(context.Background(), container.ListOptions{
+		Filters: filters.NewArgs(
+			filters.Arg("label", "com.docker.compose.project="+stackName),
+		),
+	})
+	if err != nil {
+		middleware.SugarLogger.Errorf("获取容器列表失败: %v", err)
+		return err
+	}
+
+	var lastError error
+	for _, c := range containers {
+		if err := cli.ContainerStop(context.Background(), c.ID, container.StopOptions{}); err != nil {
+			middleware.SugarLogger.Errorf("停止容器 %s 失败: %v", c.ID, err)
+			lastError = err
+		}
+	}
+
+	if lastError != nil {
+		return fmt.Errorf("停止堆栈 %s 时发生部分错误: %v", stackName, lastError)
+	}
+	middleware.SugarLogger.Infof("成功停止堆栈 %s", stackName)
+	return nil
+}
+
 // RemoveStackByName 根据stackName删除对应的容器、网络和卷
 func RemoveStackByName(stackName string) error {
 	cli, err := getDockerClient()
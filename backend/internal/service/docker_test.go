@@ -0,0 +1,288 @@
+package service
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/system"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
+	"github.com/docker/go-connections/nat"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// fakeDocker 内存中的Docker守护进程，只实现服务层用到的接口，调用其余方法时panic
+type fakeDocker struct {
+	client.APIClient
+
+	mu         sync.Mutex
+	containers []container.Summary
+	networks   []network.Summary
+	images     map[string]nat.PortSet       // 镜像名 -> 暴露的端口
+	removed    []string                     // 被删除的容器ID
+	stopped    []string                     // 被停止的容器ID
+	files      map[string]map[string]string // 容器ID -> 写入的文件路径 -> 内容
+	pingErr    error
+	rootDir    string
+	nextID     int
+}
+
+// useFakeDocker 将Docker客户端替换为假客户端，测试结束后恢复
+func useFakeDocker(t *testing.T) *fakeDocker {
+	t.Helper()
+	fake := &fakeDocker{images: map[string]nat.PortSet{}}
+	old := dockerCli
+	dockerCli = fake
+	t.Cleanup(func() { dockerCli = old })
+	return fake
+}
+
+// add 添加一个容器，name为不带斜杠的容器名
+func (f *fakeDocker) add(id, name, state string, created time.Time, labels map[string]string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.containers = append(f.containers, container.Summary{
+		ID:      id,
+		Names:   []string{"/" + name},
+		State:   state,
+		Created: created.Unix(),
+		Labels:  labels,
+	})
+}
+
+// addNetwork 添加一个compose堆栈的网络
+func (f *fakeDocker) addNetwork(id, project string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.networks = append(f.networks, network.Summary{ID: id, Name: project + "_default", Labels: map[string]string{"com.docker.compose.project": project}})
+}
+
+func (f *fakeDocker) get(id string) *container.Summary {
+	for i := range f.containers {
+		if f.containers[i].ID == id {
+			return &f.containers[i]
+		}
+	}
+	return nil
+}
+
+// state 返回容器状态，容器不存在时返回空字符串
+func (f *fakeDocker) state(id string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if c := f.get(id); c != nil {
+		return c.State
+	}
+	return ""
+}
+
+func (f *fakeDocker) wasRemoved(id string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, removed := range f.removed {
+		if removed == id {
+			return true
+		}
+	}
+	return false
+}
+
+func notFound(kind, id string) error {
+	return errdefs.NotFound(fmt.Errorf("%s %s 不存在", kind, id))
+}
+
+// matchLabels 判断标签是否满足 label=key=value 过滤条件
+func matchLabels(labels map[string]string, filter []string) bool {
+	for _, f := range filter {
+		key, value, _ := strings.Cut(f, "=")
+		if v, ok := labels[key]; !ok || v != value {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *fakeDocker) Ping(ctx context.Context) (types.Ping, error) {
+	if f.pingErr != nil {
+		return types.Ping{}, f.pingErr
+	}
+	return types.Ping{APIVersion: "1.47"}, nil
+}
+
+func (f *fakeDocker) Info(ctx context.Context) (system.Info, error) {
+	if f.pingErr != nil {
+		return system.Info{}, f.pingErr
+	}
+	return system.Info{DockerRootDir: f.rootDir}, nil
+}
+
+func (f *fakeDocker) ContainerList(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var result []container.Summary
+	for _, c := range f.containers {
+		if !options.All && c.State != "running" {
+			continue
+		}
+		if options.Filters.Len() > 0 && !matchLabels(c.Labels, options.Filters.Get("label")) {
+			continue
+		}
+		result = append(result, c)
+	}
+	return result, nil
+}
+
+func (f *fakeDocker) ContainerInspect(ctx context.Context, id string) (container.InspectResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	c := f.get(id)
+	if c == nil {
+		return container.InspectResponse{}, notFound("容器", id)
+	}
+	return container.InspectResponse{ContainerJSONBase: &container.ContainerJSONBase{ID: c.ID, Name: c.Names[0]}}, nil
+}
+
+func (f *fakeDocker) ContainerCreate(ctx context.Context, config *container.Config, hostConfig *container.HostConfig, networkingConfig *network.NetworkingConfig, platform *ocispec.Platform, containerName string) (container.CreateResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.images[config.Image]; !ok {
+		return container.CreateResponse{}, notFound("镜像", config.Image)
+	}
+	f.nextID++
+	id := fmt.Sprintf("%064x", f.nextID)
+	var ports []container.Port
+	for port, bindings := range hostConfig.PortBindings {
+		for _, b := range bindings {
+			public, _ := nat.ParsePort(b.HostPort)
+			ports = append(ports, container.Port{PrivatePort: uint16(port.Int()), PublicPort: uint16(public), Type: port.Proto()})
+		}
+	}
+	f.containers = append(f.containers, container.Summary{
+		ID:      id,
+		Names:   []string{"/" + containerName},
+		Image:   config.Image,
+		State:   "created",
+		Created: time.Now().Unix(),
+		Labels:  config.Labels,
+		Ports:   ports,
+	})
+	return container.CreateResponse{ID: id}, nil
+}
+
+func (f *fakeDocker) CopyToContainer(ctx context.Context, id, path string, content io.Reader, options container.CopyToContainerOptions) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.get(id) == nil {
+		return notFound("容器", id)
+	}
+	if f.files == nil {
+		f.files = map[string]map[string]string{}
+	}
+	if f.files[id] == nil {
+		f.files[id] = map[string]string{}
+	}
+	tr := tar.NewReader(content)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return err
+		}
+		f.files[id][strings.TrimSuffix(path, "/")+"/"+hdr.Name] = string(data)
+	}
+}
+
+func (f *fakeDocker) ContainerStart(ctx context.Context, id string, options container.StartOptions) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	c := f.get(id)
+	if c == nil {
+		return notFound("容器", id)
+	}
+	c.State = "running"
+	return nil
+}
+
+func (f *fakeDocker) ContainerStop(ctx context.Context, id string, options container.StopOptions) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	c := f.get(id)
+	if c == nil {
+		return notFound("容器", id)
+	}
+	c.State = "exited"
+	f.stopped = append(f.stopped, id)
+	return nil
+}
+
+func (f *fakeDocker) ContainerRemove(ctx context.Context, id string, options container.RemoveOptions) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, c := range f.containers {
+		if c.ID == id {
+			if c.State == "running" && !options.Force {
+				return fmt.Errorf("容器 %s 正在运行", id)
+			}
+			f.containers = append(f.containers[:i], f.containers[i+1:]...)
+			f.removed = append(f.removed, id)
+			return nil
+		}
+	}
+	return notFound("容器", id)
+}
+
+func (f *fakeDocker) NetworkList(ctx context.Context, options network.ListOptions) ([]network.Summary, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var result []network.Summary
+	for _, n := range f.networks {
+		if options.Filters.Len() > 0 && !matchLabels(n.Labels, options.Filters.Get("label")) {
+			continue
+		}
+		result = append(result, n)
+	}
+	return result, nil
+}
+
+func (f *fakeDocker) NetworkRemove(ctx context.Context, id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, n := range f.networks {
+		if n.ID == id {
+			f.networks = append(f.networks[:i], f.networks[i+1:]...)
+			return nil
+		}
+	}
+	return notFound("网络", id)
+}
+
+func (f *fakeDocker) VolumeList(ctx context.Context, options volume.ListOptions) (volume.ListResponse, error) {
+	return volume.ListResponse{}, nil
+}
+
+func (f *fakeDocker) ImageInspect(ctx context.Context, name string, _ ...client.ImageInspectOption) (image.InspectResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ports, ok := f.images[name]
+	if !ok {
+		return image.InspectResponse{}, notFound("镜像", name)
+	}
+	return image.InspectResponse{ID: "sha256:" + name, Config: &container.Config{ExposedPorts: ports}}, nil
+}
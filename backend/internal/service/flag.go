@@ -0,0 +1,101 @@
+package service
+
+import (
+	"AscensionPath/config"
+	"AscensionPath/internal/middleware"
+	"AscensionPath/internal/model"
+	"AscensionPath/internal/utils"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	ErrWrongFlag         = errors.New("flag错误")
+	ErrTeamAlreadySolved = utils.ErrTeamAlreadySolved
+)
+
+// SolveDTO 提交flag的结果
+type SolveDTO struct {
+	VulEnvID uint      `json:"vul_env_id"`
+	EnvName  string    `json:"env_name"`
+	TeamID   uint      `json:"team_id"`
+	Score    float64   `json:"score"` // 获得的积分
+	SolvedAt time.Time `json:"solved_at"`
+}
+
+// newInstanceFlag 生成实例flag，形如 flag{32位十六进制}
+func newInstanceFlag() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return config.Current().Flag.Prefix + "{" + hex.EncodeToString(b) + "}", nil
+}
+
+// flagInjection 按配置生成注入flag的环境变量和文件
+func flagInjection(flag string) ([]string, map[string]string) {
+	var env []string
+	if name := config.Current().Flag.Env; name != "" {
+		env = append(env, name+"="+flag)
+	}
+	var files map[string]string
+	if path := config.Current().Flag.File; path != "" {
+		files = map[string]string{path: flag + "\n"}
+	}
+	return env, files
+}
+
+// SubmitFlag 提交flag，只接受自己的个人实例或所在团队实例的flag，解出后获得漏洞环境的奖励积分。
+// 团队实例的flag每个团队只能提交一次，防止队员重复获得积分
+func (u *UserService) SubmitFlag(flag string) (*SolveDTO, error) {
+	flag = strings.TrimSpace(flag)
+	if flag == "" {
+		return nil, ErrWrongFlag
+	}
+	instance, err := model.GetVulInstanceByFlag(flag)
+	if err != nil {
+		return nil, ErrWrongFlag
+	}
+	owned := instance.TeamID == 0 && instance.UserID == u.ID
+	if instance.TeamID != 0 {
+		owned = u.IsTeamMember(instance.TeamID)
+	}
+	if !owned {
+		// 其他用户实例的flag，可能是共享flag
+		middleware.SugarLogger.Warnw("提交了其他实例的flag", "userID", u.ID, "instanceID", instance.ID,
+			"ownerID", instance.UserID, "teamID", instance.TeamID)
+		return nil, ErrWrongFlag
+	}
+	vulEnv, err := model.GetVulEnvByID(instance.VulEnvID)
+	if err != nil {
+		return nil, errors.New("环境不存在")
+	}
+	solve := model.Solve{
+		UserID:     u.ID,
+		VulEnvID:   vulEnv.ID,
+		TeamID:     instance.TeamID,
+		InstanceID: instance.ID,
+		Score:      vulEnv.Reward,
+		SolvedAt:   time.Now(),
+	}
+	if err := model.CreateSolve(&solve); err != nil {
+		return nil, err
+	}
+	Scoreboards.Invalidate()
+	// 记录学生在作业中的进度
+	if err := model.RecordAssignmentSolve(u.ID, vulEnv.ID, solve.SolvedAt); err != nil {
+		middleware.SugarLogger.Warnw("记录作业进度失败", "userID", u.ID, "vulEnvID", vulEnv.ID, "error", err.Error())
+	}
+	middleware.SugarLogger.Infow("用户解出漏洞环境", "userID", u.ID, "vulEnvID", vulEnv.ID, "teamID", instance.TeamID,
+		"score", solve.Score)
+	return &SolveDTO{
+		VulEnvID: vulEnv.ID,
+		EnvName:  vulEnv.EnvName,
+		TeamID:   instance.TeamID,
+		Score:    solve.Score,
+		SolvedAt: solve.SolvedAt,
+	}, nil
+}
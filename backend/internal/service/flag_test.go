@@ -0,0 +1,142 @@
+package service
+
+import (
+	"AscensionPath/internal/model"
+	"AscensionPath/internal/utils"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestInstanceFlag(t *testing.T) {
+	conf := useTestDB(t)
+	a, _ := newInstanceFlag()
+	b, _ := newInstanceFlag()
+	if !regexp.MustCompile(`^flag\{[0-9a-f]{32}\}$`).MatchString(a) || a == b {
+		t.Errorf("flag格式不正确或重复: %s %s", a, b)
+	}
+
+	env, files := flagInjection(a)
+	if len(env) != 1 || env[0] != "FLAG="+a || files != nil {
+		t.Errorf("默认只注入环境变量: %v %v", env, files)
+	}
+	conf.Flag.Env, conf.Flag.File = "", "/flag"
+	env, files = flagInjection(a)
+	if env != nil || files["/flag"] != a+"\n" {
+		t.Errorf("只写入文件: %v %v", env, files)
+	}
+}
+
+func TestSubmitFlag(t *testing.T) {
+	useTestDB(t)
+	var users []*UserService
+	for _, name := range []string{"alice", "bob", "carol"} {
+		user := &model.User{Username: name, Password: "x", Email: name + "@example.com", Status: 1, Role: RoleUser}
+		if err := model.CreateUser(user); err != nil {
+			t.Fatal(err)
+		}
+		users = append(users, &UserService{UserDTO: UserDTO{ID: user.ID, Username: name, Role: RoleUser}})
+	}
+	alice, bob, carol := users[0], users[1], users[2]
+	env := &model.VulEnv{EnvName: "sqli", EnvType: "单镜像", BaseImage: "sqli", Reward: 10}
+	model.CreateVulEnv(env)
+	team := &model.Team{Name: "red", CreatedBy: alice.ID}
+	model.CreateTeam(team)
+	model.SetTeamMember(team.ID, alice.ID, model.TeamRoleCaptain)
+	model.SetTeamMember(team.ID, bob.ID, model.TeamRoleMember)
+
+	own := &model.VulInstance{UserID: alice.ID, VulEnvID: env.ID, Status: 1, Flag: "flag{alice}"}
+	shared := &model.VulInstance{UserID: alice.ID, TeamID: team.ID, VulEnvID: env.ID, Status: 1, Flag: "flag{team}"}
+	model.CreateVulInstance(own)
+	model.CreateVulInstance(shared)
+
+	// 学生的作业进度记录解出
+	course := &model.Course{Name: "Web安全", InstructorID: 100}
+	model.CreateCourse(course)
+	model.EnrollStudent(course.ID, alice.ID)
+	now := time.Now()
+	assignment := &model.Assignment{CourseID: course.ID, Title: "第一周", OpenAt: now.Add(-time.Hour), DueAt: now.Add(time.Hour),
+		Envs: []model.AssignmentEnv{{VulEnvID: env.ID}}}
+	model.CreateAssignment(assignment)
+
+	for _, flag := range []string{"", "flag{wrong}"} {
+		if _, err := alice.SubmitFlag(flag); err != ErrWrongFlag {
+			t.Errorf("SubmitFlag(%q) = %v", flag, err)
+		}
+	}
+	// 其他用户的flag无效
+	if _, err := carol.SubmitFlag("flag{alice}"); err != ErrWrongFlag {
+		t.Errorf("提交其他用户的flag应失败: %v", err)
+	}
+	solve, err := alice.SubmitFlag(" flag{alice} ")
+	if err != nil || solve.Score != 10 || solve.EnvName != "sqli" || solve.TeamID != 0 {
+		t.Fatalf("SubmitFlag = %+v, %v", solve, err)
+	}
+	if _, err := alice.SubmitFlag("flag{alice}"); err != utils.ErrAlreadySolved {
+		t.Errorf("重复提交应返回 ErrAlreadySolved: %v", err)
+	}
+	if user, _ := model.GetUserByID(alice.ID); user.Score != 10 {
+		t.Errorf("解出后积分 = %v", user.Score)
+	}
+	progress, _ := model.GetUserAssignmentProgress(assignment.ID, alice.ID)
+	if len(progress) != 1 || progress[0].SolvedAt == nil || progress[0].LaunchedAt == nil {
+		t.Errorf("作业进度应记录解出: %+v", progress)
+	}
+
+	// 团队实例的flag只能由队员提交一次
+	if _, err := carol.SubmitFlag("flag{team}"); err != ErrWrongFlag {
+		t.Errorf("非队员提交团队flag应失败: %v", err)
+	}
+	if solve, err := bob.SubmitFlag("flag{team}"); err != nil || solve.TeamID != team.ID {
+		t.Fatalf("队员提交团队flag = %+v, %v", solve, err)
+	}
+	if _, err := alice.SubmitFlag("flag{team}"); err != ErrTeamAlreadySolved {
+		t.Errorf("团队重复提交应返回 ErrTeamAlreadySolved: %v", err)
+	}
+}
+
+func TestSubmitTeamFlagConcurrently(t *testing.T) {
+	useTestDB(t)
+	env := &model.VulEnv{EnvName: "sqli", EnvType: "单镜像", BaseImage: "sqli", Reward: 10}
+	model.CreateVulEnv(env)
+	team := &model.Team{Name: "red", CreatedBy: 1}
+	model.CreateTeam(team)
+	var members []*UserService
+	for _, name := range []string{"alice", "bob", "carol", "dave"} {
+		user := &model.User{Username: name, Password: "x", Email: name + "@example.com", Status: 1, Role: RoleUser}
+		if err := model.CreateUser(user); err != nil {
+			t.Fatal(err)
+		}
+		model.SetTeamMember(team.ID, user.ID, model.TeamRoleMember)
+		members = append(members, &UserService{UserDTO: UserDTO{ID: user.ID, Username: name, Role: RoleUser}})
+	}
+	model.CreateVulInstance(&model.VulInstance{UserID: members[0].ID, TeamID: team.ID, VulEnvID: env.ID, Status: 1, Flag: "flag{team}"})
+
+	// 队员同时提交团队flag，团队只获得一次奖励
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	solved := 0
+	for _, member := range members {
+		wg.Add(1)
+		go func(member *UserService) {
+			defer wg.Done()
+			if _, err := member.SubmitFlag("flag{team}"); err == nil {
+				mu.Lock()
+				solved++
+				mu.Unlock()
+			}
+		}(member)
+	}
+	wg.Wait()
+
+	var total float64
+	for _, member := range members {
+		user, _ := model.GetUserByID(member.ID)
+		total += user.Score
+	}
+	solves, _ := model.GetSolves(model.SolveFilter{TeamID: team.ID})
+	if solved != 1 || total != 10 || len(solves) != 1 {
+		t.Errorf("并发提交成功 %d 次，队员共获得 %v 积分，解出记录 %d 条", solved, total, len(solves))
+	}
+}
@@ -0,0 +1,189 @@
+package service
+
+import (
+	"AscensionPath/config"
+	"AscensionPath/internal/model"
+	"AscensionPath/internal/utils"
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// 健康检查状态
+const (
+	HealthOK   = "ok"
+	HealthFail = "fail"
+	HealthSkip = "skip" // 当前环境无法检查，不影响整体状态
+)
+
+// errCheckSkipped 检查项返回该错误时标记为跳过
+var errCheckSkipped = errors.New("跳过检查")
+
+// HealthCheck 单项检查结果
+type HealthCheck struct {
+	Name      string      `json:"name"`
+	Status    string      `json:"status"`
+	LatencyMs float64     `json:"latency_ms"`
+	Error     string      `json:"error,omitempty"`
+	Detail    interface{} `json:"detail,omitempty"`
+}
+
+// HealthReport 健康检查报告，任一检查失败时整体状态为fail
+type HealthReport struct {
+	Status    string        `json:"status"`
+	CheckedAt time.Time     `json:"checked_at"`
+	Checks    []HealthCheck `json:"checks"`
+}
+
+// DiskDetail 磁盘空间
+type DiskDetail struct {
+	FreeMB    uint64 `json:"free_mb"`
+	TotalMB   uint64 `json:"total_mb"`
+	MinFreeMB int    `json:"min_free_mb"`
+}
+
+type healthCheckFunc func(ctx context.Context) (interface{}, error)
+
+// Liveness 进程存活检查：后台任务是否按时运行，不依赖数据库和Docker
+func Liveness() HealthReport {
+	report := HealthReport{Status: HealthOK, CheckedAt: time.Now()}
+	for _, job := range BackgroundJobs() {
+		check := HealthCheck{Name: "job:" + job.Name, Status: HealthOK, Detail: job}
+		if job.Stale {
+			check.Status = HealthFail
+			check.Error = fmt.Sprintf("超过%s没有运行完成", 3*job.Interval.Std())
+			report.Status = HealthFail
+		}
+		report.Checks = append(report.Checks, check)
+	}
+	return report
+}
+
+// Readiness 服务就绪检查：数据库、Docker守护进程和磁盘空间，各项并发执行
+func Readiness(ctx context.Context) HealthReport {
+	checks := []struct {
+		name string
+		fn   healthCheckFunc
+	}{
+		{"database", checkDatabase},
+		{"docker", checkDocker},
+		{"disk:storage", checkStorageDisk},
+		{"disk:docker_root", checkDockerRootDisk},
+	}
+
+	timeout := config.Current().Health.CheckTimeout.Std()
+	report := HealthReport{
+		Status:    HealthOK,
+		CheckedAt: time.Now(),
+		Checks:    make([]HealthCheck, len(checks)),
+	}
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			report.Checks[i] = runHealthCheck(ctx, c.name, timeout, c.fn)
+		}()
+	}
+	wg.Wait()
+
+	for _, c := range report.Checks {
+		if c.Status == HealthFail {
+			report.Status = HealthFail
+		}
+	}
+	return report
+}
+
+// runHealthCheck 在超时时间内执行单项检查并记录耗时
+func runHealthCheck(ctx context.Context, name string, timeout time.Duration, fn healthCheckFunc) HealthCheck {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	detail, err := fn(ctx)
+	check := HealthCheck{
+		Name:      name,
+		Status:    HealthOK,
+		LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+		Detail:    detail,
+	}
+	switch {
+	case errors.Is(err, errCheckSkipped):
+		check.Status = HealthSkip
+		check.Error = err.Error()
+	case err != nil:
+		check.Status = HealthFail
+		check.Error = err.Error()
+	}
+	return check
+}
+
+func checkDatabase(ctx context.Context) (interface{}, error) {
+	return nil, model.Ping(ctx)
+}
+
+func checkDocker(ctx context.Context) (interface{}, error) {
+	if dockerCli == nil {
+		return nil, errors.New("Docker客户端未初始化")
+	}
+	ping, err := dockerCli.Ping(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{"api_version": ping.APIVersion}, nil
+}
+
+func checkStorageDisk(ctx context.Context) (interface{}, error) {
+	path, err := filepath.Abs(config.Current().Storage.ImagePath)
+	if err != nil {
+		return nil, err
+	}
+	// 目录尚未创建时检查其所在的上级目录
+	for !utils.IsPathExist(path) {
+		parent := filepath.Dir(path)
+		if parent == path {
+			break
+		}
+		path = parent
+	}
+	return checkDisk(path)
+}
+
+// checkDockerRootDisk 检查Docker数据目录的剩余空间，远程Docker守护进程的目录不在本机时跳过
+func checkDockerRootDisk(ctx context.Context) (interface{}, error) {
+	if dockerCli == nil {
+		return nil, errors.New("Docker客户端未初始化")
+	}
+	info, err := dockerCli.Info(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if info.DockerRootDir == "" || !utils.IsPathExist(info.DockerRootDir) {
+		return nil, fmt.Errorf("%w: Docker数据目录不在本机", errCheckSkipped)
+	}
+	return checkDisk(info.DockerRootDir)
+}
+
+// checkDisk 剩余空间低于 health.min_free_disk 时失败
+func checkDisk(path string) (interface{}, error) {
+	free, total, err := diskUsage(path)
+	if errors.Is(err, errors.ErrUnsupported) {
+		return nil, fmt.Errorf("%w: 当前平台不支持", errCheckSkipped)
+	}
+	if err != nil {
+		return nil, err
+	}
+	detail := DiskDetail{
+		FreeMB:    free >> 20,
+		TotalMB:   total >> 20,
+		MinFreeMB: config.Current().Health.MinFreeDisk,
+	}
+	if detail.FreeMB < uint64(detail.MinFreeMB) {
+		return detail, fmt.Errorf("剩余空间 %dMB 低于 %dMB", detail.FreeMB, detail.MinFreeMB)
+	}
+	return detail, nil
+}
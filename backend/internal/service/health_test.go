@@ -0,0 +1,139 @@
+package service
+
+import (
+	"AscensionPath/config"
+	"AscensionPath/internal/model"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// useHealthTest 准备数据库、假Docker客户端和不受磁盘剩余空间影响的配置
+func useHealthTest(t *testing.T) *fakeDocker {
+	t.Helper()
+	conf := useTestDB(t)
+	conf.Health.MinFreeDisk = 0
+	docker := useFakeDocker(t)
+	docker.rootDir = t.TempDir()
+	conf.Storage.ImagePath = t.TempDir()
+	return docker
+}
+
+func healthStatus(report HealthReport) map[string]string {
+	result := make(map[string]string)
+	for _, c := range report.Checks {
+		result[c.Name] = c.Status
+	}
+	return result
+}
+
+func TestReadiness(t *testing.T) {
+	docker := useHealthTest(t)
+
+	report := Readiness(context.Background())
+	checks := healthStatus(report)
+	if report.Status != HealthOK || checks["database"] != HealthOK || checks["docker"] != HealthOK {
+		t.Fatalf("依赖正常时应就绪: %+v", report)
+	}
+	for _, name := range []string{"disk:storage", "disk:docker_root"} {
+		// 不支持statfs的平台上跳过
+		if checks[name] != HealthOK && checks[name] != HealthSkip {
+			t.Errorf("%s 检查状态为 %s", name, checks[name])
+		}
+	}
+
+	// Docker数据目录不在本机时跳过，不影响整体状态
+	docker.rootDir = "/nonexistent/docker"
+	if report := Readiness(context.Background()); report.Status != HealthOK || healthStatus(report)["disk:docker_root"] != HealthSkip {
+		t.Fatalf("远程Docker的数据目录应跳过检查: %+v", report)
+	}
+
+	// 剩余空间不足时失败
+	config.Current().Health.MinFreeDisk = 1 << 40
+	report = Readiness(context.Background())
+	if report.Status != HealthFail || healthStatus(report)["disk:storage"] != HealthFail {
+		t.Fatalf("剩余空间不足时应未就绪: %+v", report)
+	}
+}
+
+func TestReadinessDependencyDown(t *testing.T) {
+	t.Run("docker", func(t *testing.T) {
+		docker := useHealthTest(t)
+		docker.pingErr = errors.New("connection refused")
+
+		report := Readiness(context.Background())
+		checks := healthStatus(report)
+		if report.Status != HealthFail || checks["docker"] != HealthFail || checks["disk:docker_root"] != HealthFail {
+			t.Fatalf("Docker不可用时应未就绪: %+v", report)
+		}
+		if checks["database"] != HealthOK {
+			t.Errorf("数据库检查不应受影响: %s", checks["database"])
+		}
+		if live := Liveness(); live.Status != HealthOK {
+			t.Fatalf("Docker不可用不应影响存活检查: %+v", live)
+		}
+	})
+
+	t.Run("docker客户端未初始化", func(t *testing.T) {
+		useHealthTest(t)
+		dockerCli = nil
+
+		report := Readiness(context.Background())
+		if report.Status != HealthFail || healthStatus(report)["docker"] != HealthFail {
+			t.Fatalf("Docker客户端未初始化时应未就绪: %+v", report)
+		}
+		if live := Liveness(); live.Status != HealthOK {
+			t.Fatalf("存活检查应正常: %+v", live)
+		}
+	})
+
+	t.Run("database", func(t *testing.T) {
+		useHealthTest(t)
+		if err := model.CloseDB(); err != nil {
+			t.Fatal(err)
+		}
+
+		report := Readiness(context.Background())
+		checks := healthStatus(report)
+		if report.Status != HealthFail || checks["database"] != HealthFail {
+			t.Fatalf("数据库不可用时应未就绪: %+v", report)
+		}
+		if checks["docker"] != HealthOK {
+			t.Errorf("Docker检查不应受影响: %s", checks["docker"])
+		}
+		if live := Liveness(); live.Status != HealthOK {
+			t.Fatalf("数据库不可用不应影响存活检查: %+v", live)
+		}
+	})
+}
+
+func TestLivenessStaleJob(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	release := make(chan struct{})
+	t.Cleanup(func() {
+		cancel()
+		close(release)
+		WaitBackgroundJobs()
+	})
+
+	// 任务卡住超过3个周期后存活检查失败
+	runPeriodic(ctx, "test-stuck", 5*time.Millisecond, func() error {
+		<-release
+		return nil
+	})
+	deadline := time.Now().Add(time.Second)
+	for {
+		report := Liveness()
+		if report.Status == HealthFail {
+			if healthStatus(report)["job:test-stuck"] != HealthFail {
+				t.Fatalf("应标记卡住的任务: %+v", report)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("任务卡住后存活检查应失败: %+v", report)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,176 @@
+package service
+
+import (
+	"AscensionPath/config"
+	"AscensionPath/internal/middleware"
+	"AscensionPath/internal/model"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// 未知kid时重新从数据库加载的最小间隔，防止伪造kid反复查库
+const keyReloadInterval = 10 * time.Second
+
+var ErrUnknownJwtKey = errors.New("未知的签名密钥")
+
+// KeyRing JWT签名密钥环，密钥持久化在数据库中，多个实例共享
+type KeyRing struct {
+	mu       sync.RWMutex
+	keys     []model.JwtKey // 按创建时间倒序，[0]为当前密钥，其余为宽限期内被替换的密钥
+	loadedAt time.Time
+}
+
+// JwtKeys 全局密钥环
+var JwtKeys = &KeyRing{}
+
+// Load 从数据库加载仍可验签的密钥，没有时生成一把
+func (k *KeyRing) Load() error {
+	keys, err := model.GetActiveJwtKeys(config.Current().Jwt.GracePeriod.Std())
+	if err != nil {
+		return fmt.Errorf("加载JWT密钥失败: %v", err)
+	}
+	if len(keys) == 0 {
+		key, err := newJwtKey()
+		if err != nil {
+			return err
+		}
+		if err := model.CreateJwtKey(key); err != nil {
+			return fmt.Errorf("保存JWT密钥失败: %v", err)
+		}
+		keys = []model.JwtKey{*key}
+		middleware.SugarLogger.Infow("已生成初始JWT签名密钥", "kid", key.Kid)
+	}
+
+	k.mu.Lock()
+	k.keys = keys
+	k.loadedAt = time.Now()
+	k.mu.Unlock()
+	return nil
+}
+
+// Current 获取当前用于签名的密钥
+func (k *KeyRing) Current() (string, []byte, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	if len(k.keys) == 0 {
+		return "", nil, ErrUnknownJwtKey
+	}
+	secret, err := base64.StdEncoding.DecodeString(k.keys[0].Secret)
+	if err != nil {
+		return "", nil, err
+	}
+	return k.keys[0].Kid, secret, nil
+}
+
+// Lookup 根据kid查找验签密钥：当前密钥始终有效，被替换的密钥在替换后的宽限期内有效
+func (k *KeyRing) Lookup(kid string) ([]byte, error) {
+	secret, err := k.lookup(kid)
+	if err == ErrUnknownJwtKey && k.reloadable() {
+		// 可能是其他实例刚刚轮换了密钥
+		if err := k.Load(); err != nil {
+			return nil, err
+		}
+		return k.lookup(kid)
+	}
+	return secret, err
+}
+
+func (k *KeyRing) lookup(kid string) ([]byte, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	for i, key := range k.keys {
+		if key.Kid != kid {
+			continue
+		}
+		if i > 0 && time.Since(k.keys[i-1].CreatedAt) > config.Current().Jwt.GracePeriod.Std() {
+			return nil, ErrUnknownJwtKey
+		}
+		return base64.StdEncoding.DecodeString(key.Secret)
+	}
+	return nil, ErrUnknownJwtKey
+}
+
+func (k *KeyRing) reloadable() bool {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return time.Since(k.loadedAt) > keyReloadInterval
+}
+
+// Rotate 生成新密钥作为当前密钥，原当前密钥进入宽限期
+func (k *KeyRing) Rotate() (*model.JwtKey, error) {
+	return k.rotate(time.Time{})
+}
+
+// rotate 轮换密钥，dueBefore不为零时只在最新密钥创建于dueBefore之前时轮换，已被其他实例轮换时返回nil
+func (k *KeyRing) rotate(dueBefore time.Time) (*model.JwtKey, error) {
+	key, err := newJwtKey()
+	if err != nil {
+		return nil, err
+	}
+	rotated, err := model.RotateJwtKey(key, dueBefore)
+	if err != nil {
+		return nil, fmt.Errorf("保存JWT密钥失败: %v", err)
+	}
+	if err := k.Load(); err != nil {
+		return nil, err
+	}
+	if !rotated {
+		return nil, nil
+	}
+
+	// 清理宽限期已过的旧密钥
+	if err := model.DeleteExpiredJwtKeys(config.Current().Jwt.GracePeriod.Std()); err != nil {
+		middleware.SugarLogger.Errorf("清理旧JWT密钥失败: %v", err)
+	}
+
+	middleware.SugarLogger.Infow("JWT签名密钥已轮换", "kid", key.Kid)
+	return key, nil
+}
+
+// rotateIfDue 当前密钥超过轮换周期时自动轮换，多个实例同时到期时只有一个轮换
+func (k *KeyRing) rotateIfDue() error {
+	interval := config.Current().Jwt.RotateInterval.Std()
+	if interval <= 0 {
+		return nil
+	}
+	k.mu.RLock()
+	due := len(k.keys) == 0 || time.Since(k.keys[0].CreatedAt) > interval
+	k.mu.RUnlock()
+	if !due {
+		return nil
+	}
+	_, err := k.rotate(time.Now().Add(-interval))
+	return err
+}
+
+// 生成随机密钥
+func newJwtKey() (*model.JwtKey, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("生成JWT密钥失败: %v", err)
+	}
+	return &model.JwtKey{
+		Kid:    uuid.New().String(),
+		Secret: base64.StdEncoding.EncodeToString(secret),
+	}, nil
+}
+
+// 启动定时任务：同步其他实例轮换的密钥，并按周期自动轮换，ctx取消后停止
+func StartJwtKeyRotation(ctx context.Context) {
+	runPeriodic(ctx, "jwt-key-rotation", 1*time.Minute, func() error {
+		if err := JwtKeys.Load(); err != nil {
+			return fmt.Errorf("同步JWT密钥失败: %v", err)
+		}
+		if err := JwtKeys.rotateIfDue(); err != nil {
+			return fmt.Errorf("自动轮换JWT密钥失败: %v", err)
+		}
+		return nil
+	})
+}
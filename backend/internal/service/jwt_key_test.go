@@ -0,0 +1,150 @@
+package service
+
+import (
+	"AscensionPath/config"
+	"AscensionPath/internal/model"
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+// ageJwtKeys 将所有密钥的创建时间提前，模拟时间流逝
+func ageJwtKeys(t *testing.T, d time.Duration) {
+	t.Helper()
+	keys, err := model.GetActiveJwtKeys(24 * 365 * time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range keys {
+		if err := model.DB.Model(&model.JwtKey{}).Where("id = ?", key.ID).Update("created_at", key.CreatedAt.Add(-d)).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestKeyRing(t *testing.T) {
+	conf := useTestDB(t)
+	conf.Jwt = config.JwtConfig{RotateInterval: config.Duration(time.Hour), GracePeriod: config.Duration(30 * time.Minute)}
+
+	ring := &KeyRing{}
+	if err := ring.Load(); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	oldKid, oldSecret, err := ring.Current()
+	if err != nil {
+		t.Fatalf("首次加载应生成密钥: %v", err)
+	}
+	if secret, err := ring.Lookup(oldKid); err != nil || !bytes.Equal(secret, oldSecret) {
+		t.Fatalf("当前密钥应可验签: %v", err)
+	}
+
+	// 未到轮换周期时不轮换
+	if err := ring.rotateIfDue(); err != nil {
+		t.Fatal(err)
+	}
+	if kid, _, _ := ring.Current(); kid != oldKid {
+		t.Fatal("未到轮换周期时不应轮换")
+	}
+
+	key, err := ring.Rotate()
+	if err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+	if kid, _, _ := ring.Current(); kid != key.Kid || kid == oldKid {
+		t.Fatalf("轮换后当前密钥应为新密钥: %s", kid)
+	}
+	// 宽限期内旧密钥签发的token仍可验证
+	if secret, err := ring.Lookup(oldKid); err != nil || !bytes.Equal(secret, oldSecret) {
+		t.Fatalf("宽限期内旧密钥应可验签: %v", err)
+	}
+
+	// 宽限期过后旧密钥失效，新密钥仍有效
+	ageJwtKeys(t, 40*time.Minute)
+	if err := ring.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ring.Lookup(oldKid); !errors.Is(err, ErrUnknownJwtKey) {
+		t.Fatalf("宽限期过后旧密钥应失效: %v", err)
+	}
+	if _, err := ring.Lookup(key.Kid); err != nil {
+		t.Fatalf("当前密钥应始终有效: %v", err)
+	}
+
+	// 连续轮换时，每把被替换的密钥都按各自被替换的时间计算宽限期
+	second, err := ring.Rotate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	third, err := ring.Rotate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, kid := range []string{key.Kid, second.Kid, third.Kid} {
+		if _, err := ring.Lookup(kid); err != nil {
+			t.Fatalf("宽限期内的密钥 %s 应可验签: %v", kid, err)
+		}
+	}
+	// 轮换只清理宽限期已过的密钥
+	var count int64
+	model.DB.Model(&model.JwtKey{}).Count(&count)
+	if count != 3 {
+		t.Fatalf("应清理过期的初始密钥并保留宽限期内的密钥，剩余 %d 把", count)
+	}
+}
+
+func TestKeyRingReplicas(t *testing.T) {
+	conf := useTestDB(t)
+	conf.Jwt = config.JwtConfig{RotateInterval: config.Duration(time.Hour), GracePeriod: config.Duration(30 * time.Minute)}
+
+	a, b := &KeyRing{}, &KeyRing{}
+	if err := a.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Load(); err != nil {
+		t.Fatal(err)
+	}
+	initial, _, _ := a.Current()
+	if kid, _, _ := b.Current(); kid != initial {
+		t.Fatal("多个实例应共享数据库中的密钥")
+	}
+
+	// 两个实例的密钥同时到期，a先轮换，b发现已被轮换后直接使用a的新密钥
+	ageJwtKeys(t, 2*time.Hour)
+	for _, ring := range []*KeyRing{a, b} {
+		if err := ring.Load(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := a.rotateIfDue(); err != nil {
+		t.Fatal(err)
+	}
+	rotated, _, _ := a.Current()
+	if rotated == initial {
+		t.Fatal("到期后应自动轮换")
+	}
+	if err := b.rotateIfDue(); err != nil {
+		t.Fatal(err)
+	}
+	if kid, _, _ := b.Current(); kid != rotated {
+		t.Fatalf("b应使用a轮换的密钥，实际为 %s", kid)
+	}
+	var count int64
+	model.DB.Model(&model.JwtKey{}).Count(&count)
+	if count != 2 {
+		t.Fatalf("同一周期只应轮换一次，共有 %d 把密钥", count)
+	}
+
+	// 未知kid在重新加载间隔过后才查库
+	key, err := a.Rotate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Lookup(key.Kid); !errors.Is(err, ErrUnknownJwtKey) {
+		t.Fatalf("刚加载过时不应重新查库: %v", err)
+	}
+	b.loadedAt = time.Now().Add(-2 * keyReloadInterval)
+	if _, err := b.Lookup(key.Kid); err != nil {
+		t.Fatalf("应重新加载其他实例轮换的密钥: %v", err)
+	}
+}
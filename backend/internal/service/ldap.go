@@ -0,0 +1,255 @@
+package service
+
+import (
+	"AscensionPath/config"
+	"AscensionPath/internal/middleware"
+	"AscensionPath/internal/model"
+	"AscensionPath/internal/utils"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// ldapIssuer LDAP账号在user_identities中的issuer，subject为小写的登录名
+const ldapIssuer = "ldap"
+
+// 登录失败原因，写入登录记录
+const (
+	loginReasonLDAPUnavailable = "LDAP不可用"
+	loginReasonLDAPNotLinked   = "LDAP账号无法关联"
+)
+
+var (
+	errLDAPUserNotFound = errors.New("LDAP中不存在该用户")
+	errLDAPUnavailable  = errors.New("LDAP服务暂时不可用，请稍后重试或使用本地账号登录")
+)
+
+// ldapEntry 目录中的用户
+type ldapEntry struct {
+	DN     string
+	Email  string
+	Groups []string
+}
+
+// isLDAPAccount 用户是否是通过LDAP登录的账号
+func isLDAPAccount(userID uint) bool {
+	identities, err := model.GetUserIdentitiesByUserID(userID)
+	if err != nil {
+		return false
+	}
+	for _, identity := range identities {
+		if identity.Issuer == ldapIssuer {
+			return true
+		}
+	}
+	return false
+}
+
+// ldapLogin 用目录密码登录，找到或创建对应的本地账号，失败时和本地密码一样计入登录限制
+func ldapLogin(username, password, ip, userAgent string) (*model.User, error) {
+	entry, err := ldapAuthenticate(username, password)
+	switch {
+	case errors.Is(err, errLDAPUserNotFound):
+		middleware.SugarLogger.Warnw("LDAP用户不存在", "username", username)
+		recordLoginFailure(username, ip)
+		recordLoginHistory(0, username, ip, userAgent, false, loginReasonUserNotFound)
+		return nil, utils.ErrInvalidCredentials
+	case errors.Is(err, utils.ErrInvalidCredentials):
+		middleware.SugarLogger.Warnw("LDAP密码验证失败", "username", username)
+		recordLoginFailure(username, ip)
+		recordLoginHistory(0, username, ip, userAgent, false, loginReasonWrongPassword)
+		return nil, utils.ErrInvalidCredentials
+	case err != nil:
+		middleware.SugarLogger.Errorw("LDAP认证失败", "username", username, "error", err.Error())
+		recordLoginHistory(0, username, ip, userAgent, false, loginReasonLDAPUnavailable)
+		return nil, errLDAPUnavailable
+	}
+
+	user, err := resolveLDAPUser(username, entry)
+	if err != nil {
+		middleware.SugarLogger.Warnw("LDAP账号关联失败", "username", username, "dn", entry.DN, "error", err.Error())
+		recordLoginHistory(0, username, ip, userAgent, false, loginReasonLDAPNotLinked)
+		return nil, err
+	}
+	return user, nil
+}
+
+// resolveLDAPUser 按LDAP身份查找本地账号，没有时自动创建；同名的本地账号不会被关联，避免目录用户接管本地管理员
+func resolveLDAPUser(username string, entry *ldapEntry) (*model.User, error) {
+	conf := config.Current().LDAP
+	subject := strings.ToLower(username)
+	role := mapLDAPRole(entry.Groups)
+	if role == "" {
+		role = defaultLDAPRole()
+	}
+
+	if identity, err := model.GetUserIdentity(ldapIssuer, subject); err == nil {
+		user, err := model.GetUserByID(identity.UserID)
+		if err == nil {
+			model.TouchUserIdentity(identity.ID, entry.Email)
+			if conf.SyncRole {
+				syncExternalRole(user, role, "LDAP")
+			}
+			return user, nil
+		}
+		// 关联的用户已被删除，按新用户处理
+		model.DeleteUserIdentity(identity.ID)
+	}
+
+	if !conf.AutoProvision {
+		return nil, errors.New("账号未开通，请联系管理员")
+	}
+	if _, err := model.GetUserByUsername(username); err == nil {
+		return nil, errors.New("本地已存在同名账号，请联系管理员")
+	}
+	if entry.Email == "" {
+		return nil, errors.New("LDAP中没有该用户的邮箱，无法创建账号")
+	}
+	if _, err := model.GetUserByEmail(entry.Email); err == nil {
+		return nil, errors.New("该邮箱已被其他账号使用，请联系管理员")
+	}
+	hashed, err := randomPasswordHash()
+	if err != nil {
+		return nil, err
+	}
+	user := &model.User{
+		Username: username,
+		Password: hashed,
+		Email:    entry.Email,
+		Status:   1,
+		Role:     role,
+	}
+	identity := &model.UserIdentity{Issuer: ldapIssuer, Subject: subject, Email: entry.Email, LastLoginAt: time.Now()}
+	if err := model.CreateUserWithIdentity(user, identity); err != nil {
+		return nil, fmt.Errorf("创建账号失败: %v", err)
+	}
+	middleware.SugarLogger.Infow("LDAP自动创建账号", "userID", user.ID, "username", user.Username, "role", role, "dn", entry.DN)
+	return user, nil
+}
+
+// ldapAuthenticate 用服务账号查找用户和所属组，再以用户DN和密码绑定校验密码
+func ldapAuthenticate(username, password string) (*ldapEntry, error) {
+	conf := config.Current().LDAP
+	// 空密码的简单绑定在多数服务器上是匿名绑定，会被当作认证成功
+	if password == "" {
+		return nil, utils.ErrInvalidCredentials
+	}
+	conn, err := ldapDial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if conf.BindDN != "" {
+		if err := conn.Bind(conf.BindDN, conf.BindPassword); err != nil {
+			return nil, fmt.Errorf("服务账号绑定失败: %v", err)
+		}
+	}
+	result, err := conn.Search(ldap.NewSearchRequest(
+		conf.UserBaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, int(conf.Timeout.Std().Seconds()), false,
+		fmt.Sprintf(conf.UserFilter, ldap.EscapeFilter(username)),
+		[]string{conf.EmailAttribute, conf.GroupAttribute}, nil,
+	))
+	if ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) || (err == nil && len(result.Entries) > 1) {
+		middleware.SugarLogger.Warnw("LDAP中有多个匹配的用户", "username", username)
+		return nil, errLDAPUserNotFound
+	}
+	if ldap.IsErrorWithCode(err, ldap.LDAPResultNoSuchObject) || (err == nil && len(result.Entries) == 0) {
+		return nil, errLDAPUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("查找用户失败: %v", err)
+	}
+	found := result.Entries[0]
+	entry := &ldapEntry{
+		DN:     found.DN,
+		Email:  found.GetEqualFoldAttributeValue(conf.EmailAttribute),
+		Groups: found.GetEqualFoldAttributeValues(conf.GroupAttribute),
+	}
+	if conf.GroupBaseDN != "" {
+		groups, err := conn.Search(ldap.NewSearchRequest(
+			conf.GroupBaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, int(conf.Timeout.Std().Seconds()), false,
+			fmt.Sprintf(conf.GroupFilter, ldap.EscapeFilter(found.DN)),
+			[]string{"1.1"}, nil,
+		))
+		if err != nil {
+			return nil, fmt.Errorf("查找用户组失败: %v", err)
+		}
+		for _, g := range groups.Entries {
+			entry.Groups = append(entry.Groups, g.DN)
+		}
+	}
+
+	if err := conn.Bind(found.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, utils.ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("用户绑定失败: %v", err)
+	}
+	return entry, nil
+}
+
+// ldapDial 连接LDAP服务器，按配置使用LDAPS或StartTLS
+func ldapDial() (*ldap.Conn, error) {
+	conf := config.Current().LDAP
+	tlsConfig := &tls.Config{InsecureSkipVerify: conf.InsecureSkipVerify}
+	if u, err := url.Parse(conf.URL); err == nil {
+		tlsConfig.ServerName = u.Hostname()
+	}
+	conn, err := ldap.DialURL(conf.URL,
+		ldap.DialWithDialer(&net.Dialer{Timeout: conf.Timeout.Std()}),
+		ldap.DialWithTLSConfig(tlsConfig))
+	if err != nil {
+		return nil, fmt.Errorf("连接LDAP失败: %v", err)
+	}
+	conn.SetTimeout(conf.Timeout.Std())
+	if conf.StartTLS {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("StartTLS失败: %v", err)
+		}
+	}
+	return conn, nil
+}
+
+// mapLDAPRole 按ldap.role_mapping映射用户所属组的DN(不区分大小写)，匹配多个时取开放级别最高(数值最小)的身份，没有匹配时返回空
+func mapLDAPRole(groups []string) string {
+	var groupDNs []*ldap.DN
+	for _, g := range groups {
+		if dn, err := ldap.ParseDN(g); err == nil {
+			groupDNs = append(groupDNs, dn)
+		}
+	}
+	role := ""
+	for _, pair := range strings.Split(config.Current().LDAP.RoleMapping, ";") {
+		// 组DN中也有"="，按最后一个"="拆分
+		i := strings.LastIndex(pair, "=")
+		if i < 0 {
+			continue
+		}
+		mapped := strings.TrimSpace(pair[i+1:])
+		want, err := ldap.ParseDN(strings.TrimSpace(pair[:i]))
+		if err != nil || !IsValidRole(mapped) {
+			continue
+		}
+		for _, dn := range groupDNs {
+			if dn.EqualFold(want) && (role == "" || RoleLevel(mapped) < RoleLevel(role)) {
+				role = mapped
+			}
+		}
+	}
+	return role
+}
+
+func defaultLDAPRole() string {
+	if role := config.Current().LDAP.DefaultRole; IsValidRole(role) {
+		return role
+	}
+	return RoleUser
+}
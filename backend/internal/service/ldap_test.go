@@ -0,0 +1,223 @@
+package service
+
+import (
+	"AscensionPath/config"
+	"AscensionPath/internal/middleware"
+	"AscensionPath/internal/mockldap"
+	"AscensionPath/internal/model"
+	"AscensionPath/internal/utils"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const testLDAPBase = "dc=example,dc=edu"
+
+// TestMain 将测试日志写到临时目录，避免在源码目录下生成日志文件
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "ascension-service-test")
+	if err != nil {
+		panic(err)
+	}
+	logConf := config.Default().Log
+	logConf.File = filepath.Join(dir, "app.log")
+	middleware.InitLogger(logConf)
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// useTestDB 使用临时SQLite数据库并加载预置的身份，测试结束后恢复全局配置
+func useTestDB(t *testing.T) *config.Config {
+	t.Helper()
+	dbConf := config.Default().Database
+	dbConf.DSN = filepath.Join(t.TempDir(), "test.db")
+	db, err := model.Open(dbConf)
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	if _, err := model.MigrateUp(db, 0, false); err != nil {
+		t.Fatalf("迁移数据表失败: %v", err)
+	}
+
+	conf := config.Default()
+	conf.Login.BaseDelay = 0
+	oldDB, oldConf := model.DB, config.Current()
+	model.DB = db
+	config.Set(conf)
+	t.Cleanup(func() {
+		model.CloseDB()
+		model.DB = oldDB
+		config.Set(oldConf)
+		Scoreboards.Invalidate()
+	})
+	if err := Roles.Load(); err != nil {
+		t.Fatal(err)
+	}
+	return conf
+}
+
+// useLDAPTest 在临时数据库的基础上启动进程内LDAP服务器
+func useLDAPTest(t *testing.T) (*config.Config, *mockldap.Server) {
+	t.Helper()
+	conf := useTestDB(t)
+	server, err := mockldap.Start("127.0.0.1:0", mockldap.Directory(testLDAPBase, "readonly", []mockldap.User{
+		{Username: "alice", Password: "alice123", Email: "alice@example.edu", Groups: []string{"students"}},
+		{Username: "tom", Password: "tom123", Email: "tom@example.edu", Groups: []string{"teachers", "it"}},
+		{Username: "root", Password: "directory", Email: "root@example.edu", Groups: []string{"it"}},
+		{Username: "nomail", Password: "nomail123"},
+	}))
+	if err != nil {
+		t.Fatalf("启动LDAP服务器失败: %v", err)
+	}
+	t.Cleanup(func() { server.Close() })
+
+	conf.LDAP.Enabled = true
+	conf.LDAP.URL = server.URL()
+	conf.LDAP.BindDN = "cn=readonly," + testLDAPBase
+	conf.LDAP.BindPassword = "readonly"
+	conf.LDAP.UserBaseDN = "ou=people," + testLDAPBase
+	conf.LDAP.RoleMapping = "cn=teachers,ou=groups," + testLDAPBase + "=vip;CN=IT,OU=Groups," + testLDAPBase + "=admin"
+	return conf, server
+}
+
+func createLocalUser(t *testing.T, username, password, role string) *model.User {
+	t.Helper()
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := &model.User{Username: username, Password: string(hashed), Email: username + "@local", Status: 1, Role: role}
+	if err := model.CreateUser(user); err != nil {
+		t.Fatalf("创建本地用户失败: %v", err)
+	}
+	return user
+}
+
+func TestLDAPLogin(t *testing.T) {
+	useLDAPTest(t)
+	s := &UserService{}
+
+	user, err := s.Login("alice", "alice123", "127.0.0.1", "test")
+	if err != nil {
+		t.Fatalf("LDAP登录失败: %v", err)
+	}
+	if user.Email != "alice@example.edu" || user.Role != RoleUser || user.Status != 1 {
+		t.Fatalf("自动创建的账号不正确: %+v", user)
+	}
+	if !isLDAPAccount(user.ID) {
+		t.Fatal("自动创建的账号应关联LDAP身份")
+	}
+	again, err := s.Login("Alice", "alice123", "127.0.0.1", "test")
+	if err != nil || again.ID != user.ID {
+		t.Fatalf("再次登录应使用同一账号: %v", err)
+	}
+
+	if _, err := s.Login("alice", "wrong", "127.0.0.1", "test"); !errors.Is(err, utils.ErrInvalidCredentials) {
+		t.Fatalf("密码错误应返回ErrInvalidCredentials，实际为 %v", err)
+	}
+	if _, err := s.Login("alice", "", "127.0.0.1", "test"); !errors.Is(err, utils.ErrInvalidCredentials) {
+		t.Fatalf("空密码不能通过匿名绑定登录，实际为 %v", err)
+	}
+	if _, err := s.Login("nobody", "x", "127.0.0.1", "test"); !errors.Is(err, utils.ErrInvalidCredentials) {
+		t.Fatalf("不存在的用户应返回ErrInvalidCredentials，实际为 %v", err)
+	}
+	if _, err := s.Login("*", "alice123", "127.0.0.1", "test"); !errors.Is(err, utils.ErrInvalidCredentials) {
+		t.Fatalf("用户名中的过滤器字符应被转义，实际为 %v", err)
+	}
+	if _, err := s.Login("nomail", "nomail123", "127.0.0.1", "test"); err == nil {
+		t.Fatal("没有邮箱的LDAP用户不能自动创建账号")
+	}
+
+	op := &UserService{UserDTO: UserDTO{ID: user.ID, Role: user.Role}}
+	if err := op.ChangePassword(user.ID, "alice123", "newpassword"); err != ErrLDAPPassword {
+		t.Fatalf("LDAP账号不能修改本地密码: %v", err)
+	}
+	// 管理员通过修改用户信息设置密码同样不允许
+	admin := createLocalUser(t, "root", "root123", RoleAdmin)
+	manager := &UserService{UserDTO: UserDTO{ID: admin.ID, Role: admin.Role}}
+	if err := manager.UpdateProfile(user.ID, "", -1, "", -1, "", "newpassword"); err != ErrLDAPPassword {
+		t.Fatalf("管理员不能为LDAP账号设置本地密码: %v", err)
+	}
+	if err := op.UpdateProfile(user.ID, "", -1, "", -1, "", "newpassword"); err != ErrLDAPPassword {
+		t.Fatalf("LDAP账号不能通过修改信息设置本地密码: %v", err)
+	}
+	if got, _ := model.GetUserByID(user.ID); got.MustChangePassword {
+		t.Error("拒绝设置密码时不应修改账号")
+	}
+}
+
+func TestLDAPRoleMapping(t *testing.T) {
+	conf, _ := useLDAPTest(t)
+	s := &UserService{}
+
+	tom, err := s.Login("tom", "tom123", "127.0.0.1", "test")
+	if err != nil {
+		t.Fatalf("LDAP登录失败: %v", err)
+	}
+	if tom.Role != RoleAdmin {
+		t.Fatalf("匹配多个组时应取权限最高的身份，实际为 %s", tom.Role)
+	}
+
+	// 最后一个管理员不会被降级
+	conf.LDAP.RoleMapping = "cn=teachers,ou=groups," + testLDAPBase + "=vip"
+	if tom, err = s.Login("tom", "tom123", "127.0.0.1", "test"); err != nil || tom.Role != RoleAdmin {
+		t.Fatalf("最后一个管理员不应被降级: role=%s err=%v", tom.Role, err)
+	}
+	createLocalUser(t, "admin", "localpass", RoleAdmin)
+	if tom, err = s.Login("tom", "tom123", "127.0.0.1", "test"); err != nil || tom.Role != "vip" {
+		t.Fatalf("应按映射同步身份: role=%s err=%v", tom.Role, err)
+	}
+
+	conf.LDAP.SyncRole = false
+	conf.LDAP.RoleMapping = ""
+	if tom, err = s.Login("tom", "tom123", "127.0.0.1", "test"); err != nil || tom.Role != "vip" {
+		t.Fatalf("关闭sync_role后不应修改身份: role=%s err=%v", tom.Role, err)
+	}
+}
+
+func TestLDAPGroupSearch(t *testing.T) {
+	conf, _ := useLDAPTest(t)
+	conf.LDAP.GroupAttribute = "none"
+	conf.LDAP.GroupBaseDN = "ou=groups," + testLDAPBase
+	conf.LDAP.GroupFilter = "(&(objectClass=groupOfNames)(member=%s))"
+
+	user, err := (&UserService{}).Login("tom", "tom123", "127.0.0.1", "test")
+	if err != nil {
+		t.Fatalf("LDAP登录失败: %v", err)
+	}
+	if user.Role != RoleAdmin {
+		t.Fatalf("按group_filter查找组后应映射为admin，实际为 %s", user.Role)
+	}
+}
+
+func TestLDAPLocalFallback(t *testing.T) {
+	conf, server := useLDAPTest(t)
+	s := &UserService{}
+	// 目录中也有root，但本地账号始终使用本地密码，不能被目录用户接管
+	createLocalUser(t, "root", "localpass", RoleAdmin)
+
+	if _, err := s.Login("root", "directory", "127.0.0.1", "test"); !errors.Is(err, utils.ErrInvalidCredentials) {
+		t.Fatalf("本地账号不能使用目录密码登录，实际为 %v", err)
+	}
+	if _, err := s.Login("root", "localpass", "127.0.0.1", "test"); err != nil {
+		t.Fatalf("本地账号登录失败: %v", err)
+	}
+
+	server.Close()
+	if _, err := s.Login("root", "localpass", "127.0.0.1", "test"); err != nil {
+		t.Fatalf("LDAP不可用时本地账号应仍能登录: %v", err)
+	}
+	if _, err := s.Login("alice", "alice123", "127.0.0.1", "test"); !errors.Is(err, errLDAPUnavailable) {
+		t.Fatalf("LDAP不可用时应返回errLDAPUnavailable，实际为 %v", err)
+	}
+
+	conf.LDAP.Enabled = false
+	if _, err := s.Login("alice", "alice123", "127.0.0.1", "test"); !errors.Is(err, utils.ErrInvalidCredentials) {
+		t.Fatalf("关闭LDAP后不应再查询目录，实际为 %v", err)
+	}
+}
@@ -0,0 +1,252 @@
+package service
+
+import (
+	"AscensionPath/config"
+	"AscensionPath/internal/middleware"
+	"AscensionPath/internal/model"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 停机时对运行中实例的处理策略
+const (
+	InstancePolicyKeep   = "keep"   // 保持运行
+	InstancePolicyStop   = "stop"   // 停止容器，保留实例记录
+	InstancePolicyRemove = "remove" // 删除容器并结束实例
+)
+
+var ErrShuttingDown = errors.New("服务正在停止，暂不接受新的操作")
+
+// 长耗时操作(镜像拉取/构建)跟踪
+var (
+	opsMu     sync.Mutex
+	opsWG     sync.WaitGroup
+	draining  bool
+	opsCtx    context.Context
+	cancelOps context.CancelFunc
+	jobsWG    sync.WaitGroup
+)
+
+func init() {
+	opsCtx, cancelOps = context.WithCancel(context.Background())
+}
+
+// BeginOperation 登记一个长耗时操作，停机时会等待其完成，超时后取消返回的ctx
+func BeginOperation() (context.Context, func(), error) {
+	opsMu.Lock()
+	defer opsMu.Unlock()
+	if draining {
+		return nil, nil, ErrShuttingDown
+	}
+	opsWG.Add(1)
+	ctx, cancel := context.WithCancel(opsCtx)
+	var once sync.Once
+	return ctx, func() {
+		once.Do(func() {
+			cancel()
+			opsWG.Done()
+		})
+	}, nil
+}
+
+// DrainOperations 拒绝新的长耗时操作并等待已有操作结束，ctx到期后强制取消
+func DrainOperations(ctx context.Context) error {
+	opsMu.Lock()
+	draining = true
+	opsMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		opsWG.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		middleware.SugarLogger.Warn("等待镜像拉取/构建超时，强制取消")
+		cancelOps()
+		<-done
+		return ctx.Err()
+	}
+}
+
+// 后台任务运行状态，供健康检查判断任务是否按时运行
+var (
+	jobsMu sync.Mutex
+	jobs   = map[string]*jobState{}
+)
+
+type jobState struct {
+	interval  time.Duration
+	startedAt time.Time
+	lastRun   time.Time
+	lastErr   error
+}
+
+// JobStatus 后台任务状态
+type JobStatus struct {
+	Name      string          `json:"name"`
+	Interval  config.Duration `json:"interval"`
+	LastRun   *time.Time      `json:"last_run,omitempty"`
+	LastError string          `json:"last_error,omitempty"`
+	Stale     bool            `json:"stale"` // 超过3个周期没有运行完成
+}
+
+// runPeriodic 周期执行后台任务直到ctx取消，记录每次运行的完成时间和错误
+func runPeriodic(ctx context.Context, name string, interval time.Duration, fn func() error) {
+	jobsMu.Lock()
+	state := &jobState{interval: interval, startedAt: time.Now()}
+	jobs[name] = state
+	jobsMu.Unlock()
+
+	jobsWG.Add(1)
+	go func() {
+		defer jobsWG.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				jobsMu.Lock()
+				delete(jobs, name)
+				jobsMu.Unlock()
+				middleware.SugarLogger.Infof("后台任务 %s 已停止", name)
+				return
+			case <-ticker.C:
+				err := fn()
+				if err != nil {
+					middleware.SugarLogger.Errorf("后台任务 %s 执行失败: %v", name, err)
+				}
+				jobsMu.Lock()
+				state.lastRun = time.Now()
+				state.lastErr = err
+				jobsMu.Unlock()
+			}
+		}
+	}()
+}
+
+// BackgroundJobs 获取运行中的后台任务状态
+func BackgroundJobs() []JobStatus {
+	jobsMu.Lock()
+	defer jobsMu.Unlock()
+
+	result := make([]JobStatus, 0, len(jobs))
+	for name, state := range jobs {
+		last := state.lastRun
+		if last.IsZero() {
+			last = state.startedAt
+		}
+		status := JobStatus{
+			Name:     name,
+			Interval: config.Duration(state.interval),
+			Stale:    time.Since(last) > 3*state.interval,
+		}
+		if !state.lastRun.IsZero() {
+			lastRun := state.lastRun
+			status.LastRun = &lastRun
+		}
+		if state.lastErr != nil {
+			status.LastError = state.lastErr.Error()
+		}
+		result = append(result, status)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// WaitBackgroundJobs 等待所有后台任务退出
+func WaitBackgroundJobs() {
+	jobsWG.Wait()
+}
+
+// IsValidInstancePolicy 判断停机策略是否合法
+func IsValidInstancePolicy(policy string) bool {
+	switch policy {
+	case InstancePolicyKeep, InstancePolicyStop, InstancePolicyRemove:
+		return true
+	default:
+		return false
+	}
+}
+
+// ApplyShutdownPolicy 停机时按策略处理运行中的实例
+func (v *VulService) ApplyShutdownPolicy(policy string) error {
+	if policy == InstancePolicyKeep {
+		return nil
+	}
+	if !IsValidInstancePolicy(policy) {
+		return fmt.Errorf("无效的实例停机策略: %s", policy)
+	}
+
+	instances, err := model.GetAllVulInstances()
+	if err != nil {
+		return err
+	}
+
+	var lastError error
+	for _, instance := range instances {
+		if instance.Status != 1 { // 仅处理运行中的实例
+			continue
+		}
+		switch policy {
+		case InstancePolicyStop:
+			err = v.stopInstance(&instance)
+		case InstancePolicyRemove:
+			err = v.removeInstance(&instance)
+		}
+		if err != nil {
+			middleware.SugarLogger.Errorf("停机处理实例 %d 失败: %v", instance.ID, err)
+			lastError = err
+		}
+	}
+
+	// 兜底删除本进程创建但未记录到实例表的容器
+	if policy == InstancePolicyRemove {
+		if err := RemoveAllCreatedContainers(); err != nil {
+			lastError = err
+		}
+	}
+	return lastError
+}
+
+// stopInstance 停止实例的容器并标记为已停止
+func (v *VulService) stopInstance(instance *model.VulInstance) error {
+	if instance.ContainerID != "" {
+		if err := StopContainer(instance.ContainerID); err != nil {
+			return err
+		}
+	} else if instance.StackName != "" {
+		if err := StopStackByName(instance.StackName); err != nil {
+			return err
+		}
+	}
+	instance.Status = 2 // 2 表示已停止
+	instance.EndTime = time.Now()
+	return model.UpdateVulInstance(instance)
+}
+
+// removeInstance 删除实例的容器，标记为已完成后删除实例记录
+func (v *VulService) removeInstance(instance *model.VulInstance) error {
+	if instance.ContainerID != "" {
+		if err := RemoveContainer(instance.ContainerID, true); err != nil {
+			return err
+		}
+	} else if instance.StackName != "" {
+		if err := RemoveStackByName(instance.StackName); err != nil {
+			return err
+		}
+	}
+	instance.Status = 3 // 3 表示已完成
+	instance.EndTime = time.Now()
+	if err := model.UpdateVulInstance(instance); err != nil {
+		return err
+	}
+	return model.DeleteVulInstance(instance.ID)
+}
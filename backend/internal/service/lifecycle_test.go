@@ -0,0 +1,236 @@
+package service
+
+import (
+	"AscensionPath/internal/model"
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// resetOperations 恢复长耗时操作的全局状态，DrainOperations之后仍可继续测试
+func resetOperations(t *testing.T) {
+	t.Helper()
+	t.Cleanup(func() {
+		opsMu.Lock()
+		draining = false
+		opsCtx, cancelOps = context.WithCancel(context.Background())
+		opsMu.Unlock()
+	})
+}
+
+func findJob(name string) (JobStatus, bool) {
+	for _, job := range BackgroundJobs() {
+		if job.Name == name {
+			return job, true
+		}
+	}
+	return JobStatus{}, false
+}
+
+func TestDrainOperations(t *testing.T) {
+	resetOperations(t)
+	ctx, done, err := BeginOperation()
+	if err != nil {
+		t.Fatalf("BeginOperation: %v", err)
+	}
+
+	drained := make(chan error, 1)
+	go func() { drained <- DrainOperations(context.Background()) }()
+
+	// 停机开始后拒绝新的操作，已有操作继续执行
+	deadline := time.Now().Add(time.Second)
+	for {
+		_, release, err := BeginOperation()
+		if errors.Is(err, ErrShuttingDown) {
+			break
+		}
+		release()
+		if time.Now().After(deadline) {
+			t.Fatal("停机后应拒绝新的操作")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case err := <-drained:
+		t.Fatalf("操作完成前不应结束等待: %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	if ctx.Err() != nil {
+		t.Fatal("未超时时不应取消进行中的操作")
+	}
+
+	done()
+	done() // 重复调用无影响
+	if err := <-drained; err != nil {
+		t.Fatalf("操作完成后应正常结束: %v", err)
+	}
+}
+
+func TestDrainOperationsTimeout(t *testing.T) {
+	resetOperations(t)
+	ctx, done, err := BeginOperation()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 模拟收到取消后才退出的镜像拉取
+	go func() {
+		<-ctx.Done()
+		done()
+	}()
+
+	timeout, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := DrainOperations(timeout); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("超时后应返回 DeadlineExceeded: %v", err)
+	}
+	if ctx.Err() == nil {
+		t.Fatal("超时后应取消进行中的操作")
+	}
+}
+
+func TestRunPeriodic(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var calls atomic.Int32
+	var failing atomic.Bool
+	failing.Store(true)
+	runPeriodic(ctx, "test-periodic", 5*time.Millisecond, func() error {
+		calls.Add(1)
+		if failing.Load() {
+			return errors.New("执行失败")
+		}
+		return nil
+	})
+
+	job, ok := findJob("test-periodic")
+	if !ok || job.LastRun != nil || job.Stale {
+		t.Fatalf("启动后尚未运行的任务状态: %+v", job)
+	}
+
+	// 失败时记录错误，恢复后清除
+	waitJob := func(cond func(JobStatus) bool, msg string) {
+		t.Helper()
+		deadline := time.Now().Add(time.Second)
+		for {
+			if job, ok := findJob("test-periodic"); ok && cond(job) {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatal(msg)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	waitJob(func(job JobStatus) bool { return job.LastRun != nil && job.LastError == "执行失败" }, "任务失败时应记录错误")
+	failing.Store(false)
+	waitJob(func(job JobStatus) bool { return job.LastError == "" }, "任务成功后应清除错误")
+	if job, _ := findJob("test-periodic"); job.Stale {
+		t.Fatalf("按时运行的任务不应过期: %+v", job)
+	}
+
+	cancel()
+	WaitBackgroundJobs()
+	if _, ok := findJob("test-periodic"); ok {
+		t.Fatal("ctx取消后任务应退出并移除状态")
+	}
+	stopped := calls.Load()
+	time.Sleep(20 * time.Millisecond)
+	if calls.Load() != stopped {
+		t.Fatal("任务退出后不应再运行")
+	}
+}
+
+func TestCleanExpiredInstances(t *testing.T) {
+	useTestDB(t)
+	docker := useFakeDocker(t)
+	user := createLocalUser(t, "alice", "alice123", RoleUser)
+	env := &model.VulEnv{EnvName: "sqli", EnvType: "单镜像", BaseImage: "sqli"}
+	model.CreateVulEnv(env)
+
+	now := time.Now()
+	docker.add("expired", "expired", "running", now, nil)
+	docker.add("active", "active", "running", now, nil)
+	expired := &model.VulInstance{UserID: user.ID, VulEnvID: env.ID, Status: model.InstanceStatusRunning, ContainerID: "expired", ExpireTime: now.Add(-time.Minute)}
+	active := &model.VulInstance{UserID: user.ID, VulEnvID: env.ID, Status: model.InstanceStatusRunning, ContainerID: "active", ExpireTime: now.Add(time.Hour)}
+	model.CreateVulInstance(expired)
+	model.CreateVulInstance(active)
+
+	v := &VulService{}
+	result, err := v.CleanExpiredInstances(true)
+	if err != nil || len(result) != 1 || result[0].ID != expired.ID {
+		t.Fatalf("dryRun应返回过期的实例: %+v, %v", result, err)
+	}
+	if docker.wasRemoved("expired") {
+		t.Fatal("dryRun不应删除容器")
+	}
+
+	if err := v.checkAndCleanExpiredInstances(); err != nil {
+		t.Fatalf("清理过期实例失败: %v", err)
+	}
+	if !docker.wasRemoved("expired") || docker.wasRemoved("active") {
+		t.Fatalf("只应删除过期实例的容器: %v", docker.removed)
+	}
+	if _, err := model.GetVulInstanceByID(expired.ID); err == nil {
+		t.Error("过期实例的记录应被删除")
+	}
+	if _, err := model.GetVulInstanceByID(active.ID); err != nil {
+		t.Errorf("未过期的实例应保留: %v", err)
+	}
+}
+
+func TestApplyShutdownPolicy(t *testing.T) {
+	useTestDB(t)
+	docker := useFakeDocker(t)
+	user := createLocalUser(t, "alice", "alice123", RoleUser)
+	env := &model.VulEnv{EnvName: "sqli", EnvType: "单镜像", BaseImage: "sqli"}
+	model.CreateVulEnv(env)
+
+	now := time.Now()
+	docker.add("c1", "c1", "running", now, nil)
+	docker.add("s1", "s1", "running", now, map[string]string{"com.docker.compose.project": "stack1"})
+	docker.addNetwork("n1", "stack1")
+	single := &model.VulInstance{UserID: user.ID, VulEnvID: env.ID, Status: model.InstanceStatusRunning, ContainerID: "c1", ExpireTime: now.Add(time.Hour)}
+	stack := &model.VulInstance{UserID: user.ID, VulEnvID: env.ID, Status: model.InstanceStatusRunning, StackName: "stack1", ExpireTime: now.Add(time.Hour)}
+	model.CreateVulInstance(single)
+	model.CreateVulInstance(stack)
+
+	v := &VulService{}
+	if err := v.ApplyShutdownPolicy("pause"); err == nil {
+		t.Error("无效的策略应返回错误")
+	}
+	if err := v.ApplyShutdownPolicy(InstancePolicyKeep); err != nil || len(docker.stopped) != 0 {
+		t.Fatalf("keep策略不应处理实例: %v %v", docker.stopped, err)
+	}
+
+	if err := v.ApplyShutdownPolicy(InstancePolicyStop); err != nil {
+		t.Fatalf("stop策略失败: %v", err)
+	}
+	if docker.state("c1") != "exited" || docker.state("s1") != "exited" {
+		t.Fatal("stop策略应停止单容器和堆栈的容器")
+	}
+	for _, id := range []uint{single.ID, stack.ID} {
+		if instance, _ := model.GetVulInstanceByID(id); instance.Status != model.InstanceStatusStopped {
+			t.Errorf("实例 %d 应标记为已停止: %d", id, instance.Status)
+		}
+	}
+
+	// 已停止的实例不再处理，运行中的实例删除容器和记录
+	single, _ = model.GetVulInstanceByID(single.ID)
+	single.Status = model.InstanceStatusRunning
+	model.UpdateVulInstance(single)
+	if err := v.ApplyShutdownPolicy(InstancePolicyRemove); err != nil {
+		t.Fatalf("remove策略失败: %v", err)
+	}
+	if !docker.wasRemoved("c1") || docker.wasRemoved("s1") {
+		t.Fatalf("remove策略只应删除运行中实例的容器: %v", docker.removed)
+	}
+	if _, err := model.GetVulInstanceByID(single.ID); err == nil {
+		t.Error("remove策略应删除实例记录")
+	}
+	if _, err := model.GetVulInstanceByID(stack.ID); err != nil {
+		t.Errorf("已停止的实例应保留: %v", err)
+	}
+}
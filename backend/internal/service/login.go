@@ -0,0 +1,224 @@
+package service
+
+import (
+	"AscensionPath/config"
+	"AscensionPath/internal/middleware"
+	"AscensionPath/internal/model"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// 登录失败原因，写入登录记录
+const (
+	loginReasonUserNotFound  = "用户不存在"
+	loginReasonWrongPassword = "密码错误"
+	loginReasonDisabled      = "用户已禁用"
+	loginReasonThrottled     = "尝试次数过多"
+	loginReasonTwoFactor     = "两步验证失败"
+)
+
+// LoginThrottledError 登录尝试过于频繁，需要等待RetryAfter后重试
+type LoginThrottledError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LoginThrottledError) Error() string {
+	return fmt.Sprintf("登录尝试过于频繁，请在%d秒后重试", int(math.Ceil(e.RetryAfter.Seconds())))
+}
+
+// LoginHistoryDTO 登录记录
+type LoginHistoryDTO struct {
+	ID        uint      `json:"id"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	Success   bool      `json:"success"`
+	Reason    string    `json:"reason,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// LoginLockDTO 被锁定的账号或IP
+type LoginLockDTO struct {
+	Scope       string    `json:"scope"`
+	Subject     string    `json:"subject"`
+	Failures    int       `json:"failures"`
+	LockedUntil time.Time `json:"locked_until"`
+}
+
+// checkLoginThrottle 账号或IP被锁定、或账号仍在退避等待中时返回LoginThrottledError
+func checkLoginThrottle(username, ip string) error {
+	now := time.Now()
+	conf := config.Current().Login
+	var wait time.Duration
+	if t, err := model.GetLoginThrottle(model.LoginScopeUser, username); err == nil {
+		if t.LockedUntil != nil && t.LockedUntil.After(now) {
+			wait = t.LockedUntil.Sub(now)
+		} else if t.LastFailureAt.After(now.Add(-conf.Window.Std())) {
+			wait = t.LastFailureAt.Add(loginBackoff(t.Failures)).Sub(now)
+		}
+	}
+	if t, err := model.GetLoginThrottle(model.LoginScopeIP, ip); err == nil &&
+		t.LockedUntil != nil && t.LockedUntil.Sub(now) > wait {
+		wait = t.LockedUntil.Sub(now)
+	}
+	if wait > 0 {
+		return &LoginThrottledError{RetryAfter: wait}
+	}
+	return nil
+}
+
+// loginBackoff 账号第n次失败后的等待时间：base_delay * 2^(n-1)，不超过锁定时长
+func loginBackoff(failures int) time.Duration {
+	conf := config.Current().Login
+	if failures < 1 || conf.BaseDelay <= 0 {
+		return 0
+	}
+	lockout := conf.LockoutDuration.Std()
+	if failures > 32 {
+		return lockout
+	}
+	delay := conf.BaseDelay.Std() << (failures - 1)
+	if delay <= 0 || delay > lockout {
+		return lockout
+	}
+	return delay
+}
+
+// recordLoginFailure 账号和IP的失败次数各加一，达到上限时锁定
+func recordLoginFailure(username, ip string) {
+	conf := config.Current().Login
+	windowStart := time.Now().Add(-conf.Window.Std())
+	limits := []struct {
+		scope, subject string
+		max            int
+	}{
+		{model.LoginScopeUser, username, conf.MaxAttempts},
+		{model.LoginScopeIP, ip, conf.IPMaxAttempts},
+	}
+	for _, l := range limits {
+		t, err := model.RecordLoginFailure(l.scope, l.subject, windowStart)
+		if err != nil {
+			middleware.SugarLogger.Errorw("记录登录失败次数失败", "scope", l.scope, "subject", l.subject, "error", err.Error())
+			continue
+		}
+		if t.Failures < l.max || (t.LockedUntil != nil && t.LockedUntil.After(time.Now())) {
+			continue
+		}
+		until := time.Now().Add(conf.LockoutDuration.Std())
+		if err := model.LockLogin(l.scope, l.subject, until); err != nil {
+			middleware.SugarLogger.Errorw("锁定登录失败", "scope", l.scope, "subject", l.subject, "error", err.Error())
+			continue
+		}
+		middleware.SugarLogger.Warnw("登录失败次数过多，已锁定",
+			"scope", l.scope, "subject", l.subject, "failures", t.Failures, "until", until)
+	}
+}
+
+// resetLoginFailures 登录成功后清除账号的失败计数，IP计数不清除，避免用一个有效账号解除IP锁定
+func resetLoginFailures(username string) {
+	if _, err := model.ClearLoginThrottle(model.LoginScopeUser, username); err != nil {
+		middleware.SugarLogger.Errorw("清除登录失败次数失败", "username", username, "error", err.Error())
+	}
+}
+
+// recordLoginHistory 写入登录记录，失败不影响登录结果
+func recordLoginHistory(userID uint, username, ip, userAgent string, success bool, reason string) {
+	err := model.CreateLoginHistory(&model.LoginHistory{
+		UserID:    userID,
+		Username:  truncate(username, 50),
+		IP:        ip,
+		UserAgent: truncate(userAgent, 255),
+		Success:   success,
+		Reason:    reason,
+	})
+	if err != nil {
+		middleware.SugarLogger.Errorw("写入登录记录失败", "username", username, "error", err.Error())
+	}
+}
+
+// GetLoginHistory 分页获取登录记录，普通用户只能查看自己的记录
+func (s *UserService) GetLoginHistory(userID uint, page, pageSize int) ([]LoginHistoryDTO, int64, error) {
+	if userID != s.ID && !s.Can(PermUserManage) {
+		return nil, 0, errors.New("权限不足")
+	}
+	histories, count, err := model.GetLoginHistories(userID, page, pageSize)
+	if err != nil {
+		return nil, 0, err
+	}
+	result := make([]LoginHistoryDTO, 0, len(histories))
+	for _, h := range histories {
+		result = append(result, LoginHistoryDTO{
+			ID:        h.ID,
+			IP:        h.IP,
+			UserAgent: h.UserAgent,
+			Success:   h.Success,
+			Reason:    h.Reason,
+			CreatedAt: h.CreatedAt,
+		})
+	}
+	return result, count, nil
+}
+
+// GetLoginLocks 获取当前被锁定的账号和IP，需要用户管理权限
+func (s *UserService) GetLoginLocks() ([]LoginLockDTO, error) {
+	if !s.Can(PermUserManage) {
+		return nil, errors.New("权限不足")
+	}
+	throttles, err := model.GetLockedLoginThrottles()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]LoginLockDTO, 0, len(throttles))
+	for _, t := range throttles {
+		result = append(result, LoginLockDTO{
+			Scope:       t.Scope,
+			Subject:     t.Subject,
+			Failures:    t.Failures,
+			LockedUntil: *t.LockedUntil,
+		})
+	}
+	return result, nil
+}
+
+// UnlockLogin 解除账号和/或IP的登录锁定并清除失败计数，需要用户管理权限
+func (s *UserService) UnlockLogin(username, ip string) error {
+	if !s.Can(PermUserManage) {
+		return errors.New("权限不足")
+	}
+	if username == "" && ip == "" {
+		return errors.New("用户名和IP不能同时为空")
+	}
+	unlocked := false
+	for _, target := range [][2]string{{model.LoginScopeUser, username}, {model.LoginScopeIP, ip}} {
+		if target[1] == "" {
+			continue
+		}
+		ok, err := model.ClearLoginThrottle(target[0], target[1])
+		if err != nil {
+			return err
+		}
+		unlocked = unlocked || ok
+	}
+	if !unlocked {
+		return errors.New("没有找到对应的锁定记录")
+	}
+	middleware.SugarLogger.Infow("解除登录锁定", "operatorID", s.ID, "username", username, "ip", ip)
+	return nil
+}
+
+// StartLoginCleanup 定时删除过期的失败计数和超过保留时长的登录记录，ctx取消后停止
+func StartLoginCleanup(ctx context.Context) {
+	runPeriodic(ctx, "login-cleanup", time.Hour, func() error {
+		conf := config.Current().Login
+		if _, err := model.DeleteStaleLoginThrottles(time.Now().Add(-conf.Window.Std())); err != nil {
+			return err
+		}
+		if conf.HistoryRetention <= 0 {
+			return nil
+		}
+		_, err := model.DeleteLoginHistoriesBefore(time.Now().Add(-conf.HistoryRetention.Std()))
+		return err
+	})
+}
@@ -0,0 +1,176 @@
+package service
+
+import (
+	"AscensionPath/config"
+	"AscensionPath/internal/model"
+	"AscensionPath/internal/utils"
+	"errors"
+	"testing"
+	"time"
+)
+
+// assertThrottled 检查登录被限制且等待时间在(min, max]之间
+func assertThrottled(t *testing.T, err error, min, max time.Duration) {
+	t.Helper()
+	var throttled *LoginThrottledError
+	if !errors.As(err, &throttled) {
+		t.Fatalf("应返回LoginThrottledError: %v", err)
+	}
+	if throttled.RetryAfter <= min || throttled.RetryAfter > max {
+		t.Fatalf("等待时间 %v 不在 (%v, %v] 之间", throttled.RetryAfter, min, max)
+	}
+}
+
+func TestLoginBackoff(t *testing.T) {
+	conf := config.Default()
+	oldConf := config.Current()
+	config.Set(conf)
+	t.Cleanup(func() { config.Set(oldConf) })
+
+	// 每次失败翻倍，不超过锁定时长
+	for failures, want := range map[int]time.Duration{
+		0:  0,
+		1:  time.Second,
+		2:  2 * time.Second,
+		3:  4 * time.Second,
+		10: 512 * time.Second,
+		11: 15 * time.Minute,
+		40: 15 * time.Minute,
+	} {
+		if got := loginBackoff(failures); got != want {
+			t.Errorf("loginBackoff(%d) = %v，期望 %v", failures, got, want)
+		}
+	}
+	conf.Login.BaseDelay = 0
+	if got := loginBackoff(3); got != 0 {
+		t.Errorf("base_delay为0时不应等待: %v", got)
+	}
+}
+
+func TestLoginThrottleBackoff(t *testing.T) {
+	conf := useTestDB(t)
+	conf.Login.BaseDelay = config.Duration(time.Minute)
+	createLocalUser(t, "alice", "alice123", RoleUser)
+	s := &UserService{}
+
+	// 失败后即使密码正确也要等待，等待时间随失败次数增长
+	if _, err := s.Login("alice", "wrong", "10.0.0.1", "test"); !errors.Is(err, utils.ErrInvalidCredentials) {
+		t.Fatalf("密码错误时返回 %v", err)
+	}
+	_, err := s.Login("alice", "alice123", "10.0.0.1", "test")
+	assertThrottled(t, err, 50*time.Second, time.Minute)
+
+	recordLoginFailure("alice", "10.0.0.1")
+	assertThrottled(t, checkLoginThrottle("alice", "10.0.0.2"), 110*time.Second, 2*time.Minute)
+	recordLoginFailure("alice", "10.0.0.1")
+	assertThrottled(t, checkLoginThrottle("alice", "10.0.0.2"), 230*time.Second, 4*time.Minute)
+
+	// 退避只针对账号，同一IP的其他账号不受影响
+	if err := checkLoginThrottle("bob", "10.0.0.1"); err != nil {
+		t.Errorf("其他账号不应被限制: %v", err)
+	}
+
+	// 等待结束后可以登录，登录成功清除账号的失败计数
+	model.DB.Model(&model.LoginThrottle{}).Where("scope = ?", model.LoginScopeUser).
+		Update("last_failure_at", time.Now().Add(-5*time.Minute))
+	if _, err := s.Login("alice", "alice123", "10.0.0.1", "test"); err != nil {
+		t.Fatalf("等待结束后应能登录: %v", err)
+	}
+	if _, err := model.GetLoginThrottle(model.LoginScopeUser, "alice"); err == nil {
+		t.Error("登录成功后应清除账号的失败计数")
+	}
+	if throttle, err := model.GetLoginThrottle(model.LoginScopeIP, "10.0.0.1"); err != nil || throttle.Failures != 3 {
+		t.Errorf("登录成功不应清除IP的失败计数: %+v, %v", throttle, err)
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	conf := useTestDB(t)
+	conf.Login.MaxAttempts = 3
+	alice := createLocalUser(t, "alice", "alice123", RoleUser)
+	createLocalUser(t, "bob", "bob123", RoleUser)
+	s := &UserService{}
+
+	// 未达到上限时登录成功会重新计数
+	for i := 0; i < 2; i++ {
+		s.Login("alice", "wrong", "10.0.0.1", "test")
+	}
+	if _, err := s.Login("alice", "alice123", "10.0.0.1", "test"); err != nil {
+		t.Fatalf("未达到上限时应能登录: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		s.Login("alice", "wrong", "10.0.0.1", "test")
+	}
+	if _, err := s.Login("alice", "alice123", "10.0.0.1", "test"); err != nil {
+		t.Fatalf("登录成功后应重新计数: %v", err)
+	}
+
+	// 连续失败达到上限后锁定账号，换IP也无法登录
+	for i := 0; i < 3; i++ {
+		if _, err := s.Login("alice", "wrong", "10.0.0.1", "test"); !errors.Is(err, utils.ErrInvalidCredentials) {
+			t.Fatalf("第%d次失败返回 %v", i+1, err)
+		}
+	}
+	lockout := conf.Login.LockoutDuration.Std()
+	_, err := s.Login("alice", "alice123", "10.0.0.2", "test")
+	assertThrottled(t, err, lockout-time.Minute, lockout)
+	if _, err := s.Login("bob", "bob123", "10.0.0.1", "test"); err != nil {
+		t.Errorf("其他账号不应被锁定: %v", err)
+	}
+
+	histories, _, _ := model.GetLoginHistories(alice.ID, 1, 1)
+	if len(histories) != 1 || histories[0].Success || histories[0].Reason != loginReasonThrottled {
+		t.Errorf("被限制的登录应写入登录记录: %+v", histories)
+	}
+
+	// 管理员解除锁定后可以登录
+	admin := &UserService{UserDTO: UserDTO{ID: 1, Role: RoleAdmin}}
+	locks, err := admin.GetLoginLocks()
+	if err != nil || len(locks) != 1 || locks[0].Scope != model.LoginScopeUser || locks[0].Subject != "alice" {
+		t.Fatalf("GetLoginLocks = %+v, %v", locks, err)
+	}
+	if err := (&UserService{UserDTO: UserDTO{ID: alice.ID, Role: RoleUser}}).UnlockLogin("alice", ""); err == nil {
+		t.Error("普通用户不应能解除锁定")
+	}
+	if err := admin.UnlockLogin("alice", ""); err != nil {
+		t.Fatalf("UnlockLogin: %v", err)
+	}
+	if _, err := s.Login("alice", "alice123", "10.0.0.1", "test"); err != nil {
+		t.Fatalf("解除锁定后应能登录: %v", err)
+	}
+}
+
+func TestLoginIPLockout(t *testing.T) {
+	conf := useTestDB(t)
+	conf.Login.IPMaxAttempts = 3
+	createLocalUser(t, "alice", "alice123", RoleUser)
+	s := &UserService{}
+
+	// 同一IP尝试不同的账号，包括不存在的账号，失败次数累加
+	for _, username := range []string{"nobody", "alice", "root"} {
+		if _, err := s.Login(username, "wrong", "10.6.6.6", "test"); !errors.Is(err, utils.ErrInvalidCredentials) {
+			t.Fatalf("%s 登录失败返回 %v", username, err)
+		}
+	}
+	lockout := conf.Login.LockoutDuration.Std()
+	_, err := s.Login("alice", "alice123", "10.6.6.6", "test")
+	assertThrottled(t, err, lockout-time.Minute, lockout)
+
+	// 其他IP不受影响，登录成功也不会解除IP的锁定
+	if _, err := s.Login("alice", "alice123", "10.0.0.1", "test"); err != nil {
+		t.Fatalf("其他IP应能登录: %v", err)
+	}
+	_, err = s.Login("alice", "alice123", "10.6.6.6", "test")
+	assertThrottled(t, err, lockout-time.Minute, lockout)
+
+	// 统计窗口外的失败重新计数
+	model.DB.Model(&model.LoginThrottle{}).Where("scope = ?", model.LoginScopeIP).
+		Updates(map[string]interface{}{"last_failure_at": time.Now().Add(-time.Hour), "locked_until": time.Now().Add(-time.Minute)})
+	if _, err := s.Login("alice", "alice123", "10.6.6.6", "test"); err != nil {
+		t.Fatalf("锁定结束后应能登录: %v", err)
+	}
+	s.Login("alice", "wrong", "10.6.6.6", "test")
+	if throttle, _ := model.GetLoginThrottle(model.LoginScopeIP, "10.6.6.6"); throttle.Failures != 1 || throttle.LockedUntil != nil {
+		t.Errorf("窗口外的失败应重新计数: %+v", throttle)
+	}
+}
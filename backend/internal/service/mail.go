@@ -0,0 +1,37 @@
+package service
+
+import (
+	"AscensionPath/config"
+	"AscensionPath/internal/mail"
+	"AscensionPath/internal/middleware"
+	"context"
+	"net/url"
+	"strings"
+)
+
+// newMailSender 创建邮件发送方式，测试时替换以捕获邮件
+var newMailSender = func() (mail.Sender, error) {
+	return mail.New(config.Current().Mail)
+}
+
+// sendMail 发送邮件，失败时只记录日志。调用方通常在后台执行，避免响应时间暴露账号是否存在
+func sendMail(msg mail.Message, userID uint) {
+	sender, err := newMailSender()
+	if err == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), config.Current().Mail.Timeout.Std())
+		err = sender.Send(ctx, msg)
+		cancel()
+	}
+	if err != nil {
+		middleware.SugarLogger.Errorw("发送邮件失败", "userID", userID, "subject", msg.Subject, "error", err.Error())
+	}
+}
+
+// tokenLink 把令牌附加到前端页面地址上，地址可以是hash路由
+func tokenLink(base, token string) string {
+	sep := "?"
+	if strings.Contains(base, "?") {
+		sep = "&"
+	}
+	return base + sep + "token=" + url.QueryEscape(token)
+}
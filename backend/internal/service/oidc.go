@@ -0,0 +1,601 @@
+package service
+
+import (
+	"AscensionPath/config"
+	"AscensionPath/internal/middleware"
+	"AscensionPath/internal/model"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrOIDCDisabled     = errors.New("未启用单点登录")
+	ErrOIDCStateInvalid = errors.New("单点登录已超时或无效，请重新登录")
+)
+
+const (
+	// 发起登录到回调完成的最长时间
+	oidcStateTTL = 10 * time.Minute
+	// 回调后前端用登录码换取会话的最长时间
+	oidcLoginCodeTTL = time.Minute
+	// discovery文档缓存时长
+	oidcMetadataTTL = time.Hour
+	// 遇到未知kid时重新获取JWKS的最小间隔
+	oidcKeysRefreshInterval = time.Minute
+)
+
+// 自动创建账号时用户名中不允许的字符
+var oidcUsernameInvalidChars = regexp.MustCompile(`[^A-Za-z0-9_.-]`)
+
+var oidcHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+// oidcMetadata discovery文档中用到的字段
+type oidcMetadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+	JwksURI               string `json:"jwks_uri"`
+}
+
+// oidcProvider 缓存IdP的端点和签名公钥
+type oidcProvider struct {
+	mu        sync.Mutex
+	issuer    string
+	metadata  *oidcMetadata
+	fetchedAt time.Time
+	keys      map[string]*rsa.PublicKey
+	keysAt    time.Time
+}
+
+var oidcIdP = &oidcProvider{}
+
+// OIDCLoginStart 发起单点登录时需要的跳转地址和state
+type OIDCLoginStart struct {
+	AuthURL string
+	State   string
+}
+
+// StartOIDCLogin 生成state、nonce和PKCE校验码，返回IdP授权地址
+func StartOIDCLogin(ctx context.Context) (*OIDCLoginStart, error) {
+	conf := config.Current().OIDC
+	if !conf.Enabled {
+		return nil, ErrOIDCDisabled
+	}
+	metadata, err := oidcIdP.getMetadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+	state, err := randomURLString(32)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := randomURLString(32)
+	if err != nil {
+		return nil, err
+	}
+	verifier, err := randomURLString(48)
+	if err != nil {
+		return nil, err
+	}
+	if err := model.CreateOIDCState(&model.OIDCState{
+		KeyHash:      hashToken(state),
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    time.Now().Add(oidcStateTTL),
+	}); err != nil {
+		return nil, fmt.Errorf("保存登录状态失败: %v", err)
+	}
+
+	challenge := sha256.Sum256([]byte(verifier))
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {conf.ClientID},
+		"redirect_uri":          {conf.RedirectURL},
+		"scope":                 {conf.Scopes},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	authURL := metadata.AuthorizationEndpoint
+	if strings.Contains(authURL, "?") {
+		authURL += "&" + params.Encode()
+	} else {
+		authURL += "?" + params.Encode()
+	}
+	return &OIDCLoginStart{AuthURL: authURL, State: state}, nil
+}
+
+// FinishOIDCLogin 处理IdP回调：校验state，用授权码和PKCE校验码换取ID Token并校验，
+// 找到或创建对应的用户，返回前端换取会话用的一次性登录码
+func FinishOIDCLogin(ctx context.Context, state, code, ip, userAgent string) (string, error) {
+	if !config.Current().OIDC.Enabled {
+		return "", ErrOIDCDisabled
+	}
+	saved, err := model.ConsumeOIDCState(hashToken(state))
+	if err != nil || saved.UserID != 0 {
+		return "", ErrOIDCStateInvalid
+	}
+	metadata, err := oidcIdP.getMetadata(ctx)
+	if err != nil {
+		return "", err
+	}
+	tokens, err := oidcIdP.exchangeCode(ctx, metadata, code, saved.CodeVerifier)
+	if err != nil {
+		return "", err
+	}
+	claims, err := oidcIdP.verifyIDToken(ctx, metadata, tokens.IDToken, saved.Nonce)
+	if err != nil {
+		middleware.SugarLogger.Warnw("ID Token校验失败", "ip", ip, "error", err.Error())
+		return "", errors.New("身份令牌校验失败")
+	}
+	if tokens.AccessToken != "" && metadata.UserinfoEndpoint != "" {
+		if err := oidcIdP.mergeUserinfo(ctx, metadata, tokens.AccessToken, claims); err != nil {
+			middleware.SugarLogger.Warnw("获取OIDC用户信息失败", "error", err.Error())
+		}
+	}
+
+	user, err := resolveOIDCUser(metadata.Issuer, claims)
+	if err != nil {
+		return "", err
+	}
+	if user.Status == 0 {
+		recordLoginHistory(user.ID, user.Username, ip, userAgent, false, loginReasonDisabled)
+		return "", errors.New("用户已被禁用")
+	}
+
+	loginCode, err := randomURLString(32)
+	if err != nil {
+		return "", err
+	}
+	if err := model.CreateOIDCState(&model.OIDCState{
+		KeyHash:   hashToken(loginCode),
+		UserID:    user.ID,
+		ExpiresAt: time.Now().Add(oidcLoginCodeTTL),
+	}); err != nil {
+		return "", fmt.Errorf("保存登录码失败: %v", err)
+	}
+	return loginCode, nil
+}
+
+// ExchangeOIDCLoginCode 用一次性登录码完成登录；用户已启用两步验证时返回用户和ErrTwoFactorRequired
+func ExchangeOIDCLoginCode(code, ip, userAgent string) (*model.User, error) {
+	saved, err := model.ConsumeOIDCState(hashToken(code))
+	if err != nil || saved.UserID == 0 {
+		return nil, ErrOIDCStateInvalid
+	}
+	user, err := model.GetUserByID(saved.UserID)
+	if err != nil || user.Status == 0 {
+		return nil, errors.New("用户不存在或已被禁用")
+	}
+	if enabled, err := model.IsTwoFactorEnabled(user.ID); err != nil {
+		return nil, err
+	} else if enabled {
+		return user, ErrTwoFactorRequired
+	}
+	completeLogin(user, ip, userAgent)
+	return user, nil
+}
+
+// StartOIDCCleanup 定时删除过期的单点登录凭据，ctx取消后停止
+func StartOIDCCleanup(ctx context.Context) {
+	runPeriodic(ctx, "oidc-cleanup", time.Hour, func() error {
+		_, err := model.DeleteExpiredOIDCStates(time.Now())
+		return err
+	})
+}
+
+// resolveOIDCUser 依次按外部身份、已验证的邮箱查找用户，都没有时自动创建账号
+func resolveOIDCUser(issuer string, claims map[string]interface{}) (*model.User, error) {
+	conf := config.Current().OIDC
+	subject := claimString(claims, "sub")
+	email := claimString(claims, "email")
+
+	if identity, err := model.GetUserIdentity(issuer, subject); err == nil {
+		user, err := model.GetUserByID(identity.UserID)
+		if err == nil {
+			model.TouchUserIdentity(identity.ID, email)
+			syncOIDCRole(user, claims)
+			return user, nil
+		}
+		// 关联的用户已被删除，按新用户处理
+		model.DeleteUserIdentity(identity.ID)
+	}
+
+	identity := &model.UserIdentity{Issuer: issuer, Subject: subject, Email: email, LastLoginAt: time.Now()}
+	if email != "" && conf.LinkByEmail && claimBool(claims, "email_verified") {
+		if user, err := model.GetUserByEmail(email); err == nil {
+			identity.UserID = user.ID
+			if err := model.CreateUserIdentity(identity); err != nil {
+				return nil, fmt.Errorf("关联账号失败: %v", err)
+			}
+			middleware.SugarLogger.Infow("单点登录关联已有账号", "userID", user.ID, "issuer", issuer, "subject", subject)
+			syncOIDCRole(user, claims)
+			return user, nil
+		}
+	}
+
+	if !conf.AutoProvision {
+		return nil, errors.New("账号未开通，请联系管理员")
+	}
+	if email == "" {
+		return nil, errors.New("IdP未提供邮箱，无法创建账号")
+	}
+	if _, err := model.GetUserByEmail(email); err == nil {
+		return nil, errors.New("该邮箱已被其他账号使用，请联系管理员关联账号")
+	}
+	hashed, err := randomPasswordHash()
+	if err != nil {
+		return nil, err
+	}
+	role := mapOIDCRole(claims)
+	if role == "" {
+		role = defaultOIDCRole()
+	}
+	user := &model.User{
+		Username: oidcUsername(claims),
+		Password: hashed,
+		Email:    email,
+		Status:   1,
+		Role:     role,
+	}
+	if err := model.CreateUserWithIdentity(user, identity); err != nil {
+		return nil, fmt.Errorf("创建账号失败: %v", err)
+	}
+	middleware.SugarLogger.Infow("单点登录自动创建账号",
+		"userID", user.ID, "username", user.Username, "role", role, "issuer", issuer, "subject", subject)
+	return user, nil
+}
+
+// randomPasswordHash 外部登录创建的账号不使用本地密码，保存一个随机密码的哈希
+func randomPasswordHash() (string, error) {
+	password, err := randomURLString(32)
+	if err != nil {
+		return "", err
+	}
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hashed), nil
+}
+
+// syncOIDCRole 开启sync_role时按映射更新用户身份
+func syncOIDCRole(user *model.User, claims map[string]interface{}) {
+	if !config.Current().OIDC.SyncRole {
+		return
+	}
+	role := mapOIDCRole(claims)
+	if role == "" {
+		role = defaultOIDCRole()
+	}
+	syncExternalRole(user, role, "单点登录")
+}
+
+// syncExternalRole 按外部身份源的映射更新用户身份，不会降级最后一个管理员
+func syncExternalRole(user *model.User, role, source string) {
+	if role == user.Role {
+		return
+	}
+	if user.Role == RoleAdmin {
+		if count, err := model.CountUsersByRole(RoleAdmin); err != nil || count <= 1 {
+			middleware.SugarLogger.Warnw("不能通过外部登录降级最后一个管理员", "userID", user.ID, "source", source)
+			return
+		}
+	}
+	if err := model.UpdateUserRole(user.ID, role); err != nil {
+		middleware.SugarLogger.Errorw("同步外部登录身份失败", "userID", user.ID, "source", source, "error", err.Error())
+		return
+	}
+	middleware.SugarLogger.Infow("同步外部登录身份", "userID", user.ID, "source", source, "oldRole", user.Role, "newRole", role)
+	user.Role = role
+}
+
+// mapOIDCRole 按oidc.role_mapping映射role_claim的值，匹配多个时取开放级别最高(数值最小)的身份，没有匹配时返回空
+func mapOIDCRole(claims map[string]interface{}) string {
+	values := claimStrings(claims, config.Current().OIDC.RoleClaim)
+	role := ""
+	for _, pair := range strings.Split(config.Current().OIDC.RoleMapping, ",") {
+		value, mapped, ok := strings.Cut(pair, "=")
+		if !ok {
+			continue
+		}
+		value, mapped = strings.TrimSpace(value), strings.TrimSpace(mapped)
+		if !IsValidRole(mapped) {
+			continue
+		}
+		for _, v := range values {
+			if v == value && (role == "" || RoleLevel(mapped) < RoleLevel(role)) {
+				role = mapped
+			}
+		}
+	}
+	return role
+}
+
+func defaultOIDCRole() string {
+	if role := config.Current().OIDC.DefaultRole; IsValidRole(role) {
+		return role
+	}
+	return RoleUser
+}
+
+// oidcUsername 根据preferred_username或邮箱生成未被占用的用户名
+func oidcUsername(claims map[string]interface{}) string {
+	base := claimString(claims, "preferred_username")
+	if base == "" {
+		base, _, _ = strings.Cut(claimString(claims, "email"), "@")
+	}
+	base = truncate(oidcUsernameInvalidChars.ReplaceAllString(base, ""), 40)
+	if base == "" {
+		base = "user"
+	}
+	for i := 1; i <= 100; i++ {
+		name := base
+		if i > 1 {
+			name = fmt.Sprintf("%s_%d", base, i)
+		}
+		if _, err := model.GetUserByUsername(name); err != nil {
+			return name
+		}
+	}
+	suffix, _ := randomURLString(4)
+	return base + "_" + suffix
+}
+
+// getMetadata 获取并缓存discovery文档，issuer修改后重新获取
+func (p *oidcProvider) getMetadata(ctx context.Context) (*oidcMetadata, error) {
+	issuer := strings.TrimSuffix(config.Current().OIDC.Issuer, "/")
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.metadata != nil && p.issuer == issuer && time.Since(p.fetchedAt) < oidcMetadataTTL {
+		return p.metadata, nil
+	}
+	var metadata oidcMetadata
+	if err := oidcGetJSON(ctx, issuer+"/.well-known/openid-configuration", "", &metadata); err != nil {
+		return nil, fmt.Errorf("获取IdP配置失败: %v", err)
+	}
+	if strings.TrimSuffix(metadata.Issuer, "/") != issuer {
+		return nil, fmt.Errorf("IdP返回的issuer与配置不一致: %s", metadata.Issuer)
+	}
+	if metadata.AuthorizationEndpoint == "" || metadata.TokenEndpoint == "" || metadata.JwksURI == "" {
+		return nil, errors.New("IdP配置缺少必要的端点")
+	}
+	if p.issuer != issuer {
+		p.keys = nil
+		p.keysAt = time.Time{}
+	}
+	p.issuer = issuer
+	p.metadata = &metadata
+	p.fetchedAt = time.Now()
+	return p.metadata, nil
+}
+
+// publicKey 按kid查找签名公钥，找不到时重新获取JWKS(IdP可能已轮换密钥)
+func (p *oidcProvider) publicKey(ctx context.Context, metadata *oidcMetadata, kid string) (*rsa.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	if time.Since(p.keysAt) < oidcKeysRefreshInterval {
+		return nil, fmt.Errorf("未知的签名密钥: %s", kid)
+	}
+	var jwks struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := oidcGetJSON(ctx, metadata.JwksURI, "", &jwks); err != nil {
+		return nil, fmt.Errorf("获取IdP公钥失败: %v", err)
+	}
+	keys := make(map[string]*rsa.PublicKey)
+	for _, k := range jwks.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			continue
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			continue
+		}
+		keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+	p.keys = keys
+	p.keysAt = time.Now()
+	if key, ok := keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("未知的签名密钥: %s", kid)
+}
+
+// oidcTokenResponse 令牌端点的响应
+type oidcTokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	IDToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// exchangeCode 用授权码和PKCE校验码换取令牌
+func (p *oidcProvider) exchangeCode(ctx context.Context, metadata *oidcMetadata, code, verifier string) (*oidcTokenResponse, error) {
+	conf := config.Current().OIDC
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {conf.RedirectURL},
+		"client_id":     {conf.ClientID},
+		"code_verifier": {verifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, metadata.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if conf.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(conf.ClientID), url.QueryEscape(conf.ClientSecret))
+	}
+	resp, err := oidcHTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("请求IdP令牌失败: %v", err)
+	}
+	defer resp.Body.Close()
+	var tokens oidcTokenResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&tokens); err != nil {
+		return nil, fmt.Errorf("解析IdP令牌失败: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || tokens.Error != "" {
+		return nil, fmt.Errorf("IdP拒绝授权码: %s %s", tokens.Error, tokens.ErrorDescription)
+	}
+	if tokens.IDToken == "" {
+		return nil, errors.New("IdP未返回ID Token")
+	}
+	return &tokens, nil
+}
+
+// verifyIDToken 校验ID Token的签名、签发者、受众、有效期和nonce
+func (p *oidcProvider) verifyIDToken(ctx context.Context, metadata *oidcMetadata, raw, nonce string) (map[string]interface{}, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(raw, claims, func(token *jwt.Token) (interface{}, error) {
+		if token.Method != jwt.SigningMethodRS256 {
+			return nil, fmt.Errorf("不支持的签名算法: %v", token.Header["alg"])
+		}
+		kid, _ := token.Header["kid"].(string)
+		return p.publicKey(ctx, metadata, kid)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if claimString(claims, "iss") != metadata.Issuer {
+		return nil, errors.New("issuer不匹配")
+	}
+	clientID := config.Current().OIDC.ClientID
+	audiences := claimStrings(claims, "aud")
+	found := false
+	for _, aud := range audiences {
+		found = found || aud == clientID
+	}
+	if !found {
+		return nil, errors.New("audience不匹配")
+	}
+	if azp := claimString(claims, "azp"); len(audiences) > 1 && azp != clientID {
+		return nil, errors.New("azp不匹配")
+	}
+	if _, ok := claims["exp"]; !ok {
+		return nil, errors.New("缺少exp")
+	}
+	if claimString(claims, "nonce") != nonce {
+		return nil, errors.New("nonce不匹配")
+	}
+	if claimString(claims, "sub") == "" {
+		return nil, errors.New("缺少sub")
+	}
+	return claims, nil
+}
+
+// mergeUserinfo 从userinfo端点补充ID Token中没有的claim(如邮箱、用户组)
+func (p *oidcProvider) mergeUserinfo(ctx context.Context, metadata *oidcMetadata, accessToken string, claims map[string]interface{}) error {
+	info := map[string]interface{}{}
+	if err := oidcGetJSON(ctx, metadata.UserinfoEndpoint, accessToken, &info); err != nil {
+		return err
+	}
+	if claimString(info, "sub") != claimString(claims, "sub") {
+		return errors.New("userinfo的sub与ID Token不一致")
+	}
+	for k, v := range info {
+		if _, ok := claims[k]; !ok {
+			claims[k] = v
+		}
+	}
+	return nil
+}
+
+func oidcGetJSON(ctx context.Context, endpoint, bearer string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+bearer)
+	}
+	resp, err := oidcHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s 返回 %d", endpoint, resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
+
+func claimString(claims map[string]interface{}, key string) string {
+	s, _ := claims[key].(string)
+	return s
+}
+
+// claimBool 兼容部分IdP把布尔值返回为字符串
+func claimBool(claims map[string]interface{}, key string) bool {
+	switch v := claims[key].(type) {
+	case bool:
+		return v
+	case string:
+		return v == "true"
+	}
+	return false
+}
+
+// claimStrings claim可能是单个字符串或字符串数组
+func claimStrings(claims map[string]interface{}, key string) []string {
+	switch v := claims[key].(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	case []string:
+		return v
+	}
+	return nil
+}
+
+// randomURLString 生成n字节随机数的base64url编码
+func randomURLString(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("生成随机数失败: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
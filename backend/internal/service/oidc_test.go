@@ -0,0 +1,291 @@
+package service
+
+import (
+	"AscensionPath/config"
+	"AscensionPath/internal/mockidp"
+	"AscensionPath/internal/model"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+const testOIDCRedirect = "http://app.example.edu/api/v1/users/oidc/callback"
+
+// useOIDCTest 在临时数据库的基础上启动进程内IdP并启用单点登录
+func useOIDCTest(t *testing.T) (*config.Config, *mockidp.Server) {
+	t.Helper()
+	conf := useTestDB(t)
+	idp, err := mockidp.New("", "ascension-path", "idp-secret", []mockidp.User{
+		{Username: "alice", Email: "alice@example.edu", Groups: []string{"students"}},
+		{Username: "tom", Email: "tom@example.edu", Groups: []string{"teachers", "it-admins"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(idp.Handler())
+	t.Cleanup(server.Close)
+	idp.Issuer = server.URL
+
+	// 每个测试使用新的IdP缓存
+	oldIdP := oidcIdP
+	oidcIdP = &oidcProvider{}
+	t.Cleanup(func() { oidcIdP = oldIdP })
+
+	conf.OIDC.Enabled = true
+	conf.OIDC.Issuer = server.URL + "/"
+	conf.OIDC.ClientID = "ascension-path"
+	conf.OIDC.ClientSecret = "idp-secret"
+	conf.OIDC.RedirectURL = testOIDCRedirect
+	return conf, idp
+}
+
+// oidcAuthorize 以指定用户在IdP授权，返回回调中的授权码和state
+func oidcAuthorize(t *testing.T, authURL, username string) (string, string) {
+	t.Helper()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(authURL + "&login_hint=" + url.QueryEscape(username))
+	if err != nil {
+		t.Fatalf("请求授权失败: %v", err)
+	}
+	resp.Body.Close()
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil || resp.StatusCode != http.StatusFound || !strings.HasPrefix(location.String(), testOIDCRedirect) {
+		t.Fatalf("IdP应重定向到回调地址: %d %s", resp.StatusCode, location)
+	}
+	return location.Query().Get("code"), location.Query().Get("state")
+}
+
+// oidcLogin 完成一次单点登录，返回登录码
+func oidcLogin(t *testing.T, username string) (string, error) {
+	t.Helper()
+	start, err := StartOIDCLogin(context.Background())
+	if err != nil {
+		t.Fatalf("StartOIDCLogin: %v", err)
+	}
+	code, state := oidcAuthorize(t, start.AuthURL, username)
+	return FinishOIDCLogin(context.Background(), state, code, "10.0.0.1", "test")
+}
+
+func TestOIDCDiscovery(t *testing.T) {
+	conf, idp := useOIDCTest(t)
+
+	start, err := StartOIDCLogin(context.Background())
+	if err != nil {
+		t.Fatalf("StartOIDCLogin: %v", err)
+	}
+	authURL, _ := url.Parse(start.AuthURL)
+	if authURL.Scheme+"://"+authURL.Host+authURL.Path != idp.Issuer+"/authorize" {
+		t.Errorf("授权地址应取自discovery文档: %s", start.AuthURL)
+	}
+	q := authURL.Query()
+	for key, want := range map[string]string{
+		"response_type":         "code",
+		"client_id":             "ascension-path",
+		"redirect_uri":          testOIDCRedirect,
+		"scope":                 conf.OIDC.Scopes,
+		"state":                 start.State,
+		"code_challenge_method": "S256",
+	} {
+		if q.Get(key) != want {
+			t.Errorf("授权参数 %s = %q，期望 %q", key, q.Get(key), want)
+		}
+	}
+
+	// PKCE：授权地址中的challenge是保存的verifier的SHA-256，nonce随登录状态保存
+	var saved model.OIDCState
+	if err := model.DB.Where("key_hash = ?", hashToken(start.State)).First(&saved).Error; err != nil {
+		t.Fatalf("应保存登录状态: %v", err)
+	}
+	sum := sha256.Sum256([]byte(saved.CodeVerifier))
+	if len(saved.CodeVerifier) < 43 || q.Get("code_challenge") != base64.RawURLEncoding.EncodeToString(sum[:]) {
+		t.Errorf("code_challenge与verifier不符: %+v", saved)
+	}
+	if saved.Nonce == "" || q.Get("nonce") != saved.Nonce {
+		t.Errorf("nonce与保存的不符: %q", q.Get("nonce"))
+	}
+	if another, _ := StartOIDCLogin(context.Background()); another.State == start.State {
+		t.Error("每次登录应生成新的state")
+	}
+
+	// discovery文档中的issuer与配置不一致时拒绝
+	oidcIdP = &oidcProvider{}
+	idp.Issuer = "https://evil.example.com"
+	if _, err := StartOIDCLogin(context.Background()); err == nil || !strings.Contains(err.Error(), "issuer") {
+		t.Errorf("issuer不一致时应失败: %v", err)
+	}
+	conf.OIDC.Enabled = false
+	if _, err := StartOIDCLogin(context.Background()); !errors.Is(err, ErrOIDCDisabled) {
+		t.Errorf("未启用时应返回ErrOIDCDisabled: %v", err)
+	}
+}
+
+func TestOIDCPKCE(t *testing.T) {
+	useOIDCTest(t)
+
+	// verifier被替换后IdP拒绝授权码
+	start, _ := StartOIDCLogin(context.Background())
+	code, state := oidcAuthorize(t, start.AuthURL, "alice")
+	model.DB.Model(&model.OIDCState{}).Where("key_hash = ?", hashToken(state)).
+		Update("code_verifier", strings.Repeat("x", 64))
+	if _, err := FinishOIDCLogin(context.Background(), state, code, "10.0.0.1", "test"); err == nil || !strings.Contains(err.Error(), "PKCE") {
+		t.Fatalf("verifier不符时应失败: %v", err)
+	}
+}
+
+func TestOIDCState(t *testing.T) {
+	useOIDCTest(t)
+	ctx := context.Background()
+
+	start, _ := StartOIDCLogin(ctx)
+	code, state := oidcAuthorize(t, start.AuthURL, "alice")
+	if _, err := FinishOIDCLogin(ctx, "forged-state", code, "10.0.0.1", "test"); !errors.Is(err, ErrOIDCStateInvalid) {
+		t.Fatalf("未知的state应被拒绝: %v", err)
+	}
+	loginCode, err := FinishOIDCLogin(ctx, state, code, "10.0.0.1", "test")
+	if err != nil {
+		t.Fatalf("FinishOIDCLogin: %v", err)
+	}
+	// state只能使用一次
+	if _, err := FinishOIDCLogin(ctx, state, code, "10.0.0.1", "test"); !errors.Is(err, ErrOIDCStateInvalid) {
+		t.Fatalf("重复使用state应被拒绝: %v", err)
+	}
+	// 登录码不能当作state使用
+	if _, err := FinishOIDCLogin(ctx, loginCode, code, "10.0.0.1", "test"); !errors.Is(err, ErrOIDCStateInvalid) {
+		t.Fatalf("登录码不应作为state: %v", err)
+	}
+
+	// 过期的state
+	start, _ = StartOIDCLogin(ctx)
+	code, state = oidcAuthorize(t, start.AuthURL, "alice")
+	model.DB.Model(&model.OIDCState{}).Where("key_hash = ?", hashToken(state)).
+		Update("expires_at", time.Now().Add(-time.Second))
+	if _, err := FinishOIDCLogin(ctx, state, code, "10.0.0.1", "test"); !errors.Is(err, ErrOIDCStateInvalid) {
+		t.Fatalf("过期的state应被拒绝: %v", err)
+	}
+}
+
+func TestOIDCInvalidIDToken(t *testing.T) {
+	_, idp := useOIDCTest(t)
+
+	for _, tc := range []struct {
+		name string
+		hook func(jwt.MapClaims)
+	}{
+		{"nonce不符", func(c jwt.MapClaims) { c["nonce"] = "replayed-nonce" }},
+		{"缺少nonce", func(c jwt.MapClaims) { delete(c, "nonce") }},
+		{"已过期", func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Minute).Unix() }},
+		{"缺少exp", func(c jwt.MapClaims) { delete(c, "exp") }},
+		{"受众不符", func(c jwt.MapClaims) { c["aud"] = "other-client" }},
+		{"多个受众且azp不符", func(c jwt.MapClaims) { c["aud"] = []string{"ascension-path", "other-client"} }},
+		{"签发者不符", func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }},
+		{"缺少sub", func(c jwt.MapClaims) { delete(c, "sub") }},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			idp.IDTokenHook = tc.hook
+			if _, err := oidcLogin(t, "alice"); err == nil || err.Error() != "身份令牌校验失败" {
+				t.Fatalf("应拒绝ID Token: %v", err)
+			}
+		})
+	}
+	idp.IDTokenHook = nil
+	if _, err := model.GetUserByUsername("alice"); err == nil {
+		t.Error("校验失败时不应创建账号")
+	}
+
+	// 使用IdP公钥之外的密钥签名
+	metadata, err := oidcIdP.getMetadata(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	forgedKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss": idp.Issuer, "aud": "ascension-path", "sub": "mock-alice", "nonce": "n",
+		"exp": time.Now().Add(time.Minute).Unix(),
+	})
+	token.Header["kid"] = mockidp.KeyID
+	forged, _ := token.SignedString(forgedKey)
+	if _, err := oidcIdP.verifyIDToken(context.Background(), metadata, forged, "n"); err == nil {
+		t.Error("签名无效的ID Token应被拒绝")
+	}
+	// 不接受HS256等其他算法
+	hs := jwt.NewWithClaims(jwt.SigningMethodHS256, token.Claims)
+	hs.Header["kid"] = mockidp.KeyID
+	forged, _ = hs.SignedString([]byte("secret"))
+	if _, err := oidcIdP.verifyIDToken(context.Background(), metadata, forged, "n"); err == nil {
+		t.Error("HS256签名的ID Token应被拒绝")
+	}
+}
+
+func TestOIDCFirstLogin(t *testing.T) {
+	conf, idp := useOIDCTest(t)
+	conf.OIDC.RoleMapping = "teachers=vip,it-admins=admin"
+	alice := createLocalUser(t, "alice", "alice123", RoleUser)
+	model.UpdateUser(alice.ID, map[string]interface{}{"email": "alice@example.edu"})
+
+	// 邮箱未验证时不关联已有账号，也不能用该邮箱创建新账号
+	idp.IDTokenHook = func(c jwt.MapClaims) { c["email_verified"] = false }
+	if _, err := oidcLogin(t, "alice"); err == nil || !strings.Contains(err.Error(), "已被其他账号使用") {
+		t.Fatalf("邮箱未验证时不应关联已有账号: %v", err)
+	}
+	idp.IDTokenHook = nil
+
+	// 首次登录按已验证的邮箱关联已有账号
+	loginCode, err := oidcLogin(t, "alice")
+	if err != nil {
+		t.Fatalf("关联已有账号失败: %v", err)
+	}
+	user, err := ExchangeOIDCLoginCode(loginCode, "10.0.0.1", "test")
+	if err != nil || user.ID != alice.ID {
+		t.Fatalf("应登录已有账号: %+v, %v", user, err)
+	}
+	if _, err := ExchangeOIDCLoginCode(loginCode, "10.0.0.1", "test"); !errors.Is(err, ErrOIDCStateInvalid) {
+		t.Fatalf("登录码只能使用一次: %v", err)
+	}
+	identity, err := model.GetUserIdentity(idp.Issuer, "mock-alice")
+	if err != nil || identity.UserID != alice.ID {
+		t.Fatalf("应保存外部身份: %+v, %v", identity, err)
+	}
+
+	// 之后按issuer + subject识别，不再依赖邮箱
+	model.UpdateUser(alice.ID, map[string]interface{}{"email": "alice@local"})
+	if loginCode, err = oidcLogin(t, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if user, _ := ExchangeOIDCLoginCode(loginCode, "", ""); user == nil || user.ID != alice.ID {
+		t.Fatalf("应按外部身份登录: %+v", user)
+	}
+
+	// 没有对应账号时自动创建，按用户组映射身份
+	if loginCode, err = oidcLogin(t, "tom"); err != nil {
+		t.Fatalf("自动创建账号失败: %v", err)
+	}
+	tom, err := ExchangeOIDCLoginCode(loginCode, "", "")
+	if err != nil || tom.Username != "tom" || tom.Email != "tom@example.edu" || tom.Role != RoleAdmin {
+		t.Fatalf("自动创建的账号: %+v, %v", tom, err)
+	}
+
+	// 关闭自动创建和邮箱关联后，未关联的用户不能登录
+	model.DB.Where("user_id = ?", tom.ID).Delete(&model.UserIdentity{})
+	conf.OIDC.AutoProvision = false
+	conf.OIDC.LinkByEmail = false
+	if _, err := oidcLogin(t, "tom"); err == nil || !strings.Contains(err.Error(), "未开通") {
+		t.Fatalf("未开通的账号应被拒绝: %v", err)
+	}
+
+	// 被禁用的账号不能登录
+	model.UpdateUser(alice.ID, map[string]interface{}{"status": 0})
+	if _, err := oidcLogin(t, "alice"); err == nil {
+		t.Fatal("被禁用的账号不应能登录")
+	}
+}
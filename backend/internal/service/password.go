@@ -0,0 +1,112 @@
+package service
+
+import (
+	"AscensionPath/config"
+	"AscensionPath/internal/middleware"
+	"AscensionPath/internal/utils"
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// bcrypt只使用密码的前72字节，更长的密码会被静默截断
+const maxPasswordBytes = 72
+
+// CheckPassword 按密码策略校验新密码：长度、不能与用户名或邮箱相同、不能在已泄露密码列表中。
+// 不符合时返回包装了utils.ErrWeakPassword的错误
+func CheckPassword(password, username, email string) error {
+	conf := config.Current().Password
+	if utf8.RuneCountInString(password) < conf.MinLength {
+		return fmt.Errorf("%w: 密码长度不能少于%d位", utils.ErrWeakPassword, conf.MinLength)
+	}
+	if len(password) > maxPasswordBytes {
+		return fmt.Errorf("%w: 密码不能超过%d字节", utils.ErrWeakPassword, maxPasswordBytes)
+	}
+	lower := strings.ToLower(password)
+	if username != "" && lower == strings.ToLower(username) {
+		return fmt.Errorf("%w: 密码不能与用户名相同", utils.ErrWeakPassword)
+	}
+	if local, _, ok := strings.Cut(strings.ToLower(email), "@"); ok && (lower == local || lower == strings.ToLower(email)) {
+		return fmt.Errorf("%w: 密码不能与邮箱相同", utils.ErrWeakPassword)
+	}
+	if breachedPasswords.contains(conf.BreachedList, password) {
+		return fmt.Errorf("%w: 该密码已在公开的泄露数据中出现，请更换", utils.ErrWeakPassword)
+	}
+	return nil
+}
+
+// 已泄露密码列表中的SHA-1行，兼容HIBP下载的 HASH:次数 格式
+var sha1LinePattern = regexp.MustCompile(`^[0-9A-Fa-f]{40}(:\d+)?$`)
+
+// breachedList 已泄露密码列表缓存，只保存SHA-1；文件修改后在下次校验时重新加载
+type breachedList struct {
+	mu      sync.Mutex
+	path    string
+	modTime time.Time
+	size    int64
+	hashes  map[string]struct{}
+}
+
+var breachedPasswords = &breachedList{}
+
+func (b *breachedList) contains(path, password string) bool {
+	if path == "" {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.load(path); err != nil {
+		// 列表不可用时不阻止修改密码，只记录错误
+		middleware.SugarLogger.Errorw("加载已泄露密码列表失败", "path", path, "error", err.Error())
+		return false
+	}
+	_, ok := b.hashes[sha1Hex(password)]
+	return ok
+}
+
+func (b *breachedList) load(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if b.hashes != nil && b.path == path && b.modTime.Equal(info.ModTime()) && b.size == info.Size() {
+		return nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	hashes := make(map[string]struct{})
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		if sha1LinePattern.MatchString(line) {
+			hashes[strings.ToUpper(line[:40])] = struct{}{}
+		} else {
+			hashes[sha1Hex(line)] = struct{}{}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	b.path, b.modTime, b.size, b.hashes = path, info.ModTime(), info.Size(), hashes
+	middleware.SugarLogger.Infow("已加载已泄露密码列表", "path", path, "count", len(hashes))
+	return nil
+}
+
+func sha1Hex(s string) string {
+	sum := sha1.Sum([]byte(s))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
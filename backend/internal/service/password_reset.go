@@ -0,0 +1,116 @@
+package service
+
+import (
+	"AscensionPath/config"
+	"AscensionPath/internal/mail"
+	"AscensionPath/internal/middleware"
+	"AscensionPath/internal/model"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	ErrPasswordResetDisabled = errors.New("未开启自助重置密码，请联系管理员")
+	ErrInvalidResetToken     = errors.New("重置链接无效或已过期，请重新申请")
+)
+
+// 同一用户申请重置邮件的最小间隔
+const passwordResetInterval = time.Minute
+
+// ForgotPassword 向邮箱对应的账号发送重置链接。无论邮箱是否存在都返回成功，避免被用来探测账号；
+// 禁用的账号和LDAP账号不发送，邮件在后台发送，响应时间不随账号是否存在变化
+func ForgotPassword(email, ip string) error {
+	conf := config.Current().PasswordReset
+	if !conf.Enabled {
+		return ErrPasswordResetDisabled
+	}
+	email = strings.TrimSpace(email)
+	user, err := model.GetUserByEmail(email)
+	if err != nil {
+		middleware.SugarLogger.Infow("申请重置密码的邮箱不存在", "email", email, "ip", ip)
+		return nil
+	}
+	if user.Status != 1 {
+		middleware.SugarLogger.Infow("已禁用的账号申请重置密码", "userID", user.ID, "ip", ip)
+		return nil
+	}
+	if config.Current().LDAP.Enabled && isLDAPAccount(user.ID) {
+		middleware.SugarLogger.Infow("LDAP账号申请重置密码", "userID", user.ID, "ip", ip)
+		return nil
+	}
+	if latest, err := model.GetLatestPasswordResetToken(user.ID); err == nil && time.Since(latest.CreatedAt) < passwordResetInterval {
+		middleware.SugarLogger.Warnw("重置密码申请过于频繁", "userID", user.ID, "ip", ip)
+		return nil
+	}
+
+	token, hash, err := newRefreshToken()
+	if err != nil {
+		return err
+	}
+	expiresAt := time.Now().Add(conf.TokenTTL.Std())
+	err = model.CreatePasswordResetToken(&model.PasswordResetToken{
+		UserID:    user.ID,
+		TokenHash: hash,
+		IP:        truncate(ip, 45),
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return fmt.Errorf("保存重置令牌失败: %v", err)
+	}
+
+	msg := mail.Message{
+		To:      user.Email,
+		Subject: "重置AscensionPath密码",
+		Body: fmt.Sprintf("%s，你好：\n\n我们收到了重置你的账号密码的申请。请在%s之前打开以下链接设置新密码，链接只能使用一次：\n\n%s\n\n"+
+			"如果不是你本人的操作，请忽略本邮件，你的密码不会被修改。\n",
+			user.Username, expiresAt.Format("2006-01-02 15:04"), tokenLink(conf.URL, token)),
+	}
+	go sendMail(msg, user.ID)
+	middleware.SugarLogger.Infow("已生成重置密码链接", "userID", user.ID, "ip", ip, "expiresAt", expiresAt)
+	return nil
+}
+
+// ResetPassword 使用重置链接中的令牌设置新密码，成功后令牌失效、解除强制改密并注销该用户的所有会话
+func ResetPassword(token, newPassword string) error {
+	if !config.Current().PasswordReset.Enabled {
+		return ErrPasswordResetDisabled
+	}
+	hash := hashToken(token)
+	reset, err := model.GetPasswordResetToken(hash)
+	if err != nil {
+		return ErrInvalidResetToken
+	}
+	user, err := model.GetUserByID(reset.UserID)
+	if err != nil || user.Status != 1 {
+		return ErrInvalidResetToken
+	}
+	// 先校验密码再使用令牌，密码不符合要求时用户可以用同一链接重试
+	if err := CheckPassword(newPassword, user.Username, user.Email); err != nil {
+		return err
+	}
+	if _, err := model.UsePasswordResetToken(hash); err != nil {
+		return ErrInvalidResetToken
+	}
+
+	if err := model.UpdatePassword(user.ID, newPassword); err != nil {
+		return err
+	}
+	if err := model.UpdateUser(user.ID, map[string]interface{}{"must_change_password": false}); err != nil {
+		return err
+	}
+	operator := &UserService{}
+	operator.revokeSessionsOf(user.ID)
+	middleware.SugarLogger.Infow("已通过邮件重置密码", "userID", user.ID)
+	return nil
+}
+
+// StartPasswordResetCleanup 定时删除过期的重置令牌，ctx取消后停止
+func StartPasswordResetCleanup(ctx context.Context) {
+	runPeriodic(ctx, "password-reset-cleanup", time.Hour, func() error {
+		_, err := model.DeleteExpiredPasswordResetTokens(time.Now())
+		return err
+	})
+}
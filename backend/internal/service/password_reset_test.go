@@ -0,0 +1,188 @@
+package service
+
+import (
+	"AscensionPath/internal/mail"
+	"AscensionPath/internal/model"
+	"AscensionPath/internal/utils"
+	"context"
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// captureSender 把发送的邮件放入通道，供测试读取
+type captureSender chan mail.Message
+
+func (c captureSender) Send(ctx context.Context, msg mail.Message) error {
+	c <- msg
+	return nil
+}
+
+func useCaptureMail(t *testing.T) captureSender {
+	t.Helper()
+	sent := make(captureSender, 10)
+	old := newMailSender
+	newMailSender = func() (mail.Sender, error) { return sent, nil }
+	t.Cleanup(func() { newMailSender = old })
+	return sent
+}
+
+func TestCheckPassword(t *testing.T) {
+	conf := useTestDB(t)
+	list := filepath.Join(t.TempDir(), "breached.txt")
+	// 明文和HIBP格式的SHA-1("password123")
+	content := "qwertyuiop\nCBFDAC6008F9CAB4083784CBD1874F76618D2A97:251682\n"
+	if err := os.WriteFile(list, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	conf.Password.BreachedList = list
+
+	cases := []struct {
+		password string
+		ok       bool
+	}{
+		{"short", false},
+		{"bobsmith", false},        // 与用户名相同
+		{"bob@example.edu", false}, // 与邮箱相同
+		{"qwertyuiop", false},
+		{"password123", false},
+		{strings.Repeat("长", 25), false}, // 超过72字节
+		{"correct horse battery", true},
+	}
+	for _, tc := range cases {
+		err := CheckPassword(tc.password, "BobSmith", "bob@example.edu")
+		if (err == nil) != tc.ok {
+			t.Errorf("CheckPassword(%q) = %v", tc.password, err)
+		}
+		if err != nil && !errors.Is(err, utils.ErrWeakPassword) {
+			t.Errorf("CheckPassword(%q) 应返回ErrWeakPassword: %v", tc.password, err)
+		}
+	}
+
+	// 修改列表文件后重新加载
+	time.Sleep(10 * time.Millisecond)
+	if err := os.WriteFile(list, []byte("correct horse battery\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckPassword("correct horse battery", "", ""); err == nil {
+		t.Error("修改后的列表未生效")
+	}
+
+	s := &UserService{}
+	conf.Registration.Open = true
+	if _, err := s.Register("carol", "correct horse battery", "carol@example.edu", ""); !errors.Is(err, utils.ErrWeakPassword) {
+		t.Errorf("注册时应校验密码策略: %v", err)
+	}
+}
+
+func TestPasswordReset(t *testing.T) {
+	conf := useTestDB(t)
+	sent := useCaptureMail(t)
+	user := createLocalUser(t, "alice", "oldpassword", RoleUser)
+	model.UpdateUser(user.ID, map[string]interface{}{"must_change_password": true})
+
+	if err := ForgotPassword(user.Email, "127.0.0.1"); err != ErrPasswordResetDisabled {
+		t.Fatalf("未开启时应拒绝: %v", err)
+	}
+	conf.PasswordReset.Enabled = true
+	conf.PasswordReset.URL = "https://lab.example.edu/static/#/resetPassword"
+
+	// 不存在的邮箱同样返回成功，但不发送邮件
+	if err := ForgotPassword("nobody@example.edu", "127.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ForgotPassword(user.Email, "127.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+	var msg mail.Message
+	select {
+	case msg = <-sent:
+	case <-time.After(5 * time.Second):
+		t.Fatal("未发送重置邮件")
+	}
+	if msg.To != user.Email {
+		t.Fatalf("邮件发给了 %s", msg.To)
+	}
+	i := strings.Index(msg.Body, conf.PasswordReset.URL+"?token=")
+	if i < 0 {
+		t.Fatalf("邮件中没有重置链接: %s", msg.Body)
+	}
+	link, err := url.Parse(strings.Fields(msg.Body[i:])[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := strings.TrimPrefix(link.Fragment, "/resetPassword?token=")
+
+	// 一分钟内重复申请不再发送
+	if err := ForgotPassword(user.Email, "127.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-sent:
+		t.Error("频繁申请不应重复发送邮件")
+	case <-time.After(100 * time.Millisecond):
+	}
+	select {
+	case <-sent:
+		t.Error("不存在的邮箱不应发送邮件")
+	default:
+	}
+
+	if err := ResetPassword("wrong-token", "newpassword1"); err != ErrInvalidResetToken {
+		t.Errorf("错误的令牌应被拒绝: %v", err)
+	}
+	// 密码不符合要求时令牌仍可使用
+	if err := ResetPassword(token, "short"); !errors.Is(err, utils.ErrWeakPassword) {
+		t.Errorf("弱密码应被拒绝: %v", err)
+	}
+	if _, err := CreateSession(user.ID, "127.0.0.1", "test"); err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	if err := ResetPassword(token, "newpassword1"); err != nil {
+		t.Fatalf("ResetPassword: %v", err)
+	}
+	if err := ResetPassword(token, "newpassword2"); err != ErrInvalidResetToken {
+		t.Errorf("令牌只能使用一次: %v", err)
+	}
+
+	got, _ := model.GetUserByID(user.ID)
+	if bcrypt.CompareHashAndPassword([]byte(got.Password), []byte("newpassword1")) != nil {
+		t.Error("密码未更新")
+	}
+	if got.MustChangePassword {
+		t.Error("重置密码后应解除强制改密")
+	}
+	if sessions, _ := model.GetActiveSessionsByUserID(user.ID); len(sessions) != 0 {
+		t.Errorf("重置密码后应注销所有会话，剩余 %d 个", len(sessions))
+	}
+}
+
+func TestFileMailSender(t *testing.T) {
+	conf := useTestDB(t)
+	conf.Mail.Driver = "file"
+	conf.Mail.Dir = t.TempDir()
+	sender, err := mail.New(conf.Mail)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sender.Send(context.Background(), mail.Message{To: "a@example.edu", Subject: "测试", Body: "正文"}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if err := sender.Send(context.Background(), mail.Message{To: "a@example.edu\r\nBcc: x@example.edu", Subject: "x"}); err == nil {
+		t.Error("邮件头中的换行应被拒绝")
+	}
+	files, _ := filepath.Glob(filepath.Join(conf.Mail.Dir, "*.eml"))
+	if len(files) != 1 {
+		t.Fatalf("应保存1封邮件，实际 %d", len(files))
+	}
+	data, _ := os.ReadFile(files[0])
+	if !strings.Contains(string(data), "To: a@example.edu\r\n") || !strings.Contains(string(data), "Subject: =?UTF-8?b?") {
+		t.Errorf("邮件格式不正确:\n%s", data)
+	}
+}
@@ -0,0 +1,470 @@
+package service
+
+import (
+	"AscensionPath/config"
+	"AscensionPath/internal/middleware"
+	"AscensionPath/internal/model"
+	"AscensionPath/internal/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+// 孤儿资源(没有实例记录的容器/堆栈)处理策略
+const (
+	OrphanPolicyReport = "report" // 仅报告
+	OrphanPolicyRemove = "remove" // 删除
+	OrphanPolicyAdopt  = "adopt"  // 能认领的认领，其余删除；无法写入新flag时仅报告
+)
+
+// 对账动作
+const (
+	ReconcileMarkRunning = "mark_running"
+	ReconcileMarkStopped = "mark_stopped"
+	ReconcileMarkFailed  = "mark_failed"
+	ReconcileAdopt       = "adopt"
+	ReconcileRemove      = "remove"
+	ReconcileReportOnly  = "report"
+)
+
+// 平台创建的容器名和堆栈名均为MD5值
+var managedNamePattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// 新创建的容器可能尚未写入实例记录，该时间内的孤儿资源不做处理
+const orphanGracePeriod = 5 * time.Minute
+
+// 开启实例的最长时间，超过该时间仍处于创建中的实例视为开启过程已中断(如进程在开启过程中退出)
+const launchTimeout = 10 * time.Minute
+
+// 同一时间只允许一次对账
+var reconcileMu sync.Mutex
+
+// ReconcileAction 一条对账记录
+type ReconcileAction struct {
+	Kind       string `json:"kind"`                  // instance/container/stack
+	Target     string `json:"target"`                // 实例ID/容器ID/堆栈名
+	InstanceID uint   `json:"instance_id,omitempty"` // 相关的实例ID
+	Action     string `json:"action"`                // 执行的动作
+	Error      string `json:"error,omitempty"`       // 执行失败的原因
+}
+
+// ReconcileReport 对账报告
+type ReconcileReport struct {
+	StartedAt    time.Time         `json:"started_at"`
+	FinishedAt   time.Time         `json:"finished_at"`
+	OrphanPolicy string            `json:"orphan_policy"`
+	DryRun       bool              `json:"dry_run"`
+	Instances    int               `json:"instances"` // 检查的实例数量
+	Actions      []ReconcileAction `json:"actions"`
+}
+
+func (r *ReconcileReport) add(action ReconcileAction, err error) {
+	if err != nil {
+		action.Error = err.Error()
+		middleware.SugarLogger.Errorf("对账 %s %s 执行 %s 失败: %v", action.Kind, action.Target, action.Action, err)
+	}
+	r.Actions = append(r.Actions, action)
+}
+
+// IsValidOrphanPolicy 判断孤儿资源处理策略是否合法
+func IsValidOrphanPolicy(policy string) bool {
+	switch policy {
+	case OrphanPolicyReport, OrphanPolicyRemove, OrphanPolicyAdopt:
+		return true
+	default:
+		return false
+	}
+}
+
+// Reconcile 对比实例表与Docker状态：修正丢失或停止的实例状态，按策略处理孤儿容器和堆栈
+func (v *VulService) Reconcile(orphanPolicy string, dryRun bool) (*ReconcileReport, error) {
+	if !IsValidOrphanPolicy(orphanPolicy) {
+		return nil, fmt.Errorf("无效的孤儿资源处理策略: %s", orphanPolicy)
+	}
+
+	reconcileMu.Lock()
+	defer reconcileMu.Unlock()
+
+	report := &ReconcileReport{
+		StartedAt:    time.Now(),
+		OrphanPolicy: orphanPolicy,
+		DryRun:       dryRun,
+		Actions:      []ReconcileAction{},
+	}
+
+	instances, err := model.GetAllVulInstances()
+	if err != nil {
+		return nil, fmt.Errorf("获取实例列表失败: %v", err)
+	}
+	containers, err := GetAllContainers()
+	if err != nil {
+		return nil, err
+	}
+	stackNames, err := GetStackNames()
+	if err != nil {
+		return nil, err
+	}
+
+	ownedContainers := make(map[string]bool)
+	ownedStacks := make(map[string]bool)
+
+	// 1. 实例记录 -> Docker
+	for i := range instances {
+		instance := &instances[i]
+		var total, running int
+		switch {
+		case instance.ContainerID != "":
+			ownedContainers[instance.ContainerID] = true
+			for _, c := range containers {
+				if c.ID == instance.ContainerID {
+					total++
+					if c.State == "running" {
+						running++
+					}
+				}
+			}
+		case instance.StackName != "":
+			ownedStacks[instance.StackName] = true
+			for _, c := range containers {
+				if c.Labels["com.docker.compose.project"] == instance.StackName {
+					total++
+					if c.State == "running" {
+						running++
+					}
+				}
+			}
+		default:
+			continue
+		}
+		report.Instances++
+
+		status, action := instance.Status, ""
+		switch {
+		case total == 0 && (instance.Status == model.InstanceStatusRunning || instance.Status == model.InstanceStatusStopped):
+			status, action = model.InstanceStatusFailed, ReconcileMarkFailed
+		case total > 0 && running == 0 && instance.Status == model.InstanceStatusRunning:
+			status, action = model.InstanceStatusStopped, ReconcileMarkStopped
+		case running > 0 && instance.Status == model.InstanceStatusStopped:
+			status, action = model.InstanceStatusRunning, ReconcileMarkRunning
+		}
+		if action == "" {
+			continue
+		}
+
+		var err error
+		if !dryRun {
+			instance.Status = status
+			if status != model.InstanceStatusRunning {
+				instance.EndTime = time.Now()
+			}
+			err = model.UpdateVulInstance(instance)
+		}
+		report.add(ReconcileAction{
+			Kind:       "instance",
+			Target:     strconv.FormatUint(uint64(instance.ID), 10),
+			InstanceID: instance.ID,
+			Action:     action,
+		}, err)
+	}
+
+	// 2. 开启过程中断的实例：删除已创建的容器和堆栈，退还开销并标记为异常
+	for i := range instances {
+		instance := &instances[i]
+		if !launchInterrupted(instance) {
+			continue
+		}
+		containerIDs, stackNames := interruptedLaunchResources(instance, instances, containers)
+		for _, id := range containerIDs {
+			ownedContainers[id] = true
+		}
+		for _, name := range stackNames {
+			ownedStacks[name] = true
+		}
+		var err error
+		if !dryRun {
+			err = failInterruptedLaunch(instance, containerIDs, stackNames)
+		}
+		report.add(ReconcileAction{
+			Kind:       "instance",
+			Target:     strconv.FormatUint(uint64(instance.ID), 10),
+			InstanceID: instance.ID,
+			Action:     ReconcileMarkFailed,
+		}, err)
+	}
+
+	// 3. Docker -> 实例记录：没有实例记录的堆栈
+	for _, stackName := range stackNames {
+		if ownedStacks[stackName] || !managedNamePattern.MatchString(stackName) {
+			continue
+		}
+		var stackContainers []container.Summary
+		for _, c := range containers {
+			if c.Labels["com.docker.compose.project"] == stackName {
+				stackContainers = append(stackContainers, c)
+			}
+		}
+		v.handleOrphan(report, "stack", stackName, stackContainers, orphanPolicy, dryRun)
+	}
+
+	// 4. Docker -> 实例记录：没有实例记录的单容器
+	for _, c := range containers {
+		if ownedContainers[c.ID] || c.Labels["com.docker.compose.project"] != "" || len(c.Names) == 0 {
+			continue
+		}
+		if !managedNamePattern.MatchString(strings.TrimPrefix(c.Names[0], "/")) {
+			continue
+		}
+		v.handleOrphan(report, "container", c.ID, []container.Summary{c}, orphanPolicy, dryRun)
+	}
+
+	report.FinishedAt = time.Now()
+	middleware.SugarLogger.Infow("实例状态对账完成",
+		"instances", report.Instances,
+		"actions", len(report.Actions),
+		"dryRun", dryRun,
+	)
+	return report, nil
+}
+
+// handleOrphan 按策略处理一个孤儿容器或堆栈
+func (v *VulService) handleOrphan(report *ReconcileReport, kind, target string, containers []container.Summary, policy string, dryRun bool) {
+	for _, c := range containers {
+		if time.Since(time.Unix(c.Created, 0)) < orphanGracePeriod {
+			return
+		}
+	}
+
+	action := ReconcileAction{Kind: kind, Target: target, Action: ReconcileReportOnly}
+	if policy == OrphanPolicyReport {
+		report.add(action, nil)
+		return
+	}
+
+	if policy == OrphanPolicyAdopt {
+		// 无法写入新flag时保留容器等待管理员处理，不能因为配置原因删除用户的实例
+		if !flagWritable() {
+			middleware.SugarLogger.Warnw("未设置flag.file或通过环境变量注入flag，无法认领孤儿资源，仅报告", "kind", kind, "target", target)
+			report.add(action, nil)
+			return
+		}
+		if instance, ok := adoptableInstance(kind, target, containers); ok {
+			action.Action = ReconcileAdopt
+			var err error
+			if !dryRun {
+				if err = writeAdoptedFlag(instance.Flag, containers); err == nil {
+					err = model.CreateVulInstance(instance)
+					action.InstanceID = instance.ID
+				}
+			}
+			report.add(action, err)
+			return
+		}
+	}
+
+	action.Action = ReconcileRemove
+	var err error
+	if !dryRun {
+		if kind == "stack" {
+			err = RemoveStackByName(target)
+		} else {
+			err = RemoveContainer(target, true)
+		}
+	}
+	report.add(action, err)
+}
+
+// flagWritable 判断能否更新已有容器中的flag。
+// 原flag无法从容器中取回，认领时生成新flag写入flag文件；通过环境变量注入flag时容器内的值无法更新
+func flagWritable() bool {
+	conf := config.Current().Flag
+	return conf.Env == "" && conf.File != ""
+}
+
+// adoptableInstance 根据容器标签构建实例记录，标签缺失、用户或环境不存在、或已有实例记录时无法认领
+func adoptableInstance(kind, target string, containers []container.Summary) (*model.VulInstance, bool) {
+	if len(containers) == 0 {
+		return nil, false
+	}
+	labels := containers[0].Labels
+	userID, err := strconv.ParseUint(labels[LabelUserID], 10, 32)
+	if err != nil {
+		return nil, false
+	}
+	vulEnvID, err := strconv.ParseUint(labels[LabelVulEnvID], 10, 32)
+	if err != nil {
+		return nil, false
+	}
+	if _, err := model.GetUserByID(uint(userID)); err != nil {
+		return nil, false
+	}
+	if _, err := model.GetVulEnvByID(uint(vulEnvID)); err != nil {
+		return nil, false
+	}
+	// 团队实例的标签带有团队ID，团队已被删除时不收养
+	var teamID uint64
+	if value, ok := labels[LabelTeamID]; ok {
+		if teamID, err = strconv.ParseUint(value, 10, 32); err != nil {
+			return nil, false
+		}
+		if _, err := model.GetTeam(uint(teamID)); err != nil {
+			return nil, false
+		}
+		if _, err := model.GetTeamVulInstance(uint(teamID), uint(vulEnvID)); err == nil {
+			return nil, false
+		}
+	} else if _, err := model.GetVulInstanceBy2ID(uint(userID), uint(vulEnvID)); err == nil {
+		return nil, false
+	}
+
+	// 从容器信息恢复端口映射和运行状态
+	ports := map[string]string{}
+	status := model.InstanceStatusStopped
+	startTime := time.Unix(containers[0].Created, 0)
+	for _, c := range containers {
+		for _, p := range c.Ports {
+			if p.PublicPort != 0 {
+				ports[strconv.Itoa(int(p.PrivatePort))] = strconv.Itoa(int(p.PublicPort))
+			}
+		}
+		if c.State == "running" {
+			status = model.InstanceStatusRunning
+		}
+	}
+	portsStr, err := json.Marshal(ports)
+	if err != nil {
+		return nil, false
+	}
+
+	flag, err := newInstanceFlag()
+	if err != nil {
+		return nil, false
+	}
+
+	instance := &model.VulInstance{
+		UserID:     uint(userID),
+		TeamID:     uint(teamID),
+		VulEnvID:   uint(vulEnvID),
+		Flag:       flag,
+		Status:     status,
+		Ports:      string(portsStr),
+		StartTime:  startTime,
+		ExpireTime: time.Now().Add(config.Current().Instance.DefaultExpiration.Std()),
+	}
+	if kind == "stack" {
+		instance.StackName = target
+	} else {
+		instance.ContainerID = target
+	}
+	return instance, true
+}
+
+// writeAdoptedFlag 将认领时生成的flag写入所有容器的flag文件
+func writeAdoptedFlag(flag string, containers []container.Summary) error {
+	cli, err := getDockerClient()
+	if err != nil {
+		return err
+	}
+	_, files := flagInjection(flag)
+	for _, c := range containers {
+		if err := copyFilesToContainer(cli, c.ID, files); err != nil {
+			return fmt.Errorf("写入flag文件失败: %v", err)
+		}
+	}
+	return nil
+}
+
+// launchInterrupted 实例是否停留在创建中超过了开启实例的最长时间
+func launchInterrupted(instance *model.VulInstance) bool {
+	return instance.Status == model.InstanceStatusNone && time.Since(instance.CreatedAt) >= launchTimeout
+}
+
+// interruptedLaunchResources 开启中断的实例已创建的容器和堆栈：记录在实例上的，
+// 以及标签属于该实例、但在记录前进程就已退出的，其他实例记录的容器和堆栈除外
+func interruptedLaunchResources(instance *model.VulInstance, instances []model.VulInstance, containers []container.Summary) ([]string, []string) {
+	others := make(map[string]bool)
+	for _, other := range instances {
+		if other.ID != instance.ID {
+			others[other.ContainerID] = true
+			others[other.StackName] = true
+		}
+	}
+	want := InstanceLabels(instance.UserID, instance.TeamID, instance.VulEnvID)
+	var containerIDs, stackNames []string
+	seen := make(map[string]bool)
+	add := func(list *[]string, name string) {
+		if name != "" && !others[name] && !seen[name] {
+			seen[name] = true
+			*list = append(*list, name)
+		}
+	}
+	add(&containerIDs, instance.ContainerID)
+	add(&stackNames, instance.StackName)
+	for _, c := range containers {
+		if c.Labels[LabelUserID] != want[LabelUserID] || c.Labels[LabelVulEnvID] != want[LabelVulEnvID] ||
+			c.Labels[LabelTeamID] != want[LabelTeamID] {
+			continue
+		}
+		if project := c.Labels["com.docker.compose.project"]; project != "" {
+			add(&stackNames, project)
+		} else {
+			add(&containerIDs, c.ID)
+		}
+	}
+	return containerIDs, stackNames
+}
+
+// failInterruptedLaunch 删除开启中断的实例已创建的容器和堆栈，退还开销后标记为异常。
+// 删除失败时不修改实例，下次对账重试；退还只会执行一次，标记失败时重试不会重复退还
+func failInterruptedLaunch(instance *model.VulInstance, containerIDs, stackNames []string) error {
+	for _, name := range stackNames {
+		if err := RemoveStackByName(name); err != nil {
+			return fmt.Errorf("删除堆栈失败: %v", err)
+		}
+	}
+	for _, id := range containerIDs {
+		if err := RemoveContainer(id, true); err != nil {
+			return fmt.Errorf("删除容器失败: %v", err)
+		}
+	}
+	refund, err := model.RefundLaunchCharge(instance.ID, "开启实例中断")
+	if err != nil && !errors.Is(err, utils.ErrAlreadyRefunded) {
+		return fmt.Errorf("退还开销失败: %v", err)
+	}
+	instance.Status = model.InstanceStatusFailed
+	instance.EndTime = time.Now()
+	if err := model.UpdateVulInstance(instance); err != nil {
+		return err
+	}
+	middleware.SugarLogger.Infow("已清理开启中断的实例", "instanceID", instance.ID, "userID", instance.UserID,
+		"containers", containerIDs, "stacks", stackNames, "refunded", refund != nil)
+	return nil
+}
+
+// cleanInterruptedLaunches 处理开启过程中断的实例，由过期实例监控定期调用，不必等到下次对账
+func cleanInterruptedLaunches(instances []model.VulInstance) error {
+	var containers []container.Summary
+	for i := range instances {
+		instance := &instances[i]
+		if !launchInterrupted(instance) {
+			continue
+		}
+		if containers == nil {
+			var err error
+			if containers, err = GetAllContainers(); err != nil {
+				return err
+			}
+		}
+		containerIDs, stackNames := interruptedLaunchResources(instance, instances, containers)
+		if err := failInterruptedLaunch(instance, containerIDs, stackNames); err != nil {
+			middleware.SugarLogger.Errorw("清理开启中断的实例失败", "instanceID", instance.ID, "error", err.Error())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,311 @@
+package service
+
+import (
+	"AscensionPath/internal/model"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/docker/go-connections/nat"
+	"gorm.io/gorm"
+)
+
+// managedName 生成平台风格的容器名/堆栈名
+func managedName(n int) string {
+	return fmt.Sprintf("%032x", n)
+}
+
+// reconcileActions 按目标整理对账记录
+func reconcileActions(t *testing.T, report *ReconcileReport) map[string]string {
+	t.Helper()
+	actions := make(map[string]string)
+	for _, a := range report.Actions {
+		if a.Error != "" {
+			t.Errorf("对账 %s %s 执行 %s 失败: %s", a.Kind, a.Target, a.Action, a.Error)
+		}
+		actions[a.Target] = a.Action
+	}
+	return actions
+}
+
+func TestReconcile(t *testing.T) {
+	conf := useTestDB(t)
+	conf.Flag.Env, conf.Flag.File = "", "/flag" // 认领时生成的flag只能写入文件
+	docker := useFakeDocker(t)
+	alice := createLocalUser(t, "alice", "alice123", RoleUser)
+	bob := createLocalUser(t, "bob", "bob123", RoleUser)
+	web := &model.VulEnv{EnvName: "web", EnvType: "单镜像", BaseImage: "web"}
+	stackEnv := &model.VulEnv{EnvName: "stack", EnvType: "compose", BaseCompose: "docker-compose.yml"}
+	pwn := &model.VulEnv{EnvName: "pwn", EnvType: "单镜像", BaseImage: "pwn"}
+	for _, env := range []*model.VulEnv{web, stackEnv, pwn} {
+		model.CreateVulEnv(env)
+	}
+
+	old := time.Now().Add(-time.Hour)
+	project := func(name string, l map[string]string) map[string]string {
+		l["com.docker.compose.project"] = name
+		return l
+	}
+
+	// 有实例记录的资源
+	instances := map[string]*model.VulInstance{
+		"lost":    {UserID: alice.ID, VulEnvID: web.ID, Status: model.InstanceStatusRunning, ContainerID: "lost"},
+		"exited":  {UserID: bob.ID, VulEnvID: web.ID, Status: model.InstanceStatusRunning, ContainerID: "exited"},
+		"revived": {UserID: alice.ID, TeamID: 9, VulEnvID: web.ID, Status: model.InstanceStatusStopped, ContainerID: "revived"},
+		"stackok": {UserID: alice.ID, VulEnvID: stackEnv.ID, Status: model.InstanceStatusRunning, StackName: "stackok"},
+	}
+	for _, instance := range instances {
+		instance.ExpireTime = time.Now().Add(time.Hour)
+		if err := model.CreateVulInstance(instance); err != nil {
+			t.Fatal(err)
+		}
+	}
+	docker.add("exited", managedName(1), "exited", old, InstanceLabels(bob.ID, 0, web.ID))
+	docker.add("revived", managedName(2), "running", old, InstanceLabels(alice.ID, 9, web.ID))
+	docker.add("stackok-web", "stackok-web-1", "running", old, project("stackok", InstanceLabels(alice.ID, 0, stackEnv.ID)))
+
+	// 没有实例记录的资源
+	adoptStack := managedName(10)
+	removeStack := managedName(11)
+	docker.add("orphan-adopt", managedName(3), "running", old, InstanceLabels(alice.ID, 0, pwn.ID))
+	docker.add("orphan-taken", managedName(4), "running", old, InstanceLabels(alice.ID, 0, web.ID)) // alice已有该环境的实例
+	docker.add("orphan-nolabel", managedName(5), "exited", old, nil)
+	docker.add("orphan-noteam", managedName(6), "running", old, InstanceLabels(bob.ID, 42, web.ID)) // 团队不存在
+	docker.add("orphan-recent", managedName(7), "running", time.Now(), nil)                         // 刚创建，可能尚未写入实例记录
+	docker.add("mysql", "mysql", "running", old, nil)                                               // 不是平台创建的容器
+	docker.add("adopt-stack-web", adoptStack+"-web-1", "exited", old, project(adoptStack, InstanceLabels(bob.ID, 0, stackEnv.ID)))
+	docker.addNetwork("adopt-stack-net", adoptStack)
+	docker.addNetwork("remove-stack-net", removeStack) // 容器已删除，只剩网络
+
+	v := &VulService{}
+	if _, err := v.Reconcile("ignore", false); err == nil {
+		t.Error("无效的孤儿资源处理策略应返回错误")
+	}
+
+	// dryRun只生成报告，不修改记录和容器
+	report, err := v.Reconcile(OrphanPolicyAdopt, true)
+	if err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	want := map[string]string{
+		strconv.Itoa(int(instances["lost"].ID)):    ReconcileMarkFailed,
+		strconv.Itoa(int(instances["exited"].ID)):  ReconcileMarkStopped,
+		strconv.Itoa(int(instances["revived"].ID)): ReconcileMarkRunning,
+		"orphan-adopt":   ReconcileAdopt,
+		"orphan-taken":   ReconcileRemove,
+		"orphan-nolabel": ReconcileRemove,
+		"orphan-noteam":  ReconcileRemove,
+		adoptStack:       ReconcileAdopt,
+		removeStack:      ReconcileRemove,
+	}
+	actions := reconcileActions(t, report)
+	if report.Instances != 4 || len(actions) != len(want) {
+		t.Errorf("检查 %d 个实例，对账记录 %v", report.Instances, actions)
+	}
+	for target, action := range want {
+		if actions[target] != action {
+			t.Errorf("%s 的对账动作为 %q，期望 %q", target, actions[target], action)
+		}
+	}
+	if len(docker.removed) != 0 {
+		t.Fatalf("dryRun不应删除容器: %v", docker.removed)
+	}
+	if instance, _ := model.GetVulInstanceByID(instances["lost"].ID); instance.Status != model.InstanceStatusRunning {
+		t.Fatal("dryRun不应修改实例状态")
+	}
+
+	// report策略修正实例状态，孤儿资源只报告
+	report, err = v.Reconcile(OrphanPolicyReport, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	actions = reconcileActions(t, report)
+	if actions["orphan-adopt"] != ReconcileReportOnly || actions[removeStack] != ReconcileReportOnly || len(docker.removed) != 0 {
+		t.Errorf("report策略只应报告孤儿资源: %v", actions)
+	}
+	for name, status := range map[string]int{
+		"lost":    model.InstanceStatusFailed,
+		"exited":  model.InstanceStatusStopped,
+		"revived": model.InstanceStatusRunning,
+		"stackok": model.InstanceStatusRunning,
+	} {
+		instance, _ := model.GetVulInstanceByID(instances[name].ID)
+		if instance.Status != status {
+			t.Errorf("实例 %s 的状态为 %d，期望 %d", name, instance.Status, status)
+		}
+		if status != model.InstanceStatusRunning && instance.EndTime.IsZero() {
+			t.Errorf("实例 %s 应记录结束时间", name)
+		}
+	}
+
+	// adopt策略认领标签完整的孤儿资源，其余删除
+	report, err = v.Reconcile(OrphanPolicyAdopt, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	actions = reconcileActions(t, report)
+	for _, id := range []string{"orphan-taken", "orphan-nolabel", "orphan-noteam", "orphan-adopt"} {
+		if docker.wasRemoved(id) != (actions[id] == ReconcileRemove) {
+			t.Errorf("%s 的对账动作为 %q，删除状态不符", id, actions[id])
+		}
+	}
+	for _, id := range []string{"orphan-recent", "mysql", "adopt-stack-web"} {
+		if docker.wasRemoved(id) {
+			t.Errorf("%s 不应被删除", id)
+		}
+	}
+	for _, n := range docker.networks {
+		if n.ID == "remove-stack-net" {
+			t.Error("无法认领的堆栈应删除网络")
+		}
+	}
+
+	adopted, err := model.GetVulInstanceBy2ID(alice.ID, pwn.ID)
+	if err != nil || adopted.ContainerID != "orphan-adopt" || adopted.Status != model.InstanceStatusRunning || adopted.ExpireTime.Before(time.Now()) {
+		t.Fatalf("应认领单容器: %+v, %v", adopted, err)
+	}
+	adoptedStack, err := model.GetVulInstanceBy2ID(bob.ID, stackEnv.ID)
+	if err != nil || adoptedStack.StackName != adoptStack || adoptedStack.Status != model.InstanceStatusStopped {
+		t.Fatalf("应认领堆栈: %+v, %v", adoptedStack, err)
+	}
+	// 认领的实例生成新flag并写入容器，可以提交
+	if adopted.Flag == "" || adopted.Flag == adoptedStack.Flag {
+		t.Errorf("认领的实例应生成各自的flag: %q %q", adopted.Flag, adoptedStack.Flag)
+	}
+	if docker.files["orphan-adopt"]["/flag"] != adopted.Flag+"\n" || docker.files["adopt-stack-web"]["/flag"] != adoptedStack.Flag+"\n" {
+		t.Errorf("认领时应将flag写入容器: %v", docker.files)
+	}
+	if got, err := model.GetVulInstanceByFlag(adopted.Flag); err != nil || got.ID != adopted.ID {
+		t.Errorf("认领的实例的flag无法提交: %+v, %v", got, err)
+	}
+
+	// 再次对账没有需要处理的资源
+	report, err = v.Reconcile(OrphanPolicyAdopt, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Actions) != 0 {
+		t.Errorf("认领后再次对账不应有动作: %+v", report.Actions)
+	}
+}
+
+func TestReconcileAdoptRequiresFlagFile(t *testing.T) {
+	useTestDB(t) // 默认只通过环境变量注入flag
+	docker := useFakeDocker(t)
+	alice := createLocalUser(t, "alice", "alice123", RoleUser)
+	env := &model.VulEnv{EnvName: "web", EnvType: "单镜像", BaseImage: "web"}
+	model.CreateVulEnv(env)
+	docker.add("orphan", managedName(1), "running", time.Now().Add(-time.Hour), InstanceLabels(alice.ID, 0, env.ID))
+
+	// 容器环境变量中的旧flag无法更新，不能认领，也不能删除用户的容器，仅报告
+	report, err := (&VulService{}).Reconcile(OrphanPolicyAdopt, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actions := reconcileActions(t, report); actions["orphan"] != ReconcileReportOnly || len(docker.removed) != 0 {
+		t.Errorf("通过环境变量注入flag时应仅报告: %v %v", actions, docker.removed)
+	}
+	if _, err := model.GetVulInstanceBy2ID(alice.ID, env.ID); err == nil {
+		t.Error("不应创建实例记录")
+	}
+}
+
+func TestInterruptedLaunch(t *testing.T) {
+	useTestDB(t)
+	docker := useFakeDocker(t)
+	docker.images["img"] = nat.PortSet{}
+	alice := createLocalUser(t, "alice", "alice123", RoleUser)
+	bob := createLocalUser(t, "bob", "bob123", RoleUser)
+	for _, user := range []*model.User{alice, bob} {
+		if _, err := model.SetScore(user.ID, 25, 0, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	env := &model.VulEnv{EnvName: "web", EnvType: "单镜像", BaseImage: "img", Cost: 10}
+	model.CreateVulEnv(env)
+	v := &VulService{}
+
+	// alice的容器启动后、实例标记为运行中前进程退出
+	model.DB.Callback().Update().Before("gorm:update").Register("test:crash", func(db *gorm.DB) {
+		if instance, ok := db.Statement.Dest.(*model.VulInstance); ok && instance.Status == model.InstanceStatusRunning {
+			panic("进程退出")
+		}
+	})
+	func() {
+		defer func() { recover() }()
+		v.CreateVulInstance(alice.ID, 0, env.ID)
+	}()
+	model.DB.Callback().Update().Remove("test:crash")
+	pending, err := model.GetVulInstanceBy2ID(alice.ID, env.ID)
+	if err != nil || pending.Status != model.InstanceStatusNone || pending.ContainerID == "" || len(docker.containers) != 1 {
+		t.Fatalf("开启中断后应留下记录了容器的创建中实例: %+v, %v", pending, err)
+	}
+	if _, err := v.CreateVulInstance(alice.ID, 0, env.ID); err == nil {
+		t.Fatal("创建中的实例应阻止再次开启")
+	}
+
+	// bob的容器已创建但进程在记录容器前退出，只能按标签找到
+	bobPending := &model.VulInstance{UserID: bob.ID, VulEnvID: env.ID, ExpireTime: time.Now().Add(time.Hour)}
+	if err := model.ReserveVulInstance(bobPending, &model.ScoreEntry{UserID: bob.ID, Type: model.ScoreLaunchCost, Amount: -10, VulEnvID: env.ID}); err != nil {
+		t.Fatal(err)
+	}
+	docker.add("bob-unrecorded", managedName(1), "running", time.Now(), InstanceLabels(bob.ID, 0, env.ID))
+
+	backdate := func(instance *model.VulInstance) {
+		model.DB.Model(&model.VulInstance{}).Where("id = ?", instance.ID).Update("created_at", time.Now().Add(-launchTimeout-time.Minute))
+	}
+	assertCleaned := func(user *model.User, instance *model.VulInstance, containerID string) {
+		t.Helper()
+		if got, _ := model.GetVulInstanceByID(instance.ID); got.Status != model.InstanceStatusFailed {
+			t.Errorf("%s 的实例状态为 %d，应标记为异常", user.Username, got.Status)
+		}
+		if got, _ := model.GetUserByID(user.ID); got.Score != 25 {
+			t.Errorf("%s 的积分为 %v，应退还开销", user.Username, got.Score)
+		}
+		if !docker.wasRemoved(containerID) {
+			t.Errorf("应删除 %s 的容器", user.Username)
+		}
+	}
+
+	// 未超时的实例可能仍在开启，不处理
+	report, err := v.Reconcile(OrphanPolicyReport, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actions := reconcileActions(t, report); actions[strconv.Itoa(int(pending.ID))] != "" || len(docker.removed) != 0 {
+		t.Fatalf("未超时的创建中实例不应处理: %v", actions)
+	}
+
+	// 过期实例监控定期清理超时的实例
+	backdate(bobPending)
+	if _, err := v.CleanExpiredInstances(false); err != nil {
+		t.Fatal(err)
+	}
+	assertCleaned(bob, bobPending, "bob-unrecorded")
+	if docker.wasRemoved(pending.ContainerID) {
+		t.Error("未超时的实例不应被清理")
+	}
+
+	// 对账清理超时的实例
+	backdate(pending)
+	report, err = v.Reconcile(OrphanPolicyReport, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actions := reconcileActions(t, report); actions[strconv.Itoa(int(pending.ID))] != ReconcileMarkFailed {
+		t.Errorf("对账应将开启中断的实例标记为异常: %v", actions)
+	}
+	assertCleaned(alice, pending, pending.ContainerID)
+
+	// 再次对账不会重复退还，之后可以重新开启
+	if _, err := v.Reconcile(OrphanPolicyReport, false); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := model.GetUserByID(alice.ID); got.Score != 25 {
+		t.Errorf("重复退还开销: %v", got.Score)
+	}
+	if _, err := v.CreateVulInstance(alice.ID, 0, env.ID); err != nil {
+		t.Errorf("清理后应可以重新开启: %v", err)
+	}
+}
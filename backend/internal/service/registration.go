@@ -0,0 +1,326 @@
+package service
+
+import (
+	"AscensionPath/config"
+	"AscensionPath/internal/mail"
+	"AscensionPath/internal/middleware"
+	"AscensionPath/internal/model"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInviteRequired        = errors.New("需要邀请码才能注册")
+	ErrInvalidInviteCode     = errors.New("邀请码无效、已过期或已用完")
+	ErrEmailDomainNotAllowed = errors.New("该邮箱域名不允许注册")
+	ErrEmailNotVerified      = errors.New("邮箱尚未验证，请点击验证邮件中的链接")
+	ErrInvalidVerifyToken    = errors.New("验证链接无效或已过期，请重新发送验证邮件")
+	ErrEmailVerifyDisabled   = errors.New("未开启邮箱验证")
+)
+
+const (
+	// 同一账号重新发送验证邮件的最小间隔
+	verificationResendInterval = time.Minute
+	// 过期的验证令牌保留的时间，期间仍可重新发送验证邮件
+	verificationRetention = 30 * 24 * time.Hour
+	// 邀请码字符集，去掉了容易混淆的0/O、1/I/L
+	inviteAlphabet = "ABCDEFGHJKMNPQRSTUVWXYZ23456789"
+	// 邀请码有效期上限(天)
+	maxInviteDays = 365
+)
+
+// RegistrationInfo 注册页展示的注册方式
+type RegistrationInfo struct {
+	Mode           string   `json:"mode"`
+	AllowedDomains []string `json:"allowed_domains"`
+	Activation     string   `json:"activation"`
+}
+
+// GetRegistrationInfo 获取当前的注册方式
+func GetRegistrationInfo() RegistrationInfo {
+	conf := config.Current().Registration
+	info := RegistrationInfo{Mode: conf.EffectiveMode(), AllowedDomains: []string{}, Activation: conf.Activation}
+	if info.Mode == config.RegistrationDomain {
+		info.AllowedDomains = conf.Domains()
+	}
+	return info
+}
+
+// emailDomainAllowed 邮箱域名是否在允许列表中，*.example.edu 匹配example.edu的所有子域名
+func emailDomainAllowed(email string, domains []string) bool {
+	i := strings.LastIndex(email, "@")
+	if i < 0 {
+		return false
+	}
+	domain := strings.ToLower(email[i+1:])
+	for _, d := range domains {
+		if suffix, ok := strings.CutPrefix(d, "*."); ok {
+			if strings.HasSuffix(domain, "."+suffix) {
+				return true
+			}
+		} else if domain == d {
+			return true
+		}
+	}
+	return false
+}
+
+// registrationStatus 新注册账号的状态，管理员审核时使用邀请码注册的账号直接启用
+func registrationStatus(activation string, invited bool) int {
+	switch activation {
+	case config.ActivationNone:
+		return 1
+	case config.ActivationAdmin:
+		if invited {
+			return 1
+		}
+	}
+	return 0
+}
+
+func normalizeInviteCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// checkInviteCode 检查邀请码是否可用，实际占用在创建用户的事务中完成
+func checkInviteCode(code string) (*model.InviteCode, error) {
+	invite, err := model.GetInviteCode(code)
+	if err != nil {
+		return nil, ErrInvalidInviteCode
+	}
+	if invite.UsedCount >= invite.MaxUses || (invite.ExpiresAt != nil && invite.ExpiresAt.Before(time.Now())) {
+		return nil, ErrInvalidInviteCode
+	}
+	// 生成邀请码后身份可能已被删除
+	if !IsValidRole(invite.Role) {
+		return nil, ErrInvalidInviteCode
+	}
+	return invite, nil
+}
+
+// createRegisteredUser 保存注册的用户，使用邀请码时同时占用一次邀请码
+func createRegisteredUser(user *model.User, invite *model.InviteCode) error {
+	if invite == nil {
+		return model.CreateUser(user)
+	}
+	err := model.CreateUserWithInvite(user, invite.Code)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrInvalidInviteCode
+	}
+	return err
+}
+
+// sendVerificationEmail 生成验证令牌并在后台发送验证邮件
+func sendVerificationEmail(user *model.User) error {
+	conf := config.Current().Registration
+	token, hash, err := newRefreshToken()
+	if err != nil {
+		return err
+	}
+	expiresAt := time.Now().Add(conf.VerifyTTL.Std())
+	err = model.CreateEmailVerificationToken(&model.EmailVerificationToken{
+		UserID:    user.ID,
+		TokenHash: hash,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return fmt.Errorf("保存验证令牌失败: %v", err)
+	}
+	msg := mail.Message{
+		To:      user.Email,
+		Subject: "验证AscensionPath注册邮箱",
+		Body: fmt.Sprintf("%s，你好：\n\n感谢注册。请在%s之前打开以下链接验证邮箱，验证后账号即可登录：\n\n%s\n\n"+
+			"如果不是你本人注册，请忽略本邮件。\n",
+			user.Username, expiresAt.Format("2006-01-02 15:04"), tokenLink(conf.VerifyURL, token)),
+	}
+	go sendMail(msg, user.ID)
+	return nil
+}
+
+// isPendingVerification 账号是否在等待验证邮箱
+func isPendingVerification(user *model.User) bool {
+	if user.Status != 0 {
+		return false
+	}
+	_, err := model.GetPendingEmailVerification(user.ID)
+	return err == nil
+}
+
+// VerifyEmail 使用验证邮件中的令牌启用账号
+func VerifyEmail(token string) (*model.User, error) {
+	user, err := model.VerifyEmail(hashToken(token))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidVerifyToken
+		}
+		return nil, err
+	}
+	middleware.SugarLogger.Infow("邮箱验证成功，账号已启用", "userID", user.ID, "username", user.Username)
+	return user, nil
+}
+
+// ResendVerification 重新发送验证邮件。无论邮箱是否存在都返回成功，避免被用来探测账号
+func ResendVerification(email, ip string) error {
+	if config.Current().Registration.Activation != config.ActivationEmail {
+		return ErrEmailVerifyDisabled
+	}
+	user, err := model.GetUserByEmail(strings.TrimSpace(email))
+	if err != nil || user.Status != 0 {
+		return nil
+	}
+	pending, err := model.GetPendingEmailVerification(user.ID)
+	if err != nil {
+		// 被管理员禁用的账号没有待验证的令牌
+		return nil
+	}
+	if time.Since(pending.CreatedAt) < verificationResendInterval {
+		middleware.SugarLogger.Warnw("重新发送验证邮件过于频繁", "userID", user.ID, "ip", ip)
+		return nil
+	}
+	middleware.SugarLogger.Infow("重新发送验证邮件", "userID", user.ID, "ip", ip)
+	return sendVerificationEmail(user)
+}
+
+// StartEmailVerificationCleanup 定时删除过期较久的验证令牌，ctx取消后停止
+func StartEmailVerificationCleanup(ctx context.Context) {
+	runPeriodic(ctx, "email-verification-cleanup", time.Hour, func() error {
+		_, err := model.DeleteExpiredEmailVerificationTokens(time.Now().Add(-verificationRetention))
+		return err
+	})
+}
+
+// InviteCodeDTO 邀请码
+type InviteCodeDTO struct {
+	ID        uint       `json:"id"`
+	Code      string     `json:"code"`
+	Role      string     `json:"role"`
+	Score     float64    `json:"score"`
+	MaxUses   int        `json:"max_uses"`
+	UsedCount int        `json:"used_count"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	Note      string     `json:"note"`
+	CreatedBy uint       `json:"created_by"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+func toInviteCodeDTO(invite model.InviteCode) InviteCodeDTO {
+	return InviteCodeDTO{
+		ID:        invite.ID,
+		Code:      invite.Code,
+		Role:      invite.Role,
+		Score:     invite.Score,
+		MaxUses:   invite.MaxUses,
+		UsedCount: invite.UsedCount,
+		ExpiresAt: invite.ExpiresAt,
+		Note:      invite.Note,
+		CreatedBy: invite.CreatedBy,
+		CreatedAt: invite.CreatedAt,
+	}
+}
+
+// ListInviteCodes 获取所有邀请码
+func (s *UserService) ListInviteCodes() ([]InviteCodeDTO, error) {
+	if !s.Can(PermUserManage) {
+		return nil, errors.New("权限不足")
+	}
+	invites, err := model.GetInviteCodes()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]InviteCodeDTO, 0, len(invites))
+	for _, invite := range invites {
+		result = append(result, toInviteCodeDTO(invite))
+	}
+	return result, nil
+}
+
+// CreateInviteCode 生成邀请码，有效期为0时不过期；只能预设自己可以授予的身份
+func (s *UserService) CreateInviteCode(role string, score float64, maxUses, expiresInDays int, note string) (*InviteCodeDTO, error) {
+	if !s.Can(PermUserManage) {
+		return nil, errors.New("权限不足")
+	}
+	if role == "" {
+		role = RoleUser
+	}
+	if !IsValidRole(role) {
+		return nil, errors.New("无效的角色类型")
+	}
+	if !s.canAssignRole(role) {
+		return nil, errors.New("不能授予权限超过自己的身份")
+	}
+	if maxUses < 1 || maxUses > 1000 {
+		return nil, errors.New("使用次数必须在1到1000之间")
+	}
+	if score < 0 {
+		return nil, errors.New("初始积分不能为负数")
+	}
+	if expiresInDays < 0 || expiresInDays > maxInviteDays {
+		return nil, fmt.Errorf("有效期必须在0到%d天之间", maxInviteDays)
+	}
+	note = strings.TrimSpace(note)
+	if len([]rune(note)) > 100 {
+		return nil, errors.New("备注不能超过100个字符")
+	}
+
+	code, err := newInviteCode()
+	if err != nil {
+		return nil, err
+	}
+	invite := &model.InviteCode{
+		Code:      code,
+		Role:      role,
+		Score:     score,
+		MaxUses:   maxUses,
+		Note:      note,
+		CreatedBy: s.ID,
+	}
+	if expiresInDays > 0 {
+		expiresAt := time.Now().AddDate(0, 0, expiresInDays)
+		invite.ExpiresAt = &expiresAt
+	}
+	if err := model.CreateInviteCode(invite); err != nil {
+		return nil, fmt.Errorf("生成邀请码失败: %v", err)
+	}
+	middleware.SugarLogger.Infow("生成邀请码", "operatorID", s.ID, "inviteID", invite.ID, "role", role, "score", score, "maxUses", maxUses)
+	dto := toInviteCodeDTO(*invite)
+	return &dto, nil
+}
+
+// DeleteInviteCode 删除邀请码，已使用邀请码注册的账号不受影响
+func (s *UserService) DeleteInviteCode(id uint) error {
+	if !s.Can(PermUserManage) {
+		return errors.New("权限不足")
+	}
+	if err := model.DeleteInviteCode(id); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errors.New("邀请码不存在")
+		}
+		return err
+	}
+	middleware.SugarLogger.Infow("删除邀请码", "operatorID", s.ID, "inviteID", id)
+	return nil
+}
+
+// newInviteCode 生成形如 ABCD-EFGH-JKMN 的邀请码
+func newInviteCode() (string, error) {
+	var b strings.Builder
+	max := big.NewInt(int64(len(inviteAlphabet)))
+	for i := 0; i < 12; i++ {
+		if i > 0 && i%4 == 0 {
+			b.WriteByte('-')
+		}
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", fmt.Errorf("生成随机数失败: %v", err)
+		}
+		b.WriteByte(inviteAlphabet[n.Int64()])
+	}
+	return b.String(), nil
+}
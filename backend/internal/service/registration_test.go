@@ -0,0 +1,156 @@
+package service
+
+import (
+	"AscensionPath/config"
+	"AscensionPath/internal/model"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRegistrationModes(t *testing.T) {
+	conf := useTestDB(t)
+	admin := &UserService{UserDTO: UserDTO{ID: 1, Role: RoleAdmin}}
+	s := &UserService{}
+
+	conf.Registration.Open = false
+	if _, err := s.Register("alice", "password1", "alice@example.edu", ""); err != ErrRegistrationClosed {
+		t.Errorf("未设置mode且open为false时应关闭注册: %v", err)
+	}
+
+	conf.Registration.Mode = config.RegistrationInvite
+	if _, err := s.Register("alice", "password1", "alice@example.edu", ""); err != ErrInviteRequired {
+		t.Errorf("invite方式应要求邀请码: %v", err)
+	}
+	if _, err := s.Register("alice", "password1", "alice@example.edu", "NOPE-NOPE-NOPE"); err != ErrInvalidInviteCode {
+		t.Errorf("不存在的邀请码应被拒绝: %v", err)
+	}
+	invite, err := admin.CreateInviteCode(RoleVip, 50, 1, 7, "2024级")
+	if err != nil {
+		t.Fatalf("CreateInviteCode: %v", err)
+	}
+	if invite.ExpiresAt == nil || len(invite.Code) != 14 {
+		t.Fatalf("邀请码不正确: %+v", invite)
+	}
+	// 邀请码不区分大小写
+	user, err := s.Register("alice", "password1", "alice@example.edu", strings.ToLower(invite.Code))
+	if err != nil {
+		t.Fatalf("使用邀请码注册失败: %v", err)
+	}
+	if user.Role != RoleVip || user.Score != 50 || user.Status != 1 {
+		t.Errorf("邀请码预设的身份、积分或状态不正确: %+v", user)
+	}
+	if _, err := s.Register("bob", "password1", "bob@example.edu", invite.Code); err != ErrInvalidInviteCode {
+		t.Errorf("用完的邀请码应被拒绝: %v", err)
+	}
+
+	conf.Registration.Mode = config.RegistrationDomain
+	conf.Registration.AllowedDomains = "example.edu, *.campus.edu"
+	if _, err := s.Register("bob", "password1", "bob@gmail.com", ""); err != ErrEmailDomainNotAllowed {
+		t.Errorf("不在允许列表中的域名应被拒绝: %v", err)
+	}
+	if _, err := s.Register("bob", "password1", "bob@cs.campus.edu", ""); err != nil {
+		t.Errorf("子域名应允许注册: %v", err)
+	}
+	user, err = s.Register("carol", "password1", "carol@example.edu", "")
+	if err != nil || user.Status != 0 || user.Role != RoleUser {
+		t.Errorf("未使用邀请码时应等待管理员审核: %+v, %v", user, err)
+	}
+	// 使用邀请码时不受域名限制
+	invite, _ = admin.CreateInviteCode("", 0, 2, 0, "")
+	if _, err := s.Register("dave", "password1", "dave@gmail.com", invite.Code); err != nil {
+		t.Errorf("使用邀请码时应不受域名限制: %v", err)
+	}
+
+	// 只能预设自己可以授予的身份
+	ta := &UserService{UserDTO: UserDTO{ID: 2, Role: "instructor"}}
+	if _, err := ta.CreateInviteCode(RoleUser, 0, 1, 0, ""); err == nil {
+		t.Error("没有用户管理权限时不能生成邀请码")
+	}
+	if _, err := admin.CreateInviteCode("nobody", 0, 1, 0, ""); err == nil {
+		t.Error("不存在的身份不能生成邀请码")
+	}
+	if _, err := admin.CreateInviteCode(RoleUser, 0, 0, 0, ""); err == nil {
+		t.Error("使用次数必须大于0")
+	}
+	invites, err := admin.ListInviteCodes()
+	if err != nil || len(invites) != 2 {
+		t.Fatalf("ListInviteCodes = %+v, %v", invites, err)
+	}
+	if err := admin.DeleteInviteCode(invites[0].ID); err != nil {
+		t.Fatalf("DeleteInviteCode: %v", err)
+	}
+}
+
+func TestEmailVerificationFlow(t *testing.T) {
+	conf := useTestDB(t)
+	sent := useCaptureMail(t)
+	conf.Registration.Activation = config.ActivationEmail
+	conf.Registration.VerifyURL = "https://lab.example.edu/static/#/verifyEmail"
+	s := &UserService{}
+
+	user, err := s.Register("erin", "password1", "erin@example.edu", "")
+	if err != nil || user.Status != 0 {
+		t.Fatalf("Register = %+v, %v", user, err)
+	}
+	token := receiveToken(t, sent, conf.Registration.VerifyURL)
+
+	if _, err := s.Login("erin", "password1", "127.0.0.1", "test"); err != ErrEmailNotVerified {
+		t.Errorf("验证邮箱前登录应提示验证: %v", err)
+	}
+	// 一分钟内不重复发送
+	if err := ResendVerification("erin@example.edu", "127.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-sent:
+		t.Error("频繁申请不应重复发送验证邮件")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if _, err := VerifyEmail("wrong"); err != ErrInvalidVerifyToken {
+		t.Errorf("错误的令牌应被拒绝: %v", err)
+	}
+	if _, err := VerifyEmail(token); err != nil {
+		t.Fatalf("VerifyEmail: %v", err)
+	}
+	if _, err := VerifyEmail(token); err != ErrInvalidVerifyToken {
+		t.Errorf("令牌只能使用一次: %v", err)
+	}
+	if _, err := s.Login("erin", "password1", "127.0.0.1", "test"); err != nil {
+		t.Errorf("验证后应能登录: %v", err)
+	}
+
+	// 管理员禁用等待验证的账号后，验证链接失效
+	user, _ = s.Register("frank", "password1", "frank@example.edu", "")
+	token = receiveToken(t, sent, conf.Registration.VerifyURL)
+	admin := &UserService{UserDTO: UserDTO{ID: 1, Role: RoleAdmin}}
+	if err := admin.UpdateProfile(user.ID, "", 0, "", -1, "", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyEmail(token); err != ErrInvalidVerifyToken {
+		t.Errorf("管理员修改状态后验证链接应失效: %v", err)
+	}
+	if _, err := s.Login("frank", "password1", "127.0.0.1", "test"); err == ErrEmailNotVerified {
+		t.Error("被管理员禁用的账号不应提示验证邮箱")
+	}
+	if got, _ := model.GetUserByID(user.ID); got.Status != 0 {
+		t.Errorf("账号状态为 %d", got.Status)
+	}
+}
+
+// receiveToken 从捕获的邮件中取出链接里的令牌
+func receiveToken(t *testing.T, sent captureSender, base string) string {
+	t.Helper()
+	select {
+	case msg := <-sent:
+		i := strings.Index(msg.Body, base+"?token=")
+		if i < 0 {
+			t.Fatalf("邮件中没有链接: %s", msg.Body)
+		}
+		return strings.Fields(msg.Body[i+len(base+"?token="):])[0]
+	case <-time.After(5 * time.Second):
+		t.Fatal("未发送邮件")
+	}
+	return ""
+}
@@ -0,0 +1,356 @@
+package service
+
+import (
+	"AscensionPath/internal/middleware"
+	"AscensionPath/internal/model"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 权限，保存在role_permissions中，路由通过requirePermission校验
+const (
+	PermUserManage        = "user:manage"
+	PermRoleManage        = "role:manage"
+	PermInstanceViewAll   = "instance:view_all"
+	PermInstanceExtendAll = "instance:extend_all"
+	PermInstanceRemoveAll = "instance:remove_all"
+	PermImageView         = "image:view"
+	PermImageManage       = "image:manage"
+	PermSystemManage      = "system:manage"
+	PermTeamManage        = "team:manage"
+	PermCourseManage      = "course:manage"
+)
+
+// Permission 权限说明
+type Permission struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// Permissions 所有可分配的权限
+var Permissions = []Permission{
+	{PermUserManage, "管理用户：添加、修改、删除用户，解除登录锁定，重置两步验证"},
+	{PermRoleManage, "管理身份和权限"},
+	{PermInstanceViewAll, "查看所有用户的实例"},
+	{PermInstanceExtendAll, "延长其他用户实例的有效期"},
+	{PermInstanceRemoveAll, "删除其他用户的实例"},
+	{PermImageView, "查看镜像和漏洞环境配置"},
+	{PermImageManage, "上传、拉取镜像，创建和删除漏洞环境，对账实例"},
+	{PermSystemManage, "修改系统设置，轮换JWT密钥"},
+	{PermTeamManage, "创建、修改和删除团队，管理团队成员"},
+	{PermCourseManage, "管理课程、选课学生和作业，查看学生进度"},
+}
+
+// 身份名称：小写字母开头，只能包含小写字母、数字、下划线和短横线
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]{1,19}$`)
+
+// 其他实例修改身份后同步到本实例的间隔
+const roleSyncInterval = 1 * time.Minute
+
+// RoleDTO 身份及其权限
+type RoleDTO struct {
+	ID          uint      `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Level       int       `json:"level"`
+	Builtin     bool      `json:"builtin"`
+	Permissions []string  `json:"permissions"`
+	UserCount   int64     `json:"user_count"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// RoleStore 身份缓存，每次请求校验权限时不查库
+type RoleStore struct {
+	mu    sync.RWMutex
+	roles map[string]*RoleDTO
+}
+
+// Roles 全局身份缓存
+var Roles = &RoleStore{}
+
+// Load 从数据库加载所有身份和权限
+func (r *RoleStore) Load() error {
+	roles, err := model.GetRoles()
+	if err != nil {
+		return fmt.Errorf("加载身份失败: %v", err)
+	}
+	permissions, err := model.GetRolePermissions()
+	if err != nil {
+		return fmt.Errorf("加载身份权限失败: %v", err)
+	}
+	byID := make(map[uint]*RoleDTO, len(roles))
+	byName := make(map[string]*RoleDTO, len(roles))
+	for _, role := range roles {
+		dto := &RoleDTO{
+			ID:          role.ID,
+			Name:        role.Name,
+			Description: role.Description,
+			Level:       role.Level,
+			Builtin:     role.Builtin,
+			Permissions: []string{},
+			UpdatedAt:   role.UpdatedAt,
+		}
+		byID[role.ID] = dto
+		byName[role.Name] = dto
+	}
+	for _, p := range permissions {
+		if dto, ok := byID[p.RoleID]; ok {
+			dto.Permissions = append(dto.Permissions, p.Permission)
+		}
+	}
+
+	r.mu.Lock()
+	r.roles = byName
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *RoleStore) get(name string) (*RoleDTO, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	role, ok := r.roles[name]
+	return role, ok
+}
+
+// list 按开放级别和名称排序的所有身份
+func (r *RoleStore) list() []RoleDTO {
+	r.mu.RLock()
+	result := make([]RoleDTO, 0, len(r.roles))
+	for _, role := range r.roles {
+		result = append(result, *role)
+	}
+	r.mu.RUnlock()
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Level != result[j].Level {
+			return result[i].Level < result[j].Level
+		}
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// IsValidRole 身份是否存在
+func IsValidRole(role string) bool {
+	_, ok := Roles.get(role)
+	return ok
+}
+
+// RoleLevel 身份的漏洞环境开放级别，数值越小可见的环境越多；未知身份看不到任何环境
+func RoleLevel(role string) int {
+	if r, ok := Roles.get(role); ok {
+		return r.Level
+	}
+	return math.MaxInt
+}
+
+// HasPermission 身份是否拥有权限，admin始终拥有所有权限
+func HasPermission(role, permission string) bool {
+	if role == RoleAdmin {
+		return true
+	}
+	r, ok := Roles.get(role)
+	if !ok {
+		return false
+	}
+	for _, p := range r.Permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// RolePermissions 身份拥有的所有权限
+func RolePermissions(role string) []string {
+	var result []string
+	for _, p := range Permissions {
+		if HasPermission(role, p.Name) {
+			result = append(result, p.Name)
+		}
+	}
+	return result
+}
+
+// Can 当前用户是否拥有权限，通过访问令牌认证时令牌还须拥有包含该权限的范围
+func (s *UserService) Can(permission string) bool {
+	if s.APIToken != nil && !s.APIToken.allows(permission) {
+		return false
+	}
+	return HasPermission(s.Role, permission)
+}
+
+// canAssignRole 只能授予自己拥有的权限，防止用户管理员把他人或自己提升为管理员
+func (s *UserService) canAssignRole(role string) bool {
+	if s.Role == RoleAdmin {
+		return true
+	}
+	if role == RoleAdmin {
+		return false
+	}
+	for _, p := range RolePermissions(role) {
+		if !s.Can(p) {
+			return false
+		}
+	}
+	return true
+}
+
+// ListRoles 获取所有身份及使用人数
+func (s *UserService) ListRoles() ([]RoleDTO, error) {
+	if !s.Can(PermUserManage) && !s.Can(PermRoleManage) {
+		return nil, errors.New("权限不足")
+	}
+	roles := Roles.list()
+	for i := range roles {
+		count, err := model.CountUsersByRole(roles[i].Name)
+		if err != nil {
+			return nil, err
+		}
+		roles[i].UserCount = count
+	}
+	return roles, nil
+}
+
+// CreateRole 创建身份
+func (s *UserService) CreateRole(name, description string, level int, permissions []string) (*RoleDTO, error) {
+	if !s.Can(PermRoleManage) {
+		return nil, errors.New("权限不足")
+	}
+	name = strings.TrimSpace(name)
+	if !roleNamePattern.MatchString(name) {
+		return nil, errors.New("身份名称必须以小写字母开头，只能包含小写字母、数字、下划线和短横线，长度2-20")
+	}
+	if IsValidRole(name) {
+		return nil, errors.New("身份已存在")
+	}
+	permissions, err := s.normalizePermissions(permissions)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.validateRoleFields(description, level); err != nil {
+		return nil, err
+	}
+	role := &model.Role{Name: name, Description: strings.TrimSpace(description), Level: level}
+	if err := model.CreateRole(role, permissions); err != nil {
+		return nil, fmt.Errorf("创建身份失败: %v", err)
+	}
+	middleware.SugarLogger.Infow("创建身份", "operatorID", s.ID, "role", name, "level", level, "permissions", permissions)
+	return s.reloadRole(name)
+}
+
+// UpdateRole 修改身份的说明、开放级别和权限，admin身份不能修改
+func (s *UserService) UpdateRole(name, description string, level int, permissions []string) (*RoleDTO, error) {
+	if !s.Can(PermRoleManage) {
+		return nil, errors.New("权限不足")
+	}
+	if name == RoleAdmin {
+		return nil, errors.New("admin身份拥有所有权限，不能修改")
+	}
+	if name == s.Role {
+		return nil, errors.New("不能修改自己的身份")
+	}
+	role, ok := Roles.get(name)
+	if !ok {
+		return nil, errors.New("身份不存在")
+	}
+	permissions, err := s.normalizePermissions(permissions)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.validateRoleFields(description, level); err != nil {
+		return nil, err
+	}
+	err = model.UpdateRole(&model.Role{ID: role.ID, Description: strings.TrimSpace(description), Level: level}, permissions)
+	if err != nil {
+		return nil, fmt.Errorf("修改身份失败: %v", err)
+	}
+	middleware.SugarLogger.Infow("修改身份", "operatorID", s.ID, "role", name, "level", level, "permissions", permissions)
+	return s.reloadRole(name)
+}
+
+// DeleteRole 删除身份，内置身份和仍有用户使用的身份不能删除
+func (s *UserService) DeleteRole(name string) error {
+	if !s.Can(PermRoleManage) {
+		return errors.New("权限不足")
+	}
+	role, ok := Roles.get(name)
+	if !ok {
+		return errors.New("身份不存在")
+	}
+	if role.Builtin {
+		return errors.New("内置身份不能删除")
+	}
+	count, err := model.CountUsersByRole(name)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return fmt.Errorf("仍有%d个用户使用该身份，请先修改这些用户的身份", count)
+	}
+	if err := model.DeleteRole(role.ID); err != nil {
+		return fmt.Errorf("删除身份失败: %v", err)
+	}
+	middleware.SugarLogger.Infow("删除身份", "operatorID", s.ID, "role", name)
+	return Roles.Load()
+}
+
+// normalizePermissions 校验并去重权限，只能授予自己拥有的权限
+func (s *UserService) normalizePermissions(permissions []string) ([]string, error) {
+	requested := make(map[string]bool, len(permissions))
+	for _, p := range permissions {
+		requested[strings.TrimSpace(p)] = true
+	}
+	result := make([]string, 0, len(requested))
+	for _, p := range Permissions {
+		if !requested[p.Name] {
+			continue
+		}
+		if !s.Can(p.Name) {
+			return nil, fmt.Errorf("不能授予自己没有的权限: %s", p.Name)
+		}
+		result = append(result, p.Name)
+		delete(requested, p.Name)
+	}
+	for p := range requested {
+		return nil, fmt.Errorf("未知的权限: %s", p)
+	}
+	return result, nil
+}
+
+// validateRoleFields 校验身份说明和开放级别，开放级别不能低于自己的身份
+func (s *UserService) validateRoleFields(description string, level int) error {
+	if len([]rune(strings.TrimSpace(description))) > 100 {
+		return errors.New("身份说明不能超过100个字符")
+	}
+	if level < 0 || level > 1000 {
+		return errors.New("开放级别必须在0到1000之间")
+	}
+	if level < RoleLevel(s.Role) {
+		return errors.New("开放级别不能低于自己身份的开放级别")
+	}
+	return nil
+}
+
+func (s *UserService) reloadRole(name string) (*RoleDTO, error) {
+	if err := Roles.Load(); err != nil {
+		return nil, err
+	}
+	role, ok := Roles.get(name)
+	if !ok {
+		return nil, errors.New("身份不存在")
+	}
+	dto := *role
+	return &dto, nil
+}
+
+// StartRoleSync 定时重新加载身份，同步其他实例的修改，ctx取消后停止
+func StartRoleSync(ctx context.Context) {
+	runPeriodic(ctx, "role-sync", roleSyncInterval, Roles.Load)
+}
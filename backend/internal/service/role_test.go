@@ -0,0 +1,85 @@
+package service
+
+import (
+	"AscensionPath/internal/model"
+	"testing"
+)
+
+func TestRolePermissions(t *testing.T) {
+	useTestDB(t)
+
+	if !IsValidRole("instructor") || IsValidRole("nobody") {
+		t.Fatal("IsValidRole 应查询数据库中的身份")
+	}
+	if RoleLevel(RoleAdmin) != 0 || RoleLevel(RoleVip) != 500 || RoleLevel(RoleUser) != 999 {
+		t.Fatal("预置身份的开放级别应与原RoleMap一致")
+	}
+	instructor := &UserService{UserDTO: UserDTO{Role: "instructor"}}
+	if !instructor.Can(PermInstanceViewAll) || !instructor.Can(PermInstanceExtendAll) || instructor.Can(PermImageManage) {
+		t.Fatalf("instructor的权限不正确: %v", RolePermissions("instructor"))
+	}
+	if len(RolePermissions(RoleAdmin)) != len(Permissions) {
+		t.Fatal("admin应拥有所有权限")
+	}
+	if HasPermission(RoleUser, PermUserManage) || HasPermission("nobody", PermUserManage) {
+		t.Fatal("普通用户和未知身份不应有管理权限")
+	}
+}
+
+func TestRoleManagement(t *testing.T) {
+	useTestDB(t)
+	admin := &UserService{UserDTO: UserDTO{ID: 1, Role: RoleAdmin}}
+
+	if _, err := admin.CreateRole("Bad Name", "", 999, nil); err == nil {
+		t.Error("非法的身份名应创建失败")
+	}
+	if _, err := admin.CreateRole("ta", "", 999, []string{"unknown:perm"}); err == nil {
+		t.Error("未知的权限应创建失败")
+	}
+	role, err := admin.CreateRole("ta", "助教", 800, []string{PermUserManage, PermInstanceViewAll})
+	if err != nil {
+		t.Fatalf("CreateRole: %v", err)
+	}
+	if role.Level != 800 || len(role.Permissions) != 2 || !HasPermission("ta", PermUserManage) {
+		t.Fatalf("创建后缓存未更新: %+v", role)
+	}
+	if _, err := admin.UpdateRole(RoleAdmin, "", 0, nil); err == nil {
+		t.Error("admin身份不能修改")
+	}
+
+	// 用户管理员不能把自己或他人提升为权限更高的身份
+	ta := &UserService{UserDTO: UserDTO{ID: 100, Role: "ta"}}
+	target := createLocalUser(t, "bob", "password1", RoleUser)
+	if err := ta.UpdateUserRole(target.ID, RoleAdmin); err == nil {
+		t.Error("用户管理员不能授予admin身份")
+	}
+	if err := ta.UpdateUserRole(target.ID, "instructor"); err == nil {
+		t.Error("不能授予包含自己没有的权限的身份")
+	}
+	if err := ta.UpdateUserRole(target.ID, RoleVip); err != nil {
+		t.Errorf("应能授予权限不超过自己的身份: %v", err)
+	}
+	root := createLocalUser(t, "root", "password1", RoleAdmin)
+	if err := ta.ChangePassword(root.ID, "", "newpassword"); err == nil {
+		t.Error("用户管理员不能重置管理员的密码")
+	}
+
+	if err := admin.UpdateUserRole(target.ID, "ta"); err != nil {
+		t.Fatal(err)
+	}
+	if err := admin.DeleteRole("ta"); err == nil {
+		t.Error("仍有用户使用的身份不能删除")
+	}
+	if err := admin.DeleteRole(RoleVip); err == nil {
+		t.Error("内置身份不能删除")
+	}
+	if err := model.UpdateUserRole(target.ID, RoleUser); err != nil {
+		t.Fatal(err)
+	}
+	if err := admin.DeleteRole("ta"); err != nil {
+		t.Fatalf("DeleteRole: %v", err)
+	}
+	if IsValidRole("ta") {
+		t.Error("删除后缓存未更新")
+	}
+}
@@ -0,0 +1,95 @@
+package service
+
+import (
+	"AscensionPath/internal/middleware"
+	"AscensionPath/internal/model"
+	"AscensionPath/internal/utils"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ScoreEntryDTO 积分流水
+type ScoreEntryDTO struct {
+	ID         uint      `json:"id"`
+	Type       string    `json:"type"` // launch_cost/refund/solve_reward/admin_grant
+	Amount     float64   `json:"amount"`
+	Balance    float64   `json:"balance"` // 变化后的积分
+	VulEnvID   uint      `json:"vul_env_id"`
+	EnvName    string    `json:"env_name"`
+	RefID      uint      `json:"ref_id"`
+	OperatorID uint      `json:"operator_id"`
+	Note       string    `json:"note"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// reserveLaunch 扣除开启实例的开销并写入创建中的实例记录，返回扣费流水，没有开销时为nil
+func reserveLaunch(instance *model.VulInstance, vulEnv *model.VulEnv) (*model.ScoreEntry, error) {
+	var charge *model.ScoreEntry
+	if vulEnv.Cost != 0 {
+		charge = &model.ScoreEntry{
+			UserID:   instance.UserID,
+			Type:     model.ScoreLaunchCost,
+			Amount:   -vulEnv.Cost,
+			VulEnvID: vulEnv.ID,
+		}
+		if instance.TeamID != 0 {
+			charge.Note = fmt.Sprintf("团队%d的实例", instance.TeamID)
+		}
+	}
+	if err := model.ReserveVulInstance(instance, charge); err != nil {
+		switch {
+		case errors.Is(err, utils.ErrInsufficientScore):
+			return nil, err
+		case errors.Is(err, utils.ErrInstanceExists) && instance.TeamID != 0:
+			return nil, fmt.Errorf("团队已经有该环境的实例")
+		case errors.Is(err, utils.ErrInstanceExists):
+			return nil, fmt.Errorf("用户已经有该环境的实例")
+		}
+		return nil, fmt.Errorf("扣除余额失败: %v", err)
+	}
+	return charge, nil
+}
+
+// refundLaunchCost 实例创建失败时退还开销
+func refundLaunchCost(charge *model.ScoreEntry, cause error) {
+	refund, err := model.RefundScore(charge.ID, truncate("创建实例失败: "+cause.Error(), 255))
+	if err != nil {
+		middleware.SugarLogger.Errorw("退还实例开销失败", "userID", charge.UserID, "chargeID", charge.ID,
+			"amount", -charge.Amount, "error", err.Error())
+		return
+	}
+	middleware.SugarLogger.Infow("已退还实例开销", "userID", charge.UserID, "chargeID", charge.ID,
+		"amount", refund.Amount, "balance", refund.Balance)
+}
+
+// GetScoreLedger 分页获取积分流水，普通用户只能查看自己的流水
+func (s *UserService) GetScoreLedger(userID uint, page, pageSize int) ([]ScoreEntryDTO, int64, error) {
+	if userID != s.ID && !s.canManageUser(userID) {
+		return nil, 0, errors.New("权限不足")
+	}
+	entries, count, err := model.GetScoreEntries(userID, page, pageSize)
+	if err != nil {
+		return nil, 0, err
+	}
+	envNames, err := vulEnvNames()
+	if err != nil {
+		return nil, 0, err
+	}
+	result := make([]ScoreEntryDTO, 0, len(entries))
+	for _, e := range entries {
+		result = append(result, ScoreEntryDTO{
+			ID:         e.ID,
+			Type:       e.Type,
+			Amount:     e.Amount,
+			Balance:    e.Balance,
+			VulEnvID:   e.VulEnvID,
+			EnvName:    envNames[e.VulEnvID],
+			RefID:      e.RefID,
+			OperatorID: e.OperatorID,
+			Note:       e.Note,
+			CreatedAt:  e.CreatedAt,
+		})
+	}
+	return result, count, nil
+}
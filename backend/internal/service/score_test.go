@@ -0,0 +1,151 @@
+package service
+
+import (
+	"AscensionPath/internal/model"
+	"AscensionPath/internal/utils"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/docker/go-connections/nat"
+	"gorm.io/gorm"
+)
+
+func TestScoreLedger(t *testing.T) {
+	useTestDB(t)
+	alice := &model.User{Username: "alice", Password: "x", Email: "alice@example.com", Status: 1, Role: RoleUser}
+	if err := model.CreateUser(alice); err != nil {
+		t.Fatal(err)
+	}
+	admin := &UserService{UserDTO: UserDTO{ID: 100, Username: "admin", Role: RoleAdmin}}
+	user := &UserService{UserDTO: UserDTO{ID: alice.ID, Username: "alice", Role: RoleUser}}
+	env := &model.VulEnv{EnvName: "sqli", EnvType: "单镜像", BaseImage: "ascension-test/missing:none", Cost: 10}
+	model.CreateVulEnv(env)
+
+	// 余额不足时不扣费
+	vul := VulService{}
+	if _, err := vul.CreateVulInstance(alice.ID, 0, env.ID); err != utils.ErrInsufficientScore {
+		t.Errorf("余额不足时应创建失败: %v", err)
+	}
+
+	// 管理员调整积分记录流水
+	if err := admin.UpdateProfile(alice.ID, "", -1, "", -5, "", ""); err == nil {
+		t.Error("积分不能调整为负数")
+	}
+	if err := admin.UpdateProfile(alice.ID, "", -1, "", 25, "", ""); err != nil {
+		t.Fatalf("UpdateProfile: %v", err)
+	}
+	if err := user.UpdateProfile(alice.ID, "", -1, "", 1000, "", ""); err == nil {
+		t.Error("普通用户只修改积分时应没有可更新的字段")
+	}
+
+	// 创建失败时自动退还开销
+	if _, err := vul.CreateVulInstance(alice.ID, 0, env.ID); err == nil {
+		t.Fatal("镜像不存在时应创建失败")
+	}
+	if got, _ := model.GetUserByID(alice.ID); got.Score != 25 {
+		t.Errorf("创建失败后积分 = %v，应退还开销", got.Score)
+	}
+	entries, count, err := user.GetScoreLedger(alice.ID, 1, 10)
+	if err != nil || count != 3 {
+		t.Fatalf("GetScoreLedger = %+v, %d, %v", entries, count, err)
+	}
+	refund, charge, grant := entries[0], entries[1], entries[2]
+	if refund.Type != model.ScoreRefund || refund.RefID != charge.ID || refund.Amount != 10 || refund.Balance != 25 {
+		t.Errorf("退款流水 = %+v", refund)
+	}
+	if charge.Type != model.ScoreLaunchCost || charge.Amount != -10 || charge.EnvName != "sqli" {
+		t.Errorf("扣费流水 = %+v", charge)
+	}
+	if grant.Type != model.ScoreAdminGrant || grant.Amount != 25 || grant.OperatorID != admin.ID {
+		t.Errorf("调整流水 = %+v", grant)
+	}
+
+	// 只有用户管理员可以查看其他用户的流水
+	other := &UserService{UserDTO: UserDTO{ID: 200, Username: "bob", Role: RoleUser}}
+	if _, _, err := other.GetScoreLedger(alice.ID, 1, 10); err == nil {
+		t.Error("普通用户不能查看其他用户的流水")
+	}
+	if _, count, err := admin.GetScoreLedger(alice.ID, 1, 10); err != nil || count != 3 {
+		t.Errorf("管理员查看流水 = %d, %v", count, err)
+	}
+
+	if err := admin.DeleteAccount(alice.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, count, _ := model.GetScoreEntries(alice.ID, 1, 10); count != 0 {
+		t.Errorf("删除用户后仍有 %d 条流水", count)
+	}
+}
+
+func TestLaunchRecordFailureRemovesContainer(t *testing.T) {
+	useTestDB(t)
+	docker := useFakeDocker(t)
+	docker.images["img"] = nat.PortSet{}
+	alice := createLocalUser(t, "alice", "alice123", RoleUser)
+	if _, err := model.SetScore(alice.ID, 25, 0, ""); err != nil {
+		t.Fatal(err)
+	}
+	env := &model.VulEnv{EnvName: "web", EnvType: "单镜像", BaseImage: "img", Cost: 10}
+	model.CreateVulEnv(env)
+
+	// 容器已启动后写入实例记录失败
+	model.DB.Callback().Update().Before("gorm:update").Register("test:fail_instance", func(db *gorm.DB) {
+		if db.Statement.Table == "vul_instances" {
+			db.AddError(errors.New("写入失败"))
+		}
+	})
+	if _, err := (&VulService{}).CreateVulInstance(alice.ID, 0, env.ID); err == nil {
+		t.Fatal("写入实例记录失败时应创建失败")
+	}
+	if len(docker.containers) != 0 || len(docker.removed) != 1 {
+		t.Errorf("应删除已启动的容器: 剩余 %d 个，删除 %v", len(docker.containers), docker.removed)
+	}
+	if got, _ := model.GetUserByID(alice.ID); got.Score != 25 {
+		t.Errorf("创建失败后积分 = %v，应退还开销", got.Score)
+	}
+	if _, err := model.GetVulInstanceBy2ID(alice.ID, env.ID); err == nil {
+		t.Error("应删除创建中的实例记录")
+	}
+}
+
+func TestConcurrentLaunchChargesOnce(t *testing.T) {
+	useTestDB(t)
+	docker := useFakeDocker(t)
+	docker.images["img"] = nat.PortSet{}
+	alice := createLocalUser(t, "alice", "alice123", RoleUser)
+	if _, err := model.SetScore(alice.ID, 25, 0, ""); err != nil {
+		t.Fatal(err)
+	}
+	env := &model.VulEnv{EnvName: "web", EnvType: "单镜像", BaseImage: "img", Cost: 10}
+	model.CreateVulEnv(env)
+
+	// 同时开启同一环境，只有一个请求扣费并启动容器
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	succeeded := 0
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := (&VulService{}).CreateVulInstance(alice.ID, 0, env.ID); err == nil {
+				mu.Lock()
+				succeeded++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if got, _ := model.GetUserByID(alice.ID); succeeded != 1 || got.Score != 15 || len(docker.containers) != 1 {
+		t.Errorf("并发开启成功 %d 次，剩余积分 %v，容器 %d 个", succeeded, got.Score, len(docker.containers))
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	if got := truncate("创建实例失败", 4); got != "创" {
+		t.Errorf("truncate = %q，不应截断多字节字符", got)
+	}
+	if got := truncate("abc", 5); got != "abc" {
+		t.Errorf("truncate = %q", got)
+	}
+}
@@ -0,0 +1,299 @@
+package service
+
+import (
+	"AscensionPath/config"
+	"AscensionPath/internal/model"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	defaultSeriesTop = 10  // 默认返回前10名的积分曲线
+	maxSeriesUsers   = 50  // 一次最多返回的积分曲线数
+	defaultSolves    = 50  // 默认返回最近50条解出记录
+	maxSolves        = 500 // 一次最多返回的解出记录数
+	maxCachedBoards  = 256 // 缓存的排行榜数量上限，超过时清空
+)
+
+var ErrInvalidTimeRange = errors.New("开始时间必须早于结束时间")
+
+// ScoreboardQuery 排行榜的筛选条件，零值表示不限制
+type ScoreboardQuery struct {
+	TeamID   uint      // 只统计团队成员
+	CourseID uint      // 只统计课程的学生
+	From     time.Time // 只统计From之后的解出
+	To       time.Time // 只统计To之前的解出
+}
+
+func (q ScoreboardQuery) key() string {
+	var from, to int64
+	if !q.From.IsZero() {
+		from = q.From.UnixNano()
+	}
+	if !q.To.IsZero() {
+		to = q.To.UnixNano()
+	}
+	return fmt.Sprintf("%d/%d/%d/%d", q.TeamID, q.CourseID, from, to)
+}
+
+// ScoreboardEntry 排行榜中的一名用户，积分相同时先达到该积分的用户排名靠前
+type ScoreboardEntry struct {
+	Rank      int       `json:"rank"`
+	UserID    uint      `json:"user_id"`
+	Username  string    `json:"username"`
+	Score     float64   `json:"score"`
+	Solves    int       `json:"solves"`
+	LastSolve time.Time `json:"last_solve"` // 最后一次解出的时间，用于同分排序
+}
+
+// ScoreboardDTO 排行榜
+type ScoreboardDTO struct {
+	Entries     []ScoreboardEntry `json:"entries"`
+	Total       int               `json:"total"` // 上榜的用户数
+	GeneratedAt time.Time         `json:"generated_at"`
+}
+
+// ScorePoint 积分曲线上的一个点，每次解出后的累计积分
+type ScorePoint struct {
+	Time  time.Time `json:"time"`
+	Score float64   `json:"score"`
+}
+
+// ScoreSeries 用户的积分曲线
+type ScoreSeries struct {
+	UserID   uint         `json:"user_id"`
+	Username string       `json:"username"`
+	Points   []ScorePoint `json:"points"`
+}
+
+// SolveEvent 一次解出
+type SolveEvent struct {
+	UserID   uint      `json:"user_id"`
+	Username string    `json:"username"`
+	VulEnvID uint      `json:"vul_env_id"`
+	EnvName  string    `json:"env_name"`
+	TeamID   uint      `json:"team_id"`
+	Score    float64   `json:"score"`
+	SolvedAt time.Time `json:"solved_at"`
+}
+
+// scoreboard 按一组筛选条件计算出的排行榜
+type scoreboard struct {
+	entries []ScoreboardEntry
+	series  map[uint][]ScorePoint
+	events  []SolveEvent // 按解出时间排序
+	builtAt time.Time
+}
+
+// ScoreboardCache 排行榜缓存，按筛选条件缓存计算结果，超过scoreboard.cache_ttl或有新的解出时重新计算
+type ScoreboardCache struct {
+	mu     sync.Mutex
+	boards map[string]*scoreboard
+}
+
+// Scoreboards 全局排行榜缓存
+var Scoreboards = &ScoreboardCache{}
+
+// get 获取排行榜，构建期间持锁，避免缓存失效时大量请求同时查库
+func (c *ScoreboardCache) get(q ScoreboardQuery) (*scoreboard, error) {
+	ttl := config.Current().Scoreboard.CacheTTL.Std()
+	key := q.key()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if board, ok := c.boards[key]; ok && time.Since(board.builtAt) < ttl {
+		return board, nil
+	}
+	board, err := buildScoreboard(q)
+	if err != nil {
+		return nil, err
+	}
+	if ttl > 0 {
+		if c.boards == nil || len(c.boards) >= maxCachedBoards {
+			c.boards = make(map[string]*scoreboard)
+		}
+		c.boards[key] = board
+	}
+	return board, nil
+}
+
+// Invalidate 清空缓存，有新的解出或用户被删除时调用
+func (c *ScoreboardCache) Invalidate() {
+	c.mu.Lock()
+	c.boards = nil
+	c.mu.Unlock()
+}
+
+// buildScoreboard 从解出记录计算排行榜、积分曲线和解出时间线
+func buildScoreboard(q ScoreboardQuery) (*scoreboard, error) {
+	solves, err := model.GetSolves(model.SolveFilter{TeamID: q.TeamID, CourseID: q.CourseID, From: q.From, To: q.To})
+	if err != nil {
+		return nil, fmt.Errorf("获取解出记录失败: %v", err)
+	}
+	userIDs := make([]uint, 0)
+	seen := make(map[uint]bool)
+	for _, solve := range solves {
+		if !seen[solve.UserID] {
+			seen[solve.UserID] = true
+			userIDs = append(userIDs, solve.UserID)
+		}
+	}
+	usernames, err := model.GetUsernames(userIDs)
+	if err != nil {
+		return nil, fmt.Errorf("获取用户失败: %v", err)
+	}
+	envNames, err := vulEnvNames()
+	if err != nil {
+		return nil, fmt.Errorf("获取漏洞环境失败: %v", err)
+	}
+
+	board := &scoreboard{series: make(map[uint][]ScorePoint), builtAt: time.Now()}
+	byUser := make(map[uint]*ScoreboardEntry)
+	for _, solve := range solves {
+		username, ok := usernames[solve.UserID]
+		if !ok {
+			continue
+		}
+		entry := byUser[solve.UserID]
+		if entry == nil {
+			entry = &ScoreboardEntry{UserID: solve.UserID, Username: username}
+			byUser[solve.UserID] = entry
+		}
+		entry.Score += solve.Score
+		entry.Solves++
+		entry.LastSolve = solve.SolvedAt
+		board.series[solve.UserID] = append(board.series[solve.UserID], ScorePoint{Time: solve.SolvedAt, Score: entry.Score})
+		board.events = append(board.events, SolveEvent{
+			UserID:   solve.UserID,
+			Username: username,
+			VulEnvID: solve.VulEnvID,
+			EnvName:  envNames[solve.VulEnvID],
+			TeamID:   solve.TeamID,
+			Score:    solve.Score,
+			SolvedAt: solve.SolvedAt,
+		})
+	}
+
+	for _, entry := range byUser {
+		board.entries = append(board.entries, *entry)
+	}
+	sort.Slice(board.entries, func(i, j int) bool {
+		a, b := board.entries[i], board.entries[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		if !a.LastSolve.Equal(b.LastSolve) {
+			return a.LastSolve.Before(b.LastSolve)
+		}
+		return a.UserID < b.UserID
+	})
+	for i := range board.entries {
+		board.entries[i].Rank = i + 1
+	}
+	return board, nil
+}
+
+// checkScoreboardQuery 校验筛选条件，课程排行榜只对课程学生和课程管理员开放，团队排行榜只对队员和团队管理员开放
+func (u *UserService) checkScoreboardQuery(q ScoreboardQuery) error {
+	if !q.From.IsZero() && !q.To.IsZero() && !q.From.Before(q.To) {
+		return ErrInvalidTimeRange
+	}
+	if q.CourseID != 0 && !u.Can(PermCourseManage) && !model.IsCourseStudent(q.CourseID, u.ID) {
+		return ErrNotEnrolled
+	}
+	if q.TeamID != 0 && !u.Can(PermTeamManage) && !u.IsTeamMember(q.TeamID) {
+		return ErrNotTeamMember
+	}
+	return nil
+}
+
+// GetScoreboard 获取排行榜，limit为0时返回所有用户
+func (u *UserService) GetScoreboard(q ScoreboardQuery, limit int) (*ScoreboardDTO, error) {
+	if err := u.checkScoreboardQuery(q); err != nil {
+		return nil, err
+	}
+	board, err := Scoreboards.get(q)
+	if err != nil {
+		return nil, err
+	}
+	entries := board.entries
+	if limit > 0 && limit < len(entries) {
+		entries = entries[:limit]
+	}
+	return &ScoreboardDTO{
+		Entries:     append([]ScoreboardEntry{}, entries...),
+		Total:       len(board.entries),
+		GeneratedAt: board.builtAt,
+	}, nil
+}
+
+// GetScoreSeries 获取积分曲线，userIDs为空时返回排行榜前top名
+func (u *UserService) GetScoreSeries(q ScoreboardQuery, userIDs []uint, top int) ([]ScoreSeries, error) {
+	if err := u.checkScoreboardQuery(q); err != nil {
+		return nil, err
+	}
+	board, err := Scoreboards.get(q)
+	if err != nil {
+		return nil, err
+	}
+	usernames := make(map[uint]string, len(board.entries))
+	for _, entry := range board.entries {
+		usernames[entry.UserID] = entry.Username
+	}
+	if len(userIDs) == 0 {
+		if top <= 0 {
+			top = defaultSeriesTop
+		}
+		for _, entry := range board.entries {
+			if len(userIDs) == top {
+				break
+			}
+			userIDs = append(userIDs, entry.UserID)
+		}
+	}
+	if len(userIDs) > maxSeriesUsers {
+		userIDs = userIDs[:maxSeriesUsers]
+	}
+
+	result := make([]ScoreSeries, 0, len(userIDs))
+	for _, id := range userIDs {
+		username, ok := usernames[id]
+		if !ok {
+			continue // 筛选范围内没有解出
+		}
+		result = append(result, ScoreSeries{
+			UserID:   id,
+			Username: username,
+			Points:   append([]ScorePoint{}, board.series[id]...),
+		})
+	}
+	return result, nil
+}
+
+// GetSolveTimeline 获取最近的解出记录，按时间倒序，userID不为0时只返回该用户的记录
+func (u *UserService) GetSolveTimeline(q ScoreboardQuery, userID uint, limit int) ([]SolveEvent, error) {
+	if err := u.checkScoreboardQuery(q); err != nil {
+		return nil, err
+	}
+	board, err := Scoreboards.get(q)
+	if err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		limit = defaultSolves
+	}
+	if limit > maxSolves {
+		limit = maxSolves
+	}
+	result := make([]SolveEvent, 0)
+	for i := len(board.events) - 1; i >= 0 && len(result) < limit; i-- {
+		if userID != 0 && board.events[i].UserID != userID {
+			continue
+		}
+		result = append(result, board.events[i])
+	}
+	return result, nil
+}
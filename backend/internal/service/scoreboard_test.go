@@ -0,0 +1,127 @@
+package service
+
+import (
+	"AscensionPath/internal/model"
+	"testing"
+	"time"
+)
+
+func TestScoreboard(t *testing.T) {
+	conf := useTestDB(t)
+	var users []*UserService
+	for _, name := range []string{"alice", "bob", "carol", "dave"} {
+		user := &model.User{Username: name, Password: "x", Email: name + "@example.com", Status: 1, Role: RoleUser}
+		if err := model.CreateUser(user); err != nil {
+			t.Fatal(err)
+		}
+		users = append(users, &UserService{UserDTO: UserDTO{ID: user.ID, Username: name, Role: RoleUser}})
+	}
+	alice, bob, carol, dave := users[0], users[1], users[2], users[3]
+	admin := &UserService{UserDTO: UserDTO{ID: 100, Username: "admin", Role: RoleAdmin}}
+	web := &model.VulEnv{EnvName: "sqli", EnvType: "单镜像", BaseImage: "sqli", Reward: 10}
+	pwn := &model.VulEnv{EnvName: "pwn", EnvType: "单镜像", BaseImage: "pwn", Reward: 20}
+	model.CreateVulEnv(web)
+	model.CreateVulEnv(pwn)
+	team := &model.Team{Name: "red", CreatedBy: alice.ID}
+	model.CreateTeam(team)
+	model.SetTeamMember(team.ID, alice.ID, model.TeamRoleCaptain)
+	model.SetTeamMember(team.ID, bob.ID, model.TeamRoleMember)
+	course := &model.Course{Name: "Web安全", InstructorID: 100}
+	model.CreateCourse(course)
+	model.EnrollStudent(course.ID, carol.ID)
+
+	// bob和carol同分，carol先达到该分数
+	base := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	for i, solve := range []model.Solve{
+		{UserID: alice.ID, VulEnvID: web.ID, Score: 10},
+		{UserID: carol.ID, VulEnvID: pwn.ID, Score: 20},
+		{UserID: bob.ID, VulEnvID: web.ID, Score: 10},
+		{UserID: bob.ID, VulEnvID: pwn.ID, Score: 10},
+		{UserID: alice.ID, VulEnvID: pwn.ID, Score: 20},
+	} {
+		solve.SolvedAt = base.Add(time.Duration(i) * time.Hour)
+		if err := model.CreateSolve(&solve); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	board, err := dave.GetScoreboard(ScoreboardQuery{}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var order []string
+	for _, entry := range board.Entries {
+		order = append(order, entry.Username)
+	}
+	if len(order) != 3 || order[0] != "alice" || order[1] != "carol" || order[2] != "bob" || board.Total != 3 {
+		t.Fatalf("排行榜顺序 = %v", order)
+	}
+	if e := board.Entries[0]; e.Rank != 1 || e.Score != 30 || e.Solves != 2 || !e.LastSolve.Equal(base.Add(4*time.Hour)) {
+		t.Errorf("第一名 = %+v", e)
+	}
+	if board, _ := dave.GetScoreboard(ScoreboardQuery{}, 1); len(board.Entries) != 1 || board.Total != 3 {
+		t.Errorf("limit应限制名次数: %+v", board)
+	}
+
+	// 按时间段筛选
+	board, _ = dave.GetScoreboard(ScoreboardQuery{From: base.Add(time.Hour), To: base.Add(3 * time.Hour)}, 0)
+	if len(board.Entries) != 2 || board.Entries[0].Username != "carol" || board.Entries[1].Score != 10 {
+		t.Errorf("按时间段筛选 = %+v", board.Entries)
+	}
+	if _, err := dave.GetScoreboard(ScoreboardQuery{From: base, To: base}, 0); err != ErrInvalidTimeRange {
+		t.Errorf("开始时间不早于结束时间应失败: %v", err)
+	}
+
+	// 团队和课程排行榜只对成员和管理员开放
+	if _, err := dave.GetScoreboard(ScoreboardQuery{TeamID: team.ID}, 0); err != ErrNotTeamMember {
+		t.Errorf("非队员查看团队排行榜应失败: %v", err)
+	}
+	if _, err := dave.GetScoreboard(ScoreboardQuery{CourseID: course.ID}, 0); err != ErrNotEnrolled {
+		t.Errorf("非学生查看课程排行榜应失败: %v", err)
+	}
+	board, err = bob.GetScoreboard(ScoreboardQuery{TeamID: team.ID}, 0)
+	if err != nil || len(board.Entries) != 2 || board.Entries[1].Username != "bob" {
+		t.Errorf("团队排行榜 = %+v, %v", board, err)
+	}
+	board, err = admin.GetScoreboard(ScoreboardQuery{CourseID: course.ID}, 0)
+	if err != nil || len(board.Entries) != 1 || board.Entries[0].Username != "carol" {
+		t.Errorf("课程排行榜 = %+v, %v", board, err)
+	}
+
+	// 积分曲线
+	series, err := dave.GetScoreSeries(ScoreboardQuery{}, nil, 2)
+	if err != nil || len(series) != 2 || series[0].Username != "alice" {
+		t.Fatalf("积分曲线 = %+v, %v", series, err)
+	}
+	if points := series[0].Points; len(points) != 2 || points[0].Score != 10 || points[1].Score != 30 {
+		t.Errorf("alice的积分曲线 = %+v", points)
+	}
+	series, _ = dave.GetScoreSeries(ScoreboardQuery{}, []uint{bob.ID, dave.ID}, 0)
+	if len(series) != 1 || series[0].UserID != bob.ID {
+		t.Errorf("指定用户的积分曲线 = %+v", series)
+	}
+
+	// 解出时间线按时间倒序
+	events, err := dave.GetSolveTimeline(ScoreboardQuery{}, 0, 2)
+	if err != nil || len(events) != 2 || events[0].Username != "alice" || events[0].EnvName != "pwn" || events[1].Username != "bob" {
+		t.Errorf("解出时间线 = %+v, %v", events, err)
+	}
+	if events, _ := dave.GetSolveTimeline(ScoreboardQuery{}, carol.ID, 0); len(events) != 1 || events[0].Score != 20 {
+		t.Errorf("单个用户的解出记录 = %+v", events)
+	}
+
+	// 缓存在有效期内复用，新的解出使缓存失效
+	model.CreateSolve(&model.Solve{UserID: dave.ID, VulEnvID: web.ID, Score: 50, SolvedAt: base.Add(5 * time.Hour)})
+	if board, _ := dave.GetScoreboard(ScoreboardQuery{}, 0); board.Total != 3 {
+		t.Errorf("缓存有效期内应返回缓存: %d", board.Total)
+	}
+	Scoreboards.Invalidate()
+	if board, _ := dave.GetScoreboard(ScoreboardQuery{}, 0); board.Total != 4 || board.Entries[0].Username != "dave" {
+		t.Errorf("缓存失效后应重新计算: %+v", board)
+	}
+	conf.Scoreboard.CacheTTL = 0
+	model.CreateSolve(&model.Solve{UserID: carol.ID, VulEnvID: web.ID, Score: 10, SolvedAt: base.Add(6 * time.Hour)})
+	if board, _ := dave.GetScoreboard(ScoreboardQuery{}, 0); board.Entries[2].Username != "carol" || board.Entries[2].Score != 30 {
+		t.Errorf("不缓存时应立即反映解出，同分时先达到的alice在前: %+v", board.Entries)
+	}
+}
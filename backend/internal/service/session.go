@@ -0,0 +1,242 @@
+package service
+
+import (
+	"AscensionPath/config"
+	"AscensionPath/internal/middleware"
+	"AscensionPath/internal/model"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrSessionRevoked      = errors.New("会话已失效，请重新登录")
+	ErrInvalidRefreshToken = errors.New("无效的刷新令牌")
+)
+
+// 会话最后活动时间的更新间隔，避免每次请求都写数据库
+const sessionTouchInterval = time.Minute
+
+// 已过期或注销的会话保留时长，之后由后台任务删除
+const sessionRetention = 7 * 24 * time.Hour
+
+// SessionTokens 登录或刷新后下发给客户端的会话信息
+type SessionTokens struct {
+	SessionID        string
+	RefreshToken     string
+	RefreshExpiresAt time.Time
+}
+
+// SessionDTO 用户可见的会话信息
+type SessionDTO struct {
+	ID         uint      `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"` // 是否为当前请求使用的会话
+}
+
+// CreateSession 登录成功后创建会话
+func CreateSession(userID uint, ip, userAgent string) (*SessionTokens, error) {
+	refreshToken, hash, err := newRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	session := &model.Session{
+		SessionID:        uuid.New().String(),
+		UserID:           userID,
+		RefreshTokenHash: hash,
+		UserAgent:        truncate(userAgent, 255),
+		IP:               ip,
+		LastSeenAt:       now,
+		ExpiresAt:        now.Add(config.Current().Session.RefreshTTL.Std()),
+	}
+	if err := model.CreateSession(session); err != nil {
+		return nil, fmt.Errorf("创建会话失败: %v", err)
+	}
+	return &SessionTokens{
+		SessionID:        session.SessionID,
+		RefreshToken:     refreshToken,
+		RefreshExpiresAt: session.ExpiresAt,
+	}, nil
+}
+
+// RefreshSession 使用刷新令牌换取新的刷新令牌，旧令牌立即失效；
+// 已轮换的旧令牌被再次使用时视为泄露，注销整个会话
+func RefreshSession(refreshToken, ip, userAgent string) (*SessionTokens, *model.User, error) {
+	hash := hashToken(refreshToken)
+	session, err := model.GetSessionByRefreshHash(hash)
+	if err != nil {
+		if reused, err := model.GetSessionByRotatedRefreshHash(hash); err == nil && reused.RevokedAt == nil {
+			model.RevokeSession(reused.ID)
+			middleware.SugarLogger.Warnw("刷新令牌被重复使用，已注销会话",
+				"userID", reused.UserID, "sessionID", reused.SessionID, "ip", ip)
+		}
+		return nil, nil, ErrInvalidRefreshToken
+	}
+	if !session.Active() {
+		return nil, nil, ErrSessionRevoked
+	}
+
+	user, err := model.GetUserByID(session.UserID)
+	if err != nil || user.Status == 0 {
+		model.RevokeSession(session.ID)
+		return nil, nil, errors.New("用户不存在或已被禁用")
+	}
+
+	newToken, newHash, err := newRefreshToken()
+	if err != nil {
+		return nil, nil, err
+	}
+	expiresAt := time.Now().Add(config.Current().Session.RefreshTTL.Std())
+	ok, err := model.RotateRefreshToken(session.ID, hash, newHash, expiresAt, ip, truncate(userAgent, 255))
+	if err != nil {
+		return nil, nil, fmt.Errorf("刷新会话失败: %v", err)
+	}
+	if !ok {
+		// 同一令牌的并发刷新只有一个成功
+		return nil, nil, ErrInvalidRefreshToken
+	}
+	return &SessionTokens{
+		SessionID:        session.SessionID,
+		RefreshToken:     newToken,
+		RefreshExpiresAt: expiresAt,
+	}, user, nil
+}
+
+// ValidateSession 校验访问令牌关联的会话仍然有效，并按间隔更新最后活动时间
+func ValidateSession(sessionID string, userID uint, ip string) error {
+	if sessionID == "" {
+		return ErrSessionRevoked
+	}
+	session, err := model.GetSessionBySessionID(sessionID)
+	if err != nil || session.UserID != userID || !session.Active() {
+		return ErrSessionRevoked
+	}
+	if time.Since(session.LastSeenAt) > sessionTouchInterval {
+		if err := model.TouchSession(session.ID, ip); err != nil {
+			middleware.SugarLogger.Warnf("更新会话活动时间失败: %v", err)
+		}
+	}
+	return nil
+}
+
+// Logout 注销当前会话
+func (s *UserService) Logout() error {
+	session, err := model.GetSessionBySessionID(s.SessionID)
+	if err != nil {
+		return ErrSessionRevoked
+	}
+	if err := model.RevokeSession(session.ID); err != nil {
+		return err
+	}
+	middleware.SugarLogger.Infow("用户注销会话", "userID", s.ID, "sessionID", s.SessionID)
+	return nil
+}
+
+// LogoutAll 注销当前用户的所有会话(包括当前会话)
+func (s *UserService) LogoutAll() (int64, error) {
+	count, err := model.RevokeUserSessions(s.ID, "")
+	if err != nil {
+		return 0, err
+	}
+	middleware.SugarLogger.Infow("用户注销所有会话", "userID", s.ID, "count", count)
+	return count, nil
+}
+
+// ListSessions 获取当前用户的有效会话
+func (s *UserService) ListSessions() ([]SessionDTO, error) {
+	sessions, err := model.GetActiveSessionsByUserID(s.ID)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]SessionDTO, 0, len(sessions))
+	for _, session := range sessions {
+		result = append(result, SessionDTO{
+			ID:         session.ID,
+			UserAgent:  session.UserAgent,
+			IP:         session.IP,
+			CreatedAt:  session.CreatedAt,
+			LastSeenAt: session.LastSeenAt,
+			ExpiresAt:  session.ExpiresAt,
+			Current:    session.SessionID == s.SessionID,
+		})
+	}
+	return result, nil
+}
+
+// RevokeSession 注销指定会话，只能注销自己的会话
+func (s *UserService) RevokeSession(id uint) error {
+	sessions, err := model.GetActiveSessionsByUserID(s.ID)
+	if err != nil {
+		return err
+	}
+	for _, session := range sessions {
+		if session.ID == id {
+			middleware.SugarLogger.Infow("用户注销会话", "userID", s.ID, "sessionID", session.SessionID)
+			return model.RevokeSession(id)
+		}
+	}
+	return errors.New("会话不存在")
+}
+
+// revokeSessionsOf 注销用户的会话，操作人修改自己时保留当前会话
+func (s *UserService) revokeSessionsOf(userID uint) {
+	except := ""
+	if s.ID == userID {
+		except = s.SessionID
+	}
+	count, err := model.RevokeUserSessions(userID, except)
+	if err != nil {
+		middleware.SugarLogger.Errorw("注销用户会话失败", "targetUserID", userID, "error", err.Error())
+		return
+	}
+	if count > 0 {
+		middleware.SugarLogger.Infow("已注销用户会话", "operatorID", s.ID, "targetUserID", userID, "count", count)
+	}
+}
+
+// StartSessionCleanup 定时删除过期或注销超过保留时长的会话，ctx取消后停止
+func StartSessionCleanup(ctx context.Context) {
+	runPeriodic(ctx, "session-cleanup", time.Hour, func() error {
+		_, err := model.DeleteSessionsBefore(time.Now().Add(-sessionRetention))
+		return err
+	})
+}
+
+// newRefreshToken 生成随机刷新令牌及其哈希
+func newRefreshToken() (string, string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", fmt.Errorf("生成刷新令牌失败: %v", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+	return token, hashToken(token), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// truncate 截断到最多n个字节，不会截断多字节字符
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
@@ -0,0 +1,185 @@
+package service
+
+import (
+	"AscensionPath/internal/model"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRefreshSession(t *testing.T) {
+	useTestDB(t)
+	alice := createLocalUser(t, "alice", "alice123", RoleUser)
+
+	tokens, err := CreateSession(alice.ID, "10.0.0.1", "curl")
+	if err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	if err := ValidateSession(tokens.SessionID, alice.ID, "10.0.0.1"); err != nil {
+		t.Fatalf("新会话应有效: %v", err)
+	}
+	if err := ValidateSession(tokens.SessionID, alice.ID+1, "10.0.0.1"); err != ErrSessionRevoked {
+		t.Errorf("会话不属于该用户时应无效: %v", err)
+	}
+
+	// 刷新后下发新令牌，会话ID不变，旧令牌失效
+	next, user, err := RefreshSession(tokens.RefreshToken, "10.0.0.2", "firefox")
+	if err != nil || user.ID != alice.ID {
+		t.Fatalf("RefreshSession = %v, %v", user, err)
+	}
+	if next.SessionID != tokens.SessionID || next.RefreshToken == tokens.RefreshToken || !next.RefreshExpiresAt.After(time.Now()) {
+		t.Fatalf("刷新后的会话信息: %+v", next)
+	}
+	if _, _, err := RefreshSession("not-a-token", "", ""); err != ErrInvalidRefreshToken {
+		t.Errorf("未知令牌应无效: %v", err)
+	}
+	if err := ValidateSession(tokens.SessionID, alice.ID, "10.0.0.2"); err != nil {
+		t.Fatalf("伪造的令牌不应影响会话: %v", err)
+	}
+	session, _ := model.GetSessionBySessionID(tokens.SessionID)
+	if session.IP != "10.0.0.2" || session.UserAgent != "firefox" {
+		t.Errorf("刷新时应更新IP和UA: %+v", session)
+	}
+
+	// 同一令牌并发刷新只有一个成功
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var succeeded []*SessionTokens
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if result, _, err := RefreshSession(next.RefreshToken, "10.0.0.2", "firefox"); err == nil {
+				mu.Lock()
+				succeeded = append(succeeded, result)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if len(succeeded) != 1 {
+		t.Fatalf("并发刷新成功 %d 次", len(succeeded))
+	}
+}
+
+func TestRefreshTokenReplay(t *testing.T) {
+	useTestDB(t)
+	alice := createLocalUser(t, "alice", "alice123", RoleUser)
+
+	// 任一已轮换的令牌被再次使用都注销整个会话，包括轮换多次之前的令牌
+	for _, replayIndex := range []int{0, 1} {
+		t0, err := CreateSession(alice.ID, "10.0.0.1", "curl")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t1, _, err := RefreshSession(t0.RefreshToken, "10.0.0.1", "curl")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t2, _, err := RefreshSession(t1.RefreshToken, "10.0.0.1", "curl")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		stolen := []*SessionTokens{t0, t1}[replayIndex]
+		if _, _, err := RefreshSession(stolen.RefreshToken, "10.6.6.6", "attacker"); err != ErrInvalidRefreshToken {
+			t.Fatalf("重放第%d个令牌应失败: %v", replayIndex, err)
+		}
+		if _, _, err := RefreshSession(t2.RefreshToken, "10.0.0.1", "curl"); err != ErrSessionRevoked {
+			t.Errorf("重放第%d个令牌后当前令牌应失效: %v", replayIndex, err)
+		}
+		if err := ValidateSession(t2.SessionID, alice.ID, "10.0.0.1"); err != ErrSessionRevoked {
+			t.Errorf("重放第%d个令牌后访问令牌关联的会话应失效: %v", replayIndex, err)
+		}
+	}
+
+	// 其他会话不受影响
+	other, _ := CreateSession(alice.ID, "10.0.0.3", "chrome")
+	if _, _, err := RefreshSession(other.RefreshToken, "10.0.0.3", "chrome"); err != nil {
+		t.Errorf("其他会话应不受影响: %v", err)
+	}
+}
+
+func TestSessionExpiry(t *testing.T) {
+	useTestDB(t)
+	alice := createLocalUser(t, "alice", "alice123", RoleUser)
+
+	tokens, _ := CreateSession(alice.ID, "10.0.0.1", "curl")
+	session, _ := model.GetSessionBySessionID(tokens.SessionID)
+	model.DB.Model(session).Update("expires_at", time.Now().Add(-time.Second))
+	if _, _, err := RefreshSession(tokens.RefreshToken, "10.0.0.1", "curl"); err != ErrSessionRevoked {
+		t.Errorf("过期的刷新令牌应无效: %v", err)
+	}
+	if err := ValidateSession(tokens.SessionID, alice.ID, "10.0.0.1"); err != ErrSessionRevoked {
+		t.Errorf("过期的会话应无效: %v", err)
+	}
+
+	// 用户被禁用后刷新失败并注销会话
+	tokens, _ = CreateSession(alice.ID, "10.0.0.1", "curl")
+	model.DB.Model(&model.User{}).Where("id = ?", alice.ID).Update("status", 0)
+	if _, _, err := RefreshSession(tokens.RefreshToken, "10.0.0.1", "curl"); err == nil {
+		t.Error("被禁用的用户不应能刷新会话")
+	}
+	if err := ValidateSession(tokens.SessionID, alice.ID, "10.0.0.1"); err != ErrSessionRevoked {
+		t.Errorf("被禁用用户的会话应注销: %v", err)
+	}
+}
+
+func TestLogout(t *testing.T) {
+	useTestDB(t)
+	alice := createLocalUser(t, "alice", "alice123", RoleUser)
+	bob := createLocalUser(t, "bob", "bob123", RoleUser)
+
+	first, _ := CreateSession(alice.ID, "10.0.0.1", "curl")
+	second, _ := CreateSession(alice.ID, "10.0.0.2", "firefox")
+	third, _ := CreateSession(alice.ID, "10.0.0.3", "chrome")
+	bobs, _ := CreateSession(bob.ID, "10.0.0.4", "safari")
+	user := &UserService{UserDTO: UserDTO{ID: alice.ID, Username: "alice", Role: RoleUser}, SessionID: first.SessionID}
+
+	sessions, err := user.ListSessions()
+	if err != nil || len(sessions) != 3 {
+		t.Fatalf("ListSessions = %+v, %v", sessions, err)
+	}
+	current := 0
+	for _, s := range sessions {
+		if s.Current {
+			current++
+		}
+	}
+	if current != 1 {
+		t.Errorf("应只有一个当前会话，实际 %d 个", current)
+	}
+
+	// 注销当前会话后访问令牌和刷新令牌都失效
+	if err := user.Logout(); err != nil {
+		t.Fatalf("Logout: %v", err)
+	}
+	if err := ValidateSession(first.SessionID, alice.ID, ""); err != ErrSessionRevoked {
+		t.Errorf("注销后会话应无效: %v", err)
+	}
+	if _, _, err := RefreshSession(first.RefreshToken, "", ""); err != ErrSessionRevoked {
+		t.Errorf("注销后刷新令牌应无效: %v", err)
+	}
+
+	// 只能注销自己的会话
+	bobSession, _ := model.GetSessionBySessionID(bobs.SessionID)
+	if err := user.RevokeSession(bobSession.ID); err == nil {
+		t.Error("不应能注销其他用户的会话")
+	}
+	secondSession, _ := model.GetSessionBySessionID(second.SessionID)
+	if err := user.RevokeSession(secondSession.ID); err != nil {
+		t.Fatalf("RevokeSession: %v", err)
+	}
+
+	if count, err := user.LogoutAll(); err != nil || count != 1 {
+		t.Fatalf("LogoutAll = %d, %v", count, err)
+	}
+	for _, tokens := range []*SessionTokens{second, third} {
+		if err := ValidateSession(tokens.SessionID, alice.ID, ""); err != ErrSessionRevoked {
+			t.Errorf("注销所有会话后会话 %s 仍有效", tokens.SessionID)
+		}
+	}
+	if err := ValidateSession(bobs.SessionID, bob.ID, ""); err != nil {
+		t.Errorf("其他用户的会话不应受影响: %v", err)
+	}
+}
@@ -0,0 +1,164 @@
+package service
+
+import (
+	"AscensionPath/config"
+	"AscensionPath/internal/middleware"
+	"AscensionPath/internal/model"
+	"AscensionPath/internal/utils"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 串行化配置修改，保证修改记录中的旧值准确
+var settingsMu sync.Mutex
+
+// SettingDTO 运行时配置项及最后修改信息
+type SettingDTO struct {
+	config.RuntimeSetting
+	Overridden bool       `json:"overridden"`           // 是否已被管理员修改(保存在数据库中)
+	UpdatedBy  string     `json:"updated_by,omitempty"` // 最后修改人
+	UpdatedAt  *time.Time `json:"updated_at,omitempty"` // 最后修改时间
+}
+
+// SettingAuditDTO 配置修改记录
+type SettingAuditDTO struct {
+	ID         uint      `json:"id"`
+	Key        string    `json:"key"`
+	OldValue   string    `json:"old_value"`
+	NewValue   string    `json:"new_value"`
+	OperatorID uint      `json:"operator_id"`
+	Operator   string    `json:"operator"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// LoadSettings 启动时加载数据库中保存的运行时配置，覆盖配置文件中的值
+func LoadSettings() error {
+	settings, err := model.GetAllSettings()
+	if err != nil {
+		return fmt.Errorf("加载运行时配置失败: %v", err)
+	}
+	for _, s := range settings {
+		if !config.IsRuntimeKey(s.Key) {
+			middleware.SugarLogger.Warnf("忽略不支持运行时修改的配置项: %s", s.Key)
+			continue
+		}
+		// 单项无效时保留配置文件中的值，不影响其他配置项
+		if err := config.SetRuntime(map[string]string{s.Key: s.Value}); err != nil {
+			middleware.SugarLogger.Errorf("数据库中的配置 %s=%q 无效，已忽略: %v", s.Key, s.Value, err)
+		}
+	}
+	return nil
+}
+
+// GetSettings 获取所有运行时配置项的当前值
+func GetSettings() ([]SettingDTO, error) {
+	saved, err := model.GetAllSettings()
+	if err != nil {
+		return nil, err
+	}
+	byKey := make(map[string]model.Setting, len(saved))
+	for _, s := range saved {
+		byKey[s.Key] = s
+	}
+
+	var result []SettingDTO
+	for _, rs := range config.RuntimeSettings() {
+		dto := SettingDTO{RuntimeSetting: rs}
+		if s, ok := byKey[rs.Key]; ok {
+			updatedAt := s.UpdatedAt
+			dto.Overridden = true
+			dto.UpdatedBy = s.UpdatedBy
+			dto.UpdatedAt = &updatedAt
+		}
+		result = append(result, dto)
+	}
+	return result, nil
+}
+
+// UpdateSettings 校验并保存运行时配置，保存成功后立即生效，每项修改记录操作人和新旧值
+func (s *UserService) UpdateSettings(values map[string]string) ([]SettingDTO, error) {
+	if !s.Can(PermSystemManage) {
+		return nil, errors.New("权限不足")
+	}
+	if len(values) == 0 {
+		return nil, fmt.Errorf("%w: 没有需要修改的配置项", utils.ErrInvalidSetting)
+	}
+
+	settingsMu.Lock()
+	defer settingsMu.Unlock()
+
+	if err := config.CheckRuntime(values); err != nil {
+		return nil, fmt.Errorf("%w: %v", utils.ErrInvalidSetting, err)
+	}
+	if path, ok := values["storage.image_path"]; ok {
+		if err := os.MkdirAll(path, 0755); err != nil {
+			return nil, fmt.Errorf("%w: 无法创建镜像存储目录: %v", utils.ErrInvalidSetting, err)
+		}
+	}
+
+	current := map[string]string{}
+	for _, rs := range config.RuntimeSettings() {
+		current[rs.Key] = rs.Value
+	}
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var settings []model.Setting
+	var audits []model.SettingAudit
+	for _, key := range keys {
+		value := values[key]
+		settings = append(settings, model.Setting{Key: key, Value: value, UpdatedBy: s.Username})
+		audits = append(audits, model.SettingAudit{
+			Key:        key,
+			OldValue:   current[key],
+			NewValue:   value,
+			OperatorID: s.ID,
+			Operator:   s.Username,
+		})
+	}
+	if err := model.SaveSettings(settings, audits); err != nil {
+		return nil, fmt.Errorf("保存配置失败: %v", err)
+	}
+	if err := config.SetRuntime(values); err != nil {
+		return nil, fmt.Errorf("%w: %v", utils.ErrInvalidSetting, err)
+	}
+
+	for _, a := range audits {
+		middleware.SugarLogger.Infow("修改运行时配置",
+			"operatorID", s.ID,
+			"operator", s.Username,
+			"key", a.Key,
+			"old", a.OldValue,
+			"new", a.NewValue,
+		)
+	}
+	return GetSettings()
+}
+
+// GetSettingAudits 分页获取配置修改记录
+func GetSettingAudits(key string, page, pageSize int) ([]SettingAuditDTO, int64, error) {
+	audits, count, err := model.GetSettingAudits(key, page, pageSize)
+	if err != nil {
+		return nil, 0, err
+	}
+	result := make([]SettingAuditDTO, 0, len(audits))
+	for _, a := range audits {
+		result = append(result, SettingAuditDTO{
+			ID:         a.ID,
+			Key:        a.Key,
+			OldValue:   a.OldValue,
+			NewValue:   a.NewValue,
+			OperatorID: a.OperatorID,
+			Operator:   a.Operator,
+			CreatedAt:  a.CreatedAt,
+		})
+	}
+	return result, count, nil
+}
@@ -0,0 +1,126 @@
+package service
+
+import (
+	"AscensionPath/config"
+	"AscensionPath/internal/middleware"
+	"AscensionPath/internal/model"
+	"AscensionPath/internal/utils"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// 初始化管理员密码最小长度
+const minSetupPasswordLength = 8
+
+var (
+	ErrSetupCompleted    = errors.New("系统已完成初始化")
+	ErrInvalidSetupToken = errors.New("无效的初始化令牌")
+)
+
+// 一次性初始化令牌，仅保存在内存中，创建管理员后清除
+var (
+	setupMu    sync.Mutex
+	setupToken string
+)
+
+// BootstrapAdmin 首次启动初始化：已有管理员时跳过；配置了管理员密码时直接创建管理员；
+// 否则生成一次性初始化令牌并返回，由调用方打印到控制台
+func BootstrapAdmin() (string, error) {
+	setupMu.Lock()
+	defer setupMu.Unlock()
+
+	count, err := model.CountUsersByRole(RoleAdmin)
+	if err != nil {
+		return "", fmt.Errorf("查询管理员数量失败: %v", err)
+	}
+	if count > 0 {
+		setupToken = ""
+		return "", nil
+	}
+
+	conf := config.Current().Setup
+	if conf.AdminPassword != "" {
+		user, err := createAdmin(conf.AdminUsername, conf.AdminPassword, conf.AdminEmail)
+		if err != nil {
+			return "", fmt.Errorf("创建初始管理员失败: %v", err)
+		}
+		middleware.SugarLogger.Infow("已根据配置创建初始管理员", "userID", user.ID, "username", user.Username)
+		return "", nil
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("生成初始化令牌失败: %v", err)
+	}
+	setupToken = hex.EncodeToString(buf)
+	middleware.SugarLogger.Warn("系统没有管理员，等待通过初始化令牌创建管理员")
+	return setupToken, nil
+}
+
+// SetupRequired 是否仍在等待通过初始化令牌创建管理员
+func SetupRequired() bool {
+	setupMu.Lock()
+	defer setupMu.Unlock()
+	return setupToken != ""
+}
+
+// CompleteSetup 校验初始化令牌并创建管理员，成功后令牌失效
+func CompleteSetup(token, username, password, email string) (*model.User, error) {
+	setupMu.Lock()
+	defer setupMu.Unlock()
+
+	if setupToken == "" {
+		return nil, ErrSetupCompleted
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(setupToken)) != 1 {
+		middleware.SugarLogger.Warnw("初始化令牌校验失败", "username", username)
+		return nil, ErrInvalidSetupToken
+	}
+	if len(password) < minSetupPasswordLength {
+		return nil, fmt.Errorf("密码长度不能少于%d位", minSetupPasswordLength)
+	}
+	if err := CheckPassword(password, username, email); err != nil {
+		return nil, err
+	}
+
+	user, err := createAdmin(username, password, email)
+	if err != nil {
+		return nil, err
+	}
+	setupToken = ""
+	middleware.SugarLogger.Infow("已通过初始化令牌创建管理员", "userID", user.ID, "username", user.Username)
+	return user, nil
+}
+
+// createAdmin 创建启用状态的管理员账号
+func createAdmin(username, password, email string) (*model.User, error) {
+	if _, err := model.GetUserByUsername(username); err == nil {
+		return nil, utils.ErrUserAlreadyExists
+	}
+	if email != "" {
+		if exists, _ := model.UserExists(username, email); exists {
+			return nil, utils.ErrUserAlreadyExists
+		}
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+	user := &model.User{
+		Username: username,
+		Password: string(hashedPassword),
+		Email:    email,
+		Status:   1,
+		Role:     RoleAdmin,
+	}
+	if err := model.CreateUser(user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
@@ -0,0 +1,243 @@
+package service
+
+import (
+	"AscensionPath/internal/middleware"
+	"AscensionPath/internal/model"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrTeamNotFound     = errors.New("团队不存在")
+	ErrNotTeamMember    = errors.New("不是该团队的成员")
+	ErrTeamHasInstances = errors.New("团队还有运行中的实例，请先停止")
+)
+
+// TeamDTO 团队及其成员
+type TeamDTO struct {
+	ID          uint            `json:"id"`
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	CreatedBy   uint            `json:"created_by"`
+	CreatedAt   time.Time       `json:"created_at"`
+	Members     []TeamMemberDTO `json:"members"`
+	MyRole      string          `json:"my_role,omitempty"` // 当前用户在团队中的角色，不是成员时为空
+}
+
+// TeamMemberDTO 团队成员
+type TeamMemberDTO struct {
+	UserID   uint      `json:"user_id"`
+	Username string    `json:"username"`
+	Role     string    `json:"role"`
+	JoinedAt time.Time `json:"joined_at"`
+}
+
+// toTeamDTO 转换团队并加载成员
+func (s *UserService) toTeamDTO(team model.Team) (TeamDTO, error) {
+	members, err := model.GetTeamMembers(team.ID)
+	if err != nil {
+		return TeamDTO{}, err
+	}
+	dto := TeamDTO{
+		ID:          team.ID,
+		Name:        team.Name,
+		Description: team.Description,
+		CreatedBy:   team.CreatedBy,
+		CreatedAt:   team.CreatedAt,
+		Members:     make([]TeamMemberDTO, 0, len(members)),
+	}
+	for _, member := range members {
+		dto.Members = append(dto.Members, TeamMemberDTO{
+			UserID:   member.UserID,
+			Username: member.User.Username,
+			Role:     member.Role,
+			JoinedAt: member.CreatedAt,
+		})
+		if member.UserID == s.ID {
+			dto.MyRole = member.Role
+		}
+	}
+	return dto, nil
+}
+
+func (s *UserService) toTeamDTOs(teams []model.Team) ([]TeamDTO, error) {
+	result := make([]TeamDTO, 0, len(teams))
+	for _, team := range teams {
+		dto, err := s.toTeamDTO(team)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, dto)
+	}
+	return result, nil
+}
+
+// ListTeams 获取所有团队
+func (s *UserService) ListTeams() ([]TeamDTO, error) {
+	if !s.Can(PermTeamManage) {
+		return nil, errors.New("权限不足")
+	}
+	teams, err := model.GetTeams()
+	if err != nil {
+		return nil, err
+	}
+	return s.toTeamDTOs(teams)
+}
+
+// MyTeams 获取当前用户加入的团队
+func (s *UserService) MyTeams() ([]TeamDTO, error) {
+	teams, err := model.GetTeamsByUserID(s.ID)
+	if err != nil {
+		return nil, err
+	}
+	return s.toTeamDTOs(teams)
+}
+
+// CreateTeam 创建团队
+func (s *UserService) CreateTeam(name, description string) (*TeamDTO, error) {
+	if !s.Can(PermTeamManage) {
+		return nil, errors.New("权限不足")
+	}
+	name, description, err := validateTeamFields(name, description)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := model.GetTeamByName(name); err == nil {
+		return nil, errors.New("团队名称已存在")
+	}
+	team := &model.Team{Name: name, Description: description, CreatedBy: s.ID}
+	if err := model.CreateTeam(team); err != nil {
+		return nil, fmt.Errorf("创建团队失败: %v", err)
+	}
+	middleware.SugarLogger.Infow("创建团队", "operatorID", s.ID, "teamID", team.ID, "name", name)
+	dto, err := s.toTeamDTO(*team)
+	if err != nil {
+		return nil, err
+	}
+	return &dto, nil
+}
+
+// UpdateTeam 修改团队名称和说明
+func (s *UserService) UpdateTeam(id uint, name, description string) error {
+	if !s.Can(PermTeamManage) {
+		return errors.New("权限不足")
+	}
+	name, description, err := validateTeamFields(name, description)
+	if err != nil {
+		return err
+	}
+	if existing, err := model.GetTeamByName(name); err == nil && existing.ID != id {
+		return errors.New("团队名称已存在")
+	}
+	if err := model.UpdateTeam(id, name, description); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrTeamNotFound
+		}
+		return err
+	}
+	middleware.SugarLogger.Infow("修改团队", "operatorID", s.ID, "teamID", id, "name", name)
+	return nil
+}
+
+// DeleteTeam 删除团队，团队还有实例时拒绝删除，避免留下无人管理的实例
+func (s *UserService) DeleteTeam(id uint) error {
+	if !s.Can(PermTeamManage) {
+		return errors.New("权限不足")
+	}
+	count, err := model.CountVulInstancesByTeamID(id)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrTeamHasInstances
+	}
+	if err := model.DeleteTeam(id); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrTeamNotFound
+		}
+		return err
+	}
+	middleware.SugarLogger.Infow("删除团队", "operatorID", s.ID, "teamID", id)
+	return nil
+}
+
+// SetTeamMember 添加成员或修改成员角色；团队管理员可以设置任意角色，队长只能添加队员
+func (s *UserService) SetTeamMember(teamID uint, username, role string) error {
+	if role == "" {
+		role = model.TeamRoleMember
+	}
+	if role != model.TeamRoleCaptain && role != model.TeamRoleMember {
+		return errors.New("无效的团队角色")
+	}
+	if _, err := model.GetTeam(teamID); err != nil {
+		return ErrTeamNotFound
+	}
+	user, err := model.GetUserByUsername(strings.TrimSpace(username))
+	if err != nil {
+		return errors.New("用户不存在")
+	}
+	if !s.Can(PermTeamManage) {
+		if s.teamRole(teamID) != model.TeamRoleCaptain {
+			return errors.New("权限不足")
+		}
+		if role != model.TeamRoleMember {
+			return errors.New("队长只能添加队员")
+		}
+		if _, err := model.GetTeamMember(teamID, user.ID); err == nil {
+			return errors.New("该用户已是团队成员")
+		}
+	}
+	if err := model.SetTeamMember(teamID, user.ID, role); err != nil {
+		return fmt.Errorf("设置团队成员失败: %v", err)
+	}
+	middleware.SugarLogger.Infow("设置团队成员", "operatorID", s.ID, "teamID", teamID, "targetUserID", user.ID, "role", role)
+	return nil
+}
+
+// RemoveTeamMember 移除团队成员；团队管理员可以移除任何成员，队长可以移除队员，成员可以退出团队
+func (s *UserService) RemoveTeamMember(teamID, userID uint) error {
+	target, err := model.GetTeamMember(teamID, userID)
+	if err != nil {
+		return ErrNotTeamMember
+	}
+	allowed := s.Can(PermTeamManage) || userID == s.ID ||
+		(target.Role == model.TeamRoleMember && s.teamRole(teamID) == model.TeamRoleCaptain)
+	if !allowed {
+		return errors.New("权限不足")
+	}
+	if err := model.RemoveTeamMember(teamID, userID); err != nil {
+		return err
+	}
+	middleware.SugarLogger.Infow("移除团队成员", "operatorID", s.ID, "teamID", teamID, "targetUserID", userID)
+	return nil
+}
+
+// IsTeamMember 当前用户是否是团队成员
+func (s *UserService) IsTeamMember(teamID uint) bool {
+	return s.teamRole(teamID) != ""
+}
+
+// teamRole 当前用户在团队中的角色，不是成员时返回空
+func (s *UserService) teamRole(teamID uint) string {
+	member, err := model.GetTeamMember(teamID, s.ID)
+	if err != nil {
+		return ""
+	}
+	return member.Role
+}
+
+func validateTeamFields(name, description string) (string, string, error) {
+	name = strings.TrimSpace(name)
+	description = strings.TrimSpace(description)
+	if name == "" || len([]rune(name)) > 50 {
+		return "", "", errors.New("团队名称不能为空且不能超过50个字符")
+	}
+	if len([]rune(description)) > 255 {
+		return "", "", errors.New("团队说明不能超过255个字符")
+	}
+	return name, description, nil
+}
@@ -0,0 +1,96 @@
+package service
+
+import (
+	"AscensionPath/internal/model"
+	"testing"
+	"time"
+)
+
+func TestTeamMembership(t *testing.T) {
+	useTestDB(t)
+	admin := &UserService{UserDTO: UserDTO{ID: 100, Role: RoleAdmin}}
+	var users []*UserService
+	for _, name := range []string{"alice", "bob", "carol"} {
+		user := &model.User{Username: name, Password: "x", Email: name + "@example.com", Status: 1, Role: RoleUser}
+		if err := model.CreateUser(user); err != nil {
+			t.Fatal(err)
+		}
+		users = append(users, &UserService{UserDTO: UserDTO{ID: user.ID, Username: name, Role: RoleUser}})
+	}
+	alice, bob, carol := users[0], users[1], users[2]
+
+	if _, err := alice.CreateTeam("red", ""); err == nil {
+		t.Error("普通用户不应能创建团队")
+	}
+	team, err := admin.CreateTeam(" red ", "红队")
+	if err != nil {
+		t.Fatalf("CreateTeam: %v", err)
+	}
+	if team.Name != "red" {
+		t.Errorf("团队名称应去除空格: %q", team.Name)
+	}
+	if _, err := admin.CreateTeam("red", ""); err == nil {
+		t.Error("重复的团队名称应创建失败")
+	}
+	if err := admin.SetTeamMember(team.ID, "alice", model.TeamRoleCaptain); err != nil {
+		t.Fatalf("SetTeamMember: %v", err)
+	}
+	if err := admin.SetTeamMember(team.ID, "alice", "owner"); err == nil {
+		t.Error("无效的团队角色应被拒绝")
+	}
+
+	// 队长只能添加队员
+	if err := alice.SetTeamMember(team.ID, "bob", model.TeamRoleCaptain); err == nil {
+		t.Error("队长不应能任命队长")
+	}
+	if err := alice.SetTeamMember(team.ID, "bob", ""); err != nil {
+		t.Fatalf("队长添加队员失败: %v", err)
+	}
+	if err := bob.SetTeamMember(team.ID, "carol", ""); err == nil {
+		t.Error("队员不应能添加成员")
+	}
+	if !bob.IsTeamMember(team.ID) || carol.IsTeamMember(team.ID) {
+		t.Error("IsTeamMember 结果不正确")
+	}
+
+	teams, err := bob.MyTeams()
+	if err != nil || len(teams) != 1 || teams[0].MyRole != model.TeamRoleMember || len(teams[0].Members) != 2 {
+		t.Errorf("MyTeams = %+v, %v", teams, err)
+	}
+
+	// 队员不能移除队长，可以退出团队
+	if err := bob.RemoveTeamMember(team.ID, alice.ID); err == nil {
+		t.Error("队员不应能移除队长")
+	}
+	if err := carol.RemoveTeamMember(team.ID, bob.ID); err == nil {
+		t.Error("非成员不应能移除成员")
+	}
+	if err := bob.RemoveTeamMember(team.ID, bob.ID); err != nil {
+		t.Errorf("成员应能退出团队: %v", err)
+	}
+	alice.SetTeamMember(team.ID, "carol", "")
+	if err := alice.RemoveTeamMember(team.ID, carol.ID); err != nil {
+		t.Errorf("队长应能移除队员: %v", err)
+	}
+
+	// 团队还有实例时不能删除
+	env := &model.VulEnv{EnvName: "web", EnvType: "image", BaseImage: "nginx"}
+	model.DB.Create(env)
+	instance := &model.VulInstance{UserID: alice.ID, TeamID: team.ID, VulEnvID: env.ID, Status: 1, StartTime: time.Now(), ExpireTime: time.Now().Add(time.Hour)}
+	if err := model.CreateVulInstance(instance); err != nil {
+		t.Fatal(err)
+	}
+	if err := admin.DeleteTeam(team.ID); err != ErrTeamHasInstances {
+		t.Errorf("团队有实例时应拒绝删除: %v", err)
+	}
+	model.DeleteVulInstance(instance.ID)
+	if err := alice.DeleteTeam(team.ID); err == nil {
+		t.Error("队长不应能删除团队")
+	}
+	if err := admin.DeleteTeam(team.ID); err != nil {
+		t.Errorf("DeleteTeam: %v", err)
+	}
+	if err := admin.DeleteTeam(team.ID); err != ErrTeamNotFound {
+		t.Errorf("删除不存在的团队应返回 ErrTeamNotFound: %v", err)
+	}
+}
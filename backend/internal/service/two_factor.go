@@ -0,0 +1,243 @@
+package service
+
+import (
+	"AscensionPath/config"
+	"AscensionPath/internal/middleware"
+	"AscensionPath/internal/model"
+	"AscensionPath/internal/utils"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrTwoFactorRequired      = errors.New("需要两步验证")
+	ErrInvalidTwoFactorCode   = errors.New("验证码无效")
+	ErrTwoFactorSetupRequired = errors.New("请先启用两步验证")
+)
+
+// 每次生成的恢复码数量
+const recoveryCodeCount = 10
+
+// 恢复码字符集，去掉了容易混淆的0/1/l/o
+const recoveryCodeAlphabet = "23456789abcdefghijkmnpqrstuvwxyz"
+
+// TwoFactorStatus 当前用户的两步验证状态
+type TwoFactorStatus struct {
+	Enabled           bool  `json:"enabled"`
+	Required          bool  `json:"required"`            // 当前身份是否必须启用
+	RecoveryCodesLeft int64 `json:"recovery_codes_left"` // 未使用的恢复码数量
+}
+
+// TwoFactorSetup 绑定验证器App所需的信息
+type TwoFactorSetup struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"` // otpauth链接，前端生成二维码
+}
+
+// TwoFactorSetupRequired 用户所属身份要求两步验证但尚未启用
+func TwoFactorSetupRequired(userID uint, role string) bool {
+	if !config.Current().TwoFactor.Requires(role) {
+		return false
+	}
+	enabled, err := model.IsTwoFactorEnabled(userID)
+	if err != nil {
+		middleware.SugarLogger.Errorw("查询两步验证状态失败", "userID", userID, "error", err.Error())
+		return true
+	}
+	return !enabled
+}
+
+// GetTwoFactorStatus 获取当前用户的两步验证状态
+func (s *UserService) GetTwoFactorStatus() (*TwoFactorStatus, error) {
+	status := &TwoFactorStatus{Required: config.Current().TwoFactor.Requires(s.Role)}
+	enabled, err := model.IsTwoFactorEnabled(s.ID)
+	if err != nil {
+		return nil, err
+	}
+	if enabled {
+		status.Enabled = true
+		if status.RecoveryCodesLeft, err = model.CountRecoveryCodes(s.ID); err != nil {
+			return nil, err
+		}
+	}
+	return status, nil
+}
+
+// SetupTwoFactor 生成新的TOTP密钥，调用EnableTwoFactor确认验证码后才会启用
+func (s *UserService) SetupTwoFactor() (*TwoFactorSetup, error) {
+	if enabled, err := model.IsTwoFactorEnabled(s.ID); err != nil {
+		return nil, err
+	} else if enabled {
+		return nil, errors.New("已启用两步验证")
+	}
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		return nil, fmt.Errorf("生成密钥失败: %v", err)
+	}
+	if err := model.SaveTwoFactorSecret(s.ID, secret); err != nil {
+		return nil, fmt.Errorf("保存密钥失败: %v", err)
+	}
+	return &TwoFactorSetup{
+		Secret: secret,
+		URI:    utils.TOTPURI(config.Current().TwoFactor.Issuer, s.Username, secret),
+	}, nil
+}
+
+// EnableTwoFactor 校验验证器App生成的验证码后启用两步验证，返回只显示一次的恢复码，
+// 启用后注销该用户的其他会话
+func (s *UserService) EnableTwoFactor(code string) ([]string, error) {
+	tf, err := model.GetTwoFactor(s.ID)
+	if err != nil {
+		return nil, errors.New("请先生成两步验证密钥")
+	}
+	if tf.Enabled {
+		return nil, errors.New("已启用两步验证")
+	}
+	step, ok := utils.ValidateTOTP(tf.Secret, code, time.Now())
+	if !ok {
+		return nil, ErrInvalidTwoFactorCode
+	}
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := model.EnableTwoFactor(s.ID, step, hashes); err != nil {
+		return nil, fmt.Errorf("启用两步验证失败: %v", err)
+	}
+	middleware.SugarLogger.Infow("启用两步验证", "userID", s.ID)
+	s.revokeSessionsOf(s.ID)
+	return codes, nil
+}
+
+// DisableTwoFactor 校验密码和验证码后关闭两步验证，身份要求两步验证时不能关闭
+func (s *UserService) DisableTwoFactor(password, code string) error {
+	if config.Current().TwoFactor.Requires(s.Role) {
+		return errors.New("当前身份必须启用两步验证")
+	}
+	user, err := model.GetUserByID(s.ID)
+	if err != nil {
+		return errors.New("用户不存在")
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
+		return errors.New("密码错误")
+	}
+	if ok, err := verifyTwoFactorCode(s.ID, code); err != nil {
+		return err
+	} else if !ok {
+		return ErrInvalidTwoFactorCode
+	}
+	if _, err := model.DeleteTwoFactor(s.ID); err != nil {
+		return fmt.Errorf("关闭两步验证失败: %v", err)
+	}
+	middleware.SugarLogger.Infow("关闭两步验证", "userID", s.ID)
+	s.revokeSessionsOf(s.ID)
+	return nil
+}
+
+// RegenerateRecoveryCodes 校验验证码后重新生成恢复码，旧恢复码全部失效
+func (s *UserService) RegenerateRecoveryCodes(code string) ([]string, error) {
+	if ok, err := verifyTwoFactorCode(s.ID, code); err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, ErrInvalidTwoFactorCode
+	}
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := model.ReplaceRecoveryCodes(s.ID, hashes); err != nil {
+		return nil, fmt.Errorf("保存恢复码失败: %v", err)
+	}
+	middleware.SugarLogger.Infow("重新生成恢复码", "userID", s.ID)
+	return codes, nil
+}
+
+// ResetTwoFactor 管理员为丢失验证器的用户关闭两步验证，并注销该用户的会话
+func (s *UserService) ResetTwoFactor(userID uint) error {
+	if !s.canManageUser(userID) {
+		return errors.New("权限不足")
+	}
+	deleted, err := model.DeleteTwoFactor(userID)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return errors.New("该用户未启用两步验证")
+	}
+	middleware.SugarLogger.Infow("管理员重置两步验证", "operatorID", s.ID, "targetUserID", userID)
+	s.revokeSessionsOf(userID)
+	return nil
+}
+
+// VerifyTwoFactorLogin 密码验证通过后校验验证码或恢复码，失败次数与密码错误共同计入登录限制
+func VerifyTwoFactorLogin(userID uint, code, ip, userAgent string) (*model.User, error) {
+	user, err := model.GetUserByID(userID)
+	if err != nil || user.Status == 0 {
+		return nil, utils.ErrInvalidCredentials
+	}
+	if err := checkLoginThrottle(user.Username, ip); err != nil {
+		recordLoginHistory(user.ID, user.Username, ip, userAgent, false, loginReasonThrottled)
+		return nil, err
+	}
+	ok, err := verifyTwoFactorCode(user.ID, code)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		middleware.SugarLogger.Warnw("两步验证失败", "userID", user.ID, "ip", ip)
+		recordLoginFailure(user.Username, ip)
+		recordLoginHistory(user.ID, user.Username, ip, userAgent, false, loginReasonTwoFactor)
+		return nil, ErrInvalidTwoFactorCode
+	}
+	completeLogin(user, ip, userAgent)
+	return user, nil
+}
+
+// verifyTwoFactorCode 校验TOTP验证码或恢复码，每个验证码和恢复码只能使用一次
+func verifyTwoFactorCode(userID uint, code string) (bool, error) {
+	tf, err := model.GetTwoFactor(userID)
+	if err != nil || !tf.Enabled {
+		return false, errors.New("未启用两步验证")
+	}
+	if step, ok := utils.ValidateTOTP(tf.Secret, code, time.Now()); ok {
+		return model.UseTOTPStep(userID, step)
+	}
+	normalized := normalizeRecoveryCode(code)
+	if len(normalized) != 10 {
+		return false, nil
+	}
+	used, err := model.UseRecoveryCode(userID, hashToken(normalized))
+	if used {
+		middleware.SugarLogger.Infow("使用恢复码登录", "userID", userID)
+	}
+	return used, err
+}
+
+// newRecoveryCodes 生成恢复码(xxxxx-xxxxx)及其哈希
+func newRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	buf := make([]byte, 10)
+	for i := 0; i < recoveryCodeCount; i++ {
+		if _, err := rand.Read(buf); err != nil {
+			return nil, nil, fmt.Errorf("生成恢复码失败: %v", err)
+		}
+		for j := range buf {
+			buf[j] = recoveryCodeAlphabet[int(buf[j])%len(recoveryCodeAlphabet)]
+		}
+		code := string(buf)
+		codes = append(codes, code[:5]+"-"+code[5:])
+		hashes = append(hashes, hashToken(code))
+	}
+	return codes, hashes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.ReplaceAll(code, "-", "")
+}
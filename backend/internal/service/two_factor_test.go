@@ -0,0 +1,127 @@
+package service
+
+import (
+	"AscensionPath/internal/model"
+	"AscensionPath/internal/utils"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// enableTestTwoFactor 为用户启用两步验证，返回密钥、启用时使用的时间步和恢复码
+func enableTestTwoFactor(t *testing.T, s *UserService) (string, int64, []string) {
+	t.Helper()
+	setup, err := s.SetupTwoFactor()
+	if err != nil {
+		t.Fatalf("SetupTwoFactor: %v", err)
+	}
+	if _, err := s.EnableTwoFactor("abcdef"); !errors.Is(err, ErrInvalidTwoFactorCode) {
+		t.Fatalf("错误的验证码应无法启用: %v", err)
+	}
+	step := utils.TOTPStep(time.Now())
+	code, _ := utils.TOTPCode(setup.Secret, step)
+	codes, err := s.EnableTwoFactor(code)
+	if err != nil || len(codes) != recoveryCodeCount {
+		t.Fatalf("EnableTwoFactor = %v, %v", codes, err)
+	}
+	return setup.Secret, step, codes
+}
+
+func TestTwoFactorLogin(t *testing.T) {
+	useTestDB(t)
+	alice := createLocalUser(t, "alice", "alice123", RoleUser)
+	user := &UserService{UserDTO: UserDTO{ID: alice.ID, Username: "alice", Role: RoleUser}}
+	secret, step, codes := enableTestTwoFactor(t, user)
+	s := &UserService{}
+
+	// 密码错误时不进入两步验证
+	if _, err := s.Login("alice", "wrong", "10.0.0.1", "test"); !errors.Is(err, utils.ErrInvalidCredentials) {
+		t.Fatalf("密码错误时返回 %v", err)
+	}
+	// 密码正确时返回待验证状态，不算登录成功
+	pending, err := s.Login("alice", "alice123", "10.0.0.1", "test")
+	if !errors.Is(err, ErrTwoFactorRequired) || pending == nil || pending.ID != alice.ID {
+		t.Fatalf("密码正确时应等待两步验证: %v, %v", pending, err)
+	}
+	if histories, _, _ := model.GetLoginHistories(alice.ID, 1, 10); len(histories) != 1 || histories[0].Success {
+		t.Errorf("两步验证前不应记录登录成功: %+v", histories)
+	}
+
+	// 错误的验证码被拒绝并计入失败次数
+	if _, err := VerifyTwoFactorLogin(alice.ID, "abc", "10.0.0.1", "test"); !errors.Is(err, ErrInvalidTwoFactorCode) {
+		t.Fatalf("错误的验证码应被拒绝: %v", err)
+	}
+	if throttle, err := model.GetLoginThrottle(model.LoginScopeUser, "alice"); err != nil || throttle.Failures != 2 {
+		t.Errorf("验证码错误应计入失败次数: %+v, %v", throttle, err)
+	}
+
+	// 启用时用过的时间步不能再次使用，下一个时间步的验证码可以使用一次
+	code, _ := utils.TOTPCode(secret, step)
+	if _, err := VerifyTwoFactorLogin(alice.ID, code, "10.0.0.1", "test"); !errors.Is(err, ErrInvalidTwoFactorCode) {
+		t.Fatalf("已使用的验证码应被拒绝: %v", err)
+	}
+	code, _ = utils.TOTPCode(secret, step+1)
+	if logged, err := VerifyTwoFactorLogin(alice.ID, code, "10.0.0.1", "test"); err != nil || logged.ID != alice.ID {
+		t.Fatalf("正确的验证码应能登录: %v, %v", logged, err)
+	}
+	if _, err := model.GetLoginThrottle(model.LoginScopeUser, "alice"); err == nil {
+		t.Error("登录成功后应清除失败计数")
+	}
+	if _, err := VerifyTwoFactorLogin(alice.ID, code, "10.0.0.1", "test"); !errors.Is(err, ErrInvalidTwoFactorCode) {
+		t.Fatalf("同一验证码不应能使用两次: %v", err)
+	}
+
+	// 恢复码只能使用一次，不区分大小写和分隔符
+	if _, err := VerifyTwoFactorLogin(alice.ID, codes[0], "10.0.0.1", "test"); err != nil {
+		t.Fatalf("恢复码应能登录: %v", err)
+	}
+	if _, err := VerifyTwoFactorLogin(alice.ID, codes[0], "10.0.0.1", "test"); !errors.Is(err, ErrInvalidTwoFactorCode) {
+		t.Fatalf("已使用的恢复码应被拒绝: %v", err)
+	}
+	if _, err := VerifyTwoFactorLogin(alice.ID, strings.ToUpper(strings.ReplaceAll(codes[1], "-", "")), "10.0.0.1", "test"); err != nil {
+		t.Fatalf("恢复码应不区分大小写和分隔符: %v", err)
+	}
+	status, err := user.GetTwoFactorStatus()
+	if err != nil || !status.Enabled || status.RecoveryCodesLeft != recoveryCodeCount-2 {
+		t.Errorf("GetTwoFactorStatus = %+v, %v", status, err)
+	}
+
+	// 重新生成后旧恢复码全部失效
+	if _, err := user.RegenerateRecoveryCodes(codes[2]); err != nil {
+		t.Fatalf("RegenerateRecoveryCodes: %v", err)
+	}
+	if _, err := VerifyTwoFactorLogin(alice.ID, codes[3], "10.0.0.1", "test"); !errors.Is(err, ErrInvalidTwoFactorCode) {
+		t.Fatalf("重新生成后旧恢复码应失效: %v", err)
+	}
+
+	// 被禁用的用户无法完成两步验证
+	model.DB.Model(&model.User{}).Where("id = ?", alice.ID).Update("status", 0)
+	code, _ = utils.TOTPCode(secret, step-1)
+	if _, err := VerifyTwoFactorLogin(alice.ID, code, "10.0.0.1", "test"); !errors.Is(err, utils.ErrInvalidCredentials) {
+		t.Fatalf("被禁用的用户应无法登录: %v", err)
+	}
+}
+
+func TestDisableTwoFactor(t *testing.T) {
+	useTestDB(t)
+	alice := createLocalUser(t, "alice", "alice123", RoleUser)
+	user := &UserService{UserDTO: UserDTO{ID: alice.ID, Username: "alice", Role: RoleUser}}
+	_, _, codes := enableTestTwoFactor(t, user)
+
+	if _, err := user.SetupTwoFactor(); err == nil {
+		t.Error("已启用时不应重新生成密钥")
+	}
+	if err := user.DisableTwoFactor("wrong", codes[0]); err == nil {
+		t.Error("密码错误时不应关闭两步验证")
+	}
+	if err := user.DisableTwoFactor("alice123", "abcdef"); err == nil {
+		t.Error("验证码错误时不应关闭两步验证")
+	}
+	if err := user.DisableTwoFactor("alice123", codes[0]); err != nil {
+		t.Fatalf("DisableTwoFactor: %v", err)
+	}
+	if user, err := (&UserService{}).Login("alice", "alice123", "10.0.0.1", "test"); err != nil || user.ID != alice.ID {
+		t.Fatalf("关闭两步验证后应直接登录: %v", err)
+	}
+}
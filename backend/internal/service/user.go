@@ -2,8 +2,10 @@ package service
 
 import (
 	"errors"
+	"fmt"
 	"time"
 
+	"AscensionPath/config"
 	"AscensionPath/internal/middleware"
 	"AscensionPath/internal/model"
 	"AscensionPath/internal/utils"
@@ -11,23 +13,25 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
+var (
+	ErrRegistrationClosed  = errors.New("系统未开放注册")
+	ErrPasswordViaAPIToken = errors.New("不能通过访问令牌修改密码")
+	ErrLDAPPassword        = errors.New("LDAP账号请在目录服务中修改密码")
+)
+
 type UserService struct {
 	UserDTO
+	SessionID string       `json:"-"` // 当前请求使用的会话
+	APIToken  *APITokenDTO `json:"-"` // 通过个人访问令牌认证时使用的令牌，登录会话为nil
 }
 
-// 在service层添加角色校验
+// 内置身份，其他身份由管理员在roles表中维护
 const (
 	RoleUser  = "user"
 	RoleAdmin = "admin"
 	RoleVip   = "vip"
 )
 
-var RoleMap = map[string]int{
-	RoleAdmin: 0,
-	RoleVip:   500,
-	RoleUser:  999,
-}
-
 // 转换前端需要的DTO对象
 type UserDTO struct {
 	ID        uint      `json:"id"`
@@ -39,6 +43,9 @@ type UserDTO struct {
 	LastLogin time.Time `json:"last_login"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+
+	MustChangePassword bool     `json:"must_change_password"`  // 登录后必须先修改密码
+	Permissions        []string `json:"permissions,omitempty"` // 身份拥有的权限，只在获取自己的信息时返回
 }
 
 func invertUserDTO(user model.User) UserDTO {
@@ -52,6 +59,8 @@ func invertUserDTO(user model.User) UserDTO {
 		LastLogin: user.LastLogin,
 		CreatedAt: user.CreatedAt,
 		UpdatedAt: user.UpdatedAt,
+
+		MustChangePassword: user.MustChangePassword,
 	}
 }
 
@@ -63,22 +72,32 @@ func invertUserDTOList(users []model.User) []UserDTO {
 	return userDTOs
 }
 
-// 判断非法角色
-func IsValidRole(role string) bool {
-	switch role {
-	case RoleUser, RoleAdmin, RoleVip:
-		return true
-	default:
-		return false
+// Register 用户注册，按注册方式检查邀请码和邮箱域名；使用邀请码时获得邀请码预设的身份和初始积分
+func (s *UserService) Register(username, password, email, inviteCode string) (*model.User, error) {
+	conf := config.Current().Registration
+	mode := conf.EffectiveMode()
+	if mode == config.RegistrationClosed {
+		return nil, ErrRegistrationClosed
+	}
+	var invite *model.InviteCode
+	if inviteCode = normalizeInviteCode(inviteCode); inviteCode != "" {
+		var err error
+		if invite, err = checkInviteCode(inviteCode); err != nil {
+			return nil, err
+		}
+	} else if mode == config.RegistrationInvite {
+		return nil, ErrInviteRequired
+	} else if mode == config.RegistrationDomain && !emailDomainAllowed(email, conf.Domains()) {
+		return nil, ErrEmailDomainNotAllowed
 	}
-}
 
-// Register 用户注册
-func (s *UserService) Register(username, password, email string) (*model.User, error) {
 	// 检查用户是否存在
 	if exists, _ := model.UserExists(username, email); exists {
 		return nil, utils.ErrUserAlreadyExists
 	}
+	if err := CheckPassword(password, username, email); err != nil {
+		return nil, err
+	}
 
 	// 密码加密
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
@@ -90,12 +109,16 @@ func (s *UserService) Register(username, password, email string) (*model.User, e
 		Username: username,
 		Password: string(hashedPassword),
 		Email:    email,
-		Status:   0,        // 默认状态为禁用
-		Role:     RoleUser, // 设置默认角色
-		Score:    0,        // 初始分数
+		Status:   registrationStatus(conf.Activation, invite != nil), // 需要审核或验证邮箱时为禁用
+		Role:     RoleUser,                                           // 设置默认角色
+		Score:    0,                                                  // 初始分数
+	}
+	if invite != nil {
+		user.Role = invite.Role
+		user.Score = invite.Score
 	}
 
-	if err := model.CreateUser(user); err != nil {
+	if err := createRegisteredUser(user, invite); err != nil {
 		middleware.SugarLogger.Errorw("创建用户失败",
 			"username", username,
 			"error", err.Error(),
@@ -106,31 +129,65 @@ func (s *UserService) Register(username, password, email string) (*model.User, e
 	middleware.SugarLogger.Infow("用户注册成功",
 		"userID", user.ID,
 		"username", username,
+		"mode", mode,
+		"invited", invite != nil,
 	)
+	if conf.Activation == config.ActivationEmail {
+		if err := sendVerificationEmail(user); err != nil {
+			middleware.SugarLogger.Errorw("发送验证邮件失败", "userID", user.ID, "error", err.Error())
+		}
+	}
 	return user, nil
 }
 
-// Login 用户登录
-func (s *UserService) Login(username, password string) (*model.User, error) {
+// Login 用户登录，账号或IP失败次数过多时返回LoginThrottledError，每次尝试都写入登录记录；
+// 已启用两步验证时返回用户和ErrTwoFactorRequired，需调用VerifyTwoFactorLogin完成登录
+func (s *UserService) Login(username, password, ip, userAgent string) (*model.User, error) {
 	middleware.SugarLogger.Infow("登录尝试",
 		"username", username,
+		"ip", ip,
 	)
 
 	user, err := model.GetUserByUsername(username)
-	if err != nil {
-		middleware.SugarLogger.Warnw("用户不存在",
-			"username", username,
-			"error", err.Error(),
-		)
-		return nil, utils.ErrInvalidCredentials
+	var userID uint
+	if err == nil {
+		userID = user.ID
 	}
-	// 判断密码正确性
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
-		middleware.SugarLogger.Warnw("密码验证失败",
-			"userID", user.ID,
+	// 先检查锁定，被锁定期间不再校验密码
+	if err := checkLoginThrottle(username, ip); err != nil {
+		middleware.SugarLogger.Warnw("登录被限制",
 			"username", username,
+			"ip", ip,
 		)
-		return nil, utils.ErrInvalidCredentials
+		recordLoginHistory(userID, username, ip, userAgent, false, loginReasonThrottled)
+		return nil, err
+	}
+	if config.Current().LDAP.Enabled && (err != nil || isLDAPAccount(user.ID)) {
+		// 启用LDAP时，本地不存在的用户和已关联LDAP的账号使用目录密码登录，其他本地账号仍使用本地密码
+		user, err = ldapLogin(username, password, ip, userAgent)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		if err != nil {
+			middleware.SugarLogger.Warnw("用户不存在",
+				"username", username,
+				"error", err.Error(),
+			)
+			recordLoginFailure(username, ip)
+			recordLoginHistory(0, username, ip, userAgent, false, loginReasonUserNotFound)
+			return nil, utils.ErrInvalidCredentials
+		}
+		// 判断密码正确性
+		if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
+			middleware.SugarLogger.Warnw("密码验证失败",
+				"userID", user.ID,
+				"username", username,
+			)
+			recordLoginFailure(username, ip)
+			recordLoginHistory(user.ID, username, ip, userAgent, false, loginReasonWrongPassword)
+			return nil, utils.ErrInvalidCredentials
+		}
 	}
 
 	// 检查用户状态
@@ -139,13 +196,37 @@ func (s *UserService) Login(username, password string) (*model.User, error) {
 			"userID", user.ID,
 			"username", username,
 		)
+		recordLoginHistory(user.ID, username, ip, userAgent, false, loginReasonDisabled)
+		// 密码已校验通过，可以提示用户验证邮箱
+		if isPendingVerification(user) {
+			return nil, ErrEmailNotVerified
+		}
 		return nil, utils.ErrInvalidCredentials
 	}
 
+	// 已启用两步验证时还需校验验证码，此时返回用户和ErrTwoFactorRequired，不清除失败计数
+	if enabled, err := model.IsTwoFactorEnabled(user.ID); err != nil {
+		return nil, fmt.Errorf("查询两步验证状态失败: %v", err)
+	} else if enabled {
+		middleware.SugarLogger.Infow("密码验证通过，等待两步验证",
+			"userID", user.ID,
+			"username", username,
+		)
+		return user, ErrTwoFactorRequired
+	}
+
+	completeLogin(user, ip, userAgent)
+	return user, nil
+}
+
+// completeLogin 登录成功：清除失败计数，写入登录记录并更新最后登录时间
+func completeLogin(user *model.User, ip, userAgent string) {
 	middleware.SugarLogger.Infow("登录成功",
 		"userID", user.ID,
-		"username", username,
+		"username", user.Username,
 	)
+	resetLoginFailures(user.Username)
+	recordLoginHistory(user.ID, user.Username, ip, userAgent, true, "")
 
 	// 仅更新最后登录时间字段
 	if err := model.UpdateUser(user.ID, map[string]interface{}{
@@ -156,7 +237,6 @@ func (s *UserService) Login(username, password string) (*model.User, error) {
 			"error", err,
 		)
 	}
-	return user, nil
 }
 
 // UpdateProfile 更新用户资料（添加权限验证）
@@ -174,7 +254,8 @@ func (s *UserService) UpdateProfile(id uint, email string, status int, role stri
 	middleware.SugarLogger.Infow("用户资料更新请求", logFields...)
 
 	// 权限验证
-	if s.Role != RoleAdmin {
+	manager := s.canManageUser(id)
+	if !manager {
 		// 普通用户只能修改自己的资料
 		if s.ID != id {
 			middleware.SugarLogger.Warnw("越权修改尝试", logFields...)
@@ -196,41 +277,85 @@ func (s *UserService) UpdateProfile(id uint, email string, status int, role stri
 		updates["username"] = username
 	}
 
-	if s.Role == RoleAdmin {
+	if manager {
 		if status != -1 {
 			updates["status"] = status
 		}
 		if role != "" && IsValidRole(role) {
+			if !s.canAssignRole(role) {
+				return errors.New("不能授予权限超过自己的身份")
+			}
 			updates["role"] = role
 		}
-		if score != -1 {
-			updates["score"] = score
+		if score != -1 && score < 0 {
+			return errors.New("积分不能为负数")
 		}
 	}
+	// 积分通过积分流水调整，不直接修改
+	setScore := manager && score != -1
 
 	// 密码修改单独处理
 	if password != "" {
-		if s.Role != RoleAdmin && s.ID != id {
+		if s.APIToken != nil {
+			return ErrPasswordViaAPIToken
+		}
+		if !manager && s.ID != id {
 			return errors.New("无权修改其他用户密码")
 		}
+		if config.Current().LDAP.Enabled && isLDAPAccount(id) {
+			return ErrLDAPPassword
+		}
+		target, err := model.GetUserByID(id)
+		if err != nil {
+			return err
+		}
+		if err := CheckPassword(password, target.Username, target.Email); err != nil {
+			return err
+		}
 		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 		if err != nil {
 			return err
 		}
 		updates["password"] = string(hashedPassword)
+		// 管理员重置他人密码后，该用户下次登录必须修改密码
+		updates["must_change_password"] = s.ID != id
 	}
 
 	// 如果没有可更新字段
-	if len(updates) == 0 {
+	if len(updates) == 0 && !setScore {
 		middleware.SugarLogger.Warnw("无有效更新字段", logFields...)
 		return errors.New("没有需要更新的字段")
 	}
 
-	if err := model.UpdateUser(id, updates); err != nil {
-		middleware.SugarLogger.Errorw("用户资料更新失败",
-			append(logFields, "error", err.Error())...,
-		)
-		return err
+	if len(updates) > 0 {
+		if err := model.UpdateUser(id, updates); err != nil {
+			middleware.SugarLogger.Errorw("用户资料更新失败",
+				append(logFields, "error", err.Error())...,
+			)
+			return err
+		}
+	}
+	if setScore {
+		entry, err := model.SetScore(id, score, s.ID, "管理员调整")
+		if err != nil {
+			middleware.SugarLogger.Errorw("调整用户积分失败", append(logFields, "error", err.Error())...)
+			return fmt.Errorf("调整积分失败: %v", err)
+		}
+		if entry != nil {
+			middleware.SugarLogger.Infow("管理员调整用户积分", "operatorID", s.ID, "targetUserID", id,
+				"amount", entry.Amount, "balance", entry.Balance)
+		}
+	}
+
+	// 禁用用户或修改密码后注销其已登录的会话
+	if updates["status"] == 0 || password != "" {
+		s.revokeSessionsOf(id)
+	}
+	// 管理员修改状态后不再允许通过验证邮件启用
+	if _, ok := updates["status"]; ok {
+		if err := model.DeleteEmailVerificationTokens(id); err != nil {
+			middleware.SugarLogger.Errorw("清除邮箱验证令牌失败", "targetUserID", id, "error", err.Error())
+		}
 	}
 
 	middleware.SugarLogger.Infow("用户资料更新成功",
@@ -242,31 +367,40 @@ func (s *UserService) UpdateProfile(id uint, email string, status int, role stri
 
 // ChangePassword 修改密码（添加权限验证）
 func (s *UserService) ChangePassword(targetUserID uint, oldPassword, newPassword string) error {
+	manager := s.canManageUser(targetUserID)
 	logFields := []interface{}{
 		"operatorID", s.ID,
 		"targetUserID", targetUserID,
-		"isAdmin", s.Role == "admin",
+		"isManager", manager,
 	}
 
 	middleware.SugarLogger.Infow("密码修改请求", logFields...)
-	// 权限验证：当前用户是管理员或修改自己的密码
-	if s.Role != "admin" && s.ID != targetUserID {
+	if s.APIToken != nil {
+		return ErrPasswordViaAPIToken
+	}
+	// 权限验证：当前用户可以管理该用户或修改自己的密码
+	if !manager && s.ID != targetUserID {
 		middleware.SugarLogger.Warnw("越权密码修改尝试", logFields...)
 		return errors.New("无权修改其他用户密码")
 	}
+	if config.Current().LDAP.Enabled && isLDAPAccount(targetUserID) {
+		return ErrLDAPPassword
+	}
 
+	user, err := model.GetUserByID(targetUserID)
+	if err != nil {
+		return err
+	}
 	// 当修改他人密码时（管理员操作），跳过旧密码验证
-	if s.Role != "admin" {
-		user, err := model.GetUserByID(targetUserID)
-		if err != nil {
-			return err
-		}
-
+	if !manager {
 		// 只有修改自己密码时需要验证旧密码
 		if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(oldPassword)); err != nil {
 			return utils.ErrInvalidCredentials
 		}
 	}
+	if err := CheckPassword(newPassword, user.Username, user.Email); err != nil {
+		return err
+	}
 
 	if err := model.UpdatePassword(targetUserID, newPassword); err != nil {
 		middleware.SugarLogger.Errorw("密码更新失败",
@@ -275,6 +409,16 @@ func (s *UserService) ChangePassword(targetUserID uint, oldPassword, newPassword
 		return err
 	}
 
+	// 修改自己的密码后解除强制改密；管理员重置他人密码后要求其下次登录修改
+	if err := model.UpdateUser(targetUserID, map[string]interface{}{
+		"must_change_password": s.ID != targetUserID,
+	}); err != nil {
+		return err
+	}
+
+	// 注销其他已登录的会话
+	s.revokeSessionsOf(targetUserID)
+
 	middleware.SugarLogger.Infow("密码更新成功", logFields...)
 
 	return nil
@@ -290,18 +434,18 @@ func (s *UserService) DeleteAccount(targetUserID uint) error {
 
 	middleware.SugarLogger.Infow("账户删除请求", logFields...)
 
-	// 权限验证：当前用户是管理员或删除自己账户
-	if s.Role != "admin" && s.ID != targetUserID {
+	// 权限验证：当前用户可以管理该用户或删除自己账户
+	if s.ID != targetUserID && !s.canManageUser(targetUserID) {
 		return errors.New("无权删除其他用户账户")
 	}
 
 	// 管理员删除时需要额外验证（可选）
-	if s.Role == "admin" && s.ID == targetUserID {
+	if s.Can(PermUserManage) && s.ID == targetUserID {
 		return errors.New("管理员不能删除自己账户")
 	}
 
 	// 普通用户删除自己时需要密码验证（可选）
-	if s.Role == "user" {
+	if !s.Can(PermUserManage) {
 		user, err := model.GetUserByID(targetUserID)
 		if err != nil {
 			return err
@@ -318,6 +462,21 @@ func (s *UserService) DeleteAccount(targetUserID uint) error {
 		return err
 	}
 
+	s.revokeSessionsOf(targetUserID)
+	if err := model.DeleteTeamMembersByUserID(targetUserID); err != nil {
+		middleware.SugarLogger.Warnw("删除用户的团队成员记录失败", append(logFields, "error", err.Error())...)
+	}
+	if err := model.DeleteCourseStudentsByUserID(targetUserID); err != nil {
+		middleware.SugarLogger.Warnw("删除用户的选课记录失败", append(logFields, "error", err.Error())...)
+	}
+	if err := model.DeleteSolvesByUserID(targetUserID); err != nil {
+		middleware.SugarLogger.Warnw("删除用户的解出记录失败", append(logFields, "error", err.Error())...)
+	}
+	if err := model.DeleteScoreEntriesByUserID(targetUserID); err != nil {
+		middleware.SugarLogger.Warnw("删除用户的积分流水失败", append(logFields, "error", err.Error())...)
+	}
+	Scoreboards.Invalidate()
+
 	middleware.SugarLogger.Infow("账户已删除",
 		"targetUserID", targetUserID,
 		"operatorID", s.ID,
@@ -340,8 +499,8 @@ func (s *UserService) UpdateUserRole(id uint, newRole string) error {
 		return errors.New("无效的角色类型")
 	}
 
-	if s.Role != "admin" {
-		middleware.SugarLogger.Warnw("非管理员角色修改尝试",
+	if !s.canManageUser(id) || !s.canAssignRole(newRole) {
+		middleware.SugarLogger.Warnw("越权角色修改尝试",
 			"operatorRole", s.Role,
 		)
 		return errors.New("权限不足，无法修改用户角色")
@@ -362,10 +521,22 @@ func (s *UserService) UpdateUserRole(id uint, newRole string) error {
 	return nil
 }
 
+// canManageUser 是否可以管理该用户：需要用户管理权限，且对方身份的权限不超过自己
+func (s *UserService) canManageUser(targetUserID uint) bool {
+	if !s.Can(PermUserManage) {
+		return false
+	}
+	if s.Role == RoleAdmin || s.ID == targetUserID {
+		return true
+	}
+	target, err := model.GetUserByID(targetUserID)
+	return err == nil && s.canAssignRole(target.Role)
+}
+
 // GetAllUsers 获取用户列表（Service层）
 func (s *UserService) GetAllUsers(page, pageSize int) ([]UserDTO, error) {
 	// 添加访问控制逻辑
-	if s.Role != "admin" {
+	if !s.Can(PermUserManage) {
 		return nil, errors.New("无权访问")
 	}
 	// 转换为DTO对象
@@ -380,7 +551,7 @@ func (s *UserService) GetAllUsers(page, pageSize int) ([]UserDTO, error) {
 // GetUserCount 获取所有用户的总数
 func (s *UserService) GetUserCount() (int64, error) {
 	// 添加访问控制逻辑
-	if s.Role != "admin" {
+	if !s.Can(PermUserManage) {
 		return 0, errors.New("无权访问")
 	}
 	return model.GetUserCount()
@@ -389,7 +560,7 @@ func (s *UserService) GetUserCount() (int64, error) {
 // GetUserByID 获取用户信息（Service层）
 func (s *UserService) GetUserByID(id uint) (*UserDTO, error) {
 	// 添加访问控制逻辑
-	if s.ID == id || s.Role == "admin" {
+	if s.ID == id || s.Can(PermUserManage) {
 		user, err := model.GetUserByID(id)
 		if err != nil {
 			return nil, err
@@ -402,13 +573,19 @@ func (s *UserService) GetUserByID(id uint) (*UserDTO, error) {
 
 // AddUser 添加一个用户
 func (s *UserService) AddUser(user *model.User) error {
-	if s.Role != "admin" {
+	if !s.Can(PermUserManage) {
 		return errors.New("只有管理员可以添加用户")
 	}
+	if IsValidRole(user.Role) && !s.canAssignRole(user.Role) {
+		return errors.New("不能授予权限超过自己的身份")
+	}
 	// 检查用户是否已存在
 	if exists, _ := model.UserExists(user.Username, user.Email); exists {
 		return utils.ErrUserAlreadyExists
 	}
+	if err := CheckPassword(user.Password, user.Username, user.Email); err != nil {
+		return err
+	}
 	// 密码加密
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
 	if err != nil {
@@ -424,7 +601,7 @@ func (s *UserService) AddUser(user *model.User) error {
 // SearchUsers 搜索用户
 func (s *UserService) SearchUsers(username, email string, status int, role string, page, pageSize int) ([]UserDTO, error) {
 	// 添加访问控制逻辑
-	if s.Role != "admin" {
+	if !s.Can(PermUserManage) {
 		return nil, errors.New("只有管理员可以搜索用户")
 	}
 	users, err := model.SearchUsers(username, email, status, role, page, pageSize)
@@ -438,7 +615,7 @@ func (s *UserService) SearchUsers(username, email string, status int, role strin
 // SearchUsersCount 获取符合搜索条件的用户总数
 func (s *UserService) SearchUsersCount(username, email string, status int, role string) (int64, error) {
 	// 添加访问控制逻辑
-	if s.Role != "admin" {
+	if !s.Can(PermUserManage) {
 		return 0, errors.New("只有管理员可以搜索用户")
 	}
 	return model.SearchUsersCount(username, email, status, role)
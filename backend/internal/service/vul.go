@@ -18,16 +18,6 @@ import (
 	"gorm.io/gorm"
 )
 
-func init() {
-	// 启动定时监控过期实例
-	StartMonitorExpiredInstances()
-	// 获取所有已经创建的漏洞环境依赖镜像
-	go func() {
-		time.Sleep(1 * time.Second) // 等待数据库加载
-		GetDependentImages()
-	}()
-}
-
 type VulService struct{}
 
 type VulImagesList []VulImage
@@ -101,7 +91,7 @@ func (v *VulService) GetVulImageFromLocal(path string) (VulImagesList, error) {
 func (v *VulService) GetVulImages() (VulImagesList, error) {
 	result := VulImagesList{}
 	// 从本地获取漏洞镜像信息
-	LocalVulImagesList, err := v.GetVulImageFromLocal(config.LocalImagePath)
+	LocalVulImagesList, err := v.GetVulImageFromLocal(config.Current().Storage.ImagePath)
 	if err != nil {
 		return nil, err
 	}
@@ -111,13 +101,12 @@ func (v *VulService) GetVulImages() (VulImagesList, error) {
 
 // 获取本地镜像仓库地址
 func (v *VulService) GetVulStoragePath() string {
-	return config.LocalImagePath
+	return config.Current().Storage.ImagePath
 }
 
-// 修改本地镜像仓库地址
+// 修改本地镜像仓库地址，仅在当前进程生效，需要持久化时使用 UserService.UpdateSettings
 func (v *VulService) SetVulStoragePath(path string) error {
-	config.LocalImagePath = path
-	return nil
+	return config.SetRuntime(map[string]string{"storage.image_path": path})
 }
 
 // 保存上传的JSON文件到本地镜像仓库
@@ -165,10 +154,11 @@ func (v *VulService) SaveUploadedJsonFile(filename string, base64FileData string
 		return fmt.Errorf("文件名包含路径分隔符")
 	}
 
-	filePath := filepath.Join(config.LocalImagePath, cleanFilename)
+	imagePath := config.Current().Storage.ImagePath
+	filePath := filepath.Join(imagePath, cleanFilename)
 
 	// 二次校验最终路径是否在目标目录下（防御编码攻击）
-	if !strings.HasPrefix(filepath.Clean(filePath), filepath.Clean(config.LocalImagePath)) {
+	if !strings.HasPrefix(filepath.Clean(filePath), filepath.Clean(imagePath)) {
 		middleware.SugarLogger.Errorf("非法存储路径: %s", filePath)
 		return fmt.Errorf("非法存储路径: %s", filePath)
 	}
@@ -194,6 +184,7 @@ type VulEnv struct {
 	From         string    `json:"from"`
 	Degree       VulDegree `json:"degree"`
 	Cost         float64   `json:"cost"`
+	Reward       float64   `json:"reward"` // 解出后获得的积分
 	IsOpen       int       `json:"is_open"`
 }
 
@@ -218,6 +209,7 @@ func ConvertToVulEnv(vulEnv *model.VulEnv) *VulEnv {
 		From:         vulEnv.From,
 		Degree:       degree,
 		Cost:         vulEnv.Cost,
+		Reward:       vulEnv.Reward,
 		IsOpen:       vulEnv.IsOpen,
 	}
 
@@ -304,7 +296,7 @@ func (v *VulService) GetDockerComposeFiles() ([]string, error) {
 	var composeFiles []string
 
 	// 使用filepath.Walk遍历目录
-	err := filepath.Walk(config.LocalImagePath, func(path string, info os.FileInfo, err error) error {
+	err := filepath.Walk(config.Current().Storage.ImagePath, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
@@ -333,7 +325,7 @@ func (v *VulService) UploadVulZip(base64Data string) error {
 	}
 
 	// 解压文件到指定目录
-	err = utils.Unzip(decodedData, config.LocalImagePath)
+	err = utils.Unzip(decodedData, config.Current().Storage.ImagePath)
 	if err != nil {
 		middleware.SugarLogger.Errorf("解压文件失败: %v", err)
 		return err
@@ -347,14 +339,20 @@ func (v *VulService) CreateVulEnv(vulEnv *VulEnv, conn *websocket.Conn) error {
 	if vulEnv.EnvName == "" || (vulEnv.Base_Image == "" && vulEnv.Base_compose == "") {
 		return fmt.Errorf("缺少必要字段")
 	}
+	if vulEnv.Reward < 0 {
+		return fmt.Errorf("奖励不能为负数")
+	}
 
 	// 检查环境名称是否已存在
 	if _, err := model.GetVulEnvByName(vulEnv.EnvName); err == nil {
 		return fmt.Errorf("环境名称已存在")
 	}
 
-	// 创建上下文
-	ctx, cancel := context.WithCancel(context.Background())
+	// 登记长耗时操作，停机时等待其完成
+	ctx, cancel, err := BeginOperation()
+	if err != nil {
+		return err
+	}
 	defer cancel()
 	go MonitorStopOperation(conn, cancel)
 	// 如果Base_Image存在 检查镜像是否存在
@@ -413,6 +411,7 @@ func (v *VulService) CreateVulEnv(vulEnv *VulEnv, conn *websocket.Conn) error {
 		Degree:      string(degreeJSON),
 		IsOpen:      vulEnv.IsOpen,
 		Cost:        vulEnv.Cost,
+		Reward:      vulEnv.Reward,
 	}
 
 	// 调用model层方法
@@ -461,6 +460,9 @@ func (v *VulService) DeleteVulEnv(EnvID uint, isDeleteImage bool) error {
 	if err := model.DeleteVulEnv(EnvID); err != nil {
 		return err
 	}
+	if err := model.DeleteAssignmentEnvsByVulEnvID(EnvID); err != nil {
+		middleware.SugarLogger.Warnw("从作业中移除漏洞环境失败", "vulEnvID", EnvID, "error", err.Error())
+	}
 
 	// 更新依赖列表
 	GetDependentImages()
@@ -477,6 +479,8 @@ type VulInstanceService struct {
 	ID          uint      `json:"id"`
 	UserID      uint      `json:"user_id"`
 	VulEnvID    uint      `json:"vul_env_id"`
+	TeamID      uint      `json:"team_id"`             // 0为个人实例
+	TeamName    string    `json:"team_name,omitempty"` // 团队实例所属团队
 	StartTime   time.Time `json:"start_time"`
 	EndTime     time.Time `json:"end_time"`
 	Status      int       `json:"status"` // 1-运行中 2-已停止 3-已完成
@@ -499,6 +503,7 @@ func ConvertVulInstanceModelToService(model *model.VulInstance) *VulInstanceServ
 		ID:          model.ID,
 		UserID:      model.UserID,
 		VulEnvID:    model.VulEnvID,
+		TeamID:      model.TeamID,
 		StartTime:   model.StartTime,
 		EndTime:     model.EndTime,
 		Status:      model.Status,
@@ -518,6 +523,7 @@ func ConvertVulInstanceModelToService(model *model.VulInstance) *VulInstanceServ
 		Rank:         model.VulEnv.Rank,
 		From:         model.VulEnv.From,
 		Cost:         model.VulEnv.Cost,
+		Reward:       model.VulEnv.Reward,
 		IsOpen:       model.VulEnv.IsOpen,
 	}
 	json.Unmarshal([]byte(model.VulEnv.Degree), &result.VulEnv.Degree) // 反序列化degree字段
@@ -552,6 +558,7 @@ func (v *VulService) GetVulEnvList(roleLevel int) (VulEnvList, error) {
 			From:         vul.From,
 			Degree:       degree,
 			Cost:         vul.Cost,
+			Reward:       vul.Reward,
 			IsOpen:       vul.IsOpen,
 		}
 		result = append(result, vulImage)
@@ -578,8 +585,8 @@ func (v *VulService) GetVulInstanceList() (VulInstanceList, error) {
 	return result, nil
 }
 
-// 创建场景实例
-func (v *VulService) CreateVulInstance(userID uint, vulEnvID uint) (*VulInstanceService, error) {
+// 创建场景实例，teamID不为0时以队员身份开启团队实例，同一团队每个环境只能有一个实例
+func (v *VulService) CreateVulInstance(userID, teamID, vulEnvID uint) (result *VulInstanceService, err error) {
 	// 检查环境是否存在
 	VulEnv, err := model.GetVulEnvByID(vulEnvID)
 	if err != nil {
@@ -593,28 +600,71 @@ func (v *VulService) CreateVulInstance(userID uint, vulEnvID uint) (*VulInstance
 	}
 
 	// 检查镜像是否对用户开放
-	if VulEnv.IsOpen < RoleMap[user.Role] {
+	if VulEnv.IsOpen < RoleLevel(user.Role) {
 		return nil, fmt.Errorf("镜像未开放")
 	}
 
-	// 检查用户是否有足够的余额
-	if user.Score < VulEnv.Cost {
-		return nil, fmt.Errorf("余额不足")
+	// 团队实例只能由队员开启
+	if teamID != 0 {
+		if _, err := model.GetTeamMember(teamID, userID); err != nil {
+			return nil, ErrNotTeamMember
+		}
 	}
 
-	// 扣除用户余额
-	if err = model.UpdateUserScore(userID, user.Score-VulEnv.Cost); err != nil {
-		return nil, fmt.Errorf("扣除余额失败: %v", err)
+	// 检查用户(团队)是否已经有该环境的实例
+	var instance *model.VulInstance
+	var findErr error
+	if teamID != 0 {
+		instance, findErr = model.GetTeamVulInstance(teamID, vulEnvID)
+	} else {
+		instance, findErr = model.GetVulInstanceBy2ID(userID, vulEnvID)
 	}
-
-	// 检查用户是否已经有该环境的实例
-	instance, err := model.GetVulInstanceBy2ID(userID, vulEnvID)
-	if err == nil && instance.Status == 1 { // 1 表示运行中
+	if findErr == nil && instance.Status == 1 { // 1 表示运行中
+		if teamID != 0 {
+			return nil, fmt.Errorf("团队已经有该环境的实例")
+		}
 		return nil, fmt.Errorf("用户已经有该环境的实例")
 	}
 
-	// 创建场景实例
-	newVulInstance := model.VulInstance{}
+	// 生成实例flag，注入到所有容器中
+	flag, err := newInstanceFlag()
+	if err != nil {
+		return nil, fmt.Errorf("生成flag失败: %v", err)
+	}
+	flagEnv, flagFiles := flagInjection(flag)
+
+	// 扣除开销并写入创建中的实例记录，与已有实例的检查在同一事务中完成，并发开启时只有一个请求成功
+	now := time.Now()
+	newVulInstance := model.VulInstance{
+		UserID:     userID,
+		TeamID:     teamID,
+		VulEnvID:   vulEnvID,
+		Flag:       flag,
+		StartTime:  now,
+		ExpireTime: now.Add(instanceLifetime(userID, vulEnvID, now)),
+	}
+	charge, err := reserveLaunch(&newVulInstance, VulEnv)
+	if err != nil {
+		return nil, err
+	}
+	// 之后创建失败时删除已启动的容器和实例记录，再自动退还开销
+	defer func() {
+		if err != nil {
+			abortLaunch(&newVulInstance, charge, err)
+		}
+	}()
+
+	// 清理已停止的旧实例(如停机时被停止的实例)，避免容器名冲突
+	if findErr == nil {
+		if err := v.RemoveVulInstance(instance); err != nil {
+			return nil, fmt.Errorf("清理旧实例失败: %v", err)
+		}
+	}
+	// 个人实例按用户命名，团队实例按团队命名
+	owner := fmt.Sprint(user.ID)
+	if teamID != 0 {
+		owner = fmt.Sprintf("team-%d", teamID)
+	}
 
 	ports := map[string]string{}
 
@@ -630,12 +680,16 @@ func (v *VulService) CreateVulInstance(userID uint, vulEnvID uint) (*VulInstance
 			return nil, fmt.Errorf("获取镜像端口映射失败: %v", err)
 		}
 		// 启动镜像
-		containerName := normalizeProjectName(utils.MD5Encode(string(user.ID) + VulEnv.EnvName))
-		containerID, err := CreateContainer(VulEnv.BaseImage, containerName, nil, ports)
+		containerName := normalizeProjectName(utils.MD5Encode(owner + VulEnv.EnvName))
+		containerID, err := CreateContainer(VulEnv.BaseImage, containerName, flagEnv, flagFiles, ports, InstanceLabels(userID, teamID, vulEnvID))
 		if err != nil {
 			return nil, fmt.Errorf("启动镜像失败: %v", err)
 		}
 		newVulInstance.ContainerID = containerID
+		// 立即记录容器，进程在开启过程中退出时对账可以找到并删除
+		if err := model.UpdateVulInstanceResources(newVulInstance.ID, containerID, ""); err != nil {
+			return nil, fmt.Errorf("记录实例容器失败: %v", err)
+		}
 	}
 	if VulEnv.BaseCompose != "" {
 		imageList, err := GetImagesFromCompose(VulEnv.BaseCompose)
@@ -649,33 +703,56 @@ func (v *VulService) CreateVulInstance(userID uint, vulEnvID uint) (*VulInstance
 		}
 		// 启动docker compose 环境
 		ports = map[string]string{}
-		stackName := normalizeProjectName(utils.MD5Encode(string(user.ID) + VulEnv.EnvName))
-		err = CreateFromCompose(VulEnv.BaseCompose, stackName, &ports)
+		stackName := normalizeProjectName(utils.MD5Encode(owner + VulEnv.EnvName))
+		newVulInstance.StackName = stackName
+		if err := model.UpdateVulInstanceResources(newVulInstance.ID, newVulInstance.ContainerID, stackName); err != nil {
+			return nil, fmt.Errorf("记录实例堆栈失败: %v", err)
+		}
+		err = CreateFromCompose(VulEnv.BaseCompose, stackName, &ports, InstanceLabels(userID, teamID, vulEnvID), flagEnv, flagFiles)
 		if err != nil {
-			RemoveStackByName(stackName)
 			return nil, fmt.Errorf("启动docker compose 环境失败: %v", err)
 		}
-		newVulInstance.StackName = stackName
 	}
 	portsStr, err := json.Marshal(ports)
 	if err != nil {
 		return nil, fmt.Errorf("JSON序列化失败: %v", err)
 	}
 	newVulInstance.Ports = string(portsStr)
-	// 填充基本信息
-	newVulInstance.UserID = userID
-	newVulInstance.VulEnvID = vulEnvID
 	newVulInstance.Status = 1 // 1 表示运行中
 	newVulInstance.StartTime = time.Now()
-	newVulInstance.ExpireTime = time.Now().Add(config.DefaultExpirationTime)
+	newVulInstance.ExpireTime = newVulInstance.StartTime.Add(instanceLifetime(userID, vulEnvID, newVulInstance.StartTime))
 	// 调用model层方法
-	if err := model.CreateVulInstance(&newVulInstance); err != nil {
+	if err := model.UpdateVulInstance(&newVulInstance); err != nil {
 		return nil, fmt.Errorf("创建失败: %v", err)
 	}
-	result := ConvertVulInstanceModelToService(&newVulInstance)
+	// 记录学生在作业中的进度
+	if err := model.RecordAssignmentLaunch(userID, vulEnvID, newVulInstance.StartTime); err != nil {
+		middleware.SugarLogger.Warnw("记录作业进度失败", "userID", userID, "vulEnvID", vulEnvID, "error", err.Error())
+	}
+	result = ConvertVulInstanceModelToService(&newVulInstance)
 	return result, nil
 }
 
+// abortLaunch 开启实例失败时删除已启动的容器和堆栈以及创建中的实例记录，再退还开销
+func abortLaunch(instance *model.VulInstance, charge *model.ScoreEntry, cause error) {
+	if instance.ContainerID != "" {
+		if err := RemoveContainer(instance.ContainerID, true); err != nil {
+			middleware.SugarLogger.Errorw("删除开启失败的实例容器失败", "containerID", instance.ContainerID, "error", err.Error())
+		}
+	}
+	if instance.StackName != "" {
+		if err := RemoveStackByName(instance.StackName); err != nil {
+			middleware.SugarLogger.Errorw("删除开启失败的实例堆栈失败", "stackName", instance.StackName, "error", err.Error())
+		}
+	}
+	if err := model.DeleteVulInstance(instance.ID); err != nil {
+		middleware.SugarLogger.Errorw("删除开启失败的实例记录失败", "instanceID", instance.ID, "error", err.Error())
+	}
+	if charge != nil {
+		refundLaunchCost(charge, cause)
+	}
+}
+
 // 获取指定用户的漏洞实例
 func (v *VulService) GetVulInstanceByUserID(userID uint) (VulInstanceList, error) {
 	// 调用model层方法
@@ -690,6 +767,31 @@ func (v *VulService) GetVulInstanceByUserID(userID uint) (VulInstanceList, error
 	return result, nil
 }
 
+// 获取用户所在团队的实例
+func (v *VulService) GetTeamInstancesByUserID(userID uint) (VulInstanceList, error) {
+	teams, err := model.GetTeamsByUserID(userID)
+	if err != nil {
+		return nil, fmt.Errorf("获取团队失败: %v", err)
+	}
+	names := make(map[uint]string, len(teams))
+	teamIDs := make([]uint, 0, len(teams))
+	for _, team := range teams {
+		names[team.ID] = team.Name
+		teamIDs = append(teamIDs, team.ID)
+	}
+	instances, err := model.GetVulInstancesByTeamIDs(teamIDs)
+	if err != nil {
+		return nil, fmt.Errorf("获取失败: %v", err)
+	}
+	result := VulInstanceList{}
+	for _, instance := range instances {
+		dto := ConvertVulInstanceModelToService(&instance)
+		dto.TeamName = names[instance.TeamID]
+		result = append(result, *dto)
+	}
+	return result, nil
+}
+
 // 根据vulEnvID删除实例环境
 func (v *VulService) StopVulInstanceByVulEnvID(vulEnvID uint) error {
 	// 获取实例信息
@@ -715,14 +817,27 @@ func (v *VulService) StopVulInstanceByVulEnvID(vulEnvID uint) error {
 	return nil
 }
 
-// 删除指定用户的实例环境
+// 删除指定用户的个人实例环境
 func (v *VulService) DeleteVulInstance(userID uint, vulEnvID uint) error {
 	// 获取实例信息
 	instance, err := model.GetVulInstanceBy2ID(userID, vulEnvID)
 	if err != nil {
 		return fmt.Errorf("实例不存在")
 	}
+	return v.RemoveVulInstance(instance)
+}
+
+// 删除团队的实例环境
+func (v *VulService) DeleteTeamVulInstance(teamID uint, vulEnvID uint) error {
+	instance, err := model.GetTeamVulInstance(teamID, vulEnvID)
+	if err != nil {
+		return fmt.Errorf("实例不存在")
+	}
+	return v.RemoveVulInstance(instance)
+}
 
+// RemoveVulInstance 删除实例的容器或堆栈以及实例记录
+func (v *VulService) RemoveVulInstance(instance *model.VulInstance) error {
 	// 根据实例类型执行不同的删除逻辑
 	if instance.ContainerID != "" {
 		// 删除单容器实例
@@ -737,7 +852,7 @@ func (v *VulService) DeleteVulInstance(userID uint, vulEnvID uint) error {
 	}
 
 	// 更新数据库状态为已删除
-	if err := model.DeleteVulInstanceBy2ID(userID, vulEnvID); err != nil {
+	if err := model.DeleteVulInstance(instance.ID); err != nil {
 		return fmt.Errorf("更新数据库失败: %v", err)
 	}
 
@@ -770,43 +885,59 @@ func (v *VulService) GetAllVulInstances() (VulInstanceList, error) {
 	return result, nil
 }
 
-// 启动定时监控过期实例
-func StartMonitorExpiredInstances() {
-	ticker := time.NewTicker(1 * time.Minute)
+// 启动定时监控过期实例，ctx取消后停止
+func StartMonitorExpiredInstances(ctx context.Context) {
 	v := &VulService{}
-	go func() {
-		for range ticker.C {
-			v.checkAndCleanExpiredInstances()
-		}
-	}()
+	runPeriodic(ctx, "expired-instance-monitor", 1*time.Minute, v.checkAndCleanExpiredInstances)
 }
 
 // 检查并清理过期实例
 func (v *VulService) checkAndCleanExpiredInstances() error {
+	_, err := v.CleanExpiredInstances(false)
+	return err
+}
+
+// CleanExpiredInstances 删除已过期的实例，dryRun时只返回过期的实例
+func (v *VulService) CleanExpiredInstances(dryRun bool) ([]model.VulInstance, error) {
 	// 获取所有运行中的实例
 	instances, err := model.GetAllVulInstances()
 	if err != nil {
 		middleware.SugarLogger.Errorf("监控器获取实例列表失败: %v", err)
-		return err
+		return nil, err
 	}
 
+	// 开启过程中断的实例需要退还开销，不按过期删除
+	if !dryRun {
+		if err := cleanInterruptedLaunches(instances); err != nil {
+			middleware.SugarLogger.Errorf("监控器清理开启中断的实例失败: %v", err)
+		}
+	}
+
+	var expired []model.VulInstance
 	now := time.Now()
 	for _, instance := range instances {
+		if instance.Status == model.InstanceStatusNone {
+			continue
+		}
 		// 检查实例是否已过期且仍在运行
 		if instance.ExpireTime.Before(now) {
-			err = v.DeleteVulInstance(instance.UserID, instance.VulEnvID)
-			if err != nil {
-				middleware.SugarLogger.Errorf("监控器删除实例失败: %v", err)
-				return err
+			if !dryRun {
+				err = v.RemoveVulInstance(&instance)
+				if err != nil {
+					middleware.SugarLogger.Errorf("监控器删除实例失败: %v", err)
+					return expired, err
+				}
 			}
+			expired = append(expired, instance)
 		}
 	}
-	return nil
+	return expired, nil
 }
 
-// 延长实例时间
+// 延长实例时间，每次延长的时间和最多延长次数由运行时配置决定
 func (v *VulService) ExtendExpireTime(id uint) error {
-	return model.ExtendExpireTime(id)
+	conf := config.Current().Instance
+	return model.ExtendExpireTime(id, conf.ExtendDuration.Std(), conf.MaxExtensions)
 }
 
 // 全局依赖镜像列表
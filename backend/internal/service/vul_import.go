@@ -0,0 +1,139 @@
+package service
+
+import (
+	"AscensionPath/config"
+	"AscensionPath/internal/middleware"
+	"AscensionPath/internal/model"
+	"AscensionPath/internal/utils"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// 导入结果
+const (
+	ImportCreated = "created" // 已创建
+	ImportSkipped = "skipped" // 同名环境已存在，跳过
+	ImportFailed  = "failed"  // 创建失败
+)
+
+// ImportResult 单个漏洞环境的导入结果
+type ImportResult struct {
+	EnvName string `json:"env_name"`
+	Source  string `json:"source"` // 镜像名或compose文件路径
+	Result  string `json:"result"`
+	Error   string `json:"error,omitempty"`
+}
+
+// ImportVulEnvs 从目录批量导入漏洞环境：
+// 目录下的*.json为镜像列表(与上传的镜像列表格式相同)，包含docker-compose.yml的子目录为复合环境，
+// 复合环境会复制到本地镜像仓库后再创建。同名环境已存在时跳过
+func (v *VulService) ImportVulEnvs(dir string) ([]ImportResult, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("读取目录失败: %v", err)
+	}
+
+	var envs []VulEnv
+	var composeDirs []string
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		if entry.IsDir() {
+			if utils.IsPathExist(filepath.Join(path, "docker-compose.yml")) {
+				composeDirs = append(composeDirs, path)
+			}
+			continue
+		}
+		if !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		images, err := readVulImages(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, image := range images {
+			envs = append(envs, VulEnv{
+				EnvName:    image.ImageVulName,
+				EnvDesc:    image.ImageDesc,
+				EnvType:    "单镜像",
+				Base_Image: image.ImageName,
+				Rank:       image.Rank,
+				From:       image.From,
+				Degree:     image.Degree,
+			})
+		}
+	}
+
+	var results []ImportResult
+	for _, env := range envs {
+		results = append(results, v.importVulEnv(env, env.Base_Image))
+	}
+
+	imagePath := config.Current().Storage.ImagePath
+	for _, src := range composeDirs {
+		name := filepath.Base(src)
+		env := VulEnv{
+			EnvName:      name,
+			EnvDesc:      "基于Docker Compose的多服务环境",
+			EnvType:      "复合环境",
+			Base_compose: filepath.Join(imagePath, name, "docker-compose.yml"),
+			Rank:         4.0,
+			From:         "compose",
+		}
+		if _, err := model.GetVulEnvByName(name); err == nil {
+			results = append(results, ImportResult{EnvName: name, Source: src, Result: ImportSkipped})
+			continue
+		}
+		dst := filepath.Join(imagePath, name)
+		if err := utils.CopyDir(src, dst); err != nil {
+			results = append(results, ImportResult{EnvName: name, Source: src, Result: ImportFailed, Error: err.Error()})
+			continue
+		}
+		result := v.importVulEnv(env, src)
+		if result.Result == ImportFailed {
+			// 删除复制的文件，修复后可以重新导入
+			os.RemoveAll(dst)
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// importVulEnv 创建单个漏洞环境(拉取/构建镜像)
+func (v *VulService) importVulEnv(env VulEnv, source string) ImportResult {
+	result := ImportResult{EnvName: env.EnvName, Source: source, Result: ImportCreated}
+	if _, err := model.GetVulEnvByName(env.EnvName); err == nil {
+		result.Result = ImportSkipped
+		return result
+	}
+	if err := v.CreateVulEnv(&env, nil); err != nil {
+		result.Result = ImportFailed
+		result.Error = err.Error()
+		middleware.SugarLogger.Errorf("导入环境 %s 失败: %v", env.EnvName, err)
+	}
+	return result
+}
+
+// readVulImages 读取镜像列表文件，兼容单个镜像对象
+func readVulImages(path string) (VulImagesList, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取文件 %s 失败: %v", path, err)
+	}
+	var images VulImagesList
+	if err := json.Unmarshal(data, &images); err != nil {
+		var image VulImage
+		if err := json.Unmarshal(data, &image); err != nil {
+			return nil, fmt.Errorf("解析文件 %s 失败: %v", path, err)
+		}
+		images = VulImagesList{image}
+	}
+	for _, image := range images {
+		if image.ImageName == "" || image.ImageVulName == "" {
+			return nil, fmt.Errorf("文件 %s 缺少 image_name 或 image_vul_name", path)
+		}
+	}
+	return images, nil
+}
@@ -168,3 +168,34 @@ func IsPathExist(targetPath string) bool {
 	}
 	return true
 }
+
+// CopyDir 递归复制目录，目标目录已存在时返回错误
+func CopyDir(src, dst string) error {
+	if _, err := os.Stat(dst); err == nil {
+		return fmt.Errorf("目录已存在: %s", dst)
+	}
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		switch {
+		case info.IsDir():
+			return os.MkdirAll(target, 0755)
+		case info.Mode().IsRegular():
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			return os.WriteFile(target, data, info.Mode().Perm())
+		default:
+			// 跳过符号链接等特殊文件，避免复制目录以外的内容
+			return nil
+		}
+	})
+}
@@ -0,0 +1,35 @@
+package utils
+
+import (
+	"AscensionPath/config"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// OriginAllowed 请求来源是否可以访问接口和建立WebSocket连接：来源取Origin，没有时取Referer的协议和主机，
+// 两者都没有的非浏览器请求和同源请求始终允许，其余来源须在 security.allowed_origins 中
+func OriginAllowed(r *http.Request) bool {
+	origin := strings.ToLower(r.Header.Get("Origin"))
+	if origin == "" {
+		// 跨站点击链接等顶层GET导航不带Origin，只能从Referer判断来源
+		referer := r.Header.Get("Referer")
+		if referer == "" {
+			return true
+		}
+		u, err := url.Parse(referer)
+		if err != nil || u.Host == "" {
+			return false
+		}
+		origin = strings.ToLower(u.Scheme + "://" + u.Host)
+	}
+	if u, err := url.Parse(origin); err == nil && u.Host != "" && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	for _, o := range config.Current().Security.Origins() {
+		if o == origin {
+			return true
+		}
+	}
+	return false
+}
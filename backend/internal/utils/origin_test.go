@@ -0,0 +1,54 @@
+package utils
+
+import (
+	"AscensionPath/config"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOriginAllowed(t *testing.T) {
+	conf := config.Default()
+	conf.Security.AllowedOrigins = "https://lab.example.edu/, HTTP://localhost:3006"
+	oldConf := config.Current()
+	config.Set(conf)
+	t.Cleanup(func() { config.Set(oldConf) })
+
+	for _, tc := range []struct {
+		name    string
+		origin  string
+		referer string
+		allowed bool
+	}{
+		{"没有来源的非浏览器请求", "", "", true},
+		{"同源", "http://ctf.example.edu", "", true},
+		{"同源不区分大小写", "http://CTF.example.edu", "", true},
+		{"白名单", "https://lab.example.edu", "", true},
+		{"白名单忽略配置的末尾斜杠和大小写", "http://localhost:3006", "", true},
+		{"其他网站", "https://evil.example.com", "", false},
+		{"端口不同", "http://ctf.example.edu:8080", "", false},
+		{"协议不同的白名单来源", "http://lab.example.edu", "", false},
+		{"白名单域名作为前缀", "https://lab.example.edu.evil.com", "", false},
+		{"null来源", "null", "", false},
+
+		// 没有Origin时按Referer判断
+		{"同源Referer", "", "http://ctf.example.edu/static/#/vul", true},
+		{"白名单Referer", "", "https://lab.example.edu/course?id=1", true},
+		{"其他网站的Referer", "", "https://evil.example.com/ctf.example.edu", false},
+		{"无效的Referer", "", "not a url", false},
+		{"Origin优先于Referer", "https://evil.example.com", "http://ctf.example.edu/", false},
+		{"Origin允许时忽略Referer", "https://lab.example.edu", "https://evil.example.com/", true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "http://ctf.example.edu/api/v1/vul/pullImage", nil)
+			if tc.origin != "" {
+				r.Header.Set("Origin", tc.origin)
+			}
+			if tc.referer != "" {
+				r.Header.Set("Referer", tc.referer)
+			}
+			if got := OriginAllowed(r); got != tc.allowed {
+				t.Errorf("OriginAllowed(Origin=%q, Referer=%q) = %v", tc.origin, tc.referer, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package utils
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+// RFC 6238 附录B的SHA-1密钥"12345678901234567890"的Base32编码
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// rfcVectors RFC 6238 附录B的SHA-1测试向量，取8位验证码的后6位
+var rfcVectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "287082"},
+	{1111111109, "081804"},
+	{1111111111, "050471"},
+	{1234567890, "005924"},
+	{2000000000, "279037"},
+	{20000000000, "353130"},
+}
+
+func TestTOTPCode(t *testing.T) {
+	for _, v := range rfcVectors {
+		code, err := TOTPCode(rfcSecret, TOTPStep(time.Unix(v.unix, 0)))
+		if err != nil || code != v.code {
+			t.Errorf("T=%d 的验证码 = %q, %v，期望 %q", v.unix, code, err, v.code)
+		}
+	}
+	// 小写和带填充的密钥同样可用
+	if code, _ := TOTPCode("gezdgnbvgy3tqojqgezdgnbvgy3tqojq====", 1); code != rfcVectors[0].code {
+		t.Errorf("小写密钥的验证码 = %q", code)
+	}
+	if _, err := TOTPCode("not base32!", 1); err == nil {
+		t.Error("无效的密钥应返回错误")
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	step := TOTPStep(now)
+	for _, tc := range []struct {
+		name   string
+		offset int64
+		ok     bool
+	}{
+		{"当前时间步", 0, true},
+		{"前一个时间步", -1, true},
+		{"后一个时间步", 1, true},
+		{"前两个时间步", -2, false},
+		{"后两个时间步", 2, false},
+	} {
+		code, _ := TOTPCode(rfcSecret, step+tc.offset)
+		matched, ok := ValidateTOTP(rfcSecret, code, now)
+		if ok != tc.ok || (ok && matched != step+tc.offset) {
+			t.Errorf("%s: ValidateTOTP = %d, %v", tc.name, matched, ok)
+		}
+	}
+
+	// 容忍空格，拒绝位数不对的验证码和无效的密钥
+	if _, ok := ValidateTOTP(rfcSecret, " 050 471 ", now); !ok {
+		t.Error("应忽略验证码中的空格")
+	}
+	for _, code := range []string{"", "05047", "0504710", "abcdef"} {
+		if _, ok := ValidateTOTP(rfcSecret, code, now); ok {
+			t.Errorf("验证码 %q 不应通过", code)
+		}
+	}
+	if _, ok := ValidateTOTP("not base32!", "050471", now); ok {
+		t.Error("无效的密钥不应通过")
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil || len(secret) != 32 {
+		t.Fatalf("GenerateTOTPSecret = %q, %v", secret, err)
+	}
+
+	u, err := url.Parse(TOTPURI("Ascension Path", "alice@example.edu", secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Scheme != "otpauth" || u.Host != "totp" || u.Path != "/Ascension Path:alice@example.edu" {
+		t.Errorf("otpauth链接 = %s", u)
+	}
+	q := u.Query()
+	for key, want := range map[string]string{
+		"secret":    secret,
+		"issuer":    "Ascension Path",
+		"algorithm": "SHA1",
+		"digits":    "6",
+		"period":    "30",
+	} {
+		if q.Get(key) != want {
+			t.Errorf("参数 %s = %q，期望 %q", key, q.Get(key), want)
+		}
+	}
+}
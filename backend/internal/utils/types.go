@@ -13,6 +13,14 @@ var (
 	ErrInvalidCredentials = errors.New("无效的凭证")
 	ErrUserAlreadyExists  = errors.New("用户已存在")
 	ErrJsonMarshal        = errors.New("JSON解析失败")
+	ErrExtendLimitReached = errors.New("实例延长次数已达上限")
+	ErrInvalidSetting     = errors.New("配置无效")
+	ErrWeakPassword       = errors.New("密码不符合安全要求")
+	ErrAlreadySolved      = errors.New("已经解出过该环境")
+	ErrTeamAlreadySolved  = errors.New("团队已经解出过该环境")
+	ErrInsufficientScore  = errors.New("余额不足")
+	ErrAlreadyRefunded    = errors.New("开销已经退还")
+	ErrInstanceExists     = errors.New("已经有该环境的实例")
 )
 
 // Message 基础响应结构体
@@ -10,9 +10,7 @@ import (
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
-	CheckOrigin: func(r *http.Request) bool {
-		return true // 允许跨域
-	},
+	CheckOrigin:     OriginAllowed, // 与CORS使用同一来源白名单，防止其他网站借用户的cookie建立连接
 }
 
 // UpgradeToWebSocket 升级HTTP连接到WebSocket
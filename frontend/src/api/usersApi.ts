@@ -28,6 +28,142 @@ export class UserService {
     })
   }
 
+  // 登录第二步：校验两步验证码或恢复码
+  static loginTwoFactor(options: { body: any }): Promise<BaseResult> {
+    return api
+      .post<BaseResult>({
+        url: `/api/v1/users/login/twoFactor`,
+        data: options.body
+      })
+      .catch((error) => ({
+        code: error.response?.status || 500,
+        message: error.response?.data?.message || '服务器错误',
+        data: null
+      }))
+  }
+
+  // 获取单点登录配置
+  static getOIDCConfig(): Promise<BaseResult<{ enabled: boolean; display_name: string }>> {
+    return api
+      .get<BaseResult>({
+        url: `/api/v1/users/oidc`
+      })
+      .catch(() => ({ code: 500, message: '服务器错误', data: { enabled: false, display_name: '' } }))
+  }
+
+  // 获取密码策略及是否可以自助重置密码
+  static getPasswordPolicy(): Promise<BaseResult<{ min_length: number; reset_enabled: boolean }>> {
+    return api
+      .get<BaseResult>({
+        url: `/api/v1/users/passwordPolicy`
+      })
+      .catch(() => ({ code: 500, message: '服务器错误', data: { min_length: 8, reset_enabled: false } }))
+  }
+
+  // 申请通过邮件重置密码
+  static forgotPassword(email: string): Promise<BaseResult> {
+    return api
+      .post<BaseResult>({
+        url: `/api/v1/users/forgotPassword`,
+        data: { code: 200, message: '忘记密码', data: { email } }
+      })
+      .catch((error) => ({
+        code: error.response?.status || 500,
+        message: error.response?.data?.message || '服务器错误',
+        data: null
+      }))
+  }
+
+  // 使用邮件中的令牌设置新密码
+  static resetPassword(token: string, password: string): Promise<BaseResult> {
+    return api
+      .post<BaseResult>({
+        url: `/api/v1/users/resetPassword`,
+        data: { code: 200, message: '重置密码', data: { token, password } }
+      })
+      .catch((error) => ({
+        code: error.response?.status || 500,
+        message: error.response?.data?.message || '服务器错误',
+        data: null
+      }))
+  }
+
+  // 获取注册方式：closed/open/invite/domain，以及允许的邮箱域名和账号激活方式
+  static getRegistrationInfo(): Promise<
+    BaseResult<{ mode: string; allowed_domains: string[]; activation: string }>
+  > {
+    return api
+      .get<BaseResult>({
+        url: `/api/v1/users/registration`
+      })
+      .catch(() => ({
+        code: 500,
+        message: '服务器错误',
+        data: { mode: 'closed', allowed_domains: [], activation: 'admin' }
+      }))
+  }
+
+  // 注册账号，邀请模式下需要邀请码
+  static register(body: {
+    username: string
+    password: string
+    email: string
+    invite_code: string
+  }): Promise<BaseResult> {
+    return api
+      .post<BaseResult>({
+        url: `/api/v1/users/register`,
+        data: { code: 200, message: '注册', data: body }
+      })
+      .catch((error) => ({
+        code: error.response?.status || 500,
+        message: error.response?.data?.message || '服务器错误',
+        data: null
+      }))
+  }
+
+  // 使用验证邮件中的令牌激活账号
+  static verifyEmail(token: string): Promise<BaseResult> {
+    return api
+      .post<BaseResult>({
+        url: `/api/v1/users/verifyEmail`,
+        data: { code: 200, message: '验证邮箱', data: { token } }
+      })
+      .catch((error) => ({
+        code: error.response?.status || 500,
+        message: error.response?.data?.message || '服务器错误',
+        data: null
+      }))
+  }
+
+  // 重新发送验证邮件
+  static resendVerification(email: string): Promise<BaseResult> {
+    return api
+      .post<BaseResult>({
+        url: `/api/v1/users/resendVerification`,
+        data: { code: 200, message: '重新发送验证邮件', data: { email } }
+      })
+      .catch((error) => ({
+        code: error.response?.status || 500,
+        message: error.response?.data?.message || '服务器错误',
+        data: null
+      }))
+  }
+
+  // 单点登录：用IdP回调后得到的一次性登录码换取会话
+  static loginOIDC(code: string): Promise<BaseResult> {
+    return api
+      .post<BaseResult>({
+        url: `/api/v1/users/oidc/exchange`,
+        data: { code: 200, message: '单点登录', data: { code } }
+      })
+      .catch((error) => ({
+        code: error.response?.status || 500,
+        message: error.response?.data?.message || '服务器错误',
+        data: null
+      }))
+  }
+
   // 获取用户信息
   static getUserInfo(): Promise<BaseResult<UserInfo>> {
     const userid = useUserStore().getUserInfo.id
@@ -59,4 +195,12 @@ export class UserService {
         })
     })
   }
+
+  // 退出登录，注销服务端会话
+  static logout(): Promise<void> {
+    return api
+      .post<BaseResult>({ url: `/api/v1/users/logout` })
+      .then(() => undefined)
+      .catch(() => undefined)
+  }
 }
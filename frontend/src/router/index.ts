@@ -19,6 +19,7 @@ import { RoutesAlias } from './modules/routesAlias'
 import { setWorktab } from '@/utils/worktab'
 import { registerAsyncRoutes } from './modules/dynamicRoutes'
 import { formatMenuTitle } from '@/utils/menu'
+import { hasPermission } from '@/utils/permission'
 
 /** 顶部进度条配置 */
 NProgress.configure({
@@ -52,6 +53,24 @@ const staticRoutes: AppRouteRecordRaw[] = [
     component: () => import('@views/register/index.vue'),
     meta: { title: 'menus.register.title', isHideTab: true, noLogin: true, setTheme: true }
   },
+  {
+    path: RoutesAlias.ForgetPassword,
+    name: 'ForgetPassword',
+    component: () => import('@views/forget-password/index.vue'),
+    meta: { title: 'menus.forgetPassword.title', isHideTab: true, noLogin: true, setTheme: true }
+  },
+  {
+    path: RoutesAlias.ResetPassword,
+    name: 'ResetPassword',
+    component: () => import('@views/reset-password/index.vue'),
+    meta: { title: 'menus.resetPassword.title', isHideTab: true, noLogin: true, setTheme: true }
+  },
+  {
+    path: RoutesAlias.VerifyEmail,
+    name: 'VerifyEmail',
+    component: () => import('@views/verify-email/index.vue'),
+    meta: { title: 'menus.verifyEmail.title', isHideTab: true, noLogin: true, setTheme: true }
+  },
   {
     path: '/exception',
     component: Home,
@@ -175,11 +194,8 @@ router.beforeEach(async (to, from, next) => {
   }
 
   // 检查路由权限
-  if (to.meta.roles) {
-    const userRole = userStore.getUserInfo.role
-    if (!userRole || !hasPermission(userRole, to.meta.roles as string[])) {
-      return next('/exception/403')
-    }
+  if (!hasPermission(to.meta.permissions as string[] | undefined)) {
+    return next('/exception/403')
   }
 
   // 检查路由是否存在，若不存在则跳转至404页面
@@ -194,26 +210,6 @@ router.beforeEach(async (to, from, next) => {
   next()
 })
 
-// 新增权限校验函数
-function hasPermission(userRole: string, requiredRoles: string[]): boolean {
-  if (!requiredRoles || requiredRoles.length === 0) return true
-  
-  // 管理员可以访问所有路由
-  if (userRole === 'admin') return true
-  
-  // VIP用户可以访问vip和user权限的路由
-  if (userRole === 'vip') {
-    return requiredRoles.some(role => role === 'vip' || role === 'user')
-  }
-  
-  // 普通用户只能访问user权限的路由
-  if (userRole === 'user') {
-    return requiredRoles.includes('user')
-  }
-  
-  // 默认拒绝其他角色
-  return false
-}
 
 /**
  * 根据接口返回的菜单列表注册动态路由
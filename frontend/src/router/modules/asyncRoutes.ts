@@ -31,7 +31,7 @@ export const asyncRoutes: MenuListType[] = [
         meta: {
           title:'menus.ImageManager.ImageList',
           keepAlive: false,
-          roles: ['admin']
+          permissions: ['image:view', 'image:manage']
         }
       },
       {
@@ -42,7 +42,7 @@ export const asyncRoutes: MenuListType[] = [
         meta: {
           title:'menus.ImageManager.CreateVulEnv',
           keepAlive: false,
-          roles: ['admin']
+          permissions: ['image:manage']
         }
       },
       {
@@ -63,7 +63,7 @@ export const asyncRoutes: MenuListType[] = [
         meta: {
           title:'menus.ImageManager.InstanceManage',
           keepAlive: false,
-          roles: ['admin']
+          permissions: ['instance:view_all']
         },
       }
     ]
@@ -87,7 +87,37 @@ export const asyncRoutes: MenuListType[] = [
         meta: {
           title: 'menus.user.account',
           keepAlive: false,
-          roles: ['admin']
+          permissions: ['user:manage']
+        }
+      },
+      {
+        id: 302,
+        path: 'team',
+        name: 'Team',
+        component: RoutesAlias.Team,
+        meta: {
+          title: 'menus.user.team',
+          keepAlive: false
+        }
+      },
+      {
+        id: 303,
+        path: 'course',
+        name: 'Course',
+        component: RoutesAlias.Course,
+        meta: {
+          title: 'menus.user.course',
+          keepAlive: false
+        }
+      },
+      {
+        id: 305,
+        path: 'scoreboard',
+        name: 'Scoreboard',
+        component: RoutesAlias.Scoreboard,
+        meta: {
+          title: 'menus.user.scoreboard',
+          keepAlive: false
         }
       },
       {
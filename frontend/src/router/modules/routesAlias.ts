@@ -5,12 +5,18 @@ export enum RoutesAlias {
   Home = '/index/index', // 首页
   Login = '/login', // 登录
   Register = '/register', // 注册
+  ForgetPassword = '/forgetPassword', // 忘记密码
+  ResetPassword = '/resetPassword', // 重置密码
+  VerifyEmail = '/verifyEmail', // 验证邮箱
   Exception403 = '/exception/403', // 403
   Exception404 = '/exception/404', // 404
   Exception500 = '/exception/500', // 500
   Fireworks = '/widgets/Fireworks', // 礼花效果
   Account = '/user/Account', // 账户
   UserCenter = '/user/User', // 用户中心
+  Team = '/user/Team', // 团队
+  Course = '/user/Course', // 课程
+  Scoreboard = '/user/Scoreboard', // 排行榜
   Setting = '/system/Setting', // 设置
   ImageList = '/image-manage/imageList', // 镜像管理
   CreateVulEnv = '/image-manage/createVulEnv', // 漏洞环境
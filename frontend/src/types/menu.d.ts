@@ -15,7 +15,7 @@ export type MenuListType = {
     keepAlive: boolean // 是否缓存
     authList?: Array // 可操作权限
     isInMainContainer?: boolean // 是否在主容器中
-    roles?: string[] // 角色列表
+    permissions?: string[] // 需要的权限，拥有任一即可访问
   }
   children?: MenuListType[] // 子菜单
 }
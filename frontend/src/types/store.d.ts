@@ -8,6 +8,7 @@ export interface UserInfo {
   email: string
   role: string
   score: number
+  permissions?: string[] // 身份拥有的权限
 }
 
 // 系统主题样式（light | dark）
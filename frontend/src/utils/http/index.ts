@@ -7,6 +7,10 @@ const axiosInstance = axios.create({
   timeout: 15000, // 请求超时时间(毫秒)
   baseURL: import.meta.env.VITE_API_URL, // API地址
   withCredentials: true, // 异步请求携带cookie
+  // CSRF双重提交：读取后端下发的 csrf_token cookie 放入请求头，开发环境跨端口请求也需要携带
+  xsrfCookieName: 'csrf_token',
+  xsrfHeaderName: 'X-CSRF-Token',
+  withXSRFToken: true,
   transformRequest: [(data) => JSON.stringify(data)], // 请求数据转换为 JSON 字符串
   validateStatus: (status) => status >= 200 && status < 300, // 只接受 2xx 的状态码
   headers: {
@@ -49,10 +53,53 @@ axiosInstance.interceptors.request.use(
   }
 )
 
+// 刷新访问令牌，并发的 401 请求共用同一次刷新
+let refreshing: Promise<string> | null = null
+function refreshAccessToken(): Promise<string> {
+  if (!refreshing) {
+    const userStore = useUserStore()
+    refreshing = axiosInstance
+      .post('/api/v1/users/refresh', { data: { refresh_token: userStore.refreshToken } })
+      .then((res) => {
+        userStore.setToken(res.data.data.token, res.data.data.refresh_token)
+        return res.data.data.token as string
+      })
+      .finally(() => {
+        refreshing = null
+      })
+  }
+  return refreshing
+}
+
+// 不需要刷新令牌重试的接口
+const noRefreshUrls = ['/api/v1/users/login', '/api/v1/users/refresh', '/api/v1/users/logout']
+
 // 响应拦截器
 axiosInstance.interceptors.response.use(
   (response: AxiosResponse) => response,
-  (error) => {
+  async (error) => {
+    const config = error.config as (InternalAxiosRequestConfig & { _retried?: boolean }) | undefined
+    // 访问令牌过期时用刷新令牌换取新令牌后重试一次
+    if (
+      error.response?.status === 401 &&
+      config &&
+      !config._retried &&
+      !noRefreshUrls.some((url) => config.url?.includes(url))
+    ) {
+      config._retried = true
+      try {
+        const token = await refreshAccessToken()
+        config.headers.set('Authorization', token)
+        // 重试时请求体已被序列化，避免再次转换
+        if (typeof config.data === 'string') {
+          config.data = JSON.parse(config.data)
+        }
+        return axiosInstance.request(config)
+      } catch {
+        window.location.href = '/login'
+        return Promise.reject(error)
+      }
+    }
     if (axios.isCancel(error)) {
       console.log('repeated request: ' + error.message)
     } else {
@@ -0,0 +1,11 @@
+import { useUserStore } from '@/store/modules/user'
+
+/**
+ * 当前用户是否拥有任一权限
+ * 权限由后端的身份配置决定，登录和获取用户信息时下发
+ */
+export function hasPermission(required?: string[]): boolean {
+  if (!required || required.length === 0) return true
+  const permissions = useUserStore().getUserInfo.permissions || []
+  return required.some((p) => permissions.includes(p))
+}